@@ -16,18 +16,10 @@ limitations under the License.
 
 package main
 
-import (
-	alertmanager "github.com/openshift/autoheal/pkg/alertmanager"
-	autoheal "github.com/openshift/autoheal/pkg/apis/autoheal"
-)
-
 type ActionRunnerType int
 
 const (
 	ActionRunnerTypeAWX ActionRunnerType = iota
 	ActionRunnerTypeBatch
+	ActionRunnerTypeAWXWorkflow
 )
-
-type ActionRunner interface {
-	RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error
-}
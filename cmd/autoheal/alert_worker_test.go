@@ -17,20 +17,41 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/openshift/autoheal/pkg/alertmanager"
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/auditlog"
+	"github.com/openshift/autoheal/pkg/batchrunner"
+	"github.com/openshift/autoheal/pkg/receiver"
+	"github.com/openshift/autoheal/pkg/runner"
+	"github.com/openshift/autoheal/pkg/slackrunner"
+	"github.com/openshift/autoheal/pkg/testutil"
 	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
 func TestPickAlert(t *testing.T) {
 	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
 	healer, err := NewHealerBuilder().
 		ConfigFile(file).
+		MinimumRunnersRequired(0).
 		Build()
 
 	if err != nil {
@@ -56,17 +77,15 @@ func TestStartHealingAWXJob(t *testing.T) {
 	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
 	healer, err := NewHealerBuilder().
 		ConfigFile(file).
+		MinimumRunnersRequired(0).
 		Build()
 
 	if err != nil {
 		t.Error(err)
 	}
 
-	actionRunner := FakeActionRunner{
-		RuleAlertMap: make(map[string]*alertmanager.Alert),
-	}
-
-	healer.actionRunners[ActionRunnerTypeAWX] = actionRunner
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
 
 	alert := &alertmanager.Alert{
 		Status: "firing",
@@ -90,34 +109,231 @@ func TestStartHealingAWXJob(t *testing.T) {
 	// Add the rule to rulesCache
 	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
 
-	healer.startHealing(alert)
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
 
-	expected := map[string]*alertmanager.Alert{
-		rule.ObjectMeta.Name: alert,
+	calls := fake.AWXJobs()
+	if len(calls) != 1 {
+		t.Fatalf("Expected exactly one AWX action but got %d", len(calls))
+	}
+	if calls[0].Rule.ObjectMeta.Name != rule.ObjectMeta.Name {
+		t.Errorf("Expected the action to be triggered by rule '%s', but it was triggered by '%s'",
+			rule.ObjectMeta.Name,
+			calls[0].Rule.ObjectMeta.Name,
+		)
+	}
+	if calls[0].Alert != alert {
+		t.Errorf("Expected the action to receive alert %+v, instead got %+v", alert, calls[0].Alert)
 	}
+	action := calls[0].Action.(*autoheal.AWXJobAction)
+	if action.Template != "Test AWX JOB" {
+		t.Errorf("Expected template 'Test AWX JOB' but got '%s'", action.Template)
+	}
+}
 
-	if reflect.DeepEqual(expected, actionRunner.RuleAlertMap) != true {
-		t.Errorf("Expected action runner map to be equal to %+v, instead got %+v",
-			expected,
-			actionRunner.RuleAlertMap)
+func TestStartHealingAWXWorkflowJob(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWXWorkflow] = fake
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": "ClusterDown",
+			"instance":  "master0",
+		},
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "test-workflow-rule",
+		},
+		Labels: map[string]string{
+			"alertname": "ClusterDown",
+		},
+		WorkflowJob: &autoheal.AWXWorkflowAction{
+			Template: "Heal cluster",
+			Limit:    "{{ $labels.instance }}",
+		},
+	}
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+
+	err = healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := fake.AWXWorkflowJobs()
+	if len(calls) != 1 {
+		t.Fatalf("Expected exactly one AWX workflow action but got %d", len(calls))
+	}
+	action := calls[0].Action.(*autoheal.AWXWorkflowAction)
+	if action.Template != "Heal cluster" {
+		t.Errorf("Expected template 'Heal cluster' but got '%s'", action.Template)
+	}
+	if action.Limit != "master0" {
+		t.Errorf("Expected limit 'master0' but got '%s'", action.Limit)
 	}
 }
 
-func TestStartHealingBatchJob(t *testing.T) {
+func TestDryRunDoesntRunAction(t *testing.T) {
 	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
 	healer, err := NewHealerBuilder().
 		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		DryRun(true).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"mylabel": "myvalue",
+		},
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "test-rule",
+		},
+		Labels: map[string]string{
+			"mylabel": "myvalue",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Test AWX JOB",
+			ExtraVars: map[string]interface{}{
+				"label": "{{ $labels.mylabel }}",
+			},
+		},
+	}
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+
+	// Process the alert twice, the second time it shouldn't be throttled because the action
+	// isn't remembered in dry run mode:
+	for i := 0; i < 2; i++ {
+		entry := receiver.NewHistoryEntry(alert)
+		healer.startHealing(alert, entry)
+		if len(entry.Actions) != 1 {
+			t.Fatalf("Expected exactly one action in the history but got %d", len(entry.Actions))
+		}
+		if entry.Actions[0].Outcome != receiver.ActionOutcomeDryRun {
+			t.Errorf(
+				"Expected outcome '%s' but got '%s'",
+				receiver.ActionOutcomeDryRun,
+				entry.Actions[0].Outcome,
+			)
+		}
+	}
+
+	calls := fake.AWXJobs()
+	if len(calls) != 0 {
+		t.Errorf("Expected no AWX action in dry run mode but got %d", len(calls))
+	}
+	if healer.actionMemory.Len() != 0 {
+		t.Errorf("Expected the action memory to be empty but it has %d actions", healer.actionMemory.Len())
+	}
+}
+
+func TestRunRuleRecordsAuditEntry(t *testing.T) {
+	configMaps := &fakeConfigMaps{
+		items: make(map[string]*core.ConfigMap),
+	}
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		KubernetesClient(&fakeConfigMapsClient{configMaps: configMaps}).
+		AuditConfigMap("my-audit").
+		AuditNamespace("my-namespace").
 		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "node-down",
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Restart node",
+		},
+	}
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
 
+	// Write the audit log and check its content:
+	err = healer.auditRecorder.Flush()
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if configMaps.namespace != "my-namespace" {
+		t.Errorf("Expected namespace 'my-namespace', but got '%s'", configMaps.namespace)
+	}
+	configMap, ok := configMaps.items["my-audit"]
+	if !ok {
+		t.Fatalf("Expected config map 'my-audit' to be created")
+	}
+	var entries []*auditlog.Entry
+	err = json.Unmarshal([]byte(configMap.Data[auditlog.DataKey]), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected one audit entry, but got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.RuleName != "node-down" || entry.AlertName != "NodeDown" {
+		t.Errorf("Expected entry for rule 'node-down' and alert 'NodeDown', but got %+v", entry)
+	}
+	if entry.ActionType != "AWXJobAction" || !entry.Success {
+		t.Errorf("Expected successful entry for an AWX job, but got %+v", entry)
 	}
+}
 
-	actionRunner := FakeActionRunner{
-		RuleAlertMap: make(map[string]*alertmanager.Alert),
+func TestAuditConfigMapRequiresClient(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		AuditConfigMap("my-audit").
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error when recording the audit log without a Kubernetes client")
+	}
+}
+
+func TestStartHealingBatchJob(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+
+	if err != nil {
+		t.Error(err)
 	}
 
-	healer.actionRunners[ActionRunnerTypeBatch] = actionRunner
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeBatch] = fake
 
 	alert := &alertmanager.Alert{
 		Status: "firing",
@@ -143,15 +359,1186 @@ func TestStartHealingBatchJob(t *testing.T) {
 
 	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
 
-	healer.startHealing(alert)
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
 
-	expected := map[string]*alertmanager.Alert{
-		rule.ObjectMeta.Name: alert,
+	calls := fake.BatchJobs()
+	if len(calls) != 1 {
+		t.Fatalf("Expected exactly one batch action but got %d", len(calls))
+	}
+	if calls[0].Rule.ObjectMeta.Name != rule.ObjectMeta.Name {
+		t.Errorf("Expected the action to be triggered by rule '%s', but it was triggered by '%s'",
+			rule.ObjectMeta.Name,
+			calls[0].Rule.ObjectMeta.Name,
+		)
+	}
+	if calls[0].Alert != alert {
+		t.Errorf("Expected the action to receive alert %+v, instead got %+v", alert, calls[0].Alert)
+	}
+	job := calls[0].Action.(*batch.Job)
+	if job.ObjectMeta.Name != "hello" {
+		t.Errorf("Expected job 'hello' but got '%s'", job.ObjectMeta.Name)
 	}
+}
 
-	if reflect.DeepEqual(expected, actionRunner.RuleAlertMap) != true {
-		t.Errorf("Expected action runner map to be equal to %+v, instead got %+v",
-			expected,
-			actionRunner.RuleAlertMap)
+func TestBatchJobImageOverrideTemplate(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeBatch] = fake
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname":  "BadImage",
+			"prev_image": "myapp:v1.2.2",
+		},
+	}
+
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "rollback-image",
+		},
+		Labels: map[string]string{
+			"alertname": "BadImage",
+		},
+		BatchJob: &batch.Job{
+			ObjectMeta: meta.ObjectMeta{
+				Name: "rollback",
+				Annotations: map[string]string{
+					batchrunner.ImageOverrideAnnotation: "{{ $labels.prev_image }}",
+				},
+			},
+		},
+	}
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+
+	calls := fake.BatchJobs()
+	if len(calls) != 1 {
+		t.Fatalf("Expected exactly one batch action but got %d", len(calls))
+	}
+	job := calls[0].Action.(*batch.Job)
+	image := job.ObjectMeta.Annotations[batchrunner.ImageOverrideAnnotation]
+	if image != "myapp:v1.2.2" {
+		t.Errorf("Expected image override 'myapp:v1.2.2' but got '%s'", image)
+	}
+}
+
+func TestBatchJobNameTemplate(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeBatch] = fake
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": "nodedown",
+			"node":      "node-1",
+			"namespace": "infra",
+		},
+	}
+	rule := makeTemplatedBatchRule()
+	err = healer.runRule(rule, alert, receiver.NewHistoryEntry(alert))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := fake.BatchJobs()
+	if len(calls) != 1 {
+		t.Fatalf("Expected exactly one batch action but got %d", len(calls))
+	}
+	job := calls[0].Action.(*batch.Job)
+	if job.ObjectMeta.Name != "heal-node-1-nodedown" {
+		t.Errorf("Expected job 'heal-node-1-nodedown' but got '%s'", job.ObjectMeta.Name)
+	}
+	if job.ObjectMeta.Namespace != "infra" {
+		t.Errorf("Expected namespace 'infra' but got '%s'", job.ObjectMeta.Namespace)
+	}
+}
+
+func TestBatchJobNameTemplateProducesInvalidName(t *testing.T) {
+	// The batch runner checks the name before using the client, so the fake client that doesn't
+	// implement any method is enough:
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		KubernetesClient(&FakeKubernetesClient{}).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+			"node":      "Node_1",
+			"namespace": "infra",
+		},
+	}
+	rule := makeTemplatedBatchRule()
+	err = healer.runRule(rule, alert, receiver.NewHistoryEntry(alert))
+	if err == nil {
+		t.Fatalf("Expected an error for the invalid job name, but got nil")
+	}
+	if !strings.Contains(err.Error(), "heal-Node_1-NodeDown") {
+		t.Errorf("Expected the error to contain the invalid name, but got: %s", err)
+	}
+}
+
+func makeTemplatedBatchRule() *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "heal-node",
+		},
+		BatchJob: &batch.Job{
+			ObjectMeta: meta.ObjectMeta{
+				Namespace: "{{ $labels.namespace }}",
+				Name:      "heal-{{ $labels.node }}-{{ $labels.alertname }}",
+			},
+		},
+	}
+}
+
+func TestStartHealingRunsRulesInNameOrder(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"mylabel": "myvalue",
+		},
+	}
+
+	// Add the rules in reverse order, and enough of them to make it very unlikely that the
+	// iteration order of the cache matches the alphabetical order by chance:
+	names := []string{"zulu", "yankee", "x-ray", "whiskey", "victor", "uniform", "tango", "sierra"}
+	for _, name := range names {
+		rule := &autoheal.HealingRule{
+			ObjectMeta: meta.ObjectMeta{
+				Name: name,
+			},
+			Labels: map[string]string{
+				"mylabel": "myvalue",
+			},
+			AWXJob: &autoheal.AWXJobAction{
+				Template: "Template for " + name,
+			},
+		}
+		healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+	}
+
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+
+	calls := fake.AWXJobs()
+	if len(calls) != len(names) {
+		t.Fatalf("Expected %d AWX actions but got %d", len(names), len(calls))
+	}
+	for i, call := range calls {
+		expected := names[len(names)-1-i]
+		if call.Rule.ObjectMeta.Name != expected {
+			t.Errorf("Expected rule %d to be '%s' but it is '%s'", i, expected, call.Rule.ObjectMeta.Name)
+		}
+	}
+}
+
+func TestStripLabelsDontAffectMatching(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname":  "NodeDown",
+			"receiver":   "autoheal",
+			"alertstate": "firing",
+		},
+		Annotations: map[string]string{
+			"receiver": "autoheal",
+		},
+	}
+
+	// This rule uses only labels that aren't stripped, so it should match:
+	healer.rulesCache.Store("node-down", &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "node-down",
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Start node",
+		},
+	})
+
+	// These rules use stripped labels and annotations, so they shouldn't match:
+	healer.rulesCache.Store("by-receiver", &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "by-receiver",
+		},
+		Labels: map[string]string{
+			"receiver": "autoheal",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Receiver",
+		},
+	})
+	healer.rulesCache.Store("by-annotation", &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "by-annotation",
+		},
+		Annotations: map[string]string{
+			"receiver": "autoheal",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Annotation",
+		},
+	})
+
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+
+	calls := fake.AWXJobs()
+	if len(calls) != 1 {
+		t.Fatalf("Expected exactly one AWX action but got %d", len(calls))
+	}
+	if calls[0].Rule.ObjectMeta.Name != "node-down" {
+		t.Errorf("Expected rule 'node-down' to run but '%s' did", calls[0].Rule.ObjectMeta.Name)
+	}
+
+	// The original alert should still have the stripped labels, also the one passed to the action:
+	if alert.Labels["receiver"] != "autoheal" || alert.Labels["alertstate"] != "firing" {
+		t.Errorf("Expected the original alert labels to be kept, but got %v", alert.Labels)
+	}
+	if alert.Annotations["receiver"] != "autoheal" {
+		t.Errorf("Expected the original alert annotations to be kept, but got %v", alert.Annotations)
+	}
+	if calls[0].Alert != alert {
+		t.Errorf("Expected the action to receive the original alert")
+	}
+}
+
+func TestStripLabelsDisabled(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		StripLabels(nil).
+		Build()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"receiver": "autoheal",
+		},
+	}
+	healer.rulesCache.Store("by-receiver", &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "by-receiver",
+		},
+		Labels: map[string]string{
+			"receiver": "autoheal",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Receiver",
+		},
+	})
+
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+
+	if len(fake.AWXJobs()) != 1 {
+		t.Errorf("Expected the rule to match when labels aren't stripped, but got %d actions",
+			len(fake.AWXJobs()))
+	}
+}
+
+func TestTrimLabelValues(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		TrimLabelValues(true).
+		Build()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+
+	alert := makeUntrimmedAlert()
+	healer.rulesCache.Store("node-down", makeAnchoredRule())
+
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+
+	calls := fake.AWXJobs()
+	if len(calls) != 1 {
+		t.Fatalf("Expected the rule to match the trimmed values, but got %d actions", len(calls))
+	}
+
+	// The values passed to the action should be the original ones:
+	if calls[0].Alert.Labels["alertname"] != " NodeDown " {
+		t.Errorf("Expected the original label value, but got '%s'", calls[0].Alert.Labels["alertname"])
+	}
+}
+
+func TestTrimLabelValuesDisabled(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+
+	alert := makeUntrimmedAlert()
+	healer.rulesCache.Store("node-down", makeAnchoredRule())
+
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+
+	if len(fake.AWXJobs()) != 0 {
+		t.Errorf("Expected the rule to not match untrimmed values, but got %d actions",
+			len(fake.AWXJobs()))
+	}
+}
+
+// makeUntrimmedAlert creates an alert whose label and annotation values have leading and trailing
+// white space.
+//
+func makeUntrimmedAlert() *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": " NodeDown ",
+		},
+		Annotations: map[string]string{
+			"severity": "\tcritical\n",
+		},
+	}
+}
+
+// makeAnchoredRule creates a rule with patterns that match the complete values of the label and the
+// annotation of the alert created by makeUntrimmedAlert, but without the white space.
+//
+func makeAnchoredRule() *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "node-down",
+		},
+		Labels: map[string]string{
+			"alertname": "^NodeDown$",
+		},
+		Annotations: map[string]string{
+			"severity": "^critical$",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Start node",
+		},
+	}
+}
+
+func TestRulesExecutedInOrderOfPriority(t *testing.T) {
+	healer, fake := makePriorityHealer(t,
+		makePriorityRule("a-low", -1, false),
+		makePriorityRule("b-default", 0, false),
+		makePriorityRule("c-high", 10, false),
+		makePriorityRule("a-default", 0, false),
+	)
+	alert := makePriorityAlert()
+	err := healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExecutedRules(t, fake, "c-high", "a-default", "b-default", "a-low")
+}
+
+func TestRuleStopOnFirst(t *testing.T) {
+	healer, fake := makePriorityHealer(t,
+		makePriorityRule("high", 10, false),
+		makePriorityRule("stop", 5, true),
+		makePriorityRule("low", 0, false),
+	)
+	alert := makePriorityAlert()
+	err := healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExecutedRules(t, fake, "high", "stop")
+}
+
+func TestRuleStopOnFirstContinuesIfThrottled(t *testing.T) {
+	healer, fake := makePriorityHealer(t,
+		makePriorityRule("stop", 5, true),
+		makePriorityRule("low", 0, false),
+	)
+	alert := makePriorityAlert()
+
+	// The first time the rule stops the execution, the second time its action is throttled so
+	// the next rule is executed:
+	for i := 0; i < 2; i++ {
+		err := healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkExecutedRules(t, fake, "stop", "low")
+}
+
+// makePriorityHealer creates a healer with the given rules and a fake AWX runner.
+//
+func makePriorityHealer(t *testing.T, rules ...*autoheal.HealingRule) (*Healer, *testutil.FakeHealer) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+	for _, rule := range rules {
+		healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+	}
+	return healer, fake
+}
+
+// makePriorityRule creates a rule that matches the alert created by makePriorityAlert, with an AWX
+// job whose template is the name of the rule, so that each rule has a different action.
+//
+func makePriorityRule(name string, priority int, stop bool) *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: name,
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		Priority:    priority,
+		StopOnFirst: stop,
+		AWXJob: &autoheal.AWXJobAction{
+			Template: name,
+		},
+	}
+}
+
+func makePriorityAlert() *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+}
+
+// checkExecutedRules checks that the fake runner has executed the actions of the given rules, in
+// the given order.
+//
+func checkExecutedRules(t *testing.T, fake *testutil.FakeHealer, expected ...string) {
+	calls := fake.AWXJobs()
+	actual := make([]string, len(calls))
+	for i, call := range calls {
+		actual[i] = call.Rule.ObjectMeta.Name
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected rules %v to be executed, but got %v", expected, actual)
+	}
+}
+
+func TestStartHealingPlugin(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	actionRunner := FakeActionRunner{
+		RuleAlertMap: make(map[string]*alertmanager.Alert),
+	}
+
+	healer.pluginRunners["my-plugin"] = actionRunner
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"mylabel": "plugin-value",
+		},
+	}
+
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "test-plugin-rule",
+		},
+		Labels: map[string]string{
+			"mylabel": "plugin-value",
+		},
+		Plugin: &autoheal.PluginAction{
+			Type: "my-plugin",
+		},
+	}
+
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+
+	expected := map[string]*alertmanager.Alert{
+		rule.ObjectMeta.Name: alert,
+	}
+
+	if reflect.DeepEqual(expected, actionRunner.RuleAlertMap) != true {
+		t.Errorf("Expected action runner map to be equal to %+v, instead got %+v",
+			expected,
+			actionRunner.RuleAlertMap)
+	}
+}
+
+func TestStartHealingWebhookJob(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+			"instance":  "node0",
+		},
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "test-webhook-rule",
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		WebhookJob: &autoheal.WebhookAction{
+			URL:  server.URL,
+			Body: `{"node": "{{ $labels.instance }}"}`,
+		},
+	}
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+
+	err = healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"node": "node0"}`
+	if body != expected {
+		t.Errorf("Expected webhook body '%s', but got '%s'", expected, body)
+	}
+}
+
+func TestStartHealingSlackJob(t *testing.T) {
+	var payload slackrunner.Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer healer.config.ShutDown()
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+			"instance":  "node0",
+		},
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "test-slack-rule",
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		SlackJob: &autoheal.SlackAction{
+			WebhookURL:    server.URL,
+			Channel:       "#ops",
+			TitleTemplate: "Node {{ $labels.instance }} is down",
+			Message:       "Restarting {{ $labels.instance }}",
+		},
+	}
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+
+	err = healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Channel != "#ops" {
+		t.Errorf("Expected channel '#ops', but got '%s'", payload.Channel)
+	}
+	expected := "*Node node0 is down*\nRestarting node0"
+	if payload.Text != expected {
+		t.Errorf("Expected text '%s', but got '%s'", expected, payload.Text)
+	}
+}
+
+func TestStartHealingUnknownPlugin(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	alert := &alertmanager.Alert{
+		Status: "firing",
+	}
+
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "test-unknown-plugin-rule",
+		},
+		Plugin: &autoheal.PluginAction{
+			Type: "unknown",
+		},
+	}
+
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+
+	err = healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+	if err == nil {
+		t.Errorf("Expected an error for a rule that uses an unknown plugin")
+	}
+}
+
+func TestCommonLabelsTemplate(t *testing.T) {
+	message, err := alertmanager.ParseMessage(
+		[]byte(`{
+			"commonLabels": {"severity": "critical"},
+			"commonAnnotations": {"summary": "Node is down"},
+			"alerts": [{"labels": {"alertname": "NodeDown"}}]
+		}`),
+		alertmanager.MessageVersionAuto,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := NewObjectTemplateBuilder().
+		Variable("commonLabels", ".CommonLabels").
+		Variable("commonAnnotations", ".CommonAnnotations").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	action := &autoheal.AWXJobAction{
+		Template: "{{ $commonLabels.severity }}: {{ $commonAnnotations.summary }}",
+	}
+	err = template.Process(action, message.Alerts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "critical: Node is down"
+	if action.Template != expected {
+		t.Errorf("Expected '%s', but got '%s'", expected, action.Template)
+	}
+}
+
+func TestGeneratorURLPatternMatches(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	rule := makeGeneratorURLRule(`^https://prometheus\.cluster-a\.example\.com/`)
+	alert := makeGeneratorURLAlert("https://prometheus.cluster-a.example.com/graph?g0.expr=up")
+
+	matches, err := healer.checkRule(rule, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matches {
+		t.Errorf("Expected the rule to match the generator URL '%s'", alert.GeneratorURL)
+	}
+}
+
+func TestGeneratorURLPatternDoesntMatch(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	rule := makeGeneratorURLRule(`^https://prometheus\.cluster-a\.example\.com/`)
+	alert := makeGeneratorURLAlert("https://prometheus.cluster-b.example.com/graph?g0.expr=up")
+
+	matches, err := healer.checkRule(rule, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches {
+		t.Errorf("Expected the rule to not match the generator URL '%s'", alert.GeneratorURL)
+	}
+}
+
+func TestGeneratorURLTemplate(t *testing.T) {
+	message, err := alertmanager.ParseMessage(
+		[]byte(`{
+			"alerts": [{
+				"labels": {"alertname": "NodeDown"},
+				"generatorURL": "https://prometheus.cluster-a.example.com/graph"
+			}]
+		}`),
+		alertmanager.MessageVersionAuto,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := newAlertTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	action := &autoheal.AWXJobAction{
+		Template: "Heal {{ $generatorURL }}",
+	}
+	err = template.Process(action, message.Alerts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Heal https://prometheus.cluster-a.example.com/graph"
+	if action.Template != expected {
+		t.Errorf("Expected '%s', but got '%s'", expected, action.Template)
+	}
+}
+
+func makeGeneratorURLRule(pattern string) *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "cluster-a-node-down",
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		GeneratorURLPattern: pattern,
+	}
+}
+
+func makeGeneratorURLAlert(url string) *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		GeneratorURL: url,
+	}
+}
+
+func TestProcessAlertSkipsSilencedAlert(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{
+			"id": "1",
+			"status": {"state": "active"},
+			"matchers": [{"name": "alertname", "value": "NodeDown", "isRegex": false}]
+		}]`))
+	}))
+	defer server.Close()
+	healer, fake := makeSilenceHealer(t, server.URL)
+
+	err := healer.processAlert(makeSilenceAlert("NodeDown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.AWXJobs()) != 0 {
+		t.Errorf("Expected no actions for a silenced alert, but got %d", len(fake.AWXJobs()))
+	}
+	if len(healer.history.List()) != 0 {
+		t.Errorf("Expected a silenced alert to not be added to the history")
+	}
+}
+
+func TestProcessAlertHealsAlertThatIsntSilenced(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	healer, fake := makeSilenceHealer(t, server.URL)
+
+	err := healer.processAlert(makeSilenceAlert("NodeDown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.AWXJobs()) != 1 {
+		t.Errorf("Expected one action, but got %d", len(fake.AWXJobs()))
+	}
+}
+
+func TestProcessAlertHealsWhenSilenceCheckFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	healer, fake := makeSilenceHealer(t, server.URL)
+
+	err := healer.processAlert(makeSilenceAlert("NodeDown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.AWXJobs()) != 1 {
+		t.Errorf("Expected one action when the silence check fails, but got %d", len(fake.AWXJobs()))
+	}
+}
+
+// makeSilenceHealer creates a healer that checks silences in the given alert manager, and that has
+// one rule that runs an AWX job for the 'NodeDown' alert.
+//
+func TestPickAlertRequeuesAlertWhenRunnerIsSaturated(t *testing.T) {
+	healer, fake := makeSilenceHealer(t, "")
+	fake.AWXJobError = &runner.RetryableError{
+		Reason: "Too many active jobs",
+	}
+
+	alert := makeSilenceAlert("NodeDown")
+	atomic.AddInt64(&healer.pendingAlerts, 1)
+	healer.alertsQueue.Add(alert)
+	healer.pickAlert()
+
+	if healer.alertsQueue.NumRequeues(alert) != 1 {
+		t.Errorf("Expected the alert to be requeued once, but got %d", healer.alertsQueue.NumRequeues(alert))
+	}
+	if atomic.LoadInt64(&healer.pendingAlerts) != 1 {
+		t.Errorf("Expected the alert to still be pending, but got %d", healer.pendingAlerts)
+	}
+
+	// When the runner isn't saturated anymore the action shouldn't be considered as recently
+	// executed:
+	fake.AWXJobError = nil
+	err := healer.processAlert(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.AWXJobs()) != 2 {
+		t.Errorf("Expected the action to be run again, but got %d calls", len(fake.AWXJobs()))
+	}
+}
+
+func TestHandleMessageDeduplicatesAlerts(t *testing.T) {
+	healer, fake := makeSilenceHealer(t, "")
+	defer healer.alertsQueue.ShutDown()
+
+	message := &alertmanager.Message{
+		Alerts: []*alertmanager.Alert{
+			makeSilenceAlert("NodeDown"),
+			makeSilenceAlert("NodeDown"),
+		},
+	}
+	healer.handleMessage(message)
+	if pending := atomic.LoadInt64(&healer.pendingAlerts); pending != 1 {
+		t.Errorf("Expected one pending alert, but got %d", pending)
+	}
+
+	// Process the queued alerts:
+	go healer.runAlertsWorker()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&healer.pendingAlerts) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(fake.AWXJobs()) != 1 {
+		t.Errorf("Expected the action to be run once, but got %d calls", len(fake.AWXJobs()))
+	}
+}
+
+func TestHandleMessageIgnoresNullAlerts(t *testing.T) {
+	healer, _ := makeSilenceHealer(t, "")
+	defer healer.alertsQueue.ShutDown()
+
+	message := &alertmanager.Message{
+		Alerts: []*alertmanager.Alert{
+			nil,
+			makeSilenceAlert("NodeDown"),
+			nil,
+		},
+	}
+	healer.handleMessage(message)
+	if pending := atomic.LoadInt64(&healer.pendingAlerts); pending != 1 {
+		t.Errorf("Expected one pending alert, but got %d", pending)
+	}
+}
+
+func TestHandleMessageKeepsAlertsWithDifferentStatus(t *testing.T) {
+	healer, _ := makeSilenceHealer(t, "")
+	defer healer.alertsQueue.ShutDown()
+
+	resolved := makeSilenceAlert("NodeDown")
+	resolved.Status = alertmanager.AlertStatusResolved
+	message := &alertmanager.Message{
+		Alerts: []*alertmanager.Alert{
+			makeSilenceAlert("NodeDown"),
+			resolved,
+			makeSilenceAlert("DiskFull"),
+		},
+	}
+	healer.handleMessage(message)
+	if pending := atomic.LoadInt64(&healer.pendingAlerts); pending != 3 {
+		t.Errorf("Expected three pending alerts, but got %d", pending)
+	}
+}
+
+func TestDisabledRuleIsNotExecuted(t *testing.T) {
+	healer, fake := makeSilenceHealer(t, "")
+	defer healer.config.ShutDown()
+	value, _ := healer.rulesCache.Load("node-down")
+	enabled := false
+	value.(*autoheal.HealingRule).Enabled = &enabled
+
+	err := healer.processAlert(makeSilenceAlert("NodeDown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.AWXJobs()) != 0 {
+		t.Errorf("Expected the disabled rule to not be executed, but got %d calls", len(fake.AWXJobs()))
+	}
+}
+
+func TestExplicitlyEnabledRuleIsExecuted(t *testing.T) {
+	healer, fake := makeSilenceHealer(t, "")
+	defer healer.config.ShutDown()
+	value, _ := healer.rulesCache.Load("node-down")
+	enabled := true
+	value.(*autoheal.HealingRule).Enabled = &enabled
+
+	err := healer.processAlert(makeSilenceAlert("NodeDown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.AWXJobs()) != 1 {
+		t.Errorf("Expected the enabled rule to be executed once, but got %d calls", len(fake.AWXJobs()))
+	}
+}
+
+func makeSilenceHealer(t *testing.T, silenceURL string) (*Healer, *testutil.FakeHealer) {
+	dir, err := ioutil.TempDir("", "silence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yml")
+	content := fmt.Sprintf("silenceCheckURL: %s\n", silenceURL)
+	err = ioutil.WriteFile(file, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "node-down",
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Restart node",
+		},
+	}
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+
+	return healer, fake
+}
+
+func makeSilenceAlert(name string) *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": name,
+		},
+	}
+}
+
+// fakeConfigMapsClient is a Kubernetes client that only implements the parts of the API used to
+// manage config maps. Calling any other method will panic.
+//
+type fakeConfigMapsClient struct {
+	kubernetes.Interface
+	configMaps *fakeConfigMaps
+}
+
+func (c *fakeConfigMapsClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeCoreV1{configMaps: c.configMaps}
+}
+
+// fakeConfigMaps keeps the config maps in memory, indexed by name. It remembers the namespace used.
+//
+type fakeConfigMaps struct {
+	corev1.ConfigMapInterface
+	items     map[string]*core.ConfigMap
+	namespace string
+}
+
+func (c *fakeConfigMaps) Get(name string, options meta.GetOptions) (*core.ConfigMap, error) {
+	configMap, ok := c.items[name]
+	if !ok {
+		return nil, errors.NewNotFound(core.Resource("configmaps"), name)
+	}
+	return configMap.DeepCopy(), nil
+}
+
+func (c *fakeConfigMaps) Create(configMap *core.ConfigMap) (*core.ConfigMap, error) {
+	c.items[configMap.ObjectMeta.Name] = configMap
+	return configMap, nil
+}
+
+func (c *fakeConfigMaps) Update(configMap *core.ConfigMap) (*core.ConfigMap, error) {
+	c.items[configMap.ObjectMeta.Name] = configMap
+	return configMap, nil
+}
+
+// benchmarkAlertsCount is the number of alerts checked in each iteration of the checkMap
+// benchmarks.
+//
+const benchmarkAlertsCount = 10000
+
+func BenchmarkCheckMap(b *testing.B) {
+	healer := makeHealer(b, "empty")
+	defer healer.config.ShutDown()
+	patterns, alerts := makeBenchmarkAlerts()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, labels := range alerts {
+			_, err := healer.checkMap(labels, patterns)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkCheckMapWithoutCache(b *testing.B) {
+	patterns, alerts := makeBenchmarkAlerts()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, labels := range alerts {
+			_, err := checkMapWithoutCache(labels, patterns)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// makeBenchmarkAlerts returns the label patterns of a typical rule, and the labels of the alerts
+// used by the checkMap benchmarks, half of them matching the patterns.
+//
+func makeBenchmarkAlerts() (patterns map[string]string, alerts []map[string]string) {
+	patterns = map[string]string{
+		"alertname": "^(NodeDown|NodeNotReady)$",
+		"severity":  "^(critical|warning)$",
+		"instance":  `^node-\d+\.example\.com:9100$`,
+	}
+	alerts = make([]map[string]string, benchmarkAlertsCount)
+	for i := range alerts {
+		severity := "critical"
+		if i%2 == 1 {
+			severity = "info"
+		}
+		alerts[i] = map[string]string{
+			"alertname": "NodeDown",
+			"severity":  severity,
+			"instance":  fmt.Sprintf("node-%d.example.com:9100", i),
+		}
+	}
+	return
+}
+
+// checkMapWithoutCache does the same that the checkMap method of the healer, but compiling the
+// patterns for every value, to measure the benefit of the cache of compiled patterns.
+//
+func checkMapWithoutCache(values, patterns map[string]string) (bool, error) {
+	for key, pattern := range patterns {
+		value, present := values[key]
+		if !present {
+			return false, nil
+		}
+		matches, err := regexp.MatchString(pattern, value)
+		if !matches || err != nil {
+			return false, err
+		}
 	}
+	return true, nil
 }
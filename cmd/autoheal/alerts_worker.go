@@ -19,12 +19,20 @@ package main
 import (
 	"fmt"
 	"reflect"
-	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/openshift/autoheal/pkg/alertmanager"
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/auditlog"
+	"github.com/openshift/autoheal/pkg/memory"
 	"github.com/openshift/autoheal/pkg/metrics"
+	"github.com/openshift/autoheal/pkg/receiver"
+	"github.com/openshift/autoheal/pkg/runner"
+	"github.com/openshift/autoheal/pkg/silence"
 	batch "k8s.io/api/batch/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
 )
@@ -52,8 +60,20 @@ func (h *Healer) pickAlert() bool {
 			h.alertsQueue.Forget(item)
 		}
 
-		// Process and then forget the alert:
+		// Process and then forget the alert, and remember that it is no longer pending, even if
+		// processing it failed:
+		defer atomic.AddInt64(&h.pendingAlerts, -1)
 		err := h.processAlert(alert)
+		if runner.IsRetryable(err) {
+			glog.Infof(
+				"Alert '%s' will be processed again later: %s",
+				alert.Name(),
+				err,
+			)
+			atomic.AddInt64(&h.pendingAlerts, 1)
+			h.alertsQueue.AddRateLimited(alert)
+			return nil
+		}
 		if err != nil {
 			return err
 		}
@@ -70,9 +90,46 @@ func (h *Healer) pickAlert() bool {
 }
 
 func (h *Healer) processAlert(alert *alertmanager.Alert) error {
+	// Discard the alerts that refer to namespaces that aren't handled by this service, but remember
+	// them, so that it is possible to find out why they weren't healed:
+	scoped, err := h.inScope(alert)
+	if err != nil {
+		return err
+	}
+	if !scoped {
+		glog.V(2).Infof(
+			"Alert '%s' refers to namespace '%s', which isn't in scope, will ignore it",
+			alert.Name(),
+			alert.Labels["namespace"],
+		)
+		entry := receiver.NewHistoryEntry(alert)
+		entry.Ignored = fmt.Sprintf("Namespace '%s' isn't in scope", alert.Labels["namespace"])
+		h.history.Add(entry)
+		return nil
+	}
+
+	// Discard the firing alerts that have been silenced in the alert manager. Resolved alerts are
+	// always processed, so that healing that is already in progress is cancelled:
+	if alert.Status == alertmanager.AlertStatusFiring && h.isSilenced(alert) {
+		glog.Infof("Alert '%s' is silenced, will ignore it", alert.Name())
+		metrics.AlertSilenced()
+		return nil
+	}
+
+	glog.Infof(
+		"Processing alert '%s' with status '%s' from source '%s'",
+		alert.Name(),
+		alert.Status,
+		alert.Source(),
+	)
+
+	// Remember the alert and the outcome of processing it:
+	entry := receiver.NewHistoryEntry(alert)
+	defer h.history.Add(entry)
+
 	switch alert.Status {
 	case alertmanager.AlertStatusFiring:
-		return h.startHealing(alert)
+		return h.startHealing(alert, entry)
 	case alertmanager.AlertStatusResolved:
 		return h.cancelHealing(alert)
 	default:
@@ -84,14 +141,55 @@ func (h *Healer) processAlert(alert *alertmanager.Alert) error {
 	}
 }
 
-// startHealing starts the healing process for the given alert.
+// newAlertTemplate creates the template used to replace the values from the alert in the actions and
+// conditions of the rules.
 //
-func (h *Healer) startHealing(alert *alertmanager.Alert) error {
-	// Find the rules that are activated for the alert:
+func newAlertTemplate() (*ObjectTemplate, error) {
+	return NewObjectTemplateBuilder().
+		Variable("alert", ".").
+		Variable("labels", ".Labels").
+		Variable("annotations", ".Annotations").
+		Variable("generatorURL", ".GeneratorURL").
+		Variable("commonLabels", ".CommonLabels").
+		Variable("commonAnnotations", ".CommonAnnotations").
+		Build()
+}
+
+// isSilenced checks if the given alert is silenced in the alert manager given in the configuration.
+// If the alert manager can't be checked the alert is considered not silenced, so that a failure of
+// the alert manager doesn't stop the healing.
+//
+func (h *Healer) isSilenced(alert *alertmanager.Alert) bool {
+	silenceURL := h.config.SilenceCheckURL()
+	if silenceURL == "" {
+		return false
+	}
+	silenced, err := silence.IsSilenced(alert, silenceURL)
+	if err != nil {
+		glog.Warningf(
+			"Can't check if alert '%s' is silenced, will process it: %s",
+			alert.Name(),
+			err,
+		)
+		return false
+	}
+	return silenced
+}
+
+// matchRules returns the rules that match the given alert, ignoring the labels used for routing.
+// The rules are sorted by priority, and then by name, as that is the order in which they are
+// executed.
+//
+func (h *Healer) matchRules(alert *alertmanager.Alert) []*autoheal.HealingRule {
+	normalized := h.normalizeAlert(alert)
 	activated := make([]*autoheal.HealingRule, 0)
 	h.rulesCache.Range(func(_, value interface{}) bool {
 		rule := value.(*autoheal.HealingRule)
-		matches, err := h.checkRule(rule, alert)
+		if !ruleEnabled(rule) {
+			glog.V(2).Infof("Rule '%s' is disabled", rule.ObjectMeta.Name)
+			return true
+		}
+		matches, err := h.checkRule(rule, normalized)
 		if err != nil {
 			glog.Errorf(
 				"Error while checking if rule '%s' matches alert '%s': %s",
@@ -109,26 +207,107 @@ func (h *Healer) startHealing(alert *alertmanager.Alert) error {
 		}
 		return true
 	})
+
+	// The order of iteration of the cache isn't predictable, so sort the activated rules by
+	// priority, and then by name, to always execute them in the same order:
+	sort.Slice(activated, func(i, j int) bool {
+		if activated[i].Priority != activated[j].Priority {
+			return activated[i].Priority > activated[j].Priority
+		}
+		return activated[i].ObjectMeta.Name < activated[j].ObjectMeta.Name
+	})
+	return activated
+}
+
+// ruleEnabled checks if the given rule is enabled. Rules are enabled unless the enabled field is
+// explicitly set to false.
+//
+func ruleEnabled(rule *autoheal.HealingRule) bool {
+	return rule.Enabled == nil || *rule.Enabled
+}
+
+// startHealing starts the healing process for the given alert. The names of the rules that match
+// the alert and the outcomes of their actions are added to the given history entry.
+//
+func (h *Healer) startHealing(alert *alertmanager.Alert, entry *receiver.HistoryEntry) error {
+	// Find the rules that are activated for the alert:
+	activated := h.matchRules(alert)
 	if len(activated) == 0 {
 		glog.Infof("No rule matches alert '%s'", alert.Name())
 		return nil
 	}
-
-	// Execute the activated rules:
+	now := time.Now()
 	for _, rule := range activated {
-		err := h.runRule(rule, alert)
+		entry.AddRule(rule.ObjectMeta.Name)
+		h.ruleMatches.Store(rule.ObjectMeta.Name, now)
+	}
+
+	// Execute the activated rules, till one that requests it has started its action:
+	for i, rule := range activated {
+		err := h.runRule(rule, alert, entry)
 		if err != nil {
 			return err
 		}
+		if rule.StopOnFirst && entry.HasStartedAction(rule.ObjectMeta.Name) {
+			if i < len(activated)-1 {
+				glog.Infof(
+					"Rule '%s' has started healing alert '%s', the other %d matching rules "+
+						"will be skipped",
+					rule.ObjectMeta.Name,
+					alert.Name(),
+					len(activated)-1-i,
+				)
+			}
+			break
+		}
 	}
 
 	return nil
 }
 
-// cancelHealing cancels the healing process for the given alert.
+// cancelHealing cancels the healing process for the given alert. Currently this means cancelling
+// the AWX jobs launched for the alert that are still running.
 //
 func (h *Healer) cancelHealing(alert *alertmanager.Alert) error {
-	return nil
+	if h.awxRunner == nil {
+		return nil
+	}
+	return h.awxRunner.CancelJobs(alert)
+}
+
+// normalizeAlert returns a copy of the given alert without the labels and annotations that should
+// be ignored when checking the rules, and with the white space around the values removed if that
+// is enabled. The given alert isn't modified, as it is also used by the actions, the metrics and
+// the logs.
+//
+func (h *Healer) normalizeAlert(alert *alertmanager.Alert) *alertmanager.Alert {
+	if len(h.stripLabels) == 0 && !h.trimLabelValues {
+		return alert
+	}
+	normalized := *alert
+	normalized.Labels = h.normalizeMap(alert.Labels)
+	normalized.Annotations = h.normalizeMap(alert.Annotations)
+	return &normalized
+}
+
+// normalizeMap returns a copy of the given map without the keys that should be ignored, and with
+// the values trimmed if that is enabled.
+//
+func (h *Healer) normalizeMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		if h.stripLabels[key] {
+			continue
+		}
+		if h.trimLabelValues {
+			value = strings.TrimSpace(value)
+		}
+		result[key] = value
+	}
+	return result
 }
 
 func (h *Healer) checkRule(rule *autoheal.HealingRule, alert *alertmanager.Alert) (matches bool, err error) {
@@ -141,13 +320,64 @@ func (h *Healer) checkRule(rule *autoheal.HealingRule, alert *alertmanager.Alert
 	if !matches || err != nil {
 		return
 	}
+	matches, err = h.checkSeverity(alert.Labels, rule)
+	if !matches || err != nil {
+		return
+	}
 	matches, err = h.checkMap(alert.Annotations, rule.Annotations)
 	if !matches || err != nil {
 		return
 	}
+	matches, err = h.checkNamespace(alert.Labels["namespace"], rule.Namespace)
+	if !matches || err != nil {
+		return
+	}
+	matches, err = h.checkGeneratorURL(alert.GeneratorURL, rule.GeneratorURLPattern)
+	if !matches || err != nil {
+		return
+	}
+	matches, err = h.checkConditions(rule, alert)
 	return
 }
 
+// checkSeverity checks if the severity label of the alert is one of the severities of the rule.
+// Rules without severities, or with an explicit pattern for the severity label, which has already
+// been checked with the rest of the labels, match alerts with any severity.
+//
+func (h *Healer) checkSeverity(labels map[string]string, rule *autoheal.HealingRule) (bool, error) {
+	if len(rule.Severity) == 0 {
+		return true, nil
+	}
+	if _, explicit := rule.Labels[SeverityLabel]; explicit {
+		return true, nil
+	}
+	severity, present := labels[SeverityLabel]
+	if !present {
+		return false, nil
+	}
+	return h.matchPattern(severityPattern(rule.Severity), severity)
+}
+
+// checkNamespace checks if the namespace label of the alert matches the namespace pattern of the
+// rule. Rules without a pattern match alerts from any namespace.
+//
+func (h *Healer) checkNamespace(namespace, pattern string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+	return h.matchPattern(pattern, namespace)
+}
+
+// checkGeneratorURL checks if the generator URL of the alert matches the pattern of the rule. Rules
+// without a pattern match any URL.
+//
+func (h *Healer) checkGeneratorURL(url, pattern string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+	return h.matchPattern(pattern, url)
+}
+
 func (h *Healer) checkMap(values, patterns map[string]string) (result bool, err error) {
 	if len(patterns) > 0 {
 		if len(values) == 0 {
@@ -159,7 +389,7 @@ func (h *Healer) checkMap(values, patterns map[string]string) (result bool, err
 				return
 			}
 			var matches bool
-			matches, err = regexp.MatchString(pattern, value)
+			matches, err = h.matchPattern(pattern, value)
 			if !matches || err != nil {
 				return
 			}
@@ -169,7 +399,82 @@ func (h *Healer) checkMap(values, patterns map[string]string) (result bool, err
 	return
 }
 
-func (h *Healer) runRule(rule *autoheal.HealingRule, alert *alertmanager.Alert) error {
+// actionMemoryFor returns the memory used to throttle the actions of the given rule. Rules that have
+// their own throttle interval get their own memory, created the first time that it is needed, and
+// the rest share the global one.
+//
+func (h *Healer) actionMemoryFor(rule *autoheal.HealingRule) (*memory.ShortTermMemory, error) {
+	if rule.ThrottleInterval == "" {
+		return h.actionMemory, nil
+	}
+	interval, err := time.ParseDuration(rule.ThrottleInterval)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Throttle interval '%s' of rule '%s' isn't valid: %s",
+			rule.ThrottleInterval,
+			rule.ObjectMeta.Name,
+			err,
+		)
+	}
+
+	// Reuse the existing memory, unless the interval of the rule has changed:
+	name := ruleKey(&rule.ObjectMeta)
+	value, ok := h.ruleMemories.Load(name)
+	if ok && value.(*memory.ShortTermMemory).Duration() == interval {
+		return value.(*memory.ShortTermMemory), nil
+	}
+	created, err := memory.NewShortTermMemoryBuilder().
+		Duration(interval).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		value, ok = h.ruleMemories.LoadOrStore(name, created)
+		if ok {
+			return value.(*memory.ShortTermMemory), nil
+		}
+		return created, nil
+	}
+	h.ruleMemories.Store(name, created)
+	return created, nil
+}
+
+// actionFailureReason classifies the error returned by an action runner, for use as a metric label
+// value. It returns an empty string when there is no error.
+//
+func actionFailureReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case runner.IsRetryable(err):
+		return "retryable"
+	default:
+		return "error"
+	}
+}
+
+// copyRuleAction returns a copy of the action of the given rule, or nil if the rule has no action.
+//
+func copyRuleAction(rule *autoheal.HealingRule) interface{} {
+	switch {
+	case rule.AWXJob != nil:
+		return rule.AWXJob.DeepCopy()
+	case rule.WorkflowJob != nil:
+		return rule.WorkflowJob.DeepCopy()
+	case rule.BatchJob != nil:
+		return rule.BatchJob.DeepCopy()
+	case rule.Plugin != nil:
+		return rule.Plugin.DeepCopy()
+	case rule.WebhookJob != nil:
+		return rule.WebhookJob.DeepCopy()
+	case rule.SlackJob != nil:
+		return rule.SlackJob.DeepCopy()
+	}
+	return nil
+}
+
+func (h *Healer) runRule(rule *autoheal.HealingRule, alert *alertmanager.Alert, entry *receiver.HistoryEntry) error {
 	// Send the name of the rule to the log:
 	glog.Infof(
 		"Running rule '%s' for alert '%s'",
@@ -179,12 +484,8 @@ func (h *Healer) runRule(rule *autoheal.HealingRule, alert *alertmanager.Alert)
 
 	// Make a copy of the action so that we can modify it without affecting the rule stored in the
 	// cache:
-	var action interface{}
-	if rule.AWXJob != nil {
-		action = rule.AWXJob.DeepCopy()
-	} else if rule.BatchJob != nil {
-		action = rule.BatchJob.DeepCopy()
-	} else {
+	action := copyRuleAction(rule)
+	if action == nil {
 		glog.Warningf(
 			"There are no action details, rule '%s' will have no effect on alert '%s'",
 			rule.ObjectMeta.Name,
@@ -194,51 +495,129 @@ func (h *Healer) runRule(rule *autoheal.HealingRule, alert *alertmanager.Alert)
 	}
 
 	// Increment the metric of requested heales.
+	kind := reflect.TypeOf(action).Elem().Name()
 	metrics.ActionRequested(
-		reflect.TypeOf(action).Elem().Name(),
+		kind,
 		rule.ObjectMeta.Name,
 		alert.Labels["alertname"],
 	)
 
 	// Process the templates inside the action:
-	template, err := NewObjectTemplateBuilder().
-		Variable("alert", ".").
-		Variable("labels", ".Labels").
-		Variable("annotations", ".Annotations").
-		Build()
+	template, err := newAlertTemplate()
 	if err != nil {
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeError, err)
 		return err
 	}
 	err = template.Process(action, alert)
 	if err != nil {
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeError, err)
 		return err
 	}
 
 	// Discard the action if it has been executed recently:
-	if h.actionMemory.Has(action) {
+	actionMemory, err := h.actionMemoryFor(rule)
+	if err != nil {
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeError, err)
+		return err
+	}
+	if actionMemory.Has(action) {
 		glog.Infof(
 			"Action for rule '%s' and alert '%s' has been executed recently, it will be ignored",
 			rule.ObjectMeta.Name,
 			alert.Name(),
 		)
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeThrottled, nil)
 		return nil
 	}
 
-	// Execute the action:
+	// In dry run mode write the action to the log instead of executing it, and don't remember it,
+	// so that it is written again the next time that the alert is received:
+	if h.dryRun {
+		err = logDryRun(rule, action, alert)
+		if err != nil {
+			entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeError, err)
+			return err
+		}
+		metrics.ActionDryRun(kind, rule.ObjectMeta.Name)
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeDryRun, nil)
+		return nil
+	}
+
+	// Find the runner for the action:
+	var actionRunner runner.ActionRunner
+	var ok bool
 	switch typed := action.(type) {
 	case *autoheal.AWXJobAction:
-		err = h.actionRunners[ActionRunnerTypeAWX].RunAction(rule, typed, alert)
+		actionRunner, ok = h.actionRunners[ActionRunnerTypeAWX]
+	case *autoheal.AWXWorkflowAction:
+		actionRunner, ok = h.actionRunners[ActionRunnerTypeAWXWorkflow]
 	case *batch.Job:
-		err = h.actionRunners[ActionRunnerTypeBatch].RunAction(rule, typed, alert)
+		actionRunner, ok = h.actionRunners[ActionRunnerTypeBatch]
+	case *autoheal.PluginAction:
+		actionRunner, ok = h.pluginRunners[typed.Type]
+	case *autoheal.WebhookAction:
+		actionRunner, ok = h.webhookRunner, h.webhookRunner != nil
+	case *autoheal.SlackAction:
+		actionRunner, ok = h.slackRunner, h.slackRunner != nil
 	default:
 		err = fmt.Errorf(
 			"Don't know how to execute action of type '%T'",
 			typed,
 		)
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeError, err)
+		return err
+	}
+	if !ok {
+		err = fmt.Errorf(
+			"Can't execute action of type '%T' for rule '%s' because the runner isn't available",
+			action,
+			rule.ObjectMeta.Name,
+		)
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeError, err)
+		return err
+	}
+
+	// Discard the action if another rule is already healing the same entity:
+	if !h.startHealingContext(rule, alert) {
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeThrottled, nil)
+		return nil
+	}
+
+	// If the action fails the entity isn't being healed, so release it, otherwise correlated
+	// alerts would be ignored till the context expires:
+	defer func() {
+		if err != nil {
+			h.endHealingContext(rule, alert)
+		}
+	}()
+
+	// Execute the action:
+	start := time.Now()
+	err = actionRunner.RunAction(rule, action, alert)
+	metrics.ActionExecuted(kind, rule.ObjectMeta.Name, time.Since(start), actionFailureReason(err))
+	if runner.IsRetryable(err) {
+		// The action will be executed when the alert is processed again, so it shouldn't be
+		// remembered:
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeThrottled, err)
+		return err
+	}
+	if err != nil {
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeError, err)
+	} else {
+		entry.AddAction(rule.ObjectMeta.Name, kind, receiver.ActionOutcomeStarted, nil)
+	}
+	if h.auditRecorder != nil {
+		h.auditRecorder.Record(&auditlog.Entry{
+			Timestamp:  time.Now(),
+			RuleName:   rule.ObjectMeta.Name,
+			AlertName:  alert.Name(),
+			ActionType: kind,
+			Success:    err == nil,
+		})
 	}
 
 	// Remember that the action was executed recently, even if the execution failed:
-	h.actionMemory.Add(action)
+	actionMemory.Add(action)
 
 	return err
 }
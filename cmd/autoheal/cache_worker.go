@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// runCacheConsistencyWorker periodically checks that the rules cache contains the same rules than
+// the configuration, until the given channel is closed.
+//
+func (h *Healer) runCacheConsistencyWorker(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(h.cacheCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			h.checkRulesCache()
+		}
+	}
+}
+
+// checkRulesCache compares the names of the rules in the cache with the names of the rules in the
+// configuration, and sends to the log a warning for each difference. If auto correction is enabled
+// it also sends to the rules queue the changes needed to fix the differences. It returns the names
+// of the rules that are missing from the cache and the names of the rules that are in the cache but
+// not in the configuration.
+//
+func (h *Healer) checkRulesCache() (missing, extra []string) {
+	// Index the rules of the configuration by key:
+	configured := make(map[string]*autoheal.HealingRule)
+	for _, rule := range h.config.Rules() {
+		configured[ruleKey(&rule.ObjectMeta)] = rule
+	}
+
+	// The rules loaded from the Kubernetes API should also be in the cache, unless the
+	// configuration has a rule with the same name:
+	h.crdRules.Range(func(key, value interface{}) bool {
+		rule := value.(*autoheal.HealingRule)
+		if !h.isConfiguredRule(rule.ObjectMeta.Name) {
+			configured[key.(string)] = rule
+		}
+		return true
+	})
+
+	// Find the rules that are in the cache but not in the configuration:
+	cached := make(map[string]*autoheal.HealingRule)
+	h.rulesCache.Range(func(key, value interface{}) bool {
+		name := key.(string)
+		cached[name] = value.(*autoheal.HealingRule)
+		if _, ok := configured[name]; !ok {
+			extra = append(extra, name)
+		}
+		return true
+	})
+
+	// Find the rules that are in the configuration but not in the cache:
+	for name := range configured {
+		if _, ok := cached[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+
+	// Report and optionally fix the differences:
+	for _, name := range missing {
+		glog.Warningf("Rule '%s' is in the configuration but not in the rules cache", name)
+		if h.cacheAutoCorrect {
+			h.rulesQueue.Add(&RuleChange{
+				Type: watch.Added,
+				Rule: configured[name],
+			})
+		}
+	}
+	for _, name := range extra {
+		glog.Warningf("Rule '%s' is in the rules cache but not in the configuration", name)
+		if h.cacheAutoCorrect {
+			h.rulesQueue.Add(&RuleChange{
+				Type: watch.Deleted,
+				Rule: cached[name],
+			})
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		glog.V(2).Infof("Rules cache is consistent with the configuration")
+	}
+
+	return
+}
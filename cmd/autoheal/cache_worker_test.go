@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestCheckConsistentRulesCache(t *testing.T) {
+	healer := makeRulesHealer(t, false)
+	loadRulesCache(healer)
+
+	missing, extra := healer.checkRulesCache()
+	if len(missing) != 0 || len(extra) != 0 {
+		t.Errorf("Expected no drift, but got missing %v and extra %v", missing, extra)
+	}
+}
+
+func TestCheckDriftedRulesCache(t *testing.T) {
+	healer := makeRulesHealer(t, false)
+	loadRulesCache(healer)
+
+	// Create drift removing one rule and adding another that isn't in the configuration:
+	healer.rulesCache.Delete("first-rule")
+	healer.rulesCache.Store("stale-rule", &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "stale-rule",
+		},
+	})
+
+	missing, extra := healer.checkRulesCache()
+	if !reflect.DeepEqual(missing, []string{"first-rule"}) {
+		t.Errorf("Expected missing rule 'first-rule', but got %v", missing)
+	}
+	if !reflect.DeepEqual(extra, []string{"stale-rule"}) {
+		t.Errorf("Expected extra rule 'stale-rule', but got %v", extra)
+	}
+
+	// Without auto correction nothing should have been added to the queue:
+	if healer.rulesQueue.Len() != 0 {
+		t.Errorf("Expected no changes in the queue, but got %d", healer.rulesQueue.Len())
+	}
+}
+
+func TestAutoCorrectDriftedRulesCache(t *testing.T) {
+	healer := makeRulesHealer(t, true)
+	loadRulesCache(healer)
+
+	// Create drift removing one rule and adding another that isn't in the configuration:
+	healer.rulesCache.Delete("first-rule")
+	healer.rulesCache.Store("stale-rule", &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "stale-rule",
+		},
+	})
+
+	// Check and then process the changes submitted to fix the drift:
+	healer.checkRulesCache()
+	if healer.rulesQueue.Len() != 2 {
+		t.Fatalf("Expected two changes in the queue, but got %d", healer.rulesQueue.Len())
+	}
+	for healer.rulesQueue.Len() > 0 {
+		healer.pickRuleChange()
+	}
+
+	missing, extra := healer.checkRulesCache()
+	if len(missing) != 0 || len(extra) != 0 {
+		t.Errorf("Expected drift to be fixed, but got missing %v and extra %v", missing, extra)
+	}
+}
+
+func makeRulesHealer(t *testing.T, autoCorrect bool) *Healer {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "rules-config.yml")).
+		MinimumRunnersRequired(0).
+		CacheAutoCorrect(autoCorrect).
+		Build()
+	if err != nil {
+		t.Fatalf("Error building healer: %s", err)
+	}
+	return healer
+}
+
+func loadRulesCache(healer *Healer) {
+	for _, rule := range healer.config.Rules() {
+		healer.processRuleChange(&RuleChange{
+			Type: watch.Added,
+			Rule: rule,
+		})
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to generate the self-signed certificate used by the web
+// server when the TLS certificate file is 'auto'.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// AutoTLSCertFile is the value of the TLS certificate file that indicates that the web server
+// should generate a self-signed certificate when it starts.
+//
+const AutoTLSCertFile = "auto"
+
+// certificateValidity is how long the generated certificates are valid.
+//
+const certificateValidity = 365 * 24 * time.Hour
+
+// generateCertificate generates a self-signed certificate, and its private key, valid for the given
+// host names and IP addresses. They are written in PEM format to a new temporary directory, and
+// the names of the files are returned.
+//
+func generateCertificate(hosts []string) (certFile, keyFile string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: "autoheal",
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		ip := net.ParseIP(host)
+		if ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return
+	}
+
+	// Write the files, the key readable only by the owner:
+	dir, err := ioutil.TempDir("", "autoheal-tls")
+	if err != nil {
+		return
+	}
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	err = ioutil.WriteFile(
+		certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		0644,
+	)
+	if err == nil {
+		err = ioutil.WriteFile(
+			keyFile,
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+			0600,
+		)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return
+	}
+
+	glog.Infof(
+		"Generated self-signed certificate '%s' for hosts %s, its SHA-256 fingerprint is %s",
+		certFile,
+		strings.Join(hosts, ", "),
+		certificateFingerprint(der),
+	)
+	return
+}
+
+// certificateFingerprint returns the SHA-256 fingerprint of the given DER encoded certificate, in
+// the usual format of colon separated upper case hexadecimal bytes.
+//
+func certificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// certificateHosts returns the host names and IP addresses that the generated certificate should
+// be valid for: the local host, the host name of the machine, and the names of the service.
+//
+func certificateHosts(serviceName, serviceNamespace string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	hostname, err := os.Hostname()
+	if err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	if serviceName != "" && serviceNamespace != "" {
+		hosts = append(
+			hosts,
+			fmt.Sprintf("%s.%s.svc", serviceName, serviceNamespace),
+			fmt.Sprintf("%s.%s.svc.cluster.local", serviceName, serviceNamespace),
+		)
+	}
+	return hosts
+}
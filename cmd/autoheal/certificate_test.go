@@ -0,0 +1,158 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateCertificate(t *testing.T) {
+	certFile, keyFile, err := generateCertificate([]string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(certFile))
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Expected a valid certificate and key, but got: %s", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cert.VerifyHostname("localhost"); err != nil {
+		t.Errorf("Expected the certificate to be valid for 'localhost': %s", err)
+	}
+	if err = cert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("Expected the certificate to be valid for '127.0.0.1': %s", err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the key file mode to be 0600, but got %o", info.Mode().Perm())
+	}
+}
+
+func TestBuildRejectsKeyFileWithAutoCertificate(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		TLSCertFile(AutoTLSCertFile).
+		TLSKeyFile("tls.key").
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error when the key file is given with an 'auto' certificate")
+	}
+}
+
+func TestAutoCertificateIsUsedByServer(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		TLSCertFile(AutoTLSCertFile).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(healer.tlsCertFile))
+	if healer.tlsCertFile == AutoTLSCertFile || healer.tlsKeyFile == "" {
+		t.Fatalf(
+			"Expected generated certificate and key files, but got '%s' and '%s'",
+			healer.tlsCertFile, healer.tlsKeyFile,
+		)
+	}
+
+	// Start a server that uses the files of the healer:
+	pair, err := tls.LoadX509KeyPair(healer.tlsCertFile, healer.tlsKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(healer.handleRequest))
+	err = healer.configureServer(server.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TLS = server.Config.TLSConfig
+	if server.TLS == nil {
+		server.TLS = new(tls.Config)
+	}
+	server.TLS.Certificates = []tls.Certificate{pair}
+	server.StartTLS()
+	defer server.Close()
+
+	// Check that a client that trusts only the generated certificate can connect:
+	data, err := ioutil.ReadFile(healer.tlsCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		t.Fatalf("Can't parse certificate file '%s'", healer.tlsCertFile)
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: roots,
+			},
+		},
+	}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected the server to use the generated certificate, but got: %s", err)
+	}
+	response.Body.Close()
+}
+
+func TestLoadCertificateFailsWithMissingFiles(t *testing.T) {
+	healer := makeTLSHealer(t, false)
+	defer healer.config.ShutDown()
+	err := healer.loadCertificate(new(http.Server))
+	if err == nil {
+		t.Errorf("Expected an error when the certificate and key files don't exist")
+	}
+}
+
+func TestLoadCertificateWithAutoCertificate(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		TLSCertFile(AutoTLSCertFile).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer healer.config.ShutDown()
+	defer os.RemoveAll(filepath.Dir(healer.tlsCertFile))
+	server := new(http.Server)
+	err = healer.loadCertificate(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.TLSConfig == nil || len(server.TLSConfig.Certificates) != 1 {
+		t.Errorf("Expected the certificate to be added to the TLS configuration of the server")
+	}
+}
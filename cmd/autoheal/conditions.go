@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to check the additional conditions of the healing rules.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// checkConditions checks if the additional conditions of the given rule are satisfied for the given
+// alert. Rules without conditions are always satisfied.
+//
+func (h *Healer) checkConditions(rule *autoheal.HealingRule, alert *alertmanager.Alert) (bool, error) {
+	if rule.Conditions == nil {
+		return true, nil
+	}
+	if rule.Conditions.Pod != nil {
+		satisfied, err := h.checkPodCondition(rule.Conditions.Pod, alert)
+		if !satisfied || err != nil {
+			return satisfied, err
+		}
+	}
+	return true, nil
+}
+
+// checkPodCondition checks if at least one of the pods selected by the given condition has the
+// condition type and status that it requires. If no pod is selected the condition isn't satisfied.
+//
+func (h *Healer) checkPodCondition(condition *autoheal.PodCondition, alert *alertmanager.Alert) (bool, error) {
+	if h.k8sClient == nil {
+		return false, fmt.Errorf(
+			"Can't check pod condition, there is no connection to the Kubernetes API",
+		)
+	}
+
+	// Replace the templates of the namespace and the selector with the values from the alert,
+	// using a copy so that the rule isn't modified:
+	condition = condition.DeepCopy()
+	template, err := newAlertTemplate()
+	if err != nil {
+		return false, err
+	}
+	err = template.Process(condition, alert)
+	if err != nil {
+		return false, err
+	}
+
+	// Apply the defaults:
+	namespace := condition.Namespace
+	if namespace == "" {
+		namespace = alert.Labels["namespace"]
+	}
+	if namespace == "" {
+		return false, fmt.Errorf(
+			"Can't check pod condition, it doesn't specify a namespace and alert '%s' doesn't "+
+				"have a namespace label",
+			alert.Name(),
+		)
+	}
+	conditionType := core.PodConditionType(condition.ConditionType)
+	if conditionType == "" {
+		conditionType = core.PodReady
+	}
+	conditionStatus := core.ConditionStatus(condition.ConditionStatus)
+	if conditionStatus == "" {
+		conditionStatus = core.ConditionFalse
+	}
+
+	// Find the pods and check their conditions:
+	pods, err := h.k8sClient.CoreV1().Pods(namespace).List(meta.ListOptions{
+		LabelSelector: condition.PodSelector,
+	})
+	if err != nil {
+		return false, fmt.Errorf(
+			"Can't list pods in namespace '%s' with selector '%s': %s",
+			namespace,
+			condition.PodSelector,
+			err,
+		)
+	}
+	for _, pod := range pods.Items {
+		for _, podCondition := range pod.Status.Conditions {
+			if podCondition.Type == conditionType && podCondition.Status == conditionStatus {
+				glog.V(2).Infof(
+					"Pod '%s' in namespace '%s' has condition '%s' with status '%s'",
+					pod.ObjectMeta.Name,
+					namespace,
+					conditionType,
+					conditionStatus,
+				)
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
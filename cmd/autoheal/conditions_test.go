@@ -0,0 +1,264 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestPodConditionSatisfiedByPodThatIsntReady(t *testing.T) {
+	pods := &fakePods{
+		items: []core.Pod{
+			makePod("my-namespace", "my-pod-0", "my-app", core.PodReady, core.ConditionTrue),
+			makePod("my-namespace", "my-pod-1", "my-app", core.PodReady, core.ConditionFalse),
+		},
+	}
+	healer := makeConditionsHealer(t, pods)
+
+	matches, err := healer.checkRule(makePodConditionRule(&autoheal.PodCondition{
+		PodSelector: "app=my-app",
+	}), makePodAlert("my-namespace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matches {
+		t.Errorf("Expected the rule to match when one of the pods isn't ready")
+	}
+	if pods.namespace != "my-namespace" {
+		t.Errorf("Expected pods to be listed in namespace 'my-namespace', but got '%s'", pods.namespace)
+	}
+	if pods.selector != "app=my-app" {
+		t.Errorf("Expected pods to be listed with selector 'app=my-app', but got '%s'", pods.selector)
+	}
+}
+
+func TestPodConditionNotSatisfiedWhenAllPodsAreReady(t *testing.T) {
+	pods := &fakePods{
+		items: []core.Pod{
+			makePod("my-namespace", "my-pod-0", "my-app", core.PodReady, core.ConditionTrue),
+			makePod("my-namespace", "my-pod-1", "my-app", core.PodReady, core.ConditionTrue),
+			makePod("my-namespace", "other-pod", "other-app", core.PodReady, core.ConditionFalse),
+		},
+	}
+	healer := makeConditionsHealer(t, pods)
+
+	matches, err := healer.checkRule(makePodConditionRule(&autoheal.PodCondition{
+		PodSelector: "app=my-app",
+	}), makePodAlert("my-namespace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches {
+		t.Errorf("Expected the rule to not match when all the pods are ready")
+	}
+}
+
+func TestPodConditionNotSatisfiedWithoutPods(t *testing.T) {
+	healer := makeConditionsHealer(t, &fakePods{})
+
+	matches, err := healer.checkRule(makePodConditionRule(&autoheal.PodCondition{
+		PodSelector: "app=my-app",
+	}), makePodAlert("my-namespace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches {
+		t.Errorf("Expected the rule to not match when there are no pods")
+	}
+}
+
+func TestPodConditionWithCustomTypeAndStatus(t *testing.T) {
+	pods := &fakePods{
+		items: []core.Pod{
+			makePod("my-namespace", "my-pod-0", "my-app", core.PodScheduled, core.ConditionUnknown),
+		},
+	}
+	healer := makeConditionsHealer(t, pods)
+
+	matches, err := healer.checkRule(makePodConditionRule(&autoheal.PodCondition{
+		PodSelector:     "app=my-app",
+		ConditionType:   string(core.PodScheduled),
+		ConditionStatus: string(core.ConditionUnknown),
+	}), makePodAlert("my-namespace"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matches {
+		t.Errorf("Expected the rule to match a pod that has an unknown scheduled condition")
+	}
+}
+
+func TestPodConditionWithTemplates(t *testing.T) {
+	pods := &fakePods{
+		items: []core.Pod{
+			makePod("other-namespace", "my-pod-0", "my-app", core.PodReady, core.ConditionFalse),
+		},
+	}
+	healer := makeConditionsHealer(t, pods)
+
+	alert := makePodAlert("my-namespace")
+	alert.Labels["target_namespace"] = "other-namespace"
+	alert.Labels["app"] = "my-app"
+	matches, err := healer.checkRule(makePodConditionRule(&autoheal.PodCondition{
+		Namespace:   "{{ $labels.target_namespace }}",
+		PodSelector: "app={{ $labels.app }}",
+	}), alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matches {
+		t.Errorf("Expected the rule to match using the namespace and selector from the alert")
+	}
+	if pods.namespace != "other-namespace" {
+		t.Errorf("Expected pods to be listed in namespace 'other-namespace', but got '%s'", pods.namespace)
+	}
+}
+
+func TestPodConditionWithoutNamespaceFails(t *testing.T) {
+	healer := makeConditionsHealer(t, &fakePods{})
+
+	_, err := healer.checkRule(makePodConditionRule(&autoheal.PodCondition{
+		PodSelector: "app=my-app",
+	}), makePodAlert(""))
+	if err == nil {
+		t.Errorf("Expected an error when the namespace can't be determined")
+	}
+}
+
+func TestPodConditionWithoutKubernetesClientFails(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = healer.checkRule(makePodConditionRule(&autoheal.PodCondition{
+		PodSelector: "app=my-app",
+	}), makePodAlert("my-namespace"))
+	if err == nil {
+		t.Errorf("Expected an error when there is no connection to the Kubernetes API")
+	}
+}
+
+func makeConditionsHealer(t *testing.T, pods *fakePods) *Healer {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		KubernetesClient(&fakePodsClient{pods: pods}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return healer
+}
+
+func makePodConditionRule(condition *autoheal.PodCondition) *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "restart-pod",
+		},
+		Labels: map[string]string{
+			"alertname": "PodDown",
+		},
+		Conditions: &autoheal.HealingRuleConditions{
+			Pod: condition,
+		},
+	}
+}
+
+func makePodAlert(namespace string) *alertmanager.Alert {
+	alert := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "PodDown",
+		},
+	}
+	if namespace != "" {
+		alert.Labels["namespace"] = namespace
+	}
+	return alert
+}
+
+func makePod(namespace, name, app string, conditionType core.PodConditionType,
+	conditionStatus core.ConditionStatus) core.Pod {
+	return core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels: map[string]string{
+				"app": app,
+			},
+		},
+		Status: core.PodStatus{
+			Conditions: []core.PodCondition{
+				{
+					Type:   conditionType,
+					Status: conditionStatus,
+				},
+			},
+		},
+	}
+}
+
+// fakePodsClient is a Kubernetes client that only implements the parts of the API used to list
+// pods. Calling any other method will panic.
+//
+type fakePodsClient struct {
+	kubernetes.Interface
+	pods *fakePods
+}
+
+func (c *fakePodsClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeCoreV1{pods: c.pods}
+}
+
+// fakePods returns the given pods that are in the requested namespace and match the label selector.
+// It remembers the namespace and the label selector used.
+//
+type fakePods struct {
+	corev1.PodInterface
+	items     []core.Pod
+	namespace string
+	selector  string
+}
+
+func (p *fakePods) List(options meta.ListOptions) (*core.PodList, error) {
+	p.selector = options.LabelSelector
+	selector, err := labels.Parse(options.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	list := &core.PodList{}
+	for _, pod := range p.items {
+		if pod.ObjectMeta.Namespace == p.namespace && selector.Matches(labels.Set(pod.ObjectMeta.Labels)) {
+			list.Items = append(list.Items, pod)
+		}
+	}
+	return list, nil
+}
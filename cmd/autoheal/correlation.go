@@ -0,0 +1,171 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to correlate alerts that affect the same entity, so that
+// only one healing rule is executed for them.
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// healingContext describes an entity that is being healed.
+//
+type healingContext struct {
+	// The name of the rule that started healing the entity.
+	rule string
+
+	// The labels that identify the entity, and their values.
+	labels map[string]string
+
+	// The time when the rule started healing the entity.
+	stamp time.Time
+}
+
+// startHealingContext checks if the entity affected by the alert, as identified by the labels
+// listed in the CorrelateBy field of the rule, is already being healed. If it isn't then a new
+// healing context is registered for the entity and the result is true, otherwise the result is
+// false and the rule shouldn't be executed. Rules that don't have the CorrelateBy field, and alerts
+// that don't have all the labels listed in it, always return true.
+//
+// Rules don't need to use the same labels to be correlated: an entity is already being healed if
+// there is a context that has at least one label in common with it, and the same values for all
+// the labels in common. For example, a rule that correlates by node blocks a rule that correlates
+// by node and pod for the pods of that node.
+//
+func (h *Healer) startHealingContext(rule *autoheal.HealingRule, alert *alertmanager.Alert) bool {
+	if len(rule.CorrelateBy) == 0 {
+		return true
+	}
+	labels := correlationLabels(rule.CorrelateBy, alert)
+	if labels == nil {
+		glog.V(2).Infof(
+			"Alert '%s' doesn't have all the labels used by rule '%s' to correlate alerts, "+
+				"it will not be correlated",
+			alert.Name(),
+			rule.ObjectMeta.Name,
+		)
+		return true
+	}
+
+	// Checking the existing contexts and adding the new one needs to be atomic, otherwise two
+	// alerts processed simultaneously could both start healing the same entity:
+	h.healingContextsMutex.Lock()
+	defer h.healingContextsMutex.Unlock()
+
+	// Remove the contexts that have expired, and find the one that is already healing the entity:
+	ttl := h.config.Correlation().TTL()
+	now := time.Now()
+	var existing *healingContext
+	h.healingContexts.Range(func(key, value interface{}) bool {
+		context := value.(*healingContext)
+		if now.Sub(context.stamp) >= ttl {
+			h.healingContexts.Delete(key)
+		} else if existing == nil && correlated(context.labels, labels) {
+			existing = context
+		}
+		return true
+	})
+	key := correlationKey(labels)
+	if existing != nil {
+		glog.Infof(
+			"Rule '%s' has already started healing '%s', rule '%s' will be ignored for alert '%s'",
+			existing.rule,
+			correlationKey(existing.labels),
+			rule.ObjectMeta.Name,
+			alert.Name(),
+		)
+		return false
+	}
+
+	// Register the new context:
+	h.healingContexts.Store(key, &healingContext{
+		rule:   rule.ObjectMeta.Name,
+		labels: labels,
+		stamp:  now,
+	})
+	return true
+}
+
+// endHealingContext removes the healing context registered for the entity affected by the alert by
+// the given rule, so that the entity can be healed again without waiting for the context to expire.
+//
+func (h *Healer) endHealingContext(rule *autoheal.HealingRule, alert *alertmanager.Alert) {
+	if len(rule.CorrelateBy) == 0 {
+		return
+	}
+	labels := correlationLabels(rule.CorrelateBy, alert)
+	if labels == nil {
+		return
+	}
+	h.healingContextsMutex.Lock()
+	defer h.healingContextsMutex.Unlock()
+	key := correlationKey(labels)
+	value, ok := h.healingContexts.Load(key)
+	if ok && value.(*healingContext).rule == rule.ObjectMeta.Name {
+		h.healingContexts.Delete(key)
+	}
+}
+
+// correlationLabels returns the values of the given labels of the alert, or nil if the alert
+// doesn't have any of them.
+//
+func correlationLabels(names []string, alert *alertmanager.Alert) map[string]string {
+	labels := make(map[string]string, len(names))
+	for _, name := range names {
+		value, ok := alert.Labels[name]
+		if !ok {
+			return nil
+		}
+		labels[name] = value
+	}
+	return labels
+}
+
+// correlationKey calculates the key that identifies the entity with the given labels. The key is
+// the JSON representation of the labels, which is sorted by name, so that the order used in the
+// rule isn't relevant, and quotes the values, so that different labels never have the same key.
+//
+func correlationKey(labels map[string]string) string {
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
+
+// correlated checks if the entities identified by the given labels are the same, or one contains
+// the other. That is true if they have at least one label in common, and the values of all the
+// labels in common are equal.
+//
+func correlated(first, second map[string]string) bool {
+	common := false
+	for name, value := range first {
+		other, ok := second[name]
+		if !ok {
+			continue
+		}
+		if other != value {
+			return false
+		}
+		common = true
+	}
+	return common
+}
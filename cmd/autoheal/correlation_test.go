@@ -0,0 +1,274 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestCorrelatedRulesRunOnce(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	actionRunner := FakeActionRunner{
+		RuleAlertMap: make(map[string]*alertmanager.Alert),
+	}
+	healer.actionRunners[ActionRunnerTypeAWX] = actionRunner
+
+	nodeDown := makeCorrelatedRule("node-down", "NodeDown", "Start node")
+	podCrash := makeCorrelatedRule("pod-crash", "PodCrashLoopBackOff", "Restart pod")
+	healer.rulesCache.Store(nodeDown.ObjectMeta.Name, nodeDown)
+	healer.rulesCache.Store(podCrash.ObjectMeta.Name, podCrash)
+
+	// Both alerts affect the same node, so only the first one should be healed:
+	healer.processAlert(makeNodeAlert("NodeDown", "node0"))
+	healer.processAlert(makeNodeAlert("PodCrashLoopBackOff", "node0"))
+	if len(actionRunner.RuleAlertMap) != 1 {
+		t.Errorf("Expected one rule to be executed, but got %d", len(actionRunner.RuleAlertMap))
+	}
+	if _, ok := actionRunner.RuleAlertMap["node-down"]; !ok {
+		t.Errorf("Expected rule 'node-down' to be executed, but it wasn't")
+	}
+
+	// An alert for a different node should be healed:
+	healer.processAlert(makeNodeAlert("PodCrashLoopBackOff", "node1"))
+	if _, ok := actionRunner.RuleAlertMap["pod-crash"]; !ok {
+		t.Errorf("Expected rule 'pod-crash' to be executed, but it wasn't")
+	}
+}
+
+func TestCorrelationReleasedWhenRunnerIsMissing(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+	delete(healer.actionRunners, ActionRunnerTypeAWX)
+
+	nodeDown := makeCorrelatedRule("node-down", "NodeDown", "Start node")
+	podCrash := makeCorrelatedRule("pod-crash", "PodCrashLoopBackOff", "Restart pod")
+	healer.rulesCache.Store(nodeDown.ObjectMeta.Name, nodeDown)
+	healer.rulesCache.Store(podCrash.ObjectMeta.Name, podCrash)
+
+	// The first alert can't be healed because there is no runner:
+	healer.processAlert(makeNodeAlert("NodeDown", "node0"))
+
+	// So a correlated alert for the same node should still be healed once the runner is available:
+	actionRunner := FakeActionRunner{
+		RuleAlertMap: make(map[string]*alertmanager.Alert),
+	}
+	healer.actionRunners[ActionRunnerTypeAWX] = actionRunner
+	healer.processAlert(makeNodeAlert("PodCrashLoopBackOff", "node0"))
+	if _, ok := actionRunner.RuleAlertMap["pod-crash"]; !ok {
+		t.Errorf("Expected rule 'pod-crash' to be executed, but it wasn't")
+	}
+}
+
+func TestCorrelationReleasedWhenActionFails(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+	healer.actionRunners[ActionRunnerTypeAWX] = failingActionRunner{}
+
+	nodeDown := makeCorrelatedRule("node-down", "NodeDown", "Start node")
+	podCrash := makeCorrelatedRule("pod-crash", "PodCrashLoopBackOff", "Restart pod")
+	healer.rulesCache.Store(nodeDown.ObjectMeta.Name, nodeDown)
+	healer.rulesCache.Store(podCrash.ObjectMeta.Name, podCrash)
+
+	// The first alert fails with an error that isn't retryable:
+	healer.processAlert(makeNodeAlert("NodeDown", "node0"))
+
+	// So a correlated alert for the same node should still be healed:
+	actionRunner := FakeActionRunner{
+		RuleAlertMap: make(map[string]*alertmanager.Alert),
+	}
+	healer.actionRunners[ActionRunnerTypeAWX] = actionRunner
+	healer.processAlert(makeNodeAlert("PodCrashLoopBackOff", "node0"))
+	if _, ok := actionRunner.RuleAlertMap["pod-crash"]; !ok {
+		t.Errorf("Expected rule 'pod-crash' to be executed, but it wasn't")
+	}
+}
+
+func TestCorrelationContextExpires(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	rule := makeCorrelatedRule("node-down", "NodeDown", "Start node")
+	alert := makeNodeAlert("NodeDown", "node0")
+
+	if !healer.startHealingContext(rule, alert) {
+		t.Fatalf("Expected the first healing context to be started")
+	}
+	if healer.startHealingContext(rule, alert) {
+		t.Fatalf("Expected the second healing context to be rejected")
+	}
+
+	// Make the existing context older than the TTL:
+	key := correlationKey(correlationLabels(rule.CorrelateBy, alert))
+	value, _ := healer.healingContexts.Load(key)
+	value.(*healingContext).stamp = time.Now().Add(-healer.config.Correlation().TTL())
+
+	if !healer.startHealingContext(rule, alert) {
+		t.Errorf("Expected the healing context to be started again after expiration")
+	}
+}
+
+func TestCorrelationConcurrentAlerts(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	rule := makeCorrelatedRule("node-down", "NodeDown", "Start node")
+	alert := makeNodeAlert("NodeDown", "node0")
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	started := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if healer.startHealingContext(rule, alert) {
+				mutex.Lock()
+				started++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if started != 1 {
+		t.Errorf("Expected exactly one healing context to be started, but got %d", started)
+	}
+}
+
+func TestCorrelationKeyIgnoresOrder(t *testing.T) {
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"node": "node0",
+			"pod":  "pod0",
+		},
+	}
+	first := correlationKey(correlationLabels([]string{"node", "pod"}, alert))
+	second := correlationKey(correlationLabels([]string{"pod", "node"}, alert))
+	if first != `{"node":"node0","pod":"pod0"}` || first != second {
+		t.Errorf(
+			"Expected both keys to be '{\"node\":\"node0\",\"pod\":\"pod0\"}' but got '%s' and '%s'",
+			first,
+			second,
+		)
+	}
+}
+
+func TestCorrelationKeyIsNotAmbiguous(t *testing.T) {
+	first := correlationKey(map[string]string{
+		"node": "node0,pod=pod0",
+	})
+	second := correlationKey(map[string]string{
+		"node": "node0",
+		"pod":  "pod0",
+	})
+	if first == second {
+		t.Errorf("Expected different keys, but both are '%s'", first)
+	}
+}
+
+func TestAlertsWithoutCorrelationLabelsAreNotCorrelated(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+	rule := makeCorrelatedRule("node-down", "NodeDown", "Start node")
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+
+	// Without the 'node' label all the alerts would be the same entity, so they aren't correlated:
+	for i := 0; i < 2; i++ {
+		if !healer.startHealingContext(rule, alert) {
+			t.Errorf("Expected alert without correlation labels to be healed")
+		}
+	}
+}
+
+func TestCorrelationWithOverlappingLabels(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+	nodeRule := makeCorrelatedRule("node-down", "NodeDown", "Start node")
+	podRule := makeCorrelatedRule("pod-crash", "PodCrashLoopBackOff", "Restart pod")
+	podRule.CorrelateBy = []string{"node", "pod"}
+	podAlert := func(node, pod string) *alertmanager.Alert {
+		return &alertmanager.Alert{
+			Labels: map[string]string{
+				"alertname": "PodCrashLoopBackOff",
+				"node":      node,
+				"pod":       pod,
+			},
+		}
+	}
+
+	if !healer.startHealingContext(podRule, podAlert("node0", "pod0")) {
+		t.Fatalf("Expected the pod to be healed")
+	}
+
+	// The node contains the pod that is being healed:
+	if healer.startHealingContext(nodeRule, makeNodeAlert("NodeDown", "node0")) {
+		t.Errorf("Expected the node of the pod that is being healed to be ignored")
+	}
+	if !healer.startHealingContext(nodeRule, makeNodeAlert("NodeDown", "node1")) {
+		t.Errorf("Expected a different node to be healed")
+	}
+
+	// The pods of the node that is being healed are ignored, but not the rest:
+	if healer.startHealingContext(podRule, podAlert("node1", "pod1")) {
+		t.Errorf("Expected the pod of the node that is being healed to be ignored")
+	}
+	if !healer.startHealingContext(podRule, podAlert("node0", "pod2")) {
+		t.Errorf("Expected a different pod of a node that isn't being healed to be healed")
+	}
+}
+
+// failingActionRunner is an action runner that fails all the actions with an error that isn't
+// retryable.
+//
+type failingActionRunner struct {
+}
+
+func (r failingActionRunner) RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error {
+	return fmt.Errorf("Action of rule '%s' failed", rule.ObjectMeta.Name)
+}
+
+func makeCorrelatedRule(name, alertName, template string) *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: name,
+		},
+		Labels: map[string]string{
+			"alertname": alertName,
+		},
+		CorrelateBy: []string{"node"},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: template,
+		},
+	}
+}
+
+func makeNodeAlert(alertName, node string) *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": alertName,
+			"node":      node,
+		},
+	}
+}
@@ -0,0 +1,300 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the code that watches the HealingRule objects of the Kubernetes API and
+// merges them with the rules loaded from the configuration.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/apis/autoheal/v1alpha2"
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+// healingRulesResource is the name of the resource of the healing rules in the Kubernetes API.
+//
+const healingRulesResource = "healingrules"
+
+// HealingRulesClient is the part of the Kubernetes API of the healing rules that the healer uses
+// to list and watch them. An empty namespace means all the namespaces.
+//
+type HealingRulesClient interface {
+	List(namespace string) (*v1alpha2.HealingRuleList, error)
+	Watch(namespace, resourceVersion string) (watch.Interface, error)
+}
+
+// restHealingRulesClient is the implementation of the healing rules client that uses a REST client
+// for the API group of the healing rules.
+//
+type restHealingRulesClient struct {
+	client rest.Interface
+}
+
+// NewHealingRulesClient creates a client for the healing rules using the given configuration of
+// the connection to the Kubernetes API.
+//
+func NewHealingRulesClient(config *rest.Config) (HealingRulesClient, error) {
+	scheme := runtime.NewScheme()
+	err := v1alpha2.AddToScheme(scheme)
+	if err != nil {
+		return nil, err
+	}
+	meta.AddToGroupVersion(scheme, schema.GroupVersion{Version: "v1"})
+
+	// Make a copy of the configuration, as it is also used by the other clients:
+	copy := *config
+	copy.GroupVersion = &v1alpha2.SchemeGroupVersion
+	copy.APIPath = "/apis"
+	copy.ContentType = runtime.ContentTypeJSON
+	copy.NegotiatedSerializer = serializer.DirectCodecFactory{
+		CodecFactory: serializer.NewCodecFactory(scheme),
+	}
+	if copy.UserAgent == "" {
+		copy.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	client, err := rest.RESTClientFor(&copy)
+	if err != nil {
+		return nil, err
+	}
+	return &restHealingRulesClient{
+		client: client,
+	}, nil
+}
+
+func (c *restHealingRulesClient) List(namespace string) (*v1alpha2.HealingRuleList, error) {
+	list := new(v1alpha2.HealingRuleList)
+	err := c.client.Get().
+		Namespace(namespace).
+		Resource(healingRulesResource).
+		Do().
+		Into(list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (c *restHealingRulesClient) Watch(namespace, resourceVersion string) (watch.Interface, error) {
+	return c.client.Get().
+		Namespace(namespace).
+		Resource(healingRulesResource).
+		Param("watch", "true").
+		Param("resourceVersion", resourceVersion).
+		Watch()
+}
+
+// runCRDWatcher lists and watches the healing rules of the Kubernetes API till the given channel
+// is closed. When the watch is closed by the server the rules are listed and watched again.
+//
+func (h *Healer) runCRDWatcher(stopCh <-chan struct{}) {
+	wait.Until(func() {
+		err := h.watchCRDRules(stopCh)
+		if err != nil {
+			glog.Errorf("Can't watch healing rules: %s", err)
+		}
+	}, time.Second, stopCh)
+}
+
+// watchCRDRules lists the healing rules, sending to the rules queue the changes needed to make the
+// rules loaded from the API match the list, and then sends the changes received from the watch
+// till it is closed or the given channel is closed.
+//
+func (h *Healer) watchCRDRules(stopCh <-chan struct{}) error {
+	list, err := h.crdClient.List(h.crdNamespace)
+	if err != nil {
+		return err
+	}
+	listed := make(map[string]bool, len(list.Items))
+	for i := range list.Items {
+		item := &list.Items[i]
+		listed[ruleKey(&item.ObjectMeta)] = true
+		h.queueCRDChange(watch.Added, item)
+	}
+	h.crdRules.Range(func(key, value interface{}) bool {
+		if !listed[key.(string)] {
+			h.rulesQueue.Add(&RuleChange{
+				Type: watch.Deleted,
+				Rule: value.(*autoheal.HealingRule),
+				CRD:  true,
+			})
+		}
+		return true
+	})
+	glog.Infof("Found %d healing rules in the Kubernetes API", len(list.Items))
+
+	watcher, err := h.crdClient.Watch(h.crdNamespace, list.ResourceVersion)
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil
+			}
+			if event.Type == watch.Error {
+				return fmt.Errorf("%v", event.Object)
+			}
+			item, ok := event.Object.(*v1alpha2.HealingRule)
+			if !ok {
+				continue
+			}
+			h.queueCRDChange(event.Type, item)
+		}
+	}
+}
+
+// queueCRDChange converts the given healing rule to the internal representation, and sends the
+// corresponding change to the rules queue. Rules that aren't valid are sent as deleted, so that the
+// previous version, if any, is removed.
+//
+func (h *Healer) queueCRDChange(eventType watch.EventType, item *v1alpha2.HealingRule) {
+	rule := new(autoheal.HealingRule)
+	err := v1alpha2.Convert_v1alpha2_HealingRule_To_autoheal_HealingRule(item, rule, nil)
+	if err != nil {
+		glog.Errorf("Can't convert healing rule '%s': %s", item.ObjectMeta.Name, err)
+		return
+	}
+	if eventType != watch.Deleted {
+		err = config.CheckRule(rule)
+		if err == nil {
+			err = checkCRDRuleNamespaces(rule)
+		}
+		if err != nil {
+			glog.Warningf("Healing rule '%s' will be ignored: %s", rule.ObjectMeta.Name, err)
+			eventType = watch.Deleted
+		}
+	}
+	h.rulesQueue.Add(&RuleChange{
+		Type: eventType,
+		Rule: rule,
+		CRD:  true,
+	})
+}
+
+// checkCRDRuleNamespaces checks that the given rule, loaded from the Kubernetes API, only uses the
+// secrets and creates the batch jobs of its own namespace. Otherwise any user allowed to create
+// healing rules in one namespace could use the permissions of the service to read secrets or to
+// run jobs in other namespaces. Secret references without namespace are completed with the
+// namespace of the rule.
+//
+func checkCRDRuleNamespaces(rule *autoheal.HealingRule) error {
+	namespace := rule.ObjectMeta.Namespace
+	var refs []*core.SecretReference
+	if rule.WebhookJob != nil && rule.WebhookJob.SecretRef != nil {
+		refs = append(refs, rule.WebhookJob.SecretRef)
+	}
+	if rule.WebhookJob != nil && rule.WebhookJob.SigningSecretRef != nil {
+		refs = append(refs, rule.WebhookJob.SigningSecretRef)
+	}
+	if rule.SlackJob != nil && rule.SlackJob.SecretRef != nil {
+		refs = append(refs, rule.SlackJob.SecretRef)
+	}
+	for _, ref := range refs {
+		if ref.Namespace == "" {
+			ref.Namespace = namespace
+		}
+		if ref.Namespace != namespace {
+			return fmt.Errorf(
+				"Secret '%s/%s' isn't in the namespace '%s' of the rule",
+				ref.Namespace,
+				ref.Name,
+				namespace,
+			)
+		}
+	}
+	if rule.BatchJob != nil {
+		jobNamespace := rule.BatchJob.ObjectMeta.Namespace
+		if jobNamespace != "" && jobNamespace != namespace {
+			return fmt.Errorf(
+				"Batch job namespace '%s' isn't the namespace '%s' of the rule",
+				jobNamespace,
+				namespace,
+			)
+		}
+	}
+	return nil
+}
+
+// processCRDRuleChange updates the rules loaded from the API with the given change, and applies it
+// to the rules cache unless the configuration contains a rule with the same name, as those take
+// precedence.
+//
+func (h *Healer) processCRDRuleChange(change *RuleChange) error {
+	name := change.Rule.ObjectMeta.Name
+	switch change.Type {
+	case watch.Added, watch.Modified:
+		h.crdRules.Store(ruleKey(&change.Rule.ObjectMeta), change.Rule)
+		if h.isConfiguredRule(name) {
+			glog.Warningf(
+				"Healing rule '%s' from the Kubernetes API is ignored because the "+
+					"configuration contains a rule with the same name",
+				name,
+			)
+			return nil
+		}
+		return h.processAddedRule(change.Rule)
+	case watch.Deleted:
+		h.crdRules.Delete(ruleKey(&change.Rule.ObjectMeta))
+		if h.isConfiguredRule(name) {
+			return nil
+		}
+		return h.processDeletedRule(change.Rule)
+	}
+	return nil
+}
+
+// queueCRDRules sends to the rules queue the rules loaded from the API, so that they are added
+// again to the rules cache after reloading the rules of the configuration.
+//
+func (h *Healer) queueCRDRules() {
+	h.crdRules.Range(func(_, value interface{}) bool {
+		h.rulesQueue.Add(&RuleChange{
+			Type: watch.Added,
+			Rule: value.(*autoheal.HealingRule),
+			CRD:  true,
+		})
+		return true
+	})
+}
+
+// isConfiguredRule checks if the configuration contains a rule with the given name.
+//
+func (h *Healer) isConfiguredRule(name string) bool {
+	for _, rule := range h.config.Rules() {
+		if rule.ObjectMeta.Name == name {
+			return true
+		}
+	}
+	return false
+}
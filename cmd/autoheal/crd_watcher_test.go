@@ -0,0 +1,407 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/apis/autoheal/v1alpha2"
+)
+
+func TestCRDRulesAreAddedUpdatedAndDeleted(t *testing.T) {
+	client := newFakeHealingRulesClient(makeCRDRule("crd-rule", "1", "First template"))
+	healer := makeCRDHealer(t, client)
+	defer healer.config.ShutDown()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go healer.watchCRDRules(stopCh)
+
+	// The listed rule is added:
+	healer.pickRuleChange()
+	rule := loadCachedRule(healer, "crd-rule")
+	if rule == nil || rule.AWXJob.Template != "First template" {
+		t.Fatalf("Expected the listed rule to be added to the cache, but got %v", rule)
+	}
+
+	// The modified rule replaces it:
+	client.watcher.Modify(makeCRDRule("crd-rule", "2", "Second template"))
+	healer.pickRuleChange()
+	rule = loadCachedRule(healer, "crd-rule")
+	if rule == nil || rule.AWXJob.Template != "Second template" {
+		t.Errorf("Expected the modified rule to be in the cache, but got %v", rule)
+	}
+
+	// The deleted rule is removed:
+	client.watcher.Delete(makeCRDRule("crd-rule", "3", "Second template"))
+	healer.pickRuleChange()
+	if loadCachedRule(healer, "crd-rule") != nil {
+		t.Errorf("Expected the deleted rule to be removed from the cache")
+	}
+}
+
+func TestInvalidCRDRuleIsIgnored(t *testing.T) {
+	invalid := makeCRDRule("crd-rule", "1", "")
+	invalid.AWXJob = nil
+	client := newFakeHealingRulesClient(invalid)
+	healer := makeCRDHealer(t, client)
+	defer healer.config.ShutDown()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go healer.watchCRDRules(stopCh)
+
+	healer.pickRuleChange()
+	if loadCachedRule(healer, "crd-rule") != nil {
+		t.Errorf("Expected the rule without action to be ignored")
+	}
+}
+
+func TestConfiguredRulesTakePrecedenceOverCRDRules(t *testing.T) {
+	client := newFakeHealingRulesClient(makeCRDRule("first-rule", "1", "CRD template"))
+	healer := makeCRDHealer(t, client)
+	defer healer.config.ShutDown()
+	loadRulesCache(healer)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go healer.watchCRDRules(stopCh)
+
+	// The rule from the API doesn't replace the one from the configuration:
+	healer.pickRuleChange()
+	rule := loadCachedRule(healer, "first-rule")
+	if rule == nil || rule.AWXJob.Template != "First template" {
+		t.Errorf("Expected the rule from the configuration to be kept, but got %v", rule)
+	}
+
+	// And deleting it doesn't remove the one from the configuration:
+	client.watcher.Delete(makeCRDRule("first-rule", "2", "CRD template"))
+	healer.pickRuleChange()
+	if loadCachedRule(healer, "first-rule") == nil {
+		t.Errorf("Expected the rule from the configuration to still be in the cache")
+	}
+}
+
+func TestReloadKeepsCRDRules(t *testing.T) {
+	client := newFakeHealingRulesClient(makeCRDRule("crd-rule", "1", "CRD template"))
+	healer := makeCRDHealer(t, client)
+	defer healer.config.ShutDown()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go healer.watchCRDRules(stopCh)
+	healer.pickRuleChange()
+
+	// Reload the rules of the configuration, and process all the resulting changes:
+	healer.reloadAllRules()
+	for healer.rulesQueue.Len() > 0 {
+		healer.pickRuleChange()
+	}
+
+	for _, name := range []string{"first-rule", "second-rule", "crd-rule"} {
+		if loadCachedRule(healer, name) == nil {
+			t.Errorf("Expected rule '%s' to be in the cache after the reload", name)
+		}
+	}
+	missing, extra := healer.checkRulesCache()
+	if len(missing) != 0 || len(extra) != 0 {
+		t.Errorf("Expected consistent cache, but got missing %v and extra %v", missing, extra)
+	}
+}
+
+func TestCRDRulesWithSameNameInDifferentNamespaces(t *testing.T) {
+	first := makeCRDRule("crd-rule", "1", "First template")
+	first.ObjectMeta.Namespace = "first-namespace"
+	second := makeCRDRule("crd-rule", "2", "Second template")
+	second.ObjectMeta.Namespace = "second-namespace"
+	client := newFakeHealingRulesClient(first, second)
+	healer := makeCRDHealer(t, client)
+	defer healer.config.ShutDown()
+	loadRulesCache(healer)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go healer.watchCRDRules(stopCh)
+
+	// Both rules are added, each with its own key:
+	healer.pickRuleChange()
+	healer.pickRuleChange()
+	rule := loadCachedRule(healer, "first-namespace/crd-rule")
+	if rule == nil || rule.AWXJob.Template != "First template" {
+		t.Errorf("Expected the rule of the first namespace to be in the cache, but got %v", rule)
+	}
+	rule = loadCachedRule(healer, "second-namespace/crd-rule")
+	if rule == nil || rule.AWXJob.Template != "Second template" {
+		t.Errorf("Expected the rule of the second namespace to be in the cache, but got %v", rule)
+	}
+
+	// Deleting one of them doesn't remove the other:
+	client.watcher.Delete(first)
+	healer.pickRuleChange()
+	if loadCachedRule(healer, "first-namespace/crd-rule") != nil {
+		t.Errorf("Expected the rule of the first namespace to be removed from the cache")
+	}
+	if loadCachedRule(healer, "second-namespace/crd-rule") == nil {
+		t.Errorf("Expected the rule of the second namespace to still be in the cache")
+	}
+	missing, extra := healer.checkRulesCache()
+	if len(missing) != 0 || len(extra) != 0 {
+		t.Errorf("Expected consistent cache, but got missing %v and extra %v", missing, extra)
+	}
+}
+
+func TestCheckCRDRuleNamespaces(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  *autoheal.HealingRule
+		valid bool
+	}{
+		{
+			name: "webhook secret in the same namespace",
+			rule: &autoheal.HealingRule{
+				WebhookJob: &autoheal.WebhookAction{
+					SecretRef: &core.SecretReference{Namespace: "my-namespace", Name: "my-secret"},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "webhook secret without namespace",
+			rule: &autoheal.HealingRule{
+				WebhookJob: &autoheal.WebhookAction{
+					SecretRef: &core.SecretReference{Name: "my-secret"},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "webhook secret in other namespace",
+			rule: &autoheal.HealingRule{
+				WebhookJob: &autoheal.WebhookAction{
+					SecretRef: &core.SecretReference{Namespace: "autoheal", Name: "autoheal-config"},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "webhook signing secret in other namespace",
+			rule: &autoheal.HealingRule{
+				WebhookJob: &autoheal.WebhookAction{
+					SigningSecretRef: &core.SecretReference{Namespace: "autoheal", Name: "autoheal-config"},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "slack secret in other namespace",
+			rule: &autoheal.HealingRule{
+				SlackJob: &autoheal.SlackAction{
+					SecretRef: &core.SecretReference{Namespace: "autoheal", Name: "autoheal-config"},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "batch job without namespace",
+			rule: &autoheal.HealingRule{
+				BatchJob: &batch.Job{},
+			},
+			valid: true,
+		},
+		{
+			name: "batch job in other namespace",
+			rule: &autoheal.HealingRule{
+				BatchJob: &batch.Job{
+					ObjectMeta: meta.ObjectMeta{Namespace: "kube-system"},
+				},
+			},
+			valid: false,
+		},
+	}
+	for _, test := range tests {
+		test.rule.ObjectMeta.Name = "my-rule"
+		test.rule.ObjectMeta.Namespace = "my-namespace"
+		err := checkCRDRuleNamespaces(test.rule)
+		if test.valid && err != nil {
+			t.Errorf("Expected rule with %s to be valid, but got: %s", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Expected rule with %s to be rejected", test.name)
+		}
+	}
+}
+
+func TestCRDRuleSecretDefaultsToRuleNamespace(t *testing.T) {
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      "my-rule",
+			Namespace: "my-namespace",
+		},
+		WebhookJob: &autoheal.WebhookAction{
+			SecretRef: &core.SecretReference{Name: "my-secret"},
+		},
+	}
+	err := checkCRDRuleNamespaces(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.WebhookJob.SecretRef.Namespace != "my-namespace" {
+		t.Errorf(
+			"Expected the secret namespace to be 'my-namespace', but got '%s'",
+			rule.WebhookJob.SecretRef.Namespace,
+		)
+	}
+}
+
+func TestBuildRequiresHealingRulesClient(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		WatchCRDs(true).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error when watching the rules without a client")
+	}
+}
+
+func TestRESTHealingRulesClient(t *testing.T) {
+	path := "/apis/autoheal.openshift.io/v1alpha2/namespaces/my-namespace/healingrules"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			if r.URL.Query().Get("resourceVersion") != "10" {
+				t.Errorf("Expected resource version '10', but got '%s'", r.URL.RawQuery)
+			}
+			fmt.Fprintf(w, `{"type": "ADDED", "object": %s}`+"\n", crdRuleJSON)
+			return
+		}
+		fmt.Fprintf(
+			w,
+			`{"apiVersion": "autoheal.openshift.io/v1alpha2", "kind": "HealingRuleList", `+
+				`"metadata": {"resourceVersion": "10"}, "items": [%s]}`,
+			crdRuleJSON,
+		)
+	}))
+	defer server.Close()
+
+	client, err := NewHealingRulesClient(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := client.List("my-namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].AWXJob.Template != "Start node" {
+		t.Fatalf("Expected one rule with template 'Start node', but got %+v", list.Items)
+	}
+
+	watcher, err := client.Watch("my-namespace", list.ResourceVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+	event := <-watcher.ResultChan()
+	if event.Type != watch.Added {
+		t.Errorf("Expected an added event, but got '%s'", event.Type)
+	}
+	rule, ok := event.Object.(*v1alpha2.HealingRule)
+	if !ok || rule.ObjectMeta.Name != "start-node" {
+		t.Errorf("Expected rule 'start-node', but got %v", event.Object)
+	}
+}
+
+const crdRuleJSON = `{
+	"apiVersion": "autoheal.openshift.io/v1alpha2",
+	"kind": "HealingRule",
+	"metadata": {"name": "start-node", "namespace": "my-namespace"},
+	"labels": {"alertname": "NodeDown"},
+	"awxJob": {"template": "Start node"}
+}`
+
+func makeCRDHealer(t *testing.T, client HealingRulesClient) *Healer {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "rules-config.yml")).
+		MinimumRunnersRequired(0).
+		WatchCRDs(true).
+		HealingRulesClient(client).
+		Build()
+	if err != nil {
+		t.Fatalf("Error building healer: %s", err)
+	}
+	return healer
+}
+
+func makeCRDRule(name, resourceVersion, template string) *v1alpha2.HealingRule {
+	return &v1alpha2.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name:            name,
+			ResourceVersion: resourceVersion,
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		AWXJob: &v1alpha2.AWXJobAction{
+			Template: template,
+		},
+	}
+}
+
+func loadCachedRule(healer *Healer, name string) *autoheal.HealingRule {
+	value, ok := healer.rulesCache.Load(name)
+	if !ok {
+		return nil
+	}
+	return value.(*autoheal.HealingRule)
+}
+
+// fakeHealingRulesClient is a healing rules client that returns a fixed list of rules, and a fake
+// watcher that the tests use to send events.
+//
+type fakeHealingRulesClient struct {
+	rules   []*v1alpha2.HealingRule
+	watcher *watch.FakeWatcher
+}
+
+func newFakeHealingRulesClient(rules ...*v1alpha2.HealingRule) *fakeHealingRulesClient {
+	return &fakeHealingRulesClient{
+		rules:   rules,
+		watcher: watch.NewFake(),
+	}
+}
+
+func (c *fakeHealingRulesClient) List(namespace string) (*v1alpha2.HealingRuleList, error) {
+	list := new(v1alpha2.HealingRuleList)
+	for _, rule := range c.rules {
+		list.Items = append(list.Items, *rule)
+	}
+	return list, nil
+}
+
+func (c *fakeHealingRulesClient) Watch(namespace, resourceVersion string) (watch.Interface, error) {
+	return c.watcher, nil
+}
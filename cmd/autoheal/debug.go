@@ -0,0 +1,141 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the handlers of the endpoints used to inspect the internal state of the
+// healer.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/memory"
+	"github.com/openshift/autoheal/pkg/receiver"
+)
+
+// debugRulesHandler creates the handler for the /debug/rules endpoint. It requires the admin
+// token, as the throttled actions may contain credentials, like extra variables, webhook headers
+// or Slack webhook URLs.
+//
+func (h *Healer) debugRulesHandler() http.Handler {
+	return receiver.NewMiddlewareChain(
+		receiver.LoggingMiddleware,
+		receiver.AuthMiddleware(h.managementToken()),
+	).Then(http.HandlerFunc(h.handleDebugRulesRequest))
+}
+
+// debugRulesResponse is the body of the response of the /debug/rules endpoint.
+//
+type debugRulesResponse struct {
+	// The rules that are currently loaded, sorted by name:
+	Rules []*debugRule `json:"rules"`
+
+	// The actions that have been executed recently, and that will be throttled till they expire:
+	Throttled []*debugThrottledAction `json:"throttled"`
+}
+
+// debugRule contains the details of a loaded rule.
+//
+type debugRule struct {
+	Name       string `json:"name"`
+	ActionType string `json:"actionType"`
+}
+
+// debugThrottledAction contains the details of an action that has been executed recently.
+//
+type debugThrottledAction struct {
+	Type      string      `json:"type"`
+	Action    interface{} `json:"action"`
+	AddedAt   time.Time   `json:"addedAt"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+}
+
+// appendThrottledActions adds to the given slice the actions stored in the given memory.
+//
+func appendThrottledActions(throttled []*debugThrottledAction,
+	actionMemory *memory.ShortTermMemory) []*debugThrottledAction {
+	duration := actionMemory.Duration()
+	actionMemory.Range(func(item interface{}, addedAt time.Time) bool {
+		throttled = append(throttled, &debugThrottledAction{
+			Type:      reflect.TypeOf(item).Elem().Name(),
+			Action:    item,
+			AddedAt:   addedAt,
+			ExpiresAt: addedAt.Add(duration),
+		})
+		return true
+	})
+	return throttled
+}
+
+// handleDebugRulesRequest returns the rules that are currently loaded, and the actions that are
+// currently throttled with their expiry times.
+//
+func (h *Healer) handleDebugRulesRequest(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(
+			response,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+
+	// Collect the rules:
+	body := &debugRulesResponse{
+		Rules:     make([]*debugRule, 0),
+		Throttled: make([]*debugThrottledAction, 0),
+	}
+	h.rulesCache.Range(func(_, value interface{}) bool {
+		rule := value.(*autoheal.HealingRule)
+		body.Rules = append(body.Rules, &debugRule{
+			Name:       ruleKey(&rule.ObjectMeta),
+			ActionType: ruleActionType(rule),
+		})
+		return true
+	})
+	sort.Slice(body.Rules, func(i, j int) bool {
+		return body.Rules[i].Name < body.Rules[j].Name
+	})
+
+	// Collect the throttled actions, from the global memory and from the memories of the rules
+	// that have their own throttle interval:
+	body.Throttled = appendThrottledActions(body.Throttled, h.actionMemory)
+	h.ruleMemories.Range(func(_, value interface{}) bool {
+		body.Throttled = appendThrottledActions(body.Throttled, value.(*memory.ShortTermMemory))
+		return true
+	})
+
+	// Write the response body:
+	data, err := json.Marshal(body)
+	if err != nil {
+		glog.Errorf("Can't generate debug rules response body: %s", err)
+		http.Error(
+			response,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/memory"
+)
+
+func TestDebugRulesShowsThrottledActions(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	healer.actionMemory, _ = memory.NewShortTermMemoryBuilder().Duration(time.Hour).Build()
+	healer.rulesCache.Store("start-node", &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "start-node",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Start node",
+		},
+	})
+	before := time.Now()
+	healer.actionMemory.Add(&autoheal.AWXJobAction{
+		Template: "Start node",
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/debug/rules", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleDebugRulesRequest(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d", recorder.Code)
+	}
+	var body debugRulesResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Rules) != 1 || body.Rules[0].Name != "start-node" || body.Rules[0].ActionType != "awxJob" {
+		t.Errorf("Expected rule 'start-node' with action type 'awxJob', but got %+v", body.Rules)
+	}
+	if len(body.Throttled) != 1 {
+		t.Fatalf("Expected one throttled action, but got %d", len(body.Throttled))
+	}
+	throttled := body.Throttled[0]
+	if throttled.Type != "AWXJobAction" {
+		t.Errorf("Expected type 'AWXJobAction', but got '%s'", throttled.Type)
+	}
+	if throttled.ExpiresAt.Sub(throttled.AddedAt) != time.Hour {
+		t.Errorf("Expected the action to expire an hour after it was added, but it expires at %s", throttled.ExpiresAt)
+	}
+	if throttled.AddedAt.Before(before.Truncate(time.Second)) {
+		t.Errorf("Expected the action to be added after %s, but it was added at %s", before, throttled.AddedAt)
+	}
+}
+
+func TestDebugRulesRejectsPost(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	request := httptest.NewRequest(http.MethodPost, "/debug/rules", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleDebugRulesRequest(recorder, request)
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, but got %d", recorder.Code)
+	}
+}
+
+func TestDebugRulesShowsRuleMemories(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	ruleMemory, _ := memory.NewShortTermMemoryBuilder().Duration(time.Minute).Build()
+	ruleMemory.Add(&autoheal.AWXJobAction{
+		Template: "Restart service",
+	})
+	healer.ruleMemories.Store("restart-service", ruleMemory)
+
+	request := httptest.NewRequest(http.MethodGet, "/debug/rules", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleDebugRulesRequest(recorder, request)
+	var body debugRulesResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Throttled) != 1 {
+		t.Fatalf("Expected one throttled action, but got %d", len(body.Throttled))
+	}
+	throttled := body.Throttled[0]
+	if throttled.ExpiresAt.Sub(throttled.AddedAt) != time.Minute {
+		t.Errorf("Expected the action to expire a minute after it was added, but it expires at %s", throttled.ExpiresAt)
+	}
+}
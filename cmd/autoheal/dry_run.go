@@ -0,0 +1,46 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions that implement the dry run mode of the healer, where the actions
+// are written to the log instead of executed.
+
+package main
+
+import (
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// logDryRun writes to the log the YAML representation of the action that would have been executed
+// by the given rule to heal the given alert. The action should have already been processed by the
+// templates.
+//
+func logDryRun(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error {
+	data, err := yaml.Marshal(action)
+	if err != nil {
+		return err
+	}
+	glog.Infof(
+		"Dry run of action of rule '%s' to heal alert '%s', it won't be executed:\n%s",
+		rule.ObjectMeta.Name,
+		alert.Name(),
+		data,
+	)
+	return nil
+}
@@ -17,16 +17,26 @@ limitations under the License.
 package main
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	goruntime "runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
+	"golang.org/x/net/http2"
 	"golang.org/x/sync/syncmap"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
@@ -35,11 +45,16 @@ import (
 
 	"github.com/openshift/autoheal/pkg/alertmanager"
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/auditlog"
 	"github.com/openshift/autoheal/pkg/awxrunner"
 	"github.com/openshift/autoheal/pkg/batchrunner"
 	"github.com/openshift/autoheal/pkg/config"
 	"github.com/openshift/autoheal/pkg/memory"
 	"github.com/openshift/autoheal/pkg/metrics"
+	"github.com/openshift/autoheal/pkg/receiver"
+	"github.com/openshift/autoheal/pkg/runner"
+	"github.com/openshift/autoheal/pkg/slackrunner"
+	"github.com/openshift/autoheal/pkg/webhookrunner"
 )
 
 // HealerBuilder is used to create new healers.
@@ -48,14 +63,117 @@ type HealerBuilder struct {
 	// Configuration files.
 	configFiles []string
 
+	// Config maps that contain configuration files, loaded after the files.
+	configMaps []types.NamespacedName
+
 	// Kubernetes client.
 	k8sClient kubernetes.Interface
+
+	// Whether to check that the AWX job templates used by the rules exist when the configuration is
+	// loaded.
+	validateAWXTemplates bool
+
+	// The minimum number of action runners that should be successfully initialized.
+	minimumRunnersRequired int
+
+	// How many processed alerts to remember.
+	historySize int
+
+	// Directory containing the plugins that provide additional action runners.
+	pluginDir string
+
+	// The version of the format of the messages sent by the alert manager.
+	alertmanagerVersion alertmanager.MessageVersion
+
+	// How often to check that the rules cache is consistent with the configuration, and whether to
+	// fix the differences.
+	cacheCheckInterval time.Duration
+	cacheAutoCorrect   bool
+
+	// Whether to watch the healing rules of the Kubernetes API, the namespace where they are
+	// watched, and the client used to do it.
+	watchCRDs    bool
+	crdNamespace string
+	crdClient    HealingRulesClient
+
+	// Whether to save the output of the batch jobs in config maps.
+	batchCaptureOutput bool
+
+	// How long to wait for in flight requests and pending alerts when shutting down.
+	shutdownGracePeriod time.Duration
+
+	// How long to wait for the active AWX and batch jobs to finish when shutting down.
+	drainTimeout time.Duration
+
+	// The labels and annotations that are removed from alerts before checking the rules.
+	stripLabels []string
+
+	// Whether to remove leading and trailing white space from the values of the labels and
+	// annotations before checking the rules.
+	trimLabelValues bool
+
+	// The maximum fraction of the retry delay of alerts that is added randomly.
+	retryJitterFactor float64
+
+	// The maximum number of rules loaded by each step of a reload of the rules cache.
+	maxRulesPerReload int
+
+	// The address where the web server listens, and the path where it receives the alerts.
+	listenAddress string
+	receiverPath  string
+
+	// The files containing the TLS certificate and key of the web server, and whether to disable
+	// HTTP/2 when TLS is used.
+	tlsCertFile  string
+	tlsKeyFile   string
+	disableHTTP2 bool
+
+	// The HTTP header that contains the identifier of the alert manager that sent the alerts.
+	alertSourceHeader string
+
+	// The bearer token that the alert manager needs to send, and the maximum number of requests
+	// per second accepted from it.
+	alertsToken     string
+	alertsRateLimit float64
+
+	// The maximum size, in bytes, of the bodies of the requests sent by the alert manager.
+	maxRequestBody int64
+
+	// The bearer token required by the endpoints that inspect or change the state of the healer.
+	adminToken string
+
+	// The number of spaces used to indent the request bodies written to the log.
+	logJSONIndent int
+
+	// Whether to write the actions to the log instead of executing them.
+	dryRun bool
+
+	// The name and namespace of the config map where the actions are recorded for auditing, how
+	// often it is written, and the maximum number of entries that it keeps. An empty name means
+	// that the actions aren't recorded.
+	auditConfigMap     string
+	auditNamespace     string
+	auditFlushInterval time.Duration
+	auditMaxEntries    int
+
+	// Whether to create a Kubernetes service that points to the web server, and its name, namespace
+	// and pod selector. The pod name is recorded in the service, so that only the pod that
+	// registered it last deletes it.
+	autoRegisterService bool
+	serviceName         string
+	serviceNamespace    string
+	serviceSelector     map[string]string
+	podName             string
 }
 
 // Healer contains the information needed to receive notifications about changes in the
 // Prometheus configuration and to start or reload it when there are changes.
 //
 type Healer struct {
+	// The number of alerts received that haven't been processed yet. It is the first field so that
+	// it is correctly aligned for atomic operations.
+	pendingAlerts int64
+
 	// The configuration.
 	config *config.Config
 
@@ -65,6 +183,9 @@ type Healer struct {
 	// The current set of healing rules.
 	rulesCache *syncmap.Map
 
+	// The compiled regular expressions used by the rules, indexed by pattern.
+	patternsCache *syncmap.Map
+
 	// We use two queues, one to process updates to the rules and another to process incoming
 	// notifications from the alert manager:
 	rulesQueue  workqueue.RateLimitingInterface
@@ -73,14 +194,187 @@ type Healer struct {
 	// Executed actions will be stored here in order to prevent repeated execution.
 	actionMemory *memory.ShortTermMemory
 
+	// The memories of the executed actions of the rules that have their own throttle interval,
+	// indexed by rule name. The values are *memory.ShortTermMemory.
+	ruleMemories *syncmap.Map
+
+	// The last time that each rule matched an alert that was processed, indexed by rule name. The
+	// values are time.Time.
+	ruleMatches *syncmap.Map
+
+	// The last processed alerts and the outcomes of their actions.
+	history *receiver.History
+
+	// The entities that are being healed, indexed by the values of the labels used to correlate
+	// alerts. The mutex makes checking and adding contexts atomic.
+	healingContexts      *syncmap.Map
+	healingContextsMutex *sync.Mutex
+
 	// a map of ActionRunner which run awx/batch/etc actions.
-	actionRunners map[ActionRunnerType]ActionRunner
+	actionRunners map[ActionRunnerType]runner.ActionRunner
+
+	// The action runners loaded from plugins, indexed by the type that the rules use to select
+	// them.
+	pluginRunners map[string]runner.ActionRunner
+
+	// The AWX runner, if it was successfully initialized. It is also stored in the map of action
+	// runners, but we need it here as well because it has to be started.
+	awxRunner *awxrunner.Runner
+
+	// The batch runner, if it was successfully initialized. It is also stored in the map of action
+	// runners, but we need it here as well because it has to be started.
+	batchRunner *batchrunner.Runner
+
+	// The webhook runner. It isn't stored in the map of action runners because it doesn't need any
+	// configuration, so it is always available and it shouldn't count as one of the runners that
+	// the configuration enabled.
+	webhookRunner *webhookrunner.Runner
+
+	// The Slack runner. Like the webhook runner it isn't stored in the map of action runners
+	// because it doesn't need any configuration.
+	slackRunner *slackrunner.Runner
+
+	// Whether to check that the AWX job templates used by the rules exist when the configuration is
+	// loaded.
+	validateAWXTemplates bool
+
+	// How long to wait for in flight requests and pending alerts when shutting down.
+	shutdownGracePeriod time.Duration
+
+	// How long to wait for the active AWX and batch jobs to finish when shutting down.
+	drainTimeout time.Duration
+
+	// The version of the format of the messages sent by the alert manager.
+	alertmanagerVersion alertmanager.MessageVersion
+
+	// How often to check that the rules cache is consistent with the configuration, and whether to
+	// fix the differences.
+	cacheCheckInterval time.Duration
+	cacheAutoCorrect   bool
+
+	// The client used to watch the healing rules of the Kubernetes API, nil if they aren't
+	// watched, the namespace where they are watched, and the rules loaded from the API, indexed
+	// by name. These are kept even when the configuration contains a rule with the same name, so
+	// that they can be used if that rule is removed.
+	crdClient    HealingRulesClient
+	crdNamespace string
+	crdRules     *syncmap.Map
+
+	// The labels and annotations that are removed from alerts before checking the rules.
+	stripLabels map[string]bool
+
+	// Whether to remove leading and trailing white space from the values of the labels and
+	// annotations before checking the rules.
+	trimLabelValues bool
+
+	// The maximum number of rules loaded by each call to reloadRulesCache, zero means no limit, and
+	// the position in the list of rules where the next call should continue. The mutex prevents
+	// running several reloads simultaneously.
+	maxRulesPerReload int
+	reloadCursor      int
+	reloadMutex       *sync.Mutex
+
+	// Set to one, atomically, when the first reload of the rules cache has finished, so that the
+	// readiness endpoint can report that the healer is ready to process alerts.
+	ready int32
+
+	// The namespaces that have the labels given in the configuration, if any. Alerts that refer
+	// to other namespaces are discarded. The mutex protects it, as it is replaced when the labels
+	// change in the configuration.
+	namespaceScope      *namespaceScope
+	namespaceScopeMutex *sync.RWMutex
+
+	// The address where the web server listens, and its port, used for the registered service.
+	listenAddress string
+	listenPort    int
+
+	// The path where the web server receives the alerts.
+	receiverPath string
+
+	// The files containing the TLS certificate and key of the web server, and whether to disable
+	// HTTP/2 when TLS is used.
+	tlsCertFile  string
+	tlsKeyFile   string
+	disableHTTP2 bool
+
+	// The HTTP header that contains the identifier of the alert manager that sent the alerts.
+	alertSourceHeader string
+
+	// The bearer token that the alert manager needs to send, and the maximum number of requests
+	// per second accepted from it.
+	alertsToken     string
+	alertsRateLimit float64
+
+	// The maximum size, in bytes, of the bodies of the requests sent by the alert manager.
+	maxRequestBody int64
+
+	// The bearer token required by the endpoints that inspect or change the state of the healer.
+	adminToken string
+
+	// The number of spaces used to indent the request bodies written to the log.
+	logJSONIndent int
+
+	// Whether to write the actions to the log instead of executing them.
+	dryRun bool
+
+	// The recorder that keeps the history of the actions in a config map, if enabled.
+	auditRecorder *auditlog.Recorder
+
+	// Whether to create a Kubernetes service that points to the web server, and its name, namespace
+	// and pod selector. The pod name is recorded in the service, so that only the pod that
+	// registered it last deletes it.
+	autoRegisterService bool
+	serviceName         string
+	serviceNamespace    string
+	serviceSelector     map[string]string
+	podName             string
+}
+
+// DefaultAlertSourceHeader is the HTTP header used by default to find the alert manager that sent
+// the alerts.
+//
+const DefaultAlertSourceHeader = "X-Forwarded-For"
+
+// DefaultListenAddress is the address where the web server listens by default.
+//
+const DefaultListenAddress = ":9099"
+
+// DefaultReceiverPath is the path where the web server receives the alerts by default.
+//
+const DefaultReceiverPath = "/alerts"
+
+// DefaultStripLabels are the labels added by the alert manager for routing purposes, that are
+// removed by default before checking the rules.
+//
+var DefaultStripLabels = []string{
+	"receiver",
+	"alertstate",
 }
 
 // NewHealerBuilder creates a new builder for healers.
 //
 func NewHealerBuilder() *HealerBuilder {
 	b := new(HealerBuilder)
+	b.minimumRunnersRequired = 1
+	b.historySize = 100
+	b.alertmanagerVersion = alertmanager.MessageVersionAuto
+	b.cacheCheckInterval = 10 * time.Minute
+	b.shutdownGracePeriod = 30 * time.Second
+	b.drainTimeout = 5 * time.Minute
+	b.stripLabels = DefaultStripLabels
+	b.retryJitterFactor = 0.2
+	b.alertSourceHeader = DefaultAlertSourceHeader
+	b.logJSONIndent = receiver.DefaultIndent
+	b.maxRequestBody = receiver.DefaultMaxRequestBody
+	b.listenAddress = DefaultListenAddress
+	b.receiverPath = DefaultReceiverPath
+	b.serviceName = "autoheal"
+	b.serviceNamespace = meta.NamespaceDefault
+	b.serviceSelector = DefaultServiceSelector
+	b.podName, _ = os.Hostname()
+	b.auditNamespace = meta.NamespaceDefault
+	b.auditFlushInterval = 30 * time.Second
+	b.auditMaxEntries = 1000
 	return b
 }
 
@@ -103,6 +397,18 @@ func (b *HealerBuilder) ConfigFiles(paths []string) *HealerBuilder {
 	return b
 }
 
+// ConfigMap adds a config map that contains configuration files. The keys whose names end in .yml
+// or .yaml are loaded, in alphabetical order, after the configuration files. This requires a
+// Kubernetes client, and the config maps are reloaded periodically to pick up changes.
+//
+func (b *HealerBuilder) ConfigMap(namespace, name string) *HealerBuilder {
+	b.configMaps = append(b.configMaps, types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	})
+	return b
+}
+
 // KubernetesClient sets the Kubernetes client that will be used by the healer.
 //
 func (b *HealerBuilder) KubernetesClient(client kubernetes.Interface) *HealerBuilder {
@@ -110,26 +416,470 @@ func (b *HealerBuilder) KubernetesClient(client kubernetes.Interface) *HealerBui
 	return b
 }
 
+// ValidateAWXTemplates sets the flag that indicates if the healer should check that the AWX job
+// templates used by the rules exist when the configuration is loaded. Missing templates are
+// reported as warnings, because the AWX server may be temporarily unavailable. The default is to
+// not check them.
+//
+func (b *HealerBuilder) ValidateAWXTemplates(flag bool) *HealerBuilder {
+	b.validateAWXTemplates = flag
+	return b
+}
+
+// MinimumRunnersRequired sets the minimum number of action runners, for example the AWX runner or
+// the batch job runner, that should be successfully initialized. If fewer runners are initialized
+// the Build method will return an error. The default is one.
+//
+func (b *HealerBuilder) MinimumRunnersRequired(count int) *HealerBuilder {
+	b.minimumRunnersRequired = count
+	return b
+}
+
+// HistorySize sets how many processed alerts the healer will remember, and return in the /history
+// endpoint. The default is 100.
+//
+func (b *HealerBuilder) HistorySize(size int) *HealerBuilder {
+	b.historySize = size
+	return b
+}
+
+// PluginDir sets the directory containing the plugins that provide additional action runners. All
+// the files inside this directory whose names end with .so will be loaded. The default is to not
+// load any plugin.
+//
+func (b *HealerBuilder) PluginDir(dir string) *HealerBuilder {
+	b.pluginDir = dir
+	return b
+}
+
+// AlertmanagerVersion sets the version of the format of the messages sent by the alert manager. The
+// default is to detect it automatically for each message.
+//
+func (b *HealerBuilder) AlertmanagerVersion(version alertmanager.MessageVersion) *HealerBuilder {
+	b.alertmanagerVersion = version
+	return b
+}
+
+// CacheCheckInterval sets how often the healer will check that the rules cache is consistent with
+// the configuration. The default is ten minutes. A zero value disables the check.
+//
+func (b *HealerBuilder) CacheCheckInterval(interval time.Duration) *HealerBuilder {
+	b.cacheCheckInterval = interval
+	return b
+}
+
+// CacheAutoCorrect sets whether the healer will fix the differences between the rules cache and the
+// configuration when it finds them. The default is to only report them.
+//
+func (b *HealerBuilder) CacheAutoCorrect(flag bool) *HealerBuilder {
+	b.cacheAutoCorrect = flag
+	return b
+}
+
+// WatchCRDs sets whether the healer will also load the healing rules from the HealingRule objects
+// of the Kubernetes API, and update them when those objects change. The rules of the configuration
+// take precedence over the ones from the API with the same name. The default is to not watch them.
+//
+func (b *HealerBuilder) WatchCRDs(flag bool) *HealerBuilder {
+	b.watchCRDs = flag
+	return b
+}
+
+// CRDNamespace sets the namespace where the healing rules of the Kubernetes API are watched. The
+// default is to watch all the namespaces.
+//
+func (b *HealerBuilder) CRDNamespace(namespace string) *HealerBuilder {
+	b.crdNamespace = namespace
+	return b
+}
+
+// HealingRulesClient sets the client that will be used to list and watch the healing rules of the
+// Kubernetes API. It is mandatory when watching them.
+//
+func (b *HealerBuilder) HealingRulesClient(client HealingRulesClient) *HealerBuilder {
+	b.crdClient = client
+	return b
+}
+
+// BatchCaptureOutput sets whether the output of the batch jobs will be saved in config maps when
+// they finish. The default is to not save it.
+//
+func (b *HealerBuilder) BatchCaptureOutput(flag bool) *HealerBuilder {
+	b.batchCaptureOutput = flag
+	return b
+}
+
+// ShutdownGracePeriod sets how long the healer will wait, when it is stopped, for the requests that
+// are in flight to finish and for the alerts already received to be processed. The default is
+// thirty seconds.
+//
+func (b *HealerBuilder) ShutdownGracePeriod(period time.Duration) *HealerBuilder {
+	b.shutdownGracePeriod = period
+	return b
+}
+
+// StripLabels sets the names of the labels and annotations that will be removed from the alerts
+// before checking if they match the rules. The alerts themselves aren't modified, so the removed
+// labels are still available to the actions, the logs and the history. The default is to remove
+// the 'receiver' and 'alertstate' labels, which are added by the alert manager for routing.
+//
+func (b *HealerBuilder) StripLabels(labels []string) *HealerBuilder {
+	b.stripLabels = labels
+	return b
+}
+
+// DrainTimeout sets how long the healer will wait, when it is stopped and after processing the
+// alerts already received, for the AWX and batch jobs that it started and that are still running to
+// finish, so that their results are reported. A zero value means that the healer doesn't wait. The
+// default is five minutes.
+//
+func (b *HealerBuilder) DrainTimeout(timeout time.Duration) *HealerBuilder {
+	b.drainTimeout = timeout
+	return b
+}
+
+// TrimLabelValues sets whether the leading and trailing white space of the values of the labels and
+// annotations will be removed before checking if the alerts match the rules. Like the stripped
+// labels, this only affects the matching, the alerts passed to the actions aren't modified. The
+// default is to keep the values as they are.
+//
+func (b *HealerBuilder) TrimLabelValues(flag bool) *HealerBuilder {
+	b.trimLabelValues = flag
+	return b
+}
+
+// ListenAddress sets the address where the web server will listen, in the 'host:port' form
+// accepted by the Go net package. The default is ':9099', all the interfaces and port 9099.
+//
+func (b *HealerBuilder) ListenAddress(addr string) *HealerBuilder {
+	b.listenAddress = addr
+	return b
+}
+
+// ReceiverPath sets the path where the web server will receive the alerts sent by the alert
+// manager, for example when the webhook configuration of the alert manager expects a specific
+// path. It can't be the path of any of the other endpoints. The default is '/alerts'.
+//
+func (b *HealerBuilder) ReceiverPath(path string) *HealerBuilder {
+	b.receiverPath = path
+	return b
+}
+
+// TLSCertFile sets the file containing the TLS certificate that the web server will use. When this
+// and the key file are set the web server uses HTTPS instead of HTTP. When the value is 'auto' a
+// self-signed certificate and its key are generated in a temporary directory, and the key file
+// shouldn't be set.
+//
+func (b *HealerBuilder) TLSCertFile(file string) *HealerBuilder {
+	b.tlsCertFile = file
+	return b
+}
+
+// TLSKeyFile sets the file containing the TLS private key that the web server will use.
+//
+func (b *HealerBuilder) TLSKeyFile(file string) *HealerBuilder {
+	b.tlsKeyFile = file
+	return b
+}
+
+// DisableHTTP2 sets whether the web server will only accept HTTP/1.1 connections. By default, when
+// TLS is used, HTTP/2 connections are also accepted. HTTP/2 is never used without TLS.
+//
+func (b *HealerBuilder) DisableHTTP2(flag bool) *HealerBuilder {
+	b.disableHTTP2 = flag
+	return b
+}
+
+// AlertSourceHeader sets the HTTP header that contains the identifier of the alert manager that
+// sent the alerts, used in the logs and in the metrics. If the header contains a list of values,
+// like X-Forwarded-For, the first one is used. Requests without the header are identified by their
+// remote address. The default is X-Forwarded-For.
+//
+func (b *HealerBuilder) AlertSourceHeader(header string) *HealerBuilder {
+	b.alertSourceHeader = header
+	return b
+}
+
+// AlertsToken sets the bearer token that the alert manager needs to send in the Authorization
+// header of its requests. Requests without it are rejected. The default is to accept all the
+// requests.
+//
+func (b *HealerBuilder) AlertsToken(token string) *HealerBuilder {
+	b.alertsToken = token
+	return b
+}
+
+// AdminToken sets the bearer token that needs to be sent in the Authorization header of the
+// requests to the endpoints that inspect or change the state of the healer, like /rules and
+// /memory. When it isn't set those endpoints require the alerts token instead, if it is set.
+//
+func (b *HealerBuilder) AdminToken(token string) *HealerBuilder {
+	b.adminToken = token
+	return b
+}
+
+// AlertsRateLimit sets the maximum number of requests per second accepted from the alert manager.
+// Requests that exceed it are rejected, so that the alert manager retries them later. The default
+// is zero, which means that there is no limit.
+//
+func (b *HealerBuilder) AlertsRateLimit(rps float64) *HealerBuilder {
+	b.alertsRateLimit = rps
+	return b
+}
+
+// MaxRequestBody sets the maximum size, in bytes, of the bodies of the requests sent by the alert
+// manager. Larger requests are rejected with status 413 without reading them completely, so that a
+// misbehaving client can't exhaust the memory of the service. The default is one megabyte.
+//
+func (b *HealerBuilder) MaxRequestBody(size int64) *HealerBuilder {
+	b.maxRequestBody = size
+	return b
+}
+
+// LogJSONIndent sets the number of spaces used to indent the bodies of the requests received from
+// the alert manager when they are written to the log. Zero means that the bodies are written
+// without changes, which is faster. The default is two.
+//
+func (b *HealerBuilder) LogJSONIndent(spaces int) *HealerBuilder {
+	b.logJSONIndent = spaces
+	return b
+}
+
+// DryRun enables or disables the dry run mode. In this mode the actions triggered by the alerts
+// are written to the log, after processing the templates, but they aren't executed. The default
+// is false.
+//
+func (b *HealerBuilder) DryRun(flag bool) *HealerBuilder {
+	b.dryRun = flag
+	return b
+}
+
+// AuditConfigMap sets the name of the config map where the healer records the actions that it
+// executes, so that they can be audited after restarts. This requires a Kubernetes client. The
+// default is empty, which means that the actions aren't recorded.
+//
+func (b *HealerBuilder) AuditConfigMap(name string) *HealerBuilder {
+	b.auditConfigMap = name
+	return b
+}
+
+// AuditNamespace sets the namespace of the config map where the actions are recorded. The default
+// is 'default'.
+//
+func (b *HealerBuilder) AuditNamespace(namespace string) *HealerBuilder {
+	b.auditNamespace = namespace
+	return b
+}
+
+// AuditFlushInterval sets how often the recorded actions are written to the config map. The default
+// is thirty seconds.
+//
+func (b *HealerBuilder) AuditFlushInterval(interval time.Duration) *HealerBuilder {
+	b.auditFlushInterval = interval
+	return b
+}
+
+// AuditMaxEntries sets the maximum number of actions kept in the config map. When it is exceeded
+// the oldest ones are discarded. The default is 1000.
+//
+func (b *HealerBuilder) AuditMaxEntries(max int) *HealerBuilder {
+	b.auditMaxEntries = max
+	return b
+}
+
+// RetryJitterFactor sets the maximum fraction of the delay before processing alerts that is added
+// randomly, so that alerts that are retried at the same time are spread. It must be between zero
+// and one, and the default is 0.2.
+//
+func (b *HealerBuilder) RetryJitterFactor(factor float64) *HealerBuilder {
+	b.retryJitterFactor = factor
+	return b
+}
+
+// MaxRulesPerReload sets the maximum number of rules that will be loaded in each step of a reload
+// of the rules cache. The steps are separated by yields of the processor, so that reloading a large
+// number of rules doesn't cause a spike in memory usage. The default is zero, which means that all
+// the rules are loaded in one step.
+//
+func (b *HealerBuilder) MaxRulesPerReload(max int) *HealerBuilder {
+	b.maxRulesPerReload = max
+	return b
+}
+
+// AutoRegisterService sets whether the healer will create a Kubernetes service that points to its
+// web server when it starts, and delete it when it stops, so that the alert manager can find it
+// using DNS. This requires a Kubernetes client. The default is to not create the service.
+//
+func (b *HealerBuilder) AutoRegisterService(flag bool) *HealerBuilder {
+	b.autoRegisterService = flag
+	return b
+}
+
+// ServiceName sets the name of the service created when AutoRegisterService is enabled. The default
+// is 'autoheal'.
+//
+func (b *HealerBuilder) ServiceName(name string) *HealerBuilder {
+	b.serviceName = name
+	return b
+}
+
+// ServiceNamespace sets the namespace where the service is created when AutoRegisterService is
+// enabled. It should be the namespace where the healer is running. The default is 'default'.
+//
+func (b *HealerBuilder) ServiceNamespace(namespace string) *HealerBuilder {
+	b.serviceNamespace = namespace
+	return b
+}
+
+// PodName sets the name of the pod where the healer is running. It is recorded in the service
+// created when AutoRegisterService is enabled, so that when several pods run at the same time,
+// for example during a rolling update, only the one that registered the service last deletes it.
+// The default is the host name, which is the name of the pod.
+//
+func (b *HealerBuilder) PodName(name string) *HealerBuilder {
+	b.podName = name
+	return b
+}
+
+// ServiceSelector sets the labels of the pods that the service created when AutoRegisterService is
+// enabled points to. The default is 'app=autoheal'.
+//
+func (b *HealerBuilder) ServiceSelector(selector map[string]string) *HealerBuilder {
+	b.serviceSelector = selector
+	return b
+}
+
 // Build creates the healer using the configuration stored in the builder.
 //
 func (b *HealerBuilder) Build() (h *Healer, err error) {
 	var cfg *config.Config
 
 	// Create new config and load the configuration files:
-	if len(b.configFiles) == 0 {
+	if len(b.configFiles) == 0 && len(b.configMaps) == 0 {
 		err = fmt.Errorf("No configuration file has been provided")
 		return
 	}
-	cfg, err = config.NewBuilder().
+	_, err = alertmanager.ParseMessageVersion(string(b.alertmanagerVersion))
+	if err != nil {
+		return
+	}
+	if b.shutdownGracePeriod < 0 {
+		err = fmt.Errorf("Shutdown grace period %s isn't valid, it can't be negative", b.shutdownGracePeriod)
+		return
+	}
+	if b.drainTimeout < 0 {
+		err = fmt.Errorf("Drain timeout %s isn't valid, it can't be negative", b.drainTimeout)
+		return
+	}
+	if b.retryJitterFactor < 0 || b.retryJitterFactor > 1 {
+		err = fmt.Errorf("Retry jitter factor %g isn't valid, it must be between 0 and 1", b.retryJitterFactor)
+		return
+	}
+	if b.cacheCheckInterval < 0 {
+		err = fmt.Errorf("Cache check interval %s isn't valid, it can't be negative", b.cacheCheckInterval)
+		return
+	}
+	_, listenPort, err := net.SplitHostPort(b.listenAddress)
+	if err != nil {
+		err = fmt.Errorf("Listen address '%s' isn't valid: %s", b.listenAddress, err)
+		return
+	}
+	port, err := net.LookupPort("tcp", listenPort)
+	if err != nil {
+		err = fmt.Errorf("Listen address '%s' isn't valid: %s", b.listenAddress, err)
+		return
+	}
+	if !strings.HasPrefix(b.receiverPath, "/") {
+		err = fmt.Errorf("Receiver path '%s' isn't valid, it must start with a slash", b.receiverPath)
+		return
+	}
+	for _, reserved := range reservedPaths {
+		if b.receiverPath == reserved {
+			err = fmt.Errorf("Receiver path '%s' isn't valid, it is used by another endpoint", b.receiverPath)
+			return
+		}
+	}
+	if b.watchCRDs && b.crdClient == nil {
+		err = fmt.Errorf("A healing rules client is required to watch the healing rules")
+		return
+	}
+	if b.tlsCertFile == AutoTLSCertFile {
+		if b.tlsKeyFile != "" {
+			err = fmt.Errorf("The TLS key file can't be given when the certificate is generated")
+			return
+		}
+	} else if (b.tlsCertFile == "") != (b.tlsKeyFile == "") {
+		err = fmt.Errorf("The TLS certificate and key files must be given together")
+		return
+	}
+	if b.maxRulesPerReload < 0 {
+		err = fmt.Errorf("Maximum rules per reload %d isn't valid, it can't be negative", b.maxRulesPerReload)
+		return
+	}
+	if b.logJSONIndent < 0 {
+		err = fmt.Errorf("Log JSON indent %d isn't valid, it can't be negative", b.logJSONIndent)
+		return
+	}
+	if b.alertsRateLimit < 0 {
+		err = fmt.Errorf("Alerts rate limit %g isn't valid, it can't be negative", b.alertsRateLimit)
+		return
+	}
+	if b.maxRequestBody <= 0 {
+		err = fmt.Errorf("Maximum request body size %d isn't valid, it must be positive", b.maxRequestBody)
+		return
+	}
+	if b.autoRegisterService {
+		if b.k8sClient == nil {
+			err = fmt.Errorf("A Kubernetes client is required to register the service")
+			return
+		}
+		if b.serviceName == "" || b.serviceNamespace == "" {
+			err = fmt.Errorf("The name and namespace of the service are required to register it")
+			return
+		}
+		if b.podName == "" {
+			err = fmt.Errorf("The name of the pod is required to register the service")
+			return
+		}
+
+		// The registered service points directly to the web server, bypassing any proxy that
+		// may be in front of it, so the alerts token is the only protection:
+		if b.alertsToken == "" {
+			err = fmt.Errorf("An alerts token is required to register the service")
+			return
+		}
+	}
+	if b.auditConfigMap != "" && b.k8sClient == nil {
+		err = fmt.Errorf("A Kubernetes client is required to record the actions in a config map")
+		return
+	}
+
+	cfgBuilder := config.NewBuilder().
 		Client(b.k8sClient).
-		Files(b.configFiles).
-		Build()
+		Files(b.configFiles)
+	for _, configMap := range b.configMaps {
+		cfgBuilder.ConfigMap(configMap.Namespace, configMap.Name)
+	}
+	cfg, err = cfgBuilder.Build()
 	if err != nil {
 		return
 	}
 
+	// From now on any error needs to shut down the configuration, as otherwise the watches of the
+	// configuration files would be leaked:
+	defer func() {
+		if err != nil {
+			h = nil
+			cfg.ShutDown()
+		}
+	}()
+
 	// Send to the log a summary of the configuration:
-	glog.Infof("AWX user is '%s'", cfg.AWX().User())
+	if cfg.AWX().Token() != "" {
+		glog.Infof("AWX authentication uses a token")
+	} else {
+		glog.Infof("AWX user is '%s'", cfg.AWX().User())
+	}
 	glog.Infof("AWX project is '%s'", cfg.AWX().Project())
 
 	// Create the actions memory:
@@ -140,21 +890,186 @@ func (b *HealerBuilder) Build() (h *Healer, err error) {
 		return
 	}
 
+	// Create the history of processed alerts:
+	history, err := receiver.NewHistoryBuilder().
+		Size(b.historySize).
+		Build()
+	if err != nil {
+		return
+	}
+
+	// Create the recorder of the audit log:
+	var auditRecorder *auditlog.Recorder
+	if b.auditConfigMap != "" {
+		auditRecorder, err = auditlog.NewRecorderBuilder().
+			KubernetesClient(b.k8sClient).
+			Namespace(b.auditNamespace).
+			Name(b.auditConfigMap).
+			FlushInterval(b.auditFlushInterval).
+			MaxEntries(b.auditMaxEntries).
+			Build()
+		if err != nil {
+			return
+		}
+	}
+
+	// Generate the self-signed certificate, if requested:
+	tlsCertFile := b.tlsCertFile
+	tlsKeyFile := b.tlsKeyFile
+	if tlsCertFile == AutoTLSCertFile {
+		tlsCertFile, tlsKeyFile, err = generateCertificate(
+			certificateHosts(b.serviceName, b.serviceNamespace),
+		)
+		if err != nil {
+			err = fmt.Errorf("Can't generate TLS certificate: %s", err)
+			return
+		}
+	}
+
 	// Allocate the healer:
 	h = new(Healer)
 	h.k8sClient = b.k8sClient
 	h.config = cfg
 	h.actionMemory = actionMemory
+	h.ruleMemories = new(syncmap.Map)
+	h.ruleMatches = new(syncmap.Map)
+	h.history = history
+	h.validateAWXTemplates = b.validateAWXTemplates
+	h.alertmanagerVersion = b.alertmanagerVersion
+	h.cacheCheckInterval = b.cacheCheckInterval
+	h.cacheAutoCorrect = b.cacheAutoCorrect
+	if b.watchCRDs {
+		h.crdClient = b.crdClient
+		h.crdNamespace = b.crdNamespace
+	}
+	h.crdRules = new(syncmap.Map)
+	h.shutdownGracePeriod = b.shutdownGracePeriod
+	h.drainTimeout = b.drainTimeout
+	h.maxRulesPerReload = b.maxRulesPerReload
+	h.trimLabelValues = b.trimLabelValues
+	h.listenAddress = b.listenAddress
+	h.listenPort = port
+	h.receiverPath = b.receiverPath
+	h.tlsCertFile = tlsCertFile
+	h.tlsKeyFile = tlsKeyFile
+	h.disableHTTP2 = b.disableHTTP2
+	h.alertSourceHeader = b.alertSourceHeader
+	h.alertsToken = b.alertsToken
+	h.adminToken = b.adminToken
+	h.alertsRateLimit = b.alertsRateLimit
+	h.maxRequestBody = b.maxRequestBody
+	h.logJSONIndent = b.logJSONIndent
+	h.dryRun = b.dryRun
+	h.auditRecorder = auditRecorder
+	h.autoRegisterService = b.autoRegisterService
+	h.serviceName = b.serviceName
+	h.serviceNamespace = b.serviceNamespace
+	h.serviceSelector = b.serviceSelector
+	h.podName = b.podName
+	h.reloadMutex = &sync.Mutex{}
+	h.stripLabels = make(map[string]bool, len(b.stripLabels))
+	for _, label := range b.stripLabels {
+		h.stripLabels[label] = true
+	}
 
 	// Initialize the map of rules:
 	h.rulesCache = new(syncmap.Map)
+	h.patternsCache = new(syncmap.Map)
+
+	// Initialize the map of healing contexts:
+	h.healingContexts = new(syncmap.Map)
+	h.healingContextsMutex = &sync.Mutex{}
+
+	// Create the set of namespaces that the alerts can refer to:
+	h.namespaceScopeMutex = &sync.RWMutex{}
+	scopeLabels := cfg.ScopeToNamespaceLabels()
+	if len(scopeLabels) > 0 {
+		if b.k8sClient == nil {
+			err = fmt.Errorf(
+				"Namespace labels are used to scope alerts, but there is no connection to " +
+					"the Kubernetes API",
+			)
+			return
+		}
+		h.namespaceScope = newNamespaceScope(b.k8sClient, scopeLabels)
+	}
 
 	// Create the queues:
 	h.rulesQueue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "rules")
-	h.alertsQueue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "alerts")
+	h.alertsQueue = workqueue.NewNamedRateLimitingQueue(
+		newJitterRateLimiter(
+			workqueue.DefaultControllerRateLimiter(),
+			b.retryJitterFactor,
+			time.Now().UnixNano(),
+		),
+		"alerts",
+	)
 
 	// allocate new action runners
-	h.actionRunners = make(map[ActionRunnerType]ActionRunner)
+	h.actionRunners = make(map[ActionRunnerType]runner.ActionRunner)
+	awxRunner, awxErr := awxrunner.NewBuilder().
+		Config(cfg.AWX()).
+		Servers(cfg.Servers()).
+		TemplateCacheTTL(cfg.AWX().TemplateCacheTTL()).
+		MaxJobAge(cfg.AWX().MaxJobAge()).
+		MaxConcurrentJobs(cfg.AWX().MaxConcurrentJobs()).
+		Build()
+	if awxErr != nil {
+		glog.Warningf("Error building AWX runner: %s", awxErr)
+	} else {
+		h.awxRunner = awxRunner
+		h.actionRunners[ActionRunnerTypeAWX] = awxRunner
+		h.actionRunners[ActionRunnerTypeAWXWorkflow] = awxRunner
+	}
+	batchRunner, batchErr := batchrunner.NewBuilder().
+		KubernetesClient(b.k8sClient).
+		CaptureOutput(b.batchCaptureOutput).
+		Runtime(cfg.Runtime()).
+		Build()
+	if batchErr != nil {
+		glog.Warningf("Error building batch runner: %s", batchErr)
+	} else {
+		h.batchRunner = batchRunner
+		h.actionRunners[ActionRunnerTypeBatch] = batchRunner
+	}
+
+	// Load the action runners provided by plugins:
+	h.pluginRunners = make(map[string]runner.ActionRunner)
+	if b.pluginDir != "" {
+		h.pluginRunners, err = runner.LoadPlugins(b.pluginDir)
+		if err != nil {
+			return
+		}
+	}
+
+	// Check that enough runners have been initialized. The AWX runner is registered for both jobs
+	// and workflow jobs, but it should be counted only once:
+	count := len(h.actionRunners) + len(h.pluginRunners)
+	if _, ok := h.actionRunners[ActionRunnerTypeAWXWorkflow]; ok {
+		count--
+	}
+	if count < b.minimumRunnersRequired {
+		err = fmt.Errorf(
+			"At least %d action runners are required, but only %d could be initialized",
+			b.minimumRunnersRequired,
+			count,
+		)
+		return
+	}
+
+	// Create the webhook and Slack runners, which aren't counted as required runners:
+	h.webhookRunner, err = webhookrunner.NewBuilder().
+		KubernetesClient(b.k8sClient).
+		Build()
+	if err != nil {
+		return
+	}
+	h.slackRunner, err = slackrunner.NewBuilder().
+		KubernetesClient(b.k8sClient).
+		Build()
+	if err != nil {
+		return
+	}
 
 	return
 }
@@ -167,97 +1082,411 @@ func (h *Healer) Run(stopCh <-chan struct{}) error {
 	defer h.alertsQueue.ShutDown()
 	defer h.config.ShutDown()
 
+	// There is no point in running the healer if it can't execute any action:
+	if len(h.actionRunners) == 0 && len(h.pluginRunners) == 0 {
+		return fmt.Errorf("No action runner has been initialized, healing actions can't be executed")
+	}
+
 	// Start the workers:
 	go wait.Until(h.runRulesWorker, time.Second, stopCh)
 	go wait.Until(h.runAlertsWorker, time.Second, stopCh)
 
 	// Start action runners
-	awxRunner, err := awxrunner.NewBuilder().
-		Config(h.config.AWX()).
-		StopCh(stopCh).
-		Build()
-
-	if err != nil {
-		glog.Warningf("Error building AWX runner: %s", err)
+	if h.awxRunner != nil {
+		h.awxRunner.Start(stopCh)
+	}
+	if h.batchRunner != nil {
+		h.batchRunner.Start(stopCh)
 	}
 
-	batchRunner, err := batchrunner.NewBuilder().
-		KubernetesClient(h.k8sClient).
-		Build()
-
-	if err != nil {
-		glog.Warningf("Error building batch runner: %s", err)
+	// Start writing the audit log:
+	if h.auditRecorder != nil {
+		h.auditRecorder.Start(stopCh)
 	}
 
-	// initiailize runners.
-	h.actionRunners[ActionRunnerTypeAWX] = awxRunner
-	h.actionRunners[ActionRunnerTypeBatch] = batchRunner
+	// Start watching the namespaces that alerts can refer to:
+	if h.namespaceScope != nil {
+		go h.namespaceScope.run(stopCh)
+	}
 
 	glog.Info("Workers started")
 
 	// Reload the rules cache.
-	h.reloadRulesCache()
+	h.reloadAllRules()
+	if h.validateAWXTemplates && h.awxRunner != nil {
+		h.checkAWXTemplates(h.awxRunner)
+	}
 
-	// Add a listener that will reload the rules cache
-	// on config object change.
-	h.config.AddChangeListener(func(_ *config.ChangeEvent) {
-		h.reloadRulesCache()
+	// Add a listener that will reload the rules cache when the rules in the configuration change:
+	h.config.AddChangeListener(func(event *config.ChangeEvent) {
+		glog.Infof(
+			"Configuration changed, %d rules added, %d removed and %d modified",
+			len(event.AddedRules),
+			len(event.RemovedRules),
+			len(event.ModifiedRules),
+		)
+		if event.RulesChanged() {
+			h.reloadAllRules()
+		}
+		if event.ScopeChanged {
+			h.updateNamespaceScope(stopCh)
+		}
+		if h.awxRunner != nil {
+			h.awxRunner.InvalidateTemplateCache()
+			if event.AWXChanged {
+				h.awxRunner.CloseIdleConnections()
+			}
+		}
+		if h.validateAWXTemplates && h.awxRunner != nil {
+			h.checkAWXTemplates(h.awxRunner)
+		}
 	})
 
-	// Start the web server:
-	http.Handle("/metrics", metrics.Handler())
-	http.HandleFunc("/alerts", h.handleRequest)
-
-	server := &http.Server{Addr: ":9099"}
-	go server.ListenAndServe()
-	glog.Info("Web server started")
+	// Start watching the healing rules of the Kubernetes API:
+	if h.crdClient != nil {
+		go h.runCRDWatcher(stopCh)
+	}
 
-	// Wait till we are requested to stop:
-	<-stopCh
+	// Start the worker that checks the consistency of the rules cache:
+	if h.cacheCheckInterval > 0 {
+		go h.runCacheConsistencyWorker(stopCh)
+	}
 
-	// Shutdown the web server:
-	err = server.Shutdown(context.TODO())
+	// Start the web server. The listener is created here, instead of inside the goroutine, so
+	// that errors like an address that is already in use are reported:
+	server := &http.Server{
+		Addr:    h.listenAddress,
+		Handler: h.serverHandler(),
+	}
+	err := h.configureServer(server)
+	if err != nil {
+		return err
+	}
+	err = h.loadCertificate(server)
 	if err != nil {
 		return err
 	}
+	listener, err := net.Listen("tcp", h.listenAddress)
+	if err != nil {
+		return err
+	}
+	serveErrors := make(chan error, 1)
+	go func() {
+		if h.tlsCertFile != "" {
+			// The certificate is already loaded in the TLS configuration of the server:
+			serveErrors <- server.ServeTLS(listener, "", "")
+		} else {
+			serveErrors <- server.Serve(listener)
+		}
+	}()
+	glog.Infof("Web server started, listening on '%s'", listener.Addr())
+
+	// Register the service that points to the web server:
+	if h.autoRegisterService {
+		err = h.registerService()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Wait till we are requested to stop, or till the web server fails:
+	var serveErr error
+	select {
+	case <-stopCh:
+	case serveErr = <-serveErrors:
+		glog.Errorf("Web server failed: %s", serveErr)
+	}
 
+	// Delete the service first, so that the alert manager stops sending alerts:
+	if h.autoRegisterService {
+		err = h.unregisterService()
+		if err != nil {
+			glog.Warningf("Can't delete service '%s': %s", h.serviceName, err)
+		}
+	}
+
+	// Shutdown the web server and process the alerts already received:
+	err = h.shutdown(server)
+
+	// Wait for the jobs that are still running, even if the shutdown failed, so that their results
+	// are reported:
+	drainErr := h.drainActiveJobs()
+	if serveErr != nil {
+		return serveErr
+	}
+	if err == nil {
+		err = drainErr
+	}
+	return err
+}
+
+// reservedPaths are the paths that can't be used to receive the alerts: the paths of the other
+// endpoints of the web server, and the root path, as it would receive the requests for any path.
+//
+var reservedPaths = []string{
+	"/",
+	"/metrics",
+	"/history",
+	"/debug/rules",
+	"/test",
+	"/memory",
+	"/rules",
+	"/healthz",
+	"/readyz",
+}
+
+// serverHandler creates the handler of the web server, routing the requests to the handlers of
+// the different endpoints.
+//
+func (h *Healer) serverHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle(h.receiverPath, h.alertsHandler())
+	mux.Handle("/history", h.historyHandler())
+	mux.Handle("/debug/rules", h.debugRulesHandler())
+	mux.Handle("/test", h.testHandler())
+	mux.Handle("/memory", h.memoryHandler())
+	mux.Handle("/rules", h.rulesHandler())
+	mux.Handle("/rules/", h.rulesHandler())
+	mux.HandleFunc("/healthz", h.handleHealthzRequest)
+	mux.HandleFunc("/readyz", h.handleReadyzRequest)
+	return mux
+}
+
+// alertsHandler creates the handler for the requests sent by the alert manager, wrapping the
+// function that processes the alerts with the middlewares that log the requests, update the
+// metrics, check the token and limit the rate.
+//
+func (h *Healer) alertsHandler() http.Handler {
+	return receiver.NewMiddlewareChain(
+		receiver.LoggingMiddleware,
+		receiver.MetricsMiddleware,
+		receiver.AuthMiddleware(h.alertsToken),
+		receiver.RateLimitMiddleware(h.alertsRateLimit),
+	).Then(http.HandlerFunc(h.handleRequest))
+}
+
+// configureServer enables or disables HTTP/2 in the given web server. HTTP/2 is only enabled when
+// the server uses TLS, as clients don't use it otherwise.
+//
+func (h *Healer) configureServer(server *http.Server) error {
+	if h.tlsCertFile == "" {
+		return nil
+	}
+	if h.disableHTTP2 {
+		// A non nil empty map prevents the server from enabling HTTP/2 automatically:
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		glog.Info("HTTP/2 is disabled")
+		return nil
+	}
+	return http2.ConfigureServer(server, nil)
+}
+
+// loadCertificate loads the TLS certificate and key of the web server, so that problems like
+// missing or invalid files are reported before the server starts, instead of silently failing
+// inside the goroutine that serves the requests.
+//
+func (h *Healer) loadCertificate(server *http.Server) error {
+	if h.tlsCertFile == "" {
+		return nil
+	}
+	certificate, err := tls.LoadX509KeyPair(h.tlsCertFile, h.tlsKeyFile)
+	if err != nil {
+		return fmt.Errorf(
+			"Can't load TLS certificate file '%s' and key file '%s': %s",
+			h.tlsCertFile, h.tlsKeyFile, err,
+		)
+	}
+	if server.TLSConfig == nil {
+		server.TLSConfig = new(tls.Config)
+	}
+	server.TLSConfig.Certificates = []tls.Certificate{certificate}
 	return nil
 }
 
-// Reload all rules in rules cache (by sending "Deleted" + "Added" to queue).
+// shutdown stops the web server, waiting for the requests that are in flight to finish, and then
+// waits till the alerts that have already been received are processed. The total time waiting is
+// limited by the shutdown grace period.
 //
-func (h *Healer) reloadRulesCache() {
-	// Send Delete signal to all rules currently in rules cache:
-	h.rulesCache.Range(func(key, value interface{}) bool {
-		rule := value.(*autoheal.HealingRule)
-		change := &RuleChange{
-			Type: watch.Deleted,
-			Rule: rule,
+func (h *Healer) shutdown(server *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.shutdownGracePeriod)
+	defer cancel()
+
+	// Stop the web server:
+	err := server.Shutdown(ctx)
+	if err != nil {
+		glog.Warningf("Web server didn't shut down cleanly: %s", err)
+	} else {
+		glog.Info("Web server stopped")
+	}
+
+	// Wait for the pending alerts, even if the web server didn't shut down cleanly, as otherwise
+	// they would be lost:
+	h.drainAlerts(ctx)
+
+	return err
+}
+
+// drainAlerts waits till all the alerts that have been received have been processed, or till the
+// given context is done.
+//
+func (h *Healer) drainAlerts(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		pending := atomic.LoadInt64(&h.pendingAlerts)
+		if pending <= 0 {
+			glog.Info("All received alerts have been processed")
+			return
 		}
-		h.rulesQueue.Add(change)
+		select {
+		case <-ctx.Done():
+			glog.Warningf("Shutting down with %d alerts that haven't been processed", pending)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainActiveJobs waits till the AWX and batch jobs that are still running finish, or till the
+// drain timeout expires. The runners keep checking the status of the jobs while waiting, and
+// an error is returned if some of them are still running when the timeout expires.
+//
+func (h *Healer) drainActiveJobs() error {
+	if h.drainTimeout == 0 {
+		return nil
+	}
+	deadline := time.Now().Add(h.drainTimeout)
+	if h.awxRunner != nil {
+		err := h.awxRunner.WaitForActiveJobs(h.drainTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	if h.batchRunner != nil {
+		err := h.batchRunner.WaitForActiveJobs(time.Until(deadline))
+		if err != nil {
+			return err
+		}
+	}
+	glog.Info("All active jobs have finished")
+	return nil
+}
+
+// reloadAllRules reloads the rules cache, calling reloadRulesCache till all the rules have been
+// loaded. The processor is yielded between the calls, so that the rules worker can process the
+// changes already added to the queue.
+//
+func (h *Healer) reloadAllRules() {
+	h.reloadMutex.Lock()
+	defer h.reloadMutex.Unlock()
+	for !h.reloadRulesCache() {
+		goruntime.Gosched()
+	}
+}
+
+// Reload all rules in rules cache (by sending "Deleted" + "Added" to queue). When the maximum number
+// of rules per reload is set only that number of rules is loaded, and the next call continues from
+// that point. It returns true when all the rules have been loaded.
+//
+func (h *Healer) reloadRulesCache() (done bool) {
+	var err error
+
+	// Measure how long the reload takes, and warn if it is too slow, as it blocks the processing
+	// of other configuration changes:
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		metrics.RulesReloaded(elapsed, err)
+		if elapsed > time.Second {
+			glog.Warningf("Reloading the healing rules took %s", elapsed)
+		}
+	}()
 
+	// Changes added to the queue after it has been shut down would be silently discarded:
+	if h.rulesQueue.ShuttingDown() {
+		err = fmt.Errorf("Can't reload healing rules because the rules queue is shutting down")
+		glog.Errorf("%s", err)
+		h.reloadCursor = 0
 		return true
-	})
+	}
 
-	// For each rule inside the configuration create a change and add it to the queue:
-	rules := h.config.Rules()
-	if len(rules) > 0 {
-		for _, rule := range rules {
+	// Send Delete signal to all rules currently in rules cache, but only at the beginning of the
+	// reload, as otherwise the rules added by the previous calls would be deleted:
+	if h.reloadCursor == 0 {
+		h.rulesCache.Range(func(key, value interface{}) bool {
+			rule := value.(*autoheal.HealingRule)
 			change := &RuleChange{
-				Type: watch.Added,
+				Type: watch.Deleted,
 				Rule: rule,
 			}
 			h.rulesQueue.Add(change)
-		}
-		glog.Infof("Loaded %d healing rules from the configuration", len(rules))
-	} else {
+
+			return true
+		})
+	}
+
+	// For each rule inside the configuration, starting where the previous call stopped, create a
+	// change and add it to the queue:
+	rules := h.config.Rules()
+	if len(rules) == 0 {
 		glog.Warningf("There are no healing rules in the configuration")
+		h.queueCRDRules()
+		h.reloadCursor = 0
+		atomic.StoreInt32(&h.ready, 1)
+		return true
+	}
+	first := h.reloadCursor
+	if first > len(rules) {
+		first = len(rules)
+	}
+	last := len(rules)
+	if h.maxRulesPerReload > 0 && first+h.maxRulesPerReload < last {
+		last = first + h.maxRulesPerReload
+	}
+	for _, rule := range rules[first:last] {
+		change := &RuleChange{
+			Type: watch.Added,
+			Rule: rule,
+		}
+		h.rulesQueue.Add(change)
+	}
+	if last < len(rules) {
+		h.reloadCursor = last
+		glog.Infof(
+			"Loaded %d of %d healing rules from the configuration (%d%%)",
+			last, len(rules), last*100/len(rules),
+		)
+		return false
 	}
+	h.queueCRDRules()
+	h.reloadCursor = 0
+	atomic.StoreInt32(&h.ready, 1)
+	glog.Infof("Loaded %d healing rules from the configuration", len(rules))
+	return true
 }
 
-func (h *Healer) handleRequest(response http.ResponseWriter, request *http.Request) {
-	// Read the request body:
-	body, err := ioutil.ReadAll(request.Body)
+// checkAWXTemplates checks that the AWX job templates used by the rules of the configuration exist,
+// and reports the missing ones as warnings.
+//
+func (h *Healer) checkAWXTemplates(runner *awxrunner.Runner) {
+	errs := runner.ValidateTemplates(h.config.Rules())
+	for _, err := range errs {
+		glog.Warningf("%s", err)
+	}
+	if len(errs) == 0 {
+		glog.Infof("All the AWX job templates used by the healing rules exist")
+	}
+}
+
+// readRequestBody reads the body of the given request, limited to the maximum request body size.
+// If the body can't be read, or if it exceeds the limit, it sends the corresponding error response
+// and returns false.
+//
+func (h *Healer) readRequestBody(response http.ResponseWriter, request *http.Request) ([]byte, bool) {
+	// Read the request body, one byte more than the limit, so that we can tell if it has been
+	// exceeded:
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, h.maxRequestBody+1))
 	if err != nil {
 		glog.Warningf("Can't read request body: %s", err)
 		http.Error(
@@ -265,17 +1494,39 @@ func (h *Healer) handleRequest(response http.ResponseWriter, request *http.Reque
 			http.StatusText(http.StatusBadRequest),
 			http.StatusBadRequest,
 		)
+		return nil, false
+	}
+	if int64(len(body)) > h.maxRequestBody {
+		glog.Warningf(
+			"Request body from '%s' for path '%s' exceeds the maximum size of %d bytes",
+			h.alertSource(request),
+			request.URL.Path,
+			h.maxRequestBody,
+		)
+		http.Error(
+			response,
+			http.StatusText(http.StatusRequestEntityTooLarge),
+			http.StatusRequestEntityTooLarge,
+		)
+		return nil, false
+	}
+	return body, true
+}
+
+func (h *Healer) handleRequest(response http.ResponseWriter, request *http.Request) {
+	// Read the request body:
+	body, ok := h.readRequestBody(response, request)
+	if !ok {
 		return
 	}
 
 	// Dump the request to the log:
 	if glog.V(2) {
-		glog.Infof("Request body:\n%s", h.indent(body))
+		glog.Infof("Request body:\n%s", receiver.Indent(body, h.logJSONIndent))
 	}
 
 	// Parse the JSON request body:
-	message := new(alertmanager.Message)
-	json.Unmarshal(body, message)
+	message, err := alertmanager.ParseMessage(body, h.alertmanagerVersion)
 	if err != nil {
 		glog.Warningf("Can't parse request body: %s", err)
 		http.Error(
@@ -286,21 +1537,119 @@ func (h *Healer) handleRequest(response http.ResponseWriter, request *http.Reque
 		return
 	}
 
+	// Remember which alert manager sent the alerts:
+	source := h.alertSource(request)
+	for _, alert := range message.Alerts {
+		if alert != nil {
+			alert.SetSource(source)
+			metrics.AlertReceived(source)
+		}
+	}
+
 	// Handle the parsed message:
 	h.handleMessage(message)
 }
 
-func (h *Healer) handleMessage(message *alertmanager.Message) {
-	for _, alert := range message.Alerts {
-		h.alertsQueue.AddRateLimited(alert)
+// alertSource returns the identifier of the alert manager that sent the given request, taken from
+// the configured header. When the header contains a list of values, like X-Forwarded-For, the first
+// one is used, as it is the original client. Without the header the remote address is used.
+//
+func (h *Healer) alertSource(request *http.Request) string {
+	if h.alertSourceHeader != "" {
+		value := request.Header.Get(h.alertSourceHeader)
+		if comma := strings.Index(value, ","); comma >= 0 {
+			value = value[:comma]
+		}
+		value = strings.TrimSpace(value)
+		if value != "" {
+			return value
+		}
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
 	}
+	return host
 }
 
-func (h *Healer) indent(data []byte) []byte {
-	buffer := new(bytes.Buffer)
-	err := json.Indent(buffer, data, "", "  ")
+// historyHandler creates the handler for the /history endpoint. It requires the admin token, as the
+// history contains the labels of the alerts and the results of their actions.
+//
+func (h *Healer) historyHandler() http.Handler {
+	return receiver.NewMiddlewareChain(
+		receiver.LoggingMiddleware,
+		receiver.AuthMiddleware(h.managementToken()),
+	).Then(http.HandlerFunc(h.handleHistoryRequest))
+}
+
+// handleHistoryRequest returns the last processed alerts, optionally filtered using the `since` and
+// `rule` query parameters.
+//
+func (h *Healer) handleHistoryRequest(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(
+			response,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+
+	// Get the filters from the query parameters:
+	query := request.URL.Query()
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			glog.Warningf("Can't parse history 'since' parameter '%s': %s", value, err)
+			http.Error(
+				response,
+				http.StatusText(http.StatusBadRequest),
+				http.StatusBadRequest,
+			)
+			return
+		}
+	}
+	rule := query.Get("rule")
+
+	// Write the response body:
+	entries := h.history.Filter(since, rule)
+	body, err := json.Marshal(entries)
 	if err != nil {
-		return data
+		glog.Errorf("Can't generate history response body: %s", err)
+		http.Error(
+			response,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(body)
+}
+
+// handleMessage adds the alerts of the given message to the queue. Alerts that appear more than
+// once in the message, with the same status and labels, are added only once, as otherwise the same
+// actions could be executed concurrently before they are remembered. Null alerts are ignored.
+//
+func (h *Healer) handleMessage(message *alertmanager.Message) {
+	seen := make(map[string]bool, len(message.Alerts))
+	for _, alert := range message.Alerts {
+		if alert == nil {
+			glog.Warningf("Message contains a null alert, will ignore it")
+			continue
+		}
+		key := alert.StatusKey()
+		if seen[key] {
+			glog.V(2).Infof(
+				"Alert '%s' is duplicated in the message, will ignore the duplicate",
+				alert.Name(),
+			)
+			continue
+		}
+		seen[key] = true
+		atomic.AddInt64(&h.pendingAlerts, 1)
+		h.alertsQueue.AddRateLimited(alert)
 	}
-	return buffer.Bytes()
 }
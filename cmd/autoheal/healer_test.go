@@ -17,7 +17,18 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -25,8 +36,14 @@ import (
 	"github.com/openshift/autoheal/pkg/alertmanager"
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
 	"github.com/openshift/autoheal/pkg/memory"
+	"github.com/openshift/autoheal/pkg/metrics"
+	"github.com/openshift/autoheal/pkg/testutil"
+	"golang.org/x/net/http2"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
 )
 
 func TestRuleWithExactLabel(t *testing.T) {
@@ -178,6 +195,205 @@ func TestRuleWithTwoMatchingLabels(t *testing.T) {
 	}
 }
 
+func TestRuleWithMatchingNamespace(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	rule := &autoheal.HealingRule{
+		Namespace: "^production-.*$",
+		Labels: map[string]string{
+			"alertname": "PodDown",
+		},
+	}
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "PodDown",
+			"namespace": "production-web",
+		},
+	}
+	matches, err := healer.checkRule(rule, alert)
+	if err != nil {
+		t.Error(err)
+	}
+	if !matches {
+		t.Errorf("Expected alert from namespace 'production-web' to match")
+	}
+}
+
+func TestRuleWithNonMatchingNamespace(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	rule := &autoheal.HealingRule{
+		Namespace: "^production-.*$",
+		Labels: map[string]string{
+			"alertname": "PodDown",
+		},
+	}
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "PodDown",
+			"namespace": "staging-web",
+		},
+	}
+	matches, err := healer.checkRule(rule, alert)
+	if err != nil {
+		t.Error(err)
+	}
+	if matches {
+		t.Errorf("Expected alert from namespace 'staging-web' not to match")
+	}
+}
+
+func TestRuleWithNamespaceDoesntMatchAlertWithoutNamespace(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	rule := &autoheal.HealingRule{
+		Namespace: "^production-.*$",
+	}
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	matches, err := healer.checkRule(rule, alert)
+	if err != nil {
+		t.Error(err)
+	}
+	if matches {
+		t.Errorf("Expected alert without namespace not to match")
+	}
+}
+
+func TestRuleWithoutNamespaceMatchesAnyNamespace(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	rule := &autoheal.HealingRule{}
+	for _, namespace := range []string{"production-web", "staging-web", ""} {
+		alert := &alertmanager.Alert{
+			Labels: map[string]string{
+				"namespace": namespace,
+			},
+		}
+		matches, err := healer.checkRule(rule, alert)
+		if err != nil {
+			t.Error(err)
+		}
+		if !matches {
+			t.Errorf("Expected alert from namespace '%s' to match", namespace)
+		}
+	}
+}
+
+func TestRuleWithInvalidNamespacePattern(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	rule := &autoheal.HealingRule{
+		Namespace: "production-(",
+	}
+	err := healer.checkRulePatterns(rule)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid namespace pattern, but got nil")
+	}
+}
+
+func TestRuleWithSingleSeverity(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+	rule := &autoheal.HealingRule{
+		Severity: []string{"critical"},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	severities := map[string]bool{
+		"critical":    true,
+		"warning":     false,
+		"noncritical": false,
+		"":            false,
+	}
+	for severity, expected := range severities {
+		alert := &alertmanager.Alert{
+			Labels: map[string]string{
+				"alertname": "NodeDown",
+				"severity":  severity,
+			},
+		}
+		matches, err := healer.checkRule(rule, alert)
+		if err != nil {
+			t.Error(err)
+		}
+		if matches != expected {
+			t.Errorf("Expected match %t for severity '%s', but got %t", expected, severity, matches)
+		}
+	}
+
+	// Alerts without the severity label don't match:
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	matches, err := healer.checkRule(rule, alert)
+	if err != nil {
+		t.Error(err)
+	}
+	if matches {
+		t.Errorf("Expected alert without severity to not match")
+	}
+}
+
+func TestRuleWithMultipleSeverities(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+	rule := &autoheal.HealingRule{
+		Severity: []string{"critical", "warning"},
+	}
+	severities := map[string]bool{
+		"critical": true,
+		"warning":  true,
+		"info":     false,
+	}
+	for severity, expected := range severities {
+		alert := &alertmanager.Alert{
+			Labels: map[string]string{
+				"severity": severity,
+			},
+		}
+		matches, err := healer.checkRule(rule, alert)
+		if err != nil {
+			t.Error(err)
+		}
+		if matches != expected {
+			t.Errorf("Expected match %t for severity '%s', but got %t", expected, severity, matches)
+		}
+	}
+}
+
+func TestRuleWithSeverityAndExplicitLabel(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+
+	// The explicit pattern for the severity label takes precedence over the shortcut:
+	rule := &autoheal.HealingRule{
+		Severity: []string{"critical"},
+		Labels: map[string]string{
+			"severity": "^info$",
+		},
+	}
+	severities := map[string]bool{
+		"critical": false,
+		"info":     true,
+	}
+	for severity, expected := range severities {
+		alert := &alertmanager.Alert{
+			Labels: map[string]string{
+				"severity": severity,
+			},
+		}
+		matches, err := healer.checkRule(rule, alert)
+		if err != nil {
+			t.Error(err)
+		}
+		if matches != expected {
+			t.Errorf("Expected match %t for severity '%s', but got %t", expected, severity, matches)
+		}
+	}
+}
+
 func TestRuleWithTwoMatchingAnnotations(t *testing.T) {
 	healer := makeHealer(t, "empty")
 	rule := &autoheal.HealingRule{
@@ -504,8 +720,16 @@ func TestHealerActionMemory(t *testing.T) {
 	healer.processAlert(alert0)
 	healer.processAlert(alert1)
 
-	if healer.actionMemory.Len() != 1 {
-		t.Fail()
+	items := healer.actionMemory.List()
+	if len(items) != 1 {
+		t.Fatalf("Expected one action in the memory, but got %d", len(items))
+	}
+	action, ok := items[0].(*autoheal.AWXJobAction)
+	if !ok {
+		t.Fatalf("Expected an AWX job action, but got %T", items[0])
+	}
+	if action.Template != "test_template" {
+		t.Errorf("Expected template 'test_template', but got '%s'", action.Template)
 	}
 }
 
@@ -554,15 +778,459 @@ func TestHealerActionMemoryDisabled(t *testing.T) {
 	healer.processAlert(alert0)
 	healer.processAlert(alert1)
 
+	items := healer.actionMemory.List()
+	if len(items) != 0 {
+		t.Errorf("Expected the action memory to be empty, but it contains %v", items)
+	}
+}
+
+func TestHealerRuleThrottleIntervalOverridesGlobal(t *testing.T) {
+	healer := makeHealer(t, "empty")
+
+	// Disable the global memory, so that only the memory of the rule can throttle the action:
+	healer.actionMemory, _ = memory.NewShortTermMemoryBuilder().Duration(0).Build()
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+	healer.processRuleChange(&RuleChange{
+		Type: watch.Added,
+		Rule: makeThrottledRule("1h"),
+	})
+
+	healer.processAlert(makeThrottledAlert())
+	healer.processAlert(makeThrottledAlert())
+
+	if len(fake.AWXJobs()) != 1 {
+		t.Errorf("Expected the second action to be throttled by the rule, but got %d calls", len(fake.AWXJobs()))
+	}
 	if healer.actionMemory.Len() != 0 {
-		t.Fail()
+		t.Errorf("Expected the global memory to not be used, but it has %d actions", healer.actionMemory.Len())
+	}
+}
+
+func TestHealerRuleThrottleIntervalDisablesThrottling(t *testing.T) {
+	healer := makeHealer(t, "empty")
+
+	// The global memory would throttle the second action, but the rule disables throttling:
+	healer.actionMemory, _ = memory.NewShortTermMemoryBuilder().Duration(time.Hour).Build()
+	fake := testutil.NewFakeHealer()
+	healer.actionRunners[ActionRunnerTypeAWX] = fake
+	healer.processRuleChange(&RuleChange{
+		Type: watch.Added,
+		Rule: makeThrottledRule("0s"),
+	})
+
+	healer.processAlert(makeThrottledAlert())
+	healer.processAlert(makeThrottledAlert())
+
+	if len(fake.AWXJobs()) != 2 {
+		t.Errorf("Expected both actions to be executed, but got %d calls", len(fake.AWXJobs()))
+	}
+}
+
+func TestHealerRulesWithoutThrottleIntervalUseGlobal(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	healer.actionMemory, _ = memory.NewShortTermMemoryBuilder().Duration(time.Hour).Build()
+
+	actionMemory, err := healer.actionMemoryFor(makeThrottledRule(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actionMemory != healer.actionMemory {
+		t.Errorf("Expected the rule without throttle interval to use the global memory")
+	}
+}
+
+func makeThrottledRule(interval string) *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "throttled-rule",
+		},
+		Labels: map[string]string{
+			"mylabel": "myvalue",
+		},
+		ThrottleInterval: interval,
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "test_template",
+		},
+	}
+}
+
+func makeThrottledAlert() *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Status: "firing",
+		Labels: map[string]string{
+			"mylabel": "myvalue",
+		},
+	}
+}
+
+func TestBuildWithoutRunners(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error when no runner can be initialized, but got nil")
+	}
+}
+
+func TestBuildWithOneRunner(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "awx-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		Build()
+	if err != nil {
+		t.Fatalf("Expected no error when one runner can be initialized, but got: %s", err)
+	}
+	// The AWX runner is registered for both jobs and workflow jobs:
+	if len(healer.actionRunners) != 2 {
+		t.Errorf("Expected one runner with two types, but got %d", len(healer.actionRunners))
+	}
+	_, err = NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(2).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error when two runners are required and only one can be initialized")
 	}
 }
 
-func makeHealer(t *testing.T, name string) *Healer {
+func TestBuildWithTwoRunners(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "awx-config.yml")).
+		KubernetesClient(&FakeKubernetesClient{}).
+		MinimumRunnersRequired(2).
+		Build()
+	if err != nil {
+		t.Fatalf("Expected no error when two runners can be initialized, but got: %s", err)
+	}
+	// The AWX runner is registered for both jobs and workflow jobs:
+	if len(healer.actionRunners) != 3 {
+		t.Errorf("Expected two runners with three types, but got %d", len(healer.actionRunners))
+	}
+}
+
+func TestBuildWithPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Build the plugin. This requires a compiler that supports plugins, so skip the test if that
+	// isn't possible:
+	build := exec.Command(
+		"go", "build",
+		"-buildmode=plugin",
+		"-o", filepath.Join(dir, "recorder.so"),
+		filepath.Join("..", "..", "pkg", "runner", "testdata", "recorder"),
+	)
+	output, err := build.CombinedOutput()
+	if err != nil {
+		t.Skipf("Can't build test plugin: %s\n%s", err, output)
+	}
+
+	// The plugin alone should satisfy the minimum number of runners:
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		PluginDir(dir).
+		Build()
+	if err != nil {
+		t.Fatalf("Expected no error when loading the plugin, but got: %s", err)
+	}
+	if _, ok := healer.pluginRunners["recorder"]; !ok {
+		t.Errorf("Expected plugin runner of type 'recorder', but got %v", healer.pluginRunners)
+	}
+}
+
+func TestBuildWithMissingPluginDir(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		PluginDir(filepath.Join("..", "..", "testdata", "missing-plugins")).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error when the plugin directory doesn't exist, but got nil")
+	}
+}
+
+func TestServerAcceptsHTTP2(t *testing.T) {
+	healer := makeTLSHealer(t, false)
+	server := startTLSTestServer(t, healer)
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &http2.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+	response, err := client.Post(
+		server.URL+"/alerts",
+		"application/json",
+		bytes.NewBufferString(`{"alerts": [{"status": "firing", "labels": {"alertname": "NodeDown"}}]}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.ProtoMajor != 2 {
+		t.Errorf("Expected protocol HTTP/2, but got %s", response.Proto)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, but got %d", response.StatusCode)
+	}
+	if atomic.LoadInt64(&healer.pendingAlerts) != 1 {
+		t.Errorf("Expected one pending alert, but got %d", atomic.LoadInt64(&healer.pendingAlerts))
+	}
+}
+
+func TestServerWithHTTP2Disabled(t *testing.T) {
+	healer := makeTLSHealer(t, true)
+	server := startTLSTestServer(t, healer)
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &http2.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+	response, err := client.Get(server.URL + "/alerts")
+	if err == nil {
+		response.Body.Close()
+		t.Errorf("Expected the HTTP/2 connection to be rejected, but got %s", response.Proto)
+	}
+}
+
+func TestServerWithoutTLSDoesntConfigureHTTP2(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	server := &http.Server{}
+	err := healer.configureServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.TLSConfig != nil || server.TLSNextProto != nil {
+		t.Errorf("Expected the server to not be configured for HTTP/2")
+	}
+}
+
+func TestBuildRejectsNegativeHistorySize(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		HistorySize(-1).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error for a negative history size")
+	}
+	if healer != nil {
+		t.Errorf("Expected no healer when the build fails")
+	}
+}
+
+func TestBuildRequiresBothTLSFiles(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		TLSCertFile("tls.crt").
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error when the TLS key file is missing")
+	}
+}
+
+func TestAlertSourcePropagatesToMetric(t *testing.T) {
+	metrics.InitExportedMetrics()
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	healer := makeHealer(t, "empty")
+	request := httptest.NewRequest(
+		http.MethodPost,
+		"/alerts",
+		bytes.NewBufferString(`{"alerts": [{"status": "firing", "labels": {"alertname": "NodeDown"}}]}`),
+	)
+	request.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+	recorder := httptest.NewRecorder()
+	healer.handleRequest(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d", recorder.Code)
+	}
+
+	series := `autoheal_alerts_received_total{source="10.0.0.1"}`
+	actual := scrapeMetric(t, server.URL, series)
+	if actual != 1 {
+		t.Errorf("Expected metric '%s' to be 1, but it is %f", series, actual)
+	}
+}
+
+func TestAlertSourceFromCustomHeader(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	healer.alertSourceHeader = "X-Source"
+	request := httptest.NewRequest(http.MethodPost, "/alerts", nil)
+	request.Header.Set("X-Source", "alertmanager-1")
+	request.Header.Set("X-Forwarded-For", "10.0.0.1")
+	source := healer.alertSource(request)
+	if source != "alertmanager-1" {
+		t.Errorf("Expected source 'alertmanager-1', but got '%s'", source)
+	}
+}
+
+func TestAlertSourceFromRemoteAddress(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	request := httptest.NewRequest(http.MethodPost, "/alerts", nil)
+	request.RemoteAddr = "10.0.0.3:54321"
+	source := healer.alertSource(request)
+	if source != "10.0.0.3" {
+		t.Errorf("Expected source '10.0.0.3', but got '%s'", source)
+	}
+}
+
+func TestAlertsHandlerRequiresToken(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		AlertsToken("my-token").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := healer.alertsHandler()
+	body := `{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "NodeDown"}}]}`
+
+	// Without the token the request is rejected and the alert isn't queued:
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/alerts", strings.NewReader(body)))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	if atomic.LoadInt64(&healer.pendingAlerts) != 0 {
+		t.Errorf("Expected no pending alerts after a rejected request")
+	}
+
+	// With the token the alert is queued:
+	request := httptest.NewRequest(http.MethodPost, "/alerts", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer my-token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status %d, but got %d", http.StatusOK, recorder.Code)
+	}
+	if atomic.LoadInt64(&healer.pendingAlerts) != 1 {
+		t.Errorf("Expected one pending alert, but got %d", atomic.LoadInt64(&healer.pendingAlerts))
+	}
+}
+
+func TestBuildRejectsNegativeAlertsRateLimit(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		AlertsRateLimit(-1).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error for a negative alerts rate limit")
+	}
+}
+
+func TestAlertsRequestBodyLimit(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		MaxRequestBody(100).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer healer.config.ShutDown()
+	body := `{"status": "firing", "alerts": []}`
+
+	// A body just under the limit is accepted:
+	under := body + strings.Repeat(" ", 99-len(body))
+	recorder := httptest.NewRecorder()
+	healer.handleRequest(recorder, httptest.NewRequest(http.MethodPost, "/alerts", strings.NewReader(under)))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status %d for %d bytes, but got %d", http.StatusOK, len(under), recorder.Code)
+	}
+
+	// A body just over the limit is rejected:
+	over := body + strings.Repeat(" ", 101-len(body))
+	recorder = httptest.NewRecorder()
+	healer.handleRequest(recorder, httptest.NewRequest(http.MethodPost, "/alerts", strings.NewReader(over)))
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf(
+			"Expected status %d for %d bytes, but got %d",
+			http.StatusRequestEntityTooLarge,
+			len(over),
+			recorder.Code,
+		)
+	}
+}
+
+func TestBuildRejectsNonPositiveMaxRequestBody(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		MaxRequestBody(0).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error for a zero maximum request body size")
+	}
+}
+
+func TestLogJSONIndentDefault(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	if healer.logJSONIndent != 2 {
+		t.Errorf("Expected default log JSON indent 2, but got %d", healer.logJSONIndent)
+	}
+}
+
+func TestBuildRejectsNegativeLogJSONIndent(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		LogJSONIndent(-1).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error for a negative log JSON indent")
+	}
+}
+
+func makeTLSHealer(t *testing.T, disableHTTP2 bool) *Healer {
+	// The files aren't used, as the test server uses its own certificate:
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		TLSCertFile("tls.crt").
+		TLSKeyFile("tls.key").
+		DisableHTTP2(disableHTTP2).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return healer
+}
+
+// startTLSTestServer starts a TLS web server that sends the requests to the alerts handler of the
+// given healer, configured like the real web server.
+//
+func startTLSTestServer(t *testing.T, healer *Healer) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(healer.handleRequest))
+	err := healer.configureServer(server.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TLS = server.Config.TLSConfig
+	server.StartTLS()
+	return server
+}
+
+func makeHealer(t testing.TB, name string) *Healer {
 	file := filepath.Join("..", "..", "testdata", name+"-config.yml")
 	healer, err := NewHealerBuilder().
 		ConfigFile(file).
+		MinimumRunnersRequired(0).
 		Build()
 	if err != nil {
 		t.Error(err)
@@ -571,6 +1239,38 @@ func makeHealer(t *testing.T, name string) *Healer {
 	return healer
 }
 
+// scrapeMetric retrieves the metrics from the given URL, and returns the value of the given series,
+// or zero if it doesn't exist.
+//
+func scrapeMetric(t *testing.T, url, series string) float64 {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			value, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return value
+		}
+	}
+	return 0
+}
+
+// FakeKubernetesClient is a Kubernetes client that doesn't implement any method, useful for tests
+// that need a client but don't use it.
+//
+type FakeKubernetesClient struct {
+	kubernetes.Interface
+}
+
 type FakeActionRunner struct {
 	RuleAlertMap map[string]*alertmanager.Alert
 }
@@ -583,3 +1283,167 @@ func (f FakeActionRunner) RunAction(rule *autoheal.HealingRule, action interface
 	f.RuleAlertMap[rule.ObjectMeta.Name] = alert
 	return nil
 }
+
+func TestBuildWithConfigMapOnly(t *testing.T) {
+	configMaps := &fakeConfigMaps{
+		items: map[string]*core.ConfigMap{
+			"my-rules": {
+				ObjectMeta: meta.ObjectMeta{
+					Name: "my-rules",
+				},
+				Data: map[string]string{
+					"rules.yml": "rules:\n- metadata:\n    name: my-rule\n  plugin:\n    type: heal\n",
+				},
+			},
+		},
+	}
+	healer, err := NewHealerBuilder().
+		ConfigMap("my-namespace", "my-rules").
+		KubernetesClient(&fakeConfigMapsClient{configMaps: configMaps}).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer healer.config.ShutDown()
+
+	if configMaps.namespace != "my-namespace" {
+		t.Errorf("Expected namespace 'my-namespace', but got '%s'", configMaps.namespace)
+	}
+	rules := healer.config.Rules()
+	if len(rules) != 1 || rules[0].ObjectMeta.Name != "my-rule" {
+		t.Errorf("Expected rule 'my-rule' to be loaded from the config map, but got %v", rules)
+	}
+}
+
+func TestRunListensOnConfiguredAddress(t *testing.T) {
+	// Find a free port:
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "awx-config.yml")).
+		ListenAddress(address).
+		ShutdownGracePeriod(time.Second).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- healer.Run(stopCh)
+	}()
+
+	// Wait till the web server accepts alerts:
+	var response *http.Response
+	for i := 0; i < 50; i++ {
+		response, err = http.Post(
+			"http://"+address+"/alerts",
+			"application/json",
+			bytes.NewBufferString(`{"alerts": []}`),
+		)
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Expected the web server to listen on '%s', but got: %s", address, err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, but got %d", response.StatusCode)
+	}
+
+	// Stop the healer:
+	close(stopCh)
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("Expected clean shutdown, but got: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the healer to stop")
+	}
+}
+
+func TestBuildRejectsInvalidListenAddress(t *testing.T) {
+	for _, address := range []string{"9099", "localhost", ":bad-port"} {
+		_, err := NewHealerBuilder().
+			ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+			MinimumRunnersRequired(0).
+			ListenAddress(address).
+			Build()
+		if err == nil {
+			t.Errorf("Expected an error for listen address '%s', but got nil", address)
+		}
+	}
+}
+
+func TestCustomReceiverPathReceivesAlerts(t *testing.T) {
+	healer := makeReceiverPathHealer(t, "/api/v1/alerts")
+	handler := healer.serverHandler()
+
+	request := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/alerts",
+		bytes.NewBufferString(`{"alerts": [{"status": "firing", "labels": {"alertname": "NodeDown"}}]}`),
+	)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d", recorder.Code)
+	}
+	if pending := atomic.LoadInt64(&healer.pendingAlerts); pending != 1 {
+		t.Errorf("Expected one pending alert, but got %d", pending)
+	}
+}
+
+func TestDefaultReceiverPathNotFoundWhenOverridden(t *testing.T) {
+	healer := makeReceiverPathHealer(t, "/api/v1/alerts")
+	handler := healer.serverHandler()
+
+	request := httptest.NewRequest(
+		http.MethodPost,
+		"/alerts",
+		bytes.NewBufferString(`{"alerts": [{"status": "firing", "labels": {"alertname": "NodeDown"}}]}`),
+	)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, but got %d", recorder.Code)
+	}
+	if pending := atomic.LoadInt64(&healer.pendingAlerts); pending != 0 {
+		t.Errorf("Expected no pending alerts, but got %d", pending)
+	}
+}
+
+func TestBuildRejectsInvalidReceiverPath(t *testing.T) {
+	for _, path := range []string{"alerts", "/", "/metrics", "/rules"} {
+		_, err := NewHealerBuilder().
+			ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+			MinimumRunnersRequired(0).
+			ReceiverPath(path).
+			Build()
+		if err == nil {
+			t.Errorf("Expected an error for receiver path '%s', but got nil", path)
+		}
+	}
+}
+
+func makeReceiverPathHealer(t *testing.T, path string) *Healer {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		ReceiverPath(path).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return healer
+}
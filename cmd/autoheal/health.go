@@ -0,0 +1,54 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the handlers of the endpoints used by the liveness and readiness probes.
+
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// handleHealthzRequest reports that the healer is alive. It always succeeds, as the fact that it
+// is called means that the web server is up.
+//
+func (h *Healer) handleHealthzRequest(response http.ResponseWriter, request *http.Request) {
+	response.WriteHeader(http.StatusOK)
+	response.Write([]byte("ok\n"))
+}
+
+// handleReadyzRequest reports if the healer is ready to process alerts, which is the case once the
+// rules cache has been loaded from the configuration for the first time.
+//
+func (h *Healer) handleReadyzRequest(response http.ResponseWriter, request *http.Request) {
+	if !h.isReady() {
+		http.Error(
+			response,
+			http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable,
+		)
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	response.Write([]byte("ok\n"))
+}
+
+// isReady returns true if the rules cache has been loaded at least once.
+//
+func (h *Healer) isReady() bool {
+	return atomic.LoadInt32(&h.ready) == 1
+}
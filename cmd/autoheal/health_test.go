@@ -0,0 +1,79 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestHealthzAndReadyzEndpoints(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "rules-config.yml")).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer healer.rulesQueue.ShutDown()
+
+	// Start the web server with the same handler that the healer uses:
+	server, address := startTestServer(t, healer.serverHandler())
+	defer server.Close()
+
+	// The healer is alive but not ready till the rules cache has been loaded:
+	checkEndpointStatus(t, "http://"+address+"/healthz", http.StatusOK)
+	checkEndpointStatus(t, "http://"+address+"/readyz", http.StatusServiceUnavailable)
+
+	// Load the rules, and check that it becomes ready:
+	go healer.runRulesWorker()
+	healer.reloadAllRules()
+	checkEndpointStatus(t, "http://"+address+"/healthz", http.StatusOK)
+	checkEndpointStatus(t, "http://"+address+"/readyz", http.StatusOK)
+}
+
+func TestReadyzStaysReadyAfterReload(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer healer.rulesQueue.ShutDown()
+
+	healer.reloadAllRules()
+	if !healer.isReady() {
+		t.Fatalf("Expected the healer to be ready after loading an empty configuration")
+	}
+	healer.reloadAllRules()
+	if !healer.isReady() {
+		t.Errorf("Expected the healer to be still ready after reloading the rules")
+	}
+}
+
+func checkEndpointStatus(t *testing.T, url string, expected int) {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != expected {
+		t.Errorf("Expected status %d from '%s', but got %d", expected, url, response.StatusCode)
+	}
+}
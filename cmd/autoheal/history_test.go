@@ -0,0 +1,147 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/receiver"
+)
+
+func TestHistoryIsCapped(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		HistorySize(100).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 150; i++ {
+		healer.processAlert(&alertmanager.Alert{
+			Status: alertmanager.AlertStatusFiring,
+			Labels: map[string]string{
+				"alertname": fmt.Sprintf("alert%d", i),
+			},
+		})
+	}
+	entries := healer.history.List()
+	if len(entries) != 100 {
+		t.Fatalf("Expected 100 entries in the history but got %d", len(entries))
+	}
+	if entries[0].Labels["alertname"] != "alert50" {
+		t.Errorf("Expected oldest entry to be 'alert50' but got '%s'", entries[0].Labels["alertname"])
+	}
+	if entries[99].Labels["alertname"] != "alert149" {
+		t.Errorf("Expected newest entry to be 'alert149' but got '%s'", entries[99].Labels["alertname"])
+	}
+}
+
+func TestHistoryRecordsOutcomes(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	healer.actionRunners[ActionRunnerTypeAWX] = FakeActionRunner{
+		RuleAlertMap: make(map[string]*alertmanager.Alert),
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "start-node",
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Start node",
+		},
+	}
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+	alert := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+
+	// The first time the action should be started, and the second time it should be throttled:
+	healer.processAlert(alert)
+	healer.processAlert(alert)
+	entries := healer.history.List()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries in the history but got %d", len(entries))
+	}
+	expected := []receiver.ActionOutcome{
+		receiver.ActionOutcomeStarted,
+		receiver.ActionOutcomeThrottled,
+	}
+	for i, entry := range entries {
+		if len(entry.Rules) != 1 || entry.Rules[0] != "start-node" {
+			t.Errorf("Expected entry %d to match rule 'start-node' but got %v", i, entry.Rules)
+		}
+		if len(entry.Actions) != 1 || entry.Actions[0].Outcome != expected[i] {
+			t.Errorf("Expected entry %d to have outcome '%s' but got %+v", i, expected[i], entry.Actions)
+		}
+	}
+}
+
+func TestHistoryRequest(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	healer.processAlert(&alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	})
+
+	// Request the complete history:
+	recorder := httptest.NewRecorder()
+	healer.handleHistoryRequest(recorder, httptest.NewRequest(http.MethodGet, "/history", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status %d but got %d", http.StatusOK, recorder.Code)
+	}
+	var entries []*receiver.HistoryEntry
+	err := json.Unmarshal(recorder.Body.Bytes(), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected 1 entry but got %d", len(entries))
+	}
+
+	// Request the history of a rule that didn't match:
+	recorder = httptest.NewRecorder()
+	healer.handleHistoryRequest(recorder, httptest.NewRequest(http.MethodGet, "/history?rule=other", nil))
+	entries = nil
+	json.Unmarshal(recorder.Body.Bytes(), &entries)
+	if len(entries) != 0 {
+		t.Errorf("Expected no entries but got %d", len(entries))
+	}
+
+	// Request with an invalid time:
+	recorder = httptest.NewRecorder()
+	healer.handleHistoryRequest(recorder, httptest.NewRequest(http.MethodGet, "/history?since=yesterday", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d but got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
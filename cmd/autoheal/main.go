@@ -20,8 +20,12 @@ import (
 	"flag"
 	"os"
 
+	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+
+	"github.com/openshift/autoheal/pkg/log"
+	"github.com/openshift/autoheal/pkg/logging"
 )
 
 var rootCmd = &cobra.Command{
@@ -33,6 +37,7 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
+	rootCmd.AddCommand(rulesCmd)
 	flag.Set("logtostderr", "true")
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 }
@@ -43,7 +48,23 @@ func main() {
 	// parsed.
 	flag.CommandLine.Parse([]string{})
 
-	// Execute the root command:
+	// Configure the log as soon as the flags have been parsed, before the commands run:
+	cobra.OnInitialize(configureLog)
+
+	// Execute the root command, and flush the log before exiting:
 	rootCmd.SetArgs(os.Args[1:])
 	rootCmd.Execute()
+	log.Sync()
+}
+
+// configureLog checks the format given with the --log-format option, and configures the zap
+// logger and the wrapper of glog to use it.
+//
+func configureLog() {
+	format, err := logging.ParseFormat(serverLogFormat)
+	if err != nil {
+		glog.Fatalf("Error parsing log format: %s", err.Error())
+	}
+	logging.SetFormat(format)
+	log.SetFormat(format)
 }
@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the handler of the endpoint used to make the healer forget that the action of
+// a rule has been executed recently, so that it isn't throttled.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/receiver"
+)
+
+// memoryHandler creates the handler for the /memory endpoint. It requires the admin token, as it
+// changes the state of the healer.
+//
+func (h *Healer) memoryHandler() http.Handler {
+	return receiver.NewMiddlewareChain(
+		receiver.LoggingMiddleware,
+		receiver.AuthMiddleware(h.managementToken()),
+	).Then(http.HandlerFunc(h.handleMemoryRequest))
+}
+
+// handleMemoryRequest removes from the memory of executed actions the action of the rule given in
+// the 'rule' query parameter, so that it will be executed again the next time that the alert is
+// received, even if the throttle interval hasn't expired yet. As the memory contains the actions
+// with the templates already processed, the rest of the query parameters are used as the labels
+// of the alert used to process the templates of the action.
+//
+func (h *Healer) handleMemoryRequest(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodDelete {
+		http.Error(
+			response,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+
+	// Find the rule:
+	query := request.URL.Query()
+	name := query.Get("rule")
+	if name == "" {
+		http.Error(response, "The 'rule' query parameter is mandatory", http.StatusBadRequest)
+		return
+	}
+	value, ok := h.rulesCache.Load(name)
+	if !ok {
+		http.Error(response, fmt.Sprintf("Rule '%s' doesn't exist", name), http.StatusNotFound)
+		return
+	}
+	rule := value.(*autoheal.HealingRule)
+
+	// Calculate the action as it was stored in the memory when it was executed:
+	action, err := memoryAction(rule, query)
+	if err != nil {
+		glog.Warningf("Can't calculate action of rule '%s' to remove it from memory: %s", name, err)
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Remove the action:
+	actionMemory, err := h.actionMemoryFor(rule)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !actionMemory.Remove(action) {
+		http.Error(
+			response,
+			fmt.Sprintf("The action of rule '%s' isn't in the memory", name),
+			http.StatusNotFound,
+		)
+		return
+	}
+	glog.Infof("Action of rule '%s' has been removed from the memory", name)
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// memoryAction returns a copy of the action of the given rule, with the templates processed using
+// an alert whose labels are the given query parameters, excluding the name of the rule.
+//
+func memoryAction(rule *autoheal.HealingRule, query map[string][]string) (interface{}, error) {
+	action := copyRuleAction(rule)
+	if action == nil {
+		return nil, fmt.Errorf("Rule '%s' doesn't have an action", rule.ObjectMeta.Name)
+	}
+	alert := &alertmanager.Alert{
+		Labels: make(map[string]string),
+	}
+	for key, values := range query {
+		if key == "rule" || len(values) == 0 {
+			continue
+		}
+		alert.Labels[key] = values[0]
+	}
+	template, err := newAlertTemplate()
+	if err != nil {
+		return nil, err
+	}
+	err = template.Process(action, alert)
+	if err != nil {
+		return nil, err
+	}
+	return action, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestMemoryEndpointRemovesAction(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	healer.actionMemory.Add(&autoheal.AWXJobAction{
+		Template: "Start node",
+		Limit:    "node0",
+	})
+
+	request := httptest.NewRequest(http.MethodDelete, "/memory?rule=start-node&instance=node0", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleMemoryRequest(recorder, request)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, but got %d", recorder.Code)
+	}
+	if healer.actionMemory.Has(&autoheal.AWXJobAction{
+		Template: "Start node",
+		Limit:    "node0",
+	}) {
+		t.Errorf("Expected the action to have been removed from the memory")
+	}
+}
+
+func TestMemoryEndpointActionNotInMemory(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	healer.actionMemory.Add(&autoheal.AWXJobAction{
+		Template: "Start node",
+		Limit:    "node1",
+	})
+
+	request := httptest.NewRequest(http.MethodDelete, "/memory?rule=start-node&instance=node0", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleMemoryRequest(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, but got %d", recorder.Code)
+	}
+	if !healer.actionMemory.Has(&autoheal.AWXJobAction{
+		Template: "Start node",
+		Limit:    "node1",
+	}) {
+		t.Errorf("Expected the action of the other instance to still be in the memory")
+	}
+}
+
+func TestMemoryEndpointUnknownRule(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+
+	request := httptest.NewRequest(http.MethodDelete, "/memory?rule=junk", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleMemoryRequest(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, but got %d", recorder.Code)
+	}
+}
+
+func TestMemoryEndpointRequiresRule(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+
+	request := httptest.NewRequest(http.MethodDelete, "/memory", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleMemoryRequest(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, but got %d", recorder.Code)
+	}
+}
+
+func TestMemoryEndpointRejectsOtherMethods(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+
+	request := httptest.NewRequest(http.MethodGet, "/memory?rule=start-node", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleMemoryRequest(recorder, request)
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected status 405, but got %d", recorder.Code)
+	}
+}
+
+func TestMemoryActionMatchesExecutedAction(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	alert := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+			"instance":  "node0",
+		},
+	}
+	value, _ := healer.rulesCache.Load("start-node")
+	rule := value.(*autoheal.HealingRule)
+	action, err := memoryAction(rule, map[string][]string{
+		"rule":     {"start-node"},
+		"instance": {"node0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := copyRuleAction(rule)
+	template, err := newAlertTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = template.Process(expected, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(action, expected) {
+		t.Errorf("Expected action %v, but got %v", expected, action)
+	}
+}
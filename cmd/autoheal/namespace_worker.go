@@ -0,0 +1,242 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+// namespaceScope contains the set of namespaces that have the labels given in the configuration,
+// and keeps it updated watching the namespaces.
+//
+type namespaceScope struct {
+	// The Kubernetes client used to list and watch the namespaces:
+	client kubernetes.Interface
+
+	// The label selector that the namespaces should match:
+	selector string
+
+	// The names of the namespaces that match the selector, and whether they have already been
+	// listed at least once:
+	names  map[string]bool
+	synced bool
+	mutex  *sync.RWMutex
+
+	// Closed when the scope is replaced, to stop watching the namespaces:
+	done chan struct{}
+}
+
+// newNamespaceScope creates a set of namespaces that will contain the ones that have the given
+// labels. The set is empty till the run method is called.
+//
+func newNamespaceScope(client kubernetes.Interface, set map[string]string) *namespaceScope {
+	return &namespaceScope{
+		client:   client,
+		selector: labels.SelectorFromSet(labels.Set(set)).String(),
+		names:    make(map[string]bool),
+		mutex:    &sync.RWMutex{},
+		done:     make(chan struct{}),
+	}
+}
+
+// contains checks if the namespace with the given name is in the set.
+//
+func (s *namespaceScope) contains(name string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.names[name]
+}
+
+// hasSynced checks if the namespaces have already been listed. Till then the set is empty, but that
+// doesn't mean that no namespace matches the selector.
+//
+func (s *namespaceScope) hasSynced() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.synced
+}
+
+// run lists and watches the namespaces that match the selector till the given channel is closed or
+// the scope is stopped. When the watch is closed by the server the namespaces are listed and
+// watched again.
+//
+func (s *namespaceScope) run(stopCh <-chan struct{}) {
+	doneCh := make(chan struct{})
+	go func() {
+		select {
+		case <-stopCh:
+		case <-s.done:
+		}
+		close(doneCh)
+	}()
+	wait.Until(func() {
+		err := s.watch(doneCh)
+		if err != nil {
+			glog.Errorf("Can't watch namespaces with labels '%s': %s", s.selector, err)
+		}
+	}, time.Second, doneCh)
+}
+
+// stop stops watching the namespaces. It must be called only once.
+//
+func (s *namespaceScope) stop() {
+	close(s.done)
+}
+
+// watch lists the namespaces that match the selector, replacing the contents of the set, and then
+// updates it with the watch events till the watch is closed or the given channel is closed.
+//
+func (s *namespaceScope) watch(stopCh <-chan struct{}) error {
+	resource := s.client.CoreV1().Namespaces()
+	list, err := resource.List(meta.ListOptions{
+		LabelSelector: s.selector,
+	})
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(list.Items))
+	for _, namespace := range list.Items {
+		names[namespace.ObjectMeta.Name] = true
+	}
+	s.mutex.Lock()
+	s.names = names
+	s.synced = true
+	s.mutex.Unlock()
+	glog.Infof("Found %d namespaces with labels '%s'", len(names), s.selector)
+
+	watcher, err := resource.Watch(meta.ListOptions{
+		LabelSelector:   s.selector,
+		ResourceVersion: list.ResourceVersion,
+	})
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil
+			}
+			s.processEvent(event)
+		}
+	}
+}
+
+// processEvent updates the set according to the given watch event. Namespaces that stop matching
+// the selector are reported by the server as deleted.
+//
+func (s *namespaceScope) processEvent(event watch.Event) {
+	namespace, ok := event.Object.(*core.Namespace)
+	if !ok {
+		return
+	}
+	name := namespace.ObjectMeta.Name
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		if !s.names[name] {
+			s.names[name] = true
+			glog.Infof("Namespace '%s' was added to the scope", name)
+		}
+	case watch.Deleted:
+		if s.names[name] {
+			delete(s.names, name)
+			glog.Infof("Namespace '%s' was removed from the scope", name)
+		}
+	}
+}
+
+// inScope checks if the given alert should be processed, according to the namespace that its
+// namespace label refers to. Alerts without that label are always processed. If the namespaces
+// haven't been listed yet it returns a retryable error, so that the alert is processed again later
+// instead of being discarded.
+//
+func (h *Healer) inScope(alert *alertmanager.Alert) (bool, error) {
+	h.namespaceScopeMutex.RLock()
+	scope := h.namespaceScope
+	h.namespaceScopeMutex.RUnlock()
+	if scope == nil {
+		return true, nil
+	}
+	namespace, ok := alert.Labels["namespace"]
+	if !ok {
+		return true, nil
+	}
+	if !scope.hasSynced() {
+		return false, &runner.RetryableError{
+			Reason: fmt.Sprintf(
+				"Namespaces with labels '%s' haven't been listed yet",
+				scope.selector,
+			),
+		}
+	}
+	return scope.contains(namespace), nil
+}
+
+// updateNamespaceScope replaces the set of namespaces that the alerts can refer to when the labels
+// given in the configuration change, stopping the watch of the previous set and starting the watch
+// of the new one. When the labels are removed all the alerts are processed again.
+//
+func (h *Healer) updateNamespaceScope(stopCh <-chan struct{}) {
+	set := h.config.ScopeToNamespaceLabels()
+	h.namespaceScopeMutex.Lock()
+	defer h.namespaceScopeMutex.Unlock()
+	current := h.namespaceScope
+	if len(set) == 0 {
+		if current != nil {
+			current.stop()
+			h.namespaceScope = nil
+			glog.Infof("Namespace labels removed, alerts from all namespaces will be processed")
+		}
+		return
+	}
+	selector := labels.SelectorFromSet(labels.Set(set)).String()
+	if current != nil && current.selector == selector {
+		return
+	}
+	if h.k8sClient == nil {
+		glog.Errorf(
+			"Namespace labels '%s' are used to scope alerts, but there is no connection to "+
+				"the Kubernetes API, will ignore them",
+			selector,
+		)
+		return
+	}
+	if current != nil {
+		current.stop()
+	}
+	h.namespaceScope = newNamespaceScope(h.k8sClient, set)
+	go h.namespaceScope.run(stopCh)
+	glog.Infof("Alerts are now scoped to namespaces with labels '%s'", selector)
+}
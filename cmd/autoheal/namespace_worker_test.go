@@ -0,0 +1,309 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/config"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+func TestAlertsFromUnmatchedNamespacesAreDropped(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+	actionRunner := FakeActionRunner{
+		RuleAlertMap: make(map[string]*alertmanager.Alert),
+	}
+	healer.actionRunners[ActionRunnerTypeAWX] = actionRunner
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "restart-pod",
+		},
+		Labels: map[string]string{
+			"alertname": "PodDown",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Restart pod",
+		},
+	}
+	healer.rulesCache.Store(rule.ObjectMeta.Name, rule)
+
+	// Only the 'matched' namespace is in scope:
+	healer.namespaceScope = newNamespaceScope(nil, map[string]string{"autoheal": "enabled"})
+	healer.namespaceScope.synced = true
+	healer.namespaceScope.processEvent(watch.Event{
+		Type:   watch.Added,
+		Object: makeNamespace("matched"),
+	})
+
+	err := healer.processAlert(makeNamespaceAlert("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actionRunner.RuleAlertMap) != 0 {
+		t.Fatalf("Expected the alert from an unmatched namespace to be dropped")
+	}
+	entries := healer.history.List()
+	if len(entries) != 1 {
+		t.Fatalf("Expected the dropped alert to be added to the history, got %d entries", len(entries))
+	}
+	if entries[0].Ignored != "Namespace 'other' isn't in scope" {
+		t.Errorf("Unexpected ignore reason '%s'", entries[0].Ignored)
+	}
+	healer.processAlert(makeNamespaceAlert("matched"))
+	if len(actionRunner.RuleAlertMap) != 1 {
+		t.Errorf("Expected the alert from the matched namespace to be healed")
+	}
+}
+
+func TestAlertsWithoutNamespaceAreKept(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+	healer.namespaceScope = newNamespaceScope(nil, map[string]string{"autoheal": "enabled"})
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	scoped, err := healer.inScope(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !scoped {
+		t.Errorf("Expected alert without namespace to be in scope")
+	}
+}
+
+func TestAlertsAreRetriedTillNamespacesAreListed(t *testing.T) {
+	healer := makeHealer(t, "empty")
+	defer healer.config.ShutDown()
+	healer.namespaceScope = newNamespaceScope(nil, map[string]string{"autoheal": "enabled"})
+
+	err := healer.processAlert(makeNamespaceAlert("matched"))
+	if !runner.IsRetryable(err) {
+		t.Fatalf("Expected a retryable error before the namespaces are listed, but got '%v'", err)
+	}
+	if len(healer.history.List()) != 0 {
+		t.Errorf("Expected the retried alert to not be added to the history")
+	}
+}
+
+func TestNamespaceScopeFollowsConfigurationChanges(t *testing.T) {
+	namespaces := &fakeNamespaces{
+		items:   []core.Namespace{*makeNamespace("first")},
+		watcher: watch.NewFake(),
+	}
+	healer := makeHealer(t, "empty")
+	defer func() {
+		healer.config.ShutDown()
+	}()
+	healer.k8sClient = &fakeNamespacesClient{namespaces: namespaces}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	dir, err := ioutil.TempDir("", "scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Add the labels to the configuration:
+	useConfig(t, healer, dir, "scopeToNamespaceLabels:\n  autoheal: enabled\n")
+	healer.updateNamespaceScope(stopCh)
+	scope := healer.namespaceScope
+	if scope == nil || scope.selector != "autoheal=enabled" {
+		t.Fatalf("Expected a scope with selector 'autoheal=enabled', but got %+v", scope)
+	}
+
+	// Loading the same labels again shouldn't replace the scope:
+	healer.updateNamespaceScope(stopCh)
+	if healer.namespaceScope != scope {
+		t.Errorf("Expected the scope to be kept when the labels don't change")
+	}
+
+	// Removing the labels should remove the scope and stop watching the namespaces:
+	useConfig(t, healer, dir, "throttling:\n  interval: 1h\n")
+	healer.updateNamespaceScope(stopCh)
+	if healer.namespaceScope != nil {
+		t.Errorf("Expected the scope to be removed with the labels")
+	}
+	select {
+	case <-scope.done:
+	default:
+		t.Errorf("Expected the previous scope to be stopped")
+	}
+	scoped, err := healer.inScope(makeNamespaceAlert("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !scoped {
+		t.Errorf("Expected all the namespaces to be in scope without labels")
+	}
+}
+
+func TestNamespaceScopeWatchesNamespaces(t *testing.T) {
+	namespaces := &fakeNamespaces{
+		items:   []core.Namespace{*makeNamespace("first")},
+		watcher: watch.NewFake(),
+	}
+	scope := newNamespaceScope(
+		&fakeNamespacesClient{namespaces: namespaces},
+		map[string]string{"autoheal": "enabled"},
+	)
+
+	// Send the events and then close the watch, so that the worker returns:
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	done := make(chan error)
+	go func() {
+		done <- scope.watch(stopCh)
+	}()
+	namespaces.watcher.Add(makeNamespace("second"))
+	namespaces.watcher.Modify(makeNamespace("third"))
+	namespaces.watcher.Delete(makeNamespace("first"))
+	namespaces.watcher.Stop()
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if namespaces.selector != "autoheal=enabled" {
+		t.Errorf("Expected label selector 'autoheal=enabled', but got '%s'", namespaces.selector)
+	}
+	if scope.contains("first") {
+		t.Errorf("Expected namespace 'first' to be removed from the scope")
+	}
+	for _, name := range []string{"second", "third"} {
+		if !scope.contains(name) {
+			t.Errorf("Expected namespace '%s' to be in the scope", name)
+		}
+	}
+}
+
+// useConfig replaces the configuration of the given healer with one loaded from a new file, in the
+// given directory, with the given content.
+//
+func useConfig(t *testing.T, healer *Healer, dir, content string) {
+	file, err := ioutil.TempFile(dir, "config-*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	err = ioutil.WriteFile(file.Name(), []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.NewBuilder().
+		File(file.Name()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	healer.config.ShutDown()
+	healer.config = cfg
+}
+
+func makeNamespace(name string) *core.Namespace {
+	return &core.Namespace{
+		ObjectMeta: meta.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"autoheal": "enabled",
+			},
+		},
+	}
+}
+
+func makeNamespaceAlert(namespace string) *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "PodDown",
+			"namespace": namespace,
+		},
+	}
+}
+
+// fakeNamespacesClient is a Kubernetes client that only implements the parts of the API used to
+// watch namespaces. Calling any other method will panic.
+//
+type fakeNamespacesClient struct {
+	kubernetes.Interface
+	namespaces *fakeNamespaces
+}
+
+func (c *fakeNamespacesClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeCoreV1{namespaces: c.namespaces}
+}
+
+type fakeCoreV1 struct {
+	corev1.CoreV1Interface
+	namespaces *fakeNamespaces
+	services   *fakeServices
+	pods       *fakePods
+	configMaps *fakeConfigMaps
+}
+
+func (c *fakeCoreV1) Namespaces() corev1.NamespaceInterface {
+	return c.namespaces
+}
+
+func (c *fakeCoreV1) Services(namespace string) corev1.ServiceInterface {
+	c.services.namespace = namespace
+	return c.services
+}
+
+func (c *fakeCoreV1) Pods(namespace string) corev1.PodInterface {
+	c.pods.namespace = namespace
+	return c.pods
+}
+
+func (c *fakeCoreV1) ConfigMaps(namespace string) corev1.ConfigMapInterface {
+	c.configMaps.namespace = namespace
+	return c.configMaps
+}
+
+// fakeNamespaces returns the given namespaces when listed, and the given watcher when watched. It
+// remembers the label selector used.
+//
+type fakeNamespaces struct {
+	corev1.NamespaceInterface
+	items    []core.Namespace
+	watcher  *watch.FakeWatcher
+	selector string
+}
+
+func (n *fakeNamespaces) List(options meta.ListOptions) (*core.NamespaceList, error) {
+	n.selector = options.LabelSelector
+	return &core.NamespaceList{
+		Items: n.items,
+	}, nil
+}
+
+func (n *fakeNamespaces) Watch(options meta.ListOptions) (watch.Interface, error) {
+	return n.watcher, nil
+}
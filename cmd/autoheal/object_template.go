@@ -25,8 +25,12 @@ import (
 	"fmt"
 	"reflect"
 	"text/template"
+	"time"
 
+	"github.com/Masterminds/sprig"
 	"github.com/golang/glog"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
 )
 
 // ObjecTemplateBuilder is used to build object template processors. Don't instantiate it directly,
@@ -92,6 +96,12 @@ func (b *ObjectTemplateBuilder) Build() (t *ObjectTemplate, err error) {
 		t.variables[name] = value
 	}
 
+	// Add the functions of the sprig library, except the ones that read environment variables, as
+	// they may contain credentials:
+	t.library = sprig.TxtFuncMap()
+	delete(t.library, "env")
+	delete(t.library, "expandenv")
+
 	return
 }
 
@@ -111,6 +121,9 @@ type ObjectTemplate struct {
 
 	// Variables:
 	variables map[string]string
+
+	// Functions from the sprig library, created once as there are many of them:
+	library template.FuncMap
 }
 
 // Process iterates the object recursively, and replaces all the fields or items that are strings
@@ -136,7 +149,7 @@ func (t *ObjectTemplate) processValue(input reflect.Value, data interface{}) (ou
 	if output.IsValid() {
 		switch output.Kind() {
 		case reflect.String:
-			text, err := t.processString(output, data)
+			text, err := t.ProcessString(output.String(), data)
 			if err == nil {
 				output = reflect.ValueOf(text)
 
@@ -145,10 +158,21 @@ func (t *ObjectTemplate) processValue(input reflect.Value, data interface{}) (ou
 					input.SetString(text)
 				}
 			}
-		case reflect.Array:
-			// Not implemented yet.
-		case reflect.Slice:
-			// Not implemented yet.
+		case reflect.Array, reflect.Slice:
+			for i, n := 0, output.Len(); i < n; i++ {
+				item := output.Index(i)
+				var v reflect.Value
+				v, err = t.processValue(item, data)
+				if err != nil {
+					return
+				}
+
+				// Items that can't be updated in place, like the strings stored in
+				// interfaces, need to be replaced with the processed copy:
+				if item.CanSet() && v.IsValid() && v.Type().AssignableTo(item.Type()) {
+					item.Set(v)
+				}
+			}
 		case reflect.Map:
 			for _, k := range output.MapKeys() {
 				var v reflect.Value
@@ -180,9 +204,11 @@ func (t *ObjectTemplate) processValue(input reflect.Value, data interface{}) (ou
 	return
 }
 
-func (t *ObjectTemplate) processString(value reflect.Value, data interface{}) (text string, err error) {
-	// Get the original text:
-	text = value.String()
+// ProcessString returns the result of processing the given text as a template, with the delimiters,
+// variables and functions of this object template. The data for the template is taken from the data
+// parameter.
+//
+func (t *ObjectTemplate) ProcessString(text string, data interface{}) (result string, err error) {
 	if glog.V(3) {
 		glog.Infof("Original text:\n%s", text)
 	}
@@ -199,7 +225,11 @@ func (t *ObjectTemplate) processString(value reflect.Value, data interface{}) (t
 	}
 
 	// Parse and run the template:
-	tmpl, err := template.New("").Delims(t.left, t.right).Parse(text)
+	tmpl, err := template.New("").
+		Delims(t.left, t.right).
+		Funcs(t.library).
+		Funcs(t.functions(data)).
+		Parse(text)
 	if err != nil {
 		return
 	}
@@ -208,10 +238,35 @@ func (t *ObjectTemplate) processString(value reflect.Value, data interface{}) (t
 	if err != nil {
 		return
 	}
-	text = buffer.String()
+	result = buffer.String()
 	if glog.V(3) {
-		glog.Infof("Generated text:\n%s", text)
+		glog.Infof("Generated text:\n%s", result)
 	}
 
 	return
 }
+
+// functions returns the functions that are available to the templates. Some of them use the data
+// of the template, so they are created for each execution.
+//
+func (t *ObjectTemplate) functions(data interface{}) template.FuncMap {
+	alert, _ := data.(*alertmanager.Alert)
+	return template.FuncMap{
+		"alertAge": func() (age time.Duration, err error) {
+			if alert == nil {
+				err = fmt.Errorf("Function 'alertAge' can only be used when the data is an alert")
+				return
+			}
+			age = time.Since(alert.StartsAt).Round(time.Second)
+			return
+		},
+		"alertAgeSeconds": func() (age float64, err error) {
+			if alert == nil {
+				err = fmt.Errorf("Function 'alertAgeSeconds' can only be used when the data is an alert")
+				return
+			}
+			age = time.Since(alert.StartsAt).Seconds()
+			return
+		},
+	}
+}
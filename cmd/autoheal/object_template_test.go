@@ -17,7 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"reflect"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
 )
 
 type TemplateTestDataNested struct {
@@ -51,7 +56,10 @@ func TestProcess(t *testing.T) {
 	testProcessStringInput(t, template, params)
 	testProcessStructInput(t, template, params)
 	testProcessMapInput(t, template, params)
-
+	testProcessStringSliceInput(t, template, params)
+	testProcessStructSliceInput(t, template, params)
+	testProcessNestedSliceInput(t, template, params)
+	testProcessInterfaceSliceInput(t, template, params)
 }
 
 // check basic string templating:
@@ -129,3 +137,296 @@ func testProcessMapInput(t *testing.T, template *ObjectTemplate, params Template
 		t.Errorf("Unexpected template result - expected '%v', got '%v'", expected, input["b"])
 	}
 }
+
+// check string slice templating:
+func testProcessStringSliceInput(t *testing.T, template *ObjectTemplate, params TemplateTestData) {
+	input := []string{
+		"Test [ $foo ] test [ $bar ]",
+		"str=[ $str ]",
+	}
+	err := template.Process(&input, params)
+	if err != nil {
+		t.Errorf("Error processing template: %v", err)
+	}
+
+	expected := []string{
+		"Test [ $foo ] test [ $bar ]",
+		"str=This is a string",
+	}
+	if !reflect.DeepEqual(input, expected) {
+		t.Errorf("Unexpected template result - expected '%v', got '%v'", expected, input)
+	}
+}
+
+// check struct slice templating, both for values and for pointers:
+func testProcessStructSliceInput(t *testing.T, template *ObjectTemplate, params TemplateTestData) {
+	input := []TemplateTestDataNested{
+		{StructKey: "str=[ $str ]"},
+		{StructKey: "Test [ $foo ]"},
+	}
+	err := template.Process(&input, params)
+	if err != nil {
+		t.Errorf("Error processing template: %v", err)
+	}
+
+	expected := []TemplateTestDataNested{
+		{StructKey: "str=This is a string"},
+		{StructKey: "Test [ $foo ]"},
+	}
+	if !reflect.DeepEqual(input, expected) {
+		t.Errorf("Unexpected template result - expected '%v', got '%v'", expected, input)
+	}
+
+	pointers := []*TemplateTestDataNested{
+		{StructKey: "str=[ $str ]"},
+	}
+	err = template.Process(&pointers, params)
+	if err != nil {
+		t.Errorf("Error processing template: %v", err)
+	}
+	if pointers[0].StructKey != "str=This is a string" {
+		t.Errorf("Unexpected template result - expected 'str=This is a string', got '%v'",
+			pointers[0].StructKey)
+	}
+}
+
+// check templating of slices inside structs, like the commands and environment variables of the
+// containers of a batch job:
+func testProcessNestedSliceInput(t *testing.T, template *ObjectTemplate, params TemplateTestData) {
+	type TestEnv struct {
+		Name  string
+		Value string
+	}
+	type TestContainer struct {
+		Command []string
+		Env     []TestEnv
+	}
+	type TestSpec struct {
+		Containers []TestContainer
+	}
+	input := TestSpec{
+		Containers: []TestContainer{
+			{
+				Command: []string{"echo", "[ $str ]"},
+				Env: []TestEnv{
+					{Name: "KEY", Value: "[ $struct.StructKey ]"},
+				},
+			},
+		},
+	}
+	err := template.Process(&input, params)
+	if err != nil {
+		t.Errorf("Error processing template: %v", err)
+	}
+
+	expected := TestSpec{
+		Containers: []TestContainer{
+			{
+				Command: []string{"echo", "This is a string"},
+				Env: []TestEnv{
+					{Name: "KEY", Value: "foo"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(input, expected) {
+		t.Errorf("Unexpected template result - expected '%v', got '%v'", expected, input)
+	}
+}
+
+// check templating of slices of interfaces, like the lists inside the extra variables of AWX jobs:
+func testProcessInterfaceSliceInput(t *testing.T, template *ObjectTemplate, params TemplateTestData) {
+	input := map[string]interface{}{
+		"hosts": []interface{}{
+			"str=[ $str ]",
+			map[string]interface{}{
+				"name": "[ $struct.StructKey ]",
+			},
+			42,
+		},
+	}
+	err := template.Process(&input, params)
+	if err != nil {
+		t.Errorf("Error processing template: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"hosts": []interface{}{
+			"str=This is a string",
+			map[string]interface{}{
+				"name": "foo",
+			},
+			42,
+		},
+	}
+	if !reflect.DeepEqual(input, expected) {
+		t.Errorf("Unexpected template result - expected '%v', got '%v'", expected, input)
+	}
+}
+
+func TestProcessString(t *testing.T) {
+	template, err := NewObjectTemplateBuilder().
+		Delimiters("[", "]").
+		Variable("map", ".Map").
+		Variable("str", ".Str").
+		Build()
+	if err != nil {
+		t.Fatalf("Error building ObjectTemplate: %v", err)
+	}
+	params := TemplateTestData{
+		Map: map[string]string{"mapkey": "mapvalue"},
+		Str: "This is a string",
+	}
+
+	result, err := template.ProcessString("[ $str ] and [ $map.mapkey ]", params)
+	if err != nil {
+		t.Fatalf("Error processing template: %v", err)
+	}
+	if result != "This is a string and mapvalue" {
+		t.Errorf("Expected 'This is a string and mapvalue', but got '%s'", result)
+	}
+}
+
+func TestProcessStringWithSyntaxError(t *testing.T) {
+	template, err := NewObjectTemplateBuilder().
+		Build()
+	if err != nil {
+		t.Fatalf("Error building ObjectTemplate: %v", err)
+	}
+
+	_, err = template.ProcessString("{{ .Labels.node ", &alertmanager.Alert{})
+	if err == nil {
+		t.Errorf("Expected an error for a template that can't be parsed")
+	}
+}
+
+func TestAlertAgeFunctions(t *testing.T) {
+	template, err := NewObjectTemplateBuilder().
+		Build()
+	if err != nil {
+		t.Fatalf("Error building ObjectTemplate: %v", err)
+	}
+	alert := &alertmanager.Alert{
+		StartsAt: time.Now().Add(-90 * time.Second),
+	}
+
+	// The age should be formatted as a duration, rounded to seconds:
+	input := "{{ alertAge }}"
+	err = template.Process(&input, alert)
+	if err != nil {
+		t.Fatalf("Error processing template: %v", err)
+	}
+	if input != "1m30s" && input != "1m31s" {
+		t.Errorf("Expected age '1m30s', but got '%s'", input)
+	}
+
+	// The age in seconds should be a number close to 90:
+	input = "{{ alertAgeSeconds }}"
+	err = template.Process(&input, alert)
+	if err != nil {
+		t.Fatalf("Error processing template: %v", err)
+	}
+	seconds, err := strconv.ParseFloat(input, 64)
+	if err != nil {
+		t.Fatalf("Expected a number, but got '%s'", input)
+	}
+	if seconds < 90 || seconds > 91 {
+		t.Errorf("Expected age close to 90 seconds, but got %f", seconds)
+	}
+}
+
+func TestAlertAgeFunctionsWithoutAlert(t *testing.T) {
+	template, err := NewObjectTemplateBuilder().
+		Build()
+	if err != nil {
+		t.Fatalf("Error building ObjectTemplate: %v", err)
+	}
+
+	// The template can't be evaluated, so the text should be kept:
+	input := "{{ alertAge }}"
+	err = template.Process(&input, TemplateTestData{})
+	if err != nil {
+		t.Fatalf("Error processing template: %v", err)
+	}
+	if input != "{{ alertAge }}" {
+		t.Errorf("Expected text to be kept, but got '%s'", input)
+	}
+}
+
+func TestSprigFunctions(t *testing.T) {
+	template, err := NewObjectTemplateBuilder().
+		Variable("labels", ".Labels").
+		Build()
+	if err != nil {
+		t.Fatalf("Error building ObjectTemplate: %v", err)
+	}
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"instance": "Node0.example.com",
+			"service":  "kube-apiserver",
+		},
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "{{ $labels.instance | lower }}",
+			expected: "node0.example.com",
+		},
+		{
+			input:    "{{ $labels.service | upper }}",
+			expected: "KUBE-APISERVER",
+		},
+		{
+			input:    `{{ $labels.service | trimPrefix "kube-" }}`,
+			expected: "apiserver",
+		},
+	}
+	for _, test := range tests {
+		input := test.input
+		err = template.Process(&input, alert)
+		if err != nil {
+			t.Fatalf("Error processing template '%s': %v", test.input, err)
+		}
+		if input != test.expected {
+			t.Errorf("Expected '%s' for template '%s', but got '%s'", test.expected, test.input, input)
+		}
+	}
+}
+
+func TestSprigNowFunction(t *testing.T) {
+	template, err := NewObjectTemplateBuilder().
+		Build()
+	if err != nil {
+		t.Fatalf("Error building ObjectTemplate: %v", err)
+	}
+	input := `{{ now | date "2006-01-02" }}`
+	before := time.Now().Format("2006-01-02")
+	err = template.Process(&input, &alertmanager.Alert{})
+	if err != nil {
+		t.Fatalf("Error processing template: %v", err)
+	}
+	after := time.Now().Format("2006-01-02")
+	if input != before && input != after {
+		t.Errorf("Expected today's date '%s', but got '%s'", before, input)
+	}
+}
+
+func TestSprigEnvFunctionsNotAvailable(t *testing.T) {
+	template, err := NewObjectTemplateBuilder().
+		Build()
+	if err != nil {
+		t.Fatalf("Error building ObjectTemplate: %v", err)
+	}
+
+	// The template can't be parsed, so the text should be kept:
+	input := `{{ env "HOME" }}`
+	err = template.Process(&input, &alertmanager.Alert{})
+	if err != nil {
+		t.Fatalf("Error processing template: %v", err)
+	}
+	if input != `{{ env "HOME" }}` {
+		t.Errorf("Expected text to be kept, but got '%s'", input)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to compile and cache the regular expressions used by the
+// healing rules to match the labels, annotations, namespaces and generator URLs of the alerts.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// compilePattern returns the compiled version of the given regular expression. Patterns are
+// compiled the first time that they are used and then saved in the cache, so that they aren't
+// compiled again for every alert.
+//
+func (h *Healer) compilePattern(pattern string) (*regexp.Regexp, error) {
+	value, ok := h.patternsCache.Load(pattern)
+	if ok {
+		return value.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	h.patternsCache.Store(pattern, compiled)
+	return compiled, nil
+}
+
+// SeverityLabel is the name of the label of the alerts that is checked against the severities of
+// the healing rules.
+//
+const SeverityLabel = "severity"
+
+// severityPattern returns the regular expression that matches exactly any of the given severities,
+// for example '^(critical|warning)$'.
+//
+func severityPattern(severities []string) string {
+	quoted := make([]string, len(severities))
+	for i, severity := range severities {
+		quoted[i] = regexp.QuoteMeta(severity)
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+// matchPattern checks if the given value matches the given regular expression.
+//
+func (h *Healer) matchPattern(pattern, value string) (bool, error) {
+	compiled, err := h.compilePattern(pattern)
+	if err != nil {
+		return false, err
+	}
+	return compiled.MatchString(value), nil
+}
+
+// checkRulePatterns checks that all the regular expressions used by the given rule are valid. It
+// returns an error describing the first one that isn't.
+//
+func (h *Healer) checkRulePatterns(rule *autoheal.HealingRule) error {
+	err := h.checkPatternsMap(rule, "label", rule.Labels)
+	if err != nil {
+		return err
+	}
+	err = h.checkPatternsMap(rule, "annotation", rule.Annotations)
+	if err != nil {
+		return err
+	}
+	if rule.Namespace != "" {
+		_, err = h.compilePattern(rule.Namespace)
+		if err != nil {
+			return fmt.Errorf(
+				"Namespace pattern '%s' of rule '%s' isn't a valid regular expression: %s",
+				rule.Namespace,
+				rule.ObjectMeta.Name,
+				err,
+			)
+		}
+	}
+	if rule.GeneratorURLPattern != "" {
+		_, err = h.compilePattern(rule.GeneratorURLPattern)
+		if err != nil {
+			return fmt.Errorf(
+				"Generator URL pattern '%s' of rule '%s' isn't a valid regular expression: %s",
+				rule.GeneratorURLPattern,
+				rule.ObjectMeta.Name,
+				err,
+			)
+		}
+	}
+	return nil
+}
+
+func (h *Healer) checkPatternsMap(rule *autoheal.HealingRule, kind string, patterns map[string]string) error {
+	for key, pattern := range patterns {
+		_, err := h.compilePattern(pattern)
+		if err != nil {
+			return fmt.Errorf(
+				"Pattern '%s' for %s '%s' of rule '%s' isn't a valid regular expression: %s",
+				pattern,
+				kind,
+				key,
+				rule.ObjectMeta.Name,
+				err,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestCompilePatternIsCached(t *testing.T) {
+	healer := makeHealer(t, "empty")
+
+	first, err := healer.compilePattern("^Node.*$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := healer.compilePattern("^Node.*$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("Expected the compiled pattern to be reused")
+	}
+}
+
+func TestCheckRulePatternsRejectsInvalidGeneratorURLPattern(t *testing.T) {
+	healer := makeHealer(t, "empty")
+
+	err := healer.checkRulePatterns(&autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "my-rule",
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		GeneratorURLPattern: "https://(cluster-a",
+	})
+	if err == nil {
+		t.Errorf("Expected an error for an invalid generator URL pattern")
+	}
+}
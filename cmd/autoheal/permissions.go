@@ -0,0 +1,117 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/glog"
+	authorization "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// permission describes one of the permissions that the service account of the auto-heal service
+// needs in order to work correctly. The name is optional, and restricts the permission to the
+// object with that name.
+//
+type permission struct {
+	verb        string
+	group       string
+	resource    string
+	subresource string
+	name        string
+}
+
+// String generates a human readable representation of the permission, for use in log messages.
+//
+func (p permission) String() string {
+	resource := p.resource
+	if p.group != "" {
+		resource = fmt.Sprintf("%s.%s", resource, p.group)
+	}
+	if p.subresource != "" {
+		resource = fmt.Sprintf("%s/%s", resource, p.subresource)
+	}
+	if p.name != "" {
+		resource = fmt.Sprintf("%s '%s'", resource, p.name)
+	}
+	return fmt.Sprintf("%s %s", p.verb, resource)
+}
+
+// requiredPermissions is the list of permissions that are checked when the server starts.
+//
+var requiredPermissions = []permission{
+	{verb: "create", group: "batch", resource: "jobs"},
+	{verb: "patch", group: autoheal.GroupName, resource: "healingrules", subresource: "status"},
+	{verb: "create", resource: "events"},
+	{verb: "get", resource: "secrets", name: "autoheal-config"},
+}
+
+// namespaceFile is the file where Kubernetes writes the namespace of the service account of the
+// pod.
+//
+const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// currentNamespace returns the namespace where the server is running, or an empty string if it
+// isn't running inside a pod.
+//
+func currentNamespace() string {
+	data, err := ioutil.ReadFile(namespaceFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// verifyPermissions checks, using self subject access reviews, that the service account that the
+// server is using has all the permissions that it needs in the given namespace. If the namespace
+// is empty the permissions are checked for all the namespaces. It returns the list of permissions
+// that are missing.
+//
+func verifyPermissions(client kubernetes.Interface, namespace string) (missing []string, err error) {
+	reviews := client.AuthorizationV1().SelfSubjectAccessReviews()
+	for _, required := range requiredPermissions {
+		review := &authorization.SelfSubjectAccessReview{
+			Spec: authorization.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorization.ResourceAttributes{
+					Namespace:   namespace,
+					Verb:        required.verb,
+					Group:       required.group,
+					Resource:    required.resource,
+					Subresource: required.subresource,
+					Name:        required.name,
+				},
+			},
+		}
+		review, err = reviews.Create(review)
+		if err != nil {
+			err = fmt.Errorf("Can't check permission '%s': %s", required, err)
+			return
+		}
+		if review.Status.Allowed {
+			glog.Infof("Permission '%s' is granted", required)
+		} else {
+			glog.Errorf("Permission '%s' isn't granted: %s", required, review.Status.Reason)
+			missing = append(missing, required.String())
+		}
+	}
+	return
+}
@@ -0,0 +1,149 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	authorization "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+func TestVerifyPermissionsAllGranted(t *testing.T) {
+	client := makeAuthorizationClient(nil, nil)
+	missing, err := verifyPermissions(client, "my-namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("Expected no missing permissions, but got %v", missing)
+	}
+}
+
+func TestVerifyPermissionsSomeMissing(t *testing.T) {
+	client := makeAuthorizationClient([]string{"jobs", "secrets"}, nil)
+	missing, err := verifyPermissions(client, "my-namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create jobs.batch",
+		"get secrets 'autoheal-config'",
+	}
+	if !reflect.DeepEqual(expected, missing) {
+		t.Errorf("Expected missing permissions %v, but got %v", expected, missing)
+	}
+}
+
+func TestVerifyPermissionsChecksSecretName(t *testing.T) {
+	client := makeAuthorizationClient(nil, nil)
+	_, err := verifyPermissions(client, "my-namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, review := range client.(*fakeAuthorizationClient).reviews.created {
+		if review.Spec.ResourceAttributes.Resource == "secrets" {
+			names = append(names, review.Spec.ResourceAttributes.Name)
+		}
+	}
+	expected := []string{"autoheal-config"}
+	if !reflect.DeepEqual(expected, names) {
+		t.Errorf("Expected the secrets permission to be checked for %v, but got %v", expected, names)
+	}
+}
+
+func TestVerifyPermissionsError(t *testing.T) {
+	client := makeAuthorizationClient(nil, fmt.Errorf("Connection refused"))
+	_, err := verifyPermissions(client, "my-namespace")
+	if err == nil {
+		t.Errorf("Expected an error when the review fails, but got nil")
+	}
+}
+
+func TestPermissionString(t *testing.T) {
+	p := permission{
+		verb:        "patch",
+		group:       "autoheal.openshift.io",
+		resource:    "healingrules",
+		subresource: "status",
+	}
+	expected := "patch healingrules.autoheal.openshift.io/status"
+	if p.String() != expected {
+		t.Errorf("Expected '%s', but got '%s'", expected, p.String())
+	}
+}
+
+// makeAuthorizationClient creates a fake Kubernetes client that denies the given resources, and
+// allows everything else. If an error is given, all the reviews will fail with that error.
+//
+func makeAuthorizationClient(denied []string, err error) kubernetes.Interface {
+	return &fakeAuthorizationClient{
+		reviews: &fakeSelfSubjectAccessReviews{
+			denied: denied,
+			err:    err,
+		},
+	}
+}
+
+type fakeAuthorizationClient struct {
+	kubernetes.Interface
+	reviews *fakeSelfSubjectAccessReviews
+}
+
+func (c *fakeAuthorizationClient) AuthorizationV1() authorizationv1.AuthorizationV1Interface {
+	return &fakeAuthorizationV1{
+		reviews: c.reviews,
+	}
+}
+
+type fakeAuthorizationV1 struct {
+	authorizationv1.AuthorizationV1Interface
+	reviews *fakeSelfSubjectAccessReviews
+}
+
+func (c *fakeAuthorizationV1) SelfSubjectAccessReviews() authorizationv1.SelfSubjectAccessReviewInterface {
+	return c.reviews
+}
+
+type fakeSelfSubjectAccessReviews struct {
+	authorizationv1.SelfSubjectAccessReviewInterface
+	denied  []string
+	err     error
+	created []*authorization.SelfSubjectAccessReview
+}
+
+func (r *fakeSelfSubjectAccessReviews) Create(
+	review *authorization.SelfSubjectAccessReview,
+) (*authorization.SelfSubjectAccessReview, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.created = append(r.created, review)
+	result := review.DeepCopy()
+	result.Status.Allowed = true
+	for _, resource := range r.denied {
+		if resource == review.Spec.ResourceAttributes.Resource {
+			result.Status.Allowed = false
+			result.Status.Reason = "Denied by test"
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// jitterRateLimiter is a rate limiter that adds a random amount of time to the delays calculated
+// by another rate limiter, so that items that fail at the same time, for example because the AWX
+// server is down, aren't all retried at the same time when it recovers.
+//
+type jitterRateLimiter struct {
+	workqueue.RateLimiter
+
+	// The maximum fraction of the delay that will be added, between zero and one.
+	factor float64
+
+	// The random number generator isn't safe for concurrent use, so it needs a mutex.
+	random *rand.Rand
+	mutex  *sync.Mutex
+}
+
+// newJitterRateLimiter creates a rate limiter that adds to the delays calculated by the given rate
+// limiter a random amount of time, up to the given fraction of the delay.
+//
+func newJitterRateLimiter(limiter workqueue.RateLimiter, factor float64, seed int64) *jitterRateLimiter {
+	return &jitterRateLimiter{
+		RateLimiter: limiter,
+		factor:      factor,
+		random:      rand.New(rand.NewSource(seed)),
+		mutex:       &sync.Mutex{},
+	}
+}
+
+// When returns the delay calculated by the wrapped rate limiter, plus the random jitter.
+//
+func (l *jitterRateLimiter) When(item interface{}) time.Duration {
+	delay := l.RateLimiter.When(item)
+	if l.factor == 0 {
+		return delay
+	}
+	l.mutex.Lock()
+	random := l.random.Float64()
+	l.mutex.Unlock()
+	return delay + time.Duration(float64(delay)*l.factor*random)
+}
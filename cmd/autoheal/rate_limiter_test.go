@@ -0,0 +1,89 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestJitterRateLimiterAddsVariance(t *testing.T) {
+	base := 100 * time.Millisecond
+	limiter := newJitterRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(base, time.Minute),
+		0.2,
+		42,
+	)
+
+	// Calculate the first delay of many different items, all of them would have the same delay
+	// without the jitter:
+	count := 1000
+	var sum, sumSquares float64
+	for i := 0; i < count; i++ {
+		delay := limiter.When(i)
+		if delay < base || delay > base+base/5 {
+			t.Fatalf("Expected delay between %s and %s, but got %s", base, base+base/5, delay)
+		}
+		value := float64(delay - base)
+		sum += value
+		sumSquares += value * value
+	}
+	mean := sum / float64(count)
+	variance := sumSquares/float64(count) - mean*mean
+
+	// The jitter is uniform between zero and 20 ms, so the mean should be close to 10 ms and the
+	// standard deviation close to 20 / sqrt(12), about 5.8 ms:
+	if mean < float64(8*time.Millisecond) || mean > float64(12*time.Millisecond) {
+		t.Errorf("Expected mean jitter close to 10ms, but it is %s", time.Duration(mean))
+	}
+	minVariance := float64(4*time.Millisecond) * float64(4*time.Millisecond)
+	if variance < minVariance {
+		t.Errorf("Expected jitter variance of at least %g, but it is %g", minVariance, variance)
+	}
+}
+
+func TestJitterRateLimiterDisabled(t *testing.T) {
+	base := 100 * time.Millisecond
+	limiter := newJitterRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(base, time.Minute),
+		0,
+		42,
+	)
+	for i := 0; i < 10; i++ {
+		delay := limiter.When(i)
+		if delay != base {
+			t.Errorf("Expected delay %s without jitter, but got %s", base, delay)
+		}
+	}
+}
+
+func TestBuildRejectsInvalidJitterFactor(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	for _, factor := range []float64{-0.1, 1.5} {
+		_, err := NewHealerBuilder().
+			ConfigFile(file).
+			MinimumRunnersRequired(0).
+			RetryJitterFactor(factor).
+			Build()
+		if err == nil {
+			t.Errorf("Expected an error for jitter factor %g", factor)
+		}
+	}
+}
@@ -27,4 +27,8 @@ import (
 type RuleChange struct {
 	Type watch.EventType
 	Rule *autoheal.HealingRule
+
+	// CRD indicates that the rule comes from a HealingRule object of the Kubernetes API instead of
+	// from the configuration.
+	CRD bool
 }
@@ -0,0 +1,159 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+var (
+	rulesConfigFiles []string
+	rulesOutput      string
+)
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Inspects the healing rules",
+	Long:  "Inspects the healing rules defined in the configuration files.",
+}
+
+var rulesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the healing rules",
+	Long:  "Lists the healing rules defined in the configuration files.",
+	Run:   rulesListRun,
+}
+
+func init() {
+	rulesCmd.AddCommand(rulesListCmd)
+	rulesListFlags := rulesListCmd.Flags()
+	rulesListFlags.StringSliceVar(
+		&rulesConfigFiles,
+		"config-file",
+		[]string{"autoheal.yml"},
+		"The location of the configuration file. Can be used multiple times to specify "+
+			"multiple configuration files or directories, like in the server command.",
+	)
+	rulesListFlags.StringVarP(
+		&rulesOutput,
+		"output",
+		"o",
+		"table",
+		"The output format, one of 'table', 'json' or 'yaml'.",
+	)
+}
+
+// ruleSummary contains the details of a rule that are displayed by the list command.
+//
+type ruleSummary struct {
+	Name             string `json:"name" yaml:"name"`
+	ActionType       string `json:"actionType" yaml:"actionType"`
+	ThrottleInterval string `json:"throttleInterval" yaml:"throttleInterval"`
+}
+
+func rulesListRun(cmd *cobra.Command, args []string) {
+	cfg, err := config.NewBuilder().
+		Files(rulesConfigFiles).
+		Build()
+	if err != nil {
+		glog.Fatalf("Error loading configuration: %s", err)
+	}
+	defer cfg.ShutDown()
+
+	summaries := summarizeRules(cfg)
+	err = writeRules(os.Stdout, summaries, rulesOutput)
+	if err != nil {
+		glog.Fatalf("Error writing rules: %s", err)
+	}
+}
+
+// summarizeRules extracts from the configuration the details of the rules that are displayed by
+// the list command.
+//
+func summarizeRules(cfg *config.Config) []ruleSummary {
+	interval := cfg.Throttling().Interval().String()
+	summaries := make([]ruleSummary, 0, len(cfg.Rules()))
+	for _, rule := range cfg.Rules() {
+		summaries = append(summaries, ruleSummary{
+			Name:             rule.ObjectMeta.Name,
+			ActionType:       ruleActionType(rule),
+			ThrottleInterval: interval,
+		})
+	}
+	return summaries
+}
+
+// ruleActionType returns the name of the type of action of the rule, as used in the configuration
+// file, or an empty string if the rule has no action.
+//
+func ruleActionType(rule *autoheal.HealingRule) string {
+	switch {
+	case rule.AWXJob != nil:
+		return "awxJob"
+	case rule.WorkflowJob != nil:
+		return "workflowJob"
+	case rule.BatchJob != nil:
+		return "batchJob"
+	case rule.Plugin != nil:
+		return "plugin"
+	case rule.WebhookJob != nil:
+		return "webhookJob"
+	case rule.SlackJob != nil:
+		return "slackJob"
+	}
+	return ""
+}
+
+// writeRules writes the given rule summaries to the given writer, using the given output format.
+//
+func writeRules(writer io.Writer, summaries []ruleSummary, output string) error {
+	switch output {
+	case "table":
+		table := tabwriter.NewWriter(writer, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(table, "NAME\tACTION TYPE\tTHROTTLE INTERVAL\n")
+		for _, summary := range summaries {
+			fmt.Fprintf(table, "%s\t%s\t%s\n", summary.Name, summary.ActionType, summary.ThrottleInterval)
+		}
+		return table.Flush()
+	case "json":
+		data, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(writer, "%s\n", data)
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(summaries)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(data)
+		return err
+	}
+	return fmt.Errorf("Output format '%s' isn't valid, it must be 'table', 'json' or 'yaml'", output)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the handler of the endpoint that returns the healing rules that are currently
+// loaded in the cache, and that enables or disables them.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/apis/autoheal/v1alpha2"
+	"github.com/openshift/autoheal/pkg/receiver"
+)
+
+// loadedRule is an item of the response of the /rules endpoint. It contains the rule, in the same
+// format used in the configuration files, and the last time that it matched an alert, if it has
+// matched any since the healer was started.
+//
+type loadedRule struct {
+	*v1alpha2.HealingRule
+	LastMatched *time.Time `json:"lastMatched,omitempty"`
+}
+
+// rulePatch is the body of the requests that modify a loaded rule.
+//
+type rulePatch struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// rulesHandler creates the handler for the /rules endpoint, and for the /rules/{name} endpoints of
+// the individual rules. It requires the admin token, as the rules may contain sensitive details,
+// like the parameters of the actions.
+//
+func (h *Healer) rulesHandler() http.Handler {
+	return receiver.NewMiddlewareChain(
+		receiver.LoggingMiddleware,
+		receiver.AuthMiddleware(h.managementToken()),
+	).Then(http.HandlerFunc(h.handleRulesRequest))
+}
+
+// managementToken returns the bearer token required by the endpoints that inspect or change the
+// state of the healer. It is the admin token if it has been set, and the alerts token otherwise.
+//
+func (h *Healer) managementToken() string {
+	if h.adminToken != "" {
+		return h.adminToken
+	}
+	return h.alertsToken
+}
+
+// handleRulesRequest sends the requests for the list of rules and for the individual rules to the
+// corresponding handlers.
+//
+func (h *Healer) handleRulesRequest(response http.ResponseWriter, request *http.Request) {
+	name := strings.TrimPrefix(request.URL.Path, "/rules")
+	name = strings.TrimPrefix(name, "/")
+	switch {
+	case name == "" && request.Method == http.MethodGet:
+		h.handleRulesList(response, request)
+	case name != "" && request.Method == http.MethodPatch:
+		h.handleRulePatch(response, request, name)
+	default:
+		http.Error(
+			response,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+	}
+}
+
+// handleRulesList returns the rules that are currently loaded, sorted by name.
+//
+func (h *Healer) handleRulesList(response http.ResponseWriter, request *http.Request) {
+	// Collect the rules:
+	rules := make([]*loadedRule, 0)
+	h.rulesCache.Range(func(_, value interface{}) bool {
+		rule := value.(*autoheal.HealingRule)
+		item, err := h.loadedRule(rule)
+		if err != nil {
+			glog.Errorf("Can't convert rule '%s': %s", rule.ObjectMeta.Name, err)
+			return true
+		}
+		rules = append(rules, item)
+		return true
+	})
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ObjectMeta.Name < rules[j].ObjectMeta.Name
+	})
+
+	// Write the response body:
+	writeRulesResponse(response, rules)
+}
+
+// handleRulePatch changes the rule with the given name. Currently only the enabled field can be
+// changed. The change is applied only to the copy of the rule loaded in the cache, so it is lost
+// when the rule is changed in the configuration or when the healer is restarted.
+//
+func (h *Healer) handleRulePatch(response http.ResponseWriter, request *http.Request, name string) {
+	// Read and parse the request body:
+	body, ok := h.readRequestBody(response, request)
+	if !ok {
+		return
+	}
+	var patch rulePatch
+	err := json.Unmarshal(body, &patch)
+	if err != nil {
+		http.Error(response, fmt.Sprintf("Can't parse request body: %s", err), http.StatusBadRequest)
+		return
+	}
+	if patch.Enabled == nil {
+		http.Error(response, "The 'enabled' field is mandatory", http.StatusBadRequest)
+		return
+	}
+
+	// Replace the rule in the cache with a modified copy, so that the alert workers that are
+	// using the current one don't see a partial change:
+	value, ok := h.rulesCache.Load(name)
+	if !ok {
+		http.Error(response, fmt.Sprintf("Rule '%s' doesn't exist", name), http.StatusNotFound)
+		return
+	}
+	rule := value.(*autoheal.HealingRule).DeepCopy()
+	enabled := *patch.Enabled
+	rule.Enabled = &enabled
+	h.rulesCache.Store(name, rule)
+	if enabled {
+		glog.Infof("Rule '%s' has been enabled", name)
+	} else {
+		glog.Infof("Rule '%s' has been disabled", name)
+	}
+
+	// Return the modified rule:
+	item, err := h.loadedRule(rule)
+	if err != nil {
+		glog.Errorf("Can't convert rule '%s': %s", name, err)
+		http.Error(
+			response,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	writeRulesResponse(response, item)
+}
+
+// loadedRule converts the given rule to the external format, as the internal one doesn't have JSON
+// names for the fields, and adds the last time that it matched an alert.
+//
+func (h *Healer) loadedRule(rule *autoheal.HealingRule) (item *loadedRule, err error) {
+	converted := new(v1alpha2.HealingRule)
+	err = v1alpha2.Convert_autoheal_HealingRule_To_v1alpha2_HealingRule(rule, converted, nil)
+	if err != nil {
+		return
+	}
+	item = &loadedRule{
+		HealingRule: converted,
+	}
+	matched, ok := h.ruleMatches.Load(rule.ObjectMeta.Name)
+	if ok {
+		lastMatched := matched.(time.Time)
+		item.LastMatched = &lastMatched
+	}
+	return
+}
+
+// writeRulesResponse writes the given rule, or list of rules, as the JSON body of the response.
+//
+func writeRulesResponse(response http.ResponseWriter, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		glog.Errorf("Can't generate rules response body: %s", err)
+		http.Error(
+			response,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
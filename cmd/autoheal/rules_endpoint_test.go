@@ -0,0 +1,288 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/receiver"
+)
+
+func TestRulesEndpointReturnsLoadedRules(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	healer.rulesCache.Store("restart-pod", &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "restart-pod",
+		},
+		Namespace: "^production-",
+		Labels: map[string]string{
+			"alertname": "PodDown",
+		},
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/rules", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleRulesRequest(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d", recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected content type 'application/json', but got '%s'", contentType)
+	}
+	var rules []map[string]interface{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, but got %d", len(rules))
+	}
+
+	// The rules are sorted by name, and use the same field names than the configuration files:
+	first := rules[0]
+	if first["metadata"].(map[string]interface{})["name"] != "restart-pod" {
+		t.Errorf("Expected first rule 'restart-pod', but got %v", first["metadata"])
+	}
+	if first["namespace"] != "^production-" {
+		t.Errorf("Expected namespace pattern '^production-', but got %v", first["namespace"])
+	}
+	second := rules[1]
+	if second["awxJob"].(map[string]interface{})["template"] != "Start node" {
+		t.Errorf("Expected AWX template 'Start node', but got %v", second["awxJob"])
+	}
+	if _, ok := second["lastMatched"]; ok {
+		t.Errorf("Expected no last matched time for a rule that hasn't matched any alert")
+	}
+}
+
+func TestRulesEndpointReturnsLastMatched(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	alert := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+			"instance":  "node0",
+		},
+	}
+	// There is no AWX runner, so the action fails, but the rule has still matched:
+	healer.startHealing(alert, receiver.NewHistoryEntry(alert))
+
+	request := httptest.NewRequest(http.MethodGet, "/rules", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleRulesRequest(recorder, request)
+	var rules []*loadedRule
+	err := json.Unmarshal(recorder.Body.Bytes(), &rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("Expected 1 rule, but got %d", len(rules))
+	}
+	if rules[0].LastMatched == nil {
+		t.Errorf("Expected the rule to have a last matched time")
+	}
+}
+
+func TestRulesEndpointRejectsOtherMethods(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+
+	request := httptest.NewRequest(http.MethodPost, "/rules", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleRulesRequest(recorder, request)
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected status 405, but got %d", recorder.Code)
+	}
+}
+
+func TestRulesEndpointPatchTogglesRule(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	defer healer.config.ShutDown()
+	alert := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+			"instance":  "node0",
+		},
+	}
+
+	// Disable the rule:
+	recorder := patchRule(healer, "start-node", `{"enabled": false}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var rule loadedRule
+	err := json.Unmarshal(recorder.Body.Bytes(), &rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Enabled == nil || *rule.Enabled {
+		t.Errorf("Expected the returned rule to be disabled, but got %v", rule.Enabled)
+	}
+	if len(healer.matchRules(alert)) != 0 {
+		t.Errorf("Expected the disabled rule to not match the alert")
+	}
+
+	// Enable it again:
+	recorder = patchRule(healer, "start-node", `{"enabled": true}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if len(healer.matchRules(alert)) != 1 {
+		t.Errorf("Expected the enabled rule to match the alert")
+	}
+}
+
+func TestRulesEndpointPatchRejectsUnknownRule(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	defer healer.config.ShutDown()
+
+	recorder := patchRule(healer, "junk", `{"enabled": false}`)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, but got %d", recorder.Code)
+	}
+}
+
+func TestRulesEndpointPatchRejectsInvalidBody(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	defer healer.config.ShutDown()
+
+	for _, body := range []string{`junk`, `{}`} {
+		recorder := patchRule(healer, "start-node", body)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for body '%s', but got %d", body, recorder.Code)
+		}
+	}
+	value, _ := healer.rulesCache.Load("start-node")
+	if !ruleEnabled(value.(*autoheal.HealingRule)) {
+		t.Errorf("Expected the rule to still be enabled")
+	}
+}
+
+func TestRulesEndpointPatchRejectsLargeBody(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	defer healer.config.ShutDown()
+	healer.maxRequestBody = 100
+
+	body := `{"enabled": false}` + strings.Repeat(" ", 100)
+	recorder := patchRule(healer, "start-node", body)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, but got %d", recorder.Code)
+	}
+	value, _ := healer.rulesCache.Load("start-node")
+	if !ruleEnabled(value.(*autoheal.HealingRule)) {
+		t.Errorf("Expected the rule to still be enabled")
+	}
+}
+
+func TestManagementEndpointsRequireAdminToken(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		AlertsToken("alerts-token").
+		AdminToken("admin-token").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := healer.serverHandler()
+
+	tests := []struct {
+		method        string
+		path          string
+		authorization string
+		code          int
+	}{
+		{http.MethodGet, "/rules", "", http.StatusUnauthorized},
+		{http.MethodGet, "/rules", "Bearer alerts-token", http.StatusUnauthorized},
+		{http.MethodGet, "/rules", "Bearer admin-token", http.StatusOK},
+		{http.MethodPatch, "/rules/junk", "", http.StatusUnauthorized},
+		{http.MethodPatch, "/rules/junk", "Bearer alerts-token", http.StatusUnauthorized},
+		{http.MethodDelete, "/memory?rule=junk", "", http.StatusUnauthorized},
+		{http.MethodDelete, "/memory?rule=junk", "Bearer alerts-token", http.StatusUnauthorized},
+		{http.MethodDelete, "/memory?rule=junk", "Bearer admin-token", http.StatusNotFound},
+		{http.MethodGet, "/debug/rules", "", http.StatusUnauthorized},
+		{http.MethodGet, "/debug/rules", "Bearer alerts-token", http.StatusUnauthorized},
+		{http.MethodGet, "/debug/rules", "Bearer admin-token", http.StatusOK},
+		{http.MethodGet, "/history", "", http.StatusUnauthorized},
+		{http.MethodGet, "/history", "Bearer alerts-token", http.StatusUnauthorized},
+		{http.MethodGet, "/history", "Bearer admin-token", http.StatusOK},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.path, nil)
+		if test.authorization != "" {
+			request.Header.Set("Authorization", test.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != test.code {
+			t.Errorf(
+				"Expected status %d for %s %s with authorization '%s', but got %d",
+				test.code,
+				test.method,
+				test.path,
+				test.authorization,
+				recorder.Code,
+			)
+		}
+	}
+}
+
+func TestManagementEndpointsUseAlertsTokenWithoutAdminToken(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		AlertsToken("alerts-token").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := healer.serverHandler()
+
+	request := httptest.NewRequest(http.MethodGet, "/rules", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, but got %d", recorder.Code)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/rules", nil)
+	request.Header.Set("Authorization", "Bearer alerts-token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with the alerts token, but got %d", recorder.Code)
+	}
+}
+
+// patchRule sends to the rules endpoint of the given healer a request to patch the given rule, and
+// returns the recorded response.
+//
+func patchRule(healer *Healer, name, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPatch, "/rules/"+name, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	healer.handleRulesRequest(recorder, request)
+	return recorder
+}
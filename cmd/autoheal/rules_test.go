@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+func TestWriteRulesTable(t *testing.T) {
+	actual := writeTestRules(t, "table")
+	expected := "" +
+		"NAME         ACTION TYPE  THROTTLE INTERVAL\n" +
+		"first-rule   awxJob       1h0m0s\n" +
+		"second-rule  awxJob       1h0m0s\n"
+	if actual != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, actual)
+	}
+}
+
+func TestWriteRulesJSON(t *testing.T) {
+	actual := writeTestRules(t, "json")
+	expected := `[
+  {
+    "name": "first-rule",
+    "actionType": "awxJob",
+    "throttleInterval": "1h0m0s"
+  },
+  {
+    "name": "second-rule",
+    "actionType": "awxJob",
+    "throttleInterval": "1h0m0s"
+  }
+]
+`
+	if actual != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, actual)
+	}
+}
+
+func TestWriteRulesYAML(t *testing.T) {
+	actual := writeTestRules(t, "yaml")
+	expected := `- name: first-rule
+  actionType: awxJob
+  throttleInterval: 1h0m0s
+- name: second-rule
+  actionType: awxJob
+  throttleInterval: 1h0m0s
+`
+	if actual != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, actual)
+	}
+}
+
+func TestWriteRulesInvalidOutput(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	err := writeRules(buffer, nil, "xml")
+	if err == nil {
+		t.Errorf("Expected an error for output format 'xml'")
+	}
+}
+
+func writeTestRules(t *testing.T, output string) string {
+	cfg, err := config.NewBuilder().
+		File(filepath.Join("..", "..", "testdata", "rules-config.yml")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	buffer := new(bytes.Buffer)
+	err = writeRules(buffer, summarizeRules(cfg), output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.String()
+}
@@ -18,9 +18,11 @@ package main
 
 import (
 	"github.com/golang/glog"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 
+	"github.com/openshift/autoheal/pkg/alertmanager"
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
 )
 
@@ -65,6 +67,9 @@ func (h *Healer) pickRuleChange() bool {
 }
 
 func (h *Healer) processRuleChange(change *RuleChange) error {
+	if change.CRD {
+		return h.processCRDRuleChange(change)
+	}
 	switch change.Type {
 	case watch.Added:
 		return h.processAddedRule(change.Rule)
@@ -77,25 +82,93 @@ func (h *Healer) processRuleChange(change *RuleChange) error {
 }
 
 func (h *Healer) processAddedRule(rule *autoheal.HealingRule) error {
-	value, ok := h.rulesCache.Load(rule.ObjectMeta.Name)
+	// Reject the rules that contain invalid regular expressions, as they would fail for every
+	// alert. The previous version of the rule, if any, is also removed, as it no longer reflects
+	// the configuration:
+	err := h.checkRulePatterns(rule)
+	if err != nil {
+		glog.Warningf("Rule '%s' will be ignored: %s", rule.ObjectMeta.Name, err)
+		h.rulesCache.Delete(ruleKey(&rule.ObjectMeta))
+		return err
+	}
+
+	// Templates that can't be processed are only reported, as they may depend on data that only
+	// the real alerts have:
+	h.checkRuleTemplates(rule)
+
+	key := ruleKey(&rule.ObjectMeta)
+	value, ok := h.rulesCache.Load(key)
 	if !ok {
-		h.rulesCache.Store(rule.ObjectMeta.Name, rule)
+		h.rulesCache.Store(key, rule)
 		glog.Infof("Rule '%s' was added", rule.ObjectMeta.Name)
 	} else {
 		existing := value.(*autoheal.HealingRule)
 		if rule.ObjectMeta.ResourceVersion != existing.ObjectMeta.ResourceVersion {
-			h.rulesCache.Store(rule.ObjectMeta.Name, rule)
+			h.rulesCache.Store(key, rule)
 			glog.Infof("Rule '%s' was updated", rule.ObjectMeta.Name)
 		}
 	}
 	return nil
 }
 
+// checkRuleTemplates processes the templates inside the extra variables of the AWX job of the given
+// rule with an empty alert, and writes a warning to the log for each one that fails, so that syntax
+// errors are detected when the rule is loaded instead of when an alert fires.
+//
+func (h *Healer) checkRuleTemplates(rule *autoheal.HealingRule) {
+	if rule.AWXJob == nil || rule.AWXJob.ExtraVars == nil {
+		return
+	}
+	template, err := newAlertTemplate()
+	if err != nil {
+		glog.Warningf("Can't check the templates of rule '%s': %s", rule.ObjectMeta.Name, err)
+		return
+	}
+	var check func(value interface{})
+	check = func(value interface{}) {
+		switch typed := value.(type) {
+		case string:
+			_, err := template.ProcessString(typed, &alertmanager.Alert{})
+			if err != nil {
+				glog.Warningf(
+					"Extra variable '%s' of rule '%s' may fail when processed: %s",
+					typed,
+					rule.ObjectMeta.Name,
+					err,
+				)
+			}
+		case map[string]interface{}:
+			for _, item := range typed {
+				check(item)
+			}
+		case []interface{}:
+			for _, item := range typed {
+				check(item)
+			}
+		}
+	}
+	check(map[string]interface{}(rule.AWXJob.ExtraVars))
+}
+
 func (h *Healer) processDeletedRule(rule *autoheal.HealingRule) error {
-	_, ok := h.rulesCache.Load(rule.ObjectMeta.Name)
+	key := ruleKey(&rule.ObjectMeta)
+	_, ok := h.rulesCache.Load(key)
 	if ok {
-		h.rulesCache.Delete(rule.ObjectMeta.Name)
+		h.rulesCache.Delete(key)
+		h.ruleMemories.Delete(key)
 		glog.Infof("Rule '%s' was deleted", rule.ObjectMeta.Name)
 	}
 	return nil
 }
+
+// ruleKey returns the key used to store the rule with the given metadata in the rules cache and in
+// the memories of the rules. It is the name for the rules of the configuration, and the namespace
+// and the name, separated by a slash, for the rules loaded from the Kubernetes API, as rules with
+// the same name can exist in different namespaces.
+//
+func ruleKey(meta *meta.ObjectMeta) string {
+	if meta.Namespace == "" {
+		return meta.Name
+	}
+	return meta.Namespace + "/" + meta.Name
+}
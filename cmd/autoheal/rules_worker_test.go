@@ -17,18 +17,25 @@ limitations under the License.
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/workqueue"
 )
 
 func TestPickRuleChange(t *testing.T) {
 	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
 	healer, err := NewHealerBuilder().
 		ConfigFile(file).
+		MinimumRunnersRequired(0).
 		Build()
 
 	if err != nil {
@@ -61,6 +68,7 @@ func TestProcessAddRuleChange(t *testing.T) {
 	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
 	healer, err := NewHealerBuilder().
 		ConfigFile(file).
+		MinimumRunnersRequired(0).
 		Build()
 
 	if err != nil {
@@ -89,10 +97,131 @@ func TestProcessAddRuleChange(t *testing.T) {
 	}
 }
 
+func TestProcessAddRuleChangeWithInvalidLabelPattern(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatalf("Error building healer: %s", err)
+	}
+
+	change := &RuleChange{
+		Type: watch.Added,
+		Rule: &autoheal.HealingRule{
+			ObjectMeta: meta.ObjectMeta{
+				Name: "test-rule",
+			},
+			Labels: map[string]string{
+				"mylabel": "my(value",
+			},
+			AWXJob: &autoheal.AWXJobAction{
+				Template: "test_template",
+			},
+		},
+	}
+
+	err = healer.processRuleChange(change)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid label pattern")
+	} else if !strings.Contains(err.Error(), "mylabel") {
+		t.Errorf("Expected the error to mention the label, but got '%s'", err)
+	}
+	_, ok := healer.rulesCache.Load(change.Rule.ObjectMeta.Name)
+	if ok {
+		t.Errorf("Expected rule with an invalid pattern to not be added to the cache")
+	}
+}
+
+func TestProcessAddRuleChangeWithInvalidExtraVarsTemplate(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatalf("Error building healer: %s", err)
+	}
+	defer healer.config.ShutDown()
+
+	change := &RuleChange{
+		Type: watch.Added,
+		Rule: &autoheal.HealingRule{
+			ObjectMeta: meta.ObjectMeta{
+				Name: "test-rule",
+			},
+			AWXJob: &autoheal.AWXJobAction{
+				Template: "test_template",
+				ExtraVars: autoheal.JsonDoc{
+					"nodes": []interface{}{
+						"{{ $labels.node ",
+					},
+				},
+			},
+		},
+	}
+
+	// The template is only reported, the rule is still added:
+	err = healer.processRuleChange(change)
+	if err != nil {
+		t.Errorf("Expected no error for an invalid template, but got '%s'", err)
+	}
+	_, ok := healer.rulesCache.Load(change.Rule.ObjectMeta.Name)
+	if !ok {
+		t.Errorf("Expected rule with an invalid template to be added to the cache")
+	}
+}
+
+func TestProcessModifiedRuleChangeWithInvalidAnnotationPattern(t *testing.T) {
+	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatalf("Error building healer: %s", err)
+	}
+
+	original := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name:            "test-rule",
+			ResourceVersion: "a",
+		},
+		Annotations: map[string]string{
+			"summary": "Node .* is down",
+		},
+	}
+	healer.rulesCache.Store("test-rule", original)
+
+	change := &RuleChange{
+		Type: watch.Modified,
+		Rule: &autoheal.HealingRule{
+			ObjectMeta: meta.ObjectMeta{
+				Name:            "test-rule",
+				ResourceVersion: "b",
+			},
+			Annotations: map[string]string{
+				"summary": "Node [ is down",
+			},
+		},
+	}
+
+	err = healer.processRuleChange(change)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid annotation pattern")
+	}
+	_, ok := healer.rulesCache.Load("test-rule")
+	if ok {
+		t.Errorf("Expected rule with an invalid pattern to be removed from the cache")
+	}
+}
+
 func TestProcessDeletedRuleChange(t *testing.T) {
 	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
 	healer, err := NewHealerBuilder().
 		ConfigFile(file).
+		MinimumRunnersRequired(0).
 		Build()
 
 	if err != nil {
@@ -128,6 +257,7 @@ func TestProcessModifiedRuleChange(t *testing.T) {
 	file := filepath.Join("..", "..", "testdata", "empty-config.yml")
 	healer, err := NewHealerBuilder().
 		ConfigFile(file).
+		MinimumRunnersRequired(0).
 		Build()
 
 	if err != nil {
@@ -173,3 +303,126 @@ func TestProcessModifiedRuleChange(t *testing.T) {
 		t.Errorf("Expected rule label to have value %s, instead the value is %s", change.Rule.Labels["myvalue"], original.Labels["myvalue"])
 	}
 }
+
+func TestReloadRulesCacheInSteps(t *testing.T) {
+	file := writeRulesFile(t, 100)
+	defer os.Remove(file)
+
+	// Load the rules in one step:
+	single, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		t.Fatalf("Error building healer: %s", err)
+	}
+	if !single.reloadRulesCache() {
+		t.Fatalf("Expected all the rules to be loaded in one step")
+	}
+	drainRulesQueue(single)
+
+	// Load the rules in steps of at most seven rules:
+	stepped, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		MaxRulesPerReload(7).
+		Build()
+	if err != nil {
+		t.Fatalf("Error building healer: %s", err)
+	}
+	steps := 1
+	for !stepped.reloadRulesCache() {
+		steps++
+	}
+	if steps != 15 {
+		t.Errorf("Expected 15 steps, but got %d", steps)
+	}
+	if stepped.reloadCursor != 0 {
+		t.Errorf("Expected cursor to be reset, but it is %d", stepped.reloadCursor)
+	}
+	drainRulesQueue(stepped)
+
+	// Both caches should contain the same rules:
+	expected := rulesCacheContent(single)
+	actual := rulesCacheContent(stepped)
+	if len(actual) != 100 {
+		t.Errorf("Expected 100 rules, but got %d", len(actual))
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, but got %v", expected, actual)
+	}
+}
+
+func BenchmarkReloadRulesCache(b *testing.B) {
+	// Generate a configuration file with 100 rules:
+	file := writeRulesFile(b, 100)
+	defer os.Remove(file)
+
+	healer, err := NewHealerBuilder().
+		ConfigFile(file).
+		MinimumRunnersRequired(0).
+		Build()
+	if err != nil {
+		b.Fatal(err)
+	}
+	loadRulesCache(healer)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		healer.reloadRulesCache()
+
+		// Replace the queue, so that it doesn't grow during the benchmark:
+		b.StopTimer()
+		healer.rulesQueue.ShutDown()
+		healer.rulesQueue = workqueue.NewNamedRateLimitingQueue(
+			workqueue.DefaultControllerRateLimiter(),
+			"rules",
+		)
+		b.StartTimer()
+	}
+}
+
+// writeRulesFile generates a configuration file with the given number of rules, and returns its
+// name.
+//
+func writeRulesFile(tb testing.TB, count int) string {
+	file, err := ioutil.TempFile("", "rules")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+	fmt.Fprintf(file, "awx:\n")
+	fmt.Fprintf(file, "  address: https://my-awx.example.com/api\n")
+	fmt.Fprintf(file, "  credentials:\n")
+	fmt.Fprintf(file, "    username: my-user\n")
+	fmt.Fprintf(file, "    password: my-password\n")
+	fmt.Fprintf(file, "rules:\n")
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(file, "- metadata:\n")
+		fmt.Fprintf(file, "    name: rule-%d\n", i)
+		fmt.Fprintf(file, "  labels:\n")
+		fmt.Fprintf(file, "    alertname: \"Alert%d\"\n", i)
+		fmt.Fprintf(file, "  awxJob:\n")
+		fmt.Fprintf(file, "    template: \"Template %d\"\n", i)
+	}
+	return file.Name()
+}
+
+// drainRulesQueue processes all the changes that are in the rules queue.
+//
+func drainRulesQueue(healer *Healer) {
+	for healer.rulesQueue.Len() > 0 {
+		healer.pickRuleChange()
+	}
+}
+
+// rulesCacheContent returns a map containing the rules of the cache, indexed by name.
+//
+func rulesCacheContent(healer *Healer) map[string]*autoheal.HealingRule {
+	content := map[string]*autoheal.HealingRule{}
+	healer.rulesCache.Range(func(key, value interface{}) bool {
+		content[key.(string)] = value.(*autoheal.HealingRule)
+		return true
+	})
+	return content
+}
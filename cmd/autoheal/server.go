@@ -18,17 +18,24 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/logging"
 	"github.com/openshift/autoheal/pkg/metrics"
+	"github.com/openshift/autoheal/pkg/receiver"
 	"github.com/openshift/autoheal/pkg/signals"
 )
 
@@ -37,6 +44,45 @@ var (
 	serverKubeAddress string
 	serverKubeConfig  string
 	serverConfigFiles []string
+	serverConfigMaps  []string
+
+	serverValidateAWXTemplates bool
+	serverHistorySize          int
+	serverPluginDir            string
+	serverAlertNameLabel       string
+	serverVerifyPermissions    bool
+	serverAlertmanagerVersion  string
+	serverCacheCheckInterval   time.Duration
+	serverCacheAutoCorrect     bool
+	serverWatchCRDs            bool
+	serverCRDNamespace         string
+	serverBatchCaptureOutput   bool
+	serverShutdownGracePeriod  time.Duration
+	serverDrainTimeout         time.Duration
+	serverStripLabels          []string
+	serverRetryJitterFactor    float64
+	serverMaxRulesPerReload    int
+	serverTrimLabelValues      bool
+	serverListenAddress        string
+	serverReceiverPath         string
+	serverTLSCertFile          string
+	serverTLSKeyFile           string
+	serverDisableHTTP2         bool
+	serverMetricsMaxAlertNames int
+	serverAlertSourceHeader    string
+	serverAlertsTokenFile      string
+	serverAdminToken           string
+	serverAlertsRateLimit      float64
+	serverMaxRequestBody       string
+	serverLogJSONIndent        int
+	serverLogFormat            string
+	serverAutoRegisterService  bool
+	serverServiceName          string
+	serverDryRun               bool
+	serverAuditConfigMap       string
+	serverAuditNamespace       string
+	serverAuditFlushInterval   time.Duration
+	serverAuditMaxEntries      int
 )
 
 var serverCmd = &cobra.Command{
@@ -72,6 +118,288 @@ func init() {
 			"directory all the files inside whose names end in .yml or .yaml will be "+
 			"loaded, in alphabetical order.",
 	)
+	serverFlags.StringSliceVar(
+		&serverConfigMaps,
+		"config-map",
+		nil,
+		"The name of a config map that contains configuration files, in the form "+
+			"'namespace/name', or just 'name' for the namespace where the server is "+
+			"running. Can be used multiple times. The keys whose names end in .yml or "+
+			".yaml are loaded, in alphabetical order, after the configuration files. "+
+			"The config maps are reloaded every five minutes.",
+	)
+	serverFlags.BoolVar(
+		&serverValidateAWXTemplates,
+		"validate-awx-templates",
+		false,
+		"Check that the AWX job templates used by the healing rules exist when the "+
+			"configuration is loaded. Missing templates are reported as warnings.",
+	)
+	serverFlags.IntVar(
+		&serverHistorySize,
+		"history-size",
+		100,
+		"The number of processed alerts that will be remembered and returned by the "+
+			"/history endpoint.",
+	)
+	serverFlags.StringVar(
+		&serverPluginDir,
+		"plugin-dir",
+		"",
+		"Directory containing Go plugins that provide additional action runners. All the "+
+			"files inside whose names end in .so will be loaded.",
+	)
+	serverFlags.StringVar(
+		&serverAlertNameLabel,
+		"alert-name-label",
+		alertmanager.DefaultNameLabel,
+		"The label that contains the name of the alerts, used in log messages. Alerts that "+
+			"don't have this label are identified by their fingerprint.",
+	)
+	serverFlags.BoolVar(
+		&serverVerifyPermissions,
+		"verify-permissions",
+		true,
+		"Check on startup that the service account has all the permissions that the "+
+			"server needs in the namespace where it runs, and exit if any of them is "+
+			"missing.",
+	)
+	serverFlags.StringVar(
+		&serverAlertmanagerVersion,
+		"alertmanager-version",
+		string(alertmanager.MessageVersionAuto),
+		"The version of the format of the messages sent by the alert manager: 'v1', 'v2' "+
+			"or 'auto'. In 'auto' mode the version is detected for each message, checking "+
+			"if it contains the 'version' field.",
+	)
+	serverFlags.DurationVar(
+		&serverCacheCheckInterval,
+		"cache-check-interval",
+		10*time.Minute,
+		"How often to check that the cache of healing rules is consistent with the "+
+			"configuration. Use zero to disable the check.",
+	)
+	serverFlags.BoolVar(
+		&serverCacheAutoCorrect,
+		"cache-auto-correct",
+		false,
+		"Fix the differences between the cache of healing rules and the configuration "+
+			"found by the periodic check, instead of only reporting them.",
+	)
+	serverFlags.BoolVar(
+		&serverWatchCRDs,
+		"watch-crds",
+		false,
+		"Also load the healing rules from the HealingRule objects of the Kubernetes API, "+
+			"and update them when the objects change. The rules of the configuration take "+
+			"precedence over the ones with the same name.",
+	)
+	serverFlags.StringVar(
+		&serverCRDNamespace,
+		"crd-namespace",
+		"",
+		"Namespace where the HealingRule objects are watched. The default is to watch all "+
+			"the namespaces.",
+	)
+	serverFlags.BoolVar(
+		&serverBatchCaptureOutput,
+		"batch-capture-output",
+		false,
+		"Save the output of the batch jobs, when they finish, in a config map named "+
+			"'autoheal-<job>-output' in the namespace of the job. Only the last 10 KiB "+
+			"of the output are saved.",
+	)
+	serverFlags.DurationVar(
+		&serverShutdownGracePeriod,
+		"shutdown-grace-period",
+		30*time.Second,
+		"How long to wait, when the server is stopped, for the requests in flight to "+
+			"finish and for the alerts already received to be processed.",
+	)
+	serverFlags.DurationVar(
+		&serverDrainTimeout,
+		"drain-timeout",
+		5*time.Minute,
+		"How long to wait, when the server is stopped, for the AWX and batch jobs that are "+
+			"still running to finish. Use zero to exit without waiting.",
+	)
+	serverFlags.StringSliceVar(
+		&serverStripLabels,
+		"strip-labels",
+		DefaultStripLabels,
+		"Labels and annotations that are ignored when checking if alerts match the healing "+
+			"rules, usually added by the alert manager for routing. Can be used multiple "+
+			"times, or with a comma separated list. Use an empty value to keep all of them.",
+	)
+	serverFlags.Float64Var(
+		&serverRetryJitterFactor,
+		"retry-jitter-factor",
+		0.2,
+		"Maximum fraction of the delay before processing an alert that is added randomly, "+
+			"so that alerts retried at the same time, for example when the AWX server "+
+			"recovers, are spread. Must be between 0 and 1.",
+	)
+	serverFlags.IntVar(
+		&serverMaxRulesPerReload,
+		"max-rules-per-reload",
+		0,
+		"Maximum number of healing rules loaded in each step of a reload of the rules, "+
+			"to avoid spikes of memory usage when there are many rules. Zero means no limit.",
+	)
+	serverFlags.BoolVar(
+		&serverTrimLabelValues,
+		"trim-label-values",
+		false,
+		"Remove the leading and trailing white space from the values of the labels and "+
+			"annotations of alerts before checking if they match the rules.",
+	)
+	serverFlags.StringVar(
+		&serverListenAddress,
+		"listen-address",
+		DefaultListenAddress,
+		"The address where the web server listens, in the form 'host:port'. An empty host "+
+			"means all the interfaces.",
+	)
+	serverFlags.StringVar(
+		&serverReceiverPath,
+		"receiver-path",
+		DefaultReceiverPath,
+		"The path where the web server receives the alerts sent by the alert manager.",
+	)
+	serverFlags.StringVar(
+		&serverTLSCertFile,
+		"tls-cert-file",
+		"",
+		"File containing the TLS certificate of the web server. When this and the key "+
+			"file are given the web server uses HTTPS. Use 'auto' to generate a self-signed "+
+			"certificate, without key file.",
+	)
+	serverFlags.StringVar(
+		&serverTLSKeyFile,
+		"tls-key-file",
+		"",
+		"File containing the TLS private key of the web server.",
+	)
+	serverFlags.BoolVar(
+		&serverDisableHTTP2,
+		"disable-http2",
+		false,
+		"Don't accept HTTP/2 connections. HTTP/2 is only used when TLS is enabled.",
+	)
+	serverFlags.IntVar(
+		&serverMetricsMaxAlertNames,
+		"metrics-max-alertname-values",
+		50,
+		"Maximum number of distinct alert names used as values of metric labels. Other "+
+			"alert names are reported as '"+metrics.OverflowValue+"'. Zero means no limit.",
+	)
+	serverFlags.StringVar(
+		&serverAlertSourceHeader,
+		"alert-source-header",
+		DefaultAlertSourceHeader,
+		"HTTP header that identifies the alert manager that sent the alerts, used in the "+
+			"logs and in the metrics. Requests without it are identified by their remote address.",
+	)
+	serverFlags.StringVar(
+		&serverAlertsTokenFile,
+		"alerts-token-file",
+		"",
+		"File containing the bearer token that the alert manager needs to send in the "+
+			"Authorization header. If empty all the requests are accepted.",
+	)
+	serverFlags.StringVar(
+		&serverAdminToken,
+		"admin-token",
+		"",
+		"Bearer token required in the Authorization header of the requests to the /rules "+
+			"and /memory endpoints. If empty the alerts token is required instead.",
+	)
+	serverFlags.Float64Var(
+		&serverAlertsRateLimit,
+		"alerts-rate-limit",
+		0,
+		"Maximum number of requests per second accepted from the alert manager. Zero means "+
+			"no limit.",
+	)
+	serverFlags.StringVar(
+		&serverMaxRequestBody,
+		"max-request-body",
+		"1MB",
+		"Maximum size of the bodies of the requests sent by the alert manager, for example "+
+			"'512KB' or '2MB'. Larger requests are rejected with status 413.",
+	)
+	serverFlags.IntVar(
+		&serverLogJSONIndent,
+		"log-json-indent",
+		receiver.DefaultIndent,
+		"Number of spaces used to indent the request bodies written to the log. Zero means "+
+			"that they are written without changes.",
+	)
+	serverFlags.StringVar(
+		&serverLogFormat,
+		"log-format",
+		string(logging.FormatText),
+		"Format of the log entries written by the action runners, the alerts receiver and "+
+			"the zap logger, either 'text' or 'json'. It selects the encoder of the zap "+
+			"logger. The rest of the log always uses the text format of glog.",
+	)
+	serverFlags.BoolVar(
+		&serverAutoRegisterService,
+		"auto-register-service",
+		false,
+		"Create a Kubernetes service that points to the web server when starting, and delete "+
+			"it when stopping, so that the alert manager can find it using DNS.",
+	)
+	serverFlags.StringVar(
+		&serverServiceName,
+		"service-name",
+		"autoheal",
+		"Name of the service created when the --auto-register-service option is used.",
+	)
+	serverFlags.BoolVar(
+		&serverDryRun,
+		"dry-run",
+		false,
+		"Write to the log the actions triggered by the alerts, instead of executing them.",
+	)
+	serverFlags.StringVar(
+		&serverAuditConfigMap,
+		"audit-config-map",
+		"",
+		"Name of the config map where the executed actions are recorded for auditing. If empty "+
+			"the actions aren't recorded.",
+	)
+	serverFlags.StringVar(
+		&serverAuditNamespace,
+		"audit-namespace",
+		"",
+		"Namespace of the config map where the executed actions are recorded. The default is "+
+			"the namespace where the server is running.",
+	)
+	serverFlags.DurationVar(
+		&serverAuditFlushInterval,
+		"audit-flush-interval",
+		30*time.Second,
+		"How often the recorded actions are written to the audit config map.",
+	)
+	serverFlags.IntVar(
+		&serverAuditMaxEntries,
+		"audit-max-entries",
+		1000,
+		"Maximum number of actions kept in the audit config map. When it is exceeded the "+
+			"oldest actions are discarded.",
+	)
+}
+
+// parseConfigMapName splits the value of the --config-map option into the namespace and the name of
+// the config map. When the value doesn't contain a namespace the given default is used.
+//
+func parseConfigMapName(value, defaultNamespace string) (namespace, name string) {
+	slash := strings.Index(value, "/")
+	if slash == -1 {
+		return defaultNamespace, value
+	}
+	return value[:slash], value[slash+1:]
 }
 
 func kubeConfigPath(serverKubeConfig string) (kubeConfig string, err error) {
@@ -153,16 +481,118 @@ func serverRun(cmd *cobra.Command, args []string) {
 		glog.Fatalf("Error building Kubernets API client: %s", err.Error())
 	}
 
+	// Create the client for the healing rules, only if they will be watched:
+	var rulesClient HealingRulesClient
+	if serverWatchCRDs {
+		rulesClient, err = NewHealingRulesClient(config)
+		if err != nil {
+			glog.Fatalf("Error building healing rules API client: %s", err.Error())
+		}
+	}
+
+	// Check that we have all the permissions that we need:
+	if serverVerifyPermissions {
+		missing, err := verifyPermissions(k8sClient, currentNamespace())
+		if err != nil {
+			glog.Fatalf("Error verifying permissions: %s", err.Error())
+		}
+		if len(missing) > 0 {
+			glog.Fatalf(
+				"The service account is missing the following permissions: %s",
+				strings.Join(missing, ", "),
+			)
+		}
+	}
+
+	// Set the label that contains the names of the alerts:
+	alertmanager.SetNameLabel(serverAlertNameLabel)
+
+	// Check the version of the format of the alert manager messages:
+	alertmanagerVersion, err := alertmanager.ParseMessageVersion(serverAlertmanagerVersion)
+	if err != nil {
+		glog.Fatalf("Error parsing alert manager version: %s", err.Error())
+	}
+
+	// Load the token that the alert manager needs to send:
+	var alertsToken string
+	if serverAlertsTokenFile != "" {
+		data, err := ioutil.ReadFile(serverAlertsTokenFile)
+		if err != nil {
+			glog.Fatalf("Error reading alerts token file: %s", err.Error())
+		}
+		alertsToken = strings.TrimSpace(string(data))
+	}
+
+	// Parse the maximum size of the requests sent by the alert manager:
+	maxRequestBody, err := receiver.ParseSize(serverMaxRequestBody)
+	if err != nil {
+		glog.Fatalf("Error parsing maximum request body size: %s", err.Error())
+	}
+
+	// The service is registered in the namespace where the server is running, if it is running
+	// inside a pod:
+	serviceNamespace := currentNamespace()
+	if serviceNamespace == "" {
+		serviceNamespace = meta.NamespaceDefault
+	}
+
+	// The audit config map is created, by default, in the same namespace as the service:
+	auditNamespace := serverAuditNamespace
+	if auditNamespace == "" {
+		auditNamespace = serviceNamespace
+	}
+
 	// Build the healer:
-	healer, err := NewHealerBuilder().
+	healerBuilder := NewHealerBuilder()
+	for _, value := range serverConfigMaps {
+		namespace, name := parseConfigMapName(value, serviceNamespace)
+		healerBuilder.ConfigMap(namespace, name)
+	}
+	healer, err := healerBuilder.
 		ConfigFiles(serverConfigFiles).
 		KubernetesClient(k8sClient).
+		ValidateAWXTemplates(serverValidateAWXTemplates).
+		HistorySize(serverHistorySize).
+		PluginDir(serverPluginDir).
+		AlertmanagerVersion(alertmanagerVersion).
+		CacheCheckInterval(serverCacheCheckInterval).
+		CacheAutoCorrect(serverCacheAutoCorrect).
+		WatchCRDs(serverWatchCRDs).
+		CRDNamespace(serverCRDNamespace).
+		HealingRulesClient(rulesClient).
+		BatchCaptureOutput(serverBatchCaptureOutput).
+		ShutdownGracePeriod(serverShutdownGracePeriod).
+		DrainTimeout(serverDrainTimeout).
+		StripLabels(serverStripLabels).
+		RetryJitterFactor(serverRetryJitterFactor).
+		MaxRulesPerReload(serverMaxRulesPerReload).
+		TrimLabelValues(serverTrimLabelValues).
+		ListenAddress(serverListenAddress).
+		ReceiverPath(serverReceiverPath).
+		TLSCertFile(serverTLSCertFile).
+		TLSKeyFile(serverTLSKeyFile).
+		DisableHTTP2(serverDisableHTTP2).
+		AlertSourceHeader(serverAlertSourceHeader).
+		AlertsToken(alertsToken).
+		AdminToken(serverAdminToken).
+		AlertsRateLimit(serverAlertsRateLimit).
+		MaxRequestBody(maxRequestBody).
+		LogJSONIndent(serverLogJSONIndent).
+		AutoRegisterService(serverAutoRegisterService).
+		ServiceName(serverServiceName).
+		ServiceNamespace(serviceNamespace).
+		DryRun(serverDryRun).
+		AuditConfigMap(serverAuditConfigMap).
+		AuditNamespace(auditNamespace).
+		AuditFlushInterval(serverAuditFlushInterval).
+		AuditMaxEntries(serverAuditMaxEntries).
 		Build()
 	if err != nil {
 		glog.Fatalf("Error building healer: %s", err.Error())
 	}
 
 	// Register exported metrics:
+	metrics.SetMaxAlertNameValues(serverMetricsMaxAlertNames)
 	metrics.InitExportedMetrics()
 
 	// Run the healer:
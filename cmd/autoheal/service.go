@@ -0,0 +1,156 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to register the healer as a Kubernetes service, so that
+// the alert manager can find it using DNS.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DefaultServiceSelector are the labels used by default to select the pods of the registered
+// service. They are the labels used by the deployment in the OpenShift template.
+//
+var DefaultServiceSelector = map[string]string{
+	"app": "autoheal",
+}
+
+// ServiceRegisteredByAnnotation is the annotation of the registered service that contains the name
+// of the pod that registered it.
+//
+const ServiceRegisteredByAnnotation = "autoheal.openshift.io/registered-by"
+
+// serviceURL returns the URL that the alert manager should use to send alerts to the registered
+// service.
+//
+func (h *Healer) serviceURL() string {
+	scheme := "http"
+	if h.tlsCertFile != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf(
+		"%s://%s.%s.svc.cluster.local:%d%s",
+		scheme,
+		h.serviceName,
+		h.serviceNamespace,
+		h.listenPort,
+		h.receiverPath,
+	)
+}
+
+// registerService creates the service that points to the web server of the healer, or updates it if
+// it already exists. In both cases the name of the pod is recorded in the service, so that it is
+// only deleted by the pod that registered it last.
+//
+func (h *Healer) registerService() error {
+	portName := "http"
+	if h.tlsCertFile != "" {
+		portName = "https"
+	}
+	spec := core.ServiceSpec{
+		Selector: h.serviceSelector,
+		Ports: []core.ServicePort{
+			{
+				Name:       portName,
+				Protocol:   core.ProtocolTCP,
+				Port:       int32(h.listenPort),
+				TargetPort: intstr.FromInt(h.listenPort),
+			},
+		},
+	}
+
+	resource := h.k8sClient.CoreV1().Services(h.serviceNamespace)
+	existing, err := resource.Get(h.serviceName, meta.GetOptions{})
+	switch {
+	case err == nil:
+		// Replace only the selector and the ports, as the rest of the specification, like the
+		// cluster IP, is assigned by the server and can't be changed:
+		existing.Spec.Selector = spec.Selector
+		existing.Spec.Ports = spec.Ports
+		if existing.ObjectMeta.Annotations == nil {
+			existing.ObjectMeta.Annotations = make(map[string]string)
+		}
+		existing.ObjectMeta.Annotations[ServiceRegisteredByAnnotation] = h.podName
+		_, err = resource.Update(existing)
+		if err != nil {
+			return err
+		}
+		glog.Infof("Updated service '%s' in namespace '%s'", h.serviceName, h.serviceNamespace)
+	case errors.IsNotFound(err):
+		_, err = resource.Create(&core.Service{
+			ObjectMeta: meta.ObjectMeta{
+				Name:      h.serviceName,
+				Namespace: h.serviceNamespace,
+				Labels:    h.serviceSelector,
+				Annotations: map[string]string{
+					ServiceRegisteredByAnnotation: h.podName,
+				},
+			},
+			Spec: spec,
+		})
+		if err != nil {
+			return err
+		}
+		glog.Infof("Created service '%s' in namespace '%s'", h.serviceName, h.serviceNamespace)
+	default:
+		return err
+	}
+	glog.Infof("Alerts can be sent to '%s'", h.serviceURL())
+	return nil
+}
+
+// unregisterService deletes the service created by registerService. It isn't an error if the
+// service doesn't exist. The service isn't deleted if it has been registered by another pod, for
+// example by the new pod started during a rolling update, as that pod still needs it.
+//
+func (h *Healer) unregisterService() error {
+	resource := h.k8sClient.CoreV1().Services(h.serviceNamespace)
+	existing, err := resource.Get(h.serviceName, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	owner := existing.ObjectMeta.Annotations[ServiceRegisteredByAnnotation]
+	if owner != h.podName {
+		glog.Infof(
+			"Service '%s' in namespace '%s' was registered by pod '%s', will not delete it",
+			h.serviceName,
+			h.serviceNamespace,
+			owner,
+		)
+		return nil
+	}
+	err = resource.Delete(h.serviceName, &meta.DeleteOptions{
+		Preconditions: &meta.Preconditions{
+			UID: &existing.ObjectMeta.UID,
+		},
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	glog.Infof("Deleted service '%s' in namespace '%s'", h.serviceName, h.serviceNamespace)
+	return nil
+}
@@ -0,0 +1,282 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+func TestRegisterServiceCreatesService(t *testing.T) {
+	services := &fakeServices{
+		items: make(map[string]*core.Service),
+	}
+	healer := makeServiceHealer(t, services)
+
+	err := healer.registerService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if services.namespace != "my-namespace" {
+		t.Errorf("Expected namespace 'my-namespace', but got '%s'", services.namespace)
+	}
+	service, ok := services.items["my-autoheal"]
+	if !ok {
+		t.Fatalf("Expected service 'my-autoheal' to be created")
+	}
+	if service.Spec.Selector["app"] != "autoheal" {
+		t.Errorf("Expected selector 'app=autoheal', but got %v", service.Spec.Selector)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != 9099 {
+		t.Errorf("Expected port 9099, but got %+v", service.Spec.Ports)
+	}
+	owner := service.ObjectMeta.Annotations[ServiceRegisteredByAnnotation]
+	if owner != "my-pod" {
+		t.Errorf("Expected the service to be registered by 'my-pod', but got '%s'", owner)
+	}
+}
+
+func TestRegisterServiceUpdatesExistingService(t *testing.T) {
+	services := &fakeServices{
+		items: map[string]*core.Service{
+			"my-autoheal": {
+				ObjectMeta: meta.ObjectMeta{
+					Name:            "my-autoheal",
+					ResourceVersion: "123",
+				},
+				Spec: core.ServiceSpec{
+					ClusterIP: "172.30.0.1",
+					Ports: []core.ServicePort{
+						{Port: 80},
+					},
+				},
+			},
+		},
+	}
+	healer := makeServiceHealer(t, services)
+
+	err := healer.registerService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if services.updates != 1 {
+		t.Fatalf("Expected one update, but got %d", services.updates)
+	}
+	service := services.items["my-autoheal"]
+	if service.Spec.ClusterIP != "172.30.0.1" {
+		t.Errorf("Expected the cluster IP to be preserved, but got '%s'", service.Spec.ClusterIP)
+	}
+	if service.ObjectMeta.ResourceVersion != "123" {
+		t.Errorf("Expected the resource version to be preserved, but got '%s'", service.ObjectMeta.ResourceVersion)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != 9099 {
+		t.Errorf("Expected port 9099, but got %+v", service.Spec.Ports)
+	}
+}
+
+func TestUnregisterServiceDeletesService(t *testing.T) {
+	services := &fakeServices{
+		items: make(map[string]*core.Service),
+	}
+	healer := makeServiceHealer(t, services)
+
+	err := healer.registerService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = healer.unregisterService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := services.items["my-autoheal"]; ok {
+		t.Errorf("Expected service 'my-autoheal' to be deleted")
+	}
+
+	// Deleting it again isn't an error:
+	err = healer.unregisterService()
+	if err != nil {
+		t.Errorf("Expected no error deleting a service that doesn't exist, but got '%s'", err)
+	}
+}
+
+func TestUnregisterServiceKeepsServiceOfOtherPod(t *testing.T) {
+	services := &fakeServices{
+		items: make(map[string]*core.Service),
+	}
+	healer := makeServiceHealer(t, services)
+	defer healer.config.ShutDown()
+	err := healer.registerService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate the new pod of a rolling update registering the same service:
+	services.items["my-autoheal"].ObjectMeta.Annotations[ServiceRegisteredByAnnotation] = "my-new-pod"
+
+	err = healer.unregisterService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := services.items["my-autoheal"]; !ok {
+		t.Errorf("Expected the service registered by another pod to be kept")
+	}
+}
+
+func TestAutoRegisterServiceRequiresAlertsToken(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		KubernetesClient(&fakeServicesClient{services: &fakeServices{}}).
+		AutoRegisterService(true).
+		PodName("my-pod").
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error when registering the service without an alerts token")
+	}
+}
+
+func TestServiceURL(t *testing.T) {
+	healer := makeServiceHealer(t, &fakeServices{})
+	expected := "http://my-autoheal.my-namespace.svc.cluster.local:9099/alerts"
+	if healer.serviceURL() != expected {
+		t.Errorf("Expected URL '%s', but got '%s'", expected, healer.serviceURL())
+	}
+}
+
+func TestServiceUsesListenPort(t *testing.T) {
+	services := &fakeServices{
+		items: make(map[string]*core.Service),
+	}
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		KubernetesClient(&fakeServicesClient{services: services}).
+		AutoRegisterService(true).
+		AlertsToken("my-token").
+		PodName("my-pod").
+		ServiceName("my-autoheal").
+		ServiceNamespace("my-namespace").
+		ListenAddress("0.0.0.0:8080").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = healer.registerService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := services.items["my-autoheal"].Spec.Ports
+	if len(ports) != 1 || ports[0].Port != 8080 || ports[0].TargetPort.IntValue() != 8080 {
+		t.Errorf("Expected port 8080, but got %+v", ports)
+	}
+	expected := "http://my-autoheal.my-namespace.svc.cluster.local:8080/alerts"
+	if healer.serviceURL() != expected {
+		t.Errorf("Expected URL '%s', but got '%s'", expected, healer.serviceURL())
+	}
+}
+
+func TestAutoRegisterServiceRequiresClient(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		AutoRegisterService(true).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error when registering the service without a Kubernetes client")
+	}
+}
+
+func makeServiceHealer(t *testing.T, services *fakeServices) *Healer {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		KubernetesClient(&fakeServicesClient{services: services}).
+		AutoRegisterService(true).
+		AlertsToken("my-token").
+		PodName("my-pod").
+		ServiceName("my-autoheal").
+		ServiceNamespace("my-namespace").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return healer
+}
+
+// fakeServicesClient is a Kubernetes client that only implements the parts of the API used to
+// manage services. Calling any other method will panic.
+//
+type fakeServicesClient struct {
+	kubernetes.Interface
+	services *fakeServices
+}
+
+func (c *fakeServicesClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeCoreV1{services: c.services}
+}
+
+// fakeServices keeps the services in memory, indexed by name. It remembers the namespace used and
+// the number of updates.
+//
+type fakeServices struct {
+	corev1.ServiceInterface
+	items     map[string]*core.Service
+	namespace string
+	updates   int
+}
+
+func (s *fakeServices) Get(name string, options meta.GetOptions) (*core.Service, error) {
+	service, ok := s.items[name]
+	if !ok {
+		return nil, errors.NewNotFound(core.Resource("services"), name)
+	}
+	return service.DeepCopy(), nil
+}
+
+func (s *fakeServices) Create(service *core.Service) (*core.Service, error) {
+	if _, ok := s.items[service.ObjectMeta.Name]; ok {
+		return nil, errors.NewAlreadyExists(core.Resource("services"), service.ObjectMeta.Name)
+	}
+	s.items[service.ObjectMeta.Name] = service
+	return service, nil
+}
+
+func (s *fakeServices) Update(service *core.Service) (*core.Service, error) {
+	if _, ok := s.items[service.ObjectMeta.Name]; !ok {
+		return nil, errors.NewNotFound(core.Resource("services"), service.ObjectMeta.Name)
+	}
+	s.items[service.ObjectMeta.Name] = service
+	s.updates++
+	return service, nil
+}
+
+func (s *fakeServices) Delete(name string, options *meta.DeleteOptions) error {
+	if _, ok := s.items[name]; !ok {
+		return errors.NewNotFound(core.Resource("services"), name)
+	}
+	delete(s.items, name)
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForSlowRequest(t *testing.T) {
+	healer := makeShutdownHealer(t, 5*time.Second)
+
+	// Start a web server whose alerts handler is slow, and tells us when it has started:
+	started := make(chan struct{})
+	finished := new(int32)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/alerts", func(response http.ResponseWriter, request *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		healer.handleRequest(response, request)
+		atomic.StoreInt32(finished, 1)
+	})
+	server, address := startTestServer(t, mux)
+
+	// Start the worker that processes the alerts:
+	go healer.runAlertsWorker()
+	defer healer.alertsQueue.ShutDown()
+
+	// Send the slow request, and shut down the server while it is in flight:
+	done := make(chan error, 1)
+	go func() {
+		response, err := http.Post(
+			"http://"+address+"/alerts",
+			"application/json",
+			bytes.NewBufferString(`{"alerts": [{"status": "firing", "labels": {"alertname": "NodeDown"}}]}`),
+		)
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode != http.StatusOK {
+				t.Errorf("Expected status 200, but got %d", response.StatusCode)
+			}
+		}
+		done <- err
+	}()
+	<-started
+	err := healer.shutdown(server)
+	if err != nil {
+		t.Fatalf("Expected clean shutdown, but got: %s", err)
+	}
+
+	// The request should have completed before the shutdown finished:
+	if atomic.LoadInt32(finished) != 1 {
+		t.Errorf("Expected the request to have completed when the shutdown finished")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected the request to succeed, but got: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the client to receive the response")
+	}
+
+	// And the alert that it contained should have been processed:
+	if atomic.LoadInt64(&healer.pendingAlerts) != 0 {
+		t.Errorf("Expected no pending alerts, but got %d", healer.pendingAlerts)
+	}
+	if healer.history.Len() != 1 {
+		t.Errorf("Expected the alert to be in the history, but it contains %d entries", healer.history.Len())
+	}
+}
+
+func TestShutdownGracePeriodExpires(t *testing.T) {
+	healer := makeShutdownHealer(t, 50*time.Millisecond)
+
+	// Pretend that there is an alert that is never processed:
+	atomic.AddInt64(&healer.pendingAlerts, 1)
+
+	server, _ := startTestServer(t, http.NewServeMux())
+	start := time.Now()
+	healer.shutdown(server)
+	elapsed := time.Since(start)
+	if elapsed > time.Second {
+		t.Errorf("Expected the shutdown to finish after the grace period, but it took %s", elapsed)
+	}
+}
+
+func TestDrainWithoutActiveJobsDoesntWait(t *testing.T) {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "awx-config.yml")).
+		DrainTimeout(time.Minute).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = healer.drainActiveJobs()
+	if err != nil {
+		t.Errorf("Expected no error when there are no active jobs, but got: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the drain to finish immediately, but it took %s", elapsed)
+	}
+}
+
+func TestNegativeDrainTimeoutRejected(t *testing.T) {
+	_, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		DrainTimeout(-time.Second).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error for a negative drain timeout, but got nil")
+	}
+}
+
+func makeShutdownHealer(t *testing.T, period time.Duration) *Healer {
+	healer, err := NewHealerBuilder().
+		ConfigFile(filepath.Join("..", "..", "testdata", "empty-config.yml")).
+		MinimumRunnersRequired(0).
+		ShutdownGracePeriod(period).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return healer
+}
+
+func startTestServer(t *testing.T, handler http.Handler) (server *http.Server, address string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = &http.Server{Handler: handler}
+	go server.Serve(listener)
+	address = listener.Addr().String()
+	return
+}
@@ -0,0 +1,152 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the handler of the endpoint used to check which rules match an alert, and
+// what actions they would execute, without actually executing them.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/glog"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/receiver"
+)
+
+// testResponse is the body of the response of the /test endpoint.
+//
+type testResponse struct {
+	// The results for each of the alerts of the request, in the same order:
+	Alerts []*testAlert `json:"alerts"`
+}
+
+// testAlert contains the rules that match one of the alerts of the request.
+//
+type testAlert struct {
+	Name  string      `json:"name"`
+	Rules []*testRule `json:"rules"`
+}
+
+// testRule contains the details of a rule that matches an alert, including the action with the
+// templates already processed. If the templates can't be processed the error is returned instead
+// of the action.
+//
+type testRule struct {
+	Name       string      `json:"name"`
+	ActionType string      `json:"actionType"`
+	Action     interface{} `json:"action,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// testHandler creates the handler for the /test endpoint. It requires the same token than the
+// requests sent by the alert manager, as the rendered actions may contain sensitive data.
+//
+func (h *Healer) testHandler() http.Handler {
+	return receiver.NewMiddlewareChain(
+		receiver.LoggingMiddleware,
+		receiver.AuthMiddleware(h.alertsToken),
+	).Then(http.HandlerFunc(h.handleTestRequest))
+}
+
+// handleTestRequest receives a message in the same format used by the alert manager, and returns
+// the rules that match each of its alerts and the actions that they would execute. Nothing is
+// executed, and the alerts aren't added to the history.
+//
+func (h *Healer) handleTestRequest(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(
+			response,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+
+	// Read and parse the request body:
+	data, ok := h.readRequestBody(response, request)
+	if !ok {
+		return
+	}
+	message, err := alertmanager.ParseMessage(data, h.alertmanagerVersion)
+	if err != nil {
+		glog.Warningf("Can't parse test request body: %s", err)
+		http.Error(
+			response,
+			http.StatusText(http.StatusBadRequest),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	// Find the matching rules and render their actions:
+	body := &testResponse{
+		Alerts: make([]*testAlert, 0, len(message.Alerts)),
+	}
+	for _, alert := range message.Alerts {
+		if alert == nil {
+			continue
+		}
+		result := &testAlert{
+			Name:  alert.Name(),
+			Rules: make([]*testRule, 0),
+		}
+		for _, rule := range h.matchRules(alert) {
+			result.Rules = append(result.Rules, renderTestRule(rule, alert))
+		}
+		body.Alerts = append(body.Alerts, result)
+	}
+
+	// Write the response body:
+	data, err = json.Marshal(body)
+	if err != nil {
+		glog.Errorf("Can't generate test response body: %s", err)
+		http.Error(
+			response,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.Write(data)
+}
+
+// renderTestRule processes the templates of the action of the given rule using the given alert.
+//
+func renderTestRule(rule *autoheal.HealingRule, alert *alertmanager.Alert) *testRule {
+	result := &testRule{
+		Name:       rule.ObjectMeta.Name,
+		ActionType: ruleActionType(rule),
+	}
+	action := copyRuleAction(rule)
+	if action == nil {
+		return result
+	}
+	template, err := newAlertTemplate()
+	if err == nil {
+		err = template.Process(action, alert)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Action = action
+	return result
+}
@@ -0,0 +1,153 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestTestEndpointReturnsMatchedRules(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+
+	body := `{
+		"status": "firing",
+		"alerts": [
+			{
+				"status": "firing",
+				"labels": {
+					"alertname": "NodeDown",
+					"instance": "node0"
+				}
+			},
+			{
+				"status": "firing",
+				"labels": {
+					"alertname": "DiskFull"
+				}
+			}
+		]
+	}`
+	request := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	healer.handleTestRequest(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d", recorder.Code)
+	}
+	var response struct {
+		Alerts []struct {
+			Name  string `json:"name"`
+			Rules []struct {
+				Name       string                `json:"name"`
+				ActionType string                `json:"actionType"`
+				Action     autoheal.AWXJobAction `json:"action"`
+				Error      string                `json:"error"`
+			} `json:"rules"`
+		} `json:"alerts"`
+	}
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response.Alerts) != 2 {
+		t.Fatalf("Expected results for two alerts, but got %d", len(response.Alerts))
+	}
+	matched := response.Alerts[0]
+	if matched.Name != "NodeDown" {
+		t.Errorf("Expected alert 'NodeDown', but got '%s'", matched.Name)
+	}
+	if len(matched.Rules) != 1 {
+		t.Fatalf("Expected one matching rule, but got %d", len(matched.Rules))
+	}
+	rule := matched.Rules[0]
+	if rule.Name != "start-node" || rule.ActionType != "awxJob" {
+		t.Errorf("Expected rule 'start-node' with action type 'awxJob', but got %+v", rule)
+	}
+	if rule.Action.Limit != "node0" {
+		t.Errorf("Expected the limit template to be rendered as 'node0', but got '%s'", rule.Action.Limit)
+	}
+	if len(response.Alerts[1].Rules) != 0 {
+		t.Errorf("Expected no matching rules for alert 'DiskFull', but got %d", len(response.Alerts[1].Rules))
+	}
+
+	// Nothing should have been executed or remembered:
+	if len(healer.history.Filter(time.Time{}, "")) != 0 {
+		t.Errorf("Expected the history to be empty")
+	}
+	if healer.actionMemory.Has(&autoheal.AWXJobAction{Template: "Start node", Limit: "node0"}) {
+		t.Errorf("Expected the action not to be remembered")
+	}
+}
+
+func TestTestEndpointRejectsInvalidBody(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	request := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader("{"))
+	recorder := httptest.NewRecorder()
+	healer.handleTestRequest(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, but got %d", recorder.Code)
+	}
+}
+
+func TestTestEndpointRejectsLargeBody(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	defer healer.config.ShutDown()
+	healer.maxRequestBody = 100
+	body := `{"status": "firing", "alerts": []}` + strings.Repeat(" ", 100)
+	request := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	healer.handleTestRequest(recorder, request)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, but got %d", recorder.Code)
+	}
+}
+
+func TestTestEndpointRejectsGet(t *testing.T) {
+	healer := makeTestEndpointHealer(t)
+	request := httptest.NewRequest(http.MethodGet, "/test", nil)
+	recorder := httptest.NewRecorder()
+	healer.handleTestRequest(recorder, request)
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, but got %d", recorder.Code)
+	}
+}
+
+func makeTestEndpointHealer(t *testing.T) *Healer {
+	healer := makeHealer(t, "empty")
+	healer.rulesCache.Store("start-node", &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "start-node",
+		},
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Start node",
+			Limit:    "{{ $labels.instance }}",
+		},
+	})
+	return healer
+}
@@ -4,9 +4,9 @@
 
 readonly OS_GO_PACKAGE=github.com/openshift/autoheal
 
-readonly OS_BUILD_ENV_GOLANG="${OS_BUILD_ENV_GOLANG:-1.9}"
+readonly OS_BUILD_ENV_GOLANG="${OS_BUILD_ENV_GOLANG:-1.13}"
 readonly OS_BUILD_ENV_IMAGE="${OS_BUILD_ENV_IMAGE:-openshift/origin-release:golang-${OS_BUILD_ENV_GOLANG}}"
-readonly OS_REQUIRED_GO_VERSION="go1.9"
+readonly OS_REQUIRED_GO_VERSION="go1.13"
 readonly OS_BUILD_ENV_WORKINGDIR="/go/${OS_GO_PACKAGE}"
 
 readonly OS_OUTPUT_BASEPATH="${OS_OUTPUT_BASEPATH:-_output}"
@@ -0,0 +1,25 @@
+#!/bin/bash
+
+# This script verifies that the custom resource definition manifest is up to
+# date with the Go types that it is generated from.
+source "$(dirname "${BASH_SOURCE}")/lib/init.sh"
+
+generated=$(mktemp)
+
+function cleanup() {
+    return_code=$?
+    rm -f "${generated}"
+    os::util::describe_return_code "${return_code}"
+    exit "${return_code}"
+}
+trap "cleanup" EXIT
+
+os::golang::verify_go_version
+
+go run tools/gen-crd/main.go \
+--input pkg/apis/autoheal/v1alpha2 \
+--output "${generated}"
+
+if ! diff -u healingrule-crd.yml "${generated}"; then
+	os::log::fatal "The custom resource definition is out of date, run 'make generate-crds'"
+fi
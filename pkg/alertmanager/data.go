@@ -17,11 +17,13 @@ limitations under the License.
 package alertmanager
 
 import (
+	"encoding/json"
 	"fmt"
 	"hash"
 	"hash/fnv"
 	"io"
 	"sort"
+	"sync"
 	"time"
 )
 
@@ -44,6 +46,11 @@ type Message struct {
 	CommonLabels      map[string]string `json:"commonLabels,omitempty"`
 	CommonAnnotations map[string]string `json:"commonAnnotations,omitempty"`
 	ExternalURL       string            `json:"exterlalURL,omitempty"`
+
+	// The following fields are only sent by the v2 format of the message:
+	Version         string `json:"version,omitempty"`
+	GroupKey        string `json:"groupKey,omitempty"`
+	TruncatedAlerts int    `json:"truncatedAlerts,omitempty"`
 }
 
 // Alert represents each of the alerts sent by the alert manager to a receiver.
@@ -54,13 +61,88 @@ type Alert struct {
 	Annotations  map[string]string `json:"annotations,omitempty"`
 	StartsAt     time.Time         `json:"startsAt,omitempty"`
 	EndsAt       time.Time         `json:"endsAt,omitempty"`
-	GeneratorURL time.Time         `json:"generatorURL,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+
+	// The labels and annotations that are common to all the alerts of the message that contained
+	// this alert. They aren't part of the JSON representation of the alert, they are copied from
+	// the message when it is parsed.
+	commonLabels      map[string]string
+	commonAnnotations map[string]string
+
+	// The identifier of the alert manager that sent the alert, for example its IP address. It
+	// isn't part of the JSON representation of the alert, it is set when the request is received.
+	source string
+}
+
+// CommonLabels returns the labels that are common to all the alerts of the message that contained
+// this alert.
+//
+func (a *Alert) CommonLabels() map[string]string {
+	return a.commonLabels
 }
 
-// Name returns the name of the alert.
+// CommonAnnotations returns the annotations that are common to all the alerts of the message that
+// contained this alert.
+//
+func (a *Alert) CommonAnnotations() map[string]string {
+	return a.commonAnnotations
+}
+
+// Source returns the identifier of the alert manager that sent this alert, or an empty string if it
+// isn't known.
+//
+func (a *Alert) Source() string {
+	return a.source
+}
+
+// SetSource sets the identifier of the alert manager that sent this alert.
+//
+func (a *Alert) SetSource(source string) {
+	a.source = source
+}
+
+// DefaultNameLabel is the label that contains the name of the alert when no other label has been
+// configured with the SetNameLabel function.
+//
+const DefaultNameLabel = "alertname"
+
+// nameLabel is the label that contains the name of the alert. It is protected by the mutex, as it
+// can be changed while alerts are being processed.
+var (
+	nameLabel      = DefaultNameLabel
+	nameLabelMutex = &sync.RWMutex{}
+)
+
+// SetNameLabel sets the label that contains the name of the alerts. It should be called before
+// starting to process alerts, so that all the alerts use the same label.
+//
+func SetNameLabel(label string) {
+	if label == "" {
+		label = DefaultNameLabel
+	}
+	nameLabelMutex.Lock()
+	defer nameLabelMutex.Unlock()
+	nameLabel = label
+}
+
+// NameLabel returns the label that contains the name of the alerts.
+//
+func NameLabel() string {
+	nameLabelMutex.RLock()
+	defer nameLabelMutex.RUnlock()
+	return nameLabel
+}
+
+// Name returns the name of the alert, taken from the label configured with the SetNameLabel
+// function. If the alert doesn't have that label the name will be the fingerprint of the alert, so
+// that log messages can still be correlated, even between the firing and resolved notifications.
 //
 func (a *Alert) Name() string {
-	return a.Labels["alertname"]
+	name := a.Labels[NameLabel()]
+	if name == "" {
+		name = a.Fingerprint()
+	}
+	return name
 }
 
 // Namespace returns the namespace of the alert.
@@ -87,6 +169,40 @@ func (a *Alert) Hash() string {
 	return fmt.Sprintf("%d", sum)
 }
 
+// Fingerprint calculates a hash of the labels of the alert. Unlike the value returned by the Hash
+// method it doesn't depend on the annotations, so it is the same for the firing and resolved
+// notifications of the same alert.
+//
+func (a *Alert) Fingerprint() string {
+	dst := fnv.New32a()
+	hashMap(a.Labels, dst)
+	sum := dst.Sum32()
+	return fmt.Sprintf("%d", sum)
+}
+
+// LabelsKey returns a text that contains all the labels of the alert, sorted by name. Unlike the
+// value returned by the Fingerprint method it is always different for alerts with different labels,
+// so it can be used to identify the alerts.
+//
+func (a *Alert) LabelsKey() string {
+	// The JSON encoder sorts the keys of maps and escapes the special characters, so the result
+	// doesn't depend on the internal ordering of the map and can't be ambiguous:
+	data, err := json.Marshal(a.Labels)
+	if err != nil {
+		// This can't happen, as maps of strings can always be encoded.
+		panic(err)
+	}
+	return string(data)
+}
+
+// StatusKey returns a text that contains the status and all the labels of the alert. It identifies
+// the notifications that are duplicated inside the same message, which would otherwise trigger the
+// same actions more than once.
+//
+func (a *Alert) StatusKey() string {
+	return string(a.Status) + " " + a.LabelsKey()
+}
+
 // hashMap writes the keys and values of a map to a hash, making sure that they are in order to
 // that the result will allways be the same regardless of the internal ordering of the map.
 //
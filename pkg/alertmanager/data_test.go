@@ -31,6 +31,73 @@ func TestName(t *testing.T) {
 	}
 }
 
+func TestNameWithoutLabel(t *testing.T) {
+	a := Alert{
+		Labels: map[string]string{
+			"other": "foo",
+		},
+	}
+	if a.Name() != a.Fingerprint() {
+		t.Errorf("Expected fingerprint %+v but got %+v", a.Fingerprint(), a.Name())
+	}
+}
+
+func TestNameWithoutLabelDoesntDependOnAnnotations(t *testing.T) {
+	firing := Alert{
+		Status: AlertStatusFiring,
+		Labels: map[string]string{
+			"other": "foo",
+		},
+		Annotations: map[string]string{
+			"message": "Something is wrong",
+		},
+	}
+	resolved := Alert{
+		Status: AlertStatusResolved,
+		Labels: map[string]string{
+			"other": "foo",
+		},
+	}
+	if firing.Name() != resolved.Name() {
+		t.Errorf("Expected the same name, but got %+v and %+v", firing.Name(), resolved.Name())
+	}
+}
+
+func TestNameWithCustomLabel(t *testing.T) {
+	SetNameLabel("check")
+	defer SetNameLabel(DefaultNameLabel)
+	a := Alert{
+		Labels: map[string]string{
+			"alertname": "foo",
+			"check":     "bar",
+		},
+	}
+	if a.Name() != "bar" {
+		t.Errorf("Expected bar but got %+v", a.Name())
+	}
+}
+
+func TestNameWithoutCustomLabel(t *testing.T) {
+	SetNameLabel("check")
+	defer SetNameLabel(DefaultNameLabel)
+	a := Alert{
+		Labels: map[string]string{
+			"alertname": "foo",
+		},
+	}
+	if a.Name() != a.Fingerprint() {
+		t.Errorf("Expected fingerprint %+v but got %+v", a.Fingerprint(), a.Name())
+	}
+}
+
+func TestSetEmptyNameLabel(t *testing.T) {
+	SetNameLabel("")
+	defer SetNameLabel(DefaultNameLabel)
+	if NameLabel() != DefaultNameLabel {
+		t.Errorf("Expected %+v but got %+v", DefaultNameLabel, NameLabel())
+	}
+}
+
 func TestNamespace(t *testing.T) {
 	a := Alert{}
 	if a.Namespace() != "default" {
@@ -74,3 +141,91 @@ func TestHash(t *testing.T) {
 		t.Errorf("Expected same hash, got %+v != %+v", aHash, bHash)
 	}
 }
+
+func TestFingerprintIgnoresAnnotations(t *testing.T) {
+	firing := Alert{
+		Status: AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "foo",
+		},
+		Annotations: map[string]string{
+			"message": "Started",
+		},
+	}
+	resolved := Alert{
+		Status: AlertStatusResolved,
+		Labels: map[string]string{
+			"alertname": "foo",
+		},
+		Annotations: map[string]string{
+			"message": "Finished",
+		},
+	}
+	other := Alert{
+		Labels: map[string]string{
+			"alertname": "bar",
+		},
+	}
+
+	if firing.Fingerprint() != resolved.Fingerprint() {
+		t.Errorf("Expected same fingerprint, got %s != %s", firing.Fingerprint(), resolved.Fingerprint())
+	}
+	if firing.Fingerprint() == other.Fingerprint() {
+		t.Errorf("Expected different fingerprints for alerts with different labels")
+	}
+}
+
+func TestStatusKey(t *testing.T) {
+	a := Alert{
+		Status: AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "foo",
+			"instance":  "node0",
+		},
+		Annotations: map[string]string{
+			"message": "Started",
+		},
+	}
+	b := Alert{
+		Status: AlertStatusFiring,
+		Labels: map[string]string{
+			"instance":  "node0",
+			"alertname": "foo",
+		},
+	}
+	resolved := Alert{
+		Status: AlertStatusResolved,
+		Labels: map[string]string{
+			"alertname": "foo",
+			"instance":  "node0",
+		},
+	}
+
+	if a.StatusKey() != b.StatusKey() {
+		t.Errorf("Expected same key, got %s != %s", a.StatusKey(), b.StatusKey())
+	}
+	if a.StatusKey() == resolved.StatusKey() {
+		t.Errorf("Expected different keys for firing and resolved alerts")
+	}
+}
+
+func TestLabelsKeyIsNotAmbiguous(t *testing.T) {
+	// These alerts have the same fingerprint, because the fingerprint just concatenates the names
+	// and the values of the labels:
+	a := Alert{
+		Labels: map[string]string{
+			"alertname": "foo",
+			"instance":  "node0\njob=node",
+		},
+	}
+	b := Alert{
+		Labels: map[string]string{
+			"alertname": "foo",
+			"instance":  "node0",
+			"job":       "node",
+		},
+	}
+	if a.LabelsKey() == b.LabelsKey() {
+		t.Errorf("Expected different keys for alerts with different labels, got %s", a.LabelsKey())
+	}
+}
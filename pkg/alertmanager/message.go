@@ -0,0 +1,123 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alertmanager
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MessageVersion represents the version of the format of the messages sent by the alert manager.
+//
+type MessageVersion string
+
+const (
+	// MessageVersionV1 is the original format of the messages.
+	MessageVersionV1 MessageVersion = "v1"
+
+	// MessageVersionV2 is the format used by version 0.21 and newer of the alert manager, which
+	// adds the version, group key and number of truncated alerts.
+	MessageVersionV2 MessageVersion = "v2"
+
+	// MessageVersionAuto means that the version will be detected from the content of each
+	// message, checking if it contains the version field.
+	MessageVersionAuto MessageVersion = "auto"
+)
+
+// ParseMessageVersion checks that the given text is a valid message version and converts it.
+//
+func ParseMessageVersion(text string) (version MessageVersion, err error) {
+	version = MessageVersion(text)
+	switch version {
+	case MessageVersionV1, MessageVersionV2, MessageVersionAuto:
+	default:
+		err = fmt.Errorf(
+			"Message version '%s' isn't valid, must be '%s', '%s' or '%s'",
+			text,
+			MessageVersionV1,
+			MessageVersionV2,
+			MessageVersionAuto,
+		)
+	}
+	return
+}
+
+// ParseMessage parses a message sent by the alert manager, using the given version of the format.
+// The common labels and annotations of the message are copied to each of the alerts.
+//
+func ParseMessage(data []byte, version MessageVersion) (message *Message, err error) {
+	// Detect the version, if needed:
+	if version == MessageVersionAuto {
+		version, err = detectMessageVersion(data)
+		if err != nil {
+			return
+		}
+	}
+
+	// Parse the message:
+	message = new(Message)
+	err = json.Unmarshal(data, message)
+	if err != nil {
+		message = nil
+		return
+	}
+	switch version {
+	case MessageVersionV1:
+		message.Version = ""
+		message.GroupKey = ""
+		message.TruncatedAlerts = 0
+	case MessageVersionV2:
+		if message.Version == "" {
+			err = fmt.Errorf("Message doesn't contain the 'version' field required by format '%s'", version)
+			message = nil
+			return
+		}
+	default:
+		err = fmt.Errorf("Don't know how to parse message version '%s'", version)
+		message = nil
+		return
+	}
+
+	// Copy the common labels and annotations to the alerts, so that they are available when the
+	// alerts are processed independently of the message:
+	for _, alert := range message.Alerts {
+		if alert == nil {
+			continue
+		}
+		alert.commonLabels = message.CommonLabels
+		alert.commonAnnotations = message.CommonAnnotations
+	}
+
+	return
+}
+
+// detectMessageVersion checks if the message contains the version field, which is only present in
+// the v2 format.
+//
+func detectMessageVersion(data []byte) (version MessageVersion, err error) {
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return
+	}
+	if _, ok := fields["version"]; ok {
+		version = MessageVersionV2
+	} else {
+		version = MessageVersionV1
+	}
+	return
+}
@@ -0,0 +1,261 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alertmanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+const v1Message = `{
+  "receiver": "autoheal",
+  "status": "firing",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {
+        "alertname": "NodeDown",
+        "instance": "node0"
+      }
+    }
+  ],
+  "groupLabels": {
+    "alertname": "NodeDown"
+  },
+  "commonLabels": {
+    "alertname": "NodeDown",
+    "severity": "critical"
+  },
+  "commonAnnotations": {
+    "summary": "Node is down"
+  }
+}`
+
+const v2Message = `{
+  "version": "4",
+  "groupKey": "{}:{alertname=\"NodeDown\"}",
+  "truncatedAlerts": 2,
+  "receiver": "autoheal",
+  "status": "firing",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {
+        "alertname": "NodeDown",
+        "instance": "node0"
+      }
+    }
+  ],
+  "groupLabels": {
+    "alertname": "NodeDown"
+  },
+  "commonLabels": {
+    "alertname": "NodeDown",
+    "severity": "critical"
+  },
+  "commonAnnotations": {
+    "summary": "Node is down"
+  }
+}`
+
+func TestParseV1Message(t *testing.T) {
+	message, err := ParseMessage([]byte(v1Message), MessageVersionV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCommonMessage(t, message)
+	if message.Version != "" {
+		t.Errorf("Expected empty version but got %+v", message.Version)
+	}
+}
+
+func TestParseV2Message(t *testing.T) {
+	message, err := ParseMessage([]byte(v2Message), MessageVersionV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCommonMessage(t, message)
+	checkV2Message(t, message)
+}
+
+func TestParseV2MessageAsV1(t *testing.T) {
+	message, err := ParseMessage([]byte(v2Message), MessageVersionV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCommonMessage(t, message)
+	if message.Version != "" || message.GroupKey != "" || message.TruncatedAlerts != 0 {
+		t.Errorf("Expected v2 fields to be ignored but got %+v", message)
+	}
+}
+
+func TestParseV1MessageAsV2(t *testing.T) {
+	_, err := ParseMessage([]byte(v1Message), MessageVersionV2)
+	if err == nil {
+		t.Errorf("Expected an error when parsing a v1 message as v2")
+	}
+}
+
+func TestParseAutoV1Message(t *testing.T) {
+	message, err := ParseMessage([]byte(v1Message), MessageVersionAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCommonMessage(t, message)
+	if message.Version != "" {
+		t.Errorf("Expected empty version but got %+v", message.Version)
+	}
+}
+
+func TestParseAutoV2Message(t *testing.T) {
+	message, err := ParseMessage([]byte(v2Message), MessageVersionAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCommonMessage(t, message)
+	checkV2Message(t, message)
+}
+
+func TestParseInvalidMessage(t *testing.T) {
+	for _, version := range []MessageVersion{MessageVersionV1, MessageVersionV2, MessageVersionAuto} {
+		_, err := ParseMessage([]byte("{"), version)
+		if err == nil {
+			t.Errorf("Expected an error when parsing invalid JSON as %s", version)
+		}
+	}
+}
+
+// webhookMessage is a message like the ones that the alert manager actually sends, including the
+// time stamps and the generator and external URLs.
+//
+const webhookMessage = `{
+  "version": "4",
+  "groupKey": "{}:{alertname=\"NodeDown\"}",
+  "truncatedAlerts": 0,
+  "status": "firing",
+  "receiver": "autoheal",
+  "groupLabels": {
+    "alertname": "NodeDown"
+  },
+  "commonLabels": {
+    "alertname": "NodeDown",
+    "instance": "node0:9100",
+    "severity": "critical"
+  },
+  "commonAnnotations": {
+    "summary": "Node is down"
+  },
+  "externalURL": "http://alertmanager.example.com:9093",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {
+        "alertname": "NodeDown",
+        "instance": "node0:9100",
+        "severity": "critical"
+      },
+      "annotations": {
+        "summary": "Node is down"
+      },
+      "startsAt": "2018-06-12T10:21:05.384Z",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "http://prometheus.example.com:9090/graph?g0.expr=up%7Bjob%3D%22node%22%7D+%3D%3D+0&g0.tab=1",
+      "fingerprint": "1d2e8b7ad0ea2d34"
+    }
+  ]
+}`
+
+func TestParseWebhookMessage(t *testing.T) {
+	for _, version := range []MessageVersion{MessageVersionV2, MessageVersionAuto} {
+		message, err := ParseMessage([]byte(webhookMessage), version)
+		if err != nil {
+			t.Fatalf("Can't parse webhook message as %s: %s", version, err)
+		}
+		if len(message.Alerts) != 1 {
+			t.Fatalf("Expected one alert but got %d", len(message.Alerts))
+		}
+		alert := message.Alerts[0]
+		expected := "http://prometheus.example.com:9090/graph?g0.expr=up%7Bjob%3D%22node%22%7D+%3D%3D+0&g0.tab=1"
+		if alert.GeneratorURL != expected {
+			t.Errorf("Expected generator URL '%s' but got '%s'", expected, alert.GeneratorURL)
+		}
+		if alert.StartsAt.IsZero() {
+			t.Errorf("Expected the start time to be parsed")
+		}
+		if alert.Labels["instance"] != "node0:9100" {
+			t.Errorf("Expected instance 'node0:9100' but got '%s'", alert.Labels["instance"])
+		}
+	}
+}
+
+func TestParseMessageVersion(t *testing.T) {
+	for _, text := range []string{"v1", "v2", "auto"} {
+		version, err := ParseMessageVersion(text)
+		if err != nil {
+			t.Errorf("Expected no error for '%s' but got %s", text, err)
+		}
+		if string(version) != text {
+			t.Errorf("Expected %s but got %s", text, version)
+		}
+	}
+	_, err := ParseMessageVersion("v3")
+	if err == nil {
+		t.Errorf("Expected an error for an invalid version")
+	}
+}
+
+func checkCommonMessage(t *testing.T, message *Message) {
+	if message.Receiver != "autoheal" {
+		t.Errorf("Expected receiver autoheal but got %+v", message.Receiver)
+	}
+	if len(message.Alerts) != 1 {
+		t.Fatalf("Expected one alert but got %d", len(message.Alerts))
+	}
+	alert := message.Alerts[0]
+	if alert.Labels["instance"] != "node0" {
+		t.Errorf("Expected instance node0 but got %+v", alert.Labels["instance"])
+	}
+	expectedLabels := map[string]string{
+		"alertname": "NodeDown",
+		"severity":  "critical",
+	}
+	if !reflect.DeepEqual(expectedLabels, alert.CommonLabels()) {
+		t.Errorf("Expected common labels %+v but got %+v", expectedLabels, alert.CommonLabels())
+	}
+	expectedAnnotations := map[string]string{
+		"summary": "Node is down",
+	}
+	if !reflect.DeepEqual(expectedAnnotations, alert.CommonAnnotations()) {
+		t.Errorf(
+			"Expected common annotations %+v but got %+v",
+			expectedAnnotations,
+			alert.CommonAnnotations(),
+		)
+	}
+}
+
+func checkV2Message(t *testing.T, message *Message) {
+	if message.Version != "4" {
+		t.Errorf("Expected version 4 but got %+v", message.Version)
+	}
+	if message.GroupKey != `{}:{alertname="NodeDown"}` {
+		t.Errorf("Unexpected group key %+v", message.GroupKey)
+	}
+	if message.TruncatedAlerts != 2 {
+		t.Errorf("Expected 2 truncated alerts but got %d", message.TruncatedAlerts)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"encoding/json"
 
 	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -37,6 +38,11 @@ type HealingRule struct {
 	// +optional
 	meta.ObjectMeta `json:"metadata,omitempty"`
 
+	// BasedOn is the name of another rule, loaded before this one, from which this rule inherits the
+	// settings that it doesn't specify itself.
+	// +optional
+	BasedOn string `json:"basedOn,omitempty"`
+
 	// Labels is map containing the names of the labels and the regular expressions that they should
 	// match in order to activate the rule.
 	// +optional
@@ -47,13 +53,81 @@ type HealingRule struct {
 	// +optional
 	Annotations map[string]string `json:"annotations,omitempty"`
 
+	// Severity is the list of values of the 'severity' label of the alert that activate the rule.
+	// It is a shortcut for a pattern for the 'severity' label that matches exactly any of them, and
+	// it is ignored when the labels of the rule already contain a pattern for that label.
+	// +optional
+	Severity []string `json:"severity,omitempty"`
+
+	// GeneratorURLPattern is a regular expression that the generator URL of the alert should match
+	// in order to activate the rule. It is useful when the alerts come from multiple clusters, as
+	// the URL identifies the Prometheus server that fired the alert.
+	// +optional
+	GeneratorURLPattern string `json:"generatorURLPattern,omitempty"`
+
+	// Namespace is a regular expression that the 'namespace' label of the alert should match in
+	// order to activate the rule. When it isn't set the rule is activated by alerts from any
+	// namespace. Note that this isn't the namespace of the rule itself, which is in the metadata.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// CorrelateBy is the list of names of the alert labels that identify the entity affected by the
+	// alert, for example the node. When it is set the rule won't be executed if another rule with
+	// the same list of labels has recently started healing the entity with the same label values.
+	// +optional
+	CorrelateBy []string `json:"correlateBy,omitempty"`
+
+	// ThrottleInterval is how long the actions executed by this rule are remembered, so that they
+	// aren't executed again, for example '10s' or '1h'. When it isn't set the interval from the
+	// throttling section of the configuration is used.
+	// +optional
+	ThrottleInterval string `json:"throttleInterval,omitempty"`
+
+	// Priority determines the order in which the rules that match the same alert are executed, the
+	// rules with higher priority are executed first. Rules with the same priority are executed in
+	// order of name. The default is zero.
+	// +optional
+	Priority int `json:"priority,omitempty"`
+
+	// StopOnFirst indicates that when the action of this rule is started successfully the rules
+	// that match the same alert and come after this one, in order of priority, won't be executed.
+	// +optional
+	StopOnFirst bool `json:"stopOnFirst,omitempty"`
+
+	// Enabled indicates if the rule is used. When it is explicitly set to false the rule is kept,
+	// but it doesn't match any alert. The default, when it isn't set, is true.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Conditions are additional conditions, besides the labels and annotations, that need to be
+	// satisfied in order to activate the rule.
+	// +optional
+	Conditions *HealingRuleConditions `json:"conditions,omitempty"`
+
 	// AWXJob is the AWX job that will be executed when the rule is activated.
 	// +optional
 	AWXJob *AWXJobAction `json:"awxJob,omitempty"`
 
+	// WorkflowJob is the AWX workflow job that will be executed when the rule is activated.
+	// +optional
+	WorkflowJob *AWXWorkflowAction `json:"workflowJob,omitempty"`
+
 	// BatchJob is the batch job that will be executed when the rule is activated.
 	// +optional
 	BatchJob *batch.Job `json:"batchJob,omitempty"`
+
+	// Plugin is the action that will be executed by an action runner loaded from a plugin when the
+	// rule is activated.
+	// +optional
+	Plugin *PluginAction `json:"plugin,omitempty"`
+
+	// WebhookJob is the HTTP request that will be sent when the rule is activated.
+	// +optional
+	WebhookJob *WebhookAction `json:"webhookJob,omitempty"`
+
+	// SlackJob is the message that will be sent to a Slack channel when the rule is activated.
+	// +optional
+	SlackJob *SlackAction `json:"slackJob,omitempty"`
 }
 
 // JsonDoc represents json document
@@ -78,19 +152,182 @@ func (in JsonDoc) DeepCopy() (out JsonDoc) {
 //
 type AWXJobAction struct {
 	// Template is the name of the AWX job template that will be launched.
-	// +optional
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
 	Template string `json:"template,omitempty"`
 
 	// ExtraVars are the extra variables that will be passed to job.
 	// +optional
 	ExtraVars JsonDoc `json:"extraVars,omitempty"`
 
+	// ExtraVarsMergeStrategy indicates how to combine the extra variables of the action with the
+	// global extra variables given in the AWX configuration. The default is Replace.
+	// +optional
+	ExtraVarsMergeStrategy ExtraVarsMergeStrategy `json:"extraVarsMergeStrategy,omitempty"`
+
 	// Limit is a pattern that will be passed to the job to constrain
 	// the hosts that will be affected by the playbook.
 	// +optional
 	Limit string `json:"limit,omitempty"`
+
+	// ServerRef is the name of the AWX server, from the servers section of the configuration, where
+	// the job will be launched. When it is empty the default AWX server is used.
+	// +optional
+	ServerRef string `json:"serverRef,omitempty"`
+}
+
+// AWXWorkflowAction describes how to run an Ansible AWX workflow job. The extra variables are only
+// passed to the workflow job when the template accepts them, as not all of them do.
+//
+type AWXWorkflowAction struct {
+	// Template is the name of the AWX workflow job template that will be launched.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Template string `json:"template,omitempty"`
+
+	// ExtraVars are the extra variables that will be passed to the workflow job.
+	// +optional
+	ExtraVars JsonDoc `json:"extraVars,omitempty"`
+
+	// Limit is a pattern that will be passed to the workflow job to constrain the hosts that will
+	// be affected by the playbooks.
+	// +optional
+	Limit string `json:"limit,omitempty"`
+
+	// ServerRef is the name of the AWX server, from the servers section of the configuration, where
+	// the workflow job will be launched. When it is empty the default AWX server is used.
+	// +optional
+	ServerRef string `json:"serverRef,omitempty"`
 }
 
+// HealingRuleConditions describes the additional conditions that need to be satisfied in order to
+// activate a healing rule. All the conditions that are specified need to be satisfied.
+//
+type HealingRuleConditions struct {
+	// Pod is the condition on the status of the pods affected by the alert.
+	// +optional
+	Pod *PodCondition `json:"pod,omitempty"`
+}
+
+// PodCondition describes a condition that is satisfied when at least one of the pods selected has
+// a condition of the given type with the given status. For example, with the default values, when
+// at least one of the selected pods isn't ready. The namespace and the selector can contain
+// templates that are replaced with values from the alert.
+//
+type PodCondition struct {
+	// Namespace is the namespace of the pods. The default is the namespace of the alert, taken
+	// from its namespace label.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// PodSelector is the label selector used to select the pods, for example
+	// 'app=my-app,tier=frontend'.
+	PodSelector string `json:"podSelector,omitempty"`
+
+	// ConditionType is the type of the pod condition that will be checked. The default is Ready.
+	// +optional
+	ConditionType string `json:"conditionType,omitempty"`
+
+	// ConditionStatus is the status that the condition should have, True, False or Unknown. The
+	// default is False.
+	// +optional
+	ConditionStatus string `json:"conditionStatus,omitempty"`
+}
+
+// PluginAction describes an action executed by an action runner loaded from a plugin.
+//
+type PluginAction struct {
+	// Type is the type of the action runner that will execute the action, as returned by the
+	// ActionRunnerType function of the plugin.
+	Type string `json:"type,omitempty"`
+
+	// Parameters are the parameters that will be passed to the action runner.
+	// +optional
+	Parameters JsonDoc `json:"parameters,omitempty"`
+}
+
+// WebhookAction describes an HTTP request sent to an external service, for example to trigger a
+// pipeline or to open a ticket. The URL, the headers and the body can contain templates that are
+// replaced with values from the alert.
+//
+type WebhookAction struct {
+	// URL is the address where the request will be sent.
+	URL string `json:"url,omitempty"`
+
+	// Method is the HTTP method of the request. The default is POST.
+	// +optional
+	Method string `json:"method,omitempty"`
+
+	// Headers are the HTTP headers that will be added to the request.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Body is the body of the request.
+	// +optional
+	Body string `json:"body,omitempty"`
+
+	// TLSInsecure indicates if the TLS certificate presented by the server should be accepted
+	// without checking it.
+	// +optional
+	TLSInsecure bool `json:"tlsInsecure,omitempty"`
+
+	// SecretRef is a reference to a secret that contains, in its 'token' key, the token that will
+	// be sent in the Authorization header of the request.
+	// +optional
+	SecretRef *core.SecretReference `json:"secretRef,omitempty"`
+
+	// SigningSecretRef is a reference to a secret that contains, in its 'secret' key, the secret
+	// used to sign the body of the request. The signature is sent in the X-Autoheal-Signature
+	// header.
+	// +optional
+	SigningSecretRef *core.SecretReference `json:"signingSecretRef,omitempty"`
+}
+
+// SlackAction describes a message sent to a Slack channel using an incoming webhook. The message
+// and the title can contain templates that are replaced with values from the alert.
+//
+type SlackAction struct {
+	// WebhookURL is the URL of the Slack incoming webhook. It is mandatory unless the secret
+	// reference is given.
+	// +optional
+	WebhookURL string `json:"webhookURL,omitempty"`
+
+	// Channel is the channel where the message will be posted. The default is the channel
+	// configured for the incoming webhook.
+	// +optional
+	Channel string `json:"channel,omitempty"`
+
+	// Message is the text of the message. The default is a message containing the name and the
+	// status of the alert.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// TitleTemplate is the title of the message, written in bold before the text.
+	// +optional
+	TitleTemplate string `json:"titleTemplate,omitempty"`
+
+	// SecretRef is a reference to a secret that contains, in its 'webhookURL' key, the URL of the
+	// Slack incoming webhook. It takes precedence over the URL given in the action.
+	// +optional
+	SecretRef *core.SecretReference `json:"secretRef,omitempty"`
+}
+
+// ExtraVarsMergeStrategy describes how to combine the extra variables of an AWX job action with the
+// global extra variables.
+// +kubebuilder:validation:Enum=Replace;Append
+//
+type ExtraVarsMergeStrategy string
+
+const (
+	// ExtraVarsMergeStrategyReplace means that the extra variables of the action replace the global
+	// ones. The global extra variables are only used when the action doesn't have extra variables.
+	ExtraVarsMergeStrategyReplace ExtraVarsMergeStrategy = "Replace"
+
+	// ExtraVarsMergeStrategyAppend means that the extra variables of the action are merged with the
+	// global ones, and the extra variables of the action take precedence when there are conflicts.
+	ExtraVarsMergeStrategyAppend ExtraVarsMergeStrategy = "Append"
+)
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // HealingRuleList is a list of healing rules.
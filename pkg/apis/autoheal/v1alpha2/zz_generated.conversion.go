@@ -25,6 +25,7 @@ import (
 
 	autoheal "github.com/openshift/autoheal/pkg/apis/autoheal"
 	v1 "k8s.io/api/batch/v1"
+	core_v1 "k8s.io/api/core/v1"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -39,17 +40,31 @@ func RegisterConversions(scheme *runtime.Scheme) error {
 	return scheme.AddGeneratedConversionFuncs(
 		Convert_v1alpha2_AWXJobAction_To_autoheal_AWXJobAction,
 		Convert_autoheal_AWXJobAction_To_v1alpha2_AWXJobAction,
+		Convert_v1alpha2_AWXWorkflowAction_To_autoheal_AWXWorkflowAction,
+		Convert_autoheal_AWXWorkflowAction_To_v1alpha2_AWXWorkflowAction,
 		Convert_v1alpha2_HealingRule_To_autoheal_HealingRule,
 		Convert_autoheal_HealingRule_To_v1alpha2_HealingRule,
+		Convert_v1alpha2_HealingRuleConditions_To_autoheal_HealingRuleConditions,
+		Convert_autoheal_HealingRuleConditions_To_v1alpha2_HealingRuleConditions,
 		Convert_v1alpha2_HealingRuleList_To_autoheal_HealingRuleList,
 		Convert_autoheal_HealingRuleList_To_v1alpha2_HealingRuleList,
+		Convert_v1alpha2_PluginAction_To_autoheal_PluginAction,
+		Convert_autoheal_PluginAction_To_v1alpha2_PluginAction,
+		Convert_v1alpha2_PodCondition_To_autoheal_PodCondition,
+		Convert_autoheal_PodCondition_To_v1alpha2_PodCondition,
+		Convert_v1alpha2_SlackAction_To_autoheal_SlackAction,
+		Convert_autoheal_SlackAction_To_v1alpha2_SlackAction,
+		Convert_v1alpha2_WebhookAction_To_autoheal_WebhookAction,
+		Convert_autoheal_WebhookAction_To_v1alpha2_WebhookAction,
 	)
 }
 
 func autoConvert_v1alpha2_AWXJobAction_To_autoheal_AWXJobAction(in *AWXJobAction, out *autoheal.AWXJobAction, s conversion.Scope) error {
 	out.Template = in.Template
 	out.ExtraVars = *(*autoheal.JsonDoc)(unsafe.Pointer(&in.ExtraVars))
+	out.ExtraVarsMergeStrategy = autoheal.ExtraVarsMergeStrategy(in.ExtraVarsMergeStrategy)
 	out.Limit = in.Limit
+	out.ServerRef = in.ServerRef
 	return nil
 }
 
@@ -61,7 +76,9 @@ func Convert_v1alpha2_AWXJobAction_To_autoheal_AWXJobAction(in *AWXJobAction, ou
 func autoConvert_autoheal_AWXJobAction_To_v1alpha2_AWXJobAction(in *autoheal.AWXJobAction, out *AWXJobAction, s conversion.Scope) error {
 	out.Template = in.Template
 	out.ExtraVars = *(*JsonDoc)(unsafe.Pointer(&in.ExtraVars))
+	out.ExtraVarsMergeStrategy = ExtraVarsMergeStrategy(in.ExtraVarsMergeStrategy)
 	out.Limit = in.Limit
+	out.ServerRef = in.ServerRef
 	return nil
 }
 
@@ -70,12 +87,52 @@ func Convert_autoheal_AWXJobAction_To_v1alpha2_AWXJobAction(in *autoheal.AWXJobA
 	return autoConvert_autoheal_AWXJobAction_To_v1alpha2_AWXJobAction(in, out, s)
 }
 
+func autoConvert_v1alpha2_AWXWorkflowAction_To_autoheal_AWXWorkflowAction(in *AWXWorkflowAction, out *autoheal.AWXWorkflowAction, s conversion.Scope) error {
+	out.Template = in.Template
+	out.ExtraVars = *(*autoheal.JsonDoc)(unsafe.Pointer(&in.ExtraVars))
+	out.Limit = in.Limit
+	out.ServerRef = in.ServerRef
+	return nil
+}
+
+// Convert_v1alpha2_AWXWorkflowAction_To_autoheal_AWXWorkflowAction is an autogenerated conversion function.
+func Convert_v1alpha2_AWXWorkflowAction_To_autoheal_AWXWorkflowAction(in *AWXWorkflowAction, out *autoheal.AWXWorkflowAction, s conversion.Scope) error {
+	return autoConvert_v1alpha2_AWXWorkflowAction_To_autoheal_AWXWorkflowAction(in, out, s)
+}
+
+func autoConvert_autoheal_AWXWorkflowAction_To_v1alpha2_AWXWorkflowAction(in *autoheal.AWXWorkflowAction, out *AWXWorkflowAction, s conversion.Scope) error {
+	out.Template = in.Template
+	out.ExtraVars = *(*JsonDoc)(unsafe.Pointer(&in.ExtraVars))
+	out.Limit = in.Limit
+	out.ServerRef = in.ServerRef
+	return nil
+}
+
+// Convert_autoheal_AWXWorkflowAction_To_v1alpha2_AWXWorkflowAction is an autogenerated conversion function.
+func Convert_autoheal_AWXWorkflowAction_To_v1alpha2_AWXWorkflowAction(in *autoheal.AWXWorkflowAction, out *AWXWorkflowAction, s conversion.Scope) error {
+	return autoConvert_autoheal_AWXWorkflowAction_To_v1alpha2_AWXWorkflowAction(in, out, s)
+}
+
 func autoConvert_v1alpha2_HealingRule_To_autoheal_HealingRule(in *HealingRule, out *autoheal.HealingRule, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
+	out.BasedOn = in.BasedOn
 	out.Labels = *(*map[string]string)(unsafe.Pointer(&in.Labels))
 	out.Annotations = *(*map[string]string)(unsafe.Pointer(&in.Annotations))
+	out.Severity = *(*[]string)(unsafe.Pointer(&in.Severity))
+	out.GeneratorURLPattern = in.GeneratorURLPattern
+	out.Namespace = in.Namespace
+	out.CorrelateBy = *(*[]string)(unsafe.Pointer(&in.CorrelateBy))
+	out.ThrottleInterval = in.ThrottleInterval
+	out.Priority = in.Priority
+	out.StopOnFirst = in.StopOnFirst
+	out.Enabled = (*bool)(unsafe.Pointer(in.Enabled))
+	out.Conditions = (*autoheal.HealingRuleConditions)(unsafe.Pointer(in.Conditions))
 	out.AWXJob = (*autoheal.AWXJobAction)(unsafe.Pointer(in.AWXJob))
+	out.WorkflowJob = (*autoheal.AWXWorkflowAction)(unsafe.Pointer(in.WorkflowJob))
 	out.BatchJob = (*v1.Job)(unsafe.Pointer(in.BatchJob))
+	out.Plugin = (*autoheal.PluginAction)(unsafe.Pointer(in.Plugin))
+	out.WebhookJob = (*autoheal.WebhookAction)(unsafe.Pointer(in.WebhookJob))
+	out.SlackJob = (*autoheal.SlackAction)(unsafe.Pointer(in.SlackJob))
 	return nil
 }
 
@@ -86,10 +143,24 @@ func Convert_v1alpha2_HealingRule_To_autoheal_HealingRule(in *HealingRule, out *
 
 func autoConvert_autoheal_HealingRule_To_v1alpha2_HealingRule(in *autoheal.HealingRule, out *HealingRule, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
+	out.BasedOn = in.BasedOn
 	out.Labels = *(*map[string]string)(unsafe.Pointer(&in.Labels))
 	out.Annotations = *(*map[string]string)(unsafe.Pointer(&in.Annotations))
+	out.Severity = *(*[]string)(unsafe.Pointer(&in.Severity))
+	out.GeneratorURLPattern = in.GeneratorURLPattern
+	out.Namespace = in.Namespace
+	out.CorrelateBy = *(*[]string)(unsafe.Pointer(&in.CorrelateBy))
+	out.ThrottleInterval = in.ThrottleInterval
+	out.Priority = in.Priority
+	out.StopOnFirst = in.StopOnFirst
+	out.Enabled = (*bool)(unsafe.Pointer(in.Enabled))
+	out.Conditions = (*HealingRuleConditions)(unsafe.Pointer(in.Conditions))
 	out.AWXJob = (*AWXJobAction)(unsafe.Pointer(in.AWXJob))
+	out.WorkflowJob = (*AWXWorkflowAction)(unsafe.Pointer(in.WorkflowJob))
 	out.BatchJob = (*v1.Job)(unsafe.Pointer(in.BatchJob))
+	out.Plugin = (*PluginAction)(unsafe.Pointer(in.Plugin))
+	out.WebhookJob = (*WebhookAction)(unsafe.Pointer(in.WebhookJob))
+	out.SlackJob = (*SlackAction)(unsafe.Pointer(in.SlackJob))
 	return nil
 }
 
@@ -98,6 +169,26 @@ func Convert_autoheal_HealingRule_To_v1alpha2_HealingRule(in *autoheal.HealingRu
 	return autoConvert_autoheal_HealingRule_To_v1alpha2_HealingRule(in, out, s)
 }
 
+func autoConvert_v1alpha2_HealingRuleConditions_To_autoheal_HealingRuleConditions(in *HealingRuleConditions, out *autoheal.HealingRuleConditions, s conversion.Scope) error {
+	out.Pod = (*autoheal.PodCondition)(unsafe.Pointer(in.Pod))
+	return nil
+}
+
+// Convert_v1alpha2_HealingRuleConditions_To_autoheal_HealingRuleConditions is an autogenerated conversion function.
+func Convert_v1alpha2_HealingRuleConditions_To_autoheal_HealingRuleConditions(in *HealingRuleConditions, out *autoheal.HealingRuleConditions, s conversion.Scope) error {
+	return autoConvert_v1alpha2_HealingRuleConditions_To_autoheal_HealingRuleConditions(in, out, s)
+}
+
+func autoConvert_autoheal_HealingRuleConditions_To_v1alpha2_HealingRuleConditions(in *autoheal.HealingRuleConditions, out *HealingRuleConditions, s conversion.Scope) error {
+	out.Pod = (*PodCondition)(unsafe.Pointer(in.Pod))
+	return nil
+}
+
+// Convert_autoheal_HealingRuleConditions_To_v1alpha2_HealingRuleConditions is an autogenerated conversion function.
+func Convert_autoheal_HealingRuleConditions_To_v1alpha2_HealingRuleConditions(in *autoheal.HealingRuleConditions, out *HealingRuleConditions, s conversion.Scope) error {
+	return autoConvert_autoheal_HealingRuleConditions_To_v1alpha2_HealingRuleConditions(in, out, s)
+}
+
 func autoConvert_v1alpha2_HealingRuleList_To_autoheal_HealingRuleList(in *HealingRuleList, out *autoheal.HealingRuleList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
 	out.Items = *(*[]autoheal.HealingRule)(unsafe.Pointer(&in.Items))
@@ -119,3 +210,111 @@ func autoConvert_autoheal_HealingRuleList_To_v1alpha2_HealingRuleList(in *autohe
 func Convert_autoheal_HealingRuleList_To_v1alpha2_HealingRuleList(in *autoheal.HealingRuleList, out *HealingRuleList, s conversion.Scope) error {
 	return autoConvert_autoheal_HealingRuleList_To_v1alpha2_HealingRuleList(in, out, s)
 }
+
+func autoConvert_v1alpha2_PluginAction_To_autoheal_PluginAction(in *PluginAction, out *autoheal.PluginAction, s conversion.Scope) error {
+	out.Type = in.Type
+	out.Parameters = *(*autoheal.JsonDoc)(unsafe.Pointer(&in.Parameters))
+	return nil
+}
+
+// Convert_v1alpha2_PluginAction_To_autoheal_PluginAction is an autogenerated conversion function.
+func Convert_v1alpha2_PluginAction_To_autoheal_PluginAction(in *PluginAction, out *autoheal.PluginAction, s conversion.Scope) error {
+	return autoConvert_v1alpha2_PluginAction_To_autoheal_PluginAction(in, out, s)
+}
+
+func autoConvert_autoheal_PluginAction_To_v1alpha2_PluginAction(in *autoheal.PluginAction, out *PluginAction, s conversion.Scope) error {
+	out.Type = in.Type
+	out.Parameters = *(*JsonDoc)(unsafe.Pointer(&in.Parameters))
+	return nil
+}
+
+// Convert_autoheal_PluginAction_To_v1alpha2_PluginAction is an autogenerated conversion function.
+func Convert_autoheal_PluginAction_To_v1alpha2_PluginAction(in *autoheal.PluginAction, out *PluginAction, s conversion.Scope) error {
+	return autoConvert_autoheal_PluginAction_To_v1alpha2_PluginAction(in, out, s)
+}
+
+func autoConvert_v1alpha2_PodCondition_To_autoheal_PodCondition(in *PodCondition, out *autoheal.PodCondition, s conversion.Scope) error {
+	out.Namespace = in.Namespace
+	out.PodSelector = in.PodSelector
+	out.ConditionType = in.ConditionType
+	out.ConditionStatus = in.ConditionStatus
+	return nil
+}
+
+// Convert_v1alpha2_PodCondition_To_autoheal_PodCondition is an autogenerated conversion function.
+func Convert_v1alpha2_PodCondition_To_autoheal_PodCondition(in *PodCondition, out *autoheal.PodCondition, s conversion.Scope) error {
+	return autoConvert_v1alpha2_PodCondition_To_autoheal_PodCondition(in, out, s)
+}
+
+func autoConvert_autoheal_PodCondition_To_v1alpha2_PodCondition(in *autoheal.PodCondition, out *PodCondition, s conversion.Scope) error {
+	out.Namespace = in.Namespace
+	out.PodSelector = in.PodSelector
+	out.ConditionType = in.ConditionType
+	out.ConditionStatus = in.ConditionStatus
+	return nil
+}
+
+// Convert_autoheal_PodCondition_To_v1alpha2_PodCondition is an autogenerated conversion function.
+func Convert_autoheal_PodCondition_To_v1alpha2_PodCondition(in *autoheal.PodCondition, out *PodCondition, s conversion.Scope) error {
+	return autoConvert_autoheal_PodCondition_To_v1alpha2_PodCondition(in, out, s)
+}
+
+func autoConvert_v1alpha2_SlackAction_To_autoheal_SlackAction(in *SlackAction, out *autoheal.SlackAction, s conversion.Scope) error {
+	out.WebhookURL = in.WebhookURL
+	out.Channel = in.Channel
+	out.Message = in.Message
+	out.TitleTemplate = in.TitleTemplate
+	out.SecretRef = (*core_v1.SecretReference)(unsafe.Pointer(in.SecretRef))
+	return nil
+}
+
+// Convert_v1alpha2_SlackAction_To_autoheal_SlackAction is an autogenerated conversion function.
+func Convert_v1alpha2_SlackAction_To_autoheal_SlackAction(in *SlackAction, out *autoheal.SlackAction, s conversion.Scope) error {
+	return autoConvert_v1alpha2_SlackAction_To_autoheal_SlackAction(in, out, s)
+}
+
+func autoConvert_autoheal_SlackAction_To_v1alpha2_SlackAction(in *autoheal.SlackAction, out *SlackAction, s conversion.Scope) error {
+	out.WebhookURL = in.WebhookURL
+	out.Channel = in.Channel
+	out.Message = in.Message
+	out.TitleTemplate = in.TitleTemplate
+	out.SecretRef = (*core_v1.SecretReference)(unsafe.Pointer(in.SecretRef))
+	return nil
+}
+
+// Convert_autoheal_SlackAction_To_v1alpha2_SlackAction is an autogenerated conversion function.
+func Convert_autoheal_SlackAction_To_v1alpha2_SlackAction(in *autoheal.SlackAction, out *SlackAction, s conversion.Scope) error {
+	return autoConvert_autoheal_SlackAction_To_v1alpha2_SlackAction(in, out, s)
+}
+
+func autoConvert_v1alpha2_WebhookAction_To_autoheal_WebhookAction(in *WebhookAction, out *autoheal.WebhookAction, s conversion.Scope) error {
+	out.URL = in.URL
+	out.Method = in.Method
+	out.Headers = *(*map[string]string)(unsafe.Pointer(&in.Headers))
+	out.Body = in.Body
+	out.TLSInsecure = in.TLSInsecure
+	out.SecretRef = (*core_v1.SecretReference)(unsafe.Pointer(in.SecretRef))
+	out.SigningSecretRef = (*core_v1.SecretReference)(unsafe.Pointer(in.SigningSecretRef))
+	return nil
+}
+
+// Convert_v1alpha2_WebhookAction_To_autoheal_WebhookAction is an autogenerated conversion function.
+func Convert_v1alpha2_WebhookAction_To_autoheal_WebhookAction(in *WebhookAction, out *autoheal.WebhookAction, s conversion.Scope) error {
+	return autoConvert_v1alpha2_WebhookAction_To_autoheal_WebhookAction(in, out, s)
+}
+
+func autoConvert_autoheal_WebhookAction_To_v1alpha2_WebhookAction(in *autoheal.WebhookAction, out *WebhookAction, s conversion.Scope) error {
+	out.URL = in.URL
+	out.Method = in.Method
+	out.Headers = *(*map[string]string)(unsafe.Pointer(&in.Headers))
+	out.Body = in.Body
+	out.TLSInsecure = in.TLSInsecure
+	out.SecretRef = (*core_v1.SecretReference)(unsafe.Pointer(in.SecretRef))
+	out.SigningSecretRef = (*core_v1.SecretReference)(unsafe.Pointer(in.SigningSecretRef))
+	return nil
+}
+
+// Convert_autoheal_WebhookAction_To_v1alpha2_WebhookAction is an autogenerated conversion function.
+func Convert_autoheal_WebhookAction_To_v1alpha2_WebhookAction(in *autoheal.WebhookAction, out *WebhookAction, s conversion.Scope) error {
+	return autoConvert_autoheal_WebhookAction_To_v1alpha2_WebhookAction(in, out, s)
+}
@@ -22,6 +22,7 @@ package v1alpha2
 
 import (
 	v1 "k8s.io/api/batch/v1"
+	core_v1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -42,6 +43,23 @@ func (in *AWXJobAction) DeepCopy() *AWXJobAction {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AWXWorkflowAction) DeepCopyInto(out *AWXWorkflowAction) {
+	*out = *in
+	out.ExtraVars = in.ExtraVars.DeepCopy()
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWXWorkflowAction.
+func (in *AWXWorkflowAction) DeepCopy() *AWXWorkflowAction {
+	if in == nil {
+		return nil
+	}
+	out := new(AWXWorkflowAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HealingRule) DeepCopyInto(out *HealingRule) {
 	*out = *in
@@ -61,6 +79,34 @@ func (in *HealingRule) DeepCopyInto(out *HealingRule) {
 			(*out)[key] = val
 		}
 	}
+	if in.Severity != nil {
+		in, out := &in.Severity, &out.Severity
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CorrelateBy != nil {
+		in, out := &in.CorrelateBy, &out.CorrelateBy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(bool)
+			**out = **in
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(HealingRuleConditions)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	if in.AWXJob != nil {
 		in, out := &in.AWXJob, &out.AWXJob
 		if *in == nil {
@@ -70,6 +116,15 @@ func (in *HealingRule) DeepCopyInto(out *HealingRule) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.WorkflowJob != nil {
+		in, out := &in.WorkflowJob, &out.WorkflowJob
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(AWXWorkflowAction)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	if in.BatchJob != nil {
 		in, out := &in.BatchJob, &out.BatchJob
 		if *in == nil {
@@ -79,6 +134,33 @@ func (in *HealingRule) DeepCopyInto(out *HealingRule) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.Plugin != nil {
+		in, out := &in.Plugin, &out.Plugin
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(PluginAction)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.WebhookJob != nil {
+		in, out := &in.WebhookJob, &out.WebhookJob
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(WebhookAction)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.SlackJob != nil {
+		in, out := &in.SlackJob, &out.SlackJob
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(SlackAction)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -100,6 +182,31 @@ func (in *HealingRule) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HealingRuleConditions) DeepCopyInto(out *HealingRuleConditions) {
+	*out = *in
+	if in.Pod != nil {
+		in, out := &in.Pod, &out.Pod
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(PodCondition)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HealingRuleConditions.
+func (in *HealingRuleConditions) DeepCopy() *HealingRuleConditions {
+	if in == nil {
+		return nil
+	}
+	out := new(HealingRuleConditions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HealingRuleList) DeepCopyInto(out *HealingRuleList) {
 	*out = *in
@@ -141,3 +248,102 @@ func (in JsonDoc) DeepCopyInto(out *JsonDoc) {
 		return
 	}
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PluginAction) DeepCopyInto(out *PluginAction) {
+	*out = *in
+	out.Parameters = in.Parameters.DeepCopy()
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginAction.
+func (in *PluginAction) DeepCopy() *PluginAction {
+	if in == nil {
+		return nil
+	}
+	out := new(PluginAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodCondition) DeepCopyInto(out *PodCondition) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodCondition.
+func (in *PodCondition) DeepCopy() *PodCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(PodCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SlackAction) DeepCopyInto(out *SlackAction) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.SecretReference)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SlackAction.
+func (in *SlackAction) DeepCopy() *SlackAction {
+	if in == nil {
+		return nil
+	}
+	out := new(SlackAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookAction) DeepCopyInto(out *WebhookAction) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.SecretReference)
+			**out = **in
+		}
+	}
+	if in.SigningSecretRef != nil {
+		in, out := &in.SigningSecretRef, &out.SigningSecretRef
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(core_v1.SecretReference)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookAction.
+func (in *WebhookAction) DeepCopy() *WebhookAction {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookAction)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,300 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the recorder that writes the audit log entries to a config map.
+
+package auditlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DataKey is the key of the config map that contains the entries, as a JSON array.
+//
+const DataKey = "entries.json"
+
+// Entry describes an attempt to execute a healing action.
+//
+type Entry struct {
+	// The time when the action was executed.
+	Timestamp time.Time `json:"timestamp"`
+
+	// The name of the rule that triggered the action.
+	RuleName string `json:"ruleName"`
+
+	// The name of the alert that triggered the action.
+	AlertName string `json:"alertName"`
+
+	// The type of the action, for example 'AWXJobAction'.
+	ActionType string `json:"actionType"`
+
+	// Whether the action was started successfully.
+	Success bool `json:"success"`
+}
+
+// RecorderBuilder is used to create audit log recorders.
+//
+type RecorderBuilder struct {
+	k8sClient     kubernetes.Interface
+	namespace     string
+	name          string
+	flushInterval time.Duration
+	maxEntries    int
+}
+
+// Recorder collects audit log entries in memory, and periodically appends them to a config map.
+//
+type Recorder struct {
+	// The Kubernetes client used to read and write the config map.
+	k8sClient kubernetes.Interface
+
+	// The namespace and name of the config map.
+	namespace string
+	name      string
+
+	// How often the collected entries are written to the config map.
+	flushInterval time.Duration
+
+	// The maximum number of entries kept in the config map. When it is exceeded the oldest entries
+	// are discarded.
+	maxEntries int
+
+	// The entries that haven't been written to the config map yet. The mutex protects this slice,
+	// and the flush mutex prevents running several flushes simultaneously.
+	pending    []*Entry
+	mutex      *sync.Mutex
+	flushMutex *sync.Mutex
+}
+
+// NewRecorderBuilder creates a new builder for audit log recorders.
+//
+func NewRecorderBuilder() *RecorderBuilder {
+	b := new(RecorderBuilder)
+	b.namespace = meta.NamespaceDefault
+	b.name = "autoheal-audit"
+	b.flushInterval = 30 * time.Second
+	b.maxEntries = 1000
+	return b
+}
+
+// KubernetesClient sets the Kubernetes client that will be used to read and write the config map.
+// It is mandatory.
+//
+func (b *RecorderBuilder) KubernetesClient(client kubernetes.Interface) *RecorderBuilder {
+	b.k8sClient = client
+	return b
+}
+
+// Namespace sets the namespace of the config map. The default is 'default'.
+//
+func (b *RecorderBuilder) Namespace(namespace string) *RecorderBuilder {
+	b.namespace = namespace
+	return b
+}
+
+// Name sets the name of the config map. The default is 'autoheal-audit'.
+//
+func (b *RecorderBuilder) Name(name string) *RecorderBuilder {
+	b.name = name
+	return b
+}
+
+// FlushInterval sets how often the entries collected in memory are written to the config map. The
+// default is thirty seconds.
+//
+func (b *RecorderBuilder) FlushInterval(interval time.Duration) *RecorderBuilder {
+	b.flushInterval = interval
+	return b
+}
+
+// MaxEntries sets the maximum number of entries kept in the config map, so that it doesn't grow
+// without limit. When it is exceeded the oldest entries are discarded. The default is 1000.
+//
+func (b *RecorderBuilder) MaxEntries(max int) *RecorderBuilder {
+	b.maxEntries = max
+	return b
+}
+
+// Build creates a new audit log recorder with the configuration stored in the builder.
+//
+func (b *RecorderBuilder) Build() (r *Recorder, err error) {
+	// Check the parameters:
+	if b.k8sClient == nil {
+		err = fmt.Errorf("The Kubernetes client is mandatory")
+		return
+	}
+	if b.namespace == "" || b.name == "" {
+		err = fmt.Errorf("The namespace and name of the audit config map are mandatory")
+		return
+	}
+	if b.flushInterval <= 0 {
+		err = fmt.Errorf("Audit flush interval %s isn't valid, it must be positive", b.flushInterval)
+		return
+	}
+	if b.maxEntries <= 0 {
+		err = fmt.Errorf("Audit maximum entries %d isn't valid, it must be positive", b.maxEntries)
+		return
+	}
+
+	// Create the recorder:
+	r = new(Recorder)
+	r.k8sClient = b.k8sClient
+	r.namespace = b.namespace
+	r.name = b.name
+	r.flushInterval = b.flushInterval
+	r.maxEntries = b.maxEntries
+	r.mutex = &sync.Mutex{}
+	r.flushMutex = &sync.Mutex{}
+
+	return
+}
+
+// Record adds an entry to the audit log. The entry is kept in memory till the next flush.
+//
+func (r *Recorder) Record(entry *Entry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pending = append(r.pending, entry)
+}
+
+// Start starts the goroutine that periodically writes the collected entries to the config map. When
+// the stop channel is closed the entries that are still pending are written.
+//
+func (r *Recorder) Start(stopCh <-chan struct{}) {
+	go wait.Until(r.flushAndLog, r.flushInterval, stopCh)
+	go func() {
+		<-stopCh
+		r.flushAndLog()
+	}()
+}
+
+// flushAndLog writes the pending entries to the config map, and sends to the log the error, if
+// any.
+//
+func (r *Recorder) flushAndLog() {
+	err := r.Flush()
+	if err != nil {
+		glog.Errorf("Can't write audit log to config map '%s/%s': %s", r.namespace, r.name, err)
+	}
+}
+
+// Flush writes the pending entries to the config map, creating it if it doesn't exist. If the
+// write fails the entries are kept and the next flush will try again.
+//
+func (r *Recorder) Flush() error {
+	r.flushMutex.Lock()
+	defer r.flushMutex.Unlock()
+
+	// Take the pending entries:
+	r.mutex.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.mutex.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := r.write(pending)
+	if err != nil {
+		// Put back the entries, before the ones that have been recorded meanwhile, discarding the
+		// oldest ones if there are too many:
+		r.mutex.Lock()
+		r.pending = r.trim(append(pending, r.pending...))
+		r.mutex.Unlock()
+	}
+	return err
+}
+
+// write appends the given entries to the ones already stored in the config map.
+//
+func (r *Recorder) write(entries []*Entry) error {
+	resource := r.k8sClient.CoreV1().ConfigMaps(r.namespace)
+	configMap, err := resource.Get(r.name, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		configMap = &core.ConfigMap{
+			ObjectMeta: meta.ObjectMeta{
+				Name: r.name,
+			},
+		}
+		err = r.merge(configMap, entries)
+		if err != nil {
+			return err
+		}
+		_, err = resource.Create(configMap)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	err = r.merge(configMap, entries)
+	if err != nil {
+		return err
+	}
+	_, err = resource.Update(configMap)
+	return err
+}
+
+// merge adds the given entries to the ones stored in the data of the given config map, discarding
+// the oldest ones if there are too many.
+//
+func (r *Recorder) merge(configMap *core.ConfigMap, entries []*Entry) error {
+	var stored []*Entry
+	data := configMap.Data[DataKey]
+	if data != "" {
+		err := json.Unmarshal([]byte(data), &stored)
+		if err != nil {
+			// Don't fail if the content has been damaged, otherwise the audit log would never be
+			// written again:
+			glog.Warningf(
+				"Can't parse audit log from config map '%s/%s', it will be replaced: %s",
+				r.namespace,
+				r.name,
+				err,
+			)
+			stored = nil
+		}
+	}
+	stored = r.trim(append(stored, entries...))
+	bytes, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[DataKey] = string(bytes)
+	return nil
+}
+
+// trim discards the oldest entries of the given slice, so that it contains at most the maximum
+// number of entries.
+//
+func (r *Recorder) trim(entries []*Entry) []*Entry {
+	if len(entries) > r.maxEntries {
+		entries = entries[len(entries)-r.maxEntries:]
+	}
+	return entries
+}
@@ -0,0 +1,240 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auditlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+func TestFlushCreatesConfigMap(t *testing.T) {
+	configMaps := &fakeConfigMaps{
+		items: make(map[string]*core.ConfigMap),
+	}
+	recorder := makeRecorder(t, configMaps, 10)
+
+	recorder.Record(makeEntry("my-rule", true))
+	err := recorder.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if configMaps.namespace != "my-namespace" {
+		t.Errorf("Expected namespace 'my-namespace', but got '%s'", configMaps.namespace)
+	}
+	entries := readEntries(t, configMaps, "my-audit")
+	if len(entries) != 1 {
+		t.Fatalf("Expected one entry, but got %d", len(entries))
+	}
+	if entries[0].RuleName != "my-rule" || !entries[0].Success {
+		t.Errorf("Expected successful entry for rule 'my-rule', but got %+v", entries[0])
+	}
+}
+
+func TestFlushAppendsAndTrimsEntries(t *testing.T) {
+	configMaps := &fakeConfigMaps{
+		items: make(map[string]*core.ConfigMap),
+	}
+	recorder := makeRecorder(t, configMaps, 3)
+
+	for i := 0; i < 2; i++ {
+		recorder.Record(makeEntry(fmt.Sprintf("rule-%d", i), true))
+	}
+	err := recorder.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i < 5; i++ {
+		recorder.Record(makeEntry(fmt.Sprintf("rule-%d", i), false))
+	}
+	err = recorder.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the newest entries should have been kept:
+	entries := readEntries(t, configMaps, "my-audit")
+	if len(entries) != 3 {
+		t.Fatalf("Expected three entries, but got %d", len(entries))
+	}
+	for i, entry := range entries {
+		expected := fmt.Sprintf("rule-%d", i+2)
+		if entry.RuleName != expected {
+			t.Errorf("Expected entry %d to be for rule '%s', but got '%s'", i, expected, entry.RuleName)
+		}
+	}
+}
+
+func TestFlushWithoutEntriesDoesNothing(t *testing.T) {
+	configMaps := &fakeConfigMaps{
+		items: make(map[string]*core.ConfigMap),
+	}
+	recorder := makeRecorder(t, configMaps, 10)
+
+	err := recorder.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configMaps.items) != 0 {
+		t.Errorf("Expected no config map to be created, but got %d", len(configMaps.items))
+	}
+}
+
+func TestFailedFlushKeepsEntries(t *testing.T) {
+	configMaps := &fakeConfigMaps{
+		items: make(map[string]*core.ConfigMap),
+		err:   fmt.Errorf("API server unavailable"),
+	}
+	recorder := makeRecorder(t, configMaps, 10)
+
+	recorder.Record(makeEntry("my-rule", true))
+	err := recorder.Flush()
+	if err == nil {
+		t.Fatalf("Expected the flush to fail")
+	}
+
+	// Once the API server is available again the entry should be written:
+	configMaps.err = nil
+	err = recorder.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readEntries(t, configMaps, "my-audit")
+	if len(entries) != 1 {
+		t.Fatalf("Expected one entry, but got %d", len(entries))
+	}
+}
+
+func TestBuildRejectsInvalidParameters(t *testing.T) {
+	client := &fakeClient{configMaps: &fakeConfigMaps{}}
+	builders := map[string]*RecorderBuilder{
+		"no client":         NewRecorderBuilder(),
+		"no name":           NewRecorderBuilder().KubernetesClient(client).Name(""),
+		"zero interval":     NewRecorderBuilder().KubernetesClient(client).FlushInterval(0),
+		"negative max":      NewRecorderBuilder().KubernetesClient(client).MaxEntries(-1),
+		"zero max entries": NewRecorderBuilder().KubernetesClient(client).MaxEntries(0),
+	}
+	for name, builder := range builders {
+		_, err := builder.Build()
+		if err == nil {
+			t.Errorf("Expected an error for builder with %s", name)
+		}
+	}
+}
+
+func makeRecorder(t *testing.T, configMaps *fakeConfigMaps, max int) *Recorder {
+	recorder, err := NewRecorderBuilder().
+		KubernetesClient(&fakeClient{configMaps: configMaps}).
+		Namespace("my-namespace").
+		Name("my-audit").
+		MaxEntries(max).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recorder
+}
+
+func makeEntry(rule string, success bool) *Entry {
+	return &Entry{
+		Timestamp:  time.Now(),
+		RuleName:   rule,
+		AlertName:  "NodeDown",
+		ActionType: "AWXJobAction",
+		Success:    success,
+	}
+}
+
+func readEntries(t *testing.T, configMaps *fakeConfigMaps, name string) []*Entry {
+	configMap, ok := configMaps.items[name]
+	if !ok {
+		t.Fatalf("Expected config map '%s' to exist", name)
+	}
+	var entries []*Entry
+	err := json.Unmarshal([]byte(configMap.Data[DataKey]), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// fakeClient is a Kubernetes client that only implements the parts of the API used to manage
+// config maps. Calling any other method will panic.
+//
+type fakeClient struct {
+	kubernetes.Interface
+	configMaps *fakeConfigMaps
+}
+
+func (c *fakeClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeCoreV1{configMaps: c.configMaps}
+}
+
+type fakeCoreV1 struct {
+	corev1.CoreV1Interface
+	configMaps *fakeConfigMaps
+}
+
+func (c *fakeCoreV1) ConfigMaps(namespace string) corev1.ConfigMapInterface {
+	c.configMaps.namespace = namespace
+	return c.configMaps
+}
+
+// fakeConfigMaps keeps the config maps in memory, indexed by name. It remembers the namespace used,
+// and returns the given error, if any, from all the methods.
+//
+type fakeConfigMaps struct {
+	corev1.ConfigMapInterface
+	items     map[string]*core.ConfigMap
+	namespace string
+	err       error
+}
+
+func (c *fakeConfigMaps) Get(name string, options meta.GetOptions) (*core.ConfigMap, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	configMap, ok := c.items[name]
+	if !ok {
+		return nil, errors.NewNotFound(core.Resource("configmaps"), name)
+	}
+	return configMap.DeepCopy(), nil
+}
+
+func (c *fakeConfigMaps) Create(configMap *core.ConfigMap) (*core.ConfigMap, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.items[configMap.ObjectMeta.Name] = configMap
+	return configMap, nil
+}
+
+func (c *fakeConfigMaps) Update(configMap *core.ConfigMap) (*core.ConfigMap, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.items[configMap.ObjectMeta.Name] = configMap
+	return configMap, nil
+}
@@ -17,42 +17,214 @@ limitations under the License.
 package awxrunner
 
 import (
-	"github.com/golang/glog"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/moolitayer/awx-client-go/awx"
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/logging"
 	"github.com/openshift/autoheal/pkg/metrics"
 	"k8s.io/apimachinery/pkg/util/runtime"
 )
 
+// cleanupInterval is how often the worker that removes stale active jobs runs.
+//
+const cleanupInterval = 24 * time.Hour
+
+// defaultDrainCheckInterval is the maximum time between checks of the status of the active jobs
+// while waiting for them to finish. The configured check interval is used if it is shorter.
+//
+const defaultDrainCheckInterval = 10 * time.Second
+
+// jobKind indicates if an active job is a regular job or a workflow job. They are handled by
+// different parts of the AWX API, and their identifiers are independent.
+//
+type jobKind int
+
+const (
+	regularJob jobKind = iota
+	workflowJob
+)
+
+// String returns the name of the kind of job, for use in log messages.
+//
+func (k jobKind) String() string {
+	if k == workflowJob {
+		return "workflow job"
+	}
+	return "job"
+}
+
+// activeJobKey identifies an active job. The identifiers of the jobs are only unique within an AWX
+// server and kind of job, so the key also contains the name of the server where the job was
+// launched, empty for the default server, and the kind.
+//
+type activeJobKey struct {
+	server string
+	kind   jobKind
+	id     int
+}
+
+// activeJob contains the information that the runner keeps for each job that it launched and that
+// hasn't finished yet.
+//
+type activeJob struct {
+	// The rule that launched the job.
+	rule *autoheal.HealingRule
+
+	// The complete set of labels of the alert that triggered the job, as returned by the LabelsKey
+	// method of the alert.
+	alert string
+
+	// The time when the job was launched.
+	created time.Time
+}
+
 func (r *Runner) runActiveJobsWorker() {
-	glog.Infof("Going over active jobs queue")
+	logging.Infof("Going over active jobs queue")
 
-	finishedJobs := make([]int, 0)
+	finishedJobs := make([]activeJobKey, 0)
 
 	r.activeJobs.Range(func(key interface{}, value interface{}) bool {
-		id := key.(int)
-		rule := value.(*autoheal.HealingRule)
-		finished, err := r.checkAWXJobStatus(id)
+		jobKey := key.(activeJobKey)
+		job := value.(*activeJob)
+		status, finished, err := r.checkAWXJobStatus(jobKey)
 		if err != nil {
 			runtime.HandleError(err)
 		}
 
 		if finished {
-			finishedJobs = append(finishedJobs, id)
-			metrics.ActionCompleted(
-				"AWXJob",
-				rule.AWXJob.Template,
-				rule.ObjectMeta.Name,
-			)
+			finishedJobs = append(finishedJobs, jobKey)
+			r.jobCompleted(jobKey, job, status)
 		}
 		return true
 	})
 
 	// remove finished jobs from the queue
 	for _, job := range finishedJobs {
-		glog.Infof(
-			"Removing finished job '%v' from queue ",
-			job,
+		logging.Infof(
+			"Removing finished %s '%v' from queue ",
+			job.kind,
+			job.id,
 		)
-		r.activeJobs.Delete(job)
+		r.removeActiveJob(job)
+	}
+}
+
+// WaitForActiveJobs waits till all the active jobs have finished, checking their status
+// periodically. It is intended to be called when the server is stopped, after the workers have
+// been stopped, so that the results of the jobs that are still running are reported. It returns an
+// error if there are still active jobs when the timeout expires.
+//
+func (r *Runner) WaitForActiveJobs(timeout time.Duration) error {
+	interval := r.drainCheckInterval
+	configured := r.config.JobStatusCheckInterval()
+	if configured > 0 && configured < interval {
+		interval = configured
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		count := atomic.LoadInt64(&r.activeJobsCount)
+		if count == 0 {
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("There are still %d active AWX jobs after waiting %s", count, timeout)
+		}
+		logging.Infof("Waiting for %d active AWX jobs to finish", count)
+		if interval > remaining {
+			interval = remaining
+		}
+		time.Sleep(interval)
+		r.runActiveJobsWorker()
+	}
+}
+
+// cleanupActiveJobsWorker checks the active jobs that are older than the maximum job age, and
+// removes the ones that have finished or that the AWX server doesn't know. This prevents the
+// accumulation of jobs that the regular worker can't remove, for example when the AWX server was
+// unavailable while they finished and later removed them.
+//
+func (r *Runner) cleanupActiveJobsWorker() {
+	logging.Infof("Looking for stale active jobs")
+
+	staleJobs := make([]activeJobKey, 0)
+	now := time.Now()
+
+	r.activeJobs.Range(func(key interface{}, value interface{}) bool {
+		jobKey := key.(activeJobKey)
+		job := value.(*activeJob)
+		if now.Sub(job.created) < r.maxJobAge {
+			return true
+		}
+		status, finished, err := r.checkAWXJobStatus(jobKey)
+		switch err.(type) {
+		case nil:
+			if finished {
+				staleJobs = append(staleJobs, jobKey)
+				r.jobCompleted(jobKey, job, status)
+			}
+		case *JobNotFoundError:
+			logging.Warningf(
+				"AWX %s '%d' launched by rule '%s' at %s doesn't exist in the AWX server",
+				jobKey.kind,
+				jobKey.id,
+				job.rule.ObjectMeta.Name,
+				job.created.Format(time.RFC3339),
+			)
+			staleJobs = append(staleJobs, jobKey)
+		default:
+			runtime.HandleError(err)
+		}
+		return true
+	})
+
+	for _, job := range staleJobs {
+		logging.Infof(
+			"Removing stale %s '%v' from queue",
+			job.kind,
+			job.id,
+		)
+		r.removeActiveJob(job)
+	}
+}
+
+// jobCompleted reports the final status of a job that has finished, and updates the metrics.
+//
+func (r *Runner) jobCompleted(key activeJobKey, job *activeJob, status string) {
+	if awx.JobStatus(status) == awx.JobStatusSuccesful {
+		logging.Infof(
+			"AWX %s '%d' launched by rule '%s' finished with status '%s'",
+			key.kind,
+			key.id,
+			job.rule.ObjectMeta.Name,
+			status,
+		)
+	} else {
+		logging.Warningf(
+			"AWX %s '%d' launched by rule '%s' finished with status '%s'",
+			key.kind,
+			key.id,
+			job.rule.ObjectMeta.Name,
+			status,
+		)
+	}
+	action, template := "AWXJob", ""
+	switch {
+	case key.kind == workflowJob && job.rule.WorkflowJob != nil:
+		action, template = "AWXWorkflowJob", job.rule.WorkflowJob.Template
+	case job.rule.AWXJob != nil:
+		template = job.rule.AWXJob.Template
 	}
+	metrics.ActionCompleted(
+		action,
+		template,
+		job.rule.ObjectMeta.Name,
+	)
+	metrics.AWXJobFinished(
+		status,
+		job.rule.ObjectMeta.Name,
+	)
 }
@@ -0,0 +1,432 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/syncmap"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+func TestCleanupRemovesOldFinishedJob(t *testing.T) {
+	connection := &stubConnection{
+		statuses: map[int]string{1: "successful"},
+	}
+	runner := makeCleanupRunner(connection)
+	addActiveJob(runner, 1, 25*time.Hour)
+
+	runner.cleanupActiveJobsWorker()
+
+	if hasActiveJob(runner, 1) {
+		t.Errorf("Expected old finished job to be removed")
+	}
+}
+
+func TestCleanupRemovesOldMissingJob(t *testing.T) {
+	connection := &stubConnection{
+		errors: map[int]error{1: &JobNotFoundError{Job: 1}},
+	}
+	runner := makeCleanupRunner(connection)
+	addActiveJob(runner, 1, 25*time.Hour)
+
+	runner.cleanupActiveJobsWorker()
+
+	if hasActiveJob(runner, 1) {
+		t.Errorf("Expected old job that doesn't exist to be removed")
+	}
+}
+
+func TestCleanupKeepsOldRunningJob(t *testing.T) {
+	connection := &stubConnection{
+		errors: map[int]error{2: fmt.Errorf("Connection refused")},
+	}
+	runner := makeCleanupRunner(connection)
+	addActiveJob(runner, 1, 25*time.Hour)
+	addActiveJob(runner, 2, 25*time.Hour)
+
+	runner.cleanupActiveJobsWorker()
+
+	if !hasActiveJob(runner, 1) {
+		t.Errorf("Expected old job that is still running to be kept")
+	}
+	if !hasActiveJob(runner, 2) {
+		t.Errorf("Expected old job whose status can't be checked to be kept")
+	}
+}
+
+func TestCleanupIgnoresRecentJob(t *testing.T) {
+	connection := &stubConnection{
+		statuses: map[int]string{1: "successful"},
+	}
+	runner := makeCleanupRunner(connection)
+	addActiveJob(runner, 1, time.Hour)
+
+	runner.cleanupActiveJobsWorker()
+
+	if !hasActiveJob(runner, 1) {
+		t.Errorf("Expected recent job to be kept")
+	}
+	if connection.checks != 0 {
+		t.Errorf("Expected recent job not to be checked, but it was checked %d times", connection.checks)
+	}
+}
+
+func TestActiveJobsWorkerReportsFinalStatus(t *testing.T) {
+	for _, status := range []string{"successful", "failed", "cancelled", "error"} {
+		t.Run(status, func(t *testing.T) {
+			server := startJobsServer(t, status)
+			defer server.Close()
+			runner := makeRunner(t, server.URL+"/api")
+			addActiveJob(runner, 1, time.Hour)
+
+			actual, finished, err := runner.checkAWXJobStatus(activeJobKey{id: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != status {
+				t.Errorf("Expected status '%s' but got '%s'", status, actual)
+			}
+			if !finished {
+				t.Errorf("Expected job with status '%s' to be finished", status)
+			}
+
+			runner.runActiveJobsWorker()
+			if hasActiveJob(runner, 1) {
+				t.Errorf("Expected job with status '%s' to be removed", status)
+			}
+		})
+	}
+}
+
+func TestActiveJobsWorkerKeepsRunningJob(t *testing.T) {
+	server := startJobsServer(t, "running")
+	defer server.Close()
+	runner := makeRunner(t, server.URL+"/api")
+	addActiveJob(runner, 1, time.Hour)
+
+	runner.runActiveJobsWorker()
+
+	if !hasActiveJob(runner, 1) {
+		t.Errorf("Expected running job to be kept")
+	}
+}
+
+func TestWaitForActiveJobsWaitsTillJobFinishes(t *testing.T) {
+	// The job is reported as running twice, and then as successful:
+	checks := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/authtoken/":
+			w.Write([]byte(`{"token": "mytoken"}`))
+		case "/api/v2/jobs/1/":
+			status := "running"
+			if atomic.AddInt32(checks, 1) >= 3 {
+				status = "successful"
+			}
+			fmt.Fprintf(w, `{"id": 1, "status": "%s"}`, status)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	runner := makeRunner(t, server.URL+"/api")
+	runner.drainCheckInterval = 10 * time.Millisecond
+	addActiveJob(runner, 1, time.Hour)
+
+	err := runner.WaitForActiveJobs(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Expected no error waiting for the job, but got: %s", err)
+	}
+	if atomic.LoadInt32(checks) != 3 {
+		t.Errorf("Expected the job to be checked 3 times, but it was checked %d times", *checks)
+	}
+	if hasActiveJob(runner, 1) {
+		t.Errorf("Expected finished job to be removed")
+	}
+}
+
+func TestWaitForActiveJobsTimeout(t *testing.T) {
+	server := startJobsServer(t, "running")
+	defer server.Close()
+	runner := makeRunner(t, server.URL+"/api")
+	runner.drainCheckInterval = 10 * time.Millisecond
+	addActiveJob(runner, 1, time.Hour)
+
+	start := time.Now()
+	err := runner.WaitForActiveJobs(50 * time.Millisecond)
+	if err == nil {
+		t.Errorf("Expected an error when the job doesn't finish before the timeout")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected to wait at least the timeout, but waited %s", elapsed)
+	}
+	if !hasActiveJob(runner, 1) {
+		t.Errorf("Expected running job to be kept")
+	}
+}
+
+func TestCancelJobsHitsCancelEndpoint(t *testing.T) {
+	var mutex sync.Mutex
+	cancelled := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/authtoken/":
+			w.Write([]byte(`{"token": "mytoken"}`))
+		case "/api/v2/jobs/1/cancel/", "/api/v2/jobs/2/cancel/":
+			if r.Method != http.MethodPost {
+				t.Errorf("Expected method POST but got %s", r.Method)
+			}
+			mutex.Lock()
+			cancelled = append(cancelled, r.URL.Path)
+			mutex.Unlock()
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	runner := makeRunner(t, server.URL+"/api")
+
+	resolved := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusResolved,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	other := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "DiskFull",
+		},
+	}
+	addAlertJob(runner, 1, resolved)
+	addAlertJob(runner, 2, other)
+
+	err := runner.CancelJobs(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(cancelled) != 1 || cancelled[0] != "/api/v2/jobs/1/cancel/" {
+		t.Errorf("Expected only the cancel endpoint of job 1 to be called, but got %v", cancelled)
+	}
+	if hasActiveJob(runner, 1) {
+		t.Errorf("Expected cancelled job to be removed")
+	}
+	if !hasActiveJob(runner, 2) {
+		t.Errorf("Expected job launched for a different alert to be kept")
+	}
+}
+
+func TestCancelJobsComparesAllTheLabels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	runner := makeRunner(t, server.URL+"/api")
+
+	// These alerts have the same fingerprint, but different labels:
+	resolved := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusResolved,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+			"instance":  "node0\njob=node",
+		},
+	}
+	other := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+			"instance":  "node0",
+			"job":       "node",
+		},
+	}
+	if resolved.Fingerprint() != other.Fingerprint() {
+		t.Fatalf("Expected alerts with the same fingerprint")
+	}
+	addAlertJob(runner, 1, resolved)
+	addAlertJob(runner, 2, other)
+
+	err := runner.CancelJobs(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasActiveJob(runner, 1) {
+		t.Errorf("Expected the job of the resolved alert to be cancelled")
+	}
+	if !hasActiveJob(runner, 2) {
+		t.Errorf("Expected the job of the other alert to be kept")
+	}
+}
+
+func TestCancelJobsKeepsJobWhenCancelFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/authtoken/":
+			w.Write([]byte(`{"token": "mytoken"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	runner := makeRunner(t, server.URL+"/api")
+
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	addAlertJob(runner, 1, alert)
+
+	err := runner.CancelJobs(alert)
+	if err == nil {
+		t.Errorf("Expected an error when the job can't be cancelled")
+	}
+	if !hasActiveJob(runner, 1) {
+		t.Errorf("Expected job that can't be cancelled to be kept")
+	}
+}
+
+// startJobsServer starts a fake AWX server that reports the given status for job 1.
+//
+func startJobsServer(t *testing.T, status string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/authtoken/":
+			w.Write([]byte(`{"token": "mytoken"}`))
+		case "/api/v2/jobs/1/":
+			fmt.Fprintf(w, `{"id": 1, "status": "%s"}`, status)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// stubConnection is a connection that only knows how to check the status of jobs.
+//
+type stubConnection struct {
+	statuses map[int]string
+	errors   map[int]error
+	checks   int
+}
+
+func (c *stubConnection) FindTemplates(project, name string) ([]*Template, error) {
+	return nil, nil
+}
+
+func (c *stubConnection) LaunchTemplate(template *Template, extraVars map[string]interface{},
+	limit string) (int, error) {
+	return 0, fmt.Errorf("Not implemented")
+}
+
+func (c *stubConnection) FindWorkflowTemplates(name string) ([]*Template, error) {
+	return nil, nil
+}
+
+func (c *stubConnection) LaunchWorkflowTemplate(template *Template, extraVars map[string]interface{},
+	limit string) (int, error) {
+	return 0, fmt.Errorf("Not implemented")
+}
+
+func (c *stubConnection) JobStatus(job int) (string, error) {
+	c.checks++
+	if err, ok := c.errors[job]; ok {
+		return "", err
+	}
+	if status, ok := c.statuses[job]; ok {
+		return status, nil
+	}
+	return "running", nil
+}
+
+func (c *stubConnection) CancelJob(job int) error {
+	return fmt.Errorf("Not implemented")
+}
+
+func (c *stubConnection) WorkflowJobStatus(job int) (string, error) {
+	return "", fmt.Errorf("Not implemented")
+}
+
+func (c *stubConnection) CancelWorkflowJob(job int) error {
+	return fmt.Errorf("Not implemented")
+}
+
+func (c *stubConnection) Close() {
+}
+
+func makeCleanupRunner(connection Connection) *Runner {
+	return &Runner{
+		config: &config.AWXConfig{},
+		connections: newConnectionPool(
+			"",
+			&config.AWXConfig{},
+			func(*config.AWXConfig, string) (Connection, error) {
+				return connection, nil
+			},
+			0,
+		),
+		activeJobs:      new(syncmap.Map),
+		activeJobsMutex: &sync.Mutex{},
+		maxJobAge:       24 * time.Hour,
+		templates:       newTemplateCache(0),
+	}
+}
+
+func addActiveJob(runner *Runner, id int, age time.Duration) {
+	runner.addActiveJob(activeJobKey{id: id}, &activeJob{
+		rule: &autoheal.HealingRule{
+			ObjectMeta: meta.ObjectMeta{
+				Name: "my-rule",
+			},
+			AWXJob: &autoheal.AWXJobAction{
+				Template: "Start node",
+			},
+		},
+		created: time.Now().Add(-age),
+	})
+}
+
+func addAlertJob(runner *Runner, id int, alert *alertmanager.Alert) {
+	runner.addActiveJob(activeJobKey{id: id}, &activeJob{
+		rule: &autoheal.HealingRule{
+			ObjectMeta: meta.ObjectMeta{
+				Name: "my-rule",
+			},
+			AWXJob: &autoheal.AWXJobAction{
+				Template: "Start node",
+			},
+		},
+		alert:   alert.LabelsKey(),
+		created: time.Now(),
+	})
+}
+
+func hasActiveJob(runner *Runner, id int) bool {
+	_, ok := runner.activeJobs.Load(activeJobKey{id: id})
+	return ok
+}
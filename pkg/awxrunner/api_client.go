@@ -0,0 +1,284 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains a minimal client for the parts of the AWX API that the AWX client library
+// doesn't support, and for the servers that use OAuth2 tokens, as the AWX client can't use them.
+
+package awxrunner
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/openshift/autoheal/pkg/config"
+	"github.com/openshift/autoheal/pkg/logging"
+)
+
+// apiClient sends requests to version 2 of the AWX API, authenticating them with the OAuth2 token
+// given in the configuration, or with the user name and password if there is no token.
+//
+type apiClient struct {
+	base     string
+	user     string
+	password string
+	token    string
+	client   *http.Client
+}
+
+// apiTemplate is the representation of a job template, or workflow job template, in the AWX API.
+//
+type apiTemplate struct {
+	Id               int    `json:"id"`
+	Name             string `json:"name"`
+	AskLimitOnLaunch bool   `json:"ask_limit_on_launch"`
+	AskVarsOnLaunch  bool   `json:"ask_variables_on_launch"`
+}
+
+// apiTemplateList is the representation of a page of templates in the AWX API.
+//
+type apiTemplateList struct {
+	Results []*apiTemplate `json:"results"`
+}
+
+// apiLaunchRequest is the body of the request used to launch a job from a template. The extra
+// variables are sent as a JSON encoded string.
+//
+type apiLaunchRequest struct {
+	ExtraVars string `json:"extra_vars,omitempty"`
+	Limit     string `json:"limit,omitempty"`
+}
+
+// apiLaunchResponse is the body of the response to the request used to launch a job from a
+// template.
+//
+type apiLaunchResponse struct {
+	Job         int `json:"job"`
+	WorkflowJob int `json:"workflow_job"`
+}
+
+// apiJob is the representation of a job in the AWX API.
+//
+type apiJob struct {
+	Id     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+// apiError is the error returned by the API client when the server responds with a status code
+// that indicates a failure.
+//
+type apiError struct {
+	// Code is the HTTP status code returned by the server.
+	Code int
+
+	// Status is the HTTP status line returned by the server.
+	Status string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("Status code '%d' returned from server: '%s'", e.Code, e.Status)
+}
+
+// apiErrorCode returns the HTTP status code of the given error, if it was returned by the API
+// client because of a failure response, or zero otherwise.
+//
+func apiErrorCode(err error) int {
+	if typed, ok := err.(*apiError); ok {
+		return typed.Code
+	}
+	return 0
+}
+
+// newAPIClient creates an API client for the AWX server with the given address, using the rest of
+// the connection details from the configuration.
+//
+func newAPIClient(config *config.AWXConfig, address string) (*apiClient, error) {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: config.Insecure(),
+		},
+	}
+	if config.Proxy() != "" {
+		proxy, err := url.Parse(config.Proxy())
+		if err != nil {
+			return nil, fmt.Errorf("The proxy URL '%s' isn't valid: %s", config.Proxy(), err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if len(config.CA()) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(config.CA()) {
+			return nil, fmt.Errorf("The CA certificates of the AWX server aren't valid PEM")
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	base := address
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return &apiClient{
+		base:     base + "v2/",
+		user:     config.User(),
+		password: config.Password(),
+		token:    config.Token(),
+		client: &http.Client{
+			Transport: transport,
+		},
+	}, nil
+}
+
+// get sends a GET request with the given query to the given path, relative to the base URL of the
+// API, and parses the response into the given output.
+//
+func (c *apiClient) get(path string, query url.Values, output interface{}) error {
+	return c.send(http.MethodGet, path, query, nil, output)
+}
+
+// post sends a POST request with the given input to the given path, relative to the base URL of the
+// API, and parses the response into the given output. The output can be nil if the response body
+// isn't needed.
+//
+func (c *apiClient) post(path string, input, output interface{}) error {
+	return c.send(http.MethodPost, path, nil, input, output)
+}
+
+// send sends a request to the given path, relative to the base URL of the API, and parses the
+// response into the given output. The input and the output can be nil.
+//
+func (c *apiClient) send(method, path string, query url.Values, input, output interface{}) error {
+	// The API server sends a redirect if the URL doesn't end with a slash:
+	address := c.base + path
+	if !strings.HasSuffix(address, "/") {
+		address += "/"
+	}
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+
+	// Prepare the request:
+	var body []byte
+	if input != nil {
+		var err error
+		body, err = json.Marshal(input)
+		if err != nil {
+			return err
+		}
+	}
+	request, err := http.NewRequest(method, address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if input != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	} else {
+		request.SetBasicAuth(c.user, c.password)
+	}
+
+	// Send the request and check the response:
+	logging.V(2).Infof("Sending %s request to '%s'", method, address)
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode > 202 {
+		return &apiError{
+			Code:   response.StatusCode,
+			Status: response.Status,
+		}
+	}
+	if output == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, output)
+}
+
+// cancelJob requests the cancellation of the job with the given identifier of the given
+// collection, for example 'jobs'.
+//
+func (c *apiClient) cancelJob(collection string, job int) error {
+	return c.post(fmt.Sprintf("%s/%d/cancel", collection, job), struct{}{}, nil)
+}
+
+// findTemplates returns the templates of the given collection, for example 'job_templates', that
+// match the given query.
+//
+func (c *apiClient) findTemplates(collection string, query url.Values) ([]*Template, error) {
+	list := new(apiTemplateList)
+	err := c.get(collection, query, list)
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]*Template, len(list.Results))
+	for i, result := range list.Results {
+		templates[i] = &Template{
+			Id:               result.Id,
+			Name:             result.Name,
+			AskLimitOnLaunch: result.AskLimitOnLaunch,
+			AskVarsOnLaunch:  result.AskVarsOnLaunch,
+		}
+	}
+	return templates, nil
+}
+
+// launchTemplate launches a job from the template with the given identifier of the given
+// collection, for example 'job_templates'.
+//
+func (c *apiClient) launchTemplate(collection string, template int, extraVars map[string]interface{},
+	limit string) (*apiLaunchResponse, error) {
+	request := &apiLaunchRequest{
+		Limit: limit,
+	}
+	if extraVars != nil {
+		data, err := json.Marshal(extraVars)
+		if err != nil {
+			return nil, err
+		}
+		request.ExtraVars = string(data)
+	}
+	response := new(apiLaunchResponse)
+	err := c.post(fmt.Sprintf("%s/%d/launch", collection, template), request, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// jobStatus returns the status of the job with the given identifier of the given collection, for
+// example 'jobs'.
+//
+func (c *apiClient) jobStatus(collection string, job int) (string, error) {
+	response := new(apiJob)
+	err := c.get(fmt.Sprintf("%s/%d", collection, job), nil, response)
+	if err != nil {
+		return "", err
+	}
+	return response.Status, nil
+}
@@ -0,0 +1,256 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+func TestCancelJobSendsRequest(t *testing.T) {
+	var method, path, user, password string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		user, password, _ = r.BasicAuth()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	connection := makeClientConnection(t, server.URL+"/api")
+	defer connection.Close()
+
+	err := connection.CancelJob(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPost || path != "/api/v2/jobs/123/cancel/" {
+		t.Errorf("Expected 'POST /api/v2/jobs/123/cancel/', but got '%s %s'", method, path)
+	}
+	if user != "myuser" || password != "mypassword" {
+		t.Errorf("Expected the credentials of the configuration, but got '%s' and '%s'", user, password)
+	}
+}
+
+func TestWorkflowJobRequests(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/api/v2/workflow_jobs/456/":
+			w.Write([]byte(`{"id": 456, "status": "running"}`))
+		case "/api/v2/workflow_jobs/456/cancel/":
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	connection := makeClientConnection(t, server.URL+"/api")
+	defer connection.Close()
+
+	status, err := connection.WorkflowJobStatus(456)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "running" {
+		t.Errorf("Expected status 'running', but got '%s'", status)
+	}
+	err = connection.CancelWorkflowJob(456)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = connection.WorkflowJobStatus(789)
+	if _, ok := err.(*JobNotFoundError); !ok {
+		t.Errorf("Expected a job not found error for a missing workflow job, but got '%v'", err)
+	}
+	expected := []string{
+		"GET /api/v2/workflow_jobs/456/",
+		"POST /api/v2/workflow_jobs/456/cancel/",
+		"GET /api/v2/workflow_jobs/789/",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected requests %v, but got %v", expected, paths)
+	}
+}
+
+func TestCancelJobStatusCodes(t *testing.T) {
+	tests := []struct {
+		code     int
+		notFound bool
+		failed   bool
+	}{
+		{http.StatusMethodNotAllowed, false, false},
+		{http.StatusNotFound, true, true},
+		{http.StatusInternalServerError, false, true},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.code)
+		}))
+		connection := makeClientConnection(t, server.URL+"/api")
+		err := connection.CancelJob(123)
+		connection.Close()
+		server.Close()
+		if (err != nil) != test.failed {
+			t.Errorf("Expected failure %v for status code %d, but got error: %v", test.failed, test.code, err)
+		}
+		if _, ok := err.(*JobNotFoundError); ok != test.notFound {
+			t.Errorf("Expected not found %v for status code %d, but got error: %v", test.notFound, test.code, err)
+		}
+	}
+}
+
+func TestTokenIsSentAsBearer(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/api/v2/job_templates/":
+			if r.URL.Query().Get("name") != "Start node" || r.URL.Query().Get("project__name") != "My project" {
+				w.Write([]byte(`{"count": 0, "results": []}`))
+				return
+			}
+			w.Write([]byte(`{"count": 1, "results": [{"id": 1, "name": "Start node", "ask_limit_on_launch": true}]}`))
+		case "/api/v2/job_templates/1/launch/":
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != `{"extra_vars":"{\"node\":\"node0\"}","limit":"node0"}` {
+				http.Error(w, string(body), http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"job": 123}`))
+		case "/api/v2/jobs/123/":
+			w.Write([]byte(`{"id": 123, "status": "running"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	connection := makeClientConnectionWithAuth(t, server.URL+"/api", `
+  token: "mytoken"`)
+	defer connection.Close()
+
+	templates, err := connection.FindTemplates("My project", "Start node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || templates[0].Id != 1 || !templates[0].AskLimitOnLaunch {
+		t.Fatalf("Expected template 1 that asks for the limit, but got %v", templates)
+	}
+	job, err := connection.LaunchTemplate(templates[0], map[string]interface{}{"node": "node0"}, "node0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job != 123 {
+		t.Errorf("Expected job 123, but got %d", job)
+	}
+	status, err := connection.JobStatus(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "running" {
+		t.Errorf("Expected status 'running', but got '%s'", status)
+	}
+	_, err = connection.JobStatus(456)
+	if _, ok := err.(*JobNotFoundError); !ok {
+		t.Errorf("Expected a not found error for an unknown job, but got %v", err)
+	}
+
+	for _, authorization := range authorizations {
+		if authorization != "Bearer mytoken" {
+			t.Errorf("Expected authorization 'Bearer mytoken', but got '%s'", authorization)
+		}
+	}
+}
+
+func TestLaunchWorkflowTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/workflow_job_templates/":
+			if r.URL.Query().Get("name") != "Restart cluster" {
+				w.Write([]byte(`{"count": 0, "results": []}`))
+				return
+			}
+			w.Write([]byte(`{"count": 1, "results": [{"id": 7, "name": "Restart cluster", "ask_variables_on_launch": true}]}`))
+		case "/api/v2/workflow_job_templates/7/launch/":
+			w.Write([]byte(`{"workflow_job": 456}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	connection := makeClientConnection(t, server.URL+"/api")
+	defer connection.Close()
+
+	templates, err := connection.FindWorkflowTemplates("Restart cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || templates[0].Id != 7 || !templates[0].AskVarsOnLaunch {
+		t.Fatalf("Expected workflow template 7 that asks for variables, but got %v", templates)
+	}
+	job, err := connection.LaunchWorkflowTemplate(templates[0], nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job != 456 {
+		t.Errorf("Expected workflow job 456, but got %d", job)
+	}
+}
+
+// makeClientConnection creates a connection to the AWX server with the given address, using the
+// user name and password of the configuration.
+//
+func makeClientConnection(t *testing.T, address string) Connection {
+	return makeClientConnectionWithAuth(t, address, `
+  credentials:
+    username: "myuser"
+    password: "mypassword"`)
+}
+
+// makeClientConnectionWithAuth creates a connection to the AWX server with the given address, adding
+// to the AWX section of the configuration the given YAML text, that should contain the credentials
+// or the token.
+//
+func makeClientConnectionWithAuth(t *testing.T, address, auth string) Connection {
+	file, err := ioutil.TempFile("", "awx_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	fmt.Fprintf(file, "awx:\n  address: %s%s\n", address, auth)
+	file.Close()
+
+	cfg, err := config.NewBuilder().
+		File(file.Name()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	connection, err := newClientConnection(cfg.AWX(), address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return connection
+}
@@ -18,32 +18,93 @@ package awxrunner
 
 import (
 	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/golang/glog"
+	"github.com/moolitayer/awx-client-go/awx"
 	"golang.org/x/sync/syncmap"
 	"k8s.io/apimachinery/pkg/util/wait"
 
-	"github.com/moolitayer/awx-client-go/awx"
 	"github.com/openshift/autoheal/pkg/alertmanager"
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
 	"github.com/openshift/autoheal/pkg/config"
+	"github.com/openshift/autoheal/pkg/logging"
 	"github.com/openshift/autoheal/pkg/metrics"
+	"github.com/openshift/autoheal/pkg/runner"
 )
 
 type Builder struct {
 	config *config.AWXConfig
 
+	servers *config.ServersConfig
+
 	stopCh <-chan struct{}
+
+	templateCacheTTL time.Duration
+
+	maxJobAge time.Duration
+
+	maxConcurrentJobs int
+
+	poolSize int
+
+	connectionFactory ConnectionFactory
 }
 
 type Runner struct {
 	config *config.AWXConfig
 
+	// The connections to the AWX server that can be reused.
+	connections *connectionPool
+
+	// The additional AWX servers that the actions can reference by name, and the connections to
+	// them, indexed by name. The pools are created the first time that each server is used, with
+	// the same factory and size than the pool of the default server.
+	servers           *config.ServersConfig
+	serverPools       map[string]*connectionPool
+	serverPoolsMutex  *sync.Mutex
+	connectionFactory ConnectionFactory
+	poolSize          int
+
+	// The jobs that have been launched and haven't finished yet, indexed by job identifier. The
+	// values are *activeJob.
 	activeJobs *syncmap.Map
+
+	// The number of jobs in the active jobs map, as the map doesn't have a cheap way to count its
+	// entries. It is read atomically, and the mutex serializes the changes to the map and the count.
+	activeJobsCount int64
+	activeJobsMutex *sync.Mutex
+
+	// The maximum number of active jobs, zero means that there is no limit.
+	maxConcurrentJobs int
+
+	// How long to wait before checking if an active job is stale.
+	maxJobAge time.Duration
+
+	// The maximum time between checks of the status of the active jobs while waiting for them to
+	// finish.
+	drainCheckInterval time.Duration
+
+	// The job templates retrieved from the AWX server.
+	templates *templateCache
+
+	// The number of failed attempts to launch each job whose request didn't reach the AWX server,
+	// indexed by the key calculated by the launchKey function. The values are int.
+	launchAttempts *syncmap.Map
 }
 
 func NewBuilder() *Builder {
-	return new(Builder)
+	b := new(Builder)
+	b.templateCacheTTL = 5 * time.Minute
+	b.maxJobAge = 24 * time.Hour
+	b.poolSize = 2
+	b.connectionFactory = newClientConnection
+	return b
 }
 
 func (b *Builder) Config(config *config.AWXConfig) *Builder {
@@ -51,77 +112,296 @@ func (b *Builder) Config(config *config.AWXConfig) *Builder {
 	return b
 }
 
+// Servers sets the configuration of the additional AWX servers that the AWX job actions can
+// reference by name. When it isn't set all the jobs are launched in the default AWX server.
+//
+func (b *Builder) Servers(servers *config.ServersConfig) *Builder {
+	b.servers = servers
+	return b
+}
+
 func (b *Builder) StopCh(stopCh <-chan struct{}) *Builder {
 	b.stopCh = stopCh
 	return b
 }
 
+// TemplateCacheTTL sets for how long the job templates retrieved from the AWX server are reused
+// before retrieving them again. The default is five minutes. A zero value disables the cache.
+//
+func (b *Builder) TemplateCacheTTL(ttl time.Duration) *Builder {
+	b.templateCacheTTL = ttl
+	return b
+}
+
+// MaxJobAge sets for how long the runner tracks an active job before checking if it is stale. Jobs
+// older than this that have finished, or that the AWX server doesn't know, are removed by a worker
+// that runs daily. The default is 24 hours.
+//
+func (b *Builder) MaxJobAge(age time.Duration) *Builder {
+	b.maxJobAge = age
+	return b
+}
+
+// MaxConcurrentJobs sets the maximum number of jobs that can be active at the same time. When this
+// number is reached new actions are rejected with a retryable error, so that the alerts that
+// triggered them are processed again later. The default is zero, which means that there is no
+// limit.
+//
+func (b *Builder) MaxConcurrentJobs(max int) *Builder {
+	b.maxConcurrentJobs = max
+	return b
+}
+
+// PoolSize sets the maximum number of idle connections to the AWX server that are kept for reuse,
+// so that a new connection isn't created for every request. The default is two. A zero value
+// disables the reuse of connections.
+//
+func (b *Builder) PoolSize(size int) *Builder {
+	b.poolSize = size
+	return b
+}
+
+// ConnectionFactory sets the function that will be used to create the connections to the AWX
+// server. This is intended for tests, the default is to use the AWX client.
+//
+func (b *Builder) ConnectionFactory(factory ConnectionFactory) *Builder {
+	b.connectionFactory = factory
+	return b
+}
+
 func (b *Builder) Build() (*Runner, error) {
+	// The address of the AWX server is mandatory, unless there are additional servers:
+	if b.config == nil {
+		return nil, fmt.Errorf("The AWX configuration is mandatory")
+	}
+	if b.config.Address() == "" && (b.servers == nil || len(b.servers.Names()) == 0) {
+		return nil, fmt.Errorf("The address of the AWX server hasn't been configured")
+	}
+
+	if b.templateCacheTTL < 0 {
+		return nil, fmt.Errorf("The template cache TTL can't be negative, but it is %s", b.templateCacheTTL)
+	}
+
+	if b.maxJobAge <= 0 {
+		return nil, fmt.Errorf("The maximum job age must be positive, but it is %s", b.maxJobAge)
+	}
+
+	if b.maxConcurrentJobs < 0 {
+		return nil, fmt.Errorf(
+			"The maximum number of concurrent jobs can't be negative, but it is %d",
+			b.maxConcurrentJobs,
+		)
+	}
+
+	if b.poolSize < 0 {
+		return nil, fmt.Errorf("The connection pool size can't be negative, but it is %d", b.poolSize)
+	}
+
+	if b.connectionFactory == nil {
+		return nil, fmt.Errorf("The AWX connection factory is mandatory")
+	}
+
 	runner := &Runner{
-		config:     b.config,
-		activeJobs: new(syncmap.Map),
+		config:             b.config,
+		connections:        newConnectionPool("", b.config, b.connectionFactory, b.poolSize),
+		activeJobs:         new(syncmap.Map),
+		activeJobsMutex:    &sync.Mutex{},
+		maxConcurrentJobs:  b.maxConcurrentJobs,
+		maxJobAge:          b.maxJobAge,
+		drainCheckInterval: defaultDrainCheckInterval,
+		templates:          newTemplateCache(b.templateCacheTTL),
+		launchAttempts:     new(syncmap.Map),
+		servers:            b.servers,
+		serverPools:        make(map[string]*connectionPool),
+		serverPoolsMutex:   &sync.Mutex{},
+		connectionFactory:  b.connectionFactory,
+		poolSize:           b.poolSize,
+	}
+
+	// If the stop channel has been given start the worker right away, otherwise it will be started
+	// when the Start method is called:
+	if b.stopCh != nil {
+		runner.Start(b.stopCh)
 	}
-	go wait.Until(runner.runActiveJobsWorker, runner.config.JobStatusCheckInterval(), b.stopCh)
+
 	return runner, nil
 }
 
-func (r *Runner) RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error {
-	var err error
-	awxAction := action.(*autoheal.AWXJobAction)
-	// Get the AWX connection details from the configuration:
-	awxAddress := r.config.Address()
-	awxProxy := r.config.Proxy()
-	awxUser := r.config.User()
-	awxPassword := r.config.Password()
-	awxCA := r.config.CA()
-	awxInsecure := r.config.Insecure()
+// Start starts the workers that periodically check the status of the active jobs and remove the
+// stale ones. They will run till the given stop channel is closed, and then the connections to the
+// AWX server will be closed.
+//
+func (r *Runner) Start(stopCh <-chan struct{}) {
+	go wait.Until(r.runActiveJobsWorker, r.config.JobStatusCheckInterval(), stopCh)
+	go wait.Until(r.cleanupActiveJobsWorker, cleanupInterval, stopCh)
+	go func() {
+		<-stopCh
+		for _, pool := range r.allPools() {
+			pool.drain()
+		}
+	}()
+}
+
+// CloseIdleConnections closes the connections to the AWX servers that aren't in use. It should be
+// called when the configuration is reloaded, as the addresses or the credentials may have changed.
+//
+func (r *Runner) CloseIdleConnections() {
+	for _, pool := range r.allPools() {
+		pool.closeIdle()
+	}
+}
+
+// Make sure that the runner implements the action runner interface:
+var _ runner.ActionRunner = &Runner{}
+
+// RunAction launches the AWX job described by the given *autoheal.AWXJobAction, or the AWX
+// workflow job described by the given *autoheal.AWXWorkflowAction.
+//
+func (r *Runner) RunAction(rule *autoheal.HealingRule, action interface{},
+	alert *alertmanager.Alert) error {
+	switch typed := action.(type) {
+	case *autoheal.AWXJobAction:
+		return r.runAWXJob(rule, typed, alert)
+	case *autoheal.AWXWorkflowAction:
+		return r.runAWXWorkflowJob(rule, typed, alert)
+	default:
+		return fmt.Errorf("Don't know how to run AWX action of type '%T'", action)
+	}
+}
+
+// runAWXJob launches the jobs from the job templates of the AWX project given in the configuration
+// that have the name given in the action. The jobs are launched in the AWX server referenced by the
+// action, or in the default one if the action doesn't reference any.
+//
+func (r *Runner) runAWXJob(rule *autoheal.HealingRule, awxAction *autoheal.AWXJobAction,
+	alert *alertmanager.Alert) (err error) {
+	// Find the AWX server:
+	server, err := r.server(awxAction.ServerRef)
+	if err != nil {
+		return err
+	}
 
-	// Get the name of the AWX project name from the configuration:
-	awxProject := r.config.Project()
+	// Get the name of the AWX project name from the configuration of the server:
+	awxProject := server.config.Project()
 
 	// Get the name of the AWX job template from the action:
 	awxTemplate := awxAction.Template
 
-	// Create the connection to the AWX server:
-	connection, err := awx.NewConnectionBuilder().
-		Url(awxAddress).
-		Proxy(awxProxy).
-		Username(awxUser).
-		Password(awxPassword).
-		CACertificates(awxCA).
-		Insecure(awxInsecure).
-		Build()
+	// Don't launch more jobs if the AWX server is already running too many of them:
+	if r.saturated() {
+		logging.Warningf(
+			"There are already %d active AWX jobs, template '%s' will be launched later to heal "+
+				"alert '%s'",
+			atomic.LoadInt64(&r.activeJobsCount),
+			awxTemplate,
+			alert.Name(),
+		)
+		metrics.ActionBackpressure("AWXJob")
+		return &runner.RetryableError{
+			Reason: fmt.Sprintf(
+				"Can't launch AWX job from template '%s', the maximum of %d active jobs has "+
+					"been reached",
+				awxTemplate,
+				r.maxConcurrentJobs,
+			),
+		}
+	}
+
+	// Get a connection to the AWX server:
+	connection, err := server.newConnection()
 	if err != nil {
 		return err
 	}
-	defer connection.Close()
+	defer func() {
+		server.releaseConnection(connection, err)
+	}()
 
-	// Retrieve the job template:
-	templatesResource := connection.JobTemplates()
-	templatesResponse, err := templatesResource.Get().
-		Filter("project__name", awxProject).
-		Filter("name", awxTemplate).
-		Send()
+	// Retrieve the job templates:
+	templates, err := r.findTemplates(server, connection, awxProject, awxTemplate)
 	if err != nil {
 		return err
 	}
-	if templatesResponse.Count() == 0 {
-		return fmt.Errorf(
-			"Template '%s' not found in project '%s'",
-			awxTemplate,
-			awxProject,
-		)
-	}
 
 	// Launch the jobs:
-	glog.Infof(
+	logging.Infof(
 		"Running AWX job from project '%s' and template '%s' to heal alert '%s'",
 		awxProject,
 		awxTemplate,
 		alert.Name(),
 	)
-	for _, template := range templatesResponse.Results() {
-		err := r.launchAWXJob(connection, template, awxAction, rule, alert)
+	for _, template := range templates {
+		err := r.launchAWXJob(server, connection, template, awxAction, rule, alert)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runAWXWorkflowJob launches the workflow jobs from the workflow job templates that have the name
+// given in the action. Workflow job templates don't belong to a project, so the project given in
+// the configuration isn't used. The workflow jobs are launched in the AWX server referenced by the
+// action, or in the default one if the action doesn't reference any.
+//
+func (r *Runner) runAWXWorkflowJob(rule *autoheal.HealingRule, awxAction *autoheal.AWXWorkflowAction,
+	alert *alertmanager.Alert) (err error) {
+	// Find the AWX server:
+	server, err := r.server(awxAction.ServerRef)
+	if err != nil {
+		return err
+	}
+
+	// Get the name of the AWX workflow job template from the action:
+	awxTemplate := awxAction.Template
+
+	// Don't launch more jobs if the AWX server is already running too many of them:
+	if r.saturated() {
+		logging.Warningf(
+			"There are already %d active AWX jobs, workflow template '%s' will be launched "+
+				"later to heal alert '%s'",
+			atomic.LoadInt64(&r.activeJobsCount),
+			awxTemplate,
+			alert.Name(),
+		)
+		metrics.ActionBackpressure("AWXWorkflowJob")
+		return &runner.RetryableError{
+			Reason: fmt.Sprintf(
+				"Can't launch AWX workflow job from template '%s', the maximum of %d active "+
+					"jobs has been reached",
+				awxTemplate,
+				r.maxConcurrentJobs,
+			),
+		}
+	}
+
+	// Get a connection to the AWX server:
+	connection, err := server.newConnection()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		server.releaseConnection(connection, err)
+	}()
+
+	// Retrieve the workflow job templates:
+	templates, err := connection.FindWorkflowTemplates(awxTemplate)
+	if err != nil {
+		return err
+	}
+	if len(templates) == 0 {
+		err = fmt.Errorf("Workflow template '%s' not found", awxTemplate)
+		return err
+	}
+
+	// Launch the workflow jobs:
+	logging.Infof(
+		"Running AWX workflow job from template '%s' to heal alert '%s'",
+		awxTemplate,
+		alert.Name(),
+	)
+	for _, template := range templates {
+		err = r.launchAWXWorkflowJob(server, connection, template, awxAction, rule, alert)
 		if err != nil {
 			return err
 		}
@@ -130,93 +410,409 @@ func (r *Runner) RunAction(rule *autoheal.HealingRule, action interface{}, alert
 	return nil
 }
 
+// ValidateTemplates checks that the job templates used by the AWX actions of the given rules exist
+// in the AWX project given in the configuration of the server that they use. It returns one error
+// for each template that doesn't exist or that can't be checked. Templates whose names contain
+// template expressions are skipped, as they can only be resolved when an alert is received.
+//
+func (r *Runner) ValidateTemplates(rules []*autoheal.HealingRule) []error {
+	var errs []error
+
+	// Get a connection to each AWX server the first time that it is needed, and remember if any
+	// request fails, so that the connection isn't reused. Servers that can't be used are stored
+	// with a nil connection, so that they are reported only once:
+	servers := make(map[string]*awxServer)
+	connections := make(map[string]Connection)
+	failures := make(map[string]error)
+	defer func() {
+		for name, connection := range connections {
+			if connection != nil {
+				servers[name].releaseConnection(connection, failures[name])
+			}
+		}
+	}()
+
+	// Check the templates, making sure that each of them is checked only once:
+	checked := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.AWXJob == nil {
+			continue
+		}
+		name := rule.AWXJob.ServerRef
+		awxTemplate := rule.AWXJob.Template
+		key := name + ":" + awxTemplate
+		if checked[key] || strings.Contains(awxTemplate, "{{") {
+			continue
+		}
+		checked[key] = true
+		connection, ok := connections[name]
+		if !ok {
+			server, err := r.server(name)
+			if err == nil {
+				connection, err = server.newConnection()
+			}
+			connections[name] = connection
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			servers[name] = server
+		}
+		if connection == nil {
+			continue
+		}
+		awxProject := servers[name].config.Project()
+		templates, err := connection.FindTemplates(awxProject, awxTemplate)
+		if err != nil {
+			failures[name] = err
+			errs = append(errs, fmt.Errorf(
+				"Can't check if template '%s' used by rule '%s' exists in project '%s': %s",
+				awxTemplate,
+				rule.ObjectMeta.Name,
+				awxProject,
+				err,
+			))
+			continue
+		}
+		if len(templates) == 0 {
+			errs = append(errs, fmt.Errorf(
+				"Template '%s' used by rule '%s' not found in project '%s'",
+				awxTemplate,
+				rule.ObjectMeta.Name,
+				awxProject,
+			))
+		}
+	}
+
+	return errs
+}
+
 func (r *Runner) launchAWXJob(
-	connection *awx.Connection,
-	template *awx.JobTemplate,
+	server *awxServer,
+	connection Connection,
+	template *Template,
 	action *autoheal.AWXJobAction,
 	rule *autoheal.HealingRule,
 	alert *alertmanager.Alert,
 ) error {
-	templateId := template.Id()
-	templateName := template.Name()
+	templateName := template.Name
+
+	// Resolve the address used to calculate the URL of the job:
+	address, err := server.address()
+	if err != nil {
+		return err
+	}
+
+	// Combine the extra variables of the action with the global ones:
+	extraVars, err := server.extraVars(action)
+	if err != nil {
+		return err
+	}
 
 	// Verify limit prompt on launch
-	if action.Limit != "" && !template.AskLimitOnLaunch() {
-		glog.Warningf("About to launch template '%s' with limit '%s', but 'prompt-on-launch' is false. Limit will be ignored",
+	if action.Limit != "" && !template.AskLimitOnLaunch {
+		logging.Warningf("About to launch template '%s' with limit '%s', but 'prompt-on-launch' is false. Limit will be ignored",
 			templateName, action.Limit)
 	}
 
 	// Verify extra-vars prompt on launch
-	if action.ExtraVars != nil && !template.AskVarsOnLaunch() {
-		glog.Warningf("About to launch template '%s' with extra-vars, but 'prompt-on-launch' is false. Extra Variables will be ignored",
+	if len(extraVars) > 0 && !template.AskVarsOnLaunch {
+		logging.Warningf("About to launch template '%s' with extra-vars, but 'prompt-on-launch' is false. Extra Variables will be ignored",
 			templateName)
 	}
 
-	launchResource := connection.JobTemplates().Id(templateId).Launch()
-	response, err := launchResource.Post().
-		ExtraVars(action.ExtraVars).
-		ExtraVar("alert", alert).
-		Limit(action.Limit).
-		Send()
+	// The alert is always passed to the job, in addition to the extra variables:
+	if extraVars == nil {
+		extraVars = make(map[string]interface{})
+	}
+	extraVars["alert"] = alert
+
+	key := launchKey(rule.ObjectMeta.Name, templateName, alert.LabelsKey())
+	job, err := r.launchWithRetries(server, key, templateName, func() (int, error) {
+		return connection.LaunchTemplate(template, extraVars, action.Limit)
+	})
 	if err != nil {
 		return err
 	}
-	glog.Infof(
-		"Request to launch AWX job from template '%s' has been sent, job identifier is '%v'",
+	url := jobURL(address, job)
+	logging.Infof(
+		"Request to launch AWX job from template '%s' has been sent, job identifier is '%v' "+
+			"and job URL is '%s'",
 		templateName,
-		response.Job,
+		job,
+		url,
 	)
 	metrics.ActionStarted(
 		"AWXJob",
 		templateName,
 		rule.ObjectMeta.Name,
 	)
+	metrics.ActionJobURL(
+		"AWXJob",
+		templateName,
+		rule.ObjectMeta.Name,
+		url,
+	)
 
 	// Add the job to active jobs map for tracking
-	r.activeJobs.Store(response.Job, rule)
+	r.addActiveJob(activeJobKey{server: server.name, kind: regularJob, id: job}, &activeJob{
+		rule:    rule,
+		alert:   alert.LabelsKey(),
+		created: time.Now(),
+	})
 
 	return nil
 }
 
-func (r *Runner) checkAWXJobStatus(jobID int) (finished bool, err error) {
-	// Get the AWX connection details from the configuration:
-	awxAddress := r.config.Address()
-	awxProxy := r.config.Proxy()
-	awxUser := r.config.User()
-	awxPassword := r.config.Password()
-	awxCA := r.config.CA()
-	awxInsecure := r.config.Insecure()
-
-	// Create the connection to the AWX server:
-	connection, err := awx.NewConnectionBuilder().
-		Url(awxAddress).
-		Proxy(awxProxy).
-		Username(awxUser).
-		Password(awxPassword).
-		CACertificates(awxCA).
-		Insecure(awxInsecure).
-		Build()
+func (r *Runner) launchAWXWorkflowJob(
+	server *awxServer,
+	connection Connection,
+	template *Template,
+	action *autoheal.AWXWorkflowAction,
+	rule *autoheal.HealingRule,
+	alert *alertmanager.Alert,
+) error {
+	templateName := template.Name
+
+	// Verify limit prompt on launch
+	if action.Limit != "" && !template.AskLimitOnLaunch {
+		logging.Warningf("About to launch workflow template '%s' with limit '%s', but 'prompt-on-launch' is false. Limit will be ignored",
+			templateName, action.Limit)
+	}
+
+	// Verify extra-vars prompt on launch
+	if len(action.ExtraVars) > 0 && !template.AskVarsOnLaunch {
+		logging.Warningf("About to launch workflow template '%s' with extra-vars, but 'prompt-on-launch' is false. Extra Variables will be ignored",
+			templateName)
+	}
+
+	// The alert and the extra variables of the action are passed to the workflow job only if the
+	// template accepts variables, as not all of them do:
+	var extraVars map[string]interface{}
+	if template.AskVarsOnLaunch {
+		extraVars = make(map[string]interface{})
+		for name, value := range action.ExtraVars {
+			extraVars[name] = value
+		}
+		extraVars["alert"] = alert
+	}
+
+	key := launchKey(rule.ObjectMeta.Name, templateName, alert.LabelsKey())
+	job, err := r.launchWithRetries(server, key, templateName, func() (int, error) {
+		return connection.LaunchWorkflowTemplate(template, extraVars, action.Limit)
+	})
 	if err != nil {
-		return
+		return err
 	}
-	defer connection.Close()
+	logging.Infof(
+		"Request to launch AWX workflow job from template '%s' has been sent, workflow job "+
+			"identifier is '%v'",
+		templateName,
+		job,
+	)
+	metrics.ActionStarted(
+		"AWXWorkflowJob",
+		templateName,
+		rule.ObjectMeta.Name,
+	)
 
-	jobsResource := connection.Jobs()
+	// Add the workflow job to active jobs map for tracking
+	r.addActiveJob(activeJobKey{server: server.name, kind: workflowJob, id: job}, &activeJob{
+		rule:    rule,
+		alert:   alert.LabelsKey(),
+		created: time.Now(),
+	})
+
+	return nil
+}
+
+// CancelJobs cancels the active jobs that were launched to heal the given alert, and removes them
+// from the active jobs map. It is intended for alerts that have been resolved, so that the healing
+// that is still in progress is aborted. Jobs that can't be cancelled are kept, and the first error
+// is returned.
+//
+func (r *Runner) CancelJobs(alert *alertmanager.Alert) (err error) {
+	// Find the jobs launched for the alert, grouped by the server where they were launched:
+	labels := alert.LabelsKey()
+	keys := make(map[string][]activeJobKey)
+	r.activeJobs.Range(func(key interface{}, value interface{}) bool {
+		if value.(*activeJob).alert == labels {
+			jobKey := key.(activeJobKey)
+			keys[jobKey.server] = append(keys[jobKey.server], jobKey)
+		}
+		return true
+	})
 
-	jobsResponse, err := jobsResource.Id(jobID).Get().Send()
+	for name, serverKeys := range keys {
+		cancelErr := r.cancelServerJobs(name, serverKeys, alert)
+		if err == nil {
+			err = cancelErr
+		}
+	}
+
+	return err
+}
+
+// cancelServerJobs cancels the given active jobs of the AWX server with the given name, and removes
+// them from the active jobs map.
+//
+func (r *Runner) cancelServerJobs(name string, keys []activeJobKey, alert *alertmanager.Alert) (err error) {
+	// Get a connection to the AWX server:
+	server, err := r.server(name)
 	if err != nil {
-		return
+		return err
+	}
+	connection, err := server.newConnection()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		server.releaseConnection(connection, err)
+	}()
+
+	for _, key := range keys {
+		value, ok := r.activeJobs.Load(key)
+		if !ok {
+			continue
+		}
+		job := value.(*activeJob)
+		logging.Infof(
+			"Cancelling %s '%d' launched by rule '%s' because alert '%s' has been resolved",
+			key.kind,
+			key.id,
+			job.rule.ObjectMeta.Name,
+			alert.Name(),
+		)
+		var cancelErr error
+		if key.kind == workflowJob {
+			cancelErr = connection.CancelWorkflowJob(key.id)
+		} else {
+			cancelErr = connection.CancelJob(key.id)
+		}
+		switch cancelErr.(type) {
+		case nil:
+			r.jobCompleted(key, job, string(awx.JobStatusCancelled))
+			r.removeActiveJob(key)
+		case *JobNotFoundError:
+			logging.Warningf("AWX %s '%d' doesn't exist in the AWX server", key.kind, key.id)
+			r.removeActiveJob(key)
+		default:
+			if err == nil {
+				err = cancelErr
+			}
+		}
 	}
 
-	job := jobsResponse.Job()
+	return err
+}
 
-	glog.Infof(
-		"Job %d status: %s",
-		job.Id(),
-		job.Status(),
-	)
+// saturated checks if the number of active jobs has reached the maximum.
+//
+func (r *Runner) saturated() bool {
+	return r.maxConcurrentJobs > 0 && atomic.LoadInt64(&r.activeJobsCount) >= int64(r.maxConcurrentJobs)
+}
 
-	finished = job.IsFinished()
+// addActiveJob adds a job to the active jobs map and updates the count.
+//
+func (r *Runner) addActiveJob(key activeJobKey, job *activeJob) {
+	r.activeJobsMutex.Lock()
+	defer r.activeJobsMutex.Unlock()
+	_, loaded := r.activeJobs.LoadOrStore(key, job)
+	if !loaded {
+		atomic.AddInt64(&r.activeJobsCount, 1)
+	}
+}
 
+// removeActiveJob removes a job from the active jobs map and updates the count.
+//
+func (r *Runner) removeActiveJob(key activeJobKey) {
+	r.activeJobsMutex.Lock()
+	defer r.activeJobsMutex.Unlock()
+	_, loaded := r.activeJobs.Load(key)
+	if loaded {
+		r.activeJobs.Delete(key)
+		atomic.AddInt64(&r.activeJobsCount, -1)
+	}
+}
+
+// envReferenceRE is the regular expression used to find the references to environment variables,
+// like ${AWX_HOST}.
+//
+var envReferenceRE = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} references to environment variables in the given text with their
+// values. It returns an error if any of the variables isn't defined.
+//
+func expandEnv(text string) (string, error) {
+	var missing []string
+	result := envReferenceRE.ReplaceAllStringFunc(text, func(reference string) string {
+		name := envReferenceRE.FindStringSubmatch(reference)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf(
+			"Can't resolve AWX address '%s', environment variables '%s' aren't defined",
+			text,
+			strings.Join(missing, "', '"),
+		)
+	}
+	return result, nil
+}
+
+// jobURL calculates the URL of the page of the AWX web console that displays the results of the
+// job with the given identifier. The address is the address of the AWX API, as returned by the
+// configuration, so the /api suffix needs to be removed.
+//
+func jobURL(address string, jobID int) string {
+	base := strings.TrimSuffix(address, "/")
+	base = strings.TrimSuffix(base, "/api")
+	return base + "/#/jobs/playbook/" + strconv.Itoa(jobID)
+}
+
+// checkAWXJobStatus retrieves from the AWX server where the job with the given key was launched
+// its status, and checks if it is one of the final ones.
+//
+func (r *Runner) checkAWXJobStatus(key activeJobKey) (status string, finished bool, err error) {
+	// Get a connection to the AWX server:
+	server, err := r.server(key.server)
+	if err != nil {
+		return
+	}
+	connection, err := server.newConnection()
+	if err != nil {
+		return
+	}
+	defer func() {
+		server.releaseConnection(connection, err)
+	}()
+
+	if key.kind == workflowJob {
+		status, err = connection.WorkflowJobStatus(key.id)
+	} else {
+		status, err = connection.JobStatus(key.id)
+	}
+	if err != nil {
+		return
+	}
+	finished = isFinalJobStatus(status)
 	return
 }
+
+// isFinalJobStatus checks if the given AWX job status is one of the statuses of jobs that have
+// finished, either successfully or not.
+//
+func isFinalJobStatus(status string) bool {
+	switch awx.JobStatus(status) {
+	case
+		awx.JobStatusSuccesful,
+		awx.JobStatusFailed,
+		awx.JobStatusError,
+		awx.JobStatusCancelled:
+		return true
+	}
+	return false
+}
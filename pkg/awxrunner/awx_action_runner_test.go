@@ -0,0 +1,202 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+func TestJobURL(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{
+			address:  "https://tower.example.com/api",
+			expected: "https://tower.example.com/#/jobs/playbook/123",
+		},
+		{
+			address:  "https://tower.example.com/api/",
+			expected: "https://tower.example.com/#/jobs/playbook/123",
+		},
+		{
+			address:  "https://tower.example.com",
+			expected: "https://tower.example.com/#/jobs/playbook/123",
+		},
+		{
+			address:  "https://tower.example.com:8443/awx/api",
+			expected: "https://tower.example.com:8443/awx/#/jobs/playbook/123",
+		},
+	}
+	for _, test := range tests {
+		actual := jobURL(test.address, 123)
+		if actual != test.expected {
+			t.Errorf("Expected URL '%s' for address '%s' but got '%s'", test.expected, test.address, actual)
+		}
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	// Start a fake AWX server that only knows the "Start node" template:
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/authtoken/":
+			w.Write([]byte(`{"token": "mytoken"}`))
+		case "/api/v2/job_templates/":
+			if r.URL.Query().Get("name") == "Start node" {
+				w.Write([]byte(`{"count": 1, "results": [{"id": 1, "name": "Start node"}]}`))
+			} else {
+				w.Write([]byte(`{"count": 0, "results": []}`))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	runner := makeRunner(t, server.URL+"/api")
+
+	rules := []*autoheal.HealingRule{
+		makeRule("start-node", "Start node"),
+		makeRule("restart-node", "Start node"),
+		makeRule("stop-node", "Stop node"),
+		makeRule("templated-node", "{{ $labels.template }}"),
+		{
+			ObjectMeta: meta.ObjectMeta{
+				Name: "no-awx-job",
+			},
+		},
+	}
+	errs := runner.ValidateTemplates(rules)
+	if len(errs) != 1 {
+		t.Fatalf("Expected exactly one error but got %d: %v", len(errs), errs)
+	}
+	if !strings.Contains(errs[0].Error(), "Stop node") {
+		t.Errorf("Expected error to mention template 'Stop node' but got '%s'", errs[0])
+	}
+}
+
+func TestValidateTemplatesWithToken(t *testing.T) {
+	// Start a fake AWX server that only accepts the OAuth2 token:
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer my-token" {
+			t.Errorf("Expected the token in the authorization header, but got '%s'", r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v2/job_templates/":
+			w.Write([]byte(`{"count": 1, "results": [{"id": 1, "name": "Start node"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	runner := makeRunnerWithConfig(t, fmt.Sprintf(`
+awx:
+  address: %s/api
+  project: "My project"
+  token: my-token
+`, server.URL))
+
+	errs := runner.ValidateTemplates([]*autoheal.HealingRule{
+		makeRule("start-node", "Start node"),
+	})
+	if len(errs) != 0 {
+		t.Errorf("Expected no errors but got %v", errs)
+	}
+}
+
+func TestValidateTemplatesServerUnavailable(t *testing.T) {
+	// Start and immediately stop a server, so that the address is valid but nothing is listening:
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	runner := makeRunner(t, server.URL+"/api")
+
+	rules := []*autoheal.HealingRule{
+		makeRule("start-node", "Start node"),
+	}
+	errs := runner.ValidateTemplates(rules)
+	if len(errs) != 1 {
+		t.Fatalf("Expected exactly one error but got %d: %v", len(errs), errs)
+	}
+}
+
+func makeRunner(t *testing.T, address string) *Runner {
+	return makeRunnerWithConfig(t, fmt.Sprintf(`
+awx:
+  address: %s
+  project: "My project"
+  credentials:
+    username: "myuser"
+    password: "mypassword"
+`, address))
+}
+
+func makeRunnerWithConfig(t *testing.T, content string) *Runner {
+	file, err := ioutil.TempFile("", "awx_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(content)
+	file.Close()
+
+	cfg, err := config.NewBuilder().
+		File(file.Name()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	stopCh := make(chan struct{})
+	close(stopCh)
+	runner, err := NewBuilder().
+		Config(cfg.AWX()).
+		Servers(cfg.Servers()).
+		StopCh(stopCh).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func makeRule(name, template string) *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: name,
+		},
+		AWXJob: &autoheal.AWXJobAction{
+			Template: template,
+		},
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the circuit breaker that stops sending requests to an AWX server that is
+// failing, so that alerts don't wait for connection timeouts while the server is unavailable.
+
+package awxrunner
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/openshift/autoheal/pkg/config"
+	"github.com/openshift/autoheal/pkg/logging"
+	"github.com/openshift/autoheal/pkg/metrics"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+// ErrCircuitOpen is the error returned instead of sending a request to an AWX server that has
+// failed too many consecutive times. It is retryable, so the alerts that triggered the actions are
+// processed again later, when the server may be available again.
+//
+var ErrCircuitOpen error = &runner.RetryableError{
+	Reason: "The AWX server has failed too many times, requests won't be sent till the circuit " +
+		"breaker is reset",
+}
+
+// The states of the circuit breaker. The values are the ones reported by the
+// autoheal_awx_circuit_state metric.
+//
+const (
+	circuitClosed   int32 = 0
+	circuitOpen     int32 = 1
+	circuitHalfOpen int32 = 2
+)
+
+// circuitBreaker counts the consecutive failures of the requests sent to an AWX server. When the
+// failure threshold of the configuration is reached it opens, and rejects all requests till the
+// reset timeout expires. Then it becomes half-open, and allows one trial request: if it succeeds
+// the breaker is closed again, if it fails it is opened again for another reset timeout.
+//
+type circuitBreaker struct {
+	// The name of the server, used for the log messages and the metric.
+	server string
+
+	// The configuration of the server, which contains the failure threshold and the reset timeout.
+	// It is read every time that they are needed, as they can change when the configuration is
+	// reloaded.
+	config *config.AWXConfig
+
+	// The number of consecutive failures, the current state, and the time when the breaker was
+	// opened, or when the last trial request was allowed, in nanoseconds since the epoch. They are
+	// all updated atomically.
+	failures int64
+	state    int32
+	opened   int64
+
+	// The function used to get the current time, so that tests can replace it.
+	now func() time.Time
+}
+
+// newCircuitBreaker creates a closed circuit breaker for the AWX server with the given name and
+// configuration.
+//
+func newCircuitBreaker(server string, config *config.AWXConfig) *circuitBreaker {
+	b := &circuitBreaker{
+		server: server,
+		config: config,
+		now:    time.Now,
+	}
+	metrics.AWXCircuitState(server, int(circuitClosed))
+	return b
+}
+
+// allow checks if a request can be sent to the server. It returns ErrCircuitOpen if the breaker is
+// open, or if it is half-open and the trial request has already been allowed.
+//
+func (b *circuitBreaker) allow() error {
+	if atomic.LoadInt32(&b.state) == circuitClosed {
+		return nil
+	}
+	opened := atomic.LoadInt64(&b.opened)
+	now := b.now().UnixNano()
+	if time.Duration(now-opened) < b.config.ResetTimeout() {
+		return ErrCircuitOpen
+	}
+
+	// Only one of the concurrent callers wins the trial request. If the trial never reports its
+	// result, for example because the action failed before sending the request, another trial will
+	// be allowed after the reset timeout.
+	if !atomic.CompareAndSwapInt64(&b.opened, opened, now) {
+		return ErrCircuitOpen
+	}
+	if atomic.SwapInt32(&b.state, circuitHalfOpen) != circuitHalfOpen {
+		logging.Infof("Circuit breaker of AWX server '%s' is half-open, sending trial request", b.server)
+		metrics.AWXCircuitState(b.server, int(circuitHalfOpen))
+	}
+	return nil
+}
+
+// record updates the breaker with the result of a request sent to the server.
+//
+func (b *circuitBreaker) record(err error) {
+	if !unavailable(err) {
+		b.success()
+	} else {
+		b.failure(err)
+	}
+}
+
+// success resets the count of consecutive failures and closes the breaker.
+//
+func (b *circuitBreaker) success() {
+	atomic.StoreInt64(&b.failures, 0)
+	if atomic.SwapInt32(&b.state, circuitClosed) != circuitClosed {
+		logging.Infof("Circuit breaker of AWX server '%s' is closed", b.server)
+		metrics.AWXCircuitState(b.server, int(circuitClosed))
+	}
+}
+
+// failure counts a failed request, and opens the breaker if the failure threshold has been reached
+// or if the failed request was the trial request of the half-open state.
+//
+func (b *circuitBreaker) failure(err error) {
+	failures := atomic.AddInt64(&b.failures, 1)
+	threshold := b.config.FailureThreshold()
+	if threshold <= 0 {
+		return
+	}
+	state := atomic.LoadInt32(&b.state)
+	if state == circuitOpen || (state == circuitClosed && failures < int64(threshold)) {
+		return
+	}
+	atomic.StoreInt64(&b.opened, b.now().UnixNano())
+	if atomic.SwapInt32(&b.state, circuitOpen) != circuitOpen {
+		logging.Warningf(
+			"Circuit breaker of AWX server '%s' is open after %d consecutive failures, no "+
+				"requests will be sent for %s: %s",
+			b.server,
+			failures,
+			b.config.ResetTimeout(),
+			err,
+		)
+		metrics.AWXCircuitState(b.server, int(circuitOpen))
+	}
+}
+
+// unavailable checks if the given error returned by a request to the AWX server indicates that the
+// server may be unavailable. Errors that are reported by the server itself, like a job that doesn't
+// exist or a 4xx status code, mean that the server is working.
+//
+func unavailable(err error) bool {
+	switch err.(type) {
+	case nil, *JobNotFoundError:
+		return false
+	}
+	return isTransientError(err)
+}
+
+// breakerConnection wraps a connection to the AWX server and reports the result of each request to
+// the circuit breaker.
+//
+type breakerConnection struct {
+	Connection
+	breaker *circuitBreaker
+}
+
+func (c *breakerConnection) FindTemplates(project, name string) ([]*Template, error) {
+	templates, err := c.Connection.FindTemplates(project, name)
+	c.breaker.record(err)
+	return templates, err
+}
+
+func (c *breakerConnection) LaunchTemplate(template *Template, extraVars map[string]interface{},
+	limit string) (int, error) {
+	job, err := c.Connection.LaunchTemplate(template, extraVars, limit)
+	c.breaker.record(err)
+	return job, err
+}
+
+func (c *breakerConnection) FindWorkflowTemplates(name string) ([]*Template, error) {
+	templates, err := c.Connection.FindWorkflowTemplates(name)
+	c.breaker.record(err)
+	return templates, err
+}
+
+func (c *breakerConnection) LaunchWorkflowTemplate(template *Template,
+	extraVars map[string]interface{}, limit string) (int, error) {
+	job, err := c.Connection.LaunchWorkflowTemplate(template, extraVars, limit)
+	c.breaker.record(err)
+	return job, err
+}
+
+func (c *breakerConnection) JobStatus(job int) (string, error) {
+	status, err := c.Connection.JobStatus(job)
+	c.breaker.record(err)
+	return status, err
+}
+
+func (c *breakerConnection) CancelJob(job int) error {
+	err := c.Connection.CancelJob(job)
+	c.breaker.record(err)
+	return err
+}
+
+func (c *breakerConnection) WorkflowJobStatus(job int) (string, error) {
+	status, err := c.Connection.WorkflowJobStatus(job)
+	c.breaker.record(err)
+	return status, err
+}
+
+func (c *breakerConnection) CancelWorkflowJob(job int) error {
+	err := c.Connection.CancelWorkflowJob(job)
+	c.breaker.record(err)
+	return err
+}
@@ -0,0 +1,171 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	breaker, _ := makeBreaker(t)
+
+	for i := 0; i < 2; i++ {
+		breaker.record(fmt.Errorf("Connection refused"))
+		if err := breaker.allow(); err != nil {
+			t.Fatalf("Expected requests to be allowed after %d failures, but got '%s'", i+1, err)
+		}
+	}
+	breaker.record(fmt.Errorf("Connection refused"))
+	if err := breaker.allow(); err != ErrCircuitOpen {
+		t.Errorf("Expected the circuit to be open after three failures, but got '%v'", err)
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	breaker, _ := makeBreaker(t)
+
+	breaker.record(fmt.Errorf("Connection refused"))
+	breaker.record(fmt.Errorf("Connection refused"))
+	breaker.record(nil)
+	breaker.record(fmt.Errorf("Connection refused"))
+	breaker.record(fmt.Errorf("Connection refused"))
+	if err := breaker.allow(); err != nil {
+		t.Errorf("Expected the failures before the success to be forgotten, but got '%s'", err)
+	}
+}
+
+func TestCircuitBreakerIgnoresServerErrors(t *testing.T) {
+	breaker, _ := makeBreaker(t)
+
+	for i := 0; i < 5; i++ {
+		breaker.record(&JobNotFoundError{Job: 123})
+		breaker.record(fmt.Errorf("Status code '404' returned from server"))
+	}
+	if err := breaker.allow(); err != nil {
+		t.Errorf("Expected errors reported by the server to be ignored, but got '%s'", err)
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsOneTrial(t *testing.T) {
+	breaker, clock := makeBreaker(t)
+	openBreaker(breaker)
+
+	*clock = clock.Add(59 * time.Second)
+	if err := breaker.allow(); err != ErrCircuitOpen {
+		t.Errorf("Expected the circuit to be open before the reset timeout, but got '%v'", err)
+	}
+
+	// After the reset timeout only one trial request is allowed:
+	*clock = clock.Add(time.Second)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("Expected the trial request to be allowed, but got '%s'", err)
+	}
+	if err := breaker.allow(); err != ErrCircuitOpen {
+		t.Errorf("Expected only one trial request to be allowed, but got '%v'", err)
+	}
+
+	// A successful trial closes the circuit:
+	breaker.record(nil)
+	if err := breaker.allow(); err != nil {
+		t.Errorf("Expected the circuit to be closed after the trial, but got '%s'", err)
+	}
+}
+
+func TestCircuitBreakerTrialFailureOpensAgain(t *testing.T) {
+	breaker, clock := makeBreaker(t)
+	openBreaker(breaker)
+
+	*clock = clock.Add(time.Minute)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("Expected the trial request to be allowed, but got '%s'", err)
+	}
+	breaker.record(fmt.Errorf("Connection refused"))
+	*clock = clock.Add(30 * time.Second)
+	if err := breaker.allow(); err != ErrCircuitOpen {
+		t.Errorf("Expected the circuit to be open again after the trial failed, but got '%v'", err)
+	}
+	*clock = clock.Add(30 * time.Second)
+	if err := breaker.allow(); err != nil {
+		t.Errorf("Expected another trial after the reset timeout, but got '%s'", err)
+	}
+}
+
+func TestCircuitBreakerAllowsAnotherTrialIfNoResult(t *testing.T) {
+	breaker, clock := makeBreaker(t)
+	openBreaker(breaker)
+
+	// The trial request is allowed, but its result is never reported:
+	*clock = clock.Add(time.Minute)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("Expected the trial request to be allowed, but got '%s'", err)
+	}
+	*clock = clock.Add(time.Minute)
+	if err := breaker.allow(); err != nil {
+		t.Errorf("Expected another trial after the reset timeout, but got '%s'", err)
+	}
+}
+
+func TestPoolRejectsConnectionsWhenCircuitOpen(t *testing.T) {
+	runner := makeRunnerWithConfig(t, `
+awx:
+  address: https://awx.example.com/api
+  project: "My project"
+  token: "mytoken"
+  failureThreshold: 1
+`)
+	factory := &countingFactory{}
+	pool := newConnectionPool("", runner.config, factory.create, 1)
+
+	pool.breaker.record(fmt.Errorf("Connection refused"))
+	_, err := pool.get("https://awx.example.com/api")
+	if err != ErrCircuitOpen {
+		t.Errorf("Expected the circuit to be open, but got '%v'", err)
+	}
+	if len(factory.created) != 0 {
+		t.Errorf("Expected no connections to be created, but got %d", len(factory.created))
+	}
+}
+
+// makeBreaker creates a circuit breaker with a failure threshold of three and a reset timeout of
+// one minute, and a fake clock that can be moved forward by the test.
+//
+func makeBreaker(t *testing.T) (*circuitBreaker, *time.Time) {
+	runner := makeRunnerWithConfig(t, `
+awx:
+  address: https://awx.example.com/api
+  project: "My project"
+  token: "mytoken"
+  failureThreshold: 3
+  resetTimeout: 1m
+`)
+	clock := time.Now()
+	breaker := newCircuitBreaker("", runner.config)
+	breaker.now = func() time.Time {
+		return clock
+	}
+	return breaker, &clock
+}
+
+// openBreaker records failures in the given breaker till it opens.
+//
+func openBreaker(breaker *circuitBreaker) {
+	for breaker.allow() == nil {
+		breaker.record(fmt.Errorf("Connection refused"))
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the definition of the interface that the runner uses to talk to the AWX
+// server, and its implementation based on the AWX client.
+
+package awxrunner
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/moolitayer/awx-client-go/awx"
+
+	"github.com/openshift/autoheal/pkg/config"
+	"github.com/openshift/autoheal/pkg/logging"
+)
+
+// Connection is the interface that the runner uses to talk to the AWX server. The default
+// implementation uses the AWX client, but tests can replace it using the ConnectionFactory method
+// of the builder.
+//
+type Connection interface {
+	// FindTemplates returns the job templates with the given name from the given project. If there
+	// are no such templates it returns an empty slice and no error.
+	FindTemplates(project, name string) ([]*Template, error)
+
+	// LaunchTemplate launches a job from the given template and returns the identifier of the new
+	// job.
+	LaunchTemplate(template *Template, extraVars map[string]interface{}, limit string) (int, error)
+
+	// FindWorkflowTemplates returns the workflow job templates with the given name. If there are no
+	// such templates it returns an empty slice and no error.
+	FindWorkflowTemplates(name string) ([]*Template, error)
+
+	// LaunchWorkflowTemplate launches a workflow job from the given workflow job template and
+	// returns the identifier of the new workflow job. The extra variables may be nil.
+	LaunchWorkflowTemplate(template *Template, extraVars map[string]interface{}, limit string) (int, error)
+
+	// JobStatus returns the status of the job with the given identifier, for example 'running' or
+	// 'successful'. If the job doesn't exist it returns a *JobNotFoundError.
+	JobStatus(job int) (string, error)
+
+	// CancelJob requests the cancellation of the job with the given identifier. If the job has
+	// already finished it does nothing. If the job doesn't exist it returns a *JobNotFoundError.
+	CancelJob(job int) error
+
+	// WorkflowJobStatus returns the status of the workflow job with the given identifier. If the
+	// workflow job doesn't exist it returns a *JobNotFoundError.
+	WorkflowJobStatus(job int) (string, error)
+
+	// CancelWorkflowJob requests the cancellation of the workflow job with the given identifier. If
+	// the workflow job has already finished it does nothing. If it doesn't exist it returns a
+	// *JobNotFoundError.
+	CancelWorkflowJob(job int) error
+
+	// Close releases the resources used by the connection.
+	Close()
+}
+
+// Template contains the details of an AWX job template, or workflow job template, that the runner
+// needs.
+//
+type Template struct {
+	Id               int
+	Name             string
+	AskLimitOnLaunch bool
+	AskVarsOnLaunch  bool
+}
+
+// JobNotFoundError is the error returned when the AWX server doesn't know a job.
+//
+type JobNotFoundError struct {
+	// Job is the identifier of the job.
+	Job int
+}
+
+func (e *JobNotFoundError) Error() string {
+	return fmt.Sprintf("Job %d doesn't exist", e.Job)
+}
+
+// ConnectionFactory is the type of the functions that create connections to the AWX server. The
+// runner calls it every time that it needs to talk to the server, and closes the connection when it
+// is done. The address is the address from the configuration with the environment variables already
+// replaced, and it should be used instead of the one returned by the Address method of the
+// configuration.
+//
+type ConnectionFactory func(config *config.AWXConfig, address string) (Connection, error)
+
+// clientConnection is the implementation of the connection interface that uses the AWX client, and
+// the API client for the requests that the AWX client doesn't support, like the cancellation of
+// jobs and the workflow job templates. When the configuration contains an OAuth2 token there is no
+// AWX client, and all the requests are sent with the API client.
+//
+type clientConnection struct {
+	connection *awx.Connection
+	api        *apiClient
+}
+
+// newClientConnection creates a new connection to the AWX server with the given address, using the
+// rest of the connection details from the configuration.
+//
+func newClientConnection(config *config.AWXConfig, address string) (Connection, error) {
+	// The OAuth2 token is preferred, as AWX recommends it over the user name and password. The AWX
+	// client accepts it, but then ignores it, so in that case only the API client is used:
+	api, err := newAPIClient(config, address)
+	if err != nil {
+		return nil, err
+	}
+	if config.Token() != "" {
+		return &clientConnection{
+			api: api,
+		}, nil
+	}
+
+	connection, err := awx.NewConnectionBuilder().
+		Url(address).
+		Proxy(config.Proxy()).
+		CACertificates(config.CA()).
+		Insecure(config.Insecure()).
+		Username(config.User()).
+		Password(config.Password()).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	return &clientConnection{
+		connection: connection,
+		api:        api,
+	}, nil
+}
+
+func (c *clientConnection) FindTemplates(project, name string) (templates []*Template, err error) {
+	if c.connection == nil {
+		return c.api.findTemplates("job_templates", url.Values{
+			"project__name": {project},
+			"name":          {name},
+		})
+	}
+	response, err := c.connection.JobTemplates().Get().
+		Filter("project__name", project).
+		Filter("name", name).
+		Send()
+	if err != nil {
+		return
+	}
+	results := response.Results()
+	templates = make([]*Template, len(results))
+	for i, result := range results {
+		templates[i] = &Template{
+			Id:               result.Id(),
+			Name:             result.Name(),
+			AskLimitOnLaunch: result.AskLimitOnLaunch(),
+			AskVarsOnLaunch:  result.AskVarsOnLaunch(),
+		}
+	}
+	return
+}
+
+func (c *clientConnection) LaunchTemplate(template *Template, extraVars map[string]interface{},
+	limit string) (job int, err error) {
+	if c.connection == nil {
+		var response *apiLaunchResponse
+		response, err = c.api.launchTemplate("job_templates", template.Id, extraVars, limit)
+		if err != nil {
+			return
+		}
+		job = response.Job
+		return
+	}
+	response, err := c.connection.JobTemplates().Id(template.Id).Launch().Post().
+		ExtraVars(extraVars).
+		Limit(limit).
+		Send()
+	if err != nil {
+		return
+	}
+	job = response.Job
+	return
+}
+
+func (c *clientConnection) FindWorkflowTemplates(name string) ([]*Template, error) {
+	return c.api.findTemplates("workflow_job_templates", url.Values{
+		"name": {name},
+	})
+}
+
+func (c *clientConnection) LaunchWorkflowTemplate(template *Template, extraVars map[string]interface{},
+	limit string) (job int, err error) {
+	response, err := c.api.launchTemplate("workflow_job_templates", template.Id, extraVars, limit)
+	if err != nil {
+		return
+	}
+	job = response.WorkflowJob
+	return
+}
+
+func (c *clientConnection) JobStatus(job int) (status string, err error) {
+	if c.connection == nil {
+		status, err = c.api.jobStatus("jobs", job)
+		if apiErrorCode(err) == http.StatusNotFound {
+			err = &JobNotFoundError{Job: job}
+		}
+		if err != nil {
+			return
+		}
+		logging.Infof("Job %d status: %s", job, status)
+		return
+	}
+	response, err := c.connection.Jobs().Id(job).Get().Send()
+	if err != nil {
+		// The AWX client doesn't return the status code in a structured way, so we need to check
+		// the text of the error message:
+		if strings.Contains(err.Error(), "Status code '404'") {
+			err = &JobNotFoundError{Job: job}
+		}
+		return
+	}
+	logging.Infof(
+		"Job %d status: %s",
+		response.Job().Id(),
+		response.Job().Status(),
+	)
+	status = string(response.Job().Status())
+	return
+}
+
+func (c *clientConnection) CancelJob(job int) error {
+	err := c.api.cancelJob("jobs", job)
+	if err != nil {
+		return cancelError(job, err)
+	}
+	logging.Infof("Job %d cancellation requested", job)
+	return nil
+}
+
+func (c *clientConnection) WorkflowJobStatus(job int) (string, error) {
+	status, err := c.api.jobStatus("workflow_jobs", job)
+	if apiErrorCode(err) == http.StatusNotFound {
+		err = &JobNotFoundError{Job: job}
+	}
+	if err != nil {
+		return "", err
+	}
+	logging.Infof("Workflow job %d status: %s", job, status)
+	return status, nil
+}
+
+func (c *clientConnection) CancelWorkflowJob(job int) error {
+	err := c.api.cancelJob("workflow_jobs", job)
+	if err != nil {
+		return cancelError(job, err)
+	}
+	logging.Infof("Workflow job %d cancellation requested", job)
+	return nil
+}
+
+// cancelError translates the error returned by the server to a request to cancel the given job.
+// The server responds with 405 when the job can't be cancelled because it has already finished, so
+// that isn't an error.
+//
+func cancelError(job int, err error) error {
+	switch apiErrorCode(err) {
+	case http.StatusNotFound:
+		return &JobNotFoundError{Job: job}
+	case http.StatusMethodNotAllowed:
+		return nil
+	}
+	return err
+}
+
+func (c *clientConnection) Close() {
+	if c.connection != nil {
+		c.connection.Close()
+	}
+}
@@ -0,0 +1,563 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/awxrunner"
+	"github.com/openshift/autoheal/pkg/config"
+	"github.com/openshift/autoheal/pkg/runner"
+	"github.com/openshift/autoheal/pkg/testutil"
+)
+
+func TestRunActionWithFakeConnection(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Start node": {Job: 123},
+	})
+	runner := makeFakeRunner(t, connection)
+
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	action := &autoheal.AWXJobAction{
+		Template: "Start node",
+		Limit:    "node0",
+	}
+	err := runner.RunAction(makeFakeRule("start-node", action), action, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	launches := connection.Launches()
+	if len(launches) != 1 {
+		t.Fatalf("Expected exactly one launch but got %d", len(launches))
+	}
+	launch := launches[0]
+	if launch.Template != "Start node" {
+		t.Errorf("Expected template 'Start node' but got '%s'", launch.Template)
+	}
+	if launch.Limit != "node0" {
+		t.Errorf("Expected limit 'node0' but got '%s'", launch.Limit)
+	}
+	if launch.ExtraVars["alert"] != alert {
+		t.Errorf("Expected the alert to be passed in the extra variables, but got %v", launch.ExtraVars)
+	}
+}
+
+func TestRunActionWithMissingTemplate(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{})
+	runner := makeFakeRunner(t, connection)
+
+	action := &autoheal.AWXJobAction{
+		Template: "Start node",
+	}
+	err := runner.RunAction(makeFakeRule("start-node", action), action, &alertmanager.Alert{})
+	if err == nil {
+		t.Errorf("Expected an error for a template that doesn't exist")
+	}
+	if len(connection.Launches()) != 0 {
+		t.Errorf("Expected no launches, but got %d", len(connection.Launches()))
+	}
+}
+
+func TestRunActionWithLaunchError(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Start node": {Error: fmt.Errorf("Launch failed")},
+	})
+	runner := makeFakeRunner(t, connection)
+
+	action := &autoheal.AWXJobAction{
+		Template: "Start node",
+	}
+	err := runner.RunAction(makeFakeRule("start-node", action), action, &alertmanager.Alert{})
+	if err == nil || err.Error() != "Launch failed" {
+		t.Errorf("Expected the launch error to be returned, but got '%v'", err)
+	}
+}
+
+func TestRunWorkflowActionWithFakeConnection(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{})
+	connection.WorkflowTemplates["Heal cluster"] = &testutil.FakeAWXLaunchResponse{Job: 456}
+	runner := makeFakeRunner(t, connection)
+
+	alert := &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "ClusterDown",
+		},
+	}
+	action := &autoheal.AWXWorkflowAction{
+		Template: "Heal cluster",
+		Limit:    "master0",
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "heal-cluster",
+		},
+		WorkflowJob: action,
+	}
+	err := runner.RunAction(rule, action, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	launches := connection.Launches()
+	if len(launches) != 1 {
+		t.Fatalf("Expected exactly one launch but got %d", len(launches))
+	}
+	launch := launches[0]
+	if !launch.Workflow {
+		t.Errorf("Expected the job to be launched from a workflow template")
+	}
+	if launch.Template != "Heal cluster" {
+		t.Errorf("Expected template 'Heal cluster' but got '%s'", launch.Template)
+	}
+	if launch.Limit != "master0" {
+		t.Errorf("Expected limit 'master0' but got '%s'", launch.Limit)
+	}
+	if launch.ExtraVars["alert"] != alert {
+		t.Errorf("Expected the alert to be passed in the extra variables, but got %v", launch.ExtraVars)
+	}
+}
+
+func TestRunWorkflowActionWithMissingTemplate(t *testing.T) {
+	// A job template with the same name shouldn't be used for the workflow:
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Heal cluster": {Job: 123},
+	})
+	runner := makeFakeRunner(t, connection)
+
+	action := &autoheal.AWXWorkflowAction{
+		Template: "Heal cluster",
+	}
+	rule := &autoheal.HealingRule{
+		WorkflowJob: action,
+	}
+	err := runner.RunAction(rule, action, &alertmanager.Alert{})
+	if err == nil {
+		t.Errorf("Expected an error for a workflow template that doesn't exist")
+	}
+	if len(connection.Launches()) != 0 {
+		t.Errorf("Expected no launches, but got %d", len(connection.Launches()))
+	}
+}
+
+func TestValidateTemplatesWithFakeConnection(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Start node": {Job: 123},
+	})
+	runner := makeFakeRunner(t, connection)
+
+	rules := []*autoheal.HealingRule{
+		makeFakeRule("start-node", &autoheal.AWXJobAction{Template: "Start node"}),
+		makeFakeRule("stop-node", &autoheal.AWXJobAction{Template: "Stop node"}),
+	}
+	errs := runner.ValidateTemplates(rules)
+	if len(errs) != 1 {
+		t.Errorf("Expected exactly one error but got %d: %v", len(errs), errs)
+	}
+}
+
+func TestRunActionResolvesAddressFromEnvironment(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Start node": {Job: 123},
+	})
+	runner := makeFakeRunnerWithAddress(t, connection, "https://${TEST_AWX_HOST}/api")
+
+	action := &autoheal.AWXJobAction{
+		Template: "Start node",
+	}
+	os.Setenv("TEST_AWX_HOST", "tower.example.com")
+	defer os.Unsetenv("TEST_AWX_HOST")
+	err := runner.RunAction(makeFakeRule("start-node", action), action, &alertmanager.Alert{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The variable is resolved when the action runs, so changes are used by the next action:
+	os.Setenv("TEST_AWX_HOST", "other.example.com")
+	err = runner.RunAction(makeFakeRule("start-node", action), action, &alertmanager.Alert{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := connection.Addresses()
+	if len(addresses) != 2 {
+		t.Fatalf("Expected exactly two connections but got %d", len(addresses))
+	}
+	if addresses[0] != "https://tower.example.com/api" {
+		t.Errorf("Expected address 'https://tower.example.com/api' but got '%s'", addresses[0])
+	}
+	if addresses[1] != "https://other.example.com/api" {
+		t.Errorf("Expected address 'https://other.example.com/api' but got '%s'", addresses[1])
+	}
+}
+
+func TestRunActionWithUndefinedAddressVariable(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Start node": {Job: 123},
+	})
+	runner := makeFakeRunnerWithAddress(t, connection, "https://${TEST_AWX_UNDEFINED}/api")
+
+	action := &autoheal.AWXJobAction{
+		Template: "Start node",
+	}
+	os.Unsetenv("TEST_AWX_UNDEFINED")
+	err := runner.RunAction(makeFakeRule("start-node", action), action, &alertmanager.Alert{})
+	if err == nil {
+		t.Errorf("Expected an error for an undefined environment variable")
+	}
+	if len(connection.Addresses()) != 0 {
+		t.Errorf("Expected no connections, but got %d", len(connection.Addresses()))
+	}
+	if len(connection.Launches()) != 0 {
+		t.Errorf("Expected no launches, but got %d", len(connection.Launches()))
+	}
+}
+
+func TestRunWorkflowActionPassesExtraVars(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{})
+	connection.WorkflowTemplates["Heal cluster"] = &testutil.FakeAWXLaunchResponse{Job: 456}
+	runner := makeFakeRunner(t, connection)
+
+	action := &autoheal.AWXWorkflowAction{
+		Template: "Heal cluster",
+		ExtraVars: autoheal.JsonDoc{
+			"environment": "production",
+		},
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "heal-cluster",
+		},
+		WorkflowJob: action,
+	}
+	alert := &alertmanager.Alert{}
+	err := runner.RunAction(rule, action, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	launches := connection.Launches()
+	if len(launches) != 1 {
+		t.Fatalf("Expected exactly one launch but got %d", len(launches))
+	}
+	vars := launches[0].ExtraVars
+	if vars["environment"] != "production" || vars["alert"] != alert {
+		t.Errorf("Expected the extra variables of the action and the alert, but got %v", vars)
+	}
+}
+
+func TestWorkflowJobsAreTracked(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{})
+	connection.WorkflowTemplates["Heal cluster"] = &testutil.FakeAWXLaunchResponse{Job: 456}
+	awxRunner := makeFakeRunnerWithConfig(t, connection, `
+awx:
+  address: https://tower.example.com/api
+  credentials:
+    username: my-user
+    password: my-password
+  project: "My project"
+  maxConcurrentJobs: 1
+`)
+
+	action := &autoheal.AWXWorkflowAction{
+		Template: "Heal cluster",
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "heal-cluster",
+		},
+		WorkflowJob: action,
+	}
+	firing := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "ClusterDown",
+		},
+	}
+	err := awxRunner.RunAction(rule, action, firing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The workflow job is still active, so it counts for the maximum of active jobs:
+	err = awxRunner.RunAction(rule, action, firing)
+	if !runner.IsRetryable(err) {
+		t.Errorf("Expected a retryable error when the maximum of active jobs is reached, but got '%v'", err)
+	}
+
+	// When the alert is resolved the workflow job should be cancelled:
+	resolved := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusResolved,
+		Labels: map[string]string{
+			"alertname": "ClusterDown",
+		},
+	}
+	err = awxRunner.CancelJobs(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancellations := connection.WorkflowCancellations()
+	if len(cancellations) != 1 || cancellations[0] != 456 {
+		t.Errorf("Expected workflow job 456 to be cancelled, but got %v", cancellations)
+	}
+	if len(connection.Cancellations()) != 0 {
+		t.Errorf("Expected no regular job to be cancelled, but got %v", connection.Cancellations())
+	}
+}
+
+func TestWaitForActiveWorkflowJobs(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{})
+	connection.WorkflowTemplates["Heal cluster"] = &testutil.FakeAWXLaunchResponse{Job: 456}
+	connection.JobStatuses[456] = "successful"
+	awxRunner := makeFakeRunnerWithConfig(t, connection, `
+awx:
+  address: https://tower.example.com/api
+  credentials:
+    username: my-user
+    password: my-password
+  project: "My project"
+  jobStatusCheckInterval: 10ms
+`)
+
+	action := &autoheal.AWXWorkflowAction{
+		Template: "Heal cluster",
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "heal-cluster",
+		},
+		WorkflowJob: action,
+	}
+	err := awxRunner.RunAction(rule, action, &alertmanager.Alert{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The status of the regular job with the same identifier shouldn't be used:
+	err = awxRunner.WaitForActiveJobs(10 * time.Millisecond)
+	if err == nil {
+		t.Fatalf("Expected the workflow job to be still active")
+	}
+
+	connection.WorkflowJobStatuses[456] = "successful"
+	err = awxRunner.WaitForActiveJobs(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunActionWhenSaturated(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Start node": {Job: 123},
+	})
+	awxRunner := makeFakeRunnerWithConfig(t, connection, `
+awx:
+  address: https://tower.example.com/api
+  credentials:
+    username: my-user
+    password: my-password
+  project: "My project"
+  maxConcurrentJobs: 1
+`)
+
+	action := &autoheal.AWXJobAction{
+		Template: "Start node",
+	}
+	rule := makeFakeRule("start-node", action)
+	err := awxRunner.RunAction(rule, action, &alertmanager.Alert{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first job is still active, so the second one shouldn't be launched:
+	err = awxRunner.RunAction(rule, action, &alertmanager.Alert{})
+	if !runner.IsRetryable(err) {
+		t.Errorf("Expected a retryable error when the maximum of active jobs is reached, but got '%v'", err)
+	}
+	if len(connection.Launches()) != 1 {
+		t.Errorf("Expected exactly one launch but got %d", len(connection.Launches()))
+	}
+}
+
+func TestRunActionWhenCircuitOpen(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Start node": {Error: fmt.Errorf("Connection refused")},
+	})
+	awxRunner := makeFakeRunnerWithConfig(t, connection, `
+awx:
+  address: https://tower.example.com/api
+  credentials:
+    username: my-user
+    password: my-password
+  project: "My project"
+  failureThreshold: 2
+`)
+
+	action := &autoheal.AWXJobAction{
+		Template: "Start node",
+	}
+	rule := makeFakeRule("start-node", action)
+	for i := 0; i < 2; i++ {
+		err := awxRunner.RunAction(rule, action, &alertmanager.Alert{})
+		if err == nil || err.Error() != "Connection refused" {
+			t.Fatalf("Expected the launch error to be returned, but got '%v'", err)
+		}
+	}
+
+	// The threshold has been reached, so no connection should be attempted:
+	err := awxRunner.RunAction(rule, action, &alertmanager.Alert{})
+	if err != awxrunner.ErrCircuitOpen {
+		t.Errorf("Expected the circuit to be open, but got '%v'", err)
+	}
+	if !runner.IsRetryable(err) {
+		t.Errorf("Expected the open circuit error to be retryable")
+	}
+	if len(connection.Addresses()) != 2 {
+		t.Errorf("Expected exactly two connections, but got %d", len(connection.Addresses()))
+	}
+}
+
+func TestRunActionReusesConnection(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Start node": {Job: 123},
+		"Stop node":  {Job: 456},
+	})
+	runner := makeFakeRunner(t, connection)
+
+	for _, template := range []string{"Start node", "Stop node"} {
+		action := &autoheal.AWXJobAction{
+			Template: template,
+		}
+		err := runner.RunAction(makeFakeRule("heal-node", action), action, &alertmanager.Alert{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(connection.Addresses()) != 1 {
+		t.Errorf("Expected one connection to be created, but got %d", len(connection.Addresses()))
+	}
+}
+
+func TestCancelJobsWithFakeConnection(t *testing.T) {
+	connection := testutil.NewFakeAWXConnection(map[string]*testutil.FakeAWXLaunchResponse{
+		"Start node": {Job: 123},
+	})
+	runner := makeFakeRunner(t, connection)
+
+	firing := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	action := &autoheal.AWXJobAction{
+		Template: "Start node",
+	}
+	err := runner.RunAction(makeFakeRule("start-node", action), action, firing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := &alertmanager.Alert{
+		Status: alertmanager.AlertStatusResolved,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+	err = runner.CancelJobs(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancellations := connection.Cancellations()
+	if len(cancellations) != 1 || cancellations[0] != 123 {
+		t.Errorf("Expected job 123 to be cancelled, but got %v", cancellations)
+	}
+
+	// The job has been removed, so it isn't cancelled again:
+	err = runner.CancelJobs(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(connection.Cancellations()) != 1 {
+		t.Errorf("Expected exactly one cancellation, but got %d", len(connection.Cancellations()))
+	}
+}
+
+func makeFakeRunner(t *testing.T, connection *testutil.FakeAWXConnection) *awxrunner.Runner {
+	return makeFakeRunnerWithAddress(t, connection, "https://tower.example.com/api")
+}
+
+func makeFakeRunnerWithAddress(t *testing.T, connection *testutil.FakeAWXConnection,
+	address string) *awxrunner.Runner {
+	return makeFakeRunnerWithConfig(t, connection, fmt.Sprintf(`
+awx:
+  address: %s
+  credentials:
+    username: my-user
+    password: my-password
+  project: "My project"
+`, address))
+}
+
+func makeFakeRunnerWithConfig(t *testing.T, connection *testutil.FakeAWXConnection,
+	content string) *awxrunner.Runner {
+	file, err := ioutil.TempFile("", "awx_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(content)
+	file.Close()
+
+	cfg, err := config.NewBuilder().
+		File(file.Name()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := awxrunner.NewBuilder().
+		Config(cfg.AWX()).
+		ConnectionFactory(connection.Factory()).
+		MaxConcurrentJobs(cfg.AWX().MaxConcurrentJobs()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func makeFakeRule(name string, action *autoheal.AWXJobAction) *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: name,
+		},
+		AWXJob: action,
+	}
+}
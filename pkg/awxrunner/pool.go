@@ -0,0 +1,161 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the pool of connections to the AWX server, used to avoid creating a new
+// connection, and doing a new TLS handshake, for every request.
+
+package awxrunner
+
+import (
+	"sync"
+
+	"github.com/openshift/autoheal/pkg/config"
+	"github.com/openshift/autoheal/pkg/logging"
+)
+
+// connectionPool keeps the connections to the AWX server that aren't being used, so that they can
+// be reused by later requests. Connections that fail are discarded, and new ones are created when
+// needed, so the pool reconnects automatically when the server is restarted.
+//
+type connectionPool struct {
+	config  *config.AWXConfig
+	factory ConnectionFactory
+
+	// The maximum number of idle connections kept in the pool. Zero means that connections are
+	// closed as soon as they are released.
+	size int
+
+	// The circuit breaker that stops the creation of connections when the server is failing.
+	breaker *circuitBreaker
+
+	// The mutex protects the idle connections and the drained flag.
+	mutex   *sync.Mutex
+	idle    []*pooledConnection
+	drained bool
+}
+
+// pooledConnection is a connection that remembers the address that was used to create it, as it
+// may contain environment variables that can change.
+//
+type pooledConnection struct {
+	Connection
+	address string
+}
+
+// newConnectionPool creates a pool for the AWX server with the given name, that creates connections
+// using the given factory and configuration, and that keeps at most the given number of idle
+// connections.
+//
+func newConnectionPool(name string, config *config.AWXConfig, factory ConnectionFactory,
+	size int) *connectionPool {
+	return &connectionPool{
+		config:  config,
+		factory: factory,
+		size:    size,
+		breaker: newCircuitBreaker(name, config),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// get returns an idle connection to the given address, or creates a new one if there is none. The
+// connection should be returned to the pool with the put method when it is no longer needed. If the
+// circuit breaker of the server is open it returns ErrCircuitOpen.
+//
+func (p *connectionPool) get(address string) (Connection, error) {
+	err := p.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	for len(p.idle) > 0 {
+		last := len(p.idle) - 1
+		connection := p.idle[last]
+		p.idle = p.idle[:last]
+		if connection.address == address {
+			p.mutex.Unlock()
+			return connection, nil
+		}
+		connection.Close()
+	}
+	p.mutex.Unlock()
+
+	connection, err := p.factory(p.config, address)
+	if err != nil {
+		p.breaker.record(err)
+		return nil, err
+	}
+	return &pooledConnection{
+		Connection: &breakerConnection{
+			Connection: connection,
+			breaker:    p.breaker,
+		},
+		address: address,
+	}, nil
+}
+
+// put returns to the pool a connection obtained with the get method. The error is the result of
+// the last request sent using the connection. If it indicates that the connection may be broken
+// the connection is closed instead of being kept for later requests.
+//
+func (p *connectionPool) put(connection Connection, err error) {
+	pooled := connection.(*pooledConnection)
+	if !healthy(err) {
+		logging.Infof("Closing AWX connection after error: %s", err)
+		pooled.Close()
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.drained || len(p.idle) >= p.size {
+		pooled.Close()
+		return
+	}
+	p.idle = append(p.idle, pooled)
+}
+
+// closeIdle closes all the idle connections. The pool can still be used, and new connections will
+// be created when needed.
+//
+func (p *connectionPool) closeIdle() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, connection := range p.idle {
+		connection.Close()
+	}
+	p.idle = nil
+}
+
+// drain closes all the idle connections, and makes sure that the connections that are in use are
+// closed when they are returned to the pool.
+//
+func (p *connectionPool) drain() {
+	p.mutex.Lock()
+	p.drained = true
+	p.mutex.Unlock()
+	p.closeIdle()
+}
+
+// healthy checks if a connection that returned the given error can still be used. Errors that are
+// reported by the server for a specific job don't affect the connection.
+//
+func healthy(err error) bool {
+	switch err.(type) {
+	case nil, *JobNotFoundError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+func TestPoolReusesConnection(t *testing.T) {
+	factory := &countingFactory{}
+	pool := newConnectionPool("", &config.AWXConfig{}, factory.create, 1)
+
+	first, err := pool.get("https://awx.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.put(first, nil)
+	second, err := pool.get("https://awx.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("Expected the idle connection to be reused")
+	}
+	if len(factory.created) != 1 {
+		t.Errorf("Expected one connection to be created, but got %d", len(factory.created))
+	}
+}
+
+func TestPoolClosesConnectionAfterError(t *testing.T) {
+	factory := &countingFactory{}
+	pool := newConnectionPool("", &config.AWXConfig{}, factory.create, 1)
+
+	first, err := pool.get("https://awx.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.put(first, fmt.Errorf("Connection reset by peer"))
+	if !factory.created[0].closed {
+		t.Errorf("Expected the connection that failed to be closed")
+	}
+	_, err = pool.get("https://awx.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(factory.created) != 2 {
+		t.Errorf("Expected a new connection to be created, but got %d connections", len(factory.created))
+	}
+}
+
+func TestPoolKeepsConnectionAfterJobNotFound(t *testing.T) {
+	factory := &countingFactory{}
+	pool := newConnectionPool("", &config.AWXConfig{}, factory.create, 1)
+
+	first, err := pool.get("https://awx.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.put(first, &JobNotFoundError{Job: 1})
+	if factory.created[0].closed {
+		t.Errorf("Expected the connection to be kept when the job doesn't exist")
+	}
+}
+
+func TestPoolDoesntReuseConnectionToOtherAddress(t *testing.T) {
+	factory := &countingFactory{}
+	pool := newConnectionPool("", &config.AWXConfig{}, factory.create, 1)
+
+	first, err := pool.get("https://awx-a.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.put(first, nil)
+	_, err = pool.get("https://awx-b.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !factory.created[0].closed {
+		t.Errorf("Expected the connection to the old address to be closed")
+	}
+	if len(factory.created) != 2 {
+		t.Errorf("Expected a new connection to be created, but got %d connections", len(factory.created))
+	}
+}
+
+func TestPoolDrainClosesConnections(t *testing.T) {
+	factory := &countingFactory{}
+	pool := newConnectionPool("", &config.AWXConfig{}, factory.create, 2)
+
+	idle, err := pool.get("https://awx.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy, err := pool.get("https://awx.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.put(idle, nil)
+	pool.drain()
+	if !factory.created[0].closed {
+		t.Errorf("Expected the idle connection to be closed when the pool is drained")
+	}
+	pool.put(busy, nil)
+	if !factory.created[1].closed {
+		t.Errorf("Expected the busy connection to be closed when returned to a drained pool")
+	}
+}
+
+// countingFactory is a connection factory that remembers the connections that it created.
+//
+type countingFactory struct {
+	created []*closableConnection
+}
+
+func (f *countingFactory) create(*config.AWXConfig, string) (Connection, error) {
+	connection := &closableConnection{}
+	f.created = append(f.created, connection)
+	return connection, nil
+}
+
+// closableConnection is a connection that only remembers if it has been closed. Calling any other
+// method will panic.
+//
+type closableConnection struct {
+	Connection
+	closed bool
+}
+
+func (c *closableConnection) Close() {
+	c.closed = true
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to retry the launch of jobs that fail because the request
+// didn't reach the AWX server.
+
+package awxrunner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+
+	"github.com/openshift/autoheal/pkg/logging"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+// statusCodeRE is the regular expression used to extract the HTTP status code from the error
+// messages returned by the AWX client, as it doesn't return it in a structured way.
+//
+var statusCodeRE = regexp.MustCompile(`Status code '(\d+)'`)
+
+// launchWithRetries calls the given function, which launches a job from the template with the given
+// name. When the launch fails because the request never reached the AWX server, for example
+// because the connection was refused or the name of the server couldn't be resolved, it returns a
+// retryable error, so that the alert is put back in the queue and the launch is tried again later,
+// with the delay decided by the rate limiter of the queue. The failed attempts are counted using
+// the given key, and when the number of retries given in the configuration of the server is
+// exhausted the error of the last attempt is returned. Other errors aren't retried, as the server
+// may have already created the job.
+//
+func (r *Runner) launchWithRetries(server *awxServer, key string, template string,
+	launch func() (int, error)) (int, error) {
+	job, err := launch()
+	if err == nil || !unreachedError(err) {
+		r.launchAttempts.Delete(key)
+		return job, err
+	}
+	attempt := 1
+	value, ok := r.launchAttempts.Load(key)
+	if ok {
+		attempt = value.(int) + 1
+	}
+	retries := server.config.MaxRetries()
+	if attempt > retries {
+		r.launchAttempts.Delete(key)
+		return 0, err
+	}
+	r.launchAttempts.Store(key, attempt)
+	logging.Warningf(
+		"Launch of job from template '%s' failed, will retry it, %d retries left: %s",
+		template,
+		retries-attempt,
+		err,
+	)
+	return 0, &runner.RetryableError{
+		Reason: fmt.Sprintf(
+			"Can't send the request to launch job from template '%s': %s",
+			template,
+			err,
+		),
+	}
+}
+
+// launchKey calculates the key used to count the failed attempts to launch a job from the given
+// template for the given rule and alert.
+//
+func launchKey(rule string, template string, alert string) string {
+	return fmt.Sprintf("%s\x00%s\x00%s", rule, template, alert)
+}
+
+// unreachedError checks if the given error returned by the AWX client means that the request never
+// reached the server, because the name of the server couldn't be resolved or because the
+// connection couldn't be established. Those requests can be safely sent again, as the server
+// didn't create any job.
+//
+func unreachedError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isTransientError checks if the given error returned by the AWX client may disappear if the
+// request is sent again. Errors without an HTTP status code, like network errors, and the 5xx
+// status codes are considered transient. The rest of the status codes, for example 404, indicate
+// problems that retrying won't fix.
+//
+func isTransientError(err error) bool {
+	match := statusCodeRE.FindStringSubmatch(err.Error())
+	if match == nil {
+		return true
+	}
+	code, _ := strconv.Atoi(match[1])
+	return code >= 500
+}
@@ -0,0 +1,265 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+func TestLaunchRetriedWhenServerIsUnreachable(t *testing.T) {
+	address := unreachableAddress()
+	awxRunner := makeUnreachableRunner(t, address, 2, 5)
+	rule := makeRule("start-node", "Start node")
+
+	// The first attempts should ask to retry later:
+	for i := 1; i <= 2; i++ {
+		err := awxRunner.RunAction(rule, rule.AWXJob, &alertmanager.Alert{})
+		if !runner.IsRetryable(err) {
+			t.Fatalf("Expected attempt %d to be retryable, but got '%v'", i, err)
+		}
+	}
+
+	// When the retries are exhausted the error should be returned as is:
+	err := awxRunner.RunAction(rule, rule.AWXJob, &alertmanager.Alert{})
+	if err == nil || runner.IsRetryable(err) {
+		t.Fatalf("Expected a non retryable error when all the retries fail, but got '%v'", err)
+	}
+
+	// And the count should start again for the next alert:
+	err = awxRunner.RunAction(rule, rule.AWXJob, &alertmanager.Alert{})
+	if !runner.IsRetryable(err) {
+		t.Fatalf("Expected the count of attempts to be reset, but got '%v'", err)
+	}
+}
+
+func TestLaunchNotRetriedWithoutRetries(t *testing.T) {
+	address := unreachableAddress()
+	awxRunner := makeUnreachableRunner(t, address, 0, 5)
+	rule := makeRule("start-node", "Start node")
+
+	err := awxRunner.RunAction(rule, rule.AWXJob, &alertmanager.Alert{})
+	if err == nil || runner.IsRetryable(err) {
+		t.Fatalf("Expected a non retryable error, but got '%v'", err)
+	}
+}
+
+func TestLaunchAttemptsAreCountedPerAlert(t *testing.T) {
+	address := unreachableAddress()
+	awxRunner := makeUnreachableRunner(t, address, 1, 5)
+	rule := makeRule("start-node", "Start node")
+	first := &alertmanager.Alert{Labels: map[string]string{"instance": "node0"}}
+	second := &alertmanager.Alert{Labels: map[string]string{"instance": "node1"}}
+
+	err := awxRunner.RunAction(rule, rule.AWXJob, first)
+	if !runner.IsRetryable(err) {
+		t.Fatalf("Expected the first alert to be retryable, but got '%v'", err)
+	}
+	err = awxRunner.RunAction(rule, rule.AWXJob, second)
+	if !runner.IsRetryable(err) {
+		t.Fatalf("Expected the second alert to be retryable, but got '%v'", err)
+	}
+}
+
+func TestLaunchAttemptsAreResetAfterSuccess(t *testing.T) {
+	awxRunner := makeUnreachableRunner(t, unreachableAddress(), 1, 5)
+	server, err := awxRunner.server("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := func() (int, error) {
+		return 0, &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}
+	}
+	reachable := func() (int, error) {
+		return 7, nil
+	}
+
+	_, err = awxRunner.launchWithRetries(server, "my-key", "Start node", unreachable)
+	if !runner.IsRetryable(err) {
+		t.Fatalf("Expected the first attempt to be retryable, but got '%v'", err)
+	}
+	job, err := awxRunner.launchWithRetries(server, "my-key", "Start node", reachable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job != 7 {
+		t.Errorf("Expected job 7, but got %d", job)
+	}
+	_, err = awxRunner.launchWithRetries(server, "my-key", "Start node", unreachable)
+	if !runner.IsRetryable(err) {
+		t.Fatalf("Expected the count of attempts to be reset, but got '%v'", err)
+	}
+}
+
+func TestLaunchNotRetriedAfterServerError(t *testing.T) {
+	server, launches := makeFailingLaunchServer(http.StatusServiceUnavailable)
+	defer server.Close()
+	awxRunner := makeRetryRunner(t, server.URL+"/api", 3)
+	rule := makeRule("start-node", "Start node")
+
+	err := awxRunner.RunAction(rule, rule.AWXJob, &alertmanager.Alert{})
+	if err == nil || runner.IsRetryable(err) {
+		t.Fatalf("Expected a non retryable error for a request that reached the server, but got '%v'", err)
+	}
+	if atomic.LoadInt32(launches) != 1 {
+		t.Errorf("Expected one launch attempt, but got %d", *launches)
+	}
+}
+
+func TestLaunchNotRetriedAfterClientError(t *testing.T) {
+	server, launches := makeFailingLaunchServer(http.StatusBadRequest)
+	defer server.Close()
+	awxRunner := makeRetryRunner(t, server.URL+"/api", 3)
+	rule := makeRule("start-node", "Start node")
+
+	err := awxRunner.RunAction(rule, rule.AWXJob, &alertmanager.Alert{})
+	if err == nil || runner.IsRetryable(err) {
+		t.Fatalf("Expected a non retryable error for a request rejected by the server, but got '%v'", err)
+	}
+	if atomic.LoadInt32(launches) != 1 {
+		t.Errorf("Expected one launch attempt, but got %d", *launches)
+	}
+}
+
+func TestLaunchRetriesStopWhenCircuitOpens(t *testing.T) {
+	awxRunner := makeUnreachableRunner(t, unreachableAddress(), 5, 2)
+	rule := makeRule("start-node", "Start node")
+
+	for i := 1; i <= 2; i++ {
+		err := awxRunner.RunAction(rule, rule.AWXJob, &alertmanager.Alert{})
+		if !runner.IsRetryable(err) || err == ErrCircuitOpen {
+			t.Fatalf("Expected attempt %d to be retried, but got '%v'", i, err)
+		}
+	}
+	err := awxRunner.RunAction(rule, rule.AWXJob, &alertmanager.Alert{})
+	if err != ErrCircuitOpen {
+		t.Fatalf("Expected the retries to stop with an open circuit, but got '%v'", err)
+	}
+}
+
+func TestUnreachedError(t *testing.T) {
+	tests := []struct {
+		err       error
+		unreached bool
+	}{
+		{&net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}, true},
+		{&net.DNSError{Name: "tower.example.com", Err: "no such host"}, true},
+		{&net.OpError{Op: "read", Err: fmt.Errorf("connection reset by peer")}, false},
+		{fmt.Errorf("Status code '503' returned from server: 'Unavailable'"), false},
+		{fmt.Errorf("Status code '400' returned from server: 'Bad request'"), false},
+	}
+	for _, test := range tests {
+		if unreachedError(test.err) != test.unreached {
+			t.Errorf("Expected unreached to be %v for error '%s'", test.unreached, test.err)
+		}
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{fmt.Errorf("dial tcp: connection refused"), true},
+		{fmt.Errorf("Status code '503' returned from server: 'Unavailable'"), true},
+		{fmt.Errorf("Status code '502' returned from server: 'Bad gateway'"), true},
+		{fmt.Errorf("Status code '400' returned from server: 'Bad request'"), false},
+		{fmt.Errorf("Status code '404' returned from server: 'Not found'"), false},
+	}
+	for _, test := range tests {
+		if isTransientError(test.err) != test.transient {
+			t.Errorf("Expected transient to be %v for error '%s'", test.transient, test.err)
+		}
+	}
+}
+
+// makeFailingLaunchServer starts a fake AWX server that knows the "Start node" template, and that
+// responds to the requests to launch it with the given status codes, in order, and then with
+// success. It returns the server and a counter of the launch requests.
+//
+func makeFailingLaunchServer(failures ...int) (*httptest.Server, *int32) {
+	launches := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/authtoken/":
+			w.Write([]byte(`{"token": "mytoken"}`))
+		case "/api/v2/job_templates/":
+			w.Write([]byte(`{"count": 1, "results": [{"id": 1, "name": "Start node"}]}`))
+		case "/api/v2/job_templates/1/launch/":
+			attempt := int(atomic.AddInt32(launches, 1))
+			if attempt <= len(failures) {
+				w.WriteHeader(failures[attempt-1])
+				w.Write([]byte(`{"detail": "Failed"}`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"job": 7}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server, launches
+}
+
+// unreachableAddress returns the address of an AWX server that refuses connections, because it
+// has already been stopped.
+//
+func unreachableAddress() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL + "/api"
+}
+
+// makeUnreachableRunner creates a runner for the AWX server with the given address, with the
+// "Start node" template already in the cache, so that the only request sent to the server is the
+// one used to launch the job.
+//
+func makeUnreachableRunner(t *testing.T, address string, retries int, threshold int) *Runner {
+	awxRunner := makeRunnerWithConfig(t, fmt.Sprintf(`
+awx:
+  address: %s
+  project: "My project"
+  token: "mytoken"
+  maxRetries: %d
+  failureThreshold: %d
+  resetTimeout: 1m
+`, address, retries, threshold))
+	awxRunner.templates.put("", "My project", "Start node", []*Template{{
+		Id:   1,
+		Name: "Start node",
+	}})
+	return awxRunner
+}
+
+func makeRetryRunner(t *testing.T, address string, retries int) *Runner {
+	return makeRunnerWithConfig(t, fmt.Sprintf(`
+awx:
+  address: %s
+  project: "My project"
+  credentials:
+    username: "myuser"
+    password: "mypassword"
+  maxRetries: %d
+`, address, retries))
+}
@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to select the AWX server where the jobs of an action are
+// launched.
+
+package awxrunner
+
+import (
+	"fmt"
+
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+// awxServer contains the configuration of one of the AWX servers that the runner uses, and the pool
+// of connections to it. The default server has an empty name.
+//
+type awxServer struct {
+	name        string
+	config      *config.AWXConfig
+	connections *connectionPool
+}
+
+// server returns the AWX server with the given name, or the default server if the name is empty.
+// The pools of connections to the named servers are created the first time that they are needed,
+// and created again when the configuration of the server changes.
+//
+func (r *Runner) server(name string) (*awxServer, error) {
+	if name == "" {
+		return &awxServer{
+			config:      r.config,
+			connections: r.connections,
+		}, nil
+	}
+	var serverConfig *config.AWXConfig
+	if r.servers != nil {
+		serverConfig = r.servers.Server(name)
+	}
+	if serverConfig == nil {
+		return nil, fmt.Errorf("AWX server '%s' isn't configured", name)
+	}
+	r.serverPoolsMutex.Lock()
+	defer r.serverPoolsMutex.Unlock()
+	pool, ok := r.serverPools[name]
+	if !ok || pool.config != serverConfig {
+		if ok {
+			pool.drain()
+		}
+		pool = newConnectionPool(name, serverConfig, r.connectionFactory, r.poolSize)
+		r.serverPools[name] = pool
+	}
+	return &awxServer{
+		name:        name,
+		config:      serverConfig,
+		connections: pool,
+	}, nil
+}
+
+// allPools returns all the connection pools of the runner, including the pool of the default
+// server.
+//
+func (r *Runner) allPools() []*connectionPool {
+	r.serverPoolsMutex.Lock()
+	defer r.serverPoolsMutex.Unlock()
+	pools := []*connectionPool{r.connections}
+	for _, pool := range r.serverPools {
+		pools = append(pools, pool)
+	}
+	return pools
+}
+
+// newConnection returns a connection to the server, reusing an idle one from the pool if possible,
+// or else creating a new one. The caller is responsible for releasing it with the releaseConnection
+// method.
+//
+func (s *awxServer) newConnection() (Connection, error) {
+	address, err := s.address()
+	if err != nil {
+		return nil, err
+	}
+	return s.connections.get(address)
+}
+
+// releaseConnection returns to the pool a connection obtained with the newConnection method. The
+// error is the result of the last request sent with the connection, and it is used to decide if the
+// connection can be reused.
+//
+func (s *awxServer) releaseConnection(connection Connection, err error) {
+	s.connections.put(connection, err)
+}
+
+// address returns the address of the server from the configuration, replacing the references to
+// environment variables with their values. This is done every time that a connection is created,
+// instead of when the configuration is loaded, so that changes to the environment are used without
+// reloading the configuration.
+//
+func (s *awxServer) address() (string, error) {
+	return expandEnv(s.config.Address())
+}
@@ -0,0 +1,149 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestJobLaunchedInReferencedServer(t *testing.T) {
+	defaultServer, defaultGets := makeLaunchServer()
+	defer defaultServer.Close()
+	teamServer, teamGets := makeLaunchServer()
+	defer teamServer.Close()
+	runner := makeServersRunner(t, defaultServer.URL+"/api", teamServer.URL+"/api")
+
+	rule := makeRule("my-rule", "Start node")
+	rule.AWXJob.ServerRef = "team-a"
+	err := runner.RunAction(rule, rule.AWXJob.DeepCopy(), makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(teamGets) != 1 {
+		t.Errorf("Expected the template to be retrieved from the referenced server, but it wasn't")
+	}
+	if atomic.LoadInt32(defaultGets) != 0 {
+		t.Errorf("Expected the default server not to be used, but it was used %d times", *defaultGets)
+	}
+	if !hasServerJob(runner, "team-a", 123) {
+		t.Errorf("Expected job 123 of server 'team-a' to be active")
+	}
+}
+
+func TestWorkflowJobLaunchedInReferencedServer(t *testing.T) {
+	defaultServer, defaultGets := makeLaunchServer()
+	defer defaultServer.Close()
+	teamServer, teamGets := makeLaunchServer()
+	defer teamServer.Close()
+	runner := makeServersRunner(t, defaultServer.URL+"/api", teamServer.URL+"/api")
+
+	action := &autoheal.AWXWorkflowAction{
+		Template:  "Heal cluster",
+		ServerRef: "team-a",
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "heal-cluster",
+		},
+		WorkflowJob: action,
+	}
+	err := runner.RunAction(rule, action.DeepCopy(), makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(teamGets) != 1 {
+		t.Errorf("Expected the workflow template to be retrieved from the referenced server, but it wasn't")
+	}
+	if atomic.LoadInt32(defaultGets) != 0 {
+		t.Errorf("Expected the default server not to be used, but it was used %d times", *defaultGets)
+	}
+	_, ok := runner.activeJobs.Load(activeJobKey{server: "team-a", kind: workflowJob, id: 456})
+	if !ok {
+		t.Errorf("Expected workflow job 456 of server 'team-a' to be active")
+	}
+	if hasServerJob(runner, "team-a", 456) {
+		t.Errorf("Expected workflow job 456 not to be tracked as a regular job")
+	}
+}
+
+func TestJobsOfDifferentServersDontCollide(t *testing.T) {
+	defaultServer, _ := makeLaunchServer()
+	defer defaultServer.Close()
+	teamServer, _ := makeLaunchServer()
+	defer teamServer.Close()
+	runner := makeServersRunner(t, defaultServer.URL+"/api", teamServer.URL+"/api")
+
+	// Both servers return the same job identifier:
+	runTemplate(t, runner, "Start node")
+	rule := makeRule("my-rule", "Start node")
+	rule.AWXJob.ServerRef = "team-a"
+	err := runner.RunAction(rule, rule.AWXJob.DeepCopy(), makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasServerJob(runner, "", 123) || !hasServerJob(runner, "team-a", 123) {
+		t.Errorf("Expected job 123 to be active in both servers")
+	}
+	if atomic.LoadInt64(&runner.activeJobsCount) != 2 {
+		t.Errorf("Expected two active jobs, but got %d", runner.activeJobsCount)
+	}
+}
+
+func TestUnknownServerIsRejected(t *testing.T) {
+	defaultServer, defaultGets := makeLaunchServer()
+	defer defaultServer.Close()
+	runner := makeRunner(t, defaultServer.URL+"/api")
+
+	rule := makeRule("my-rule", "Start node")
+	rule.AWXJob.ServerRef = "junk"
+	err := runner.RunAction(rule, rule.AWXJob.DeepCopy(), makeAlert())
+	if err == nil {
+		t.Fatal("Expected an error for a server that isn't configured")
+	}
+	if atomic.LoadInt32(defaultGets) != 0 {
+		t.Errorf("Expected the default server not to be used, but it was used %d times", *defaultGets)
+	}
+}
+
+func makeServersRunner(t *testing.T, defaultAddress, teamAddress string) *Runner {
+	return makeRunnerWithConfig(t, fmt.Sprintf(`
+awx:
+  address: %s
+  project: "My project"
+  credentials:
+    username: "myuser"
+    password: "mypassword"
+
+servers:
+  team-a:
+    address: %s
+`, defaultAddress, teamAddress))
+}
+
+func hasServerJob(runner *Runner, server string, id int) bool {
+	_, ok := runner.activeJobs.Load(activeJobKey{server: server, id: id})
+	return ok
+}
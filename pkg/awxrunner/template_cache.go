@@ -0,0 +1,146 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openshift/autoheal/pkg/logging"
+)
+
+// templateCache remembers the job templates retrieved from the AWX server, so that they don't need
+// to be retrieved again every time that an alert fires.
+//
+type templateCache struct {
+	ttl     time.Duration
+	entries map[string]*templateCacheEntry
+	mutex   *sync.Mutex
+}
+
+// templateCacheEntry contains the job templates that were retrieved for a server, project and
+// template name, and the time when they were retrieved.
+//
+type templateCacheEntry struct {
+	templates []*Template
+	stamp     time.Time
+}
+
+// newTemplateCache creates a cache whose entries expire after the given time. A zero time disables
+// the cache.
+//
+func newTemplateCache(ttl time.Duration) *templateCache {
+	return &templateCache{
+		ttl:     ttl,
+		entries: make(map[string]*templateCacheEntry),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// templateCacheKey calculates the key used to store the templates of a project in the cache. The
+// name of the server is part of the key, as different servers may have projects with the same
+// name.
+//
+func templateCacheKey(server, project, template string) string {
+	return server + ":" + project + ":" + template
+}
+
+// get returns the templates stored for the given server, project and template name, if they
+// haven't expired yet.
+//
+func (c *templateCache) get(server, project, template string) (templates []*Template, ok bool) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := templateCacheKey(server, project, template)
+	entry, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	if time.Since(entry.stamp) > c.ttl {
+		delete(c.entries, key)
+		ok = false
+		return
+	}
+	templates = entry.templates
+	return
+}
+
+// put stores the templates retrieved for the given server, project and template name.
+//
+func (c *templateCache) put(server, project, template string, templates []*Template) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[templateCacheKey(server, project, template)] = &templateCacheEntry{
+		templates: templates,
+		stamp:     time.Now(),
+	}
+}
+
+// clear removes all the entries from the cache.
+//
+func (c *templateCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[string]*templateCacheEntry)
+}
+
+// InvalidateTemplateCache removes all the job templates that the runner has cached. It should be
+// called when the configuration is reloaded, as the project or the names of the templates may have
+// changed.
+//
+func (r *Runner) InvalidateTemplateCache() {
+	r.templates.clear()
+	logging.Infof("AWX job templates cache has been cleared")
+}
+
+// findTemplates returns the job templates with the given name from the given project of the given
+// server, using the cache if possible. Results that don't contain any template aren't cached, so
+// that templates created later will be found.
+//
+func (r *Runner) findTemplates(
+	server *awxServer,
+	connection Connection,
+	project string,
+	template string,
+) (templates []*Template, err error) {
+	templates, ok := r.templates.get(server.name, project, template)
+	if ok {
+		logging.V(2).Infof("Using cached AWX job template '%s' from project '%s'", template, project)
+		return
+	}
+	templates, err = connection.FindTemplates(project, template)
+	if err != nil {
+		return
+	}
+	if len(templates) == 0 {
+		err = fmt.Errorf(
+			"Template '%s' not found in project '%s'",
+			template,
+			project,
+		)
+		return
+	}
+	r.templates.put(server.name, project, template, templates)
+	return
+}
@@ -0,0 +1,138 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+)
+
+func TestTemplateRetrievedOnlyOnce(t *testing.T) {
+	server, gets := makeLaunchServer()
+	defer server.Close()
+	runner := makeRunner(t, server.URL+"/api")
+
+	runTemplate(t, runner, "Start node")
+	runTemplate(t, runner, "Start node")
+	runTemplate(t, runner, "Start node")
+
+	if atomic.LoadInt32(gets) != 1 {
+		t.Errorf("Expected the template to be retrieved once, but it was retrieved %d times", *gets)
+	}
+}
+
+func TestTemplateRetrievedAfterInvalidation(t *testing.T) {
+	server, gets := makeLaunchServer()
+	defer server.Close()
+	runner := makeRunner(t, server.URL+"/api")
+
+	runTemplate(t, runner, "Start node")
+	runner.InvalidateTemplateCache()
+	runTemplate(t, runner, "Start node")
+
+	if atomic.LoadInt32(gets) != 2 {
+		t.Errorf("Expected the template to be retrieved twice, but it was retrieved %d times", *gets)
+	}
+}
+
+func TestTemplateCacheExpires(t *testing.T) {
+	cache := newTemplateCache(time.Millisecond)
+	cache.put("", "My project", "Start node", nil)
+	if _, ok := cache.get("", "My project", "Start node"); !ok {
+		t.Errorf("Expected the entry to be found right after adding it")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := cache.get("", "My project", "Start node"); ok {
+		t.Errorf("Expected the entry to expire")
+	}
+}
+
+func TestTemplateCacheDisabled(t *testing.T) {
+	cache := newTemplateCache(0)
+	cache.put("", "My project", "Start node", nil)
+	if _, ok := cache.get("", "My project", "Start node"); ok {
+		t.Errorf("Expected no entry when the cache is disabled")
+	}
+}
+
+func TestMissingTemplateNotCached(t *testing.T) {
+	server, gets := makeLaunchServer()
+	defer server.Close()
+	runner := makeRunner(t, server.URL+"/api")
+
+	for i := 0; i < 2; i++ {
+		err := runner.RunAction(makeRule("my-rule", "Missing"), makeRule("", "Missing").AWXJob, makeAlert())
+		if err == nil {
+			t.Errorf("Expected an error for a missing template")
+		}
+	}
+
+	if atomic.LoadInt32(gets) != 2 {
+		t.Errorf("Expected the missing template to be retrieved twice, but it was retrieved %d times", *gets)
+	}
+}
+
+// makeLaunchServer starts a fake AWX server that knows the "Start node" template and accepts
+// requests to launch it. It returns the server and a counter of the requests to get templates.
+//
+func makeLaunchServer() (*httptest.Server, *int32) {
+	gets := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/authtoken/":
+			w.Write([]byte(`{"token": "mytoken"}`))
+		case "/api/v2/job_templates/":
+			atomic.AddInt32(gets, 1)
+			if r.URL.Query().Get("name") == "Start node" {
+				w.Write([]byte(`{"count": 1, "results": [{"id": 1, "name": "Start node"}]}`))
+			} else {
+				w.Write([]byte(`{"count": 0, "results": []}`))
+			}
+		case "/api/v2/job_templates/1/launch/":
+			w.Write([]byte(`{"job": 123}`))
+		case "/api/v2/workflow_job_templates/":
+			atomic.AddInt32(gets, 1)
+			w.Write([]byte(`{"count": 1, "results": [{"id": 7, "name": "Heal cluster"}]}`))
+		case "/api/v2/workflow_job_templates/7/launch/":
+			w.Write([]byte(`{"workflow_job": 456}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server, gets
+}
+
+func runTemplate(t *testing.T, runner *Runner, template string) {
+	rule := makeRule("my-rule", template)
+	err := runner.RunAction(rule, rule.AWXJob.DeepCopy(), makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func makeAlert() *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to combine the extra variables of the actions with the
+// global extra variables.
+
+package awxrunner
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// extraVars calculates the extra variables that should be passed to the job launched for the given
+// action, combining the extra variables of the action with the global ones according to the merge
+// strategy of the action. The result is always a new map, so it can be safely modified.
+//
+func (s *awxServer) extraVars(action *autoheal.AWXJobAction) (result map[string]interface{}, err error) {
+	global, err := json.Marshal(s.config.ExtraVars())
+	if err != nil {
+		return
+	}
+	local, err := json.Marshal(action.ExtraVars)
+	if err != nil {
+		return
+	}
+	var merged string
+	switch action.ExtraVarsMergeStrategy {
+	case "", autoheal.ExtraVarsMergeStrategyReplace:
+		if action.ExtraVars != nil {
+			merged = string(local)
+		} else {
+			merged = string(global)
+		}
+	case autoheal.ExtraVarsMergeStrategyAppend:
+		merged, err = mergeExtraVarsJSON(string(global), string(local))
+		if err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf(
+			"Unknown extra variables merge strategy '%s', valid values are '%s' and '%s'",
+			action.ExtraVarsMergeStrategy,
+			autoheal.ExtraVarsMergeStrategyReplace,
+			autoheal.ExtraVarsMergeStrategyAppend,
+		)
+		return
+	}
+	err = json.Unmarshal([]byte(merged), &result)
+	return
+}
+
+// mergeExtraVarsJSON parses the given JSON objects and merges them. When both objects contain the
+// same key the value from b takes precedence, except when both values are objects, as then they
+// are merged recursively using the same rules. Arrays aren't merged, the array from b replaces the
+// array from a. Empty strings and null are considered empty objects.
+//
+func mergeExtraVarsJSON(a, b string) (string, error) {
+	aVars, err := parseExtraVarsJSON(a)
+	if err != nil {
+		return "", err
+	}
+	bVars, err := parseExtraVarsJSON(b)
+	if err != nil {
+		return "", err
+	}
+	result, err := json.Marshal(mergeExtraVars(aVars, bVars))
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+func parseExtraVarsJSON(text string) (vars map[string]interface{}, err error) {
+	if text == "" {
+		vars = make(map[string]interface{})
+		return
+	}
+	err = json.Unmarshal([]byte(text), &vars)
+	if err != nil {
+		err = fmt.Errorf("Can't parse extra variables '%s': %s", text, err)
+		return
+	}
+	if vars == nil {
+		vars = make(map[string]interface{})
+	}
+	return
+}
+
+// mergeExtraVars merges the given maps, returning a new map. Values from b take precedence, except
+// when both values are maps, which are merged recursively.
+//
+func mergeExtraVars(a, b map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(a)+len(b))
+	for key, value := range a {
+		result[key] = value
+	}
+	for key, bValue := range b {
+		aMap, aIsMap := result[key].(map[string]interface{})
+		bMap, bIsMap := bValue.(map[string]interface{})
+		if aIsMap && bIsMap {
+			result[key] = mergeExtraVars(aMap, bMap)
+		} else {
+			result[key] = bValue
+		}
+	}
+	return result
+}
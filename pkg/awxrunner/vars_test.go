@@ -0,0 +1,182 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awxrunner
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergeExtraVarsJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "Both empty",
+			a:        "",
+			b:        "",
+			expected: `{}`,
+		},
+		{
+			name:     "Both null",
+			a:        "null",
+			b:        "null",
+			expected: `{}`,
+		},
+		{
+			name:     "Only a",
+			a:        `{"x": 1}`,
+			b:        "",
+			expected: `{"x": 1}`,
+		},
+		{
+			name:     "Only b",
+			a:        "",
+			b:        `{"y": 2}`,
+			expected: `{"y": 2}`,
+		},
+		{
+			name:     "Disjoint keys",
+			a:        `{"x": 1}`,
+			b:        `{"y": 2}`,
+			expected: `{"x": 1, "y": 2}`,
+		},
+		{
+			name:     "Conflicting scalars",
+			a:        `{"x": 1, "y": "a"}`,
+			b:        `{"x": 2}`,
+			expected: `{"x": 2, "y": "a"}`,
+		},
+		{
+			name:     "Scalar replaced by null",
+			a:        `{"x": 1}`,
+			b:        `{"x": null}`,
+			expected: `{"x": null}`,
+		},
+		{
+			name:     "Nested objects are merged",
+			a:        `{"node": {"name": "node0", "cpus": 2}}`,
+			b:        `{"node": {"cpus": 4, "memory": "8G"}}`,
+			expected: `{"node": {"name": "node0", "cpus": 4, "memory": "8G"}}`,
+		},
+		{
+			name:     "Deeply nested objects are merged",
+			a:        `{"a": {"b": {"c": 1, "d": 2}}}`,
+			b:        `{"a": {"b": {"d": 3}}}`,
+			expected: `{"a": {"b": {"c": 1, "d": 3}}}`,
+		},
+		{
+			name:     "Object replaced by scalar",
+			a:        `{"x": {"y": 1}}`,
+			b:        `{"x": "z"}`,
+			expected: `{"x": "z"}`,
+		},
+		{
+			name:     "Scalar replaced by object",
+			a:        `{"x": "z"}`,
+			b:        `{"x": {"y": 1}}`,
+			expected: `{"x": {"y": 1}}`,
+		},
+		{
+			name:     "Arrays are replaced",
+			a:        `{"hosts": ["a", "b"]}`,
+			b:        `{"hosts": ["c"]}`,
+			expected: `{"hosts": ["c"]}`,
+		},
+		{
+			name:     "Array replaced by object",
+			a:        `{"x": [1, 2]}`,
+			b:        `{"x": {"y": 1}}`,
+			expected: `{"x": {"y": 1}}`,
+		},
+		{
+			name:     "Arrays inside nested objects are replaced",
+			a:        `{"x": {"hosts": ["a"], "port": 22}}`,
+			b:        `{"x": {"hosts": ["b", "c"]}}`,
+			expected: `{"x": {"hosts": ["b", "c"], "port": 22}}`,
+		},
+	}
+	for _, test := range tests {
+		actual, err := mergeExtraVarsJSON(test.a, test.b)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		var actualVars, expectedVars interface{}
+		json.Unmarshal([]byte(actual), &actualVars)
+		json.Unmarshal([]byte(test.expected), &expectedVars)
+		if !reflect.DeepEqual(actualVars, expectedVars) {
+			t.Errorf("%s: expected '%s' but got '%s'", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestMergeExtraVarsJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+	}{
+		{
+			name: "Invalid a",
+			a:    `{"x": `,
+			b:    `{}`,
+		},
+		{
+			name: "Invalid b",
+			a:    `{}`,
+			b:    `{"x": `,
+		},
+		{
+			name: "Array instead of object",
+			a:    `[1, 2]`,
+			b:    `{}`,
+		},
+		{
+			name: "Scalar instead of object",
+			a:    `{}`,
+			b:    `"x"`,
+		},
+	}
+	for _, test := range tests {
+		_, err := mergeExtraVarsJSON(test.a, test.b)
+		if err == nil {
+			t.Errorf("%s: expected an error but got nil", test.name)
+		}
+	}
+}
+
+func TestMergeExtraVarsDoesNotModifyInputs(t *testing.T) {
+	a := map[string]interface{}{
+		"x": map[string]interface{}{
+			"y": 1,
+		},
+	}
+	b := map[string]interface{}{
+		"x": map[string]interface{}{
+			"z": 2,
+		},
+	}
+	mergeExtraVars(a, b)
+	if len(a["x"].(map[string]interface{})) != 1 || len(b["x"].(map[string]interface{})) != 1 {
+		t.Errorf("Expected the inputs to not be modified, but got %v and %v", a, b)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the worker that checks the status of the batch jobs created by the runner.
+
+package batchrunner
+
+import (
+	"fmt"
+	"time"
+
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/logging"
+	"github.com/openshift/autoheal/pkg/metrics"
+)
+
+// Final statuses of the batch jobs, as reported in the log and in the metrics.
+//
+const (
+	jobStatusSucceeded = "succeeded"
+	jobStatusFailed    = "failed"
+)
+
+// activeJob contains the information about a job that has been created and hasn't finished yet.
+//
+type activeJob struct {
+	namespace string
+	name      string
+
+	// The rule that created the job.
+	rule *autoheal.HealingRule
+
+	// Indicates if the final status of the job has already been reported, and how many times saving
+	// its output has failed. Jobs whose output can't be saved are kept till it is saved or the
+	// maximum number of attempts is reached.
+	completed      bool
+	outputAttempts int
+}
+
+// jobKey calculates the key used to store a job in the map of active jobs.
+//
+func jobKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// runActiveJobsWorker checks the status of the active jobs, and removes the ones that have
+// finished.
+//
+func (r *Runner) runActiveJobsWorker() {
+	r.activeJobs.Range(func(key, value interface{}) bool {
+		job := value.(*activeJob)
+		finished, err := r.checkJob(job)
+		if err != nil {
+			runtime.HandleError(err)
+		}
+		if finished {
+			r.activeJobs.Delete(key)
+		}
+		return true
+	})
+}
+
+// WaitForActiveJobs waits till all the active jobs have finished, checking their status with the
+// configured interval. It is intended to be called when the server is stopped, after the worker has
+// been stopped, so that the results of the jobs that are still running are reported. It returns an
+// error if there are still active jobs when the timeout expires.
+//
+func (r *Runner) WaitForActiveJobs(timeout time.Duration) error {
+	interval := r.jobStatusCheckInterval
+	deadline := time.Now().Add(timeout)
+	for {
+		count := r.countActiveJobs()
+		if count == 0 {
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("There are still %d active batch jobs after waiting %s", count, timeout)
+		}
+		logging.Infof("Waiting for %d active batch jobs to finish", count)
+		if interval > remaining {
+			interval = remaining
+		}
+		time.Sleep(interval)
+		r.runActiveJobsWorker()
+	}
+}
+
+// countActiveJobs returns the number of jobs that haven't finished yet.
+//
+func (r *Runner) countActiveJobs() int {
+	count := 0
+	r.activeJobs.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// checkJob checks if the given job has finished, and if it has reports its status and, if enabled,
+// saves its output. It returns true if the job doesn't need to be checked again. When the output
+// can't be saved the job is checked again, so that saving it is retried.
+//
+func (r *Runner) checkJob(job *activeJob) (finished bool, err error) {
+	object, err := r.k8sClient.Batch().Jobs(job.namespace).Get(job.name, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		logging.Warningf(
+			"Batch job '%s' from namespace '%s' doesn't exist any more, its status can't be checked",
+			job.name,
+			job.namespace,
+		)
+		finished = true
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	var status string
+	switch {
+	case jobHasCondition(object, batch.JobComplete):
+		status = jobStatusSucceeded
+	case jobHasCondition(object, batch.JobFailed):
+		status = jobStatusFailed
+	default:
+		return
+	}
+	finished = true
+	if !job.completed {
+		r.jobCompleted(job, status)
+		job.completed = true
+	}
+	if r.captureOutput {
+		err = r.saveOutput(job)
+		if err != nil {
+			job.outputAttempts++
+			if job.outputAttempts < maxOutputAttempts {
+				finished = false
+			}
+		}
+	}
+	return
+}
+
+// jobCompleted reports the final status of a job that has finished, and updates the metrics.
+//
+func (r *Runner) jobCompleted(job *activeJob, status string) {
+	if status == jobStatusSucceeded {
+		logging.Infof(
+			"Batch job '%s' from namespace '%s' created by rule '%s' finished with status '%s'",
+			job.name,
+			job.namespace,
+			job.rule.ObjectMeta.Name,
+			status,
+		)
+	} else {
+		logging.Warningf(
+			"Batch job '%s' from namespace '%s' created by rule '%s' finished with status '%s'",
+			job.name,
+			job.namespace,
+			job.rule.ObjectMeta.Name,
+			status,
+		)
+	}
+	metrics.BatchJobFinished(status)
+}
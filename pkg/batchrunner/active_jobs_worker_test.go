@@ -0,0 +1,155 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batchrunner
+
+import (
+	"testing"
+	"time"
+
+	batch "k8s.io/api/batch/v1"
+)
+
+func TestActiveJobTracked(t *testing.T) {
+	client := &fakeClient{jobs: newFakeJobs()}
+	runner := makeStatusRunner(t, client)
+	runJobWithRunner(t, runner)
+
+	value, ok := runner.activeJobs.Load(jobKey("default", "hello"))
+	if !ok {
+		t.Fatalf("Expected job 'hello' to be active")
+	}
+	job := value.(*activeJob)
+	if job.rule.ObjectMeta.Name != "say-hello" {
+		t.Errorf("Expected the job to be created by rule 'say-hello', but got '%s'", job.rule.ObjectMeta.Name)
+	}
+}
+
+func TestRunningJobKept(t *testing.T) {
+	client := &fakeClient{jobs: newFakeJobs()}
+	runner := makeStatusRunner(t, client)
+	runJobWithRunner(t, runner)
+
+	runner.runActiveJobsWorker()
+	if !hasActiveJob(runner, "hello") {
+		t.Errorf("Expected running job 'hello' to still be active")
+	}
+}
+
+func TestFinishedJobsRemoved(t *testing.T) {
+	conditions := []batch.JobConditionType{
+		batch.JobComplete,
+		batch.JobFailed,
+	}
+	for _, condition := range conditions {
+		t.Run(string(condition), func(t *testing.T) {
+			client := &fakeClient{jobs: newFakeJobs()}
+			runner := makeStatusRunner(t, client)
+			runJobWithRunner(t, runner)
+
+			client.jobs.items["hello"] = makeJob("hello", condition)
+			runner.runActiveJobsWorker()
+			if hasActiveJob(runner, "hello") {
+				t.Errorf("Expected finished job 'hello' to be removed")
+			}
+		})
+	}
+}
+
+func TestMissingJobRemoved(t *testing.T) {
+	client := &fakeClient{jobs: newFakeJobs()}
+	runner := makeStatusRunner(t, client)
+	runJobWithRunner(t, runner)
+
+	delete(client.jobs.items, "hello")
+	runner.runActiveJobsWorker()
+	if hasActiveJob(runner, "hello") {
+		t.Errorf("Expected job 'hello' that doesn't exist to be removed")
+	}
+}
+
+func TestWaitForActiveJobsWaitsTillJobFinishes(t *testing.T) {
+	client := &fakeClient{jobs: newFakeJobs()}
+	runner := makeStatusRunnerWithInterval(t, client, 10*time.Millisecond)
+	runJobWithRunner(t, runner)
+
+	// The job is reported as running twice, and then as complete:
+	client.jobs.completeAfter = 3
+	err := runner.WaitForActiveJobs(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Expected no error waiting for the job, but got: %s", err)
+	}
+	if client.jobs.gets != 3 {
+		t.Errorf("Expected the job to be checked 3 times, but it was checked %d times", client.jobs.gets)
+	}
+	if hasActiveJob(runner, "hello") {
+		t.Errorf("Expected finished job 'hello' to be removed")
+	}
+}
+
+func TestWaitForActiveJobsTimeout(t *testing.T) {
+	client := &fakeClient{jobs: newFakeJobs()}
+	runner := makeStatusRunnerWithInterval(t, client, 10*time.Millisecond)
+	runJobWithRunner(t, runner)
+
+	start := time.Now()
+	err := runner.WaitForActiveJobs(50 * time.Millisecond)
+	if err == nil {
+		t.Errorf("Expected an error when the job doesn't finish before the timeout")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected to wait at least the timeout, but waited %s", elapsed)
+	}
+	if !hasActiveJob(runner, "hello") {
+		t.Errorf("Expected running job 'hello' to still be active")
+	}
+}
+
+func TestWaitForActiveJobsWithoutJobs(t *testing.T) {
+	client := &fakeClient{jobs: newFakeJobs()}
+	runner := makeStatusRunner(t, client)
+
+	err := runner.WaitForActiveJobs(0)
+	if err != nil {
+		t.Errorf("Expected no error when there are no active jobs, but got: %s", err)
+	}
+}
+
+func makeStatusRunner(t *testing.T, client *fakeClient) *Runner {
+	runner, err := NewBuilder().
+		KubernetesClient(client).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func makeStatusRunnerWithInterval(t *testing.T, client *fakeClient, interval time.Duration) *Runner {
+	runner, err := NewBuilder().
+		KubernetesClient(client).
+		JobStatusCheckInterval(interval).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func hasActiveJob(runner *Runner, name string) bool {
+	_, ok := runner.activeJobs.Load(jobKey("default", name))
+	return ok
+}
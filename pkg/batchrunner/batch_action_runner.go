@@ -18,25 +18,50 @@ package batchrunner
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
-	"github.com/golang/glog"
 	alertmanager "github.com/openshift/autoheal/pkg/alertmanager"
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/config"
+	"github.com/openshift/autoheal/pkg/logging"
+	"github.com/openshift/autoheal/pkg/runner"
+	"golang.org/x/sync/syncmap"
 	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 )
 
 type Builder struct {
-	k8sClient kubernetes.Interface
+	k8sClient              kubernetes.Interface
+	captureOutput          bool
+	jobStatusCheckInterval time.Duration
+	runtime                *config.RuntimeConfig
+	stopCh                 <-chan struct{}
 }
 
 type Runner struct {
-	k8sClient kubernetes.Interface
+	k8sClient              kubernetes.Interface
+	captureOutput          bool
+	jobStatusCheckInterval time.Duration
+
+	// The runtime configuration, which contains the registry mirror used for the images of the
+	// jobs. It may be nil.
+	runtime *config.RuntimeConfig
+
+	// The jobs that have been created and haven't finished yet. The keys are the namespaces and
+	// names of the jobs, and the values are *activeJob.
+	activeJobs *syncmap.Map
 }
 
 func NewBuilder() *Builder {
-	return new(Builder)
+	b := new(Builder)
+	b.jobStatusCheckInterval = 10 * time.Second
+	return b
 }
 
 func (b *Builder) KubernetesClient(k8sClient kubernetes.Interface) *Builder {
@@ -44,17 +69,85 @@ func (b *Builder) KubernetesClient(k8sClient kubernetes.Interface) *Builder {
 	return b
 }
 
+// CaptureOutput sets whether the runner will save the output of the jobs that it creates in a
+// config map when they finish. The default is to not save it.
+//
+func (b *Builder) CaptureOutput(flag bool) *Builder {
+	b.captureOutput = flag
+	return b
+}
+
+// JobStatusCheckInterval sets how often the runner checks if the jobs that it created have finished.
+// The default is ten seconds.
+//
+func (b *Builder) JobStatusCheckInterval(interval time.Duration) *Builder {
+	b.jobStatusCheckInterval = interval
+	return b
+}
+
+// Runtime sets the runtime section of the configuration. When it contains an image mirror the
+// registries of the images of the jobs are replaced with it. It is optional, and the configuration
+// is read every time that a job is created, so changes are used without building a new runner.
+//
+func (b *Builder) Runtime(runtime *config.RuntimeConfig) *Builder {
+	b.runtime = runtime
+	return b
+}
+
+// StopCh sets the channel that will be used to stop the worker that checks the status of the jobs.
+// If it isn't set the worker will be started when the Start method is called.
+//
+func (b *Builder) StopCh(stopCh <-chan struct{}) *Builder {
+	b.stopCh = stopCh
+	return b
+}
+
 func (b *Builder) Build() (*Runner, error) {
+	// The Kubernetes client is mandatory:
+	if b.k8sClient == nil {
+		return nil, fmt.Errorf("The Kubernetes client is mandatory")
+	}
+	if b.jobStatusCheckInterval <= 0 {
+		return nil, fmt.Errorf(
+			"The job status check interval must be positive, but it is %s",
+			b.jobStatusCheckInterval,
+		)
+	}
+
 	runner := &Runner{
-		k8sClient: b.k8sClient,
+		k8sClient:              b.k8sClient,
+		captureOutput:          b.captureOutput,
+		jobStatusCheckInterval: b.jobStatusCheckInterval,
+		runtime:                b.runtime,
+		activeJobs:             new(syncmap.Map),
+	}
+
+	// Start the worker that checks the status of the jobs, if the stop channel was given, otherwise
+	// it will be started when the Start method is called:
+	if b.stopCh != nil {
+		runner.Start(b.stopCh)
 	}
+
 	return runner, nil
 }
 
+// Start starts the worker that periodically checks the status of the jobs created by the runner,
+// in order to report it and, if enabled, capture their output. It will run till the given stop
+// channel is closed.
+//
+func (r *Runner) Start(stopCh <-chan struct{}) {
+	go wait.Until(r.runActiveJobsWorker, r.jobStatusCheckInterval, stopCh)
+}
+
+// Make sure that the runner implements the action runner interface:
+var _ runner.ActionRunner = &Runner{}
+
+// RunAction creates the Kubernetes job described by the given *batch.Job.
+//
 func (r *Runner) RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error {
 	batchJob := action.(*batch.Job)
 
-	glog.Infof(
+	logging.Infof(
 		"Running batch job '%s' to heal alert '%s'",
 		batchJob.ObjectMeta.Name,
 		alert.Labels["alertname"],
@@ -75,16 +168,95 @@ func (r *Runner) RunAction(rule *autoheal.HealingRule, action interface{}, alert
 		namespace = rule.ObjectMeta.Namespace
 	}
 
+	// The name and the namespace may have been generated from the labels of the alert, so check
+	// that they are valid before sending them to the API server:
+	err := checkJobNames(rule, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	// Replace the images of the containers and avoid the node of the alert, if requested, in a
+	// copy of the job, so that the action isn't modified. The mirror is applied after the
+	// override, so that the replaced images also come from the mirror:
+	batchJob = batchJob.DeepCopy()
+	err = applyImageOverride(batchJob)
+	if err != nil {
+		return err
+	}
+	if r.runtime != nil {
+		applyImageMirror(batchJob, r.runtime.ImageMirror())
+	}
+	err = r.applyNodeAvoidance(batchJob, alert)
+	if err != nil {
+		return fmt.Errorf(
+			"Can't parse annotation '%s' of job '%s': %s",
+			AvoidAlertNodeAnnotation,
+			name,
+			err,
+		)
+	}
+
+	// In dry run mode write the job to the log instead of creating it:
+	dryRun, err := isDryRun(batchJob)
+	if err != nil {
+		return fmt.Errorf(
+			"Can't parse annotation '%s' of job '%s': %s",
+			DryRunAnnotation,
+			name,
+			err,
+		)
+	}
+	if dryRun {
+		batchJob.ObjectMeta.Namespace = namespace
+		return logDryRun(batchJob, alert.Labels["alertname"])
+	}
+
 	// Get the resource that manages the collection of batch jobs:
 	resource := r.k8sClient.Batch().Jobs(namespace)
 
+	// Check if there is already a job with the same name, and decide what to do according to its
+	// status:
+	existing, err := resource.Get(name, meta.GetOptions{})
+	if err == nil {
+		switch {
+		case jobHasCondition(existing, batch.JobComplete):
+			logging.Infof(
+				"Batch job '%s' has already completed successfully, will do nothing to heal alert '%s'",
+				name,
+				alert.Labels["alertname"],
+			)
+			return nil
+		case jobHasCondition(existing, batch.JobFailed):
+			logging.Infof(
+				"Batch job '%s' has failed, will delete it and create it again to heal alert '%s'",
+				name,
+				alert.Labels["alertname"],
+			)
+			propagation := meta.DeletePropagationBackground
+			err = resource.Delete(name, &meta.DeleteOptions{
+				PropagationPolicy: &propagation,
+			})
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		default:
+			logging.Infof(
+				"Batch job '%s' is still running, will do nothing to heal alert '%s'",
+				name,
+				alert.Labels["alertname"],
+			)
+			return nil
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
 	// Try to create the job:
-	batchJob = batchJob.DeepCopy()
 	batchJob.ObjectMeta.Name = name
 	batchJob.ObjectMeta.Namespace = namespace
-	_, err := resource.Create(batchJob)
+	_, err = resource.Create(batchJob)
 	if errors.IsAlreadyExists(err) {
-		glog.Warningf(
+		logging.Warningf(
 			"Batch job '%s' already exists, will do nothing to heal alert '%s'",
 			batchJob.ObjectMeta.Name,
 			alert.Labels["alertname"],
@@ -92,12 +264,56 @@ func (r *Runner) RunAction(rule *autoheal.HealingRule, action interface{}, alert
 	} else if err != nil {
 		return err
 	} else {
-		glog.Infof(
+		logging.Infof(
 			"Batch job '%s' to heal alert '%s' has been created",
 			batchJob.ObjectMeta.Name,
 			alert.Labels["alertname"],
 		)
+		r.activeJobs.Store(jobKey(namespace, name), &activeJob{
+			namespace: namespace,
+			name:      name,
+			rule:      rule,
+		})
 	}
 
 	return nil
 }
+
+// checkJobNames checks that the given namespace and name of a job follow the Kubernetes naming
+// rules: the name must be a DNS subdomain and the namespace a DNS label. An empty namespace isn't
+// checked, as it means that the default namespace of the client will be used.
+//
+func checkJobNames(rule *autoheal.HealingRule, namespace, name string) error {
+	problems := validation.IsDNS1123Subdomain(name)
+	if len(problems) > 0 {
+		return fmt.Errorf(
+			"Can't create job for rule '%s', the name '%s' isn't valid: %s",
+			rule.ObjectMeta.Name,
+			name,
+			strings.Join(problems, ", "),
+		)
+	}
+	if namespace != "" {
+		problems = validation.IsDNS1123Label(namespace)
+		if len(problems) > 0 {
+			return fmt.Errorf(
+				"Can't create job for rule '%s', the namespace '%s' isn't valid: %s",
+				rule.ObjectMeta.Name,
+				namespace,
+				strings.Join(problems, ", "),
+			)
+		}
+	}
+	return nil
+}
+
+// jobHasCondition checks if the given job has a condition of the given type with status true.
+//
+func jobHasCondition(job *batch.Job, conditionType batch.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == core.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batchrunner
+
+import (
+	"strings"
+	"testing"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	batchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestRunActionCreatesMissingJob(t *testing.T) {
+	jobs := newFakeJobs()
+	runJob(t, jobs)
+	if len(jobs.created) != 1 {
+		t.Errorf("Expected the job to be created, but it wasn't")
+	}
+	if len(jobs.deleted) != 0 {
+		t.Errorf("Expected no job to be deleted, but %d were", len(jobs.deleted))
+	}
+}
+
+func TestRunActionSkipsRunningJob(t *testing.T) {
+	jobs := newFakeJobs()
+	jobs.items["hello"] = makeJob("hello")
+	runJob(t, jobs)
+	if len(jobs.created) != 0 {
+		t.Errorf("Expected the running job to be kept, but it was created again")
+	}
+	if len(jobs.deleted) != 0 {
+		t.Errorf("Expected the running job to be kept, but it was deleted")
+	}
+}
+
+func TestRunActionSkipsCompletedJob(t *testing.T) {
+	jobs := newFakeJobs()
+	jobs.items["hello"] = makeJob("hello", batch.JobComplete)
+	runJob(t, jobs)
+	if len(jobs.created) != 0 {
+		t.Errorf("Expected the completed job to be kept, but it was created again")
+	}
+	if len(jobs.deleted) != 0 {
+		t.Errorf("Expected the completed job to be kept, but it was deleted")
+	}
+}
+
+func TestRunActionRecreatesFailedJob(t *testing.T) {
+	jobs := newFakeJobs()
+	jobs.items["hello"] = makeJob("hello", batch.JobFailed)
+	runJob(t, jobs)
+	if len(jobs.deleted) != 1 {
+		t.Errorf("Expected the failed job to be deleted, but it wasn't")
+	}
+	if len(jobs.created) != 1 {
+		t.Errorf("Expected the failed job to be created again, but it wasn't")
+	}
+}
+
+func TestRunActionRejectsInvalidName(t *testing.T) {
+	names := []string{
+		"heal-Node_1",
+		"heal-node-1-",
+		strings.Repeat("a", 254),
+	}
+	for _, name := range names {
+		jobs := newFakeJobs()
+		runner, err := NewBuilder().
+			KubernetesClient(&fakeClient{jobs: jobs}).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = runner.RunAction(makeRule(), makeJob(name), makeAlert())
+		if err == nil {
+			t.Errorf("Expected an error for job name '%s', but got nil", name)
+		}
+		if len(jobs.created) != 0 {
+			t.Errorf("Expected job '%s' not to be created", name)
+		}
+	}
+}
+
+func TestRunActionRejectsInvalidNamespace(t *testing.T) {
+	jobs := newFakeJobs()
+	runner, err := NewBuilder().
+		KubernetesClient(&fakeClient{jobs: jobs}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := makeJob("hello")
+	job.ObjectMeta.Namespace = "my.namespace"
+	err = runner.RunAction(makeRule(), job, makeAlert())
+	if err == nil {
+		t.Errorf("Expected an error for namespace 'my.namespace', but got nil")
+	}
+	if len(jobs.created) != 0 {
+		t.Errorf("Expected the job not to be created")
+	}
+}
+
+func runJob(t *testing.T, jobs *fakeJobs) {
+	runner, err := NewBuilder().
+		KubernetesClient(&fakeClient{jobs: jobs}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.RunAction(makeRule(), makeJob("hello"), makeAlert())
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func makeRule() *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      "say-hello",
+			Namespace: "default",
+		},
+	}
+}
+
+func makeAlert() *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NewFriend",
+		},
+	}
+}
+
+func makeJob(name string, conditions ...batch.JobConditionType) *batch.Job {
+	job := &batch.Job{
+		ObjectMeta: meta.ObjectMeta{
+			Name: name,
+		},
+	}
+	for _, condition := range conditions {
+		job.Status.Conditions = append(job.Status.Conditions, batch.JobCondition{
+			Type:   condition,
+			Status: core.ConditionTrue,
+		})
+	}
+	return job
+}
+
+// fakeClient is a Kubernetes client that only implements the parts of the API used by the batch
+// runner. Calling any other method will panic.
+//
+type fakeClient struct {
+	kubernetes.Interface
+	jobs       *fakeJobs
+	pods       *fakePods
+	nodes      *fakeNodes
+	configMaps *fakeConfigMaps
+}
+
+func (c *fakeClient) Batch() batchv1.BatchV1Interface {
+	return &fakeBatch{jobs: c.jobs}
+}
+
+type fakeBatch struct {
+	batchv1.BatchV1Interface
+	jobs *fakeJobs
+}
+
+func (b *fakeBatch) Jobs(namespace string) batchv1.JobInterface {
+	return b.jobs
+}
+
+type fakeJobs struct {
+	batchv1.JobInterface
+	items   map[string]*batch.Job
+	created []string
+	deleted []string
+
+	// When positive, the jobs are reported as complete after this number of calls to Get.
+	completeAfter int
+	gets          int
+}
+
+func newFakeJobs() *fakeJobs {
+	return &fakeJobs{
+		items: make(map[string]*batch.Job),
+	}
+}
+
+func (j *fakeJobs) Get(name string, options meta.GetOptions) (*batch.Job, error) {
+	job, ok := j.items[name]
+	if !ok {
+		return nil, errors.NewNotFound(schema.GroupResource{Group: "batch", Resource: "jobs"}, name)
+	}
+	j.gets++
+	if j.completeAfter > 0 && j.gets >= j.completeAfter {
+		return makeJob(name, batch.JobComplete), nil
+	}
+	return job, nil
+}
+
+func (j *fakeJobs) Create(job *batch.Job) (*batch.Job, error) {
+	if _, ok := j.items[job.Name]; ok {
+		return nil, errors.NewAlreadyExists(schema.GroupResource{Group: "batch", Resource: "jobs"}, job.Name)
+	}
+	j.items[job.Name] = job
+	j.created = append(j.created, job.Name)
+	return job, nil
+}
+
+func (j *fakeJobs) Delete(name string, options *meta.DeleteOptions) error {
+	if _, ok := j.items[name]; !ok {
+		return errors.NewNotFound(schema.GroupResource{Group: "batch", Resource: "jobs"}, name)
+	}
+	delete(j.items, name)
+	j.deleted = append(j.deleted, name)
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions that implement the dry run mode of the jobs, requested by an
+// annotation of the job.
+
+package batchrunner
+
+import (
+	"strconv"
+
+	"github.com/ghodss/yaml"
+	batch "k8s.io/api/batch/v1"
+
+	"github.com/openshift/autoheal/pkg/logging"
+)
+
+// DryRunAnnotation indicates, when its value is 'true', that the job shouldn't be created. Instead
+// the complete job, after processing the templates and the rest of the annotations, is written to
+// the log.
+//
+const DryRunAnnotation = "autoheal.openshift.io/dry-run"
+
+// isDryRun checks if the annotations of the given job request the dry run mode. It returns an error
+// if the value of the annotation isn't a valid boolean.
+//
+func isDryRun(job *batch.Job) (bool, error) {
+	value := job.ObjectMeta.Annotations[DryRunAnnotation]
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// logDryRun writes to the log the YAML representation of the job that would have been created.
+//
+func logDryRun(job *batch.Job, alert string) error {
+	data, err := yaml.Marshal(job)
+	if err != nil {
+		return err
+	}
+	logging.Infof(
+		"Dry run of batch job '%s' to heal alert '%s', it won't be created:\n%s",
+		job.ObjectMeta.Name,
+		alert,
+		data,
+	)
+	return nil
+}
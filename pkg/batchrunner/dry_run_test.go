@@ -0,0 +1,87 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batchrunner
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+)
+
+func TestDryRunDoesntCreateJob(t *testing.T) {
+	client := &unusedClient{t: t}
+	runner, err := NewBuilder().
+		KubernetesClient(client).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := makeImageJob(map[string]string{
+		DryRunAnnotation:        "true",
+		ImageOverrideAnnotation: "myapp:v1.2.2",
+	})
+	err = runner.RunAction(makeRule(), job, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.calls != 0 {
+		t.Errorf("Expected the Kubernetes API to not be used, but it was used %d times", client.calls)
+	}
+}
+
+func TestDryRunDisabledCreatesJob(t *testing.T) {
+	jobs := newFakeJobs()
+	runImageJob(t, jobs, makeImageJob(map[string]string{
+		DryRunAnnotation: "false",
+	}))
+	if len(jobs.created) != 1 {
+		t.Errorf("Expected the job to be created, but %d were", len(jobs.created))
+	}
+}
+
+func TestDryRunInvalidAnnotation(t *testing.T) {
+	client := &unusedClient{t: t}
+	runner, err := NewBuilder().
+		KubernetesClient(client).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.RunAction(makeRule(), makeImageJob(map[string]string{
+		DryRunAnnotation: "perhaps",
+	}), makeAlert())
+	if err == nil {
+		t.Errorf("Expected an error for an invalid annotation value")
+	}
+	if client.calls != 0 {
+		t.Errorf("Expected the Kubernetes API to not be used, but it was used %d times", client.calls)
+	}
+}
+
+// unusedClient is a Kubernetes client that reports an error if the batch API is used.
+//
+type unusedClient struct {
+	fakeClient
+	t     *testing.T
+	calls int
+}
+
+func (c *unusedClient) Batch() batchv1.BatchV1Interface {
+	c.calls++
+	c.t.Errorf("The batch API shouldn't be used")
+	return &fakeBatch{jobs: newFakeJobs()}
+}
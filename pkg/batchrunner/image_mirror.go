@@ -0,0 +1,72 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions that replace the registries of the images of the containers of
+// the jobs with a mirror, for environments that can't pull images from the original registries.
+
+package batchrunner
+
+import (
+	"strings"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+)
+
+// applyImageMirror replaces the registries of the images of the containers and init containers of
+// the given job with the given mirror. It does nothing if the mirror is empty.
+//
+func applyImageMirror(job *batch.Job, mirror string) {
+	if mirror == "" {
+		return
+	}
+	spec := &job.Spec.Template.Spec
+	mirrorContainers(spec.InitContainers, mirror)
+	mirrorContainers(spec.Containers, mirror)
+}
+
+func mirrorContainers(containers []core.Container, mirror string) {
+	for i := range containers {
+		containers[i].Image = mirrorImage(containers[i].Image, mirror)
+	}
+}
+
+// mirrorImage calculates the reference of the given image in the given mirror. The registry of the
+// image, if it has one, is replaced by the mirror, and the rest of the reference, including the
+// tag or the digest, is kept. Images that are already in the mirror aren't changed. For example,
+// with the 'mirror.example.com/autoheal' mirror:
+//
+//	quay.io/openshift/origin-cli:v3.11 -> mirror.example.com/autoheal/openshift/origin-cli:v3.11
+//	busybox:latest                     -> mirror.example.com/autoheal/busybox:latest
+//	myapp@sha256:0123...               -> mirror.example.com/autoheal/myapp@sha256:0123...
+//
+func mirrorImage(image, mirror string) string {
+	if image == "" || strings.HasPrefix(image, mirror+"/") {
+		return image
+	}
+
+	// As in the Docker references, the first component of the name is the registry only if
+	// there are more components, and it contains a dot or a colon, or it is 'localhost':
+	path := image
+	slash := strings.Index(image, "/")
+	if slash >= 0 {
+		first := image[:slash]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			path = image[slash+1:]
+		}
+	}
+	return mirror + "/" + path
+}
@@ -0,0 +1,155 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batchrunner
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+func TestImageMirrorRewritesAllContainers(t *testing.T) {
+	cfg := makeMirrorConfig(t, "mirror.example.com/autoheal/")
+	defer cfg.ShutDown()
+
+	job := makeJob("hello")
+	job.Spec.Template.Spec.InitContainers = []core.Container{
+		{
+			Name:  "init",
+			Image: "busybox",
+		},
+	}
+	job.Spec.Template.Spec.Containers = []core.Container{
+		{
+			Name:  "cli",
+			Image: "quay.io/openshift/origin-cli:v3.11",
+		},
+		{
+			Name:  "app",
+			Image: "myapp@sha256:0123456789abcdef",
+		},
+		{
+			Name:  "sidecar",
+			Image: "sidecar:latest",
+		},
+		{
+			Name:  "local",
+			Image: "localhost:5000/tools/debug:1.0",
+		},
+		{
+			Name:  "mirrored",
+			Image: "mirror.example.com/autoheal/helper:2.0",
+		},
+	}
+
+	jobs := newFakeJobs()
+	runner, err := NewBuilder().
+		KubernetesClient(&fakeClient{jobs: jobs}).
+		Runtime(cfg.Runtime()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.RunAction(makeRule(), job, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := jobs.items["hello"].Spec.Template.Spec
+	expected := map[string]string{
+		"init":     "mirror.example.com/autoheal/busybox",
+		"cli":      "mirror.example.com/autoheal/openshift/origin-cli:v3.11",
+		"app":      "mirror.example.com/autoheal/myapp@sha256:0123456789abcdef",
+		"sidecar":  "mirror.example.com/autoheal/sidecar:latest",
+		"local":    "mirror.example.com/autoheal/tools/debug:1.0",
+		"mirrored": "mirror.example.com/autoheal/helper:2.0",
+	}
+	containers := append(spec.InitContainers, spec.Containers...)
+	for _, container := range containers {
+		if container.Image != expected[container.Name] {
+			t.Errorf(
+				"Expected image of container '%s' to be '%s' but it is '%s'",
+				container.Name,
+				expected[container.Name],
+				container.Image,
+			)
+		}
+	}
+
+	// The action itself shouldn't be modified:
+	if job.Spec.Template.Spec.Containers[0].Image != "quay.io/openshift/origin-cli:v3.11" {
+		t.Errorf("Expected the action not to be modified")
+	}
+}
+
+func TestImageMirrorAppliedToOverriddenImage(t *testing.T) {
+	cfg := makeMirrorConfig(t, "mirror.example.com")
+	defer cfg.ShutDown()
+
+	jobs := newFakeJobs()
+	runner, err := NewBuilder().
+		KubernetesClient(&fakeClient{jobs: jobs}).
+		Runtime(cfg.Runtime()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.RunAction(makeRule(), makeImageJob(map[string]string{
+		ImageOverrideAnnotation:          "docker.io/myorg/myapp:v1.2.2",
+		ImageOverrideContainerAnnotation: "app",
+	}), makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	containers := jobs.items["hello"].Spec.Template.Spec.Containers
+	if containers[0].Image != "mirror.example.com/myorg/myapp:v1.2.2" {
+		t.Errorf("Expected overridden image to come from the mirror, but it is '%s'", containers[0].Image)
+	}
+}
+
+func TestImageNotMirroredWithoutMirror(t *testing.T) {
+	jobs := newFakeJobs()
+	runImageJob(t, jobs, makeImageJob(nil))
+
+	containers := jobs.items["hello"].Spec.Template.Spec.Containers
+	if containers[1].Image != "sidecar:latest" {
+		t.Errorf("Expected image to be kept but it is '%s'", containers[1].Image)
+	}
+}
+
+func makeMirrorConfig(t *testing.T, mirror string) *config.Config {
+	file, err := ioutil.TempFile("", "runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("runtime:\n  imageMirror: " + mirror + "\n")
+	file.Close()
+
+	cfg, err := config.NewBuilder().
+		File(file.Name()).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions that replace the images of the containers of the jobs, as
+// requested by annotations of the job.
+
+package batchrunner
+
+import (
+	"fmt"
+
+	batch "k8s.io/api/batch/v1"
+)
+
+// The annotations that can be added to batch jobs to replace the images of their containers. As
+// the templates of the job are processed before running it, the values can use the labels of the
+// alert, for example '{{ $labels.prev_image }}'.
+//
+const (
+	// ImageOverrideAnnotation contains the image that will replace the image of the containers of
+	// the job.
+	ImageOverrideAnnotation = "autoheal.openshift.io/image-override"
+
+	// ImageOverrideContainerAnnotation contains the name of the only container whose image will be
+	// replaced. If it isn't set the image of all the containers will be replaced.
+	ImageOverrideContainerAnnotation = "autoheal.openshift.io/image-override-container"
+)
+
+// applyImageOverride replaces the images of the containers of the given job, according to its
+// annotations. It returns an error if the annotations ask to replace the image of a container that
+// doesn't exist.
+//
+func applyImageOverride(job *batch.Job) error {
+	image := job.ObjectMeta.Annotations[ImageOverrideAnnotation]
+	if image == "" {
+		return nil
+	}
+	containers := job.Spec.Template.Spec.Containers
+	name := job.ObjectMeta.Annotations[ImageOverrideContainerAnnotation]
+	if name == "" {
+		for i := range containers {
+			containers[i].Image = image
+		}
+		return nil
+	}
+	for i := range containers {
+		if containers[i].Name == name {
+			containers[i].Image = image
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"Can't override image of container '%s' of job '%s' because it doesn't exist",
+		name,
+		job.ObjectMeta.Name,
+	)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batchrunner
+
+import (
+	"testing"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+)
+
+func TestImageOverrideAllContainers(t *testing.T) {
+	jobs := newFakeJobs()
+	job := makeImageJob(map[string]string{
+		ImageOverrideAnnotation: "myapp:v1.2.2",
+	})
+	runImageJob(t, jobs, job)
+
+	created := jobs.items["hello"]
+	for _, container := range created.Spec.Template.Spec.Containers {
+		if container.Image != "myapp:v1.2.2" {
+			t.Errorf("Expected image of container '%s' to be 'myapp:v1.2.2' but it is '%s'",
+				container.Name, container.Image)
+		}
+	}
+
+	// The action itself shouldn't be modified:
+	if job.Spec.Template.Spec.Containers[0].Image != "myapp:v1.2.3-broken" {
+		t.Errorf("Expected the action not to be modified")
+	}
+}
+
+func TestImageOverrideNamedContainer(t *testing.T) {
+	jobs := newFakeJobs()
+	runImageJob(t, jobs, makeImageJob(map[string]string{
+		ImageOverrideAnnotation:          "myapp:v1.2.2",
+		ImageOverrideContainerAnnotation: "app",
+	}))
+
+	containers := jobs.items["hello"].Spec.Template.Spec.Containers
+	if containers[0].Image != "myapp:v1.2.2" {
+		t.Errorf("Expected image of container 'app' to be 'myapp:v1.2.2' but it is '%s'", containers[0].Image)
+	}
+	if containers[1].Image != "sidecar:latest" {
+		t.Errorf("Expected image of container 'sidecar' to be kept but it is '%s'", containers[1].Image)
+	}
+}
+
+func TestImageOverrideMissingContainer(t *testing.T) {
+	jobs := newFakeJobs()
+	runner, err := NewBuilder().
+		KubernetesClient(&fakeClient{jobs: jobs}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.RunAction(makeRule(), makeImageJob(map[string]string{
+		ImageOverrideAnnotation:          "myapp:v1.2.2",
+		ImageOverrideContainerAnnotation: "missing",
+	}), makeAlert())
+	if err == nil {
+		t.Errorf("Expected an error when the container doesn't exist")
+	}
+	if len(jobs.created) != 0 {
+		t.Errorf("Expected no job to be created, but %d were", len(jobs.created))
+	}
+}
+
+func TestImageNotOverriddenWithoutAnnotation(t *testing.T) {
+	jobs := newFakeJobs()
+	runImageJob(t, jobs, makeImageJob(nil))
+
+	containers := jobs.items["hello"].Spec.Template.Spec.Containers
+	if containers[0].Image != "myapp:v1.2.3-broken" {
+		t.Errorf("Expected image to be kept but it is '%s'", containers[0].Image)
+	}
+}
+
+func runImageJob(t *testing.T, jobs *fakeJobs, job *batch.Job) {
+	runner, err := NewBuilder().
+		KubernetesClient(&fakeClient{jobs: jobs}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.RunAction(makeRule(), job, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func makeImageJob(annotations map[string]string) *batch.Job {
+	job := makeJob("hello")
+	job.ObjectMeta.Annotations = annotations
+	job.Spec.Template.Spec.Containers = []core.Container{
+		{
+			Name:  "app",
+			Image: "myapp:v1.2.3-broken",
+		},
+		{
+			Name:  "sidecar",
+			Image: "sidecar:latest",
+		},
+	}
+	return job
+}
@@ -0,0 +1,254 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions that prevent the jobs from running in the node affected by the
+// alert, as requested by annotations of the job.
+//
+// The batch jobs of the healing rules are plain Kubernetes jobs, there is no specific action type
+// where an 'avoid alert node' flag could be added, so the behaviour is requested with the
+// AvoidAlertNodeAnnotation and NodeLabelKeyAnnotation annotations of the job instead.
+//
+// When the alert identifies a pod, with the 'namespace' and 'pod' labels, the job gets a pod
+// anti-affinity rule that prevents it from running in the same node than that pod. Pod affinity
+// rules can only refer to pods, not to nodes, so when the alert identifies a node the job gets
+// instead a node affinity rule that excludes that node.
+
+package batchrunner
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/logging"
+)
+
+// The annotations that can be added to batch jobs to prevent them from running in the node
+// affected by the alert.
+//
+const (
+	// AvoidAlertNodeAnnotation indicates, when its value is 'true', that the job shouldn't run in
+	// the node affected by the alert.
+	AvoidAlertNodeAnnotation = "autoheal.openshift.io/avoid-alert-node"
+
+	// NodeLabelKeyAnnotation contains the name of the alert label that contains the name of the
+	// affected node. If it isn't set the 'node' label is used, and then the 'instance' label.
+	NodeLabelKeyAnnotation = "autoheal.openshift.io/node-label-key"
+)
+
+// hostnameLabel is the label that Kubernetes adds to the nodes with their host name.
+//
+const hostnameLabel = "kubernetes.io/hostname"
+
+// defaultNodeLabelKeys are the alert labels checked, in order, to find the name of the node
+// affected by the alert when the job doesn't specify one.
+//
+var defaultNodeLabelKeys = []string{"node", "instance"}
+
+// applyNodeAvoidance adds to the given job the affinity rules that prevent it from running in the
+// node affected by the alert, if its annotations request it. If the node can't be determined from
+// the labels of the alert the job is left unchanged.
+//
+func (r *Runner) applyNodeAvoidance(job *batch.Job, alert *alertmanager.Alert) error {
+	value := job.ObjectMeta.Annotations[AvoidAlertNodeAnnotation]
+	if value == "" {
+		return nil
+	}
+	avoid, err := strconv.ParseBool(value)
+	if err != nil || !avoid {
+		return err
+	}
+	spec := &job.Spec.Template.Spec
+
+	// Avoid the node where the pod of the alert runs:
+	podAvoided := false
+	namespace, pod := alert.Labels["namespace"], alert.Labels["pod"]
+	if namespace != "" && pod != "" {
+		labels, err := r.podLabels(namespace, pod)
+		if err != nil {
+			logging.Warningf(
+				"Job '%s' should avoid the node of pod '%s' of namespace '%s', but the "+
+					"labels of the pod can't be retrieved: %s",
+				job.ObjectMeta.Name,
+				pod,
+				namespace,
+				err,
+			)
+		} else {
+			addPodAntiAffinity(spec, namespace, labels)
+			podAvoided = true
+		}
+	}
+
+	// Avoid the node of the alert:
+	node := alertNode(job, alert)
+	if node == "" {
+		if !podAvoided {
+			logging.Warningf(
+				"Job '%s' should avoid the node of alert '%s', but the alert doesn't have "+
+					"a node label",
+				job.ObjectMeta.Name,
+				alert.Name(),
+			)
+		}
+		return nil
+	}
+	hostname, err := r.nodeHostname(node)
+	if err != nil {
+		logging.Warningf(
+			"Job '%s' should avoid node '%s' of alert '%s', but it will not: %s",
+			job.ObjectMeta.Name,
+			node,
+			alert.Name(),
+			err,
+		)
+		return nil
+	}
+	addNodeExclusion(spec, hostname)
+	return nil
+}
+
+// alertNode returns the name or the address of the node affected by the alert, or an empty string
+// if it can't be determined. Port numbers, like in the 'instance' label of most alerts, are
+// removed.
+//
+func alertNode(job *batch.Job, alert *alertmanager.Alert) string {
+	keys := defaultNodeLabelKeys
+	if key := job.ObjectMeta.Annotations[NodeLabelKeyAnnotation]; key != "" {
+		keys = []string{key}
+	}
+	for _, key := range keys {
+		node := alert.Labels[key]
+		if node == "" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(node)
+		if err == nil {
+			node = host
+		}
+		return node
+	}
+	return ""
+}
+
+// nodeHostname returns the value of the host name label of the given node. Host names are used
+// directly. IP addresses, which is what the 'instance' label usually contains, are resolved
+// finding the node that has that address.
+//
+func (r *Runner) nodeHostname(node string) (hostname string, err error) {
+	if net.ParseIP(node) == nil {
+		if errs := validation.IsDNS1123Subdomain(node); len(errs) > 0 {
+			err = fmt.Errorf("'%s' isn't a host name or an IP address", node)
+			return
+		}
+		hostname = node
+		return
+	}
+	list, err := r.k8sClient.CoreV1().Nodes().List(meta.ListOptions{})
+	if err != nil {
+		err = fmt.Errorf("Can't list nodes to find the one with address '%s': %s", node, err)
+		return
+	}
+	for _, item := range list.Items {
+		for _, address := range item.Status.Addresses {
+			if address.Address != node {
+				continue
+			}
+			hostname = item.ObjectMeta.Labels[hostnameLabel]
+			if hostname == "" {
+				hostname = item.ObjectMeta.Name
+			}
+			return
+		}
+	}
+	err = fmt.Errorf("There is no node with address '%s'", node)
+	return
+}
+
+// podLabels returns the labels of the given pod, used to select it in pod affinity rules.
+//
+func (r *Runner) podLabels(namespace, name string) (labels map[string]string, err error) {
+	pod, err := r.k8sClient.CoreV1().Pods(namespace).Get(name, meta.GetOptions{})
+	if err != nil {
+		return
+	}
+	if len(pod.ObjectMeta.Labels) == 0 {
+		err = fmt.Errorf("The pod doesn't have labels")
+		return
+	}
+	labels = pod.ObjectMeta.Labels
+	return
+}
+
+// addPodAntiAffinity modifies the given pod spec so that it is never scheduled to the node where
+// the pods with the given labels, in the given namespace, run.
+//
+func addPodAntiAffinity(spec *core.PodSpec, namespace string, labels map[string]string) {
+	term := core.PodAffinityTerm{
+		LabelSelector: &meta.LabelSelector{
+			MatchLabels: labels,
+		},
+		Namespaces:  []string{namespace},
+		TopologyKey: hostnameLabel,
+	}
+	if spec.Affinity == nil {
+		spec.Affinity = &core.Affinity{}
+	}
+	if spec.Affinity.PodAntiAffinity == nil {
+		spec.Affinity.PodAntiAffinity = &core.PodAntiAffinity{}
+	}
+	antiAffinity := spec.Affinity.PodAntiAffinity
+	antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+		antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+		term,
+	)
+}
+
+// addNodeExclusion modifies the given pod spec so that it is never scheduled to the given node.
+// The terms of a node selector are alternatives, so the requirement is added to all the existing
+// terms.
+//
+func addNodeExclusion(spec *core.PodSpec, node string) {
+	requirement := core.NodeSelectorRequirement{
+		Key:      hostnameLabel,
+		Operator: core.NodeSelectorOpNotIn,
+		Values:   []string{node},
+	}
+	if spec.Affinity == nil {
+		spec.Affinity = &core.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &core.NodeAffinity{}
+	}
+	nodeAffinity := spec.Affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &core.NodeSelector{}
+	}
+	selector := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(selector.NodeSelectorTerms) == 0 {
+		selector.NodeSelectorTerms = []core.NodeSelectorTerm{{}}
+	}
+	for i := range selector.NodeSelectorTerms {
+		term := &selector.NodeSelectorTerms[i]
+		term.MatchExpressions = append(term.MatchExpressions, requirement)
+	}
+}
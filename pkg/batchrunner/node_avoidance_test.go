@@ -0,0 +1,353 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batchrunner
+
+import (
+	"reflect"
+	"testing"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+)
+
+func TestAvoidAlertNodeUsesNodeLabel(t *testing.T) {
+	jobs := newFakeJobs()
+	job := makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "true",
+	})
+	runNodeJob(t, jobs, job, map[string]string{
+		"alertname": "NodeMemoryPressure",
+		"node":      "node0.example.com",
+		"instance":  "10.0.0.1:9100",
+	})
+
+	checkNodeExclusions(t, jobs.items["hello"], [][]string{{"node0.example.com"}})
+
+	// The action itself shouldn't be modified:
+	if job.Spec.Template.Spec.Affinity != nil {
+		t.Errorf("Expected the action not to be modified")
+	}
+}
+
+func TestAvoidAlertNodeFallsBackToInstanceLabel(t *testing.T) {
+	jobs := newFakeJobs()
+	runNodeJob(t, jobs, makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "true",
+	}), map[string]string{
+		"alertname": "NodeMemoryPressure",
+		"instance":  "node1.example.com:9100",
+	})
+
+	checkNodeExclusions(t, jobs.items["hello"], [][]string{{"node1.example.com"}})
+}
+
+func TestAvoidAlertNodeResolvesInstanceAddress(t *testing.T) {
+	client := &fakeClient{
+		jobs: newFakeJobs(),
+		nodes: &fakeNodes{
+			items: []core.Node{
+				makeNode("node0", "node0.example.com", "10.0.0.1"),
+				makeNode("node1", "node1.example.com", "10.0.0.2"),
+			},
+		},
+	}
+	runClientNodeJob(t, client, makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "true",
+	}), map[string]string{
+		"alertname": "NodeMemoryPressure",
+		"instance":  "10.0.0.2:9100",
+	})
+
+	// The address should be replaced by the host name of the node that has it:
+	checkNodeExclusions(t, client.jobs.items["hello"], [][]string{{"node1.example.com"}})
+}
+
+func TestAvoidAlertNodeSkipsUnknownAddress(t *testing.T) {
+	client := &fakeClient{
+		jobs: newFakeJobs(),
+		nodes: &fakeNodes{
+			items: []core.Node{
+				makeNode("node0", "node0.example.com", "10.0.0.1"),
+			},
+		},
+	}
+	runClientNodeJob(t, client, makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "true",
+	}), map[string]string{
+		"alertname": "NodeMemoryPressure",
+		"instance":  "10.0.0.9:9100",
+	})
+
+	if client.jobs.items["hello"].Spec.Template.Spec.Affinity != nil {
+		t.Errorf("Expected no affinity when no node has the address of the alert")
+	}
+}
+
+func TestAvoidAlertNodeSkipsInvalidHostName(t *testing.T) {
+	jobs := newFakeJobs()
+	runNodeJob(t, jobs, makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "true",
+	}), map[string]string{
+		"alertname": "NodeMemoryPressure",
+		"node":      "Not A Host",
+	})
+
+	if jobs.items["hello"].Spec.Template.Spec.Affinity != nil {
+		t.Errorf("Expected no affinity when the node label isn't a host name")
+	}
+}
+
+func TestAvoidAlertNodeAddsPodAntiAffinity(t *testing.T) {
+	client := &fakeClient{
+		jobs: newFakeJobs(),
+		pods: &fakePods{
+			items: map[string]*core.Pod{
+				"web-0": {
+					ObjectMeta: meta.ObjectMeta{
+						Name:      "web-0",
+						Namespace: "shop",
+						Labels: map[string]string{
+							"app": "web",
+						},
+					},
+				},
+			},
+		},
+	}
+	runClientNodeJob(t, client, makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "true",
+	}), map[string]string{
+		"alertname": "PodMemoryPressure",
+		"namespace": "shop",
+		"pod":       "web-0",
+	})
+
+	affinity := client.jobs.items["hello"].Spec.Template.Spec.Affinity
+	if affinity == nil || affinity.PodAntiAffinity == nil {
+		t.Fatalf("Expected the job to have a pod anti-affinity")
+	}
+	terms := affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 {
+		t.Fatalf("Expected 1 pod anti-affinity term but got %d", len(terms))
+	}
+	term := terms[0]
+	if term.TopologyKey != hostnameLabel {
+		t.Errorf("Expected topology key '%s', but got '%s'", hostnameLabel, term.TopologyKey)
+	}
+	if !reflect.DeepEqual(term.Namespaces, []string{"shop"}) {
+		t.Errorf("Expected namespaces [shop], but got %v", term.Namespaces)
+	}
+	if term.LabelSelector == nil || !reflect.DeepEqual(term.LabelSelector.MatchLabels, map[string]string{"app": "web"}) {
+		t.Errorf("Expected the labels of the pod in the selector, but got %+v", term.LabelSelector)
+	}
+
+	// The alert doesn't have a node label, so there should be no node affinity:
+	if affinity.NodeAffinity != nil {
+		t.Errorf("Expected no node affinity, but got %+v", affinity.NodeAffinity)
+	}
+}
+
+func TestAvoidAlertNodeWithCustomLabel(t *testing.T) {
+	jobs := newFakeJobs()
+	runNodeJob(t, jobs, makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "true",
+		NodeLabelKeyAnnotation:   "kubernetes_node",
+	}), map[string]string{
+		"alertname":       "NodeMemoryPressure",
+		"node":            "node0.example.com",
+		"kubernetes_node": "node2.example.com",
+	})
+
+	checkNodeExclusions(t, jobs.items["hello"], [][]string{{"node2.example.com"}})
+}
+
+func TestAvoidAlertNodeKeepsExistingTerms(t *testing.T) {
+	jobs := newFakeJobs()
+	job := makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "true",
+	})
+	job.Spec.Template.Spec.Affinity = &core.Affinity{
+		NodeAffinity: &core.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &core.NodeSelector{
+				NodeSelectorTerms: []core.NodeSelectorTerm{
+					{
+						MatchExpressions: []core.NodeSelectorRequirement{
+							{
+								Key:      "node-role.kubernetes.io/infra",
+								Operator: core.NodeSelectorOpExists,
+							},
+						},
+					},
+					{
+						MatchExpressions: []core.NodeSelectorRequirement{
+							{
+								Key:      "node-role.kubernetes.io/master",
+								Operator: core.NodeSelectorOpExists,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	runNodeJob(t, jobs, job, map[string]string{
+		"alertname": "NodeMemoryPressure",
+		"node":      "node0.example.com",
+	})
+
+	// Each of the alternative terms should exclude the node, and keep its original requirement:
+	terms := jobs.items["hello"].Spec.Template.Spec.Affinity.NodeAffinity.
+		RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 2 {
+		t.Fatalf("Expected 2 node selector terms but got %d", len(terms))
+	}
+	for _, term := range terms {
+		if len(term.MatchExpressions) != 2 {
+			t.Errorf("Expected 2 requirements in term but got %d", len(term.MatchExpressions))
+			continue
+		}
+		if term.MatchExpressions[0].Operator != core.NodeSelectorOpExists {
+			t.Errorf("Expected the original requirement to be kept, but got %+v", term.MatchExpressions[0])
+		}
+	}
+	checkNodeExclusions(t, jobs.items["hello"], [][]string{{"node0.example.com"}, {"node0.example.com"}})
+}
+
+func TestAvoidAlertNodeWithoutNodeLabel(t *testing.T) {
+	jobs := newFakeJobs()
+	runNodeJob(t, jobs, makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "true",
+	}), map[string]string{
+		"alertname": "NodeMemoryPressure",
+	})
+
+	if jobs.items["hello"].Spec.Template.Spec.Affinity != nil {
+		t.Errorf("Expected no affinity when the alert doesn't have a node label")
+	}
+}
+
+func TestAvoidAlertNodeDisabled(t *testing.T) {
+	jobs := newFakeJobs()
+	runNodeJob(t, jobs, makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "false",
+	}), map[string]string{
+		"alertname": "NodeMemoryPressure",
+		"node":      "node0.example.com",
+	})
+
+	if jobs.items["hello"].Spec.Template.Spec.Affinity != nil {
+		t.Errorf("Expected no affinity when the annotation is false")
+	}
+}
+
+func TestAvoidAlertNodeInvalidAnnotation(t *testing.T) {
+	jobs := newFakeJobs()
+	runner, err := NewBuilder().
+		KubernetesClient(&fakeClient{jobs: jobs}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.RunAction(makeRule(), makeImageJob(map[string]string{
+		AvoidAlertNodeAnnotation: "maybe",
+	}), makeAlert())
+	if err == nil {
+		t.Errorf("Expected an error for an invalid annotation value")
+	}
+	if len(jobs.created) != 0 {
+		t.Errorf("Expected no job to be created, but %d were", len(jobs.created))
+	}
+}
+
+func runNodeJob(t *testing.T, jobs *fakeJobs, job *batch.Job, labels map[string]string) {
+	runClientNodeJob(t, &fakeClient{jobs: jobs}, job, labels)
+}
+
+func runClientNodeJob(t *testing.T, client *fakeClient, job *batch.Job, labels map[string]string) {
+	runner, err := NewBuilder().
+		KubernetesClient(client).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runner.RunAction(makeRule(), job, &alertmanager.Alert{
+		Labels: labels,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkNodeExclusions checks that each node selector term of the job has a requirement that
+// excludes the given nodes using the host name label.
+//
+func checkNodeExclusions(t *testing.T, job *batch.Job, expected [][]string) {
+	affinity := job.Spec.Template.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil ||
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		t.Fatalf("Expected the job to have a required node affinity")
+	}
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != len(expected) {
+		t.Fatalf("Expected %d node selector terms but got %d", len(expected), len(terms))
+	}
+	for i, term := range terms {
+		last := term.MatchExpressions[len(term.MatchExpressions)-1]
+		if last.Key != hostnameLabel || last.Operator != core.NodeSelectorOpNotIn {
+			t.Errorf("Expected requirement '%s NotIn', but got %+v", hostnameLabel, last)
+		}
+		if !reflect.DeepEqual(last.Values, expected[i]) {
+			t.Errorf("Expected excluded nodes %v, but got %v", expected[i], last.Values)
+		}
+	}
+}
+
+func makeNode(name, hostname, address string) core.Node {
+	return core.Node{
+		ObjectMeta: meta.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				hostnameLabel: hostname,
+			},
+		},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{
+				{
+					Type:    core.NodeInternalIP,
+					Address: address,
+				},
+			},
+		},
+	}
+}
+
+// fakeNodes returns always the same list of nodes.
+//
+type fakeNodes struct {
+	corev1.NodeInterface
+	items []core.Node
+}
+
+func (n *fakeNodes) List(options meta.ListOptions) (*core.NodeList, error) {
+	return &core.NodeList{
+		Items: n.items,
+	}, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batchrunner
+
+import (
+	"bytes"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/logging"
+)
+
+// maxOutputSize is the maximum number of bytes of output saved for each job. When the output is
+// larger only the last part is saved, as that is usually where the errors are.
+//
+const maxOutputSize = 10 * 1024
+
+// outputTruncated is the text added to the beginning of the output when it has been truncated.
+//
+const outputTruncated = "[output truncated]\n"
+
+// maxOutputLines is the number of lines requested from the end of the logs of each pod. It is used
+// together with the maximum output size, so that only the last part of the logs, which is where the
+// errors usually are, is transferred and kept in memory.
+//
+const maxOutputLines = 100
+
+// maxOutputAttempts is the number of times that saving the output of a job is tried before giving
+// up.
+//
+const maxOutputAttempts = 5
+
+// outputName calculates the name of the config map that contains the output of a job.
+//
+func outputName(job string) string {
+	return fmt.Sprintf("autoheal-%s-output", job)
+}
+
+// saveOutput collects the logs of the pods of the given job and saves them in a config map in the
+// same namespace.
+//
+func (r *Runner) saveOutput(job *activeJob) error {
+	// Collect the logs of the pods:
+	pods := r.k8sClient.CoreV1().Pods(job.namespace)
+	list, err := pods.List(meta.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", job.name),
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"Can't list pods of batch job '%s' from namespace '%s': %s",
+			job.name,
+			job.namespace,
+			err,
+		)
+	}
+	tailLines := int64(maxOutputLines)
+	limitBytes := int64(maxOutputSize)
+	buffer := new(bytes.Buffer)
+	for _, pod := range list.Items {
+		logs, err := pods.GetLogs(pod.ObjectMeta.Name, &core.PodLogOptions{
+			TailLines:  &tailLines,
+			LimitBytes: &limitBytes,
+		}).Do().Raw()
+		if err != nil {
+			return fmt.Errorf(
+				"Can't get logs of pod '%s' from namespace '%s': %s",
+				pod.ObjectMeta.Name,
+				job.namespace,
+				err,
+			)
+		}
+		if len(list.Items) > 1 {
+			fmt.Fprintf(buffer, "==> %s <==\n", pod.ObjectMeta.Name)
+		}
+		buffer.Write(logs)
+	}
+	output := truncateOutput(buffer.String())
+
+	// Save the output in the config map, replacing it if it already exists:
+	name := outputName(job.name)
+	configMap := &core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{
+			Namespace: job.namespace,
+			Name:      name,
+			Labels: map[string]string{
+				"job-name": job.name,
+			},
+		},
+		Data: map[string]string{
+			"output": output,
+		},
+	}
+	configMaps := r.k8sClient.CoreV1().ConfigMaps(job.namespace)
+	_, err = configMaps.Create(configMap)
+	if errors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(configMap)
+	}
+	if err != nil {
+		return fmt.Errorf(
+			"Can't save output of batch job '%s' to config map '%s' in namespace '%s': %s",
+			job.name,
+			name,
+			job.namespace,
+			err,
+		)
+	}
+	logging.Infof(
+		"Output of batch job '%s' has been saved to config map '%s' in namespace '%s'",
+		job.name,
+		name,
+		job.namespace,
+	)
+
+	return nil
+}
+
+// truncateOutput makes sure that the given output isn't larger than the maximum size, keeping the
+// last part.
+//
+func truncateOutput(output string) string {
+	if len(output) <= maxOutputSize {
+		return output
+	}
+	return outputTruncated + output[len(output)-maxOutputSize+len(outputTruncated):]
+}
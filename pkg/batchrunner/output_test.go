@@ -0,0 +1,364 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batchrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestOutputSavedWhenJobCompletes(t *testing.T) {
+	client := newFakeOutputClient()
+	client.pods.logs["hello-abc"] = "Hello, world!\n"
+	runner := makeOutputRunner(t, client)
+	runJobWithRunner(t, runner)
+
+	// The job is still running, so nothing should be saved:
+	runner.runActiveJobsWorker()
+	if len(client.configMaps.items) != 0 {
+		t.Fatalf("Expected no config map while the job is running, but got %d", len(client.configMaps.items))
+	}
+
+	// Complete the job and check that the output is saved:
+	client.jobs.items["hello"] = makeJob("hello", batch.JobComplete)
+	runner.runActiveJobsWorker()
+	configMap, ok := client.configMaps.items["autoheal-hello-output"]
+	if !ok {
+		t.Fatalf("Expected config map 'autoheal-hello-output' to be created, but it wasn't")
+	}
+	if configMap.Data["output"] != "Hello, world!\n" {
+		t.Errorf("Expected output 'Hello, world!', but got '%s'", configMap.Data["output"])
+	}
+
+	// The job shouldn't be checked again:
+	delete(client.configMaps.items, "autoheal-hello-output")
+	runner.runActiveJobsWorker()
+	if len(client.configMaps.items) != 0 {
+		t.Errorf("Expected the finished job to be checked only once")
+	}
+}
+
+func TestOutputSavedWhenJobFails(t *testing.T) {
+	client := newFakeOutputClient()
+	client.pods.logs["hello-abc"] = "Something went wrong\n"
+	runner := makeOutputRunner(t, client)
+	runJobWithRunner(t, runner)
+	client.jobs.items["hello"] = makeJob("hello", batch.JobFailed)
+	runner.runActiveJobsWorker()
+	configMap, ok := client.configMaps.items["autoheal-hello-output"]
+	if !ok {
+		t.Fatalf("Expected config map 'autoheal-hello-output' to be created, but it wasn't")
+	}
+	if configMap.Data["output"] != "Something went wrong\n" {
+		t.Errorf("Expected output 'Something went wrong', but got '%s'", configMap.Data["output"])
+	}
+}
+
+func TestOutputNotSavedWhenDisabled(t *testing.T) {
+	client := newFakeOutputClient()
+	runner, err := NewBuilder().
+		KubernetesClient(client).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runJobWithRunner(t, runner)
+	client.jobs.items["hello"] = makeJob("hello", batch.JobComplete)
+	runner.runActiveJobsWorker()
+	if len(client.configMaps.items) != 0 {
+		t.Errorf("Expected no config map when capture is disabled, but got %d", len(client.configMaps.items))
+	}
+}
+
+func TestOutputOfSeveralPods(t *testing.T) {
+	client := newFakeOutputClient()
+	client.pods.logs["hello-abc"] = "First\n"
+	client.pods.logs["hello-def"] = "Second\n"
+	runner := makeOutputRunner(t, client)
+	runJobWithRunner(t, runner)
+	client.jobs.items["hello"] = makeJob("hello", batch.JobComplete)
+	runner.runActiveJobsWorker()
+	expected := "==> hello-abc <==\nFirst\n==> hello-def <==\nSecond\n"
+	actual := client.configMaps.items["autoheal-hello-output"].Data["output"]
+	if actual != expected {
+		t.Errorf("Expected output '%s', but got '%s'", expected, actual)
+	}
+}
+
+func TestOutputReplacesExistingConfigMap(t *testing.T) {
+	client := newFakeOutputClient()
+	client.pods.logs["hello-abc"] = "New\n"
+	client.configMaps.items["autoheal-hello-output"] = &core.ConfigMap{
+		Data: map[string]string{
+			"output": "Old\n",
+		},
+	}
+	runner := makeOutputRunner(t, client)
+	runJobWithRunner(t, runner)
+	client.jobs.items["hello"] = makeJob("hello", batch.JobComplete)
+	runner.runActiveJobsWorker()
+	actual := client.configMaps.items["autoheal-hello-output"].Data["output"]
+	if actual != "New\n" {
+		t.Errorf("Expected output 'New', but got '%s'", actual)
+	}
+}
+
+func TestOutputRequestIsLimited(t *testing.T) {
+	client := newFakeOutputClient()
+	client.pods.logs["hello-abc"] = "Hello, world!\n"
+	runner := makeOutputRunner(t, client)
+	runJobWithRunner(t, runner)
+	client.jobs.items["hello"] = makeJob("hello", batch.JobComplete)
+	runner.runActiveJobsWorker()
+	if len(client.pods.options) != 1 {
+		t.Fatalf("Expected one request for logs, but got %d", len(client.pods.options))
+	}
+	options := client.pods.options[0]
+	if options.LimitBytes == nil || *options.LimitBytes != maxOutputSize {
+		t.Errorf("Expected the logs to be limited to %d bytes, but got %v", maxOutputSize, options.LimitBytes)
+	}
+	if options.TailLines == nil || *options.TailLines != maxOutputLines {
+		t.Errorf("Expected the last %d lines of the logs, but got %v", maxOutputLines, options.TailLines)
+	}
+}
+
+func TestFailedOutputSaveIsRetried(t *testing.T) {
+	client := newFakeOutputClient()
+	client.pods.logs["hello-abc"] = "Hello, world!\n"
+	client.configMaps.failures = 1
+	runner := makeOutputRunner(t, client)
+	runJobWithRunner(t, runner)
+	client.jobs.items["hello"] = makeJob("hello", batch.JobComplete)
+
+	// The first attempt fails, so the job should be kept:
+	runner.runActiveJobsWorker()
+	if len(client.configMaps.items) != 0 {
+		t.Fatalf("Expected no config map after the failure, but got %d", len(client.configMaps.items))
+	}
+	if runner.countActiveJobs() != 1 {
+		t.Fatalf("Expected the job to be kept after the failure, but got %d active jobs", runner.countActiveJobs())
+	}
+
+	// The second attempt should save the output and remove the job:
+	runner.runActiveJobsWorker()
+	if _, ok := client.configMaps.items["autoheal-hello-output"]; !ok {
+		t.Errorf("Expected config map 'autoheal-hello-output' to be created, but it wasn't")
+	}
+	if runner.countActiveJobs() != 0 {
+		t.Errorf("Expected the job to be removed, but got %d active jobs", runner.countActiveJobs())
+	}
+}
+
+func TestOutputSaveGivesUpAfterMaxAttempts(t *testing.T) {
+	client := newFakeOutputClient()
+	client.pods.logs["hello-abc"] = "Hello, world!\n"
+	client.configMaps.failures = maxOutputAttempts + 1
+	runner := makeOutputRunner(t, client)
+	runJobWithRunner(t, runner)
+	client.jobs.items["hello"] = makeJob("hello", batch.JobComplete)
+	for i := 0; i < maxOutputAttempts; i++ {
+		runner.runActiveJobsWorker()
+	}
+	if runner.countActiveJobs() != 0 {
+		t.Errorf("Expected the job to be removed after %d attempts, but got %d active jobs",
+			maxOutputAttempts, runner.countActiveJobs())
+	}
+	if len(client.configMaps.items) != 0 {
+		t.Errorf("Expected no config map, but got %d", len(client.configMaps.items))
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	short := "Short output"
+	if truncateOutput(short) != short {
+		t.Errorf("Expected short output to be kept")
+	}
+	long := strings.Repeat("a", maxOutputSize) + "end"
+	truncated := truncateOutput(long)
+	if len(truncated) != maxOutputSize {
+		t.Errorf("Expected truncated output of %d bytes, but got %d", maxOutputSize, len(truncated))
+	}
+	if !strings.HasPrefix(truncated, outputTruncated) {
+		t.Errorf("Expected truncated output to start with the truncation mark")
+	}
+	if !strings.HasSuffix(truncated, "end") {
+		t.Errorf("Expected truncated output to keep the end of the output")
+	}
+}
+
+func makeOutputRunner(t *testing.T, client *fakeClient) *Runner {
+	runner, err := NewBuilder().
+		KubernetesClient(client).
+		CaptureOutput(true).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func runJobWithRunner(t *testing.T, runner *Runner) {
+	rule := makeRule()
+	err := runner.RunAction(rule, makeJob("hello"), makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newFakeOutputClient() *fakeClient {
+	return &fakeClient{
+		jobs: newFakeJobs(),
+		pods: &fakePods{
+			logs: make(map[string]string),
+		},
+		configMaps: &fakeConfigMaps{
+			items: make(map[string]*core.ConfigMap),
+		},
+	}
+}
+
+func (c *fakeClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeCore{
+		pods:       c.pods,
+		nodes:      c.nodes,
+		configMaps: c.configMaps,
+	}
+}
+
+type fakeCore struct {
+	corev1.CoreV1Interface
+	pods       *fakePods
+	nodes      *fakeNodes
+	configMaps *fakeConfigMaps
+}
+
+func (c *fakeCore) Nodes() corev1.NodeInterface {
+	return c.nodes
+}
+
+func (c *fakeCore) Pods(namespace string) corev1.PodInterface {
+	return c.pods
+}
+
+func (c *fakeCore) ConfigMaps(namespace string) corev1.ConfigMapInterface {
+	return c.configMaps
+}
+
+// fakePods returns one pod for each of the logs that it contains, and the pods that it contains
+// when they are retrieved by name.
+//
+type fakePods struct {
+	corev1.PodInterface
+	logs    map[string]string
+	options []*core.PodLogOptions
+	items   map[string]*core.Pod
+}
+
+func (p *fakePods) Get(name string, options meta.GetOptions) (*core.Pod, error) {
+	pod, ok := p.items[name]
+	if !ok {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: "pods"}, name)
+	}
+	return pod, nil
+}
+
+func (p *fakePods) List(options meta.ListOptions) (*core.PodList, error) {
+	list := new(core.PodList)
+	for _, name := range sortedKeys(p.logs) {
+		list.Items = append(list.Items, core.Pod{
+			ObjectMeta: meta.ObjectMeta{
+				Name: name,
+			},
+		})
+	}
+	return list, nil
+}
+
+func (p *fakePods) GetLogs(name string, options *core.PodLogOptions) *rest.Request {
+	p.options = append(p.options, options)
+	base, _ := url.Parse("http://localhost")
+	client := &fakeHTTPClient{
+		body: p.logs[name],
+	}
+	return rest.NewRequest(client, "GET", base, "", rest.ContentConfig{}, rest.Serializers{}, nil, nil, 0)
+}
+
+// fakeHTTPClient returns always the same body, without sending the request to any server.
+//
+type fakeHTTPClient struct {
+	body string
+}
+
+func (c *fakeHTTPClient) Do(request *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(c.body)),
+		Request:    request,
+	}, nil
+}
+
+// fakeConfigMaps stores the config maps in memory. The given number of failures makes the first
+// requests to create config maps fail.
+//
+type fakeConfigMaps struct {
+	corev1.ConfigMapInterface
+	items    map[string]*core.ConfigMap
+	failures int
+}
+
+func (c *fakeConfigMaps) Create(configMap *core.ConfigMap) (*core.ConfigMap, error) {
+	if c.failures > 0 {
+		c.failures--
+		return nil, errors.NewServiceUnavailable("Try later")
+	}
+	if _, ok := c.items[configMap.Name]; ok {
+		return nil, errors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, configMap.Name)
+	}
+	c.items[configMap.Name] = configMap
+	return configMap, nil
+}
+
+func (c *fakeConfigMaps) Update(configMap *core.ConfigMap) (*core.ConfigMap, error) {
+	if _, ok := c.items[configMap.Name]; !ok {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, configMap.Name)
+	}
+	c.items[configMap.Name] = configMap
+	return configMap, nil
+}
+
+func sortedKeys(items map[string]string) []string {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
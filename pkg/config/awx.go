@@ -39,10 +39,18 @@ type AWXConfig struct {
 	proxy                  string
 	user                   string
 	password               string
+	token                  string
 	insecure               bool
 	ca                     *bytes.Buffer
 	project                string
 	jobStatusCheckInterval time.Duration
+	templateCacheTTL       time.Duration
+	maxJobAge              time.Duration
+	maxConcurrentJobs      int
+	maxRetries             int
+	failureThreshold       int
+	resetTimeout           time.Duration
+	extraVars              map[string]interface{}
 
 	// The Kubernetes client that will be used to load Kubernetes objects:
 	client kubernetes.Interface
@@ -52,6 +60,8 @@ type AWXConfig struct {
 // but not the /v1 or /v2 suffixes.
 //
 func (c *AWXConfig) Address() string {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
 	return c.address
 }
 
@@ -64,6 +74,8 @@ func (c *AWXConfig) Address() string {
 // An empty string means that no proxy should be used.
 //
 func (c *AWXConfig) Proxy() string {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
 	return c.proxy
 }
 
@@ -71,6 +83,8 @@ func (c *AWXConfig) Proxy() string {
 // server.
 //
 func (c *AWXConfig) User() string {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
 	return c.user
 }
 
@@ -78,13 +92,26 @@ func (c *AWXConfig) User() string {
 // the AWX server.
 //
 func (c *AWXConfig) Password() string {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
 	return c.password
 }
 
+// Token returns the OAuth2 personal access token that the auto-heal service will use to connect to
+// the AWX server. When it isn't empty it is used instead of the user name and password.
+//
+func (c *AWXConfig) Token() string {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return c.token
+}
+
 // CA returns the PEM encoded certificates of the authorities that should be trusted when checking
 // the TLS certificate presented by the AWX server. If not provided the system cert pool will be used.
 //
 func (c *AWXConfig) CA() []byte {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
 	if c.ca == nil {
 		return nil
 	}
@@ -94,21 +121,89 @@ func (c *AWXConfig) CA() []byte {
 // Project returns the name of the AWX project that contains the auto-heal job templates.
 //
 func (c *AWXConfig) Project() string {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
 	return c.project
 }
 
 // Whether to use insecure connection to connect to AWX.
 //
 func (c *AWXConfig) Insecure() bool {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
 	return c.insecure
 }
 
 // Return the duration of how often the active AWX jobs status is checked
 //
 func (c *AWXConfig) JobStatusCheckInterval() time.Duration {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
 	return c.jobStatusCheckInterval
 }
 
+// TemplateCacheTTL returns for how long the job templates retrieved from the AWX server should be
+// reused before retrieving them again.
+//
+func (c *AWXConfig) TemplateCacheTTL() time.Duration {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return c.templateCacheTTL
+}
+
+// MaxJobAge returns for how long the active jobs are tracked before checking if they are stale.
+//
+func (c *AWXConfig) MaxJobAge() time.Duration {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return c.maxJobAge
+}
+
+// MaxConcurrentJobs returns the maximum number of jobs that can be active at the same time. Zero
+// means that there is no limit.
+//
+func (c *AWXConfig) MaxConcurrentJobs() int {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return c.maxConcurrentJobs
+}
+
+// MaxRetries returns the number of times that the launch of a job is retried when the request
+// doesn't reach the AWX server. Zero means that it isn't retried.
+//
+func (c *AWXConfig) MaxRetries() int {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return c.maxRetries
+}
+
+// FailureThreshold returns the number of consecutive failed requests to the AWX server after which
+// the runner stops sending requests to it, till the reset timeout expires.
+//
+func (c *AWXConfig) FailureThreshold() int {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return c.failureThreshold
+}
+
+// ResetTimeout returns the time to wait, after the failure threshold has been reached, before
+// sending a trial request to the AWX server.
+//
+func (c *AWXConfig) ResetTimeout() time.Duration {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return c.resetTimeout
+}
+
+// ExtraVars returns the global extra variables that will be passed to all the jobs, combined with
+// the extra variables of each action according to its merge strategy.
+//
+func (c *AWXConfig) ExtraVars() map[string]interface{} {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return c.extraVars
+}
+
 func (a *AWXConfig) merge(decoded *data.AWXConfig) error {
 	// Merge the server address and proxy:
 	if decoded.Address != "" {
@@ -131,6 +226,15 @@ func (a *AWXConfig) merge(decoded *data.AWXConfig) error {
 			return err
 		}
 	}
+	if decoded.Token != "" {
+		a.token = decoded.Token
+	}
+	if decoded.TokenRef != nil {
+		err := a.mergeAWXTokenSecret(decoded.TokenRef)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Merge the TLS details:
 	if decoded.TLS != nil {
@@ -163,6 +267,89 @@ func (a *AWXConfig) merge(decoded *data.AWXConfig) error {
 		a.jobStatusCheckInterval = interval
 	}
 
+	// Merge the templateCacheTTL
+	if decoded.TemplateCacheTTL != "" {
+		ttl, err := time.ParseDuration(decoded.TemplateCacheTTL)
+		if err != nil {
+			return err
+		}
+		a.templateCacheTTL = ttl
+	}
+
+	// Merge the maxJobAge
+	if decoded.MaxJobAge != "" {
+		age, err := time.ParseDuration(decoded.MaxJobAge)
+		if err != nil {
+			return err
+		}
+		a.maxJobAge = age
+	}
+
+	// Merge the maxConcurrentJobs
+	if decoded.MaxConcurrentJobs != 0 {
+		a.maxConcurrentJobs = decoded.MaxConcurrentJobs
+	}
+
+	// Merge the retries of the launch of jobs:
+	if decoded.MaxRetries != 0 {
+		a.maxRetries = decoded.MaxRetries
+	}
+
+	// Merge the circuit breaker settings:
+	if decoded.FailureThreshold != 0 {
+		a.failureThreshold = decoded.FailureThreshold
+	}
+	if decoded.ResetTimeout != "" {
+		timeout, err := time.ParseDuration(decoded.ResetTimeout)
+		if err != nil {
+			return err
+		}
+		a.resetTimeout = timeout
+	}
+
+	// Merge the global extra variables:
+	if decoded.ExtraVars != nil {
+		a.extraVars = decoded.ExtraVars
+	}
+
+	return nil
+}
+
+// check verifies that the AWX configuration is consistent. It should be called after merging all
+// the sources, as the address and the credentials may come from different files or secrets.
+//
+func (a *AWXConfig) check() error {
+	if a.address != "" && a.token == "" && (a.user == "" || a.password == "") {
+		return fmt.Errorf(
+			"The AWX address '%s' is specified, but there is no token and the user name or "+
+				"the password are missing",
+			a.address,
+		)
+	}
+	if a.maxConcurrentJobs < 0 {
+		return fmt.Errorf(
+			"The maximum number of concurrent AWX jobs can't be negative, but it is %d",
+			a.maxConcurrentJobs,
+		)
+	}
+	if a.maxRetries < 0 {
+		return fmt.Errorf(
+			"The maximum number of retries of AWX job launches can't be negative, but it is %d",
+			a.maxRetries,
+		)
+	}
+	if a.failureThreshold <= 0 {
+		return fmt.Errorf(
+			"The AWX failure threshold must be positive, but it is %d",
+			a.failureThreshold,
+		)
+	}
+	if a.resetTimeout <= 0 {
+		return fmt.Errorf(
+			"The AWX reset timeout must be positive, but it is %s",
+			a.resetTimeout,
+		)
+	}
 	return nil
 }
 
@@ -196,6 +383,20 @@ func (a *AWXConfig) mergeAWXCredentialsSecret(reference *core.SecretReference) e
 	return nil
 }
 
+func (a *AWXConfig) mergeAWXTokenSecret(reference *core.SecretReference) error {
+	secret, err := a.loadSecret(reference)
+	if err != nil {
+		return err
+	}
+	if secret.Data != nil {
+		value, ok := secret.Data[core.ServiceAccountTokenKey]
+		if ok {
+			a.token = string(value)
+		}
+	}
+	return nil
+}
+
 func (a *AWXConfig) mergeAWXTLS(tls *data.TLSConfig) error {
 	if tls.CACerts != "" {
 		a.ca.WriteString(tls.CACerts)
@@ -229,21 +430,26 @@ func (a *AWXConfig) mergeAWXTLSSecret(reference *core.SecretReference) error {
 func (a *AWXConfig) loadSecret(reference *core.SecretReference) (secret *core.Secret, err error) {
 	// Both the name and the namespace are mandatory:
 	if reference.Name == "" {
-		err = fmt.Errorf("The name of the secret is mandatory, but it hasn't been specified")
+		err = &SecretLoadError{
+			SecretRef: reference,
+			Cause:     fmt.Errorf("The name of the secret is mandatory, but it hasn't been specified"),
+		}
 		return
 	}
 	if reference.Namespace == "" {
-		err = fmt.Errorf("The namespace of the secret is mandatory, but it hasn't been specified")
+		err = &SecretLoadError{
+			SecretRef: reference,
+			Cause:     fmt.Errorf("The namespace of the secret is mandatory, but it hasn't been specified"),
+		}
 		return
 	}
 
 	// Check that we have a client to use the Kubernetes API:
 	if a.client == nil {
-		err = fmt.Errorf(
-			"Can't load secret '%s' from namespace '%s' because there is no connection to the Kubernetes API",
-			reference.Name,
-			reference.Namespace,
-		)
+		err = &SecretLoadError{
+			SecretRef: reference,
+			Cause:     fmt.Errorf("There is no connection to the Kubernetes API"),
+		}
 		return
 	}
 
@@ -251,12 +457,10 @@ func (a *AWXConfig) loadSecret(reference *core.SecretReference) (secret *core.Se
 	resource := a.client.CoreV1().Secrets(reference.Namespace)
 	secret, err = resource.Get(reference.Name, meta.GetOptions{})
 	if err != nil {
-		err = fmt.Errorf(
-			"Can't load secret '%s' from namespace '%s': %s",
-			reference.Name,
-			reference.Namespace,
-			err,
-		)
+		err = &SecretLoadError{
+			SecretRef: reference,
+			Cause:     err,
+		}
 		return
 	}
 
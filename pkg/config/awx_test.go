@@ -0,0 +1,209 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	goerrors "errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+func TestAWXToken(t *testing.T) {
+	cfg, err := buildConfig(t, `
+awx:
+  address: https://my-awx.example.com/api
+  token: my-token
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWX().Token() != "my-token" {
+		t.Errorf("Expected token 'my-token', but got '%s'", cfg.AWX().Token())
+	}
+}
+
+func TestAWXTokenFromSecret(t *testing.T) {
+	secrets := map[string]map[string][]byte{
+		"my-namespace/my-token": {
+			"token": []byte("my-token"),
+		},
+	}
+	cfg, err := buildSecretsConfig(t, secrets, `
+awx:
+  address: https://my-awx.example.com/api
+  tokenRef:
+    namespace: my-namespace
+    name: my-token
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWX().Token() != "my-token" {
+		t.Errorf("Expected token 'my-token', but got '%s'", cfg.AWX().Token())
+	}
+}
+
+func TestAWXTokenMergedWithCredentialsSecret(t *testing.T) {
+	secrets := map[string]map[string][]byte{
+		"my-namespace/my-credentials": {
+			"username": []byte("my-user"),
+			"password": []byte("my-password"),
+		},
+		"my-namespace/my-token": {
+			"token": []byte("my-token"),
+		},
+	}
+	cfg, err := buildSecretsConfig(t, secrets,
+		`
+awx:
+  address: https://my-awx.example.com/api
+  credentialsRef:
+    namespace: my-namespace
+    name: my-credentials
+`,
+		`
+awx:
+  tokenRef:
+    namespace: my-namespace
+    name: my-token
+`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	awx := cfg.AWX()
+	if awx.User() != "my-user" || awx.Password() != "my-password" {
+		t.Errorf("Expected credentials 'my-user' and 'my-password', but got '%s' and '%s'", awx.User(), awx.Password())
+	}
+	if awx.Token() != "my-token" {
+		t.Errorf("Expected token 'my-token', but got '%s'", awx.Token())
+	}
+}
+
+func TestAWXTokenSecretOverridesToken(t *testing.T) {
+	secrets := map[string]map[string][]byte{
+		"my-namespace/my-token": {
+			"token": []byte("secret-token"),
+		},
+	}
+	cfg, err := buildSecretsConfig(t, secrets, `
+awx:
+  address: https://my-awx.example.com/api
+  token: inline-token
+  tokenRef:
+    namespace: my-namespace
+    name: my-token
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWX().Token() != "secret-token" {
+		t.Errorf("Expected token 'secret-token', but got '%s'", cfg.AWX().Token())
+	}
+}
+
+func TestAWXMissingTokenSecret(t *testing.T) {
+	_, err := buildSecretsConfig(t, map[string]map[string][]byte{}, `
+awx:
+  address: https://my-awx.example.com/api
+  tokenRef:
+    namespace: my-namespace
+    name: my-token
+`)
+	var secretErr *SecretLoadError
+	if !goerrors.As(err, &secretErr) {
+		t.Fatalf("Expected a SecretLoadError, but got '%v'", err)
+	}
+	if secretErr.SecretRef.Name != "my-token" {
+		t.Errorf("Expected reference to secret 'my-token', but got %+v", secretErr.SecretRef)
+	}
+}
+
+// buildSecretsConfig is like buildConfig, but uses a Kubernetes client that contains the given
+// secrets, indexed by namespace and name separated by a slash.
+//
+func buildSecretsConfig(t *testing.T, secrets map[string]map[string][]byte,
+	contents ...string) (*Config, error) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	builder := NewBuilder().Client(&fakeSecretsClient{secrets: secrets})
+	for i, content := range contents {
+		file := filepath.Join(dir, fmt.Sprintf("%d.yml", i))
+		err = ioutil.WriteFile(file, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder.File(file)
+	}
+	return builder.Build()
+}
+
+// fakeSecretsClient is a Kubernetes client that only implements the parts of the API used to read
+// secrets. Calling any other method will panic.
+//
+type fakeSecretsClient struct {
+	kubernetes.Interface
+	secrets map[string]map[string][]byte
+}
+
+func (c *fakeSecretsClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeSecretsCoreV1{secrets: c.secrets}
+}
+
+type fakeSecretsCoreV1 struct {
+	corev1.CoreV1Interface
+	secrets map[string]map[string][]byte
+}
+
+func (c *fakeSecretsCoreV1) Secrets(namespace string) corev1.SecretInterface {
+	return &fakeSecrets{
+		secrets:   c.secrets,
+		namespace: namespace,
+	}
+}
+
+type fakeSecrets struct {
+	corev1.SecretInterface
+	secrets   map[string]map[string][]byte
+	namespace string
+}
+
+func (c *fakeSecrets) Get(name string, options meta.GetOptions) (*core.Secret, error) {
+	data, ok := c.secrets[c.namespace+"/"+name]
+	if !ok {
+		return nil, errors.NewNotFound(core.Resource("secrets"), name)
+	}
+	return &core.Secret{
+		ObjectMeta: meta.ObjectMeta{
+			Namespace: c.namespace,
+			Name:      name,
+		},
+		Data: data,
+	}, nil
+}
@@ -20,6 +20,7 @@ package config
 
 import (
 	"bytes"
+	"fmt"
 	"sync"
 	"time"
 
@@ -40,9 +41,17 @@ type Builder struct {
 	// The names of the configuration files, in the order that they should be loaded:
 	files []string
 
+	// The config maps that contain configuration files, loaded after the files, and how often they
+	// are reloaded:
+	configMaps     []configMapRef
+	resyncInterval time.Duration
+
 	// The codec that will be used to convert the rules specified in the configuration file into the
 	// types used internally.
 	codec runtime.Codec
+
+	// Whether the Build method has already been called:
+	built bool
 }
 
 // NewBuilder creates an empty configuration loader.
@@ -57,6 +66,9 @@ func NewBuilder() *Builder {
 	v1alpha2.AddToScheme(scheme)
 	b.codec = serializer.NewCodecFactory(scheme).LegacyCodec()
 
+	// Reload the config maps with the same interval used by the informers:
+	b.resyncInterval = 5 * time.Minute
+
 	return b
 }
 
@@ -88,28 +100,68 @@ func (b *Builder) Files(files []string) *Builder {
 	return b
 }
 
-// Build loads the configuration files and returns the resulting configuration object.
+// ConfigMap adds the given config map to the set of config maps that will be loaded. Each key of
+// the config map whose name ends in .yml or .yaml is loaded as a configuration file, in
+// alphabetical order. The config maps are loaded after the configuration files, and they require
+// the Kubernetes client.
+//
+func (b *Builder) ConfigMap(namespace, name string) *Builder {
+	b.configMaps = append(b.configMaps, configMapRef{
+		namespace: namespace,
+		name:      name,
+	})
+	return b
+}
+
+// ResyncInterval sets how often the config maps are reloaded to pick up changes. The default is
+// five minutes.
+//
+func (b *Builder) ResyncInterval(interval time.Duration) *Builder {
+	b.resyncInterval = interval
+	return b
+}
+
+// Clone creates a new builder with the same settings than this one, that can be modified and built
+// even if this one has already been built.
+//
+func (b *Builder) Clone() *Builder {
+	clone := &Builder{
+		client:         b.client,
+		codec:          b.codec,
+		resyncInterval: b.resyncInterval,
+	}
+	clone.files = make([]string, len(b.files))
+	copy(clone.files, b.files)
+	clone.configMaps = make([]configMapRef, len(b.configMaps))
+	copy(clone.configMaps, b.configMaps)
+	return clone
+}
+
+// Build loads the configuration files and returns the resulting configuration object. It can only
+// be called once, as each configuration object watches the files for changes. To create another
+// configuration object with the same settings use the Clone method.
 //
 func (b *Builder) Build() (c *Config, err error) {
-	// Create an default configuration:
-	c = &Config{
-		awx: &AWXConfig{
-			ca: new(bytes.Buffer),
-			jobStatusCheckInterval: 5 * time.Minute,
-			client:                 b.client,
-		},
-		throttling: &ThrottlingConfig{
-			interval: 1 * time.Hour,
-		},
-		rules: &RulesConfig{
-			codec: b.codec,
-		},
-		listener:      &eventListener{},
-		files:         b.files,
-		loadMutex:     &sync.Mutex{},
-		listenerMutex: &sync.Mutex{},
+	// Check that the builder hasn't already been used:
+	if b.built {
+		err = fmt.Errorf("config builder has already been built; create a new builder instead")
+		return
+	}
+	b.built = true
+	if len(b.configMaps) > 0 && b.resyncInterval <= 0 {
+		err = fmt.Errorf("Resync interval %s isn't valid, it must be positive", b.resyncInterval)
+		return
 	}
 
+	// Create an default configuration:
+	c = newConfig(b.client, b.codec)
+	c.listener = &eventListener{}
+	c.files = b.files
+	c.loadMutex = &sync.Mutex{}
+	c.listenerMutex = &sync.Mutex{}
+	c.configMaps = b.configMaps
+	c.resyncInterval = b.resyncInterval
+
 	// Do the initial load of the configuration files:
 	err = c.load()
 	if err != nil {
@@ -124,3 +176,36 @@ func (b *Builder) Build() (c *Config, err error) {
 
 	return
 }
+
+// newConfig creates a configuration object that contains the default values, and that uses the
+// given Kubernetes client and codec to load the configuration.
+//
+func newConfig(client kubernetes.Interface, codec runtime.Codec) *Config {
+	return &Config{
+		awx: &AWXConfig{
+			ca:                     new(bytes.Buffer),
+			jobStatusCheckInterval: 5 * time.Minute,
+			templateCacheTTL:       5 * time.Minute,
+			maxJobAge:              24 * time.Hour,
+			failureThreshold:       5,
+			resetTimeout:           time.Minute,
+			client:                 client,
+		},
+		servers: &ServersConfig{
+			mutex: &sync.Mutex{},
+		},
+		throttling: &ThrottlingConfig{
+			interval: 1 * time.Hour,
+		},
+		correlation: &CorrelationConfig{
+			ttl: 10 * time.Minute,
+		},
+		runtime: &RuntimeConfig{},
+		rules: &RulesConfig{
+			codec:      codec,
+			rulesMutex: &sync.Mutex{},
+		},
+		stateMutex: &sync.RWMutex{},
+		client:     client,
+	}
+}
@@ -18,8 +18,10 @@ package config
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -36,7 +38,10 @@ func TestFiles(t *testing.T) {
 
 	data0 := `
       awx:
-        address: "http://test_address.com"`
+        address: "http://test_address.com"
+        credentials:
+          username: "my-user"
+          password: "my-password"`
 
 	data1 := `
       awx:
@@ -64,10 +69,16 @@ func TestFiles(t *testing.T) {
 
 	expected := &Config{
 		awx: &AWXConfig{
-			address: "http://test_address.com",
-			proxy:   "http://test-proxy.com:1234",
+			address:                "http://test_address.com",
+			proxy:                  "http://test-proxy.com:1234",
+			user:                   "my-user",
+			password:               "my-password",
 			jobStatusCheckInterval: 5 * time.Minute,
-			ca: new(bytes.Buffer),
+			templateCacheTTL:       time.Duration(5) * time.Minute,
+			maxJobAge:              time.Duration(24) * time.Hour,
+			failureThreshold:       5,
+			resetTimeout:           time.Minute,
+			ca:                     new(bytes.Buffer),
 		},
 		throttling: &ThrottlingConfig{
 			interval: 1 * time.Hour,
@@ -108,7 +119,11 @@ func TestLoadFile(t *testing.T) {
 			expected: &Config{
 				awx: &AWXConfig{
 					jobStatusCheckInterval: time.Duration(5) * time.Minute,
-					ca: new(bytes.Buffer),
+					templateCacheTTL:       time.Duration(5) * time.Minute,
+					maxJobAge:              time.Duration(24) * time.Hour,
+					failureThreshold:       5,
+					resetTimeout:           time.Minute,
+					ca:                     new(bytes.Buffer),
 				},
 				throttling: &ThrottlingConfig{
 					interval: time.Duration(1) * time.Hour,
@@ -121,6 +136,9 @@ func TestLoadFile(t *testing.T) {
                awx:
                  address: https://my-awx.example.com/api
                  proxy: http://my-proxy.example.com:3128
+                 credentials:
+                   username: my-user
+                   password: my-password
                rules:
                - metadata:
                    name: start-node
@@ -130,10 +148,16 @@ func TestLoadFile(t *testing.T) {
                    template: "Start node"`,
 			expected: &Config{
 				awx: &AWXConfig{
-					address: "https://my-awx.example.com/api",
-					proxy:   "http://my-proxy.example.com:3128",
+					address:                "https://my-awx.example.com/api",
+					proxy:                  "http://my-proxy.example.com:3128",
+					user:                   "my-user",
+					password:               "my-password",
 					jobStatusCheckInterval: time.Duration(5) * time.Minute,
-					ca: new(bytes.Buffer),
+					templateCacheTTL:       time.Duration(5) * time.Minute,
+					maxJobAge:              time.Duration(24) * time.Hour,
+					failureThreshold:       5,
+					resetTimeout:           time.Minute,
+					ca:                     new(bytes.Buffer),
 				},
 				throttling: &ThrottlingConfig{
 					interval: time.Duration(1) * time.Hour,
@@ -160,6 +184,9 @@ func TestLoadFile(t *testing.T) {
                awx:
                  address: https://my-awx.example.com/api
                  proxy: http://my-proxy.example.com:3128
+                 credentials:
+                   username: my-user
+                   password: my-password
                  project: "Test Project"
                  jobStatusCheckInterval: 3m
                throttling:
@@ -175,9 +202,15 @@ func TestLoadFile(t *testing.T) {
 				awx: &AWXConfig{
 					address:                "https://my-awx.example.com/api",
 					proxy:                  "http://my-proxy.example.com:3128",
+					user:                   "my-user",
+					password:               "my-password",
 					project:                "Test Project",
 					jobStatusCheckInterval: time.Duration(3) * time.Minute,
-					ca: new(bytes.Buffer),
+					templateCacheTTL:       time.Duration(5) * time.Minute,
+					maxJobAge:              time.Duration(24) * time.Hour,
+					failureThreshold:       5,
+					resetTimeout:           time.Minute,
+					ca:                     new(bytes.Buffer),
 				},
 				throttling: &ThrottlingConfig{
 					interval: time.Duration(1) * time.Hour,
@@ -204,6 +237,9 @@ func TestLoadFile(t *testing.T) {
              awx:
                address: https://my-awx.example.com/api
                proxy: http://my-proxy.example.com:3128
+               credentials:
+                 username: my-user
+                 password: my-password
                project: "Test Project"
                jobStatusCheckInterval: 3m
              throttling:
@@ -240,9 +276,15 @@ func TestLoadFile(t *testing.T) {
 				awx: &AWXConfig{
 					address:                "https://my-awx.example.com/api",
 					proxy:                  "http://my-proxy.example.com:3128",
+					user:                   "my-user",
+					password:               "my-password",
 					project:                "Test Project",
 					jobStatusCheckInterval: time.Duration(3) * time.Minute,
-					ca: new(bytes.Buffer),
+					templateCacheTTL:       time.Duration(5) * time.Minute,
+					maxJobAge:              time.Duration(24) * time.Hour,
+					failureThreshold:       5,
+					resetTimeout:           time.Minute,
+					ca:                     new(bytes.Buffer),
 				},
 				throttling: &ThrottlingConfig{
 					interval: time.Duration(1) * time.Hour,
@@ -304,7 +346,7 @@ func TestLoadFile(t *testing.T) {
 	for _, test := range configsTest {
 		func() {
 			file.WriteAt([]byte(test.configString), 0)
-			cfg, err := l.Build()
+			cfg, err := l.Clone().Build()
 			if err != nil {
 				t.Errorf("An error occured! %s", err)
 			}
@@ -340,6 +382,9 @@ func TestLoadDir(t *testing.T) {
       awx:
         address: https://my-awx.example.com/api
         proxy: http://my-proxy.example.com:3128
+        credentials:
+          username: my-user
+          password: my-password
       rules:
       - metadata:
           name: start-node
@@ -350,10 +395,16 @@ func TestLoadDir(t *testing.T) {
 
 	expected := &Config{
 		awx: &AWXConfig{
-			address: "https://my-awx.example.com/api",
-			proxy:   "http://my-proxy.example.com:3128",
+			address:                "https://my-awx.example.com/api",
+			proxy:                  "http://my-proxy.example.com:3128",
+			user:                   "my-user",
+			password:               "my-password",
 			jobStatusCheckInterval: time.Duration(5) * time.Minute,
-			ca: new(bytes.Buffer),
+			templateCacheTTL:       time.Duration(5) * time.Minute,
+			maxJobAge:              time.Duration(24) * time.Hour,
+			failureThreshold:       5,
+			resetTimeout:           time.Minute,
+			ca:                     new(bytes.Buffer),
 		},
 		throttling: &ThrottlingConfig{
 			interval: time.Duration(1) * time.Hour,
@@ -398,3 +449,168 @@ func TestLoadDir(t *testing.T) {
 		t.Errorf("Expected %+v but got %+v", expected.rules.rules, cfg.rules.rules)
 	}
 }
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	dir := filepath.Join("..", "..", "testdata", "broken-config")
+	cfg, err := NewBuilder().
+		File(dir).
+		Build()
+	if err == nil {
+		defer cfg.ShutDown()
+		t.Fatalf("Expected an error but got nil")
+	}
+
+	// Both broken files should be reported, but not the good one:
+	message := err.Error()
+	for _, name := range []string{"b-bad-yaml.yml", "c-bad-rule.yml"} {
+		if !strings.Contains(message, name) {
+			t.Errorf("Expected error message to mention file '%s', but it is '%s'", name, message)
+		}
+	}
+	if strings.Contains(message, "a-good.yml") {
+		t.Errorf("Expected error message to not mention file 'a-good.yml', but it is '%s'", message)
+	}
+
+	// The configuration is rolled back when it has errors, so neither the good file nor the
+	// good rule that follows the broken one should have been applied:
+	if cfg.AWX().Address() != "" {
+		t.Errorf("Expected the AWX address to not be loaded, but got '%s'", cfg.AWX().Address())
+	}
+	rules := cfg.Rules()
+	if len(rules) != 0 {
+		t.Errorf("Expected no rule to be loaded, but got %+v", rules)
+	}
+}
+
+func TestLoadDirWithLongLines(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "temp_dir")
+	defer os.RemoveAll(dir)
+
+	// A line longer than the default limit of the scanner:
+	project := strings.Repeat("a", 100*1024)
+	content := fmt.Sprintf("awx:\n  project: \"%s\"\n", project)
+	ioutil.WriteFile(filepath.Join(dir, "00-awx.yml"), []byte(content), 0600)
+
+	cfg, err := NewBuilder().
+		File(dir).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	if cfg.AWX().Project() != project {
+		t.Errorf("Expected project of %d characters, but got %d", len(project), len(cfg.AWX().Project()))
+	}
+}
+
+func TestLoadDirWithAnchors(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "temp_dir")
+	defer os.RemoveAll(dir)
+
+	defaults := `
+      ---
+      # The anchors defined here are used in the rules file.
+      awx:
+        address: https://my-awx.example.com/api
+        credentials:
+          username: my-user
+          password: my-password
+        project: &project "Auto-heal"
+      defaults:
+        extraVars: &extraVars
+          environment: production
+          project: *project`
+
+	rules := `
+      rules:
+      - metadata:
+          name: start-node
+        labels:
+          alertname: "NodeDown"
+        awxJob:
+          template: "Start node"
+          extraVars: *extraVars`
+
+	ioutil.WriteFile(filepath.Join(dir, "00-defaults.yml"), []byte(defaults), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "10-rules.yml"), []byte(rules), 0600)
+
+	cfg, err := NewBuilder().
+		File(dir).
+		Build()
+	if err != nil {
+		t.Fatalf("An error occured! %s", err)
+	}
+	defer cfg.ShutDown()
+
+	if cfg.AWX().Project() != "Auto-heal" {
+		t.Errorf("Expected project 'Auto-heal' but got '%s'", cfg.AWX().Project())
+	}
+
+	expected := []*autoheal.HealingRule{
+		{
+			ObjectMeta: meta.ObjectMeta{
+				Name: "start-node",
+			},
+			Labels: map[string]string{
+				"alertname": "NodeDown",
+			},
+			AWXJob: &autoheal.AWXJobAction{
+				Template: "Start node",
+				ExtraVars: autoheal.JsonDoc{
+					"environment": "production",
+					"project":     "Auto-heal",
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(cfg.Rules(), expected) {
+		t.Errorf("Expected %+v but got %+v", expected, cfg.Rules())
+	}
+}
+
+func TestBuildTwiceFails(t *testing.T) {
+	builder := NewBuilder().
+		File(filepath.Join("..", "..", "testdata", "empty-config.yml"))
+	cfg, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	_, err = builder.Build()
+	if err == nil {
+		t.Fatalf("Expected an error when building twice")
+	}
+	if !strings.Contains(err.Error(), "already been built") {
+		t.Errorf("Expected error to mention that the builder was already built, but got '%s'", err)
+	}
+}
+
+func TestCloneCanBeBuilt(t *testing.T) {
+	builder := NewBuilder().
+		File(filepath.Join("..", "..", "testdata", "empty-config.yml"))
+	cfg, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	// The clone can be modified without affecting the original builder:
+	clone := builder.Clone().
+		File(filepath.Join("..", "..", "testdata", "rules-config.yml"))
+	if len(builder.files) != 1 {
+		t.Errorf("Expected the original builder to have 1 file, but it has %d", len(builder.files))
+	}
+	if clone.codec != builder.codec {
+		t.Errorf("Expected the clone to use the same codec")
+	}
+	cloned, err := clone.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cloned.ShutDown()
+	if len(cloned.Rules()) != 2 {
+		t.Errorf("Expected 2 rules, but got %d", len(cloned.Rules()))
+	}
+}
@@ -26,27 +26,68 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
-	"github.com/yaacov/observer/observer"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
 	"github.com/openshift/autoheal/pkg/internal/data"
+	"github.com/openshift/autoheal/pkg/metrics"
 )
 
+// sectionsMutex protects the values of the sections of the configuration, like the AWX or the
+// throttling sections. The sections are replaced in place when the configuration is reloaded, as
+// other components keep references to them, so their accessors need to take this lock. It is a
+// single lock for all the sections, instead of one per section, so that the values of the sections
+// can also be created directly, for example in tests.
+//
+var sectionsMutex sync.RWMutex
+
 // Config is a read only view of the configuration of the auto-heal service.
 //
 type Config struct {
-	awx        *AWXConfig
-	throttling *ThrottlingConfig
-	rules      *RulesConfig
-	listener   *eventListener
+	awx         *AWXConfig
+	servers     *ServersConfig
+	throttling  *ThrottlingConfig
+	correlation *CorrelationConfig
+	runtime     *RuntimeConfig
+	rules       *RulesConfig
+	listener    *eventListener
+
+	// The labels of the namespaces that the service will handle:
+	scopeToNamespaceLabels map[string]string
+
+	// The address of the alert manager used to check if alerts are silenced:
+	silenceCheckURL string
+
+	// Protects the labels and the address above, which are replaced when the configuration is
+	// loaded:
+	stateMutex *sync.RWMutex
+
+	// The copy of the last configuration loaded successfully, used to calculate what changed when it
+	// is reloaded:
+	lastLoaded *snapshot
 
 	// The names of the configuration files, in the order that they should be loaded:
 	files         []string
 	loadMutex     *sync.Mutex
 	listenerMutex *sync.Mutex
+
+	// The resolved patterns of the files included by the configuration files during the last load,
+	// and the ones that are already watched:
+	includes []string
+	watched  map[string]bool
+
+	// The config maps that contain configuration files, loaded after the files, and how often
+	// they are reloaded to pick up changes. The channel is closed to stop the reloads.
+	configMaps     []configMapRef
+	resyncInterval time.Duration
+	stopCh         chan struct{}
+
+	// The Kubernetes client used to load the config maps:
+	client kubernetes.Interface
 }
 
 // AWX returns a read only view of the section of the configuration of the auto-heal service that
@@ -56,6 +97,13 @@ func (c *Config) AWX() *AWXConfig {
 	return c.awx
 }
 
+// Servers returns a read only view of the section of the configuration that describes the
+// additional AWX servers that the AWX jobs of the healing rules can use instead of the default one.
+//
+func (c *Config) Servers() *ServersConfig {
+	return c.servers
+}
+
 // Throttling returns a read only view of the section of the configuration that describes how to
 // throttle the execution of healing rules.
 //
@@ -63,15 +111,54 @@ func (c *Config) Throttling() *ThrottlingConfig {
 	return c.throttling
 }
 
+// Correlation returns a read only view of the section of the configuration that describes how to
+// correlate alerts that affect the same entity.
+//
+func (c *Config) Correlation() *CorrelationConfig {
+	return c.correlation
+}
+
+// Runtime returns a read only view of the section of the configuration that describes the
+// environment where the healing actions run.
+//
+func (c *Config) Runtime() *RuntimeConfig {
+	return c.runtime
+}
+
+// ScopeToNamespaceLabels returns the labels of the namespaces that the auto-heal service should
+// handle. Alerts whose namespace label refers to a namespace that doesn't have these labels should
+// be discarded. An empty map means that all the namespaces are handled.
+//
+func (c *Config) ScopeToNamespaceLabels() map[string]string {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.scopeToNamespaceLabels
+}
+
+// SilenceCheckURL returns the address of the alert manager that should be queried to check if
+// alerts are silenced before processing them. An empty string means that alerts aren't checked.
+//
+func (c *Config) SilenceCheckURL() string {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.silenceCheckURL
+}
+
 // Rules returns the list of healing rules defined in the configuration.
 //
 func (c *Config) Rules() []*autoheal.HealingRule {
+	c.rules.init()
+	c.rules.rulesMutex.Lock()
+	defer c.rules.rulesMutex.Unlock()
 	return c.rules.rules
 }
 
 // ShutDown close the change obeserver channels
 //
 func (c *Config) ShutDown() {
+	if c.stopCh != nil {
+		close(c.stopCh)
+	}
 	c.listener.shutDown()
 }
 
@@ -87,6 +174,11 @@ func (c *Config) watch() error {
 	e := c.listener
 	e.open()
 
+	// Remember the configuration that was loaded, so that the changes can be calculated when it is
+	// reloaded. Failed reloads don't replace it, so the changes are always relative to the last
+	// configuration that was loaded successfully:
+	c.lastLoaded = c.snapshot()
+
 	// Start watching config files for modifications.
 	configFiles := c.configFiles()
 	err := e.configFilesChangedObserver.Watch(configFiles)
@@ -96,72 +188,211 @@ func (c *Config) watch() error {
 	for _, file := range configFiles {
 		glog.Infof("Watching configuration file '%s'", file)
 	}
+	err = c.watchIncludes()
+	if err != nil {
+		return err
+	}
 
 	// Load new configuration when config files change.
 	e.configFilesChangedObserver.AddListener(func(_ interface{}) {
-		// This listener function call the load and continue assuming
-		// no other loading can be called, so we need to avoid
-		// running it simultaneously from multiple goroutines:
-		c.listenerMutex.Lock()
-		defer c.listenerMutex.Unlock()
-
-		// Reload the configuration files:
 		glog.Infof("Configuration files have changed")
-		err := c.load()
-		if err != nil {
-			glog.Errorf("Can't reload configuration files: %s", err)
-			return
-		}
-
-		// If config files loaded succesfully emit config object changed event.
-		e.configFilesLoadedObserver.Emit(observer.WatchEvent{Name: "Config loaded"})
+		c.reload(true)
 	})
 
+	// The config maps aren't watched, instead the configuration is reloaded periodically:
+	if len(c.configMaps) > 0 {
+		for _, ref := range c.configMaps {
+			glog.Infof(
+				"Reloading configuration config map '%s' every %s",
+				ref, c.resyncInterval,
+			)
+		}
+		c.stopCh = make(chan struct{})
+		go c.runConfigMapsResync(c.stopCh)
+	}
+
 	return err
 }
 
+// watchIncludes starts watching the files included by the configuration files that aren't watched
+// yet. Patterns that are no longer included are still watched, so changes to those files trigger
+// reloads that don't change anything.
+//
+func (c *Config) watchIncludes() error {
+	if c.watched == nil {
+		c.watched = make(map[string]bool)
+	}
+	var patterns []string
+	for _, pattern := range c.includes {
+		if !c.watched[pattern] {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	err := c.listener.configFilesChangedObserver.Watch(patterns)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		c.watched[pattern] = true
+		glog.Infof("Watching included configuration file '%s'", pattern)
+	}
+	return nil
+}
+
+// reload loads the configuration again and notifies the listeners of the changes. When force is
+// false the listeners are only notified if the rules, the AWX, the throttling or the namespace scope
+// configuration changed.
+//
+func (c *Config) reload(force bool) {
+	// This function calls the load and continues assuming no other loading can be called, so we
+	// need to avoid running it simultaneously from multiple goroutines:
+	c.listenerMutex.Lock()
+	defer c.listenerMutex.Unlock()
+
+	// Reload the configuration:
+	start := time.Now()
+	err := c.load()
+	if err != nil {
+		glog.Errorf("Can't reload configuration: %s", err)
+		metrics.RulesReloaded(time.Since(start), err)
+		return
+	}
+
+	// Start watching the files that have been added to the includes:
+	err = c.watchIncludes()
+	if err != nil {
+		glog.Errorf("Can't watch included configuration files: %s", err)
+	}
+
+	// If the configuration loaded successfully emit the config object changed event, describing
+	// what changed:
+	event := c.diff(c.lastLoaded)
+	c.lastLoaded = c.snapshot()
+	if force || event.RulesChanged() || event.AWXChanged || event.ThrottlingChanged ||
+		event.ScopeChanged {
+		c.listener.configFilesLoadedObserver.Emit(event)
+	}
+}
+
 // load the configuration files and returns an error on fail.
 //
 func (c *Config) load() (err error) {
-	// Loading the configuration modifies the members of the structure in place, so we need to avoid
-	// running it simultaneously from multiple goroutines:
+	// Loading the configuration replaces the members of the structure, so we need to avoid running
+	// it simultaneously from multiple goroutines:
 	c.loadMutex.Lock()
 	defer c.loadMutex.Unlock()
 
-	// Always clean rules before loading new ones
-	c.rules.clear()
+	// Load the configuration into a new object that starts with the default values, so that the
+	// current configuration isn't modified if the load fails, and so that removing sections from
+	// the files takes effect:
+	fresh := newConfig(c.client, c.rules.codec)
+	fresh.files = c.files
+	fresh.configMaps = c.configMaps
+	loaded, err := fresh.loadSources()
+	if err != nil {
+		return
+	}
+	c.apply(fresh)
 
-	// Merge the contents of the files into the empty configuration:
+	// Update the metrics only when the load succeeds, so that they describe the configuration
+	// that is actually in use:
+	metrics.ConfigLoaded(loaded, len(c.Rules()))
+
+	return
+}
+
+// loadSources merges the configuration files and config maps into this configuration, and checks
+// the result. It returns the number of files loaded.
+//
+func (c *Config) loadSources() (loaded int, err error) {
+	// Merge the contents of the files into the empty configuration. Errors don't stop the loading
+	// of the rest of the files, instead they are collected and returned together, so that the user
+	// can fix all of them at once:
+	var errs []error
 	for _, file := range c.files {
-		var info os.FileInfo
-		info, err = os.Stat(file)
-		if err != nil {
-			err = fmt.Errorf("Can't check if '%s' is a file or a directory: %s", file, err)
-			return
+		info, statErr := os.Stat(file)
+		if os.IsNotExist(statErr) {
+			errs = append(errs, &ConfigFileNotFoundError{Path: file})
+			continue
+		}
+		if statErr != nil {
+			errs = append(errs, fmt.Errorf("Can't check if '%s' is a file or a directory: %s", file, statErr))
+			continue
 		}
 		if info.IsDir() {
-			err = c.mergeDir(file)
-			if err != nil {
-				err = fmt.Errorf("Can't load configuration directory '%s': %s", file, err)
-				return
-			}
+			dirLoaded, dirErrs := c.mergeDir(file)
+			loaded += dirLoaded
+			errs = append(errs, dirErrs...)
 		} else {
-			err = c.mergeFile(file)
-			if err != nil {
-				err = fmt.Errorf("Can't load configuration file '%s': %s", file, err)
-				return
+			mergeErr := c.mergeFile(file, nil)
+			if mergeErr != nil {
+				errs = append(errs, fmt.Errorf("Can't load configuration file '%s': %w", file, mergeErr))
+			} else {
+				loaded++
 			}
 		}
 	}
 
+	// Merge the contents of the config maps, after the files, so that they take precedence:
+	for _, ref := range c.configMaps {
+		configMapLoaded, configMapErrs := c.mergeConfigMap(ref)
+		loaded += configMapLoaded
+		errs = append(errs, configMapErrs...)
+	}
+
+	// Check the consistency of the configuration only when all the files have been loaded, as the
+	// sections that depend on each other may come from different files:
+	if len(errs) == 0 {
+		errs = c.check()
+	}
+	if len(errs) == 0 {
+		err = c.Validate()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err = newAggregate(errs)
 	return
 }
 
-func (c *Config) mergeDir(dir string) error {
+// apply replaces the current configuration with the given one, which has been loaded and checked.
+// The objects are modified in place, as other components may keep references to them, holding the
+// locks that their accessors use. It must be called while holding the load mutex.
+//
+func (c *Config) apply(fresh *Config) {
+	sectionsMutex.Lock()
+	*c.awx = *fresh.awx
+	*c.throttling = *fresh.throttling
+	*c.correlation = *fresh.correlation
+	*c.runtime = *fresh.runtime
+	sectionsMutex.Unlock()
+	c.servers.mutex.Lock()
+	c.servers.servers = fresh.servers.servers
+	c.servers.decoded = fresh.servers.decoded
+	c.servers.mutex.Unlock()
+	c.rules.init()
+	c.rules.rulesMutex.Lock()
+	c.rules.rules = fresh.rules.rules
+	c.rules.rulesMutex.Unlock()
+	c.stateMutex.Lock()
+	c.scopeToNamespaceLabels = fresh.scopeToNamespaceLabels
+	c.silenceCheckURL = fresh.silenceCheckURL
+	c.stateMutex.Unlock()
+	c.includes = fresh.includes
+}
+
+// mergeDir loads the configuration files of the given directory. It returns the number of files
+// that were loaded successfully, and the errors for the ones that couldn't be loaded.
+//
+func (c *Config) mergeDir(dir string) (loaded int, errs []error) {
 	// List the files in the directory:
 	infos, err := ioutil.ReadDir(dir)
 	if err != nil {
-		return err
+		errs = append(errs, fmt.Errorf("Can't load configuration directory '%s': %s", dir, err))
+		return
 	}
 	files := make([]string, 0, len(infos))
 	for _, info := range infos {
@@ -174,25 +405,74 @@ func (c *Config) mergeDir(dir string) error {
 		}
 	}
 
-	// Load the files in alphabetical order:
+	// Load the files in alphabetical order. First try to load all of them combined in a single YAML
+	// document, so that anchors defined in one file can be used in the others. If that fails then
+	// load them one by one, so that the errors reported point to the file that caused them:
 	sort.Strings(files)
-	for _, file := range files {
-		err := c.mergeFile(file)
+	decoded, err := c.decodeDir(files)
+	if err != nil {
+		glog.Warningf(
+			"Can't load the files of configuration directory '%s' together, will load "+
+				"them one by one: %s",
+			dir, err,
+		)
+		for _, file := range files {
+			err := c.mergeFile(file, nil)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Can't load configuration file '%s': %w", file, err))
+				continue
+			}
+			loaded++
+		}
+		return
+	}
+	for i, file := range files {
+		glog.Infof("Loading configuration file '%s'", file)
+		err := c.mergeIncludesAndDecoded(file, &decoded[i], nil)
 		if err != nil {
-			return err
+			errs = append(errs, fmt.Errorf("Can't load configuration file '%s': %w", file, err))
+			continue
 		}
+		loaded++
 	}
 
-	return nil
+	return
 }
 
-func (c *Config) mergeFile(file string) error {
+// decodeDir parses the given files as a single YAML document, and returns the configuration data
+// of each of them, in the same order.
+//
+func (c *Config) decodeDir(files []string) (decoded []data.Config, err error) {
+	var content []byte
+	content, err = concatenateFiles(files)
+	if err != nil {
+		return
+	}
+	err = yaml.Unmarshal(content, &decoded)
+	if err != nil {
+		return
+	}
+	if len(decoded) != len(files) {
+		err = fmt.Errorf("Expected %d configuration files but got %d", len(files), len(decoded))
+		return
+	}
+	return
+}
+
+// mergeFile loads the given configuration file, and the files that it includes. The chain contains
+// the absolute names of the files that are being loaded because they include this one, and is used
+// to detect cycles.
+//
+func (c *Config) mergeFile(file string, chain []string) error {
 	var err error
 
 	// Read the content of the file:
 	glog.Infof("Loading configuration file '%s'", file)
 	var content []byte
 	content, err = ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &ConfigFileNotFoundError{Path: file}
+	}
 	if err != nil {
 		return err
 	}
@@ -204,27 +484,136 @@ func (c *Config) mergeFile(file string) error {
 		return err
 	}
 
-	// Merge the configuration data from the file with the existing configuration:
+	return c.mergeIncludesAndDecoded(file, &decoded, chain)
+}
+
+// mergeIncludesAndDecoded loads the files included by the given file, and then merges the rest of
+// the configuration data of the file, so that it takes precedence over the included files.
+//
+func (c *Config) mergeIncludesAndDecoded(file string, decoded *data.Config, chain []string) error {
+	if len(decoded.Include) > 0 {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		for _, included := range chain {
+			if included == path {
+				cycle := make([]string, len(chain), len(chain)+1)
+				copy(cycle, chain)
+				return &IncludeCycleError{Chain: append(cycle, path)}
+			}
+		}
+		chain = append(chain[:len(chain):len(chain)], path)
+		err = c.mergeIncludes(file, decoded.Include, chain)
+		if err != nil {
+			return err
+		}
+	}
+	return c.mergeDecoded(decoded)
+}
+
+// mergeIncludes loads the files that match the include patterns of the given file. Files that match
+// the same pattern are loaded in alphabetical order.
+//
+func (c *Config) mergeIncludes(file string, includes []string, chain []string) error {
+	var errs []error
+	for _, include := range includes {
+		pattern := include
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+		c.includes = append(c.includes, pattern)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Can't resolve include '%s': %s", include, err))
+			continue
+		}
+
+		// A pattern that doesn't match any file is fine, but a plain file name must exist:
+		if len(matches) == 0 && !strings.ContainsAny(include, "*?[") {
+			errs = append(errs, &ConfigFileNotFoundError{Path: pattern})
+			continue
+		}
+
+		for _, match := range matches {
+			err = c.mergeFile(match, chain)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Can't load included configuration file '%s': %w", match, err))
+			}
+		}
+	}
+	return newAggregate(errs)
+}
+
+// mergeDecoded merges the configuration data loaded from a file with the existing configuration.
+//
+func (c *Config) mergeDecoded(decoded *data.Config) error {
+	var err error
+
+	// Merge the configuration data with the existing configuration, collecting the errors of all
+	// the sections:
+	var errs []error
 	if decoded.AWX != nil {
 		err = c.awx.merge(decoded.AWX)
 		if err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
+	if decoded.Servers != nil {
+		c.servers.merge(decoded.Servers)
+	}
 	if decoded.Throttling != nil {
 		err = c.throttling.merge(decoded.Throttling)
 		if err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
+	if decoded.Correlation != nil {
+		err = c.correlation.merge(decoded.Correlation)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if decoded.Runtime != nil {
+		err = c.runtime.merge(decoded.Runtime)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if decoded.ScopeToNamespaceLabels != nil {
+		c.scopeToNamespaceLabels = decoded.ScopeToNamespaceLabels
+	}
+	if decoded.AWXSilenceCheckURL != "" {
+		c.silenceCheckURL = decoded.AWXSilenceCheckURL
+	}
 	if decoded.Rules != nil {
 		err = c.rules.merge(decoded.Rules)
 		if err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	return newAggregate(errs)
+}
+
+// check verifies the consistency of the merged configuration, and returns the list of problems
+// found.
+//
+func (c *Config) check() (errs []error) {
+	err := c.awx.check()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	err = c.servers.build(c.awx)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+	err = c.rules.check(c.awx, c.servers)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return
 }
 
 func (c *Config) configFiles() (files []string) {
@@ -0,0 +1,114 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to load the configuration from Kubernetes config maps.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/internal/data"
+)
+
+// configMapRef identifies a config map that contains configuration files.
+//
+type configMapRef struct {
+	namespace string
+	name      string
+}
+
+func (r configMapRef) String() string {
+	return fmt.Sprintf("%s/%s", r.namespace, r.name)
+}
+
+// mergeConfigMap loads the configuration files stored in the given config map, one for each key
+// whose name ends in .yml or .yaml, in alphabetical order of key. It returns the number of files
+// that were loaded successfully, and the errors for the ones that couldn't be loaded.
+//
+func (c *Config) mergeConfigMap(ref configMapRef) (loaded int, errs []error) {
+	if c.client == nil {
+		errs = append(errs, fmt.Errorf(
+			"Can't load configuration config map '%s' because there is no connection to "+
+				"the Kubernetes API",
+			ref,
+		))
+		return
+	}
+	configMap, err := c.client.CoreV1().ConfigMaps(ref.namespace).Get(ref.name, meta.GetOptions{})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Can't load configuration config map '%s': %s", ref, err))
+		return
+	}
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		if strings.HasSuffix(key, ".yml") || strings.HasSuffix(key, ".yaml") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		glog.Infof("Loading configuration file '%s' from config map '%s'", key, ref)
+		err = c.mergeConfigMapKey(configMap.Data[key])
+		if err != nil {
+			errs = append(errs, fmt.Errorf(
+				"Can't load configuration file '%s' from config map '%s': %w",
+				key, ref, err,
+			))
+			continue
+		}
+		loaded++
+	}
+	return
+}
+
+// mergeConfigMapKey merges the content of one of the keys of a config map. Includes aren't
+// supported, as there is no directory that relative file names could refer to.
+//
+func (c *Config) mergeConfigMapKey(content string) error {
+	var decoded data.Config
+	err := yaml.Unmarshal([]byte(content), &decoded)
+	if err != nil {
+		return err
+	}
+	if len(decoded.Include) > 0 {
+		return fmt.Errorf("Includes aren't supported in configuration files stored in config maps")
+	}
+	return c.mergeDecoded(&decoded)
+}
+
+// runConfigMapsResync periodically reloads the configuration, so that changes in the config maps
+// are applied without restarting the service, till the given channel is closed.
+//
+func (c *Config) runConfigMapsResync(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(c.resyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			c.reload(false)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+func TestLoadRulesFromConfigMap(t *testing.T) {
+	configMaps := newFakeConfigMaps()
+	configMaps.set("my-namespace", "my-rules", map[string]string{
+		"b.yml": `
+rules:
+- metadata:
+    name: from-b
+  plugin:
+    type: heal
+  labels:
+    alertname: "NodeDown"
+`,
+		"a.yaml": `
+rules:
+- metadata:
+    name: from-a
+  plugin:
+    type: heal
+  labels:
+    alertname: "NodeDown"
+`,
+		"README": "This isn't a configuration file.",
+	})
+	cfg, err := NewBuilder().
+		Client(&fakeConfigMapsClient{configMaps: configMaps}).
+		ConfigMap("my-namespace", "my-rules").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	// The keys should have been loaded in alphabetical order:
+	rules := cfg.Rules()
+	if len(rules) != 2 {
+		t.Fatalf("Expected two rules, but got %d", len(rules))
+	}
+	if rules[0].ObjectMeta.Name != "from-a" || rules[1].ObjectMeta.Name != "from-b" {
+		t.Errorf(
+			"Expected rules 'from-a' and 'from-b', but got '%s' and '%s'",
+			rules[0].ObjectMeta.Name, rules[1].ObjectMeta.Name,
+		)
+	}
+}
+
+func TestConfigMapLoadedAfterFiles(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"file.yml": `
+throttling:
+  interval: 10m
+`,
+	})
+	configMaps := newFakeConfigMaps()
+	configMaps.set("my-namespace", "my-config", map[string]string{
+		"throttling.yml": `
+throttling:
+  interval: 20m
+`,
+	})
+	cfg, err := NewBuilder().
+		Client(&fakeConfigMapsClient{configMaps: configMaps}).
+		File(dir).
+		ConfigMap("my-namespace", "my-config").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	if cfg.Throttling().Interval() != 20*time.Minute {
+		t.Errorf("Expected the config map to take precedence, but got %s", cfg.Throttling().Interval())
+	}
+}
+
+func TestConfigMapRequiresClient(t *testing.T) {
+	_, err := NewBuilder().
+		ConfigMap("my-namespace", "my-rules").
+		Build()
+	if err == nil {
+		t.Fatalf("Expected an error loading a config map without a Kubernetes client")
+	}
+}
+
+func TestMissingConfigMapFails(t *testing.T) {
+	_, err := NewBuilder().
+		Client(&fakeConfigMapsClient{configMaps: newFakeConfigMaps()}).
+		ConfigMap("my-namespace", "my-rules").
+		Build()
+	if err == nil {
+		t.Fatalf("Expected an error loading a config map that doesn't exist")
+	}
+	if !strings.Contains(err.Error(), "my-namespace/my-rules") {
+		t.Errorf("Expected the error to mention the config map, but got '%s'", err)
+	}
+}
+
+func TestConfigMapRejectsIncludes(t *testing.T) {
+	configMaps := newFakeConfigMaps()
+	configMaps.set("my-namespace", "my-rules", map[string]string{
+		"rules.yml": `
+include:
+- other.yml
+`,
+	})
+	_, err := NewBuilder().
+		Client(&fakeConfigMapsClient{configMaps: configMaps}).
+		ConfigMap("my-namespace", "my-rules").
+		Build()
+	if err == nil {
+		t.Fatalf("Expected an error loading a config map that includes other files")
+	}
+}
+
+func TestConfigMapChangesAreReloaded(t *testing.T) {
+	configMaps := newFakeConfigMaps()
+	configMaps.set("my-namespace", "my-rules", map[string]string{
+		"rules.yml": `
+rules:
+- metadata:
+    name: first
+  plugin:
+    type: heal
+`,
+	})
+	cfg, err := NewBuilder().
+		Client(&fakeConfigMapsClient{configMaps: configMaps}).
+		ConfigMap("my-namespace", "my-rules").
+		ResyncInterval(10 * time.Millisecond).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	events := make(chan *ChangeEvent, 10)
+	cfg.AddChangeListener(func(event *ChangeEvent) {
+		events <- event
+	})
+
+	// Change the rules inside the config map, and wait for the change event:
+	configMaps.set("my-namespace", "my-rules", map[string]string{
+		"rules.yml": `
+rules:
+- metadata:
+    name: second
+  plugin:
+    type: heal
+`,
+	})
+	select {
+	case event := <-events:
+		if len(event.AddedRules) != 1 || event.AddedRules[0].ObjectMeta.Name != "second" {
+			t.Errorf("Expected rule 'second' to be added, but got %+v", event.AddedRules)
+		}
+		if len(event.RemovedRules) != 1 || event.RemovedRules[0].ObjectMeta.Name != "first" {
+			t.Errorf("Expected rule 'first' to be removed, but got %+v", event.RemovedRules)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a change event after modifying the config map")
+	}
+}
+
+func TestUnchangedConfigMapDoesntNotify(t *testing.T) {
+	configMaps := newFakeConfigMaps()
+	configMaps.set("my-namespace", "my-rules", map[string]string{
+		"rules.yml": `
+rules:
+- metadata:
+    name: first
+  plugin:
+    type: heal
+`,
+	})
+	cfg, err := NewBuilder().
+		Client(&fakeConfigMapsClient{configMaps: configMaps}).
+		ConfigMap("my-namespace", "my-rules").
+		ResyncInterval(10 * time.Millisecond).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	events := make(chan *ChangeEvent, 10)
+	cfg.AddChangeListener(func(event *ChangeEvent) {
+		events <- event
+	})
+
+	// Wait till the config map has been reloaded several times:
+	for configMaps.count() < 5 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Expected no change event, but got %+v", event)
+	default:
+	}
+}
+
+// fakeConfigMapsClient is a Kubernetes client that only implements the parts of the API used to
+// read config maps. Calling any other method will panic.
+//
+type fakeConfigMapsClient struct {
+	kubernetes.Interface
+	configMaps *fakeConfigMaps
+}
+
+func (c *fakeConfigMapsClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeCoreV1{configMaps: c.configMaps}
+}
+
+type fakeCoreV1 struct {
+	corev1.CoreV1Interface
+	configMaps *fakeConfigMaps
+}
+
+func (c *fakeCoreV1) ConfigMaps(namespace string) corev1.ConfigMapInterface {
+	return &fakeNamespacedConfigMaps{
+		configMaps: c.configMaps,
+		namespace:  namespace,
+	}
+}
+
+// fakeConfigMaps keeps the data of the config maps in memory, indexed by namespace and name, and
+// counts how many times they have been retrieved. It can be safely used from multiple goroutines.
+//
+type fakeConfigMaps struct {
+	items map[string]map[string]string
+	gets  int
+	mutex *sync.Mutex
+}
+
+func newFakeConfigMaps() *fakeConfigMaps {
+	return &fakeConfigMaps{
+		items: make(map[string]map[string]string),
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (c *fakeConfigMaps) set(namespace, name string, data map[string]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.items[namespace+"/"+name] = data
+}
+
+func (c *fakeConfigMaps) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.gets
+}
+
+type fakeNamespacedConfigMaps struct {
+	corev1.ConfigMapInterface
+	configMaps *fakeConfigMaps
+	namespace  string
+}
+
+func (c *fakeNamespacedConfigMaps) Get(name string, options meta.GetOptions) (*core.ConfigMap, error) {
+	c.configMaps.mutex.Lock()
+	defer c.configMaps.mutex.Unlock()
+	c.configMaps.gets++
+	data, ok := c.configMaps.items[c.namespace+"/"+name]
+	if !ok {
+		return nil, errors.NewNotFound(core.Resource("configmaps"), name)
+	}
+	return &core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{
+			Namespace: c.namespace,
+			Name:      name,
+		},
+		Data: data,
+	}, nil
+}
@@ -0,0 +1,753 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift/autoheal/pkg/metrics"
+)
+
+func TestLoadUpdatesMetrics(t *testing.T) {
+	metrics.InitExportedMetrics()
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	// Create a configuration directory with two files:
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeRuleFile(t, dir, "a.yml", "first-rule")
+	writeRuleFile(t, dir, "b.yml", "second-rule")
+
+	start := time.Now().Unix()
+	cfg, err := NewBuilder().
+		File(dir).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMetric(t, server.URL, "autoheal_config_files_loaded", 2)
+	checkMetric(t, server.URL, "autoheal_rules_loaded_total", 2)
+
+	// Add a file and reload:
+	writeRuleFile(t, dir, "c.yml", "third-rule")
+	err = cfg.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMetric(t, server.URL, "autoheal_config_files_loaded", 3)
+	checkMetric(t, server.URL, "autoheal_rules_loaded_total", 3)
+	stamp := scrapeMetric(t, server.URL, "autoheal_config_last_reload_timestamp_seconds")
+	if stamp < float64(start) {
+		t.Errorf("Expected last reload time to be at least %d but it is %f", start, stamp)
+	}
+}
+
+func TestAWXAddressRequiresCredentials(t *testing.T) {
+	_, err := buildConfig(t, `
+awx:
+  address: https://my-awx.example.com/api
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	if !strings.Contains(err.Error(), "user name or the password are missing") {
+		t.Errorf("Expected error about missing credentials, but got '%s'", err)
+	}
+}
+
+func TestAWXAddressRequiresPassword(t *testing.T) {
+	_, err := buildConfig(t, `
+awx:
+  address: https://my-awx.example.com/api
+  credentials:
+    username: my-user
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	if !strings.Contains(err.Error(), "user name or the password are missing") {
+		t.Errorf("Expected error about missing credentials, but got '%s'", err)
+	}
+}
+
+func TestAWXMaxConcurrentJobs(t *testing.T) {
+	cfg, err := buildConfig(t, `
+awx:
+  maxConcurrentJobs: 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWX().MaxConcurrentJobs() != 10 {
+		t.Errorf("Expected maximum of 10 concurrent jobs, but got %d", cfg.AWX().MaxConcurrentJobs())
+	}
+}
+
+func TestAWXMaxConcurrentJobsCantBeNegative(t *testing.T) {
+	_, err := buildConfig(t, `
+awx:
+  maxConcurrentJobs: -1
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	if !strings.Contains(err.Error(), "can't be negative") {
+		t.Errorf("Expected error about negative maximum, but got '%s'", err)
+	}
+}
+
+func TestAWXRetries(t *testing.T) {
+	cfg, err := buildConfig(t, `
+awx:
+  maxRetries: 3
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWX().MaxRetries() != 3 {
+		t.Errorf("Expected 3 retries, but got %d", cfg.AWX().MaxRetries())
+	}
+}
+
+func TestAWXRetriesDefaults(t *testing.T) {
+	cfg, err := buildConfig(t, `
+awx:
+  project: "My project"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWX().MaxRetries() != 0 {
+		t.Errorf("Expected no retries by default, but got %d", cfg.AWX().MaxRetries())
+	}
+}
+
+func TestAWXMaxRetriesCantBeNegative(t *testing.T) {
+	_, err := buildConfig(t, `
+awx:
+  maxRetries: -1
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	if !strings.Contains(err.Error(), "can't be negative") {
+		t.Errorf("Expected error about negative retries, but got '%s'", err)
+	}
+}
+
+func TestAWXCircuitBreaker(t *testing.T) {
+	cfg, err := buildConfig(t, `
+awx:
+  failureThreshold: 3
+  resetTimeout: 2m
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWX().FailureThreshold() != 3 {
+		t.Errorf("Expected failure threshold 3, but got %d", cfg.AWX().FailureThreshold())
+	}
+	if cfg.AWX().ResetTimeout() != 2*time.Minute {
+		t.Errorf("Expected reset timeout of 2m, but got %s", cfg.AWX().ResetTimeout())
+	}
+}
+
+func TestAWXCircuitBreakerDefaults(t *testing.T) {
+	cfg, err := buildConfig(t, `
+awx:
+  project: "My project"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AWX().FailureThreshold() != 5 {
+		t.Errorf("Expected default failure threshold 5, but got %d", cfg.AWX().FailureThreshold())
+	}
+	if cfg.AWX().ResetTimeout() != time.Minute {
+		t.Errorf("Expected default reset timeout of 1m, but got %s", cfg.AWX().ResetTimeout())
+	}
+}
+
+func TestAWXFailureThresholdMustBePositive(t *testing.T) {
+	_, err := buildConfig(t, `
+awx:
+  failureThreshold: -1
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	if !strings.Contains(err.Error(), "must be positive") {
+		t.Errorf("Expected error about the failure threshold, but got '%s'", err)
+	}
+}
+
+func TestRuntimeImageMirror(t *testing.T) {
+	cfg, err := buildConfig(t, `
+runtime:
+  imageMirror: registry.example.com/mirror/
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Runtime().ImageMirror() != "registry.example.com/mirror" {
+		t.Errorf("Expected image mirror 'registry.example.com/mirror', but got '%s'", cfg.Runtime().ImageMirror())
+	}
+}
+
+func TestAWXJobRequiresAddress(t *testing.T) {
+	_, err := buildConfig(t, `
+rules:
+- metadata:
+    name: start-node
+  awxJob:
+    template: "Start node"
+`)
+	var parseErr *RuleParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected a RuleParseError, but got '%v'", err)
+	}
+	if parseErr.RuleName != "start-node" {
+		t.Errorf("Expected rule name 'start-node', but got '%s'", parseErr.RuleName)
+	}
+}
+
+func TestAWXAddressLoadedAfterRules(t *testing.T) {
+	cfg, err := buildConfig(
+		t,
+		`
+rules:
+- metadata:
+    name: start-node
+  awxJob:
+    template: "Start node"
+`,
+		`
+awx:
+  address: https://my-awx.example.com/api
+  credentials:
+    username: my-user
+    password: my-password
+`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	if len(cfg.Rules()) != 1 {
+		t.Errorf("Expected one rule, but got %d", len(cfg.Rules()))
+	}
+}
+
+func TestRecursiveIncludes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"main.yml": `
+include:
+- rules/first.yml
+rules:
+- metadata:
+    name: main-rule
+  plugin:
+    type: heal
+`,
+		"rules/first.yml": `
+include:
+- second.yml
+rules:
+- metadata:
+    name: first-rule
+  plugin:
+    type: heal
+`,
+		"rules/second.yml": `
+rules:
+- metadata:
+    name: second-rule
+  plugin:
+    type: heal
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := NewBuilder().
+		File(filepath.Join(dir, "main.yml")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	// The included files are loaded before the file that includes them:
+	checkRuleNames(t, cfg, "second-rule", "first-rule", "main-rule")
+}
+
+func TestIncludeGlobMatchesMultipleFiles(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"main.yml": `
+include:
+- ./rules/disk*.yml
+- ./rules/nodedown.yml
+`,
+		"rules/disk-full.yml": `
+rules:
+- metadata:
+    name: disk-full
+  plugin:
+    type: heal
+`,
+		"rules/disk-slow.yml": `
+rules:
+- metadata:
+    name: disk-slow
+  plugin:
+    type: heal
+`,
+		"rules/nodedown.yml": `
+rules:
+- metadata:
+    name: node-down
+  plugin:
+    type: heal
+`,
+		"rules/other.yml": `
+rules:
+- metadata:
+    name: other
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := NewBuilder().
+		File(filepath.Join(dir, "main.yml")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	checkRuleNames(t, cfg, "disk-full", "disk-slow", "node-down")
+}
+
+func TestIncludedFilesAreWatched(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"main.yml": `
+include:
+- ./rules/*.yml
+`,
+		"rules/first.yml": `
+rules:
+- metadata:
+    name: first
+  plugin:
+    type: heal
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := NewBuilder().
+		File(filepath.Join(dir, "main.yml")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	events := make(chan *ChangeEvent, 10)
+	cfg.AddChangeListener(func(event *ChangeEvent) {
+		events <- event
+	})
+
+	// Add a new file matching the included pattern, and wait for the change event:
+	err = ioutil.WriteFile(filepath.Join(dir, "rules", "second.yml"), []byte(`
+rules:
+- metadata:
+    name: second
+  plugin:
+    type: heal
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		if len(event.AddedRules) != 1 || event.AddedRules[0].ObjectMeta.Name != "second" {
+			t.Errorf("Expected rule 'second' to be added, but got %+v", event.AddedRules)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a change event after adding an included file")
+	}
+}
+
+func TestIncludeMissingFile(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"main.yml": `
+include:
+- missing.yml
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := NewBuilder().
+		File(filepath.Join(dir, "main.yml")).
+		Build()
+	var notFoundErr *ConfigFileNotFoundError
+	if !errors.As(err, &notFoundErr) {
+		t.Fatalf("Expected a ConfigFileNotFoundError, but got '%v'", err)
+	}
+}
+
+func TestCircularIncludeDetected(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"a.yml": `
+include:
+- b.yml
+`,
+		"b.yml": `
+include:
+- c.yml
+`,
+		"c.yml": `
+include:
+- a.yml
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := NewBuilder().
+		File(filepath.Join(dir, "a.yml")).
+		Build()
+	var cycleErr *IncludeCycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("Expected an IncludeCycleError, but got '%v'", err)
+	}
+	expected := []string{"a.yml", "b.yml", "c.yml", "a.yml"}
+	if len(cycleErr.Chain) != len(expected) {
+		t.Fatalf("Expected chain %v, but got %v", expected, cycleErr.Chain)
+	}
+	for i, name := range expected {
+		if filepath.Base(cycleErr.Chain[i]) != name {
+			t.Errorf("Expected chain %v, but got %v", expected, cycleErr.Chain)
+			break
+		}
+	}
+}
+
+func TestCircularIncludeInDirectoryDetected(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"conf.d/a.yml": `
+include:
+- ../other/b.yml
+`,
+		"other/b.yml": `
+include:
+- ../conf.d/a.yml
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := NewBuilder().
+		File(filepath.Join(dir, "conf.d")).
+		Build()
+	var cycleErr *IncludeCycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("Expected an IncludeCycleError, but got '%v'", err)
+	}
+}
+
+func TestChangeEventContainsAddedRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeRuleFile(t, dir, "a.yml", "first-rule")
+	cfg, err := NewBuilder().
+		File(dir).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	before := cfg.snapshot()
+	writeRuleFile(t, dir, "b.yml", "second-rule")
+	writeRuleFile(t, dir, "c.yml", "third-rule")
+	err = cfg.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := cfg.diff(before)
+
+	names := make([]string, len(event.AddedRules))
+	for i, rule := range event.AddedRules {
+		names[i] = rule.ObjectMeta.Name
+	}
+	if strings.Join(names, ",") != "second-rule,third-rule" {
+		t.Errorf("Expected added rules 'second-rule' and 'third-rule', but got %v", names)
+	}
+	if len(event.RemovedRules) != 0 || len(event.ModifiedRules) != 0 {
+		t.Errorf("Expected no removed or modified rules, but got %+v", event)
+	}
+	if event.AWXChanged || event.ThrottlingChanged {
+		t.Errorf("Expected the AWX and throttling sections to not change")
+	}
+}
+
+func TestChangeEventContainsRemovedAndModifiedRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeRuleFile(t, dir, "a.yml", "first-rule")
+	writeRuleFile(t, dir, "b.yml", "second-rule")
+	cfg, err := NewBuilder().
+		File(dir).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	before := cfg.snapshot()
+	err = os.Remove(filepath.Join(dir, "a.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "rules:\n- metadata:\n    name: second-rule\n  labels:\n    alertname: NodeDown\n  plugin:\n    type: heal\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "b.yml"), []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := cfg.diff(before)
+
+	if len(event.AddedRules) != 0 {
+		t.Errorf("Expected no added rules, but got %d", len(event.AddedRules))
+	}
+	if len(event.RemovedRules) != 1 || event.RemovedRules[0].ObjectMeta.Name != "first-rule" {
+		t.Errorf("Expected removed rule 'first-rule', but got %+v", event.RemovedRules)
+	}
+	if len(event.ModifiedRules) != 1 || event.ModifiedRules[0].ObjectMeta.Name != "second-rule" {
+		t.Errorf("Expected modified rule 'second-rule', but got %+v", event.ModifiedRules)
+	}
+	if !event.RulesChanged() {
+		t.Errorf("Expected the event to report that the rules changed")
+	}
+}
+
+func TestChangeEventDetectsSectionChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yml")
+	err = ioutil.WriteFile(file, []byte("throttling:\n  interval: 1h\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewBuilder().
+		File(file).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	before := cfg.snapshot()
+	content := `
+throttling:
+  interval: 2h
+awx:
+  address: https://my-awx.example.com/api
+  credentials:
+    username: my-user
+    password: my-password
+`
+	err = ioutil.WriteFile(file, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := cfg.diff(before)
+
+	if !event.AWXChanged {
+		t.Errorf("Expected the AWX section to change")
+	}
+	if !event.ThrottlingChanged {
+		t.Errorf("Expected the throttling section to change")
+	}
+	if event.RulesChanged() {
+		t.Errorf("Expected the rules to not change")
+	}
+}
+
+func TestChangeEventDetectsRemovedNamespaceScope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yml")
+	err = ioutil.WriteFile(file, []byte("scopeToNamespaceLabels:\n  autoheal: enabled\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewBuilder().
+		File(file).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	before := cfg.snapshot()
+	err = ioutil.WriteFile(file, []byte("throttling:\n  interval: 1h\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := cfg.diff(before)
+
+	if !event.ScopeChanged {
+		t.Errorf("Expected the namespace scope to change")
+	}
+	if len(cfg.ScopeToNamespaceLabels()) != 0 {
+		t.Errorf(
+			"Expected the namespace labels to be removed, but got %v",
+			cfg.ScopeToNamespaceLabels(),
+		)
+	}
+}
+
+// buildConfig writes each of the given contents to a configuration file, and loads them in the same
+// order.
+//
+func buildConfig(t *testing.T, contents ...string) (*Config, error) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	builder := NewBuilder()
+	for i, content := range contents {
+		file := filepath.Join(dir, fmt.Sprintf("%d.yml", i))
+		err = ioutil.WriteFile(file, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder.File(file)
+	}
+	return builder.Build()
+}
+
+// writeConfigFiles creates a temporary directory containing the given files, indexed by their
+// name relative to that directory, and returns its name. The caller is responsible for removing it.
+//
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(file), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(file, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func checkRuleNames(t *testing.T, cfg *Config, expected ...string) {
+	rules := cfg.Rules()
+	actual := make([]string, len(rules))
+	for i, rule := range rules {
+		actual[i] = rule.ObjectMeta.Name
+	}
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected rules %v, but got %v", expected, actual)
+	}
+}
+
+func writeRuleFile(t *testing.T, dir, name, rule string) {
+	content := "rules:\n- metadata:\n    name: " + rule + "\n  plugin:\n    type: heal\n"
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkMetric(t *testing.T, url, name string, expected float64) {
+	actual := scrapeMetric(t, url, name)
+	if actual != expected {
+		t.Errorf("Expected metric '%s' to be %f but it is %f", name, expected, actual)
+	}
+}
+
+// scrapeMetric retrieves the metrics from the given URL, and returns the value of the one with the
+// given name.
+//
+func scrapeMetric(t *testing.T, url, name string) float64 {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == name {
+			value, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return value
+		}
+	}
+	t.Fatalf("Can't find metric '%s'", name)
+	return 0
+}
@@ -0,0 +1,52 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config contains types and functions used to load the service configuration.
+//
+package config
+
+import (
+	"time"
+
+	"github.com/openshift/autoheal/pkg/internal/data"
+)
+
+// CorrelationConfig is a read only view of the section of the configuration that describes how to
+// correlate alerts that affect the same entity.
+//
+type CorrelationConfig struct {
+	ttl time.Duration
+}
+
+// TTL returns how long the healer remembers that a rule has started healing an entity. During that
+// time other rules that correlate alerts using the same labels won't be executed for that entity.
+//
+func (c *CorrelationConfig) TTL() time.Duration {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return c.ttl
+}
+
+func (c *CorrelationConfig) merge(decoded *data.CorrelationConfig) error {
+	if decoded.TTL != "" {
+		ttl, err := time.ParseDuration(decoded.TTL)
+		if err != nil {
+			return err
+		}
+		c.ttl = ttl
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to calculate the differences between the configuration
+// before and after reloading it.
+
+package config
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// snapshot contains a copy of the parts of the configuration that are compared to find what
+// changed when it is reloaded.
+//
+type snapshot struct {
+	awx        AWXConfig
+	ca         []byte
+	servers    map[string]*AWXConfig
+	throttling ThrottlingConfig
+	rules      []*autoheal.HealingRule
+	scope      map[string]string
+}
+
+// snapshot copies the parts of the configuration that are needed to calculate the differences with
+// the configuration loaded later.
+//
+func (c *Config) snapshot() *snapshot {
+	s := new(snapshot)
+	sectionsMutex.RLock()
+	s.awx = *c.awx
+	s.throttling = *c.throttling
+	if c.awx.ca != nil {
+		s.ca = append([]byte(nil), c.awx.ca.Bytes()...)
+	}
+	sectionsMutex.RUnlock()
+	s.awx.ca = nil
+	c.servers.mutex.Lock()
+	s.servers = c.servers.servers
+	c.servers.mutex.Unlock()
+	s.rules = c.Rules()
+	s.scope = c.ScopeToNamespaceLabels()
+	return s
+}
+
+// diff calculates the changes between the given snapshot and the current configuration.
+//
+func (c *Config) diff(before *snapshot) *ChangeEvent {
+	after := c.snapshot()
+	event := &ChangeEvent{}
+
+	// Compare the rules using their names, as that is what identifies them:
+	oldRules := make(map[string]*autoheal.HealingRule, len(before.rules))
+	for _, rule := range before.rules {
+		oldRules[rule.ObjectMeta.Name] = rule
+	}
+	newRules := make(map[string]bool, len(after.rules))
+	for _, rule := range after.rules {
+		name := rule.ObjectMeta.Name
+		newRules[name] = true
+		old, ok := oldRules[name]
+		switch {
+		case !ok:
+			event.AddedRules = append(event.AddedRules, rule)
+		case !reflect.DeepEqual(old, rule):
+			event.ModifiedRules = append(event.ModifiedRules, rule)
+		}
+	}
+	for _, rule := range before.rules {
+		if !newRules[rule.ObjectMeta.Name] {
+			event.RemovedRules = append(event.RemovedRules, rule)
+		}
+	}
+
+	// Compare the rest of the sections:
+	event.AWXChanged = !reflect.DeepEqual(before.awx, after.awx) || !bytes.Equal(before.ca, after.ca) ||
+		!reflect.DeepEqual(before.servers, after.servers)
+	event.ThrottlingChanged = before.throttling != after.throttling
+	event.ScopeChanged = !reflect.DeepEqual(before.scope, after.scope)
+
+	return event
+}
@@ -0,0 +1,141 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	goerrors "errors"
+	"fmt"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ConfigFileNotFoundError is the error returned when a configuration file or directory doesn't
+// exist.
+//
+type ConfigFileNotFoundError struct {
+	// Path is the name of the file or directory that doesn't exist.
+	Path string
+}
+
+func (e *ConfigFileNotFoundError) Error() string {
+	return fmt.Sprintf("Configuration file '%s' doesn't exist", e.Path)
+}
+
+// IncludeCycleError is the error returned when configuration files include each other, directly or
+// indirectly.
+//
+type IncludeCycleError struct {
+	// Chain contains the names of the files that form the cycle, starting and ending with the same
+	// file.
+	Chain []string
+}
+
+func (e *IncludeCycleError) Error() string {
+	return fmt.Sprintf("Configuration files include each other: %s", strings.Join(e.Chain, " -> "))
+}
+
+// RuleParseError is the error returned when a healing rule can't be loaded.
+//
+type RuleParseError struct {
+	// RuleName is the name of the rule, if it could be determined.
+	RuleName string
+
+	// Cause is the error that prevented loading the rule.
+	Cause error
+}
+
+func (e *RuleParseError) Error() string {
+	if e.RuleName == "" {
+		return fmt.Sprintf("Can't parse rule: %s", e.Cause)
+	}
+	return fmt.Sprintf("Can't parse rule '%s': %s", e.RuleName, e.Cause)
+}
+
+// Unwrap returns the error that prevented loading the rule.
+//
+func (e *RuleParseError) Unwrap() error {
+	return e.Cause
+}
+
+// SecretLoadError is the error returned when a secret referenced from the configuration can't be
+// loaded.
+//
+type SecretLoadError struct {
+	// SecretRef is the reference to the secret, as it appears in the configuration.
+	SecretRef *core.SecretReference
+
+	// Cause is the error that prevented loading the secret.
+	Cause error
+}
+
+func (e *SecretLoadError) Error() string {
+	return fmt.Sprintf(
+		"Can't load secret '%s' from namespace '%s': %s",
+		e.SecretRef.Name,
+		e.SecretRef.Namespace,
+		e.Cause,
+	)
+}
+
+// Unwrap returns the error that prevented loading the secret.
+//
+func (e *SecretLoadError) Unwrap() error {
+	return e.Cause
+}
+
+// aggregateError is an aggregate of errors that can be inspected with the errors.Is and errors.As
+// functions of the standard library, which check each of the errors that it contains.
+//
+type aggregateError struct {
+	errors.Aggregate
+}
+
+// Is checks if any of the errors contained in the aggregate matches the given target.
+//
+func (e aggregateError) Is(target error) bool {
+	for _, err := range e.Errors() {
+		if goerrors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors contained in the aggregate that matches the given target, and
+// if there is one sets the target to that error.
+//
+func (e aggregateError) As(target interface{}) bool {
+	for _, err := range e.Errors() {
+		if goerrors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// newAggregate creates an aggregate containing the given list of errors. It returns nil if the
+// list is empty.
+//
+func newAggregate(errs []error) error {
+	aggregate := errors.NewAggregate(errs)
+	if aggregate == nil {
+		return nil
+	}
+	return aggregateError{aggregate}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigFileNotFoundError(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "missing.yml")
+	_, err := NewBuilder().
+		File(path).
+		Build()
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	var notFound *ConfigFileNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("Expected a ConfigFileNotFoundError, but got '%s'", err)
+	}
+	if notFound.Path != path {
+		t.Errorf("Expected path '%s', but got '%s'", path, notFound.Path)
+	}
+}
+
+func TestRuleParseError(t *testing.T) {
+	cfg, err := NewBuilder().
+		File(filepath.Join("..", "..", "testdata", "broken-config")).
+		Build()
+	if err == nil {
+		defer cfg.ShutDown()
+		t.Fatalf("Expected an error but got nil")
+	}
+	var parseErr *RuleParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected a RuleParseError, but got '%s'", err)
+	}
+	if parseErr.RuleName != "bad-rule" {
+		t.Errorf("Expected rule name 'bad-rule', but got '%s'", parseErr.RuleName)
+	}
+	if parseErr.Cause == nil {
+		t.Errorf("Expected the cause of the error to be set")
+	}
+}
+
+func TestRuleParseErrorForMissingParent(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: child
+  basedOn: missing
+`)
+	var parseErr *RuleParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected a RuleParseError, but got '%v'", err)
+	}
+	if parseErr.RuleName != "child" {
+		t.Errorf("Expected rule name 'child', but got '%s'", parseErr.RuleName)
+	}
+}
+
+func TestSecretLoadError(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+awx:
+  credentialsRef:
+    namespace: my-namespace
+    name: my-credentials
+`)
+	var secretErr *SecretLoadError
+	if !errors.As(err, &secretErr) {
+		t.Fatalf("Expected a SecretLoadError, but got '%v'", err)
+	}
+	if secretErr.SecretRef == nil || secretErr.SecretRef.Name != "my-credentials" {
+		t.Errorf("Expected reference to secret 'my-credentials', but got %+v", secretErr.SecretRef)
+	}
+
+	// Other error types shouldn't match:
+	var notFound *ConfigFileNotFoundError
+	if errors.As(err, &notFound) {
+		t.Errorf("Didn't expect a ConfigFileNotFoundError")
+	}
+}
+
+func TestAggregateErrorContainsTypedErrors(t *testing.T) {
+	notFound := &ConfigFileNotFoundError{Path: "missing.yml"}
+	err := newAggregate([]error{
+		errors.New("Something else failed"),
+		fmt.Errorf("Can't load configuration file 'missing.yml': %w", notFound),
+	})
+	var found *ConfigFileNotFoundError
+	if !errors.As(err, &found) {
+		t.Fatalf("Expected a ConfigFileNotFoundError, but got '%s'", err)
+	}
+	if found != notFound {
+		t.Errorf("Expected the error contained in the aggregate, but got %v", found)
+	}
+	if !errors.Is(err, notFound) {
+		t.Errorf("Expected the aggregate to match the error that it contains")
+	}
+	var cycle *IncludeCycleError
+	if errors.As(err, &cycle) {
+		t.Errorf("Didn't expect an IncludeCycleError")
+	}
+}
@@ -22,12 +22,32 @@ import (
 	"time"
 
 	"github.com/yaacov/observer/observer"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
 )
 
-// ChangeEvent contains config change event info
+// ChangeEvent describes what changed when the configuration was reloaded.
 //
 type ChangeEvent struct {
-	// Empty
+	// The rules that didn't exist before the reload, the ones that don't exist after the reload,
+	// and the ones that exist before and after but have a different definition. Rules are
+	// identified by their names.
+	AddedRules    []*autoheal.HealingRule
+	RemovedRules  []*autoheal.HealingRule
+	ModifiedRules []*autoheal.HealingRule
+
+	// Whether the AWX and throttling sections of the configuration changed.
+	AWXChanged        bool
+	ThrottlingChanged bool
+
+	// Whether the labels of the namespaces that alerts are scoped to changed.
+	ScopeChanged bool
+}
+
+// RulesChanged checks if any rule has been added, removed or modified.
+//
+func (e *ChangeEvent) RulesChanged() bool {
+	return len(e.AddedRules) > 0 || len(e.RemovedRules) > 0 || len(e.ModifiedRules) > 0
 }
 
 // ChangeListener a listener function that can be called when config event change is triggered.
@@ -45,8 +65,12 @@ type eventListener struct {
 //
 func (e *eventListener) addChangeListener(listener ChangeListener) {
 	// add a new listener to configFilesChangedObserver
-	e.configFilesLoadedObserver.AddListener(func(_ interface{}) {
-		listener(&ChangeEvent{})
+	e.configFilesLoadedObserver.AddListener(func(value interface{}) {
+		event, ok := value.(*ChangeEvent)
+		if !ok {
+			event = &ChangeEvent{}
+		}
+		listener(event)
 	})
 }
 
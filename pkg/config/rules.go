@@ -22,8 +22,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/ghodss/yaml"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/openshift/autoheal/pkg/apis/autoheal"
@@ -45,13 +48,15 @@ type RulesConfig struct {
 }
 
 func (r *RulesConfig) merge(rules []interface{}) error {
-	for _, rule := range rules {
+	// A rule that can't be loaded doesn't prevent loading the rest of the rules:
+	var errs []error
+	for i, rule := range rules {
 		err := r.mergeRule(rule)
 		if err != nil {
-			return err
+			errs = append(errs, fmt.Errorf("Can't load rule %d: %w", i, err))
 		}
 	}
-	return nil
+	return newAggregate(errs)
 }
 
 func (r *RulesConfig) mergeRule(rawRule interface{}) error {
@@ -62,12 +67,25 @@ func (r *RulesConfig) mergeRule(rawRule interface{}) error {
 	r.rulesMutex.Lock()
 	defer r.rulesMutex.Unlock()
 
+	// The extra variables of the AWX job or workflow job may have been written as a string
+	// containing a JSON or YAML document, convert them to the map that the rule type expects:
+	err := normalizeExtraVars(rawRule)
+	if err != nil {
+		return &RuleParseError{
+			RuleName: rawRuleName(rawRule),
+			Cause:    err,
+		}
+	}
+
 	// The rule was originally written in YAML inside the configuration file, but in order to
 	// deserialize it using the Kubernetes API versioning mechanism we need to convert it back to
 	// JSON, as the coded only supports JSON.
 	jsonRule, err := json.Marshal(rawRule)
 	if err != nil {
-		return fmt.Errorf("Can't convert rule to JSON: %s", err)
+		return &RuleParseError{
+			RuleName: rawRuleName(rawRule),
+			Cause:    fmt.Errorf("Can't convert rule to JSON: %s", err),
+		}
 	}
 
 	// Now we can create an empty instance of the type that we expect and try to convert the JSON
@@ -77,13 +95,61 @@ func (r *RulesConfig) mergeRule(rawRule interface{}) error {
 	defaultGVK := v1alpha2.SchemeGroupVersion.WithKind(defaultKind)
 	outRule, _, err := r.codec.Decode(jsonRule, &defaultGVK, inRule)
 	if err != nil {
-		return fmt.Errorf("Can't convert rule JSON to type '%s': %s", defaultKind, err)
+		return &RuleParseError{
+			RuleName: rawRuleName(rawRule),
+			Cause:    fmt.Errorf("Can't convert rule JSON to type '%s': %s", defaultKind, err),
+		}
 	}
 
 	// Check that the resulting object is really the type that we expect:
 	convertedRule, ok := outRule.(*autoheal.HealingRule)
 	if !ok {
-		return fmt.Errorf("Converted rule is of type '%T', but expected '%T'", outRule, inRule)
+		return &RuleParseError{
+			RuleName: rawRuleName(rawRule),
+			Cause:    fmt.Errorf("Converted rule is of type '%T', but expected '%T'", outRule, inRule),
+		}
+	}
+
+	// Inherit the settings of the parent rule:
+	if convertedRule.BasedOn != "" {
+		parent := r.findRule(convertedRule.BasedOn)
+		if parent == nil {
+			return &RuleParseError{
+				RuleName: convertedRule.ObjectMeta.Name,
+				Cause: fmt.Errorf(
+					"It is based on rule '%s', but it doesn't exist or hasn't been loaded yet",
+					convertedRule.BasedOn,
+				),
+			}
+		}
+		inheritRule(convertedRule, parent.DeepCopy())
+	}
+
+	// Check that the rule has exactly one action:
+	err = checkRuleActions(convertedRule)
+	if err != nil {
+		return &RuleParseError{
+			RuleName: convertedRule.ObjectMeta.Name,
+			Cause:    err,
+		}
+	}
+
+	// Check that the conditions are complete:
+	err = checkRuleConditions(convertedRule)
+	if err != nil {
+		return &RuleParseError{
+			RuleName: convertedRule.ObjectMeta.Name,
+			Cause:    err,
+		}
+	}
+
+	// Check that the throttle interval is a valid duration:
+	err = checkRuleThrottleInterval(convertedRule)
+	if err != nil {
+		return &RuleParseError{
+			RuleName: convertedRule.ObjectMeta.Name,
+			Cause:    err,
+		}
 	}
 
 	// Add the rule to the list:
@@ -92,6 +158,322 @@ func (r *RulesConfig) mergeRule(rawRule interface{}) error {
 	return nil
 }
 
+// check verifies that the rules that have an AWX job or an AWX workflow job can be executed with the given AWX
+// configuration, and that the AWX servers that they reference exist. It should be called after
+// merging all the sources, as the AWX configuration may be loaded after the rules.
+//
+func (r *RulesConfig) check(awx *AWXConfig, servers *ServersConfig) error {
+	r.init()
+	r.rulesMutex.Lock()
+	defer r.rulesMutex.Unlock()
+
+	var errs []error
+	for _, rule := range r.rules {
+		if rule.AWXJob != nil && rule.AWXJob.ServerRef != "" {
+			if servers.Server(rule.AWXJob.ServerRef) == nil {
+				errs = append(errs, &RuleParseError{
+					RuleName: rule.ObjectMeta.Name,
+					Cause: fmt.Errorf(
+						"It uses AWX server '%s', but that server isn't configured",
+						rule.AWXJob.ServerRef,
+					),
+				})
+			}
+		} else if rule.AWXJob != nil && awx.address == "" {
+			errs = append(errs, &RuleParseError{
+				RuleName: rule.ObjectMeta.Name,
+				Cause:    fmt.Errorf("It has an AWX job, but the address of the AWX server isn't specified"),
+			})
+		}
+		if rule.WorkflowJob != nil && rule.WorkflowJob.ServerRef != "" {
+			if servers.Server(rule.WorkflowJob.ServerRef) == nil {
+				errs = append(errs, &RuleParseError{
+					RuleName: rule.ObjectMeta.Name,
+					Cause: fmt.Errorf(
+						"It uses AWX server '%s', but that server isn't configured",
+						rule.WorkflowJob.ServerRef,
+					),
+				})
+			}
+		} else if rule.WorkflowJob != nil && awx.address == "" {
+			errs = append(errs, &RuleParseError{
+				RuleName: rule.ObjectMeta.Name,
+				Cause: fmt.Errorf(
+					"It has an AWX workflow job, but the address of the AWX server isn't specified",
+				),
+			})
+		}
+	}
+	return newAggregate(errs)
+}
+
+// CheckRule checks a rule that doesn't come from the configuration files, for example one loaded
+// from the Kubernetes API. It applies the same checks that are applied to the rules loaded from
+// the files, except the ones that need the rest of the configuration, as those rules can't be
+// based on other rules or reference the configured AWX servers.
+//
+func CheckRule(rule *autoheal.HealingRule) error {
+	if rule.BasedOn != "" {
+		return fmt.Errorf(
+			"Rule '%s' is based on rule '%s', but only rules loaded from the configuration "+
+				"files can be based on other rules",
+			rule.ObjectMeta.Name,
+			rule.BasedOn,
+		)
+	}
+	err := checkRuleActions(rule)
+	if err != nil {
+		return err
+	}
+	err = checkRuleConditions(rule)
+	if err != nil {
+		return err
+	}
+	err = checkRuleThrottleInterval(rule)
+	if err != nil {
+		return err
+	}
+	return validateRuleAction(rule)
+}
+
+// normalizeExtraVars checks if the extra variables of the AWX job or workflow job of the given raw
+// rule are a string, and in that case replaces them with the result of parsing it, first as JSON
+// and then as YAML. It returns an error if the string isn't a valid JSON or YAML object.
+//
+func normalizeExtraVars(rawRule interface{}) error {
+	ruleMap, ok := rawRule.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for _, field := range []string{"awxJob", "workflowJob"} {
+		action, ok := ruleMap[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		text, ok := action["extraVars"].(string)
+		if !ok {
+			continue
+		}
+		vars, err := parseExtraVars(text)
+		if err != nil {
+			return err
+		}
+		action["extraVars"] = vars
+	}
+	return nil
+}
+
+// parseExtraVars parses a string containing extra variables, in JSON or YAML format.
+//
+func parseExtraVars(text string) (vars map[string]interface{}, err error) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	err = json.Unmarshal([]byte(text), &vars)
+	if err == nil {
+		return
+	}
+	err = yaml.Unmarshal([]byte(text), &vars)
+	if err != nil {
+		err = fmt.Errorf("Extra variables '%s' aren't a valid JSON or YAML object: %s", text, err)
+	}
+	return
+}
+
+// checkRuleActions checks that the rule doesn't have more than one action, as it would be ambiguous
+// which one should be executed. Rules without actions are rejected later, by the validation of the
+// configuration.
+//
+func checkRuleActions(rule *autoheal.HealingRule) error {
+	var actions []string
+	if rule.AWXJob != nil {
+		actions = append(actions, "awxJob")
+	}
+	if rule.WorkflowJob != nil {
+		actions = append(actions, "workflowJob")
+	}
+	if rule.BatchJob != nil {
+		actions = append(actions, "batchJob")
+	}
+	if rule.Plugin != nil {
+		actions = append(actions, "plugin")
+	}
+	if rule.WebhookJob != nil {
+		actions = append(actions, "webhookJob")
+	}
+	if rule.SlackJob != nil {
+		actions = append(actions, "slackJob")
+	}
+	switch len(actions) {
+	case 0, 1:
+	default:
+		return fmt.Errorf(
+			"Rule '%s' has %s; exactly one must be specified",
+			rule.ObjectMeta.Name,
+			joinActions(actions),
+		)
+	}
+	return nil
+}
+
+// checkRuleConditions checks that the conditions of the rule have the fields that are mandatory.
+//
+func checkRuleConditions(rule *autoheal.HealingRule) error {
+	if rule.Conditions == nil {
+		return nil
+	}
+	if rule.Conditions.Pod != nil && rule.Conditions.Pod.PodSelector == "" {
+		return fmt.Errorf("The pod condition doesn't have a pod selector")
+	}
+	return nil
+}
+
+// checkRuleThrottleInterval checks that the throttle interval of the rule, if any, is a valid
+// duration that isn't negative.
+//
+func checkRuleThrottleInterval(rule *autoheal.HealingRule) error {
+	if rule.ThrottleInterval == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(rule.ThrottleInterval)
+	if err != nil {
+		return fmt.Errorf("The throttle interval '%s' isn't valid: %s", rule.ThrottleInterval, err)
+	}
+	if interval < 0 {
+		return fmt.Errorf("The throttle interval '%s' can't be negative", rule.ThrottleInterval)
+	}
+	return nil
+}
+
+// joinActions generates a human readable list of action names, like 'both awxJob and batchJob' or
+// 'awxJob, batchJob and plugin'.
+//
+func joinActions(actions []string) string {
+	if len(actions) == 2 {
+		return fmt.Sprintf("both %s and %s", actions[0], actions[1])
+	}
+	last := len(actions) - 1
+	return fmt.Sprintf("%s and %s", strings.Join(actions[:last], ", "), actions[last])
+}
+
+// rawRuleName tries to extract the name of the rule from its raw representation, so that it can be
+// used in error messages. It returns an empty string if the name can't be extracted.
+//
+func rawRuleName(rawRule interface{}) string {
+	rule, ok := rawRule.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	metadata, ok := rule["metadata"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := metadata["name"].(string)
+	return name
+}
+
+// findRule returns the already loaded rule that has the given name, or nil if there is no such
+// rule. The caller should hold the rules mutex.
+//
+func (r *RulesConfig) findRule(name string) *autoheal.HealingRule {
+	for _, rule := range r.rules {
+		if rule.ObjectMeta.Name == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+// inheritRule copies to the child rule the settings of the parent that the child doesn't specify.
+// The action is inherited only if the child doesn't have any action, except when both have an AWX
+// job, as then the fields of the job are inherited individually. The parent should be a copy, as
+// its contents will be shared with the child.
+//
+func inheritRule(child, parent *autoheal.HealingRule) {
+	if child.Labels == nil {
+		child.Labels = parent.Labels
+	}
+	if child.Annotations == nil {
+		child.Annotations = parent.Annotations
+	}
+	if child.Severity == nil {
+		child.Severity = parent.Severity
+	}
+	if child.GeneratorURLPattern == "" {
+		child.GeneratorURLPattern = parent.GeneratorURLPattern
+	}
+	if child.Namespace == "" {
+		child.Namespace = parent.Namespace
+	}
+	if child.CorrelateBy == nil {
+		child.CorrelateBy = parent.CorrelateBy
+	}
+	if child.ThrottleInterval == "" {
+		child.ThrottleInterval = parent.ThrottleInterval
+	}
+	if child.Priority == 0 {
+		child.Priority = parent.Priority
+	}
+	if !child.StopOnFirst {
+		child.StopOnFirst = parent.StopOnFirst
+	}
+	if child.Conditions == nil {
+		child.Conditions = parent.Conditions
+	}
+	switch {
+	case child.AWXJob == nil && child.WorkflowJob == nil && child.BatchJob == nil && child.Plugin == nil &&
+		child.WebhookJob == nil && child.SlackJob == nil:
+		child.AWXJob = parent.AWXJob
+		child.WorkflowJob = parent.WorkflowJob
+		child.BatchJob = parent.BatchJob
+		child.Plugin = parent.Plugin
+		child.WebhookJob = parent.WebhookJob
+		child.SlackJob = parent.SlackJob
+	case child.AWXJob != nil && parent.AWXJob != nil:
+		inheritAWXJob(child.AWXJob, parent.AWXJob)
+	case child.WorkflowJob != nil && parent.WorkflowJob != nil:
+		inheritWorkflowJob(child.WorkflowJob, parent.WorkflowJob)
+	}
+}
+
+// inheritAWXJob copies to the child AWX job the fields of the parent that the child doesn't specify.
+//
+func inheritAWXJob(child, parent *autoheal.AWXJobAction) {
+	if child.Template == "" {
+		child.Template = parent.Template
+	}
+	if child.ExtraVars == nil {
+		child.ExtraVars = parent.ExtraVars
+	}
+	if child.ExtraVarsMergeStrategy == "" {
+		child.ExtraVarsMergeStrategy = parent.ExtraVarsMergeStrategy
+	}
+	if child.Limit == "" {
+		child.Limit = parent.Limit
+	}
+	if child.ServerRef == "" {
+		child.ServerRef = parent.ServerRef
+	}
+}
+
+// inheritWorkflowJob copies to the child AWX workflow job the fields of the parent that the child
+// doesn't specify.
+//
+func inheritWorkflowJob(child, parent *autoheal.AWXWorkflowAction) {
+	if child.Template == "" {
+		child.Template = parent.Template
+	}
+	if child.ExtraVars == nil {
+		child.ExtraVars = parent.ExtraVars
+	}
+	if child.Limit == "" {
+		child.Limit = parent.Limit
+	}
+	if child.ServerRef == "" {
+		child.ServerRef = parent.ServerRef
+	}
+}
+
 // clear the healing rules array
 func (r *RulesConfig) clear() {
 	// Init the rules mutex
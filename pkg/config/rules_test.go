@@ -0,0 +1,678 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestRuleInheritsFromParent(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: parent
+  labels:
+    alertname: "NodeDown"
+  correlateBy:
+  - instance
+  awxJob:
+    template: "Start node"
+    limit: "{{ $labels.instance }}"
+    extraVars:
+      environment: production
+- metadata:
+    name: child
+  basedOn: parent
+  labels:
+    alertname: "NodeUnreachable"
+  awxJob:
+    template: "Restart node"
+`)
+	child := findTestRule(t, rules, "child")
+	if !reflect.DeepEqual(child.Labels, map[string]string{"alertname": "NodeUnreachable"}) {
+		t.Errorf("Expected child labels to be kept, but got %v", child.Labels)
+	}
+	if !reflect.DeepEqual(child.CorrelateBy, []string{"instance"}) {
+		t.Errorf("Expected correlation labels to be inherited, but got %v", child.CorrelateBy)
+	}
+	if child.AWXJob.Template != "Restart node" {
+		t.Errorf("Expected child template to be kept, but got '%s'", child.AWXJob.Template)
+	}
+	if child.AWXJob.Limit != "{{ $labels.instance }}" {
+		t.Errorf("Expected limit to be inherited, but got '%s'", child.AWXJob.Limit)
+	}
+	if child.AWXJob.ExtraVars["environment"] != "production" {
+		t.Errorf("Expected extra variables to be inherited, but got %v", child.AWXJob.ExtraVars)
+	}
+
+	// Changing the child shouldn't change the parent:
+	child.AWXJob.ExtraVars["environment"] = "testing"
+	parent := findTestRule(t, rules, "parent")
+	if parent.AWXJob.ExtraVars["environment"] != "production" {
+		t.Errorf("Expected parent to be independent of child, but got %v", parent.AWXJob.ExtraVars)
+	}
+}
+
+func TestRuleLoadsAnnotations(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: annotations-only
+  annotations:
+    severity: "critical"
+  awxJob:
+    template: "Heal"
+- metadata:
+    name: mixed
+  labels:
+    alertname: "NodeDown"
+  annotations:
+    severity: "warning|critical"
+  awxJob:
+    template: "Heal"
+`)
+	annotationsOnly := findTestRule(t, rules, "annotations-only")
+	if len(annotationsOnly.Labels) != 0 {
+		t.Errorf("Expected no labels, but got %v", annotationsOnly.Labels)
+	}
+	if !reflect.DeepEqual(annotationsOnly.Annotations, map[string]string{"severity": "critical"}) {
+		t.Errorf("Expected annotations to be loaded, but got %v", annotationsOnly.Annotations)
+	}
+	mixed := findTestRule(t, rules, "mixed")
+	if !reflect.DeepEqual(mixed.Labels, map[string]string{"alertname": "NodeDown"}) {
+		t.Errorf("Expected labels to be loaded, but got %v", mixed.Labels)
+	}
+	if !reflect.DeepEqual(mixed.Annotations, map[string]string{"severity": "warning|critical"}) {
+		t.Errorf("Expected annotations to be loaded, but got %v", mixed.Annotations)
+	}
+}
+
+func TestRuleInheritsChain(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: a
+  correlateBy:
+  - instance
+  awxJob:
+    template: "Heal"
+    extraVarsMergeStrategy: Append
+- metadata:
+    name: b
+  basedOn: a
+  annotations:
+    severity: "critical"
+- metadata:
+    name: c
+  basedOn: b
+  labels:
+    alertname: "NodeDown"
+`)
+	c := findTestRule(t, rules, "c")
+	if !reflect.DeepEqual(c.Labels, map[string]string{"alertname": "NodeDown"}) {
+		t.Errorf("Expected labels of 'c' to be kept, but got %v", c.Labels)
+	}
+	if !reflect.DeepEqual(c.Annotations, map[string]string{"severity": "critical"}) {
+		t.Errorf("Expected annotations to be inherited from 'b', but got %v", c.Annotations)
+	}
+	if !reflect.DeepEqual(c.CorrelateBy, []string{"instance"}) {
+		t.Errorf("Expected correlation labels to be inherited from 'a', but got %v", c.CorrelateBy)
+	}
+	if c.AWXJob == nil || c.AWXJob.Template != "Heal" {
+		t.Fatalf("Expected AWX job to be inherited from 'a', but got %+v", c.AWXJob)
+	}
+	if c.AWXJob.ExtraVarsMergeStrategy != autoheal.ExtraVarsMergeStrategyAppend {
+		t.Errorf("Expected merge strategy to be inherited from 'a', but got '%s'", c.AWXJob.ExtraVarsMergeStrategy)
+	}
+}
+
+func TestRuleInheritsPriority(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: parent
+  priority: 10
+  stopOnFirst: true
+  awxJob:
+    template: "Heal"
+- metadata:
+    name: child
+  basedOn: parent
+- metadata:
+    name: other
+  basedOn: parent
+  priority: -1
+`)
+	child := findTestRule(t, rules, "child")
+	if child.Priority != 10 || !child.StopOnFirst {
+		t.Errorf("Expected priority and stop on first to be inherited, but got %d and %t",
+			child.Priority, child.StopOnFirst)
+	}
+	other := findTestRule(t, rules, "other")
+	if other.Priority != -1 {
+		t.Errorf("Expected priority -1 to be kept, but got %d", other.Priority)
+	}
+}
+
+func TestRuleInheritsSeverity(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: parent
+  severity:
+  - critical
+  - warning
+  awxJob:
+    template: "Heal"
+- metadata:
+    name: child
+  basedOn: parent
+- metadata:
+    name: other
+  basedOn: parent
+  severity:
+  - info
+`)
+	child := findTestRule(t, rules, "child")
+	if !reflect.DeepEqual(child.Severity, []string{"critical", "warning"}) {
+		t.Errorf("Expected severities to be inherited, but got %v", child.Severity)
+	}
+	other := findTestRule(t, rules, "other")
+	if !reflect.DeepEqual(other.Severity, []string{"info"}) {
+		t.Errorf("Expected severity 'info' to be kept, but got %v", other.Severity)
+	}
+}
+
+func TestRuleDoesntInheritOtherAction(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: parent
+  awxJob:
+    template: "Heal"
+- metadata:
+    name: child
+  basedOn: parent
+  batchJob:
+    metadata:
+      namespace: my-namespace
+      name: heal
+`)
+	child := findTestRule(t, rules, "child")
+	if child.AWXJob != nil {
+		t.Errorf("Expected AWX job not to be inherited when the child has a batch job")
+	}
+	if child.BatchJob == nil {
+		t.Errorf("Expected batch job to be kept")
+	}
+}
+
+func TestRuleBasedOnMissingRule(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: child
+  basedOn: missing
+`)
+	if err == nil {
+		t.Errorf("Expected an error when the parent rule doesn't exist")
+	}
+}
+
+func loadRules(t *testing.T, content string) []*autoheal.HealingRule {
+	cfg, err := buildRulesConfig(t, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	return cfg.Rules()
+}
+
+func buildRulesConfig(t *testing.T, content string) (*Config, error) {
+	file, err := ioutil.TempFile("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(content)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rules with AWX jobs require the address of the server, so load it first:
+	return NewBuilder().
+		File(filepath.Join("..", "..", "testdata", "awx-config.yml")).
+		File(file.Name()).
+		Build()
+}
+
+func findTestRule(t *testing.T, rules []*autoheal.HealingRule, name string) *autoheal.HealingRule {
+	for _, rule := range rules {
+		if rule.ObjectMeta.Name == name {
+			return rule
+		}
+	}
+	t.Fatalf("Can't find rule '%s'", name)
+	return nil
+}
+
+func TestRuleWithoutActionIsRejected(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: no-action
+  labels:
+    alertname: "NodeDown"
+`)
+	if err == nil {
+		t.Fatalf("Expected an error for a rule without action")
+	}
+	expected := "Rule 'no-action' doesn't have an action"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestRuleWithOneActionIsAccepted(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: one-action
+  awxJob:
+    template: "Start node"
+`)
+	findTestRule(t, rules, "one-action")
+}
+
+func TestRuleWithTwoActionsIsRejected(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: two-actions
+  awxJob:
+    template: "Start node"
+  batchJob:
+    metadata:
+      name: start-node
+`)
+	if err == nil {
+		t.Fatalf("Expected an error for a rule with two actions")
+	}
+	expected := "Rule 'two-actions' has both awxJob and batchJob; exactly one must be specified"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestRuleWithThreeActionsIsRejected(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: three-actions
+  awxJob:
+    template: "Start node"
+  batchJob:
+    metadata:
+      name: start-node
+  plugin:
+    type: my-plugin
+`)
+	if err == nil {
+		t.Fatalf("Expected an error for a rule with three actions")
+	}
+	expected := "Rule 'three-actions' has awxJob, batchJob and plugin; exactly one must be specified"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestRuleWithPodCondition(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: parent
+  labels:
+    alertname: "PodDown"
+  conditions:
+    pod:
+      namespace: "{{ $labels.namespace }}"
+      podSelector: "app=my-app"
+      conditionType: "Ready"
+      conditionStatus: "False"
+  awxJob:
+    template: "Restart pod"
+- metadata:
+    name: child
+  basedOn: parent
+  awxJob:
+    template: "Delete pod"
+`)
+	expected := &autoheal.PodCondition{
+		Namespace:       "{{ $labels.namespace }}",
+		PodSelector:     "app=my-app",
+		ConditionType:   "Ready",
+		ConditionStatus: "False",
+	}
+	for _, name := range []string{"parent", "child"} {
+		rule := findTestRule(t, rules, name)
+		if rule.Conditions == nil || !reflect.DeepEqual(rule.Conditions.Pod, expected) {
+			t.Errorf("Expected rule '%s' to have pod condition %+v, but got %+v", name, expected, rule.Conditions)
+		}
+	}
+}
+
+func TestPodConditionWithoutSelectorIsRejected(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: no-selector
+  conditions:
+    pod:
+      namespace: my-namespace
+  awxJob:
+    template: "Restart pod"
+`)
+	if err == nil {
+		t.Fatalf("Expected an error for a pod condition without selector")
+	}
+	expected := "The pod condition doesn't have a pod selector"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestRuleWithWorkflowJob(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: heal-cluster
+  workflowJob:
+    template: "Heal cluster"
+    limit: "{{ $labels.instance }}"
+`)
+	rule := findTestRule(t, rules, "heal-cluster")
+	expected := &autoheal.AWXWorkflowAction{
+		Template: "Heal cluster",
+		Limit:    "{{ $labels.instance }}",
+	}
+	if !reflect.DeepEqual(rule.WorkflowJob, expected) {
+		t.Errorf("Expected workflow job %+v, but got %+v", expected, rule.WorkflowJob)
+	}
+}
+
+func TestRuleWithWorkflowAndAWXJobIsRejected(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: two-actions
+  awxJob:
+    template: "Start node"
+  workflowJob:
+    template: "Heal cluster"
+`)
+	if err == nil {
+		t.Fatalf("Expected an error for a rule with two actions")
+	}
+	expected := "Rule 'two-actions' has both awxJob and workflowJob; exactly one must be specified"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestRuleWithWebhookJob(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: trigger-pipeline
+  webhookJob:
+    url: https://ci.example.com/pipelines/heal
+    method: PUT
+    headers:
+      Content-Type: application/json
+    body: '{"node": "{{ $labels.instance }}"}'
+    secretRef:
+      namespace: my-namespace
+      name: ci-token
+`)
+	rule := findTestRule(t, rules, "trigger-pipeline")
+	expected := &autoheal.WebhookAction{
+		URL:    "https://ci.example.com/pipelines/heal",
+		Method: "PUT",
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: `{"node": "{{ $labels.instance }}"}`,
+		SecretRef: &core.SecretReference{
+			Namespace: "my-namespace",
+			Name:      "ci-token",
+		},
+	}
+	if !reflect.DeepEqual(rule.WebhookJob, expected) {
+		t.Errorf("Expected webhook job %+v, but got %+v", expected, rule.WebhookJob)
+	}
+}
+
+func TestRuleWithSlackJob(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: notify-ops
+  slackJob:
+    channel: "#ops"
+    titleTemplate: "Node {{ $labels.instance }} is down"
+    message: "Restarting it"
+    secretRef:
+      namespace: my-namespace
+      name: slack-webhook
+`)
+	rule := findTestRule(t, rules, "notify-ops")
+	expected := &autoheal.SlackAction{
+		Channel:       "#ops",
+		TitleTemplate: "Node {{ $labels.instance }} is down",
+		Message:       "Restarting it",
+		SecretRef: &core.SecretReference{
+			Namespace: "my-namespace",
+			Name:      "slack-webhook",
+		},
+	}
+	if !reflect.DeepEqual(rule.SlackJob, expected) {
+		t.Errorf("Expected Slack job %+v, but got %+v", expected, rule.SlackJob)
+	}
+}
+
+func TestCheckRule(t *testing.T) {
+	valid := &autoheal.HealingRule{
+		AWXJob: &autoheal.AWXJobAction{
+			Template: "Start node",
+		},
+	}
+	valid.ObjectMeta.Name = "valid"
+	err := CheckRule(valid)
+	if err != nil {
+		t.Errorf("Expected no error for a valid rule, but got '%s'", err)
+	}
+
+	based := valid.DeepCopy()
+	based.BasedOn = "parent"
+	err = CheckRule(based)
+	if err == nil {
+		t.Errorf("Expected an error for a rule based on another rule")
+	}
+
+	invalid := valid.DeepCopy()
+	invalid.ThrottleInterval = "junk"
+	err = CheckRule(invalid)
+	if err == nil {
+		t.Errorf("Expected an error for a rule with an invalid throttle interval")
+	}
+}
+
+func TestRuleWithThrottleInterval(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: parent
+  throttleInterval: 10s
+  awxJob:
+    template: "Restart pod"
+- metadata:
+    name: child
+  basedOn: parent
+`)
+	for _, name := range []string{"parent", "child"} {
+		rule := findTestRule(t, rules, name)
+		if rule.ThrottleInterval != "10s" {
+			t.Errorf("Expected rule '%s' to have throttle interval '10s', but got '%s'", name, rule.ThrottleInterval)
+		}
+	}
+}
+
+func TestInvalidThrottleIntervalIsRejected(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: invalid-interval
+  throttleInterval: often
+  awxJob:
+    template: "Restart pod"
+`)
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid throttle interval")
+	}
+	expected := "The throttle interval 'often' isn't valid"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestExtraVarsAsJSONString(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: json-vars
+  awxJob:
+    template: "Start node"
+    extraVars: '{"node": "{{ $labels.instance }}", "environment": "production"}'
+`)
+	rule := findTestRule(t, rules, "json-vars")
+	expected := autoheal.JsonDoc{
+		"node":        "{{ $labels.instance }}",
+		"environment": "production",
+	}
+	if !reflect.DeepEqual(rule.AWXJob.ExtraVars, expected) {
+		t.Errorf("Expected extra variables %v, but got %v", expected, rule.AWXJob.ExtraVars)
+	}
+}
+
+func TestExtraVarsAsYAMLString(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: yaml-vars
+  awxJob:
+    template: "Start node"
+    extraVars: |
+      node: "{{ $labels.instance }}"
+      environment: production
+`)
+	rule := findTestRule(t, rules, "yaml-vars")
+	expected := autoheal.JsonDoc{
+		"node":        "{{ $labels.instance }}",
+		"environment": "production",
+	}
+	if !reflect.DeepEqual(rule.AWXJob.ExtraVars, expected) {
+		t.Errorf("Expected extra variables %v, but got %v", expected, rule.AWXJob.ExtraVars)
+	}
+}
+
+func TestExtraVarsAsMap(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: map-vars
+  awxJob:
+    template: "Start node"
+    extraVars:
+      environment: production
+`)
+	rule := findTestRule(t, rules, "map-vars")
+	expected := autoheal.JsonDoc{
+		"environment": "production",
+	}
+	if !reflect.DeepEqual(rule.AWXJob.ExtraVars, expected) {
+		t.Errorf("Expected extra variables %v, but got %v", expected, rule.AWXJob.ExtraVars)
+	}
+}
+
+func TestWorkflowExtraVarsAsYAMLString(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    name: yaml-vars
+  workflowJob:
+    template: "Heal cluster"
+    extraVars: |
+      node: "{{ $labels.instance }}"
+      environment: production
+`)
+	rule := findTestRule(t, rules, "yaml-vars")
+	expected := autoheal.JsonDoc{
+		"node":        "{{ $labels.instance }}",
+		"environment": "production",
+	}
+	if !reflect.DeepEqual(rule.WorkflowJob.ExtraVars, expected) {
+		t.Errorf("Expected extra variables %v, but got %v", expected, rule.WorkflowJob.ExtraVars)
+	}
+}
+
+func TestInvalidExtraVarsAreRejected(t *testing.T) {
+	values := []string{
+		`"myvar"`,
+		`"[1, 2, 3]"`,
+		`"{not valid"`,
+	}
+	for _, value := range values {
+		_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: bad-vars
+  awxJob:
+    template: "Start node"
+    extraVars: `+value+`
+`)
+		if err == nil {
+			t.Errorf("Expected an error for extra variables %s", value)
+			continue
+		}
+		if !strings.Contains(err.Error(), "bad-vars") {
+			t.Errorf("Expected error message to contain the rule name, but it is '%s'", err)
+		}
+		if !strings.Contains(err.Error(), strings.Trim(value, `"`)) {
+			t.Errorf("Expected error message to contain the extra variables, but it is '%s'", err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"strings"
+
+	"github.com/openshift/autoheal/pkg/internal/data"
+)
+
+// RuntimeConfig is a read only view of the section of the configuration that describes the
+// environment where the healing actions run.
+//
+type RuntimeConfig struct {
+	imageMirror string
+}
+
+// ImageMirror returns the prefix of the registry mirror, for example
+// 'registry.example.com/mirror', that should replace the registries of the images of the batch
+// jobs. An empty string means that the images aren't changed.
+//
+func (r *RuntimeConfig) ImageMirror() string {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
+	return r.imageMirror
+}
+
+func (r *RuntimeConfig) merge(decoded *data.RuntimeConfig) error {
+	if decoded.ImageMirror != "" {
+		r.imageMirror = strings.TrimSuffix(decoded.ImageMirror, "/")
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the types and functions used to load the configuration of the additional AWX
+// servers that the AWX jobs of the healing rules can reference by name.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/openshift/autoheal/pkg/internal/data"
+)
+
+// ServersConfig is a read only view of the section of the configuration that describes the
+// additional AWX servers. The configuration of each server starts as a copy of the configuration of
+// the default AWX server, so the settings that aren't given for a server are taken from it.
+//
+type ServersConfig struct {
+	// The configurations of the servers, indexed by name. The map is replaced, instead of modified,
+	// every time that the configuration is loaded, so that the previous one can be restored if the
+	// load fails.
+	servers map[string]*AWXConfig
+
+	// The sections decoded from the configuration files, in the order that they were loaded. They
+	// are only merged when all the files have been loaded, as the default AWX configuration that
+	// they extend may come from a file loaded later.
+	decoded map[string][]*data.AWXConfig
+
+	mutex *sync.Mutex
+}
+
+// Server returns the configuration of the AWX server with the given name, or nil if there is no
+// such server.
+//
+func (s *ServersConfig) Server(name string) *AWXConfig {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.servers[name]
+}
+
+// Names returns the names of the AWX servers, sorted alphabetically.
+//
+func (s *ServersConfig) Names() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	names := make([]string, 0, len(s.servers))
+	for name := range s.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *ServersConfig) merge(decoded map[string]*data.AWXConfig) {
+	if s.decoded == nil {
+		s.decoded = make(map[string][]*data.AWXConfig)
+	}
+	for name, server := range decoded {
+		if server == nil {
+			server = &data.AWXConfig{}
+		}
+		s.decoded[name] = append(s.decoded[name], server)
+	}
+}
+
+// clear discards the sections decoded from the configuration files, so that they can be loaded
+// again.
+//
+func (s *ServersConfig) clear() {
+	s.decoded = nil
+}
+
+// build creates the configurations of the servers merging the sections decoded from the
+// configuration files into copies of the given default AWX configuration. It should be called
+// after merging all the sources.
+//
+func (s *ServersConfig) build(defaults *AWXConfig) error {
+	names := make([]string, 0, len(s.decoded))
+	for name := range s.decoded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	servers := make(map[string]*AWXConfig, len(names))
+	for _, name := range names {
+		server, err := buildServer(defaults, s.decoded[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf(
+				"The configuration of AWX server '%s' isn't valid: %s",
+				name,
+				err,
+			))
+			continue
+		}
+		servers[name] = server
+	}
+	if len(errs) > 0 {
+		return newAggregate(errs)
+	}
+
+	s.mutex.Lock()
+	s.servers = servers
+	s.mutex.Unlock()
+	return nil
+}
+
+// buildServer creates the configuration of one AWX server merging the given sections into a copy
+// of the default AWX configuration.
+//
+func buildServer(defaults *AWXConfig, sections []*data.AWXConfig) (*AWXConfig, error) {
+	server := *defaults
+	server.ca = new(bytes.Buffer)
+	if defaults.ca != nil {
+		server.ca.Write(defaults.ca.Bytes())
+	}
+	for _, section := range sections {
+		// The token of the default server would take precedence over the user name and password
+		// given for this server, so it has to be discarded:
+		if section.Credentials != nil || section.CredentialsRef != nil {
+			server.token = ""
+		}
+		err := server.merge(section)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if server.address == "" {
+		return nil, fmt.Errorf(
+			"It doesn't have an address, and the default AWX server doesn't have one either",
+		)
+	}
+	err := server.check()
+	if err != nil {
+		return nil, err
+	}
+	return &server, nil
+}
@@ -0,0 +1,231 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestServerInheritsDefaults(t *testing.T) {
+	cfg, err := buildConfig(t, `
+awx:
+  address: https://default.example.com/api
+  project: "Default project"
+  credentials:
+    username: "default-user"
+    password: "default-password"
+  maxRetries: 3
+  extraVars:
+    environment: production
+
+servers:
+  team-a:
+    address: https://team-a.example.com/api
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cfg.Servers().Server("team-a")
+	if server == nil {
+		t.Fatal("Expected server 'team-a' to be configured")
+	}
+	if server.Address() != "https://team-a.example.com/api" {
+		t.Errorf("Expected address 'https://team-a.example.com/api', but got '%s'", server.Address())
+	}
+	if server.Project() != "Default project" {
+		t.Errorf("Expected project 'Default project', but got '%s'", server.Project())
+	}
+	if server.User() != "default-user" || server.Password() != "default-password" {
+		t.Errorf("Expected the credentials of the default server, but got user '%s'", server.User())
+	}
+	if server.MaxRetries() != 3 {
+		t.Errorf("Expected 3 retries, but got %d", server.MaxRetries())
+	}
+	expected := map[string]interface{}{
+		"environment": "production",
+	}
+	if !reflect.DeepEqual(server.ExtraVars(), expected) {
+		t.Errorf("Expected extra variables %v, but got %v", expected, server.ExtraVars())
+	}
+}
+
+func TestServerOverridesDefaults(t *testing.T) {
+	cfg, err := buildConfig(t, `
+awx:
+  address: https://default.example.com/api
+  project: "Default project"
+  token: default-token
+
+servers:
+  team-a:
+    address: https://team-a.example.com/api
+    project: "Team A project"
+    credentials:
+      username: "team-a-user"
+      password: "team-a-password"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cfg.Servers().Server("team-a")
+	if server.Project() != "Team A project" {
+		t.Errorf("Expected project 'Team A project', but got '%s'", server.Project())
+	}
+	if server.Token() != "" {
+		t.Errorf("Expected the token of the default server to be discarded, but got '%s'", server.Token())
+	}
+	if server.User() != "team-a-user" || server.Password() != "team-a-password" {
+		t.Errorf("Expected user 'team-a-user', but got '%s'", server.User())
+	}
+
+	// The default server shouldn't be affected:
+	if cfg.AWX().Project() != "Default project" {
+		t.Errorf("Expected default project 'Default project', but got '%s'", cfg.AWX().Project())
+	}
+	if cfg.AWX().Token() != "default-token" {
+		t.Errorf("Expected default token 'default-token', but got '%s'", cfg.AWX().Token())
+	}
+}
+
+func TestServerInheritsDefaultsLoadedLater(t *testing.T) {
+	cfg, err := buildConfig(
+		t,
+		`
+servers:
+  team-a:
+    project: "Team A project"
+`,
+		`
+awx:
+  address: https://default.example.com/api
+  token: default-token
+`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cfg.Servers().Server("team-a")
+	if server.Address() != "https://default.example.com/api" {
+		t.Errorf("Expected address 'https://default.example.com/api', but got '%s'", server.Address())
+	}
+	if server.Token() != "default-token" {
+		t.Errorf("Expected token 'default-token', but got '%s'", server.Token())
+	}
+}
+
+func TestServerRequiresAddress(t *testing.T) {
+	_, err := buildConfig(t, `
+servers:
+  team-a:
+    token: my-token
+`)
+	if err == nil {
+		t.Fatal("Expected an error for a server without address")
+	}
+}
+
+func TestRuleWithServerRef(t *testing.T) {
+	cfg, err := buildConfig(t, `
+servers:
+  team-a:
+    address: https://team-a.example.com/api
+    token: my-token
+
+rules:
+- metadata:
+    name: start-node
+  awxJob:
+    template: "Start node"
+    serverRef: team-a
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := cfg.Rules()
+	if len(rules) != 1 || rules[0].AWXJob.ServerRef != "team-a" {
+		t.Errorf("Expected one rule that references server 'team-a', but got %v", rules)
+	}
+}
+
+func TestWorkflowRuleWithServerRef(t *testing.T) {
+	cfg, err := buildConfig(t, `
+servers:
+  team-a:
+    address: https://team-a.example.com/api
+    token: my-token
+
+rules:
+- metadata:
+    name: heal-cluster
+  workflowJob:
+    template: "Heal cluster"
+    serverRef: team-a
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := cfg.Rules()
+	if len(rules) != 1 || rules[0].WorkflowJob.ServerRef != "team-a" {
+		t.Errorf("Expected one rule that references server 'team-a', but got %v", rules)
+	}
+}
+
+func TestWorkflowRuleWithUnknownServerIsRejected(t *testing.T) {
+	_, err := buildConfig(t, `
+awx:
+  address: https://default.example.com/api
+  token: my-token
+
+rules:
+- metadata:
+    name: heal-cluster
+  workflowJob:
+    template: "Heal cluster"
+    serverRef: junk
+`)
+	var parseErr *RuleParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected a rule parse error, but got %v", err)
+	}
+	if parseErr.RuleName != "heal-cluster" {
+		t.Errorf("Expected the error to be for rule 'heal-cluster', but got '%s'", parseErr.RuleName)
+	}
+}
+
+func TestRuleWithUnknownServerIsRejected(t *testing.T) {
+	_, err := buildConfig(t, `
+awx:
+  address: https://default.example.com/api
+  token: my-token
+
+rules:
+- metadata:
+    name: start-node
+  awxJob:
+    template: "Start node"
+    serverRef: junk
+`)
+	var parseErr *RuleParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected a rule parse error, but got %v", err)
+	}
+	if parseErr.RuleName != "start-node" {
+		t.Errorf("Expected the error to be for rule 'start-node', but got '%s'", parseErr.RuleName)
+	}
+}
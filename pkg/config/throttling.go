@@ -35,6 +35,8 @@ type ThrottlingConfig struct {
 // rules.
 //
 func (t *ThrottlingConfig) Interval() time.Duration {
+	sectionsMutex.RLock()
+	defer sectionsMutex.RUnlock()
 	return t.interval
 }
 
@@ -0,0 +1,138 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions that check that a loaded configuration can be applied to the
+// running service.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// envReferenceRE matches the references to environment variables, like ${AWX_HOST}, that can be
+// used in the address of the AWX server.
+//
+var envReferenceRE = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// Validate checks that the configuration is complete and can be applied to the running service. It
+// is called every time that the configuration is loaded, and when it fails the previously loaded
+// configuration is kept.
+//
+func (c *Config) Validate() error {
+	var errs []error
+
+	// The addresses of the AWX servers, if present, must be URLs:
+	if c.awx.address != "" {
+		err := validateAWXAddress(c.awx.address)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, name := range c.servers.Names() {
+		// The addresses inherited from the default server have already been checked:
+		address := c.servers.Server(name).address
+		if address == c.awx.address {
+			continue
+		}
+		err := validateAWXAddress(address)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(
+				"The configuration of AWX server '%s' isn't valid: %s",
+				name,
+				err,
+			))
+		}
+	}
+
+	// The throttling interval must be positive:
+	if c.throttling.interval <= 0 {
+		errs = append(errs, fmt.Errorf(
+			"The throttling interval must be positive, but it is %s",
+			c.throttling.interval,
+		))
+	}
+
+	// Each rule must have a complete action:
+	for _, rule := range c.rules.rules {
+		err := validateRuleAction(rule)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return newAggregate(errs)
+}
+
+// validateAWXAddress checks that the given address of an AWX server is an URL. The references to
+// environment variables are replaced with a valid host name, as they are only resolved when the
+// server is used.
+//
+func validateAWXAddress(address string) error {
+	parsed, err := url.Parse(envReferenceRE.ReplaceAllString(address, "placeholder"))
+	if err == nil && (parsed.Scheme == "" || parsed.Host == "") {
+		err = fmt.Errorf("It must contain the scheme and the host name")
+	}
+	if err != nil {
+		return fmt.Errorf("The AWX address '%s' isn't a valid URL: %s", address, err)
+	}
+	return nil
+}
+
+// validateRuleAction checks that the given rule has an action, and that it has the details that
+// are needed to execute it.
+//
+func validateRuleAction(rule *autoheal.HealingRule) error {
+	switch {
+	case rule.AWXJob != nil:
+		if rule.AWXJob.Template == "" {
+			return fmt.Errorf(
+				"The AWX job of rule '%s' doesn't have a template",
+				rule.ObjectMeta.Name,
+			)
+		}
+	case rule.WorkflowJob != nil:
+		if rule.WorkflowJob.Template == "" {
+			return fmt.Errorf(
+				"The AWX workflow job of rule '%s' doesn't have a template",
+				rule.ObjectMeta.Name,
+			)
+		}
+	case rule.BatchJob != nil:
+		// The namespace of the job defaults to the namespace of the rule:
+		if rule.BatchJob.ObjectMeta.Namespace == "" && rule.ObjectMeta.Namespace == "" {
+			return fmt.Errorf(
+				"The batch job of rule '%s' doesn't have a namespace",
+				rule.ObjectMeta.Name,
+			)
+		}
+	case rule.SlackJob != nil:
+		if rule.SlackJob.WebhookURL == "" && rule.SlackJob.SecretRef == nil {
+			return fmt.Errorf(
+				"The Slack job of rule '%s' doesn't have a webhook URL or a secret reference",
+				rule.ObjectMeta.Name,
+			)
+		}
+	case rule.Plugin != nil, rule.WebhookJob != nil:
+	default:
+		return fmt.Errorf("Rule '%s' doesn't have an action", rule.ObjectMeta.Name)
+	}
+	return nil
+}
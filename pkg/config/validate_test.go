@@ -0,0 +1,325 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidateRejectsInvalidAWXAddress(t *testing.T) {
+	_, err := buildConfig(t, `
+awx:
+  address: my-awx.example.com/api
+  credentials:
+    username: my-user
+    password: my-password
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	expected := "The AWX address 'my-awx.example.com/api' isn't a valid URL"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestValidateAcceptsAWXAddressWithEnvironmentVariables(t *testing.T) {
+	cfg, err := buildConfig(t, `
+awx:
+  address: https://${AWX_HOST}/api
+  credentials:
+    username: my-user
+    password: my-password
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ShutDown()
+}
+
+func TestValidateRejectsZeroThrottlingInterval(t *testing.T) {
+	_, err := buildConfig(t, `
+throttling:
+  interval: 0s
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	expected := "The throttling interval must be positive"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestValidateRejectsAWXJobWithoutTemplate(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: no-template
+  awxJob:
+    limit: "{{ $labels.instance }}"
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	expected := "The AWX job of rule 'no-template' doesn't have a template"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestValidateRejectsBatchJobWithoutNamespace(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: no-namespace
+  batchJob:
+    metadata:
+      name: heal
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	expected := "The batch job of rule 'no-namespace' doesn't have a namespace"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestValidateRejectsSlackJobWithoutWebhookURL(t *testing.T) {
+	_, err := buildRulesConfig(t, `
+rules:
+- metadata:
+    name: no-url
+  slackJob:
+    channel: "#ops"
+`)
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+	expected := "The Slack job of rule 'no-url' doesn't have a webhook URL or a secret reference"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error message to contain '%s', but it is '%s'", expected, err)
+	}
+}
+
+func TestValidateAcceptsBatchJobWithRuleNamespace(t *testing.T) {
+	rules := loadRules(t, `
+rules:
+- metadata:
+    namespace: my-namespace
+    name: rule-namespace
+  batchJob:
+    metadata:
+      name: heal
+`)
+	findTestRule(t, rules, "rule-namespace")
+}
+
+func TestFailedReloadKeepsPreviousConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeRuleFile(t, dir, "a.yml", "first-rule")
+	cfg, err := NewBuilder().
+		File(dir).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	interval := cfg.Throttling().Interval()
+
+	// Add a file that changes the throttling interval and contains a rule without action, and
+	// reload:
+	content := "throttling:\n  interval: 5m\nrules:\n- metadata:\n    name: broken-rule\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "b.yml"), []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.load()
+	if err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+
+	// Nothing from the broken load should have been applied:
+	checkRuleNames(t, cfg, "first-rule")
+	if cfg.Throttling().Interval() != interval {
+		t.Errorf(
+			"Expected throttling interval to be %s, but it is %s",
+			interval,
+			cfg.Throttling().Interval(),
+		)
+	}
+}
+
+func TestReloadStartsFromDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yml")
+	content := "throttling:\n  interval: 5m\nsilenceCheckURL: http://alertmanager:9093\n"
+	err = ioutil.WriteFile(file, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewBuilder().
+		File(file).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	awx := cfg.AWX()
+
+	// Remove the sections from the file and reload:
+	err = ioutil.WriteFile(file, []byte("awx:\n  project: my-project\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The removed sections should have the default values again:
+	if cfg.Throttling().Interval() != time.Hour {
+		t.Errorf("Expected throttling interval 1h, but it is %s", cfg.Throttling().Interval())
+	}
+	if cfg.SilenceCheckURL() != "" {
+		t.Errorf("Expected no silence check URL, but got '%s'", cfg.SilenceCheckURL())
+	}
+
+	// The objects returned before the reload should see the new values:
+	if awx.Project() != "my-project" {
+		t.Errorf("Expected project 'my-project', but got '%s'", awx.Project())
+	}
+}
+
+func TestReloadClearsScopeAndSilenceCheckURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yml")
+	content := "scopeToNamespaceLabels:\n  team: ops\nsilenceCheckURL: http://alertmanager:9093\n"
+	err = ioutil.WriteFile(file, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewBuilder().
+		File(file).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+	if len(cfg.ScopeToNamespaceLabels()) != 1 || cfg.SilenceCheckURL() == "" {
+		t.Fatalf("Expected the scope and the silence check URL to be loaded")
+	}
+
+	// Remove both settings from the file and reload:
+	err = ioutil.WriteFile(file, []byte("{}\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.ScopeToNamespaceLabels()) != 0 {
+		t.Errorf("Expected no scope labels, but got %v", cfg.ScopeToNamespaceLabels())
+	}
+	if cfg.SilenceCheckURL() != "" {
+		t.Errorf("Expected no silence check URL, but got '%s'", cfg.SilenceCheckURL())
+	}
+}
+
+func TestReloadWhileReading(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yml")
+	content := "awx:\n  project: my-project\nthrottling:\n  interval: 5m\n"
+	err = ioutil.WriteFile(file, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewBuilder().
+		File(file).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.ShutDown()
+
+	// Read the configuration from other goroutines, like the runners and the workers do, while it
+	// is reloaded. Run with the race detector to check that the reads are protected:
+	stop := make(chan struct{})
+	var started, wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		started.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			awx := cfg.AWX()
+			throttling := cfg.Throttling()
+			started.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				awx.Project()
+				awx.ExtraVars()
+				throttling.Interval()
+				cfg.Correlation().TTL()
+				cfg.Runtime().ImageMirror()
+				cfg.Rules()
+				cfg.SilenceCheckURL()
+			}
+		}()
+	}
+	started.Wait()
+	for i := 0; i < 20; i++ {
+		err = cfg.load()
+		if err != nil {
+			t.Error(err)
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if cfg.AWX().Project() != "my-project" {
+		t.Errorf("Expected project 'my-project', but got '%s'", cfg.AWX().Project())
+	}
+}
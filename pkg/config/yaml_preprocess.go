@@ -0,0 +1,82 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to combine the YAML configuration files of a directory into
+// a single YAML document, so that anchors defined in one file can be referenced from the others.
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// concatenateFiles reads the given YAML files and combines them into a single YAML document that
+// contains a sequence with one item for each file, in the same order. YAML anchors are scoped to
+// the document where they are defined, so combining the files this way means that an anchor
+// defined in a file, for example in `00-defaults.yml`, can be referenced from the files that come
+// after it, for example `10-rules.yml`.
+//
+func concatenateFiles(files []string) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		err = writeIndented(buffer, content)
+		if err != nil {
+			return nil, fmt.Errorf("Can't read configuration file '%s': %s", file, err)
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// writeIndented writes the given YAML content to the buffer as an item of a sequence, indenting all
+// its lines so that the relative indentation, which is significant in YAML, is preserved. The
+// optional document start marker that precedes the content is removed, as it isn't valid inside a
+// sequence item.
+//
+func writeIndented(buffer *bytes.Buffer, content []byte) error {
+	buffer.WriteString("-\n")
+
+	// The content is already in memory, so the scanner is allowed to use a buffer as large as the
+	// complete content, otherwise it would fail with lines longer than the default limit of 64 KiB,
+	// for example with long certificates or extra variables:
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	header := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if header {
+			if trimmed == "---" {
+				header = false
+				continue
+			}
+			if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				header = false
+			}
+		}
+		buffer.WriteString("  ")
+		buffer.WriteString(line)
+		buffer.WriteString("\n")
+	}
+	return scanner.Err()
+}
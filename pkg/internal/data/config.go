@@ -26,12 +26,36 @@ import (
 // Config is used to marshal and unmarshal the main configuration of the auto-heal service.
 //
 type Config struct {
+	// Include contains the names of other configuration files that should be loaded before this
+	// one. Relative names are relative to the directory of this file, and they can contain glob
+	// patterns.
+	Include []string `json:"include,omitempty"`
+
 	// AWX contains the details to connect to the default AWX server.
 	AWX *AWXConfig `json:"awx,omitempty"`
 
+	// Servers contains the details to connect to additional AWX servers, indexed by the name that
+	// the AWX jobs of the rules use to reference them. The settings that aren't given are taken
+	// from the default AWX server.
+	Servers map[string]*AWXConfig `json:"servers,omitempty"`
+
 	// Throttling contains the healing rule execution throttling details.
 	Throttling *ThrottlingConfig
 
+	// Correlation contains the details of how to correlate alerts that affect the same entity.
+	Correlation *CorrelationConfig `json:"correlation,omitempty"`
+
+	// Runtime contains the details of the environment where the healing actions run.
+	Runtime *RuntimeConfig `json:"runtime,omitempty"`
+
+	// ScopeToNamespaceLabels are the labels of the namespaces that the auto-heal service will
+	// handle. Alerts that refer to other namespaces are discarded.
+	ScopeToNamespaceLabels map[string]string `json:"scopeToNamespaceLabels,omitempty"`
+
+	// AWXSilenceCheckURL is the address of the alert manager that is queried to check if alerts
+	// are silenced before processing them.
+	AWXSilenceCheckURL string `json:"silenceCheckURL,omitempty"`
+
 	// The list of healing rules. Note that we use here an interface because we don't know in
 	// advance what version of the rule type will be used in the configuration file. So we accept
 	// any thing and we will try to convert them to the internal unversioned rule type using the
@@ -56,6 +80,14 @@ type AWXConfig struct {
 	// the user name and password used to access the AWX API.
 	CredentialsRef *core.SecretReference `json:"credentialsRef,omitempty"`
 
+	// Token is the OAuth2 personal access token used to access the AWX API. When it is present it
+	// is used instead of the user name and password.
+	Token string `json:"token,omitempty"`
+
+	// TokenRef is the reference (name, and optionally namespace) of the secret that contains the
+	// OAuth2 personal access token, in the `token` key.
+	TokenRef *core.SecretReference `json:"tokenRef,omitempty"`
+
 	// TLS contains the TLS configuration.
 	TLS *TLSConfig `json:"tls,omitempty"`
 
@@ -71,6 +103,35 @@ type AWXConfig struct {
 
 	// JobStatusCheckInterval determines how often to check AWX active jobs status
 	JobStatusCheckInterval string `json:"jobStatusCheckInterval,omitempty"`
+
+	// TemplateCacheTTL determines for how long the job templates retrieved from the AWX server are
+	// reused before retrieving them again.
+	TemplateCacheTTL string `json:"templateCacheTTL,omitempty"`
+
+	// MaxJobAge determines for how long the active jobs are tracked before checking if they are
+	// stale, for example because the AWX server no longer knows them.
+	MaxJobAge string `json:"maxJobAge,omitempty"`
+
+	// MaxConcurrentJobs is the maximum number of jobs that can be active at the same time. Zero
+	// means that there is no limit.
+	MaxConcurrentJobs int `json:"maxConcurrentJobs,omitempty"`
+
+	// MaxRetries is the number of times that the launch of a job is retried when the request
+	// doesn't reach the AWX server, like when the connection is refused. Zero means that it isn't
+	// retried.
+	MaxRetries int `json:"maxRetries,omitempty"`
+
+	// FailureThreshold is the number of consecutive failed requests to the AWX server after which
+	// the runner stops sending requests to it for a while.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// ResetTimeout is the time to wait, after the failure threshold has been reached, before sending
+	// a trial request to the AWX server.
+	ResetTimeout string `json:"resetTimeout,omitempty"`
+
+	// ExtraVars are the global extra variables that will be passed to all the jobs, combined with
+	// the extra variables of each action.
+	ExtraVars map[string]interface{} `json:"extraVars,omitempty"`
 }
 
 // AWXCredentialsConfig contains the credentials used to connect to the AWX server.
@@ -93,3 +154,18 @@ type TLSConfig struct {
 type ThrottlingConfig struct {
 	Interval string `json:"interval,omitempty"`
 }
+
+// CorrelationConfig is used to marshal and unmarshal the alert correlation configuration.
+//
+type CorrelationConfig struct {
+	TTL string `json:"ttl,omitempty"`
+}
+
+// RuntimeConfig is used to marshal and unmarshal the configuration of the environment where the
+// healing actions run.
+//
+type RuntimeConfig struct {
+	// ImageMirror is the prefix of the registry mirror that replaces the registries of the images
+	// of the batch jobs, for air-gapped environments.
+	ImageMirror string `json:"imageMirror,omitempty"`
+}
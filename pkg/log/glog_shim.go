@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions that have the same signatures as the functions of glog, so
+// that the existing call sites can use the zap logger without other changes.
+
+package log
+
+import (
+	"github.com/golang/glog"
+	"go.uber.org/zap"
+)
+
+// Info writes an informative message to the log, formatting the arguments like fmt.Sprint.
+//
+func Info(args ...interface{}) {
+	sugar().Info(args...)
+}
+
+// Infof writes an informative message to the log.
+//
+func Infof(format string, args ...interface{}) {
+	sugar().Infof(format, args...)
+}
+
+// Warningf writes a warning message to the log. Warnings of glog are written with the warn level
+// of zap.
+//
+func Warningf(format string, args ...interface{}) {
+	sugar().Warnf(format, args...)
+}
+
+// Errorf writes an error message to the log.
+//
+func Errorf(format string, args ...interface{}) {
+	sugar().Errorf(format, args...)
+}
+
+// Fatalf writes an error message to the log and then exits the process, like glog.Fatalf.
+//
+func Fatalf(format string, args ...interface{}) {
+	sugar().Fatalf(format, args...)
+}
+
+// Verbose is the type returned by the V function. Its methods only write to the log when the
+// verbosity level is enabled.
+//
+type Verbose bool
+
+// V checks if the given verbosity level is enabled, using the -v flag of glog. The messages written
+// using the result are written with the debug level of zap, as zap doesn't have numeric verbosity
+// levels.
+//
+func V(level glog.Level) Verbose {
+	return Verbose(glog.V(level))
+}
+
+// Info writes a debug message to the log, formatting the arguments like fmt.Sprint, if the
+// verbosity level is enabled.
+//
+func (v Verbose) Info(args ...interface{}) {
+	if v {
+		sugar().Debug(args...)
+	}
+}
+
+// Infof writes a debug message to the log if the verbosity level is enabled.
+//
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v {
+		sugar().Debugf(format, args...)
+	}
+}
+
+// sugar returns the sugared logger used by the shim.
+//
+func sugar() *zap.SugaredLogger {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return shim
+}
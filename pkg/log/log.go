@@ -0,0 +1,107 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the global zap logger and the functions used to configure it.
+
+package log
+
+import (
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/openshift/autoheal/pkg/logging"
+)
+
+var (
+	// The global logger, and the sugared logger used by the glog shim, which skips the frame of
+	// the shim so that the entries report the file and line of the caller. The mutex protects
+	// them, as the format can be changed while other goroutines are writing to the log.
+	logger *zap.Logger
+	shim   *zap.SugaredLogger
+	mutex  sync.RWMutex
+)
+
+func init() {
+	setLogger(newLogger(logging.FormatText, zapcore.Lock(os.Stderr)))
+}
+
+// L returns the global zap logger. Call sites that are migrated from glog should use it instead
+// of the shim, so that they can add structured fields to the log entries.
+//
+func L() *zap.Logger {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return logger
+}
+
+// SetFormat replaces the global logger with one that writes to the standard error the entries in
+// the given format. The text format uses the console encoder of zap, and the JSON format writes
+// each entry as a JSON object in a separate line.
+//
+func SetFormat(format logging.Format) {
+	setLogger(newLogger(format, zapcore.Lock(os.Stderr)))
+}
+
+// Sync flushes the entries buffered by the global logger. It should be called before the process
+// exits.
+//
+func Sync() error {
+	return L().Sync()
+}
+
+// newLogger creates a logger that writes the entries in the given format to the given output. All
+// the levels are enabled, because the verbosity of the debug messages is checked by the shim using
+// the -v flag of glog.
+//
+func newLogger(format logging.Format, output zapcore.WriteSyncer) *zap.Logger {
+	config := zapcore.EncoderConfig{
+		TimeKey:        "ts",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		MessageKey:     "msg",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.EpochTimeEncoder,
+		EncodeDuration: zapcore.SecondsDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+	var encoder zapcore.Encoder
+	if format == logging.FormatJSON {
+		encoder = zapcore.NewJSONEncoder(config)
+	} else {
+		config.EncodeLevel = zapcore.CapitalLevelEncoder
+		config.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewConsoleEncoder(config)
+	}
+	core := zapcore.NewCore(encoder, output, zapcore.DebugLevel)
+	return zap.New(core, zap.AddCaller(), zap.ErrorOutput(output))
+}
+
+// setLogger replaces the global logger, and the global logger of zap, so that libraries that use
+// zap.L write to the same place.
+//
+func setLogger(value *zap.Logger) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	logger = value
+	shim = value.WithOptions(zap.AddCallerSkip(1)).Sugar()
+	zap.ReplaceGlobals(value)
+}
@@ -0,0 +1,165 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/openshift/autoheal/pkg/logging"
+)
+
+// entry is the representation of the log entries written in JSON format.
+//
+type entry struct {
+	Level  string  `json:"level"`
+	Ts     float64 `json:"ts"`
+	Caller string  `json:"caller"`
+	Msg    string  `json:"msg"`
+	Alert  string  `json:"alert"`
+}
+
+func TestShimLevels(t *testing.T) {
+	buffer, restore := useBuffer(logging.FormatJSON)
+	defer restore()
+	restoreVerbosity := setVerbosity("2")
+	defer restoreVerbosity()
+
+	Infof("Processing alert '%s'", "NodeDown")
+	Warningf("Job %d failed", 123)
+	Errorf("Can't connect")
+	V(2).Infof("Rule '%s' is disabled", "start-node")
+
+	expected := []entry{
+		{Level: "info", Msg: "Processing alert 'NodeDown'"},
+		{Level: "warn", Msg: "Job 123 failed"},
+		{Level: "error", Msg: "Can't connect"},
+		{Level: "debug", Msg: "Rule 'start-node' is disabled"},
+	}
+	actual := parseEntries(t, buffer)
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %d log entries, but got %d: %s", len(expected), len(actual), buffer)
+	}
+	for i := range expected {
+		if actual[i].Level != expected[i].Level || actual[i].Msg != expected[i].Msg {
+			t.Errorf("Expected entry %+v, but got %+v", expected[i], actual[i])
+		}
+		if !strings.HasPrefix(actual[i].Caller, "log/log_test.go:") {
+			t.Errorf("Expected the caller to be the test, but got '%s'", actual[i].Caller)
+		}
+		if actual[i].Ts == 0 {
+			t.Errorf("Expected a time stamp in entry %+v", actual[i])
+		}
+	}
+}
+
+func TestShimDisabledVerbosity(t *testing.T) {
+	buffer, restore := useBuffer(logging.FormatJSON)
+	defer restore()
+	restoreVerbosity := setVerbosity("0")
+	defer restoreVerbosity()
+
+	V(1).Infof("Detailed message")
+	if V(1) {
+		t.Errorf("Expected verbosity level 1 to be disabled")
+	}
+	if buffer.Len() != 0 {
+		t.Errorf("Expected nothing in the log, but got '%s'", buffer)
+	}
+}
+
+func TestTextFormatUsesConsoleEncoder(t *testing.T) {
+	buffer, restore := useBuffer(logging.FormatText)
+	defer restore()
+
+	Warningf("Job %d failed", 123)
+	line := buffer.String()
+	if !strings.Contains(line, "\tWARN\t") || !strings.HasSuffix(line, "\tJob 123 failed\n") {
+		t.Errorf("Expected a console entry with level 'WARN', but got '%s'", line)
+	}
+	if strings.HasPrefix(line, "{") {
+		t.Errorf("Expected the entry not to be JSON, but got '%s'", line)
+	}
+}
+
+func TestLReturnsGlobalLogger(t *testing.T) {
+	buffer, restore := useBuffer(logging.FormatJSON)
+	defer restore()
+
+	L().Info("Processing alert", zap.String("alert", "NodeDown"))
+	zap.L().Info("Written by a library")
+
+	actual := parseEntries(t, buffer)
+	if len(actual) != 2 {
+		t.Fatalf("Expected two log entries, but got %d: %s", len(actual), buffer)
+	}
+	if actual[0].Msg != "Processing alert" || actual[0].Alert != "NodeDown" {
+		t.Errorf("Expected the message and the 'alert' field, but got %+v", actual[0])
+	}
+	if actual[1].Msg != "Written by a library" {
+		t.Errorf("Expected the entry written with zap.L, but got %+v", actual[1])
+	}
+}
+
+// useBuffer replaces the global logger with one that writes to a buffer in the given format. It
+// returns the buffer, and a function that restores the previous logger.
+//
+func useBuffer(format logging.Format) (buffer *bytes.Buffer, restore func()) {
+	buffer = &bytes.Buffer{}
+	saved := L()
+	setLogger(newLogger(format, zapcore.AddSync(buffer)))
+	restore = func() {
+		setLogger(saved)
+	}
+	return
+}
+
+// setVerbosity changes the value of the -v flag of glog. It returns a function that restores the
+// previous value.
+//
+func setVerbosity(value string) (restore func()) {
+	saved := flag.Lookup("v").Value.String()
+	flag.Set("v", value)
+	restore = func() {
+		flag.Set("v", saved)
+	}
+	return
+}
+
+// parseEntries parses the JSON log entries written to the given buffer, one per line.
+//
+func parseEntries(t *testing.T, buffer *bytes.Buffer) []entry {
+	var entries []entry
+	for _, line := range bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var value entry
+		err := json.Unmarshal(line, &value)
+		if err != nil {
+			t.Fatalf("Can't parse log entry '%s': %s", line, err)
+		}
+		entries = append(entries, value)
+	}
+	return entries
+}
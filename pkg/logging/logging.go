@@ -0,0 +1,154 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to write log entries, either in the text format of glog
+// or in JSON format.
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Format represents the format of the log entries.
+//
+type Format string
+
+const (
+	// FormatText is the text format used by glog.
+	FormatText Format = "text"
+
+	// FormatJSON writes each log entry as a JSON object in a separate line, containing the level,
+	// the time stamp in seconds since the epoch, and the message.
+	FormatJSON Format = "json"
+)
+
+// ParseFormat checks that the given text is a valid log format and converts it.
+//
+func ParseFormat(text string) (format Format, err error) {
+	format = Format(text)
+	switch format {
+	case FormatText, FormatJSON:
+	default:
+		err = fmt.Errorf(
+			"Log format '%s' isn't valid, must be '%s' or '%s'",
+			text,
+			FormatText,
+			FormatJSON,
+		)
+	}
+	return
+}
+
+// entry is the representation of a log entry in JSON format.
+//
+type entry struct {
+	Level string `json:"level"`
+	Ts    int64  `json:"ts"`
+	Msg   string `json:"msg"`
+}
+
+var (
+	// The format of the log entries, and the writer used for the JSON format. The mutex protects
+	// them, and serializes the writes so that the entries aren't mixed.
+	format           = FormatText
+	output io.Writer = os.Stderr
+	mutex            = &sync.Mutex{}
+)
+
+// SetFormat sets the format of the log entries. The default is the text format of glog. It should
+// be called before anything is written to the log.
+//
+func SetFormat(value Format) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	format = value
+}
+
+// Infof writes an informative message to the log.
+//
+func Infof(msg string, args ...interface{}) {
+	write("info", msg, args)
+}
+
+// Warningf writes a warning message to the log.
+//
+func Warningf(msg string, args ...interface{}) {
+	write("warning", msg, args)
+}
+
+// Errorf writes an error message to the log.
+//
+func Errorf(msg string, args ...interface{}) {
+	write("error", msg, args)
+}
+
+// Verbose is the type returned by the V function. Its methods only write to the log when the
+// verbosity level is enabled.
+//
+type Verbose bool
+
+// V checks if the given verbosity level is enabled, using the -v flag of glog.
+//
+func V(level glog.Level) Verbose {
+	return Verbose(glog.V(level))
+}
+
+// Infof writes an informative message to the log if the verbosity level is enabled.
+//
+func (v Verbose) Infof(msg string, args ...interface{}) {
+	if v {
+		write("info", msg, args)
+	}
+}
+
+// write sends the log entry to glog, or writes it in JSON format.
+//
+func write(level, msg string, args []interface{}) {
+	text := fmt.Sprintf(msg, args...)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if format != FormatJSON {
+		// The depth is the number of calls between the caller and glog, so that glog reports
+		// the file and line of the caller:
+		switch level {
+		case "warning":
+			glog.WarningDepth(2, text)
+		case "error":
+			glog.ErrorDepth(2, text)
+		default:
+			glog.InfoDepth(2, text)
+		}
+		return
+	}
+	data, err := json.Marshal(&entry{
+		Level: level,
+		Ts:    time.Now().Unix(),
+		Msg:   text,
+	})
+	if err != nil {
+		glog.Errorf("Can't generate JSON log entry: %s", err)
+		return
+	}
+	output.Write(append(data, '\n'))
+}
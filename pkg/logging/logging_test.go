@@ -0,0 +1,99 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, text := range []string{"text", "json"} {
+		format, err := ParseFormat(text)
+		if err != nil {
+			t.Errorf("Expected format '%s' to be valid, but got '%s'", text, err)
+		}
+		if string(format) != text {
+			t.Errorf("Expected format '%s', but got '%s'", text, format)
+		}
+	}
+	_, err := ParseFormat("xml")
+	if err == nil {
+		t.Errorf("Expected an error for format 'xml'")
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	buffer, restore := useJSONBuffer()
+	defer restore()
+
+	before := time.Now().Unix()
+	Infof("Processing alert '%s'", "NodeDown")
+	Warningf("Job %d failed", 123)
+	Errorf("Can't connect")
+
+	lines := bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("Expected three log entries, but got %d: %s", len(lines), buffer.String())
+	}
+	expected := []entry{
+		{Level: "info", Msg: "Processing alert 'NodeDown'"},
+		{Level: "warning", Msg: "Job 123 failed"},
+		{Level: "error", Msg: "Can't connect"},
+	}
+	for i, line := range lines {
+		var actual entry
+		err := json.Unmarshal(line, &actual)
+		if err != nil {
+			t.Fatalf("Can't parse log entry '%s': %s", line, err)
+		}
+		if actual.Level != expected[i].Level || actual.Msg != expected[i].Msg {
+			t.Errorf("Expected entry %+v, but got %+v", expected[i], actual)
+		}
+		if actual.Ts < before {
+			t.Errorf("Expected time stamp after %d, but got %d", before, actual.Ts)
+		}
+	}
+}
+
+func TestJSONFormatDisabledVerbosity(t *testing.T) {
+	buffer, restore := useJSONBuffer()
+	defer restore()
+
+	V(10).Infof("Very detailed message")
+
+	if buffer.Len() != 0 {
+		t.Errorf("Expected nothing to be written, but got '%s'", buffer.String())
+	}
+}
+
+// useJSONBuffer configures the JSON format and replaces the output with a buffer. It returns the
+// buffer and a function that restores the original configuration.
+//
+func useJSONBuffer() (buffer *bytes.Buffer, restore func()) {
+	buffer = &bytes.Buffer{}
+	savedFormat, savedOutput := format, output
+	SetFormat(FormatJSON)
+	output = buffer
+	restore = func() {
+		SetFormat(savedFormat)
+		output = savedOutput
+	}
+	return
+}
@@ -105,6 +105,27 @@ func (m *ShortTermMemory) Has(item interface{}) bool {
 	return m.findMatchingCell(item) != nil
 }
 
+// Remove removes the given item from the memory, so that it is forgotten before it expires. It
+// returns true if the item was in the memory, and false otherwise.
+//
+func (m *ShortTermMemory) Remove(item interface{}) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.purgeExpiredCells()
+	cell := m.findMatchingCell(item)
+	if cell == nil {
+		return false
+	}
+	for idx := range m.cells {
+		if m.cells[idx] == cell {
+			m.cells[idx] = nil
+			m.cells = append(m.cells[:idx], m.cells[idx+1:]...)
+			break
+		}
+	}
+	return true
+}
+
 // Len returns the number of items inside the memory.
 //
 func (m *ShortTermMemory) Len() int {
@@ -114,6 +135,73 @@ func (m *ShortTermMemory) Len() int {
 	return len(m.cells)
 }
 
+// Range calls the given function for each item that is in the memory, with the time when it was
+// added or last updated. If the function returns false the iteration stops. The memory is locked
+// during the iteration, so the function must not call other methods of the memory.
+//
+func (m *ShortTermMemory) Range(f func(item interface{}, addedAt time.Time) bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.purgeExpiredCells()
+	now := time.Now()
+	for _, cell := range m.cells {
+		if now.Sub(cell.stamp) >= m.duration {
+			continue
+		}
+		if !f(cell.item, cell.stamp) {
+			return
+		}
+	}
+}
+
+// List returns a slice containing the items that are currently in the memory, from the oldest to
+// the most recently added or updated.
+//
+func (m *ShortTermMemory) List() []interface{} {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.purgeExpiredCells()
+	now := time.Now()
+	items := make([]interface{}, 0, len(m.cells))
+	for _, cell := range m.cells {
+		if now.Sub(cell.stamp) >= m.duration {
+			continue
+		}
+		items = append(items, cell.item)
+	}
+	return items
+}
+
+// ListWithStamps is like List, but it returns copies of the cells, so that the caller can also
+// get the time when each item was added or last updated.
+//
+func (m *ShortTermMemory) ListWithStamps() []ShortTermCell {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.purgeExpiredCells()
+	now := time.Now()
+	cells := make([]ShortTermCell, 0, len(m.cells))
+	for _, cell := range m.cells {
+		if now.Sub(cell.stamp) >= m.duration {
+			continue
+		}
+		cells = append(cells, *cell)
+	}
+	return cells
+}
+
+// Item returns the item stored in the cell.
+//
+func (c ShortTermCell) Item() interface{} {
+	return c.item
+}
+
+// Stamp returns the time when the item of the cell was added to the memory or last updated.
+//
+func (c ShortTermCell) Stamp() time.Time {
+	return c.stamp
+}
+
 // purgeExpiredCells finds the aged cells and removes them.
 //
 func (m *ShortTermMemory) purgeExpiredCells() {
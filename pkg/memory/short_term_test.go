@@ -179,6 +179,163 @@ func TestLenExpired(t *testing.T) {
 	}
 }
 
+func TestRangeSeesAllItems(t *testing.T) {
+	memory := makeMemory(t, 1*time.Hour)
+	before := time.Now()
+	memory.Add(&autoheal.AWXJobAction{Template: "First template"})
+	memory.Add(&autoheal.AWXJobAction{Template: "Second template"})
+	memory.Add(&autoheal.AWXJobAction{Template: "Third template"})
+
+	seen := make(map[string]bool)
+	memory.Range(func(item interface{}, addedAt time.Time) bool {
+		action := item.(*autoheal.AWXJobAction)
+		seen[action.Template] = true
+		if addedAt.Before(before) {
+			t.Errorf("Expected time of item '%s' to be after %s, but it is %s", action.Template, before, addedAt)
+		}
+		return true
+	})
+	for _, template := range []string{"First template", "Second template", "Third template"} {
+		if !seen[template] {
+			t.Errorf("Expected item '%s' to be seen", template)
+		}
+	}
+}
+
+func TestRangeStopsEarly(t *testing.T) {
+	memory := makeMemory(t, 1*time.Hour)
+	memory.Add(&autoheal.AWXJobAction{Template: "First template"})
+	memory.Add(&autoheal.AWXJobAction{Template: "Second template"})
+	memory.Add(&autoheal.AWXJobAction{Template: "Third template"})
+
+	calls := 0
+	memory.Range(func(item interface{}, addedAt time.Time) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("Expected one call, but got %d", calls)
+	}
+}
+
+func TestRangeSkipsExpiredItems(t *testing.T) {
+	memory := makeMemory(t, 1*time.Millisecond)
+	memory.Add(&autoheal.AWXJobAction{Template: "My template"})
+	time.Sleep(2 * time.Millisecond)
+
+	memory.Range(func(item interface{}, addedAt time.Time) bool {
+		t.Errorf("Expected no items, but got %v", item)
+		return true
+	})
+}
+
+func TestListReturnsItemsInOrder(t *testing.T) {
+	memory := makeMemory(t, 1*time.Hour)
+	memory.Add(&autoheal.AWXJobAction{Template: "First template"})
+	memory.Add(&autoheal.AWXJobAction{Template: "Second template"})
+
+	items := memory.List()
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, but got %d", len(items))
+	}
+	for i, template := range []string{"First template", "Second template"} {
+		action := items[i].(*autoheal.AWXJobAction)
+		if action.Template != template {
+			t.Errorf("Expected item %d to be '%s', but got '%s'", i, template, action.Template)
+		}
+	}
+}
+
+func TestListSkipsExpiredItems(t *testing.T) {
+	memory := makeMemory(t, 1*time.Millisecond)
+	memory.Add(&autoheal.AWXJobAction{Template: "My template"})
+	time.Sleep(2 * time.Millisecond)
+
+	items := memory.List()
+	if len(items) != 0 {
+		t.Errorf("Expected no items, but got %v", items)
+	}
+}
+
+func TestListWithStamps(t *testing.T) {
+	memory := makeMemory(t, 1*time.Hour)
+	before := time.Now()
+	memory.Add(&autoheal.AWXJobAction{Template: "My template"})
+	after := time.Now()
+
+	cells := memory.ListWithStamps()
+	if len(cells) != 1 {
+		t.Fatalf("Expected 1 cell, but got %d", len(cells))
+	}
+	action := cells[0].Item().(*autoheal.AWXJobAction)
+	if action.Template != "My template" {
+		t.Errorf("Expected template 'My template', but got '%s'", action.Template)
+	}
+	stamp := cells[0].Stamp()
+	if stamp.Before(before) || stamp.After(after) {
+		t.Errorf("Expected stamp between %s and %s, but got %s", before, after, stamp)
+	}
+}
+
+func TestRemoveExisting(t *testing.T) {
+	memory := makeMemory(t, 1*time.Hour)
+	memory.Add(&autoheal.AWXJobAction{Template: "First template"})
+	memory.Add(&autoheal.AWXJobAction{Template: "Second template"})
+	memory.Add(&autoheal.AWXJobAction{Template: "Third template"})
+
+	// An equal item, not the same pointer, should be enough to find it:
+	if !memory.Remove(&autoheal.AWXJobAction{Template: "Second template"}) {
+		t.Errorf("Expected the item to be found")
+	}
+	if memory.Has(&autoheal.AWXJobAction{Template: "Second template"}) {
+		t.Errorf("Expected the item to be forgotten")
+	}
+	if memory.Len() != 2 {
+		t.Errorf("Expected two items to remain, but got %d", memory.Len())
+	}
+	for _, template := range []string{"First template", "Third template"} {
+		if !memory.Has(&autoheal.AWXJobAction{Template: template}) {
+			t.Errorf("Expected item '%s' to be kept", template)
+		}
+	}
+}
+
+func TestRemoveNotExisting(t *testing.T) {
+	memory := makeMemory(t, 1*time.Hour)
+	memory.Add(&autoheal.AWXJobAction{Template: "My template"})
+	if memory.Remove(&autoheal.AWXJobAction{Template: "Your template"}) {
+		t.Errorf("Expected the item not to be found")
+	}
+	if memory.Len() != 1 {
+		t.Errorf("Expected one item to remain, but got %d", memory.Len())
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	memory := makeMemory(t, 1*time.Millisecond)
+	action := &autoheal.AWXJobAction{
+		Template: "My template",
+	}
+	memory.Add(action)
+	time.Sleep(2 * time.Millisecond)
+	if memory.Remove(action) {
+		t.Errorf("Expected expired item not to be found")
+	}
+}
+
+func TestAddAfterRemove(t *testing.T) {
+	memory := makeMemory(t, 1*time.Hour)
+	action := &autoheal.AWXJobAction{
+		Template: "My template",
+	}
+	memory.Add(action)
+	memory.Remove(action)
+	memory.Add(action)
+	if !memory.Has(action) {
+		t.Errorf("Expected the item to be remembered again")
+	}
+}
+
 func makeMemory(t *testing.T, duration time.Duration) *ShortTermMemory {
 	memory, err := NewShortTermMemoryBuilder().
 		Duration(duration).
@@ -0,0 +1,84 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the limiter used to bound the number of distinct values of the metric labels
+// that are copied from alerts.
+
+package metrics
+
+import (
+	"sync"
+)
+
+// OverflowValue is the label value that replaces the values rejected by a cardinality limiter.
+//
+const OverflowValue = "__overflow__"
+
+// CardinalityLimiter keeps a fixed size set of allowed values for one metric label, so that the
+// number of time series doesn't grow without bounds when the values come from alerts.
+//
+// The first values seen are allowed till the set is full, and after that any new value is
+// replaced with OverflowValue. Values are never removed from the set, because the time series
+// that use them have already been created and would still be exported, so replacing them with
+// new values would grow the number of time series again. It is safe to use from multiple
+// goroutines.
+//
+type CardinalityLimiter struct {
+	// The maximum number of values allowed, and the values that are already allowed:
+	maxValues int
+	values    map[string]bool
+
+	mutex *sync.Mutex
+}
+
+// NewCardinalityLimiter creates a limiter that allows at most the given number of values. A value
+// of zero or less means that there is no limit.
+//
+func NewCardinalityLimiter(maxValues int) *CardinalityLimiter {
+	return &CardinalityLimiter{
+		maxValues: maxValues,
+		values:    make(map[string]bool),
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// Limit returns the given value if it is allowed, or OverflowValue if it isn't.
+//
+func (l *CardinalityLimiter) Limit(value string) string {
+	if l.maxValues <= 0 {
+		return value
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.values[value] {
+		return value
+	}
+	if len(l.values) >= l.maxValues {
+		return OverflowValue
+	}
+	l.values[value] = true
+	return value
+}
+
+// Len returns the number of values currently allowed.
+//
+func (l *CardinalityLimiter) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.values)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCardinalityLimiterAllowsValuesBelowCap(t *testing.T) {
+	limiter := NewCardinalityLimiter(3)
+	for _, value := range []string{"NodeDown", "DiskFull", "NodeDown", "PodDown"} {
+		actual := limiter.Limit(value)
+		if actual != value {
+			t.Errorf("Expected value '%s' to be allowed, but got '%s'", value, actual)
+		}
+	}
+	if limiter.Len() != 3 {
+		t.Errorf("Expected 3 allowed values, but got %d", limiter.Len())
+	}
+}
+
+func TestCardinalityLimiterEnforcesCap(t *testing.T) {
+	limiter := NewCardinalityLimiter(2)
+	limiter.Limit("NodeDown")
+	limiter.Limit("DiskFull")
+
+	// Values beyond the cap are coalesced into the overflow value:
+	for _, value := range []string{"PodDown", "NetworkDown"} {
+		actual := limiter.Limit(value)
+		if actual != OverflowValue {
+			t.Errorf("Expected value '%s' to be replaced with '%s', but got '%s'", value, OverflowValue, actual)
+		}
+		if limiter.Len() > 2 {
+			t.Errorf("Expected at most 2 allowed values, but got %d", limiter.Len())
+		}
+	}
+}
+
+func TestCardinalityLimiterKeepsAllowedValues(t *testing.T) {
+	limiter := NewCardinalityLimiter(2)
+	limiter.Limit("NodeDown")
+	limiter.Limit("DiskFull")
+	for i := 0; i < 10; i++ {
+		limiter.Limit(fmt.Sprintf("Alert%d", i))
+	}
+
+	// The values allowed first are never replaced, as their time series already exist:
+	for _, value := range []string{"NodeDown", "DiskFull"} {
+		if actual := limiter.Limit(value); actual != value {
+			t.Errorf("Expected value '%s' to be still allowed, but got '%s'", value, actual)
+		}
+	}
+	if limiter.Len() != 2 {
+		t.Errorf("Expected 2 allowed values, but got %d", limiter.Len())
+	}
+}
+
+func TestCardinalityLimiterWithoutCap(t *testing.T) {
+	limiter := NewCardinalityLimiter(0)
+	for i := 0; i < 100; i++ {
+		value := fmt.Sprintf("Alert%d", i)
+		if actual := limiter.Limit(value); actual != value {
+			t.Errorf("Expected value '%s' to be allowed, but got '%s'", value, actual)
+		}
+	}
+}
+
+func TestCardinalityLimiterConcurrentUse(t *testing.T) {
+	limiter := NewCardinalityLimiter(10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				limiter.Limit(fmt.Sprintf("Alert%d", (i*100+j)%25))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if limiter.Len() > 10 {
+		t.Errorf("Expected at most 10 allowed values, but got %d", limiter.Len())
+	}
+}
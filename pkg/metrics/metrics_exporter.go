@@ -2,12 +2,41 @@ package metrics
 
 import (
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
+	alertsReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoheal_alerts_received_total",
+			Help: "Number of alerts received, by the alert manager that sent them",
+		},
+		[]string{"source"},
+	)
+	alertsSilenced = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "autoheal_alerts_silenced_total",
+			Help: "Number of alerts skipped because they are silenced in the alert manager",
+		},
+	)
+	receiverRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoheal_receiver_requests_total",
+			Help: "Number of requests received from the alert manager",
+		},
+		[]string{"method", "code"},
+	)
+	receiverRequestDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name: "autoheal_receiver_request_duration_seconds",
+			Help: "Time taken to handle the requests received from the alert manager",
+		},
+	)
 	actionsRequested = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "autoheal_actions_requested_total",
@@ -15,6 +44,20 @@ var (
 		},
 		[]string{"type", "rule", "alert"},
 	)
+	actionsBackpressure = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoheal_actions_backpressure_total",
+			Help: "Number of healing actions postponed because too many actions were already running",
+		},
+		[]string{"type"},
+	)
+	actionsDryRun = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoheal_dry_run_actions_total",
+			Help: "Number of healing actions written to the log instead of executed, because of the dry run mode",
+		},
+		[]string{"type", "rule"},
+	)
 	actionsLaunched = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "autoheal_actions_launched",
@@ -22,6 +65,94 @@ var (
 		},
 		[]string{"type", "template", "rule", "status"},
 	)
+	actionsLastJob = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "autoheal_actions_last_job_info",
+			Help: "URL of the last job launched by a healing action",
+		},
+		[]string{"type", "template", "rule", "job_url"},
+	)
+	actionDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "autoheal_action_duration_seconds",
+			Help: "Time taken by the action runners to execute the healing actions",
+		},
+		[]string{"rule", "action_type"},
+	)
+	actionFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoheal_action_failures_total",
+			Help: "Number of healing actions that the action runners failed to execute, by reason",
+		},
+		[]string{"rule", "action_type", "error_reason"},
+	)
+	awxJobsFinished = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoheal_awx_job_finished_total",
+			Help: "Number of AWX jobs finished, by final status",
+		},
+		[]string{"status", "rule"},
+	)
+
+	batchJobsFinished = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoheal_batch_job_finished_total",
+			Help: "Number of batch jobs finished, by final status",
+		},
+		[]string{"status"},
+	)
+
+	rulesReloadDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name: "autoheal_rules_reload_duration_seconds",
+			Help: "Time taken to reload the healing rules",
+		},
+	)
+	rulesReloads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoheal_rules_reload_total",
+			Help: "Number of reloads of the healing rules",
+		},
+		[]string{"result"},
+	)
+
+	configFilesLoaded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "autoheal_config_files_loaded",
+			Help: "Number of configuration files loaded during the last reload",
+		},
+	)
+	rulesLoaded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "autoheal_rules_loaded_total",
+			Help: "Number of healing rules loaded during the last reload",
+		},
+	)
+	configLastReload = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "autoheal_config_last_reload_timestamp_seconds",
+			Help: "Time of the last successful reload of the configuration, in seconds since the epoch",
+		},
+	)
+	awxCircuitState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "autoheal_awx_circuit_state",
+			Help: "State of the circuit breaker of each AWX server: 0 closed, 1 open, 2 half-open",
+		},
+		[]string{"server"},
+	)
+
+	// The last job URL reported for each combination of type, template and rule, so that the
+	// previous series can be removed and the cardinality of the metric stays bounded:
+	lastJobURLs      = make(map[[3]string]string)
+	lastJobURLsMutex = &sync.Mutex{}
+
+	// The limiter for the alert names used as label values, as they come from the alerts and there
+	// may be many of them:
+	alertNames = NewCardinalityLimiter(50)
+
+	// The limiter for the alert sources used as label values, as they come from request headers:
+	alertSources = NewCardinalityLimiter(50)
 )
 
 // Handle /metrics requsts, retrun a list of all exported metrics
@@ -30,10 +161,44 @@ func Handler() http.Handler {
 	return promhttp.Handler()
 }
 
+// SetMaxAlertNameValues sets the maximum number of distinct alert names that will be used as metric
+// label values. Other alert names are replaced with OverflowValue. The default is 50, and zero means
+// that there is no limit. It should be called before any metric is updated.
+//
+func SetMaxAlertNameValues(max int) {
+	alertNames = NewCardinalityLimiter(max)
+}
+
 // Init autoheal prometheus exported metrics
 //
 func InitExportedMetrics() {
-	prometheus.MustRegister(actionsRequested, actionsLaunched)
+	prometheus.MustRegister(collectors()...)
+}
+
+// collectors returns all the metrics exported by the auto-heal service.
+//
+func collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		alertsReceived,
+		alertsSilenced,
+		receiverRequests,
+		receiverRequestDuration,
+		actionsRequested,
+		actionsBackpressure,
+		actionsDryRun,
+		actionsLaunched,
+		actionsLastJob,
+		actionDuration,
+		actionFailures,
+		awxJobsFinished,
+		batchJobsFinished,
+		rulesReloadDuration,
+		rulesReloads,
+		configFilesLoaded,
+		rulesLoaded,
+		configLastReload,
+		awxCircuitState,
+	}
 }
 
 func ActionStarted(
@@ -74,12 +239,180 @@ func ActionCompleted(
 	).Inc()
 }
 
+// ActionJobURL records the URL of the last job launched for the given action type, template and
+// rule, replacing the previously recorded one.
+//
+func ActionJobURL(
+	actionType,
+	templateName,
+	ruleName,
+	url string,
+) {
+	lastJobURLsMutex.Lock()
+	defer lastJobURLsMutex.Unlock()
+
+	key := [3]string{actionType, templateName, ruleName}
+	if previous, ok := lastJobURLs[key]; ok {
+		actionsLastJob.Delete(
+			map[string]string{
+				"type":     actionType,
+				"template": templateName,
+				"rule":     ruleName,
+				"job_url":  previous,
+			},
+		)
+	}
+	lastJobURLs[key] = url
+	actionsLastJob.With(
+		map[string]string{
+			"type":     actionType,
+			"template": templateName,
+			"rule":     ruleName,
+			"job_url":  url,
+		},
+	).Set(1)
+}
+
+// ActionExecuted records how long an action runner took to execute a healing action of the given
+// type, triggered by the given rule. If the execution failed the reason should be a short value
+// that classifies the error, for example 'retryable', and it will be counted as a failure. An
+// empty reason means that the execution succeeded.
+//
+func ActionExecuted(actionType, rule string, duration time.Duration, reason string) {
+	actionDuration.With(
+		map[string]string{
+			"rule":        rule,
+			"action_type": actionType,
+		},
+	).Observe(duration.Seconds())
+	if reason != "" {
+		actionFailures.With(
+			map[string]string{
+				"rule":         rule,
+				"action_type":  actionType,
+				"error_reason": reason,
+			},
+		).Inc()
+	}
+}
+
+// AWXJobFinished records that an AWX job launched by the given rule has finished with the given
+// status, for example 'successful' or 'failed'.
+//
+func AWXJobFinished(status, rule string) {
+	awxJobsFinished.With(
+		map[string]string{
+			"status": status,
+			"rule":   rule,
+		},
+	).Inc()
+}
+
+// BatchJobFinished records that a batch job has finished with the given status, either 'succeeded'
+// or 'failed'.
+//
+func BatchJobFinished(status string) {
+	batchJobsFinished.With(
+		map[string]string{
+			"status": status,
+		},
+	).Inc()
+}
+
+// AlertReceived records that an alert has been received from the given source.
+//
+func AlertReceived(source string) {
+	alertsReceived.With(
+		map[string]string{
+			"source": alertSources.Limit(source),
+		},
+	).Inc()
+}
+
+// AlertSilenced records that an alert has been skipped because it is silenced in the alert manager.
+//
+func AlertSilenced() {
+	alertsSilenced.Inc()
+}
+
+// ReceiverRequest records that a request from the alert manager has been handled with the given
+// method and response status code, and how long it took.
+//
+func ReceiverRequest(method string, code int, duration time.Duration) {
+	receiverRequests.With(
+		map[string]string{
+			"method": method,
+			"code":   strconv.Itoa(code),
+		},
+	).Inc()
+	receiverRequestDuration.Observe(duration.Seconds())
+}
+
 func ActionRequested(actionType, rule, alert string) {
 	actionsRequested.With(
 		map[string]string{
 			"type":  actionType,
 			"rule":  rule,
-			"alert": alert,
+			"alert": alertNames.Limit(alert),
+		},
+	).Inc()
+}
+
+// ActionBackpressure records that a healing action of the given type has been postponed because
+// too many actions of that type were already running.
+//
+func ActionBackpressure(actionType string) {
+	actionsBackpressure.With(
+		map[string]string{
+			"type": actionType,
+		},
+	).Inc()
+}
+
+// ActionDryRun records that a healing action of the given type, triggered by the given rule, has
+// been written to the log instead of executed, because the dry run mode is enabled.
+//
+func ActionDryRun(actionType, rule string) {
+	actionsDryRun.With(
+		map[string]string{
+			"type": actionType,
+			"rule": rule,
+		},
+	).Inc()
+}
+
+// RulesReloaded records that the healing rules have been reloaded, how long it took, and whether
+// it failed.
+//
+func RulesReloaded(duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	rulesReloadDuration.Observe(duration.Seconds())
+	rulesReloads.With(
+		map[string]string{
+			"result": result,
 		},
 	).Inc()
 }
+
+// ConfigLoaded records that the configuration has been loaded successfully, with the given number
+// of files and healing rules.
+//
+func ConfigLoaded(files, rules int) {
+	configFilesLoaded.Set(float64(files))
+	rulesLoaded.Set(float64(rules))
+	configLastReload.Set(float64(time.Now().Unix()))
+}
+
+// AWXCircuitState records the state of the circuit breaker of the AWX server with the given name,
+// which is empty for the default server: 0 for closed, 1 for open and 2 for half-open.
+//
+func AWXCircuitState(server string, state int) {
+	awxCircuitState.With(
+		map[string]string{
+			"server": server,
+		},
+	).Set(float64(state))
+}
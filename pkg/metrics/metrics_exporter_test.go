@@ -0,0 +1,93 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCollectorsRegisteredOnce(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	for _, collector := range collectors() {
+		err := registry.Register(collector)
+		if err != nil {
+			t.Errorf("Can't register collector: %s", err)
+		}
+	}
+
+	// Registering them again should fail, as they are already registered:
+	for _, collector := range collectors() {
+		err := registry.Register(collector)
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			t.Errorf("Expected the collector to be already registered, but got '%v'", err)
+		}
+	}
+}
+
+func TestActionExecuted(t *testing.T) {
+	ActionExecuted("AWXJobAction", "executed-rule", 2*time.Second, "")
+	ActionExecuted("AWXJobAction", "executed-rule", 4*time.Second, "retryable")
+
+	metric := &dto.Metric{}
+	histogram := actionDuration.WithLabelValues("executed-rule", "AWXJobAction").(prometheus.Histogram)
+	err := histogram.Write(metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metric.GetHistogram().GetSampleCount() != 2 {
+		t.Errorf("Expected two duration samples, but got %d", metric.GetHistogram().GetSampleCount())
+	}
+	if metric.GetHistogram().GetSampleSum() != 6 {
+		t.Errorf("Expected a total duration of 6 seconds, but got %v", metric.GetHistogram().GetSampleSum())
+	}
+
+	metric = &dto.Metric{}
+	err = actionFailures.WithLabelValues("executed-rule", "AWXJobAction", "retryable").Write(metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metric.GetCounter().GetValue() != 1 {
+		t.Errorf("Expected one failure, but got %v", metric.GetCounter().GetValue())
+	}
+}
+
+func TestAWXJobFinished(t *testing.T) {
+	AWXJobFinished("failed", "my-rule")
+	AWXJobFinished("failed", "my-rule")
+	AWXJobFinished("successful", "my-rule")
+
+	expected := map[string]float64{
+		"successful": 1,
+		"failed":     2,
+		"cancelled":  0,
+	}
+	for status, count := range expected {
+		metric := &dto.Metric{}
+		err := awxJobsFinished.WithLabelValues(status, "my-rule").Write(metric)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := metric.GetCounter().GetValue()
+		if actual != count {
+			t.Errorf("Expected %v jobs finished with status '%s', but got %v", count, status, actual)
+		}
+	}
+}
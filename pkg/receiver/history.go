@@ -0,0 +1,233 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the implementation of the history where the healer stores the last alerts that
+// it processed, and the outcomes of the actions that they triggered.
+
+package receiver
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+)
+
+// ActionOutcome represents the result of trying to execute a healing action.
+//
+type ActionOutcome string
+
+const (
+	ActionOutcomeStarted   ActionOutcome = "started"
+	ActionOutcomeThrottled ActionOutcome = "throttled"
+	ActionOutcomeError     ActionOutcome = "error"
+	ActionOutcomeDryRun    ActionOutcome = "dryRun"
+)
+
+// HistoryEntry contains the details of an alert processed by the healer.
+//
+type HistoryEntry struct {
+	// The time when the alert was processed.
+	Received time.Time `json:"received"`
+
+	// The status of the alert.
+	Status alertmanager.AlertStatus `json:"status,omitempty"`
+
+	// The labels of the alert.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// The names of the rules that matched the alert.
+	Rules []string `json:"rules,omitempty"`
+
+	// The actions that were triggered by the alert.
+	Actions []*HistoryAction `json:"actions,omitempty"`
+
+	// The reason why the alert was ignored, if it wasn't processed.
+	Ignored string `json:"ignored,omitempty"`
+}
+
+// HistoryAction contains the details of an action triggered by an alert.
+//
+type HistoryAction struct {
+	// The name of the rule that contains the action.
+	Rule string `json:"rule"`
+
+	// The type of the action.
+	Type string `json:"type"`
+
+	// The outcome of the action.
+	Outcome ActionOutcome `json:"outcome"`
+
+	// The error message, if the outcome is an error.
+	Error string `json:"error,omitempty"`
+}
+
+// NewHistoryEntry creates a new history entry for the given alert, with the current time as the
+// received time.
+//
+func NewHistoryEntry(alert *alertmanager.Alert) *HistoryEntry {
+	e := new(HistoryEntry)
+	e.Received = time.Now()
+	e.Status = alert.Status
+	e.Labels = alert.Labels
+	return e
+}
+
+// AddRule adds the name of a rule that matched the alert.
+//
+func (e *HistoryEntry) AddRule(name string) {
+	e.Rules = append(e.Rules, name)
+}
+
+// AddAction adds the details of an action triggered by the alert. The error is only used when the
+// outcome is an error.
+//
+func (e *HistoryEntry) AddAction(rule, kind string, outcome ActionOutcome, err error) {
+	action := &HistoryAction{
+		Rule:    rule,
+		Type:    kind,
+		Outcome: outcome,
+	}
+	if err != nil {
+		action.Error = err.Error()
+	}
+	e.Actions = append(e.Actions, action)
+}
+
+// HasRule checks if the given rule matched the alert.
+//
+func (e *HistoryEntry) HasRule(name string) bool {
+	for _, rule := range e.Rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasStartedAction checks if an action of the given rule has been started for the alert.
+//
+func (e *HistoryEntry) HasStartedAction(rule string) bool {
+	for _, action := range e.Actions {
+		if action.Rule == rule && action.Outcome == ActionOutcomeStarted {
+			return true
+		}
+	}
+	return false
+}
+
+// HistoryBuilder builds history objects.
+//
+type HistoryBuilder struct {
+	// How many entries to remember.
+	size int
+}
+
+// History stores the last entries added to it, discarding the oldest ones when it is full.
+//
+type History struct {
+	// The entries are stored in a ring buffer, the next entry will be stored in the position
+	// indicated by the next field, and the count field indicates how many positions are in use.
+	entries []*HistoryEntry
+	next    int
+	count   int
+
+	// Mutex used to prevent simultaneous updates of the data structures.
+	mutex *sync.Mutex
+}
+
+// NewHistoryBuilder creates a builder that can create history objects.
+//
+func NewHistoryBuilder() *HistoryBuilder {
+	b := new(HistoryBuilder)
+	b.size = 100
+	return b
+}
+
+// Size sets how many entries the history will remember. The default is 100. Zero means that no
+// entry will be remembered.
+//
+func (b *HistoryBuilder) Size(size int) *HistoryBuilder {
+	b.size = size
+	return b
+}
+
+// Build creates a new history object with the configuration stored in the builder.
+//
+func (b *HistoryBuilder) Build() (h *History, err error) {
+	if b.size < 0 {
+		err = fmt.Errorf("The size of the history must be zero or positive, but it is %d", b.size)
+		return
+	}
+	h = new(History)
+	h.entries = make([]*HistoryEntry, b.size)
+	h.mutex = &sync.Mutex{}
+	return
+}
+
+// Add adds a new entry to the history, discarding the oldest one if the history is full. The entry
+// shouldn't be modified after adding it.
+//
+func (h *History) Add(entry *HistoryEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	size := len(h.entries)
+	if size == 0 {
+		return
+	}
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % size
+	if h.count < size {
+		h.count++
+	}
+}
+
+// Len returns the number of entries inside the history.
+//
+func (h *History) Len() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.count
+}
+
+// List returns the entries of the history, from the oldest to the newest.
+//
+func (h *History) List() []*HistoryEntry {
+	return h.Filter(time.Time{}, "")
+}
+
+// Filter returns the entries of the history that were received after the given time and that
+// matched the given rule, from the oldest to the newest. If the time is zero then entries aren't
+// filtered by time, and if the rule is empty then entries aren't filtered by rule.
+//
+func (h *History) Filter(since time.Time, rule string) []*HistoryEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	size := len(h.entries)
+	result := make([]*HistoryEntry, 0, h.count)
+	for i := 0; i < h.count; i++ {
+		entry := h.entries[(h.next-h.count+i+size)%size]
+		if !since.IsZero() && entry.Received.Before(since) {
+			continue
+		}
+		if rule != "" && !entry.HasRule(rule) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
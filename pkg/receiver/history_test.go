@@ -0,0 +1,104 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package receiver
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+)
+
+func TestHistoryKeepsNewestEntries(t *testing.T) {
+	history, err := NewHistoryBuilder().
+		Size(3).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		history.Add(makeEntry(fmt.Sprintf("alert%d", i), time.Now()))
+	}
+	if history.Len() != 3 {
+		t.Fatalf("Expected 3 entries but got %d", history.Len())
+	}
+	entries := history.List()
+	for i, entry := range entries {
+		expected := fmt.Sprintf("alert%d", i+2)
+		if entry.Labels["alertname"] != expected {
+			t.Errorf("Expected entry %d to be '%s' but got '%s'", i, expected, entry.Labels["alertname"])
+		}
+	}
+}
+
+func TestHistoryWithZeroSize(t *testing.T) {
+	history, err := NewHistoryBuilder().
+		Size(0).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	history.Add(makeEntry("alert0", time.Now()))
+	if history.Len() != 0 {
+		t.Errorf("Expected no entries but got %d", history.Len())
+	}
+}
+
+func TestHistoryWithNegativeSize(t *testing.T) {
+	_, err := NewHistoryBuilder().
+		Size(-1).
+		Build()
+	if err == nil {
+		t.Errorf("Expected an error but got nil")
+	}
+}
+
+func TestHistoryFilterSince(t *testing.T) {
+	history, _ := NewHistoryBuilder().Build()
+	now := time.Now()
+	history.Add(makeEntry("old", now.Add(-time.Hour)))
+	history.Add(makeEntry("new", now))
+	entries := history.Filter(now.Add(-time.Minute), "")
+	if len(entries) != 1 || entries[0].Labels["alertname"] != "new" {
+		t.Errorf("Expected only the new entry but got %+v", entries)
+	}
+}
+
+func TestHistoryFilterRule(t *testing.T) {
+	history, _ := NewHistoryBuilder().Build()
+	matched := makeEntry("matched", time.Now())
+	matched.AddRule("my-rule")
+	matched.AddAction("my-rule", "AWXJobAction", ActionOutcomeStarted, nil)
+	history.Add(matched)
+	history.Add(makeEntry("unmatched", time.Now()))
+	entries := history.Filter(time.Time{}, "my-rule")
+	if len(entries) != 1 || entries[0].Labels["alertname"] != "matched" {
+		t.Errorf("Expected only the matched entry but got %+v", entries)
+	}
+}
+
+func makeEntry(name string, received time.Time) *HistoryEntry {
+	entry := NewHistoryEntry(&alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": name,
+		},
+	})
+	entry.Received = received
+	return entry
+}
@@ -0,0 +1,47 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the function used to format the JSON documents received from the alert
+// manager before writing them to the log.
+
+package receiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// DefaultIndent is the number of spaces used to indent the JSON documents written to the log when
+// no other value is given.
+//
+const DefaultIndent = 2
+
+// Indent returns the given JSON document indented with the given number of spaces per level. If
+// the number of spaces is zero or less, or if the data isn't valid JSON, it is returned unchanged,
+// which is faster when the indentation isn't needed.
+//
+func Indent(data []byte, spaces int) []byte {
+	if spaces <= 0 {
+		return data
+	}
+	buffer := new(bytes.Buffer)
+	err := json.Indent(buffer, data, "", strings.Repeat(" ", spaces))
+	if err != nil {
+		return data
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,80 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package receiver
+
+import (
+	"testing"
+)
+
+func TestIndent(t *testing.T) {
+	data := []byte(`{"status":"firing","alerts":[{"labels":{"alertname":"NodeDown"}}]}`)
+	tests := []struct {
+		name     string
+		spaces   int
+		expected string
+	}{
+		{
+			name:   "Two spaces",
+			spaces: 2,
+			expected: `{
+  "status": "firing",
+  "alerts": [
+    {
+      "labels": {
+        "alertname": "NodeDown"
+      }
+    }
+  ]
+}`,
+		},
+		{
+			name:   "Four spaces",
+			spaces: 4,
+			expected: `{
+    "status": "firing",
+    "alerts": [
+        {
+            "labels": {
+                "alertname": "NodeDown"
+            }
+        }
+    ]
+}`,
+		},
+		{
+			name:     "Zero leaves raw JSON",
+			spaces:   0,
+			expected: string(data),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := string(Indent(data, test.spaces))
+			if actual != test.expected {
+				t.Errorf("Expected:\n%s\nBut got:\n%s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIndentInvalidJSON(t *testing.T) {
+	data := []byte(`{"status":`)
+	actual := string(Indent(data, 2))
+	if actual != string(data) {
+		t.Errorf("Expected invalid JSON to be returned unchanged, but got '%s'", actual)
+	}
+}
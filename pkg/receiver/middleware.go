@@ -0,0 +1,179 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the middlewares that wrap the handler of the requests sent by the alert
+// manager, and the chain used to compose them.
+
+package receiver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/openshift/autoheal/pkg/logging"
+	"github.com/openshift/autoheal/pkg/metrics"
+)
+
+// Middleware is a function that wraps an HTTP handler with additional processing, for example
+// checking authentication before calling it.
+//
+type Middleware func(http.Handler) http.Handler
+
+// MiddlewareChain is a list of middlewares that are applied together to a handler.
+//
+type MiddlewareChain struct {
+	middlewares []Middleware
+}
+
+// NewMiddlewareChain creates a chain with the given middlewares. The first middleware is the
+// outermost one, so it sees the requests before the rest.
+//
+func NewMiddlewareChain(middlewares ...Middleware) *MiddlewareChain {
+	c := new(MiddlewareChain)
+	c.middlewares = append(c.middlewares, middlewares...)
+	return c
+}
+
+// Then wraps the given handler with the middlewares of the chain and returns the result.
+//
+func (c *MiddlewareChain) Then(handler http.Handler) http.Handler {
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		handler = c.middlewares[i](handler)
+	}
+	return handler
+}
+
+// statusRecorder is a response writer that remembers the status code sent, so that middlewares
+// can use it after calling the wrapped handler.
+//
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// recordStatus wraps the given response writer in a status recorder, if it isn't one already.
+//
+func recordStatus(response http.ResponseWriter) *statusRecorder {
+	if recorder, ok := response.(*statusRecorder); ok {
+		return recorder
+	}
+	return &statusRecorder{
+		ResponseWriter: response,
+		status:         http.StatusOK,
+	}
+}
+
+// LoggingMiddleware writes to the log the method, path, remote address and response status of each
+// request, and how long it took to handle it.
+//
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		recorder := recordStatus(response)
+		start := time.Now()
+		next.ServeHTTP(recorder, request)
+		logging.V(2).Infof(
+			"Request '%s %s' from '%s' finished with status %d in %s",
+			request.Method,
+			request.URL.Path,
+			request.RemoteAddr,
+			recorder.status,
+			time.Since(start),
+		)
+	})
+}
+
+// MetricsMiddleware updates the metrics that count the requests and measure how long they take.
+//
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		recorder := recordStatus(response)
+		start := time.Now()
+		next.ServeHTTP(recorder, request)
+		metrics.ReceiverRequest(request.Method, recorder.status, time.Since(start))
+	})
+}
+
+// AuthMiddleware rejects the requests that don't have an Authorization header containing the given
+// bearer token. If the token is empty all the requests are accepted.
+//
+func AuthMiddleware(token string) Middleware {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		expected := []byte("Bearer " + token)
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			actual := []byte(strings.TrimSpace(request.Header.Get("Authorization")))
+			if subtle.ConstantTimeCompare(actual, expected) != 1 {
+				logging.Warningf(
+					"Request from '%s' doesn't contain the expected bearer token, will reject it",
+					request.RemoteAddr,
+				)
+				response.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(
+					response,
+					http.StatusText(http.StatusUnauthorized),
+					http.StatusUnauthorized,
+				)
+				return
+			}
+			next.ServeHTTP(response, request)
+		})
+	}
+}
+
+// RateLimitMiddleware rejects the requests that exceed the given number of requests per second. A
+// burst of up to one second worth of requests is allowed. If the rate is zero or negative all the
+// requests are accepted.
+//
+func RateLimitMiddleware(rps float64) Middleware {
+	return func(next http.Handler) http.Handler {
+		if rps <= 0 {
+			return next
+		}
+		burst := int(rps)
+		if burst < 1 {
+			burst = 1
+		}
+		limiter := rate.NewLimiter(rate.Limit(rps), burst)
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			if !limiter.Allow() {
+				logging.Warningf(
+					"Request from '%s' exceeds the rate limit of %g requests per second, will "+
+						"reject it",
+					request.RemoteAddr,
+					rps,
+				)
+				http.Error(
+					response,
+					http.StatusText(http.StatusTooManyRequests),
+					http.StatusTooManyRequests,
+				)
+				return
+			}
+			next.ServeHTTP(response, request)
+		})
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package receiver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/openshift/autoheal/pkg/metrics"
+)
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	var calls []string
+	tracer := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(response, request)
+			})
+		}
+	}
+	handler := NewMiddlewareChain(tracer("first"), tracer("second"), tracer("third")).
+		Then(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			calls = append(calls, "handler")
+		}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/alerts", nil))
+
+	expected := []string{"first", "second", "third", "handler"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected calls %v, but got %v", expected, calls)
+	}
+}
+
+func TestEmptyMiddlewareChain(t *testing.T) {
+	called := false
+	handler := NewMiddlewareChain().Then(http.HandlerFunc(
+		func(response http.ResponseWriter, request *http.Request) {
+			called = true
+		},
+	))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/alerts", nil))
+	if !called {
+		t.Errorf("Expected the handler to be called")
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		header   string
+		expected int
+	}{
+		{
+			name:     "Valid token",
+			token:    "my-token",
+			header:   "Bearer my-token",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "Wrong token",
+			token:    "my-token",
+			header:   "Bearer other-token",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "Missing header",
+			token:    "my-token",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "Wrong scheme",
+			token:    "my-token",
+			header:   "Basic my-token",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "No token configured",
+			expected: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := AuthMiddleware(test.token)(okHandler())
+			request := httptest.NewRequest(http.MethodPost, "/alerts", nil)
+			if test.header != "" {
+				request.Header.Set("Authorization", test.header)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.expected {
+				t.Errorf("Expected status %d, but got %d", test.expected, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := RateLimitMiddleware(2)(okHandler())
+
+	// The first two requests fit in the burst, the third one is rejected:
+	expected := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, code := range expected {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/alerts", nil))
+		if recorder.Code != code {
+			t.Errorf("Expected status %d for request %d, but got %d", code, i, recorder.Code)
+		}
+	}
+}
+
+func TestRateLimitMiddlewareWithoutLimit(t *testing.T) {
+	handler := RateLimitMiddleware(0)(okHandler())
+	for i := 0; i < 100; i++ {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/alerts", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for request %d, but got %d", http.StatusOK, i, recorder.Code)
+		}
+	}
+}
+
+func TestLoggingMiddlewarePreservesResponse(t *testing.T) {
+	handler := LoggingMiddleware(http.HandlerFunc(
+		func(response http.ResponseWriter, request *http.Request) {
+			http.Error(response, "Boom", http.StatusBadRequest)
+		},
+	))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/alerts", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, but got %d", http.StatusBadRequest, recorder.Code)
+	}
+	if recorder.Body.String() != "Boom\n" {
+		t.Errorf("Expected body 'Boom', but got '%s'", recorder.Body.String())
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	metrics.InitExportedMetrics()
+	before := receiverRequestsCount(t, "401")
+
+	// The metrics middleware is before the authentication, so rejected requests are counted:
+	handler := NewMiddlewareChain(
+		MetricsMiddleware,
+		AuthMiddleware("my-token"),
+	).Then(okHandler())
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/alerts", nil))
+	}
+
+	after := receiverRequestsCount(t, "401")
+	if after-before != 3 {
+		t.Errorf("Expected 3 rejected requests to be counted, but got %g", after-before)
+	}
+}
+
+func TestComposedChain(t *testing.T) {
+	handler := NewMiddlewareChain(
+		LoggingMiddleware,
+		MetricsMiddleware,
+		AuthMiddleware("my-token"),
+		RateLimitMiddleware(1),
+	).Then(okHandler())
+
+	// A request without the token is rejected before consuming the rate limit:
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/alerts", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+
+	// The first authenticated request is accepted and the second exceeds the rate limit:
+	for _, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodPost, "/alerts", nil)
+		request.Header.Set("Authorization", "Bearer my-token")
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != code {
+			t.Errorf("Expected status %d, but got %d", code, recorder.Code)
+		}
+	}
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusOK)
+	})
+}
+
+// receiverRequestsCount returns the number of requests with the given status code counted by the
+// receiver requests metric.
+//
+func receiverRequestsCount(t *testing.T, code string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "autoheal_receiver_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "code" && label.GetValue() == code {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the function used to parse the sizes given in the command line, like the
+// maximum size of the bodies of the requests sent by the alert manager.
+
+package receiver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxRequestBody is the maximum size, in bytes, of the bodies of the requests sent by the
+// alert manager when no other value is given.
+//
+const DefaultMaxRequestBody = 1000 * 1000
+
+// sizeSuffixes are the suffixes accepted by ParseSize, and the number of bytes that they multiply
+// the value by. Longer suffixes go first, so that 'B' doesn't match the end of 'KB'.
+//
+var sizeSuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// ParseSize parses a size given as a number of bytes followed by an optional SI suffix, like '512',
+// '512KB' or '2MB'. The suffixes are case insensitive, and they are powers of 1000, not of 1024.
+//
+func ParseSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, candidate := range sizeSuffixes {
+		if strings.HasSuffix(text, candidate.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, candidate.suffix))
+			multiplier = candidate.multiplier
+			break
+		}
+	}
+	number, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf(
+			"Size '%s' isn't valid, it should be a number of bytes optionally followed by "+
+				"'B', 'KB', 'MB' or 'GB'",
+			value,
+		)
+	}
+	return number * multiplier, nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package receiver
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"512KB", 512000},
+		{"2MB", 2000000},
+		{"1GB", 1000000000},
+		{"2mb", 2000000},
+		{" 4 KB ", 4000},
+	}
+	for _, test := range tests {
+		actual, err := ParseSize(test.value)
+		if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %s", test.value, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Expected '%s' to be %d bytes, but got %d", test.value, test.expected, actual)
+		}
+	}
+}
+
+func TestParseSizeRejectsInvalidValues(t *testing.T) {
+	for _, value := range []string{"", "MB", "-1KB", "1.5MB", "1TB", "one"} {
+		_, err := ParseSize(value)
+		if err == nil {
+			t.Errorf("Expected an error parsing '%s'", value)
+		}
+	}
+}
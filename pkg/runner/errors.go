@@ -0,0 +1,42 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the errors that action runners can return to change how the alert that
+// triggered the action is processed.
+
+package runner
+
+// RetryableError is the error returned by action runners when an action can't be executed now but
+// may succeed later, for example because too many actions are already running. The alert that
+// triggered the action is put back in the queue and processed again after a delay.
+//
+type RetryableError struct {
+	// Reason explains why the action can't be executed now.
+	Reason string
+}
+
+// Error returns the reason why the action can't be executed now.
+//
+func (e *RetryableError) Error() string {
+	return e.Reason
+}
+
+// IsRetryable checks if the given error is a RetryableError.
+//
+func IsRetryable(err error) bool {
+	_, ok := err.(*RetryableError)
+	return ok
+}
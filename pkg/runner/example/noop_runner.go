@@ -0,0 +1,66 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains an action runner that doesn't execute any action, it only writes to the log
+// the actions that it receives.
+
+package example
+
+import (
+	"github.com/golang/glog"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+// NoopRunner is an action runner that doesn't execute any action. Don't create instances directly,
+// use the NewNoopRunner function instead.
+//
+type NoopRunner struct {
+}
+
+// Make sure that the runner implements the action runner interface:
+var _ runner.ActionRunner = &NoopRunner{}
+
+// NewNoopRunner creates a new action runner that doesn't execute any action. To load it from a
+// plugin, return it from the NewActionRunner function of the plugin:
+//
+//	func ActionRunnerType() string {
+//		return "noop"
+//	}
+//
+//	func NewActionRunner() runner.ActionRunner {
+//		return example.NewNoopRunner()
+//	}
+//
+func NewNoopRunner() *NoopRunner {
+	return new(NoopRunner)
+}
+
+// RunAction writes to the log the names of the rule and the alert that triggered the action, and
+// returns without doing anything else. Real runners should check the type of the action, returning
+// an error if it isn't the expected one, and then execute it.
+//
+func (r *NoopRunner) RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error {
+	glog.Infof(
+		"Ignoring action of type '%T' for rule '%s' and alert '%s'",
+		action,
+		rule.ObjectMeta.Name,
+		alert.Name(),
+	)
+	return nil
+}
@@ -0,0 +1,36 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the definition of the action runner interface.
+
+package runner
+
+import (
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// ActionRunner is the interface that should be implemented by the objects that execute healing
+// actions. The runners included in the auto-heal service, and the ones loaded from plugins, all
+// implement it. See the example package for a minimal implementation.
+//
+type ActionRunner interface {
+	// RunAction executes the given action, triggered by the given rule and alert. The templates
+	// inside the action have already been processed. The type of the action depends on the
+	// runner, for example *autoheal.AWXJobAction for the AWX runner, *batch.Job for the batch
+	// runner and *autoheal.PluginAction for runners loaded from plugins.
+	RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error
+}
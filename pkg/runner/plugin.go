@@ -0,0 +1,153 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to load action runners from Go plugins.
+//
+// A plugin is a Go package compiled with `go build -buildmode=plugin`. It must export the following
+// two functions:
+//
+//	// ActionRunnerType returns the type of the actions that the runner executes. Rules select the
+//	// runner using this value in the `type` field of the `plugin` action.
+//	func ActionRunnerType() string
+//
+//	// NewActionRunner creates the action runner.
+//	func NewActionRunner() runner.ActionRunner
+//
+// The action passed to the RunAction method of the runner will be a *autoheal.PluginAction, with
+// all the templates already processed.
+//
+// Note that plugins must be compiled with exactly the same version of the Go compiler and of the
+// packages used by the auto-heal service, otherwise they can't be loaded.
+
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// The names of the symbols that plugins must export:
+const (
+	NewActionRunnerSymbol  = "NewActionRunner"
+	ActionRunnerTypeSymbol = "ActionRunnerType"
+)
+
+// LoadPlugins loads all the plugins, the files whose names end with .so, from the given directory,
+// in alphabetical order. The result is a map where the keys are the types of the action runners and
+// the values are the action runners.
+//
+func LoadPlugins(dir string) (runners map[string]ActionRunner, err error) {
+	// List the files in the directory:
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		err = fmt.Errorf("Can't read plugin directory '%s': %s", dir, err)
+		return
+	}
+	files := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".so") {
+			files = append(files, filepath.Join(dir, info.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	// Load the plugins:
+	runners = make(map[string]ActionRunner)
+	for _, file := range files {
+		var kind string
+		var runner ActionRunner
+		kind, runner, err = LoadPlugin(file)
+		if err != nil {
+			return
+		}
+		if _, ok := runners[kind]; ok {
+			err = fmt.Errorf(
+				"Plugin '%s' provides action runner type '%s', but it has already been "+
+					"provided by another plugin",
+				file,
+				kind,
+			)
+			return
+		}
+		runners[kind] = runner
+		glog.Infof("Loaded action runner type '%s' from plugin '%s'", kind, file)
+	}
+
+	return
+}
+
+// LoadPlugin loads the plugin from the given file, and returns the type of the action runner and
+// the action runner itself.
+//
+func LoadPlugin(file string) (kind string, runner ActionRunner, err error) {
+	plug, err := plugin.Open(file)
+	if err != nil {
+		err = fmt.Errorf("Can't open plugin '%s': %s", file, err)
+		return
+	}
+
+	// Get the type of the action runner:
+	symbol, err := plug.Lookup(ActionRunnerTypeSymbol)
+	if err != nil {
+		err = fmt.Errorf("Can't find symbol '%s' in plugin '%s': %s", ActionRunnerTypeSymbol, file, err)
+		return
+	}
+	kindFunc, ok := symbol.(func() string)
+	if !ok {
+		err = fmt.Errorf(
+			"Symbol '%s' in plugin '%s' is of type '%T', but expected 'func() string'",
+			ActionRunnerTypeSymbol,
+			file,
+			symbol,
+		)
+		return
+	}
+	kind = kindFunc()
+	if kind == "" {
+		err = fmt.Errorf("Plugin '%s' returned an empty action runner type", file)
+		return
+	}
+
+	// Create the action runner:
+	symbol, err = plug.Lookup(NewActionRunnerSymbol)
+	if err != nil {
+		err = fmt.Errorf("Can't find symbol '%s' in plugin '%s': %s", NewActionRunnerSymbol, file, err)
+		return
+	}
+	newFunc, ok := symbol.(func() ActionRunner)
+	if !ok {
+		err = fmt.Errorf(
+			"Symbol '%s' in plugin '%s' is of type '%T', but expected 'func() runner.ActionRunner'",
+			NewActionRunnerSymbol,
+			file,
+			symbol,
+		)
+		return
+	}
+	runner = newFunc()
+	if runner == nil {
+		err = fmt.Errorf("Plugin '%s' returned a nil action runner", file)
+		return
+	}
+
+	return
+}
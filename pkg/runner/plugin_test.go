@@ -0,0 +1,152 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The tests are in a separate package because plugins can only be loaded if the runner package is
+// exactly the same that they were built with, and that isn't true when it includes internal tests.
+
+package runner_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"plugin"
+	"runtime"
+	"strings"
+	"testing"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+func TestLoadPluginsMissingDir(t *testing.T) {
+	_, err := runner.LoadPlugins(filepath.Join("testdata", "missing"))
+	if err == nil {
+		t.Errorf("Loading plugins from a missing directory should fail")
+	}
+}
+
+func TestLoadPluginsEmptyDir(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	err := ioutil.WriteFile(filepath.Join(dir, "README.txt"), []byte("Not a plugin"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runners, err := runner.LoadPlugins(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runners) != 0 {
+		t.Errorf("Expected no runners, but got %d", len(runners))
+	}
+}
+
+func TestLoadPluginInvalidFile(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "invalid.so")
+	err := ioutil.WriteFile(file, []byte("Not a plugin"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runner.LoadPlugins(dir)
+	if err == nil {
+		t.Errorf("Loading an invalid plugin should fail")
+	}
+}
+
+func TestLoadPluginsRunsRecorder(t *testing.T) {
+	dir := makeTempDir(t)
+	defer os.RemoveAll(dir)
+	file := buildRecorderPlugin(t, dir)
+
+	runners, err := runner.LoadPlugins(dir)
+	if err != nil {
+		if strings.Contains(err.Error(), "different version of package") {
+			t.Skipf("Plugin was built with different flags than the test: %s", err)
+		}
+		t.Fatal(err)
+	}
+	recorder, ok := runners["recorder"]
+	if !ok {
+		t.Fatalf("Expected action runner type 'recorder', but got %v", runners)
+	}
+	rule := &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "my-rule",
+		},
+	}
+	err = recorder.RunAction(rule, &autoheal.PluginAction{}, &alertmanager.Alert{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the same file again returns the plugin that is already loaded, so its variables
+	// contain the calls made above:
+	plug, err := plugin.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbol, err := plug.Lookup("Calls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := *symbol.(*[]string)
+	if len(calls) != 1 || calls[0] != "my-rule" {
+		t.Errorf("Expected one call for rule 'my-rule', but got %v", calls)
+	}
+}
+
+// buildRecorderPlugin compiles the plugin in the testdata/recorder directory into the given
+// directory, and returns the path of the resulting file. The test is skipped if plugins can't be
+// built in this environment.
+//
+func buildRecorderPlugin(t *testing.T, dir string) string {
+	if testing.Short() {
+		t.Skip("Building plugins is slow, skipping in short mode")
+	}
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skipf("Plugins aren't supported in '%s'", runtime.GOOS)
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("The go tool isn't available")
+	}
+	cgo, err := exec.Command(goTool, "env", "CGO_ENABLED").Output()
+	if err != nil || strings.TrimSpace(string(cgo)) != "1" {
+		t.Skip("Plugins require cgo, but it isn't enabled")
+	}
+	file := filepath.Join(dir, "recorder.so")
+	build := exec.Command(goTool, "build", "-buildmode=plugin", "-o", file, "./testdata/recorder")
+	output, err := build.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Can't build plugin: %s\n%s", err, output)
+	}
+	return file
+}
+
+func makeTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
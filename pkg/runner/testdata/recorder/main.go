@@ -0,0 +1,46 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This is a plugin used by the tests. It provides an action runner of type 'recorder' that
+// remembers the names of the rules that it was asked to run.
+
+package main
+
+import (
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+type recorder struct {
+}
+
+func (r *recorder) RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error {
+	Calls = append(Calls, rule.ObjectMeta.Name)
+	return nil
+}
+
+// Calls contains the names of the rules that the runner has been asked to run.
+//
+var Calls []string
+
+func ActionRunnerType() string {
+	return "recorder"
+}
+
+func NewActionRunner() runner.ActionRunner {
+	return new(recorder)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package silence
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+)
+
+// silenceStateActive is the state of the silences that are currently in effect.
+//
+const silenceStateActive = "active"
+
+// client is the HTTP client used to query the alert manager. It has a timeout so that a slow alert
+// manager doesn't block the processing of alerts indefinitely.
+//
+var client = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// silence is used to unmarshal the silences returned by the v2 API of the alert manager. Only the
+// fields needed to check if a silence applies to an alert are included.
+//
+type silence struct {
+	ID       string     `json:"id,omitempty"`
+	Status   *status    `json:"status,omitempty"`
+	Matchers []*matcher `json:"matchers,omitempty"`
+}
+
+type status struct {
+	State string `json:"state,omitempty"`
+}
+
+// matcher is a condition on the value of one label. Note that IsEqual is a pointer because the
+// alert manager considers a missing value as true.
+//
+type matcher struct {
+	Name    string `json:"name,omitempty"`
+	Value   string `json:"value,omitempty"`
+	IsRegex bool   `json:"isRegex,omitempty"`
+	IsEqual *bool  `json:"isEqual,omitempty"`
+}
+
+// IsSilenced checks if the given alert is silenced by any of the active silences of the alert
+// manager whose address is given. The address is the base URL of the alert manager, without the
+// /api/v2 suffix.
+//
+func IsSilenced(alert *alertmanager.Alert, silenceURL string) (bool, error) {
+	silences, err := fetchSilences(alert, silenceURL)
+	if err != nil {
+		return false, err
+	}
+	for _, silence := range silences {
+		if silence.Status == nil || silence.Status.State != silenceStateActive {
+			continue
+		}
+		matches, err := silence.matches(alert)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fetchSilences retrieves from the alert manager the silences that refer to the name of the given
+// alert.
+//
+func fetchSilences(alert *alertmanager.Alert, silenceURL string) (silences []*silence, err error) {
+	query := url.Values{}
+	query.Set("filter", fmt.Sprintf("%s=%s", alertmanager.NameLabel(), alert.Name()))
+	address := strings.TrimSuffix(silenceURL, "/") + "/api/v2/silences?" + query.Encode()
+	response, err := client.Get(address)
+	if err != nil {
+		err = fmt.Errorf("Can't get silences from '%s': %s", address, err)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf(
+			"Can't get silences from '%s', response status is %d",
+			address,
+			response.StatusCode,
+		)
+		return
+	}
+	err = json.NewDecoder(response.Body).Decode(&silences)
+	if err != nil {
+		err = fmt.Errorf("Can't parse silences returned by '%s': %s", address, err)
+	}
+	return
+}
+
+// matches checks if all the matchers of the silence match the labels of the given alert.
+//
+func (s *silence) matches(alert *alertmanager.Alert) (bool, error) {
+	for _, m := range s.Matchers {
+		matches, err := m.matches(alert.Labels[m.Name])
+		if err != nil {
+			return false, fmt.Errorf("Can't check matcher '%s' of silence '%s': %s", m.Name, s.ID, err)
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matches checks if the given label value satisfies the matcher. Regular expressions are anchored,
+// like in the alert manager.
+//
+func (m *matcher) matches(value string) (bool, error) {
+	var equal bool
+	if m.IsRegex {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return false, err
+		}
+		equal = re.MatchString(value)
+	} else {
+		equal = value == m.Value
+	}
+	if m.IsEqual != nil && !*m.IsEqual {
+		return !equal, nil
+	}
+	return equal, nil
+}
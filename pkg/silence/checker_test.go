@@ -0,0 +1,224 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package silence
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+)
+
+// startSilenceServer starts a fake alert manager that returns the given silences, and checks that
+// they are requested with a filter for the given alert name.
+//
+func startSilenceServer(t *testing.T, alertName string, silences string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/silences" {
+			http.NotFound(w, r)
+			return
+		}
+		filter := r.URL.Query().Get("filter")
+		if filter != "alertname="+alertName {
+			t.Errorf("Expected filter 'alertname=%s', but got '%s'", alertName, filter)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(silences))
+	}))
+}
+
+func makeAlert() *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+			"instance":  "node0.example.com",
+		},
+	}
+}
+
+func TestIsSilenced(t *testing.T) {
+	tests := []struct {
+		name     string
+		silences string
+		expected bool
+	}{
+		{
+			name:     "No silences",
+			silences: `[]`,
+			expected: false,
+		},
+		{
+			name: "Active silence matches",
+			silences: `[{
+				"id": "1",
+				"status": {"state": "active"},
+				"matchers": [
+					{"name": "alertname", "value": "NodeDown", "isRegex": false},
+					{"name": "instance", "value": "node0.example.com", "isRegex": false}
+				]
+			}]`,
+			expected: true,
+		},
+		{
+			name: "Expired silence is ignored",
+			silences: `[{
+				"id": "1",
+				"status": {"state": "expired"},
+				"matchers": [
+					{"name": "alertname", "value": "NodeDown", "isRegex": false}
+				]
+			}]`,
+			expected: false,
+		},
+		{
+			name: "Pending silence is ignored",
+			silences: `[{
+				"id": "1",
+				"status": {"state": "pending"},
+				"matchers": [
+					{"name": "alertname", "value": "NodeDown", "isRegex": false}
+				]
+			}]`,
+			expected: false,
+		},
+		{
+			name: "Other label value doesn't match",
+			silences: `[{
+				"id": "1",
+				"status": {"state": "active"},
+				"matchers": [
+					{"name": "alertname", "value": "NodeDown", "isRegex": false},
+					{"name": "instance", "value": "node1.example.com", "isRegex": false}
+				]
+			}]`,
+			expected: false,
+		},
+		{
+			name: "Regular expression matches",
+			silences: `[{
+				"id": "1",
+				"status": {"state": "active"},
+				"matchers": [
+					{"name": "instance", "value": "node[0-9]\\.example\\.com", "isRegex": true}
+				]
+			}]`,
+			expected: true,
+		},
+		{
+			name: "Regular expression is anchored",
+			silences: `[{
+				"id": "1",
+				"status": {"state": "active"},
+				"matchers": [
+					{"name": "instance", "value": "node0", "isRegex": true}
+				]
+			}]`,
+			expected: false,
+		},
+		{
+			name: "Negative matcher",
+			silences: `[{
+				"id": "1",
+				"status": {"state": "active"},
+				"matchers": [
+					{"name": "alertname", "value": "NodeDown", "isRegex": false},
+					{"name": "instance", "value": "node1.example.com", "isRegex": false, "isEqual": false}
+				]
+			}]`,
+			expected: true,
+		},
+		{
+			name: "One of several silences matches",
+			silences: `[
+				{
+					"id": "1",
+					"status": {"state": "active"},
+					"matchers": [
+						{"name": "instance", "value": "node1.example.com", "isRegex": false}
+					]
+				},
+				{
+					"id": "2",
+					"status": {"state": "active"},
+					"matchers": [
+						{"name": "instance", "value": "node0.example.com", "isRegex": false}
+					]
+				}
+			]`,
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := startSilenceServer(t, "NodeDown", test.silences)
+			defer server.Close()
+			actual, err := IsSilenced(makeAlert(), server.URL)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if actual != test.expected {
+				t.Errorf("Expected silenced to be %v, but got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIsSilencedWithTrailingSlash(t *testing.T) {
+	server := startSilenceServer(t, "NodeDown", `[{
+		"id": "1",
+		"status": {"state": "active"},
+		"matchers": [
+			{"name": "alertname", "value": "NodeDown", "isRegex": false}
+		]
+	}]`)
+	defer server.Close()
+	actual, err := IsSilenced(makeAlert(), server.URL+"/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !actual {
+		t.Errorf("Expected the alert to be silenced")
+	}
+}
+
+func TestIsSilencedServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	_, err := IsSilenced(makeAlert(), server.URL)
+	if err == nil {
+		t.Errorf("Expected an error when the alert manager fails")
+	}
+}
+
+func TestIsSilencedInvalidRegularExpression(t *testing.T) {
+	server := startSilenceServer(t, "NodeDown", `[{
+		"id": "1",
+		"status": {"state": "active"},
+		"matchers": [
+			{"name": "instance", "value": "node(", "isRegex": true}
+		]
+	}]`)
+	defer server.Close()
+	_, err := IsSilenced(makeAlert(), server.URL)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid regular expression")
+	}
+}
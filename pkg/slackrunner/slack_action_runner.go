@@ -0,0 +1,237 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the action runner that sends the messages described by Slack actions using
+// the incoming webhooks API.
+
+package slackrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+// WebhookURLKey is the key of the secret referenced by a Slack action that contains the URL of the
+// incoming webhook.
+//
+const WebhookURLKey = "webhookURL"
+
+// maxErrorBodySize is the maximum number of bytes of the response body that are included in the
+// error returned when Slack responds with an error status.
+//
+const maxErrorBodySize = 1024
+
+type Builder struct {
+	k8sClient kubernetes.Interface
+	timeout   time.Duration
+}
+
+type Runner struct {
+	// The Kubernetes client used to load the secrets that contain the webhook URLs. It is
+	// optional, and actions that reference a secret will fail if it isn't available.
+	k8sClient kubernetes.Interface
+
+	// The HTTP client used to send the messages.
+	client *http.Client
+}
+
+// Payload is the body of the requests sent to the Slack incoming webhooks API.
+//
+type Payload struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text"`
+}
+
+func NewBuilder() *Builder {
+	b := new(Builder)
+	b.timeout = 30 * time.Second
+	return b
+}
+
+// KubernetesClient sets the Kubernetes client that will be used to load the secrets that contain
+// the webhook URLs. It is optional, but actions that reference a secret will fail without it.
+//
+func (b *Builder) KubernetesClient(k8sClient kubernetes.Interface) *Builder {
+	b.k8sClient = k8sClient
+	return b
+}
+
+// Timeout sets how long to wait for the response of Slack. The default is thirty seconds.
+//
+func (b *Builder) Timeout(timeout time.Duration) *Builder {
+	b.timeout = timeout
+	return b
+}
+
+func (b *Builder) Build() (*Runner, error) {
+	if b.timeout <= 0 {
+		return nil, fmt.Errorf("The Slack timeout must be positive, but it is %s", b.timeout)
+	}
+
+	runner := &Runner{
+		k8sClient: b.k8sClient,
+		client: &http.Client{
+			Timeout: b.timeout,
+		},
+	}
+
+	return runner, nil
+}
+
+// Make sure that the runner implements the action runner interface:
+var _ runner.ActionRunner = &Runner{}
+
+// RunAction sends the message described by the given *autoheal.SlackAction. The templates inside
+// the action have already been processed. Responses with a status code that isn't 2xx are reported
+// as errors.
+//
+func (r *Runner) RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error {
+	slack := action.(*autoheal.SlackAction)
+
+	// Find the URL of the webhook, the one from the secret takes precedence:
+	url := slack.WebhookURL
+	if slack.SecretRef != nil {
+		var err error
+		url, err = r.loadWebhookURL(slack.SecretRef)
+		if err != nil {
+			return err
+		}
+	}
+	if url == "" {
+		return fmt.Errorf(
+			"Can't send Slack message for rule '%s' because it doesn't have a webhook URL",
+			rule.ObjectMeta.Name,
+		)
+	}
+
+	// Create the request:
+	body, err := json.Marshal(MakePayload(slack, alert))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	// Send the request. Note that the URL isn't written to the log, because it contains the
+	// credentials of the webhook:
+	glog.Infof(
+		"Sending Slack message for rule '%s' and alert '%s'",
+		rule.ObjectMeta.Name,
+		alert.Name(),
+	)
+	response, err := r.client.Do(request)
+	if err != nil {
+		return fmt.Errorf(
+			"Can't send Slack message for rule '%s': %s",
+			rule.ObjectMeta.Name,
+			err,
+		)
+	}
+	defer response.Body.Close()
+
+	// Check the response:
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		return fmt.Errorf(
+			"Slack message for rule '%s' failed with status code %d: %s",
+			rule.ObjectMeta.Name,
+			response.StatusCode,
+			strings.TrimSpace(string(data)),
+		)
+	}
+	glog.Infof(
+		"Slack message for rule '%s' succeeded with status code %d",
+		rule.ObjectMeta.Name,
+		response.StatusCode,
+	)
+
+	return nil
+}
+
+// MakePayload creates the body of the request that sends the message of the given action. When the
+// action has a title it is written in bold in the first line of the text. When it doesn't have a
+// message the text describes the alert.
+//
+func MakePayload(slack *autoheal.SlackAction, alert *alertmanager.Alert) *Payload {
+	text := slack.Message
+	if text == "" {
+		text = fmt.Sprintf("Alert '%s' is %s", alert.Name(), alert.Status)
+		summary := alert.Annotations["summary"]
+		if summary != "" {
+			text += ": " + summary
+		}
+	}
+	if slack.TitleTemplate != "" {
+		text = fmt.Sprintf("*%s*\n%s", slack.TitleTemplate, text)
+	}
+	return &Payload{
+		Channel: slack.Channel,
+		Text:    text,
+	}
+}
+
+// loadWebhookURL loads the URL of the incoming webhook from the secret with the given reference.
+//
+func (r *Runner) loadWebhookURL(reference *core.SecretReference) (string, error) {
+	if reference.Name == "" || reference.Namespace == "" {
+		return "", fmt.Errorf("The name and the namespace of the Slack webhook secret are mandatory")
+	}
+	if r.k8sClient == nil {
+		return "", fmt.Errorf(
+			"Can't load Slack webhook URL from secret '%s/%s' because there is no connection to "+
+				"the Kubernetes API",
+			reference.Namespace,
+			reference.Name,
+		)
+	}
+	secret, err := r.k8sClient.CoreV1().Secrets(reference.Namespace).Get(reference.Name, meta.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf(
+			"Can't load Slack webhook URL from secret '%s/%s': %s",
+			reference.Namespace,
+			reference.Name,
+			err,
+		)
+	}
+	url, ok := secret.Data[WebhookURLKey]
+	if !ok {
+		return "", fmt.Errorf(
+			"Secret '%s/%s' doesn't contain the '%s' key",
+			reference.Namespace,
+			reference.Name,
+			WebhookURLKey,
+		)
+	}
+	return strings.TrimSpace(string(url)), nil
+}
@@ -0,0 +1,255 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package slackrunner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestRunActionSendsPayload(t *testing.T) {
+	var method, contentType string
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		contentType = r.Header.Get("Content-Type")
+		data, _ := ioutil.ReadAll(r.Body)
+		err := json.Unmarshal(data, &payload)
+		if err != nil {
+			t.Errorf("Expected the body to be valid JSON, but got '%s': %s", data, err)
+		}
+	}))
+	defer server.Close()
+
+	action := &autoheal.SlackAction{
+		WebhookURL:    server.URL,
+		Channel:       "#ops",
+		TitleTemplate: "Node down",
+		Message:       "Restarting node0",
+	}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPost {
+		t.Errorf("Expected method POST, but got '%s'", method)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Expected content type 'application/json', but got '%s'", contentType)
+	}
+	expected := map[string]interface{}{
+		"channel": "#ops",
+		"text":    "*Node down*\nRestarting node0",
+	}
+	for key, value := range expected {
+		if payload[key] != value {
+			t.Errorf("Expected '%s' to be '%v', but got '%v'", key, value, payload[key])
+		}
+	}
+}
+
+func TestRunActionOmitsEmptyChannel(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	action := &autoheal.SlackAction{
+		WebhookURL: server.URL,
+		Message:    "Restarting node0",
+	}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload["channel"]; ok {
+		t.Errorf("Expected no channel, but got '%v'", payload["channel"])
+	}
+	if payload["text"] != "Restarting node0" {
+		t.Errorf("Expected text 'Restarting node0', but got '%v'", payload["text"])
+	}
+}
+
+func TestMakePayloadDefaultMessage(t *testing.T) {
+	alert := makeAlert()
+	alert.Annotations = map[string]string{
+		"summary": "Node node0 isn't ready",
+	}
+	payload := MakePayload(&autoheal.SlackAction{}, alert)
+	expected := "Alert 'NodeDown' is firing: Node node0 isn't ready"
+	if payload.Text != expected {
+		t.Errorf("Expected text '%s', but got '%s'", expected, payload.Text)
+	}
+}
+
+func TestRunActionReportsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	action := &autoheal.SlackAction{
+		WebhookURL: server.URL,
+	}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err == nil {
+		t.Fatalf("Expected an error for status 400")
+	}
+	expected := "Slack message for rule 'notify-ops' failed with status code 400: invalid_payload"
+	if err.Error() != expected {
+		t.Errorf("Expected error '%s', but got '%s'", expected, err)
+	}
+}
+
+func TestRunActionRequiresWebhookURL(t *testing.T) {
+	action := &autoheal.SlackAction{
+		Message: "Restarting node0",
+	}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err == nil {
+		t.Errorf("Expected an error for an action without webhook URL")
+	}
+}
+
+func TestRunActionLoadsWebhookURLFromSecret(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	secrets := &fakeSecrets{
+		items: map[string]*core.Secret{
+			"my-namespace/slack-webhook": {
+				Data: map[string][]byte{
+					WebhookURLKey: []byte(server.URL + "\n"),
+				},
+			},
+		},
+	}
+	action := &autoheal.SlackAction{
+		WebhookURL: "http://example.invalid/ignored",
+		SecretRef: &core.SecretReference{
+			Namespace: "my-namespace",
+			Name:      "slack-webhook",
+		},
+	}
+	err := makeRunner(t, secrets).RunAction(makeRule(action), action, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Errorf("Expected the message to be sent to the URL from the secret")
+	}
+}
+
+func TestRunActionFailsWithMissingSecret(t *testing.T) {
+	action := &autoheal.SlackAction{
+		SecretRef: &core.SecretReference{
+			Namespace: "my-namespace",
+			Name:      "missing",
+		},
+	}
+	err := makeRunner(t, &fakeSecrets{}).RunAction(makeRule(action), action, makeAlert())
+	if err == nil {
+		t.Errorf("Expected an error when the secret doesn't exist")
+	}
+}
+
+func makeRunner(t *testing.T, secrets *fakeSecrets) *Runner {
+	builder := NewBuilder()
+	if secrets != nil {
+		builder.KubernetesClient(&fakeSecretsClient{secrets: secrets})
+	}
+	runner, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func makeRule(action *autoheal.SlackAction) *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "notify-ops",
+		},
+		SlackJob: action,
+	}
+}
+
+func makeAlert() *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Status: alertmanager.AlertStatusFiring,
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+}
+
+// fakeSecretsClient is a Kubernetes client that only implements the parts of the API used to load
+// secrets. Calling any other method will panic.
+//
+type fakeSecretsClient struct {
+	kubernetes.Interface
+	secrets *fakeSecrets
+}
+
+func (c *fakeSecretsClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeCoreV1{secrets: c.secrets}
+}
+
+type fakeCoreV1 struct {
+	corev1.CoreV1Interface
+	secrets *fakeSecrets
+}
+
+func (c *fakeCoreV1) Secrets(namespace string) corev1.SecretInterface {
+	return &fakeNamespacedSecrets{secrets: c.secrets, namespace: namespace}
+}
+
+// fakeSecrets keeps the secrets in memory, indexed by namespace and name.
+//
+type fakeSecrets struct {
+	items map[string]*core.Secret
+}
+
+type fakeNamespacedSecrets struct {
+	corev1.SecretInterface
+	secrets   *fakeSecrets
+	namespace string
+}
+
+func (s *fakeNamespacedSecrets) Get(name string, options meta.GetOptions) (*core.Secret, error) {
+	secret, ok := s.secrets.items[s.namespace+"/"+name]
+	if !ok {
+		return nil, errors.NewNotFound(core.Resource("secrets"), name)
+	}
+	return secret, nil
+}
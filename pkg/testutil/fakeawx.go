@@ -0,0 +1,278 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/openshift/autoheal/pkg/awxrunner"
+	"github.com/openshift/autoheal/pkg/config"
+)
+
+// FakeAWXLaunchResponse is the response that the fake AWX connection returns when a job is launched
+// from a template.
+//
+type FakeAWXLaunchResponse struct {
+	// The identifier of the job created.
+	Job int
+
+	// The error returned instead of launching the job. Nil means that the job is launched.
+	Error error
+}
+
+// FakeAWXLaunch contains the details of one of the jobs launched using the fake AWX connection.
+//
+type FakeAWXLaunch struct {
+	Template  string
+	ExtraVars map[string]interface{}
+	Limit     string
+
+	// Workflow is true when the job was launched from a workflow job template.
+	Workflow bool
+}
+
+// FakeAWXConnection implements the awxrunner.Connection interface without talking to a real AWX
+// server. The templates that exist are the keys of the Templates map, and the values are the
+// responses returned when jobs are launched from them.
+//
+type FakeAWXConnection struct {
+	// The responses for the templates that exist, indexed by template name.
+	Templates map[string]*FakeAWXLaunchResponse
+
+	// The responses for the workflow templates that exist, indexed by template name.
+	WorkflowTemplates map[string]*FakeAWXLaunchResponse
+
+	// The statuses of the jobs, indexed by job identifier. Jobs that aren't in this map are
+	// reported as running.
+	JobStatuses map[int]string
+
+	// The identifiers of the jobs that the fake server doesn't know.
+	MissingJobs map[int]bool
+
+	// The statuses of the workflow jobs, indexed by workflow job identifier. Workflow jobs that
+	// aren't in this map are reported as running.
+	WorkflowJobStatuses map[int]string
+
+	mutex                 *sync.Mutex
+	launches              []*FakeAWXLaunch
+	cancellations         []int
+	workflowCancellations []int
+	addresses             []string
+}
+
+// NewFakeAWXConnection creates a fake AWX connection that knows the given templates.
+//
+func NewFakeAWXConnection(templates map[string]*FakeAWXLaunchResponse) *FakeAWXConnection {
+	return &FakeAWXConnection{
+		Templates:           templates,
+		WorkflowTemplates:   make(map[string]*FakeAWXLaunchResponse),
+		JobStatuses:         make(map[int]string),
+		MissingJobs:         make(map[int]bool),
+		WorkflowJobStatuses: make(map[int]string),
+		mutex:               &sync.Mutex{},
+	}
+}
+
+// Factory returns a connection factory, suitable for the ConnectionFactory method of the AWX runner
+// builder, that always returns this fake connection.
+//
+func (c *FakeAWXConnection) Factory() awxrunner.ConnectionFactory {
+	return func(_ *config.AWXConfig, address string) (awxrunner.Connection, error) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.addresses = append(c.addresses, address)
+		return c, nil
+	}
+}
+
+// Addresses returns the AWX addresses passed to the connection factory, in the order that the
+// connections were created.
+//
+func (c *FakeAWXConnection) Addresses() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	addresses := make([]string, len(c.addresses))
+	copy(addresses, c.addresses)
+	return addresses
+}
+
+// FindTemplates returns the template with the given name if it is one of the keys of the Templates
+// map, regardless of the project.
+//
+func (c *FakeAWXConnection) FindTemplates(project, name string) ([]*awxrunner.Template, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.Templates[name]; !ok {
+		return []*awxrunner.Template{}, nil
+	}
+	template := &awxrunner.Template{
+		Name:             name,
+		AskLimitOnLaunch: true,
+		AskVarsOnLaunch:  true,
+	}
+	return []*awxrunner.Template{template}, nil
+}
+
+// LaunchTemplate records the launch and returns the response configured for the template.
+//
+func (c *FakeAWXConnection) LaunchTemplate(template *awxrunner.Template, extraVars map[string]interface{},
+	limit string) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	response, ok := c.Templates[template.Name]
+	if !ok {
+		return 0, fmt.Errorf("Template '%s' doesn't exist", template.Name)
+	}
+	if response.Error != nil {
+		return 0, response.Error
+	}
+	c.launches = append(c.launches, &FakeAWXLaunch{
+		Template:  template.Name,
+		ExtraVars: extraVars,
+		Limit:     limit,
+	})
+	return response.Job, nil
+}
+
+// FindWorkflowTemplates returns the workflow template with the given name if it is one of the keys
+// of the WorkflowTemplates map.
+//
+func (c *FakeAWXConnection) FindWorkflowTemplates(name string) ([]*awxrunner.Template, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.WorkflowTemplates[name]; !ok {
+		return []*awxrunner.Template{}, nil
+	}
+	template := &awxrunner.Template{
+		Name:             name,
+		AskLimitOnLaunch: true,
+		AskVarsOnLaunch:  true,
+	}
+	return []*awxrunner.Template{template}, nil
+}
+
+// LaunchWorkflowTemplate records the launch and returns the response configured for the workflow
+// template.
+//
+func (c *FakeAWXConnection) LaunchWorkflowTemplate(template *awxrunner.Template,
+	extraVars map[string]interface{}, limit string) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	response, ok := c.WorkflowTemplates[template.Name]
+	if !ok {
+		return 0, fmt.Errorf("Workflow template '%s' doesn't exist", template.Name)
+	}
+	if response.Error != nil {
+		return 0, response.Error
+	}
+	c.launches = append(c.launches, &FakeAWXLaunch{
+		Template:  template.Name,
+		ExtraVars: extraVars,
+		Limit:     limit,
+		Workflow:  true,
+	})
+	return response.Job, nil
+}
+
+// JobStatus returns the status of the given job from the JobStatuses map, or 'running' if it isn't
+// in that map. If the job is in the MissingJobs map it returns a *awxrunner.JobNotFoundError.
+//
+func (c *FakeAWXConnection) JobStatus(job int) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.MissingJobs[job] {
+		return "", &awxrunner.JobNotFoundError{Job: job}
+	}
+	status, ok := c.JobStatuses[job]
+	if !ok {
+		status = "running"
+	}
+	return status, nil
+}
+
+// CancelJob records the cancellation of the given job. If the job is in the MissingJobs map it
+// returns a *awxrunner.JobNotFoundError.
+//
+func (c *FakeAWXConnection) CancelJob(job int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.MissingJobs[job] {
+		return &awxrunner.JobNotFoundError{Job: job}
+	}
+	c.cancellations = append(c.cancellations, job)
+	return nil
+}
+
+// WorkflowJobStatus returns the status of the given workflow job from the WorkflowJobStatuses map,
+// or 'running' if it isn't in that map.
+//
+func (c *FakeAWXConnection) WorkflowJobStatus(job int) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	status, ok := c.WorkflowJobStatuses[job]
+	if !ok {
+		status = "running"
+	}
+	return status, nil
+}
+
+// CancelWorkflowJob records the cancellation of the given workflow job.
+//
+func (c *FakeAWXConnection) CancelWorkflowJob(job int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.workflowCancellations = append(c.workflowCancellations, job)
+	return nil
+}
+
+// Close does nothing, the fake connection can be used again after closing it.
+//
+func (c *FakeAWXConnection) Close() {
+}
+
+// Launches returns the jobs launched so far, in the order they were launched.
+//
+func (c *FakeAWXConnection) Launches() []*FakeAWXLaunch {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	launches := make([]*FakeAWXLaunch, len(c.launches))
+	copy(launches, c.launches)
+	return launches
+}
+
+// Cancellations returns the identifiers of the jobs cancelled so far, in the order they were
+// cancelled.
+//
+func (c *FakeAWXConnection) Cancellations() []int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cancellations := make([]int, len(c.cancellations))
+	copy(cancellations, c.cancellations)
+	return cancellations
+}
+
+// WorkflowCancellations returns the identifiers of the workflow jobs cancelled so far, in the order
+// they were cancelled.
+//
+func (c *FakeAWXConnection) WorkflowCancellations() []int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cancellations := make([]int, len(c.workflowCancellations))
+	copy(cancellations, c.workflowCancellations)
+	return cancellations
+}
@@ -0,0 +1,164 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"fmt"
+	"sync"
+
+	batch "k8s.io/api/batch/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+// FakeHealerCall contains the details of one of the actions received by the fake healer.
+//
+type FakeHealerCall struct {
+	Rule   *autoheal.HealingRule
+	Action interface{}
+	Alert  *alertmanager.Alert
+}
+
+// FakeHealer replaces the real action runners in tests. It implements the runner.ActionRunner
+// interface, so it can be registered as the AWX, batch, plugin or webhook runner of a healer, and instead of
+// executing the actions it receives it records them and returns the configured responses.
+//
+type FakeHealer struct {
+	// The errors returned when running AWX, batch, plugin and webhook actions. Nil means that the
+	// action succeeds.
+	AWXJobError   error
+	BatchJobError error
+	PluginError   error
+	WebhookError  error
+
+	mutex *sync.Mutex
+	calls []*FakeHealerCall
+}
+
+// NewFakeHealer creates a fake healer that accepts all the actions.
+//
+func NewFakeHealer() *FakeHealer {
+	return &FakeHealer{
+		mutex: &sync.Mutex{},
+	}
+}
+
+// RunAction records the action and returns the response configured for its type.
+//
+func (h *FakeHealer) RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.calls = append(h.calls, &FakeHealerCall{
+		Rule:   rule,
+		Action: action,
+		Alert:  alert,
+	})
+	switch action.(type) {
+	case *autoheal.AWXJobAction, *autoheal.AWXWorkflowAction:
+		return h.runAWXJob()
+	case *batch.Job:
+		return h.runBatchJob()
+	case *autoheal.PluginAction:
+		return h.runPlugin()
+	case *autoheal.WebhookAction:
+		return h.runWebhook()
+	default:
+		return fmt.Errorf("Don't know how to run action of type '%T'", action)
+	}
+}
+
+func (h *FakeHealer) runAWXJob() error {
+	return h.AWXJobError
+}
+
+func (h *FakeHealer) runBatchJob() error {
+	return h.BatchJobError
+}
+
+func (h *FakeHealer) runPlugin() error {
+	return h.PluginError
+}
+
+func (h *FakeHealer) runWebhook() error {
+	return h.WebhookError
+}
+
+// Calls returns all the actions received so far, in the order they were received.
+//
+func (h *FakeHealer) Calls() []*FakeHealerCall {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	calls := make([]*FakeHealerCall, len(h.calls))
+	copy(calls, h.calls)
+	return calls
+}
+
+// AWXJobs returns the AWX actions received so far.
+//
+func (h *FakeHealer) AWXJobs() []*FakeHealerCall {
+	return h.filter(func(action interface{}) bool {
+		_, ok := action.(*autoheal.AWXJobAction)
+		return ok
+	})
+}
+
+// AWXWorkflowJobs returns the AWX workflow actions received so far.
+//
+func (h *FakeHealer) AWXWorkflowJobs() []*FakeHealerCall {
+	return h.filter(func(action interface{}) bool {
+		_, ok := action.(*autoheal.AWXWorkflowAction)
+		return ok
+	})
+}
+
+// BatchJobs returns the batch actions received so far.
+//
+func (h *FakeHealer) BatchJobs() []*FakeHealerCall {
+	return h.filter(func(action interface{}) bool {
+		_, ok := action.(*batch.Job)
+		return ok
+	})
+}
+
+// Plugins returns the plugin actions received so far.
+//
+func (h *FakeHealer) Plugins() []*FakeHealerCall {
+	return h.filter(func(action interface{}) bool {
+		_, ok := action.(*autoheal.PluginAction)
+		return ok
+	})
+}
+
+// Webhooks returns the webhook actions received so far.
+//
+func (h *FakeHealer) Webhooks() []*FakeHealerCall {
+	return h.filter(func(action interface{}) bool {
+		_, ok := action.(*autoheal.WebhookAction)
+		return ok
+	})
+}
+
+func (h *FakeHealer) filter(accept func(action interface{}) bool) []*FakeHealerCall {
+	var result []*FakeHealerCall
+	for _, call := range h.Calls() {
+		if accept(call.Action) {
+			result = append(result, call)
+		}
+	}
+	return result
+}
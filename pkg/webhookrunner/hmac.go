@@ -0,0 +1,61 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the functions used to sign the bodies of the requests sent to webhooks, so
+// that the receivers can check that they were sent by the auto-heal service.
+
+package webhookrunner
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// SignatureHeader is the name of the HTTP header that contains the signature of the body.
+//
+const SignatureHeader = "X-Autoheal-Signature"
+
+// signaturePrefix is the prefix of the signature that identifies the hash algorithm.
+//
+const signaturePrefix = "sha256="
+
+// Sign calculates the HMAC-SHA256 of the given body using the given secret. The result is the
+// value of the signature header, the hexadecimal representation of the HMAC with the 'sha256='
+// prefix.
+//
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the given signature, in the format returned by the Sign function, is the
+// signature of the given body calculated with the given secret.
+//
+func Verify(body []byte, secret, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	actual, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(actual, mac.Sum(nil))
+}
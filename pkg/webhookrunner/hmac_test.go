@@ -0,0 +1,73 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookrunner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"alert": "NodeDown"}`)
+	signature := Sign(body, "mysecret")
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("Expected signature to start with 'sha256=' but it is '%s'", signature)
+	}
+	if !Verify(body, "mysecret", signature) {
+		t.Errorf("Expected signature '%s' to be valid", signature)
+	}
+}
+
+func TestSignKnownValue(t *testing.T) {
+	// Calculated with `echo -n 'hello' | openssl dgst -sha256 -hmac 'secret'`:
+	expected := "sha256=88aab3ede8d3adf94d26ab90d3bafd4a2083070c3bcce9c014ee04a443847c0b"
+	actual := Sign([]byte("hello"), "secret")
+	if actual != expected {
+		t.Errorf("Expected signature '%s' but got '%s'", expected, actual)
+	}
+}
+
+func TestVerifyRejectsWrongSecret(t *testing.T) {
+	body := []byte(`{"alert": "NodeDown"}`)
+	signature := Sign(body, "mysecret")
+	if Verify(body, "othersecret", signature) {
+		t.Errorf("Expected signature to be rejected with a different secret")
+	}
+}
+
+func TestVerifyRejectsModifiedBody(t *testing.T) {
+	signature := Sign([]byte(`{"alert": "NodeDown"}`), "mysecret")
+	if Verify([]byte(`{"alert": "NodeUp"}`), "mysecret", signature) {
+		t.Errorf("Expected signature to be rejected for a modified body")
+	}
+}
+
+func TestVerifyRejectsMalformedSignature(t *testing.T) {
+	body := []byte(`{"alert": "NodeDown"}`)
+	signature := Sign(body, "mysecret")
+	malformed := []string{
+		"",
+		strings.TrimPrefix(signature, "sha256="),
+		"sha1=" + strings.TrimPrefix(signature, "sha256="),
+		"sha256=not-hex",
+	}
+	for _, value := range malformed {
+		if Verify(body, "mysecret", value) {
+			t.Errorf("Expected malformed signature '%s' to be rejected", value)
+		}
+	}
+}
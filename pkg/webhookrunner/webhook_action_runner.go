@@ -0,0 +1,240 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This file contains the action runner that sends the HTTP requests described by webhook actions.
+
+package webhookrunner
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+	"github.com/openshift/autoheal/pkg/runner"
+)
+
+// TokenKey is the key of the secret referenced by a webhook action that contains the bearer token.
+//
+const TokenKey = "token"
+
+// SigningSecretKey is the key of the signing secret referenced by a webhook action that contains
+// the secret used to sign the body of the request.
+//
+const SigningSecretKey = "secret"
+
+// maxErrorBodySize is the maximum number of bytes of the response body that are included in the
+// error returned when the server responds with an error status.
+//
+const maxErrorBodySize = 1024
+
+type Builder struct {
+	k8sClient kubernetes.Interface
+	timeout   time.Duration
+}
+
+type Runner struct {
+	// The Kubernetes client used to load the secrets that contain the tokens. It is optional, and
+	// actions that reference a secret will fail if it isn't available.
+	k8sClient kubernetes.Interface
+
+	// The HTTP clients used to send the requests, one that checks the TLS certificates of the
+	// servers and another that doesn't.
+	client         *http.Client
+	insecureClient *http.Client
+}
+
+func NewBuilder() *Builder {
+	b := new(Builder)
+	b.timeout = 30 * time.Second
+	return b
+}
+
+// KubernetesClient sets the Kubernetes client that will be used to load the secrets that contain
+// the tokens. It is optional, but actions that reference a secret will fail without it.
+//
+func (b *Builder) KubernetesClient(k8sClient kubernetes.Interface) *Builder {
+	b.k8sClient = k8sClient
+	return b
+}
+
+// Timeout sets how long to wait for the response of the server. The default is thirty seconds.
+//
+func (b *Builder) Timeout(timeout time.Duration) *Builder {
+	b.timeout = timeout
+	return b
+}
+
+func (b *Builder) Build() (*Runner, error) {
+	if b.timeout <= 0 {
+		return nil, fmt.Errorf("The webhook timeout must be positive, but it is %s", b.timeout)
+	}
+
+	runner := &Runner{
+		k8sClient: b.k8sClient,
+		client: &http.Client{
+			Timeout: b.timeout,
+		},
+		insecureClient: &http.Client{
+			Timeout: b.timeout,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+			},
+		},
+	}
+
+	return runner, nil
+}
+
+// Make sure that the runner implements the action runner interface:
+var _ runner.ActionRunner = &Runner{}
+
+// RunAction sends the HTTP request described by the given *autoheal.WebhookAction. The templates
+// inside the action have already been processed. Responses with a status code that isn't 2xx are
+// reported as errors.
+//
+func (r *Runner) RunAction(rule *autoheal.HealingRule, action interface{}, alert *alertmanager.Alert) error {
+	webhook := action.(*autoheal.WebhookAction)
+
+	// The URL is mandatory:
+	if webhook.URL == "" {
+		return fmt.Errorf(
+			"Can't send webhook for rule '%s' because it doesn't have an URL",
+			rule.ObjectMeta.Name,
+		)
+	}
+
+	// Create the request:
+	method := webhook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	request, err := http.NewRequest(method, webhook.URL, strings.NewReader(webhook.Body))
+	if err != nil {
+		return err
+	}
+	for name, value := range webhook.Headers {
+		request.Header.Set(name, value)
+	}
+	if webhook.SecretRef != nil {
+		token, err := r.loadSecretKey(webhook.SecretRef, TokenKey, "token")
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	if webhook.SigningSecretRef != nil {
+		secret, err := r.loadSecretKey(webhook.SigningSecretRef, SigningSecretKey, "signing secret")
+		if err != nil {
+			return err
+		}
+		request.Header.Set(SignatureHeader, Sign([]byte(webhook.Body), secret))
+	}
+
+	// Send the request:
+	glog.Infof(
+		"Sending webhook '%s %s' to heal alert '%s'",
+		method,
+		webhook.URL,
+		alert.Name(),
+	)
+	client := r.client
+	if webhook.TLSInsecure {
+		client = r.insecureClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Check the response:
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		return fmt.Errorf(
+			"Webhook '%s %s' for rule '%s' failed with status code %d: %s",
+			method,
+			webhook.URL,
+			rule.ObjectMeta.Name,
+			response.StatusCode,
+			strings.TrimSpace(string(body)),
+		)
+	}
+	glog.Infof(
+		"Webhook '%s %s' for rule '%s' succeeded with status code %d",
+		method,
+		webhook.URL,
+		rule.ObjectMeta.Name,
+		response.StatusCode,
+	)
+
+	return nil
+}
+
+// loadSecretKey loads the value of the given key from the secret with the given reference. The
+// description of the value is used in the error messages.
+//
+func (r *Runner) loadSecretKey(reference *core.SecretReference, key, description string) (string,
+	error) {
+	if reference.Name == "" || reference.Namespace == "" {
+		return "", fmt.Errorf(
+			"The name and the namespace of the webhook %s secret are mandatory",
+			description,
+		)
+	}
+	if r.k8sClient == nil {
+		return "", fmt.Errorf(
+			"Can't load webhook %s from secret '%s/%s' because there is no connection to the "+
+				"Kubernetes API",
+			description,
+			reference.Namespace,
+			reference.Name,
+		)
+	}
+	secret, err := r.k8sClient.CoreV1().Secrets(reference.Namespace).Get(reference.Name, meta.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf(
+			"Can't load webhook %s from secret '%s/%s': %s",
+			description,
+			reference.Namespace,
+			reference.Name,
+			err,
+		)
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf(
+			"Secret '%s/%s' doesn't contain the '%s' key",
+			reference.Namespace,
+			reference.Name,
+			key,
+		)
+	}
+	return strings.TrimSpace(string(value)), nil
+}
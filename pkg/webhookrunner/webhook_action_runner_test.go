@@ -0,0 +1,312 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhookrunner
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/openshift/autoheal/pkg/alertmanager"
+	"github.com/openshift/autoheal/pkg/apis/autoheal"
+)
+
+func TestRunActionSendsRequest(t *testing.T) {
+	var method, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		contentType = r.Header.Get("Content-Type")
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	action := &autoheal.WebhookAction{
+		URL: server.URL,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body: `{"node": "node0"}`,
+	}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPost {
+		t.Errorf("Expected the default method to be POST, but got '%s'", method)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Expected content type 'application/json', but got '%s'", contentType)
+	}
+	if body != `{"node": "node0"}` {
+		t.Errorf("Expected the body of the action to be sent, but got '%s'", body)
+	}
+}
+
+func TestRunActionUsesMethod(t *testing.T) {
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	}))
+	defer server.Close()
+
+	action := &autoheal.WebhookAction{
+		URL:    server.URL,
+		Method: http.MethodPut,
+	}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut {
+		t.Errorf("Expected method PUT, but got '%s'", method)
+	}
+}
+
+func TestRunActionFailsWithErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Pipeline doesn't exist", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	action := &autoheal.WebhookAction{
+		URL: server.URL,
+	}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err == nil {
+		t.Fatalf("Expected an error for a response with status 404")
+	}
+	if !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "Pipeline doesn't exist") {
+		t.Errorf("Expected the error to contain the status and the body, but got '%s'", err)
+	}
+}
+
+func TestRunActionRequiresURL(t *testing.T) {
+	action := &autoheal.WebhookAction{}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err == nil {
+		t.Errorf("Expected an error for an action without URL")
+	}
+}
+
+func TestRunActionSendsTokenFromSecret(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	secrets := &fakeSecrets{
+		items: map[string]*core.Secret{
+			"my-namespace/my-token": {
+				Data: map[string][]byte{
+					TokenKey: []byte("my-token\n"),
+				},
+			},
+		},
+	}
+	action := &autoheal.WebhookAction{
+		URL: server.URL,
+		SecretRef: &core.SecretReference{
+			Namespace: "my-namespace",
+			Name:      "my-token",
+		},
+	}
+	err := makeRunner(t, secrets).RunAction(makeRule(action), action, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer my-token" {
+		t.Errorf("Expected authorization 'Bearer my-token', but got '%s'", authorization)
+	}
+}
+
+func TestRunActionSignsBody(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	secrets := &fakeSecrets{
+		items: map[string]*core.Secret{
+			"my-namespace/my-signing": {
+				Data: map[string][]byte{
+					SigningSecretKey: []byte("my-secret\n"),
+				},
+			},
+		},
+	}
+	action := &autoheal.WebhookAction{
+		URL:  server.URL,
+		Body: `{"node": "node0"}`,
+		SigningSecretRef: &core.SecretReference{
+			Namespace: "my-namespace",
+			Name:      "my-signing",
+		},
+	}
+	err := makeRunner(t, secrets).RunAction(makeRule(action), action, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != action.Body {
+		t.Errorf("Expected body '%s', but got '%s'", action.Body, body)
+	}
+	if !Verify(body, "my-secret", signature) {
+		t.Errorf("Signature '%s' doesn't match the body", signature)
+	}
+}
+
+func TestRunActionDoesntSignWithoutSecret(t *testing.T) {
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	action := &autoheal.WebhookAction{
+		URL:  server.URL,
+		Body: `{"node": "node0"}`,
+	}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature != "" {
+		t.Errorf("Expected no signature without signing secret, but got '%s'", signature)
+	}
+}
+
+func TestRunActionFailsWithoutSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no request to be sent when the secret can't be loaded")
+	}))
+	defer server.Close()
+
+	action := &autoheal.WebhookAction{
+		URL: server.URL,
+		SecretRef: &core.SecretReference{
+			Namespace: "my-namespace",
+			Name:      "missing",
+		},
+	}
+	err := makeRunner(t, &fakeSecrets{}).RunAction(makeRule(action), action, makeAlert())
+	if err == nil {
+		t.Errorf("Expected an error when the secret doesn't exist")
+	}
+}
+
+func TestRunActionChecksCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	}))
+	defer server.Close()
+
+	action := &autoheal.WebhookAction{
+		URL: server.URL,
+	}
+	err := makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err == nil {
+		t.Errorf("Expected an error for a server with a certificate that isn't trusted")
+	}
+
+	action.TLSInsecure = true
+	err = makeRunner(t, nil).RunAction(makeRule(action), action, makeAlert())
+	if err != nil {
+		t.Errorf("Expected no error when the certificate isn't checked, but got '%s'", err)
+	}
+}
+
+func makeRunner(t *testing.T, secrets *fakeSecrets) *Runner {
+	builder := NewBuilder()
+	if secrets != nil {
+		builder.KubernetesClient(&fakeSecretsClient{secrets: secrets})
+	}
+	runner, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func makeRule(action *autoheal.WebhookAction) *autoheal.HealingRule {
+	return &autoheal.HealingRule{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "trigger-pipeline",
+		},
+		WebhookJob: action,
+	}
+}
+
+func makeAlert() *alertmanager.Alert {
+	return &alertmanager.Alert{
+		Labels: map[string]string{
+			"alertname": "NodeDown",
+		},
+	}
+}
+
+// fakeSecretsClient is a Kubernetes client that only implements the parts of the API used to load
+// secrets. Calling any other method will panic.
+//
+type fakeSecretsClient struct {
+	kubernetes.Interface
+	secrets *fakeSecrets
+}
+
+func (c *fakeSecretsClient) CoreV1() corev1.CoreV1Interface {
+	return &fakeCoreV1{secrets: c.secrets}
+}
+
+type fakeCoreV1 struct {
+	corev1.CoreV1Interface
+	secrets *fakeSecrets
+}
+
+func (c *fakeCoreV1) Secrets(namespace string) corev1.SecretInterface {
+	return &fakeNamespacedSecrets{secrets: c.secrets, namespace: namespace}
+}
+
+// fakeSecrets keeps the secrets in memory, indexed by namespace and name.
+//
+type fakeSecrets struct {
+	items map[string]*core.Secret
+}
+
+type fakeNamespacedSecrets struct {
+	corev1.SecretInterface
+	secrets   *fakeSecrets
+	namespace string
+}
+
+func (s *fakeNamespacedSecrets) Get(name string, options meta.GetOptions) (*core.Secret, error) {
+	secret, ok := s.secrets.items[s.namespace+"/"+name]
+	if !ok {
+		return nil, errors.NewNotFound(core.Resource("secrets"), name)
+	}
+	return secret, nil
+}
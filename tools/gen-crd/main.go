@@ -0,0 +1,432 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This tool generates the YAML manifest of the custom resource definition of the healing rules,
+// including the OpenAPI v3 schema used to validate them, from the Go types defined in the
+// pkg/apis/autoheal/v1alpha2 package.
+//
+// The schema is calculated from the JSON tags of the fields, and from the following markers in the
+// doc comments of fields and types:
+//
+//	+optional
+//	+kubebuilder:validation:Required
+//	+kubebuilder:validation:MinLength=<int>
+//	+kubebuilder:validation:MaxLength=<int>
+//	+kubebuilder:validation:Minimum=<int>
+//	+kubebuilder:validation:Maximum=<int>
+//	+kubebuilder:validation:Pattern=<regexp>
+//	+kubebuilder:validation:Enum=<value>;<value>;...
+//
+// Fields whose types come from other packages, like the batch jobs, are described as objects
+// without further validation.
+//
+// The controller-gen tool of the controller-tools project isn't used because it requires a version
+// of the Kubernetes libraries much newer than the one vendored by this project, and it only works
+// with Go modules. This tool only supports the markers above, so new markers need to be added here
+// before they are used in the types. The 'make verify' target checks that the manifest is up to
+// date.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// The header added to the generated manifest:
+const header = `#
+# Copyright (c) 2018 Red Hat, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#   http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+# Code generated by tools/gen-crd. DO NOT EDIT.
+
+`
+
+// The prefix of the validation markers:
+const validationMarker = "+kubebuilder:validation:"
+
+var (
+	inputDir   string
+	outputFile string
+	group      string
+	version    string
+	kind       string
+	plural     string
+)
+
+func init() {
+	flag.StringVar(&inputDir, "input", "pkg/apis/autoheal/v1alpha2", "Directory containing the Go types.")
+	flag.StringVar(&outputFile, "output", "", "File where the manifest will be written, default is standard output.")
+	flag.StringVar(&group, "group", "autoheal.openshift.io", "API group of the custom resource.")
+	flag.StringVar(&version, "version", "v1alpha2", "API version of the custom resource.")
+	flag.StringVar(&kind, "kind", "HealingRule", "Kind of the custom resource.")
+	flag.StringVar(&plural, "plural", "healingrules", "Plural name of the custom resource.")
+}
+
+func main() {
+	flag.Parse()
+
+	manifest, err := generate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't generate custom resource definition: %s\n", err)
+		os.Exit(1)
+	}
+
+	if outputFile == "" {
+		os.Stdout.Write(manifest)
+		return
+	}
+	err = ioutil.WriteFile(outputFile, manifest, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't write custom resource definition to '%s': %s\n", outputFile, err)
+		os.Exit(1)
+	}
+}
+
+// generate parses the types of the input directory and returns the YAML text of the custom
+// resource definition.
+//
+func generate() (manifest []byte, err error) {
+	types, err := parseTypes(inputDir)
+	if err != nil {
+		return
+	}
+	spec, ok := types[kind]
+	if !ok {
+		err = fmt.Errorf("Can't find type '%s' in directory '%s'", kind, inputDir)
+		return
+	}
+	schema, err := structSchema(types, spec.Type.(*ast.StructType))
+	if err != nil {
+		return
+	}
+
+	// Add the standard fields that aren't explicitly declared in the Go type:
+	properties := schema["properties"].(map[string]interface{})
+	properties["apiVersion"] = map[string]interface{}{
+		"type": "string",
+	}
+	properties["kind"] = map[string]interface{}{
+		"type": "string",
+	}
+	properties["metadata"] = map[string]interface{}{
+		"type": "object",
+	}
+
+	crd := map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1beta1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]interface{}{
+			"name": plural + "." + group,
+		},
+		"spec": map[string]interface{}{
+			"group":   group,
+			"version": version,
+			"scope":   "Namespaced",
+			"names": map[string]interface{}{
+				"kind":     kind,
+				"listKind": kind + "List",
+				"plural":   plural,
+				"singular": strings.ToLower(kind),
+			},
+			"validation": map[string]interface{}{
+				"openAPIV3Schema": schema,
+			},
+		},
+	}
+	data, err := yaml.Marshal(crd)
+	if err != nil {
+		return
+	}
+	manifest = append([]byte(header), data...)
+	return
+}
+
+// parseTypes parses the Go files of the given directory, excluding tests and generated files, and
+// returns a map containing the type specifications indexed by type name. The doc comments of the
+// declarations are moved to the type specifications, so that markers can be found there.
+//
+func parseTypes(dir string) (types map[string]*ast.TypeSpec, err error) {
+	fset := token.NewFileSet()
+	filter := func(info os.FileInfo) bool {
+		name := info.Name()
+		return !strings.HasSuffix(name, "_test.go") && !strings.HasPrefix(name, "zz_generated")
+	}
+	packages, err := parser.ParseDir(fset, dir, filter, parser.ParseComments)
+	if err != nil {
+		return
+	}
+	types = make(map[string]*ast.TypeSpec)
+	for _, pkg := range packages {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					if typeSpec.Doc == nil {
+						typeSpec.Doc = gen.Doc
+					}
+					types[typeSpec.Name.Name] = typeSpec
+				}
+			}
+		}
+	}
+	return
+}
+
+// structSchema calculates the schema of a struct type.
+//
+func structSchema(types map[string]*ast.TypeSpec, node *ast.StructType) (schema map[string]interface{},
+	err error) {
+	properties := make(map[string]interface{})
+	var required []string
+	for _, field := range node.Fields.List {
+		// Embedded fields, like the type and object metadata, aren't part of the schema:
+		if len(field.Names) == 0 {
+			continue
+		}
+		name := jsonName(field)
+		if name == "" {
+			continue
+		}
+		var property map[string]interface{}
+		property, err = typeSchema(types, field.Type)
+		if err != nil {
+			err = fmt.Errorf("Field '%s': %s", field.Names[0].Name, err)
+			return
+		}
+		lines := commentLines(field.Doc)
+		description := descriptionText(lines)
+		if description != "" {
+			property["description"] = description
+		}
+		err = applyMarkers(property, lines)
+		if err != nil {
+			err = fmt.Errorf("Field '%s': %s", field.Names[0].Name, err)
+			return
+		}
+		if hasMarker(lines, validationMarker+"Required") {
+			required = append(required, name)
+		}
+		properties[name] = property
+	}
+	schema = map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return
+}
+
+// typeSchema calculates the schema of a type expression.
+//
+func typeSchema(types map[string]*ast.TypeSpec, expr ast.Expr) (schema map[string]interface{}, err error) {
+	switch typed := expr.(type) {
+	case *ast.StarExpr:
+		return typeSchema(types, typed.X)
+	case *ast.ArrayType:
+		var items map[string]interface{}
+		items, err = typeSchema(types, typed.Elt)
+		if err != nil {
+			return
+		}
+		schema = map[string]interface{}{
+			"type":  "array",
+			"items": items,
+		}
+	case *ast.MapType:
+		schema = map[string]interface{}{
+			"type": "object",
+		}
+		if _, ok := typed.Value.(*ast.InterfaceType); !ok {
+			var values map[string]interface{}
+			values, err = typeSchema(types, typed.Value)
+			if err != nil {
+				return
+			}
+			schema["additionalProperties"] = values
+		}
+	case *ast.StructType:
+		schema, err = structSchema(types, typed)
+	case *ast.SelectorExpr:
+		// Types from other packages aren't described in detail:
+		schema = map[string]interface{}{
+			"type": "object",
+		}
+	case *ast.Ident:
+		schema, err = identSchema(types, typed.Name)
+	default:
+		err = fmt.Errorf("Don't know how to generate schema for expression of type '%T'", expr)
+	}
+	return
+}
+
+// identSchema calculates the schema of a named type, either a basic type or one of the types
+// declared in the input directory.
+//
+func identSchema(types map[string]*ast.TypeSpec, name string) (schema map[string]interface{}, err error) {
+	switch name {
+	case "string":
+		schema = map[string]interface{}{"type": "string"}
+		return
+	case "bool":
+		schema = map[string]interface{}{"type": "boolean"}
+		return
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		schema = map[string]interface{}{"type": "integer"}
+		return
+	case "float32", "float64":
+		schema = map[string]interface{}{"type": "number"}
+		return
+	}
+	spec, ok := types[name]
+	if !ok {
+		err = fmt.Errorf("Can't find type '%s'", name)
+		return
+	}
+	schema, err = typeSchema(types, spec.Type)
+	if err != nil {
+		return
+	}
+	err = applyMarkers(schema, commentLines(spec.Doc))
+	return
+}
+
+// jsonName returns the name of the field in the JSON representation, or an empty string if the
+// field isn't serialized.
+//
+func jsonName(field *ast.Field) string {
+	name := field.Names[0].Name
+	if field.Tag == nil {
+		return name
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return name
+	}
+	value := reflect.StructTag(tag).Get("json")
+	if value == "-" {
+		return ""
+	}
+	if comma := strings.Index(value, ","); comma >= 0 {
+		value = value[:comma]
+	}
+	if value == "" {
+		return name
+	}
+	return value
+}
+
+// commentLines returns the lines of a comment, without the comment markers and without leading and
+// trailing blanks.
+//
+func commentLines(group *ast.CommentGroup) []string {
+	if group == nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(group.Text(), "\n") {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return lines
+}
+
+// descriptionText joins the lines of a comment that aren't markers.
+//
+func descriptionText(lines []string) string {
+	var words []string
+	for _, line := range lines {
+		if line == "" || strings.HasPrefix(line, "+") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return strings.Join(words, " ")
+}
+
+// hasMarker checks if the given comment lines contain the given marker.
+//
+func hasMarker(lines []string, marker string) bool {
+	for _, line := range lines {
+		if line == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMarkers adds to the schema the validations indicated by the markers in the given comment
+// lines.
+//
+func applyMarkers(schema map[string]interface{}, lines []string) error {
+	for _, line := range lines {
+		if !strings.HasPrefix(line, validationMarker) {
+			continue
+		}
+		marker := strings.TrimPrefix(line, validationMarker)
+		equals := strings.Index(marker, "=")
+		if equals < 0 {
+			if marker == "Required" {
+				continue
+			}
+			return fmt.Errorf("Marker '%s' doesn't have a value", line)
+		}
+		name, value := marker[:equals], marker[equals+1:]
+		switch name {
+		case "MinLength", "MaxLength", "Minimum", "Maximum":
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("Value of marker '%s' isn't an integer: %s", line, err)
+			}
+			key := strings.ToLower(name[:1]) + name[1:]
+			schema[key] = number
+		case "Pattern":
+			schema["pattern"] = value
+		case "Enum":
+			schema["enum"] = strings.Split(value, ";")
+		default:
+			return fmt.Errorf("Unknown marker '%s'", line)
+		}
+	}
+	return nil
+}